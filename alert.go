@@ -500,11 +500,7 @@ func (n *AlertNode) runAlert([]byte) error {
 	n.statMap.Set(statsCritsTriggered, n.critsTriggered)
 
 	// Setup consumer
-	consumer := edge.NewGroupedConsumer(
-		n.ins[0],
-		n,
-	)
-	n.statMap.Set(statCardinalityGauge, consumer.CardinalityVar())
+	consumer := n.newGroupedConsumer(n)
 
 	if err := consumer.Consume(); err != nil {
 		return err
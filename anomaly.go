@@ -0,0 +1,241 @@
+package kapacitor
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/influxdata/kapacitor/edge"
+	"github.com/influxdata/kapacitor/models"
+	"github.com/influxdata/kapacitor/pipeline"
+	"github.com/pkg/errors"
+)
+
+type AnomalyNode struct {
+	node
+	a *pipeline.AnomalyNode
+
+	scoreField    string
+	expectedField string
+	lowerField    string
+	upperField    string
+
+	// Guards the baselines, which are read by snapshots while points are processed.
+	mu        sync.Mutex
+	baselines map[models.GroupID]*anomalyBaseline
+}
+
+// Create a new AnomalyNode which scores values against learned baselines.
+func newAnomalyNode(et *ExecutingTask, n *pipeline.AnomalyNode, d NodeDiagnostic) (*AnomalyNode, error) {
+	an := &AnomalyNode{
+		node:          node{Node: n, et: et, diag: d},
+		a:             n,
+		scoreField:    n.As + "_score",
+		expectedField: n.As + "_expected",
+		lowerField:    n.As + "_lower",
+		upperField:    n.As + "_upper",
+		baselines:     make(map[models.GroupID]*anomalyBaseline),
+	}
+	an.node.runF = an.runAnomaly
+	return an, nil
+}
+
+func (n *AnomalyNode) runAnomaly(snapshot []byte) error {
+	if snapshot != nil {
+		if err := n.restore(snapshot); err != nil {
+			// Do not fail the task, the baselines are learned again.
+			n.diag.Error("failed to restore anomaly baselines", err)
+		}
+	}
+	consumer := n.newGroupedConsumer(n)
+	return consumer.Consume()
+}
+
+// anomalySnapshot is the snapshot of the baselines of all groups.
+type anomalySnapshot struct {
+	Season    string                              `json:"season"`
+	Baselines map[models.GroupID]*anomalyBaseline `json:"baselines"`
+}
+
+func (n *AnomalyNode) snapshot() ([]byte, error) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	return json.Marshal(anomalySnapshot{
+		Season:    n.a.Season,
+		Baselines: n.baselines,
+	})
+}
+
+func (n *AnomalyNode) restore(data []byte) error {
+	var s anomalySnapshot
+	if err := json.Unmarshal(data, &s); err != nil {
+		return errors.Wrap(err, "failed to decode anomaly snapshot")
+	}
+	// Baselines of a different season cannot be used.
+	if s.Season != n.a.Season {
+		return nil
+	}
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	buckets := anomalyBuckets(n.a.Season)
+	for id, b := range s.Baselines {
+		if b != nil && len(b.Buckets) == buckets {
+			n.baselines[id] = b
+		}
+	}
+	return nil
+}
+
+func (n *AnomalyNode) NewGroup(group edge.GroupInfo, first edge.PointMeta) (edge.Receiver, error) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	b, ok := n.baselines[group.ID]
+	if !ok {
+		b = &anomalyBaseline{
+			Buckets: make([]ewmaStats, anomalyBuckets(n.a.Season)),
+		}
+		n.baselines[group.ID] = b
+	}
+	return edge.NewReceiverFromForwardReceiverWithStats(
+		n.outs,
+		edge.NewTimedForwardReceiver(n.timer, &anomalyGroup{
+			n:        n,
+			id:       group.ID,
+			baseline: b,
+		}),
+	), nil
+}
+
+type anomalyGroup struct {
+	n        *AnomalyNode
+	id       models.GroupID
+	baseline *anomalyBaseline
+}
+
+func (g *anomalyGroup) BeginBatch(begin edge.BeginBatchMessage) (edge.Message, error) {
+	return begin, nil
+}
+
+func (g *anomalyGroup) BatchPoint(bp edge.BatchPointMessage) (edge.Message, error) {
+	bp = bp.ShallowCopy()
+	if err := g.score(bp); err != nil {
+		g.n.diag.Error("failed to score point", err)
+		return nil, nil
+	}
+	return bp, nil
+}
+
+func (g *anomalyGroup) EndBatch(end edge.EndBatchMessage) (edge.Message, error) {
+	return end, nil
+}
+
+func (g *anomalyGroup) Point(p edge.PointMessage) (edge.Message, error) {
+	p = p.ShallowCopy()
+	if err := g.score(p); err != nil {
+		g.n.diag.Error("failed to score point", err)
+		return nil, nil
+	}
+	return p, nil
+}
+
+func (g *anomalyGroup) score(p edge.FieldsTagsTimeSetter) error {
+	var value float64
+	switch v := p.Fields()[g.n.a.Field].(type) {
+	case float64:
+		value = v
+	case int64:
+		value = float64(v)
+	case nil:
+		return fmt.Errorf("missing field %q", g.n.a.Field)
+	default:
+		return fmt.Errorf("field %q is not a number, got %T", g.n.a.Field, v)
+	}
+
+	g.n.mu.Lock()
+	s := &g.baseline.Buckets[anomalyBucket(g.n.a.Season, p.Time())]
+	expected, stddev, count := s.Mean, math.Sqrt(s.Variance), s.Count
+	if count == 0 {
+		expected = value
+	}
+	s.update(value, g.n.a.Alpha)
+	g.n.mu.Unlock()
+
+	score := 0.0
+	if count >= g.n.a.Warmup && stddev > 0 {
+		score = (value - expected) / stddev
+	}
+	fields := p.Fields().Copy()
+	fields[g.n.scoreField] = score
+	fields[g.n.expectedField] = expected
+	fields[g.n.lowerField] = expected - g.n.a.Sigmas*stddev
+	fields[g.n.upperField] = expected + g.n.a.Sigmas*stddev
+	p.SetFields(fields)
+	return nil
+}
+
+func (g *anomalyGroup) Barrier(b edge.BarrierMessage) (edge.Message, error) {
+	return b, nil
+}
+
+func (g *anomalyGroup) DeleteGroup(d edge.DeleteGroupMessage) (edge.Message, error) {
+	g.n.mu.Lock()
+	delete(g.n.baselines, g.id)
+	g.n.mu.Unlock()
+	return d, nil
+}
+
+// anomalyBaseline is the baseline of a group, with one bucket per season.
+type anomalyBaseline struct {
+	Buckets []ewmaStats `json:"buckets"`
+}
+
+// ewmaStats is an exponentially weighted moving mean and variance.
+type ewmaStats struct {
+	Count    int64   `json:"count"`
+	Mean     float64 `json:"mean"`
+	Variance float64 `json:"variance"`
+}
+
+func (s *ewmaStats) update(value, alpha float64) {
+	s.Count++
+	if s.Count == 1 {
+		s.Mean = value
+		s.Variance = 0
+		return
+	}
+	diff := value - s.Mean
+	incr := alpha * diff
+	s.Mean += incr
+	s.Variance = (1 - alpha) * (s.Variance + diff*incr)
+}
+
+// anomalyBuckets returns the number of baselines per group for the season.
+func anomalyBuckets(season string) int {
+	switch season {
+	case pipeline.AnomalyHourOfDay:
+		return 24
+	case pipeline.AnomalyDayOfWeek:
+		return 7
+	case pipeline.AnomalyHourOfWeek:
+		return 7 * 24
+	default:
+		return 1
+	}
+}
+
+// anomalyBucket returns the index of the baseline of the time for the season.
+func anomalyBucket(season string, t time.Time) int {
+	t = t.UTC()
+	switch season {
+	case pipeline.AnomalyHourOfDay:
+		return t.Hour()
+	case pipeline.AnomalyDayOfWeek:
+		return int(t.Weekday())
+	case pipeline.AnomalyHourOfWeek:
+		return int(t.Weekday())*24 + t.Hour()
+	default:
+		return 0
+	}
+}
@@ -0,0 +1,93 @@
+package kapacitor
+
+import (
+	"testing"
+	"time"
+
+	"github.com/influxdata/kapacitor/models"
+	"github.com/influxdata/kapacitor/pipeline"
+)
+
+func TestEWMAStats(t *testing.T) {
+	var s ewmaStats
+	for _, v := range []float64{10, 10, 10, 10} {
+		s.update(v, 0.5)
+	}
+	if s.Mean != 10 || s.Variance != 0 || s.Count != 4 {
+		t.Fatalf("unexpected stats of constant values: %+v", s)
+	}
+	s.update(20, 0.5)
+	if s.Mean != 15 {
+		t.Errorf("unexpected mean, got %v exp 15", s.Mean)
+	}
+	// (1 - 0.5) * (0 + 10 * 5)
+	if s.Variance != 25 {
+		t.Errorf("unexpected variance, got %v exp 25", s.Variance)
+	}
+}
+
+func TestAnomalyBucket(t *testing.T) {
+	// Wednesday
+	tm := time.Date(2017, 3, 15, 13, 30, 0, 0, time.UTC)
+	testCases := []struct {
+		season string
+		exp    int
+	}{
+		{season: "", exp: 0},
+		{season: pipeline.AnomalyHourOfDay, exp: 13},
+		{season: pipeline.AnomalyDayOfWeek, exp: 3},
+		{season: pipeline.AnomalyHourOfWeek, exp: 3*24 + 13},
+	}
+	for _, tc := range testCases {
+		got := anomalyBucket(tc.season, tm)
+		if got != tc.exp {
+			t.Errorf("unexpected bucket for season %q: got %d exp %d", tc.season, got, tc.exp)
+		}
+		if got >= anomalyBuckets(tc.season) {
+			t.Errorf("bucket %d out of range for season %q", got, tc.season)
+		}
+	}
+}
+
+func TestAnomalyNode_SnapshotRestore(t *testing.T) {
+	pn := &pipeline.AnomalyNode{Season: pipeline.AnomalyDayOfWeek}
+	n := &AnomalyNode{
+		a:         pn,
+		baselines: make(map[models.GroupID]*anomalyBaseline),
+	}
+	b := &anomalyBaseline{Buckets: make([]ewmaStats, 7)}
+	b.Buckets[2] = ewmaStats{Count: 3, Mean: 4.5, Variance: 0.25}
+	n.baselines["host=a"] = b
+
+	data, err := n.snapshot()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	restored := &AnomalyNode{
+		a:         pn,
+		baselines: make(map[models.GroupID]*anomalyBaseline),
+	}
+	if err := restored.restore(data); err != nil {
+		t.Fatal(err)
+	}
+	got, ok := restored.baselines["host=a"]
+	if !ok {
+		t.Fatal("missing restored baseline")
+	}
+	if got.Buckets[2] != b.Buckets[2] {
+		t.Errorf("unexpected restored bucket: got %+v exp %+v", got.Buckets[2], b.Buckets[2])
+	}
+
+	// Baselines of a different season are dropped.
+	other := &AnomalyNode{
+		a:         &pipeline.AnomalyNode{Season: pipeline.AnomalyHourOfDay},
+		baselines: make(map[models.GroupID]*anomalyBaseline),
+	}
+	if err := other.restore(data); err != nil {
+		t.Fatal(err)
+	}
+	if len(other.baselines) != 0 {
+		t.Errorf("expected no baselines, got %d", len(other.baselines))
+	}
+}
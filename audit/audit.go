@@ -0,0 +1,34 @@
+// Package audit defines the records of the audit log of API mutations.
+package audit
+
+import "time"
+
+// Actions of audit records.
+const (
+	CreateAction  = "create"
+	UpdateAction  = "update"
+	DeleteAction  = "delete"
+	EnableAction  = "enable"
+	DisableAction = "disable"
+)
+
+// Record of a single mutating API request.
+type Record struct {
+	Time time.Time `json:"time"`
+	// Name of the authenticated user, empty if authentication is disabled.
+	User string `json:"user"`
+	// Path of the resource relative to the API base path, i.e. /tasks/cpu_alert.
+	Resource string `json:"resource"`
+	Action   string `json:"action"`
+	Method   string `json:"method"`
+	Status   int    `json:"status"`
+	// Digest of the resource before the request, empty if it did not exist.
+	Before string `json:"before,omitempty"`
+	// Digest of the resource returned by the request, empty if it was deleted or the request failed.
+	After string `json:"after,omitempty"`
+}
+
+// Recorder records audit records.
+type Recorder interface {
+	Record(r Record)
+}
@@ -54,6 +54,16 @@ func (p Privilege) String() string {
 	}
 }
 
+// ParsePrivilege returns the privilege with the name returned by String.
+func ParsePrivilege(s string) (Privilege, error) {
+	for _, p := range PrivilegeList {
+		if p.String() == s {
+			return p, nil
+		}
+	}
+	return NoPrivileges, fmt.Errorf("unknown privilege %q", s)
+}
+
 type Action struct {
 	Resource  string
 	Privilege Privilege
@@ -1,13 +1,23 @@
 package kapacitor
 
 import (
+	"bytes"
+	"encoding/json"
 	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"text/template"
 	"time"
 
 	"github.com/influxdata/kapacitor/edge"
 	"github.com/influxdata/kapacitor/expvar"
 	"github.com/influxdata/kapacitor/models"
 	"github.com/influxdata/kapacitor/pipeline"
+	"github.com/influxdata/kapacitor/services/httppost"
 	k8s "github.com/influxdata/kapacitor/services/k8s/client"
 	swarm "github.com/influxdata/kapacitor/services/swarm/client"
 	"github.com/influxdata/kapacitor/tick/ast"
@@ -19,6 +29,7 @@ const (
 	statsAutoscaleIncreaseEventsCount = "increase_events"
 	statsAutoscaleDecreaseEventsCount = "decrease_events"
 	statsAutoscaleCooldownDropsCount  = "cooldown_drops"
+	statsAutoscalePolicyLimitsCount   = "policy_limits"
 )
 
 type resourceID interface {
@@ -36,6 +47,10 @@ type resourceState struct {
 	lastIncrease time.Time
 	lastDecrease time.Time
 	current      int
+	// Desired replica counts within the stabilization windows.
+	recommendations []timedReplicas
+	// Changes to the replicas within the longest policy period.
+	changes []timedReplicas
 }
 
 type event struct {
@@ -57,14 +72,16 @@ type AutoscaleNode struct {
 	increaseCount      *expvar.Int
 	decreaseCount      *expvar.Int
 	cooldownDropsCount *expvar.Int
+	policyLimitsCount  *expvar.Int
 
-	min int
-	max int
+	behavior autoscaleBehavior
 
 	increaseCooldown time.Duration
 	decreaseCooldown time.Duration
 
 	currentField string
+
+	dryRun bool
 }
 
 // Create a new AutoscaleNode which can trigger autoscale events.
@@ -73,15 +90,15 @@ func newAutoscaleNode(
 	d NodeDiagnostic,
 	n pipeline.Node,
 	a autoscaler,
-	min,
-	max int,
+	behavior autoscaleBehavior,
 	increaseCooldown,
 	decreaseCooldown time.Duration,
 	currentField string,
 	replicas *ast.LambdaNode,
+	dryRun bool,
 ) (*AutoscaleNode, error) {
-	if min < 1 {
-		return nil, fmt.Errorf("minimum count must be >= 1, got %d", min)
+	if behavior.min < 1 {
+		return nil, fmt.Errorf("minimum count must be >= 1, got %d", behavior.min)
 	}
 	// Initialize the replicas lambda expression scope pool
 	replicasExpr, err := stateful.NewExpression(replicas.Expression)
@@ -92,14 +109,14 @@ func newAutoscaleNode(
 	kn := &AutoscaleNode{
 		node:              node{Node: n, et: et, diag: d},
 		resourceStates:    make(map[string]resourceState),
-		min:               min,
-		max:               max,
+		behavior:          behavior,
 		increaseCooldown:  increaseCooldown,
 		decreaseCooldown:  decreaseCooldown,
 		currentField:      currentField,
 		a:                 a,
 		replicasExpr:      replicasExpr,
 		replicasScopePool: replicasScopePool,
+		dryRun:            dryRun,
 	}
 	kn.node.runF = kn.runAutoscale
 	return kn, nil
@@ -109,16 +126,14 @@ func (n *AutoscaleNode) runAutoscale([]byte) error {
 	n.increaseCount = &expvar.Int{}
 	n.decreaseCount = &expvar.Int{}
 	n.cooldownDropsCount = &expvar.Int{}
+	n.policyLimitsCount = &expvar.Int{}
 
 	n.statMap.Set(statsAutoscaleIncreaseEventsCount, n.increaseCount)
 	n.statMap.Set(statsAutoscaleDecreaseEventsCount, n.decreaseCount)
 	n.statMap.Set(statsAutoscaleCooldownDropsCount, n.cooldownDropsCount)
+	n.statMap.Set(statsAutoscalePolicyLimitsCount, n.policyLimitsCount)
 
-	consumer := edge.NewGroupedConsumer(
-		n.ins[0],
-		n,
-	)
-	n.statMap.Set(statCardinalityGauge, consumer.CardinalityVar())
+	consumer := n.newGroupedConsumer(n)
 	return consumer.Consume()
 }
 
@@ -200,18 +215,23 @@ func (n *AutoscaleNode) handlePoint(streamName string, dims models.Dimensions, p
 		return nil, errors.Wrap(err, "failed to evaluate the replicas expression")
 	}
 
+	t := p.Time()
+
+	// Stabilize the desired replicas, keeping the recommendation even if nothing changes.
+	newReplicas = n.behavior.stabilize(&state, newReplicas, t)
+	n.resourceStates[id.ID()] = state
+
+	// Limit the rate of change
+	newReplicas, limited := n.behavior.limit(&state, newReplicas, t)
+	if limited {
+		n.policyLimitsCount.Add(1)
+	}
+
 	// Create the event
 	e := event{
 		ID:  id,
 		Old: state.current,
-		New: newReplicas,
-	}
-	// Check bounds
-	if n.max > 0 && e.New > n.max {
-		e.New = n.max
-	}
-	if e.New < n.min {
-		e.New = n.min
+		New: n.behavior.clamp(newReplicas, t),
 	}
 
 	// Validate something changed
@@ -225,7 +245,6 @@ func (n *AutoscaleNode) handlePoint(streamName string, dims models.Dimensions, p
 	state.current = e.New
 
 	// Check last change cooldown times
-	t := p.Time()
 	var counter *expvar.Int
 	switch {
 	case change > 0:
@@ -247,9 +266,12 @@ func (n *AutoscaleNode) handlePoint(streamName string, dims models.Dimensions, p
 	}
 
 	// We have a valid event to apply
-	if err := n.applyEvent(e); err != nil {
-		return nil, errors.Wrap(err, "failed to apply scaling event")
+	if !n.dryRun {
+		if err := n.applyEvent(e); err != nil {
+			return nil, errors.Wrap(err, "failed to apply scaling event")
+		}
 	}
+	n.behavior.recordChange(&state, change, t)
 
 	// Only save the updated state if we were successful
 	n.resourceStates[id.ID()] = state
@@ -267,14 +289,19 @@ func (n *AutoscaleNode) handlePoint(streamName string, dims models.Dimensions, p
 	}
 	n.a.SetResourceIDOnTags(id, newTags)
 
+	fields := models.Fields{
+		"old": int64(e.Old),
+		"new": int64(e.New),
+	}
+	if n.dryRun {
+		fields["dry_run"] = true
+	}
+
 	// Create point representing the event
 	return edge.NewPointMessage(
 		streamName, "", "",
 		dims,
-		models.Fields{
-			"old": int64(e.Old),
-			"new": int64(e.New),
-		},
+		fields,
 		newTags,
 		t,
 	), nil
@@ -345,17 +372,30 @@ func newK8sAutoscaleNode(et *ExecutingTask, n *pipeline.K8sAutoscaleNode, d Node
 		kind:            n.Kind,
 		namespace:       n.Namespace,
 	}
+	behavior, err := newAutoscaleBehavior(
+		int(n.Min),
+		int(n.Max),
+		n.IncreasePolicies,
+		n.DecreasePolicies,
+		n.SelectPolicy,
+		n.IncreaseStabilization,
+		n.DecreaseStabilization,
+		n.Schedules,
+	)
+	if err != nil {
+		return nil, err
+	}
 	return newAutoscaleNode(
 		et,
 		d,
 		n,
 		a,
-		int(n.Min),
-		int(n.Max),
+		behavior,
 		n.IncreaseCooldown,
 		n.DecreaseCooldown,
 		n.CurrentField,
 		n.Replicas,
+		n.IsDryRun,
 	)
 }
 
@@ -470,17 +510,30 @@ func newSwarmAutoscaleNode(et *ExecutingTask, n *pipeline.SwarmAutoscaleNode, d
 		serviceNameTag:       n.ServiceNameTag,
 		outputServiceNameTag: outputServiceNameTag,
 	}
+	behavior, err := newAutoscaleBehavior(
+		int(n.Min),
+		int(n.Max),
+		n.IncreasePolicies,
+		n.DecreasePolicies,
+		n.SelectPolicy,
+		n.IncreaseStabilization,
+		n.DecreaseStabilization,
+		n.Schedules,
+	)
+	if err != nil {
+		return nil, err
+	}
 	return newAutoscaleNode(
 		et,
 		d,
 		n,
 		a,
-		int(n.Min),
-		int(n.Max),
+		behavior,
 		n.IncreaseCooldown,
 		n.DecreaseCooldown,
 		n.CurrentField,
 		n.Replicas,
+		n.IsDryRun,
 	)
 }
 
@@ -536,3 +589,212 @@ func (a *swarmAutoscaler) SetResourceIDOnTags(id resourceID, tags models.Tags) {
 		tags[a.outputServiceNameTag] = id.ID()
 	}
 }
+
+/////////////////////////////////////////////
+// HTTP implementation of Autoscaler
+
+type httpAutoscaler struct {
+	endpoint *httppost.Endpoint
+
+	resourceName    string
+	resourceNameTag string
+	resourceTag     string
+
+	replicasPath  *template.Template
+	replicasField string
+	scalePath     *template.Template
+	scaleMethod   string
+	scaleBody     *template.Template
+}
+
+// httpAutoscaleData is the data of the path and body templates of the httpAutoscale node.
+// The Name is escaped for the path or the JSON body it is executed for.
+type httpAutoscaleData struct {
+	Name     string
+	Replicas int
+}
+
+// pathEscape escapes the string for use as a single path segment.
+func pathEscape(s string) string {
+	return strings.Replace(url.QueryEscape(s), "+", "%20", -1)
+}
+
+// jsonEscape escapes the string for use within a JSON string.
+func jsonEscape(s string) string {
+	b, _ := json.Marshal(s)
+	return string(b[1 : len(b)-1])
+}
+
+func newHTTPAutoscaleNode(et *ExecutingTask, n *pipeline.HTTPAutoscaleNode, d NodeDiagnostic) (*AutoscaleNode, error) {
+	e, ok := et.tm.HTTPPostService.Endpoint(n.Endpoint)
+	if !ok {
+		return nil, fmt.Errorf("endpoint '%s' does not exist", n.Endpoint)
+	}
+	scalePath := n.ScalePath
+	if scalePath == "" {
+		scalePath = n.ReplicasPath
+	}
+	a := &httpAutoscaler{
+		endpoint:        e,
+		resourceName:    n.ResourceName,
+		resourceNameTag: n.ResourceNameTag,
+		resourceTag:     n.ResourceTag,
+		replicasField:   n.ReplicasField,
+		scaleMethod:     strings.ToUpper(n.ScaleMethod),
+	}
+	var err error
+	if a.replicasPath, err = template.New("replicasPath").Parse(n.ReplicasPath); err != nil {
+		return nil, errors.Wrap(err, "invalid replicasPath template")
+	}
+	if a.scalePath, err = template.New("scalePath").Parse(scalePath); err != nil {
+		return nil, errors.Wrap(err, "invalid scalePath template")
+	}
+	if a.scaleBody, err = template.New("scaleBody").Parse(n.ScaleBody); err != nil {
+		return nil, errors.Wrap(err, "invalid scaleBody template")
+	}
+	behavior, err := newAutoscaleBehavior(
+		int(n.Min),
+		int(n.Max),
+		n.IncreasePolicies,
+		n.DecreasePolicies,
+		n.SelectPolicy,
+		n.IncreaseStabilization,
+		n.DecreaseStabilization,
+		n.Schedules,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return newAutoscaleNode(
+		et,
+		d,
+		n,
+		a,
+		behavior,
+		n.IncreaseCooldown,
+		n.DecreaseCooldown,
+		n.CurrentField,
+		n.Replicas,
+		n.IsDryRun,
+	)
+}
+
+type httpResourceID string
+
+func (id httpResourceID) ID() string {
+	return string(id)
+}
+
+func (a *httpAutoscaler) ResourceIDFromTags(tags models.Tags) (resourceID, error) {
+	// Get the name of the resource
+	var name string
+	switch {
+	case a.resourceName != "":
+		name = a.resourceName
+	case a.resourceNameTag != "":
+		t, ok := tags[a.resourceNameTag]
+		if ok {
+			name = t
+		}
+	default:
+		return nil, errors.New("expected one of ResourceName or ResourceNameTag to be set")
+	}
+	if name == "" {
+		return nil, errors.New("could not determine the name of the resource")
+	}
+	return httpResourceID(name), nil
+}
+
+func executeTemplate(t *template.Template, data httpAutoscaleData) (string, error) {
+	var buf bytes.Buffer
+	if err := t.Execute(&buf, data); err != nil {
+		return "", errors.Wrapf(err, "failed to execute %s template", t.Name())
+	}
+	return buf.String(), nil
+}
+
+// do sends the request and decodes the JSON response into v, if v is not nil.
+func (a *httpAutoscaler) do(method, path string, body io.Reader, v interface{}) error {
+	req, err := a.endpoint.NewRequest(method, path, body)
+	if err != nil {
+		return err
+	}
+	if body != nil && req.Header.Get("Content-Type") == "" {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		data, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("unexpected response status %d from %s %s: %s", resp.StatusCode, method, req.URL, bytes.TrimSpace(data))
+	}
+	if v == nil {
+		return nil
+	}
+	return errors.Wrap(json.NewDecoder(resp.Body).Decode(v), "failed to decode response")
+}
+
+func (a *httpAutoscaler) Replicas(id resourceID) (int, error) {
+	path, err := executeTemplate(a.replicasPath, httpAutoscaleData{Name: pathEscape(id.ID())})
+	if err != nil {
+		return 0, err
+	}
+	var response interface{}
+	if err := a.do("GET", path, nil, &response); err != nil {
+		return 0, errors.Wrapf(err, "failed to get replicas for %q", id.ID())
+	}
+	replicas, err := jsonField(response, a.replicasField)
+	if err != nil {
+		return 0, errors.Wrapf(err, "failed to get replicas for %q", id.ID())
+	}
+	return replicas, nil
+}
+
+func (a *httpAutoscaler) SetReplicas(id resourceID, replicas int) error {
+	path, err := executeTemplate(a.scalePath, httpAutoscaleData{Name: pathEscape(id.ID()), Replicas: replicas})
+	if err != nil {
+		return err
+	}
+	body, err := executeTemplate(a.scaleBody, httpAutoscaleData{Name: jsonEscape(id.ID()), Replicas: replicas})
+	if err != nil {
+		return err
+	}
+	return a.do(a.scaleMethod, path, strings.NewReader(body), nil)
+}
+
+func (a *httpAutoscaler) SetResourceIDOnTags(id resourceID, tags models.Tags) {
+	if a.resourceTag != "" {
+		tags[a.resourceTag] = id.ID()
+	}
+}
+
+// jsonField returns the integer value of the field of a decoded JSON document.
+// Nested fields and array indexes are separated by '.'.
+func jsonField(v interface{}, field string) (int, error) {
+	for _, name := range strings.Split(field, ".") {
+		switch o := v.(type) {
+		case map[string]interface{}:
+			f, ok := o[name]
+			if !ok {
+				return 0, fmt.Errorf("missing field %q", field)
+			}
+			v = f
+		case []interface{}:
+			i, err := strconv.Atoi(name)
+			if err != nil || i < 0 || i >= len(o) {
+				return 0, fmt.Errorf("invalid index %q of field %q", name, field)
+			}
+			v = o[i]
+		default:
+			return 0, fmt.Errorf("missing field %q", field)
+		}
+	}
+	f, ok := v.(float64)
+	if !ok {
+		return 0, fmt.Errorf("field %q is not a number", field)
+	}
+	return int(f), nil
+}
@@ -0,0 +1,240 @@
+package kapacitor
+
+import (
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/gorhill/cronexpr"
+	"github.com/influxdata/kapacitor/pipeline"
+)
+
+// autoscaleBehavior shapes the desired replica counts of the replicas expression,
+// similar to the behavior of the Kubernetes Horizontal Pod Autoscaler.
+type autoscaleBehavior struct {
+	min int
+	max int
+
+	increasePolicies []pipeline.AutoscalePolicy
+	decreasePolicies []pipeline.AutoscalePolicy
+	// Use the policy that allows the smallest change instead of the largest.
+	selectMin bool
+
+	increaseStabilization time.Duration
+	decreaseStabilization time.Duration
+
+	schedules []autoscaleSchedule
+}
+
+type autoscaleSchedule struct {
+	expr     *cronexpr.Expression
+	duration time.Duration
+	min      int
+	max      int
+}
+
+// timedReplicas is a replica count or change in replicas at a point in time.
+type timedReplicas struct {
+	time     time.Time
+	replicas int
+}
+
+func newAutoscaleBehavior(
+	min,
+	max int,
+	increasePolicies,
+	decreasePolicies []pipeline.AutoscalePolicy,
+	selectPolicy string,
+	increaseStabilization,
+	decreaseStabilization time.Duration,
+	schedules []pipeline.AutoscaleSchedule,
+) (autoscaleBehavior, error) {
+	b := autoscaleBehavior{
+		min:                   min,
+		max:                   max,
+		increasePolicies:      increasePolicies,
+		decreasePolicies:      decreasePolicies,
+		selectMin:             selectPolicy == pipeline.AutoscaleSelectMin,
+		increaseStabilization: increaseStabilization,
+		decreaseStabilization: decreaseStabilization,
+	}
+	for _, s := range schedules {
+		expr, err := cronexpr.Parse(s.Cron)
+		if err != nil {
+			return autoscaleBehavior{}, fmt.Errorf("invalid schedule cron %q: %v", s.Cron, err)
+		}
+		b.schedules = append(b.schedules, autoscaleSchedule{
+			expr:     expr,
+			duration: s.Duration,
+			min:      int(s.Min),
+			max:      int(s.Max),
+		})
+	}
+	return b, nil
+}
+
+// bounds returns the min and max replicas at the time, a max of 0 means no upper limit.
+// The first schedule that is active at the time overrides the configured bounds.
+func (b autoscaleBehavior) bounds(t time.Time) (int, int) {
+	for _, s := range b.schedules {
+		// The schedule is active if it fired within the last duration.
+		if next := s.expr.Next(t.Add(-s.duration)); !next.IsZero() && !next.After(t) {
+			return s.min, s.max
+		}
+	}
+	return b.min, b.max
+}
+
+// clamp limits the replicas to the bounds at the time.
+func (b autoscaleBehavior) clamp(replicas int, t time.Time) int {
+	min, max := b.bounds(t)
+	if max > 0 && replicas > max {
+		replicas = max
+	}
+	if replicas < min {
+		replicas = min
+	}
+	return replicas
+}
+
+// stabilize records the desired replicas and returns the stabilized recommendation.
+// Increases only go up to the smallest desired count within the increase stabilization window
+// and decreases only go down to the largest desired count within the decrease stabilization window.
+func (b autoscaleBehavior) stabilize(state *resourceState, desired int, t time.Time) int {
+	window := b.increaseStabilization
+	if b.decreaseStabilization > window {
+		window = b.decreaseStabilization
+	}
+	if window == 0 {
+		return desired
+	}
+	state.recommendations = append(pruneReplicas(state.recommendations, t.Add(-window)), timedReplicas{
+		time:     t,
+		replicas: desired,
+	})
+
+	up, down := desired, desired
+	for _, r := range state.recommendations {
+		if r.time.After(t.Add(-b.increaseStabilization)) && r.replicas < up {
+			up = r.replicas
+		}
+		if r.time.After(t.Add(-b.decreaseStabilization)) && r.replicas > down {
+			down = r.replicas
+		}
+	}
+	recommendation := state.current
+	if recommendation < up {
+		recommendation = up
+	}
+	if recommendation > down {
+		recommendation = down
+	}
+	return recommendation
+}
+
+// limit applies the increase and decrease policies to the change from the current replicas.
+// It reports whether the desired replicas were limited.
+func (b autoscaleBehavior) limit(state *resourceState, desired int, t time.Time) (int, bool) {
+	switch {
+	case desired > state.current && len(b.increasePolicies) > 0:
+		limit := b.increaseLimit(state, t)
+		if desired > limit {
+			return limit, true
+		}
+	case desired < state.current && len(b.decreasePolicies) > 0:
+		limit := b.decreaseLimit(state, t)
+		if desired < limit {
+			return limit, true
+		}
+	}
+	return desired, false
+}
+
+func (b autoscaleBehavior) increaseLimit(state *resourceState, t time.Time) int {
+	var limit int
+	for i, p := range b.increasePolicies {
+		// The replicas at the start of the period, not counting the decreases.
+		start := state.current - changedReplicas(state.changes, t.Add(-p.Period), true)
+		var l int
+		switch p.Type {
+		case pipeline.AutoscalePodsPolicy:
+			l = start + int(p.Value)
+		case pipeline.AutoscalePercentPolicy:
+			l = int(math.Ceil(float64(start) * (1 + float64(p.Value)/100)))
+		}
+		if i == 0 || (b.selectMin && l < limit) || (!b.selectMin && l > limit) {
+			limit = l
+		}
+	}
+	if limit < state.current {
+		limit = state.current
+	}
+	return limit
+}
+
+func (b autoscaleBehavior) decreaseLimit(state *resourceState, t time.Time) int {
+	var limit int
+	for i, p := range b.decreasePolicies {
+		// The replicas at the start of the period, not counting the increases.
+		start := state.current - changedReplicas(state.changes, t.Add(-p.Period), false)
+		var l int
+		switch p.Type {
+		case pipeline.AutoscalePodsPolicy:
+			l = start - int(p.Value)
+		case pipeline.AutoscalePercentPolicy:
+			l = int(float64(start) * (1 - float64(p.Value)/100))
+		}
+		if i == 0 || (b.selectMin && l > limit) || (!b.selectMin && l < limit) {
+			limit = l
+		}
+	}
+	if limit > state.current {
+		limit = state.current
+	}
+	return limit
+}
+
+// recordChange records a change in replicas for the policies.
+func (b autoscaleBehavior) recordChange(state *resourceState, change int, t time.Time) {
+	var period time.Duration
+	for _, p := range b.increasePolicies {
+		if p.Period > period {
+			period = p.Period
+		}
+	}
+	for _, p := range b.decreasePolicies {
+		if p.Period > period {
+			period = p.Period
+		}
+	}
+	if period == 0 {
+		return
+	}
+	state.changes = append(pruneReplicas(state.changes, t.Add(-period)), timedReplicas{
+		time:     t,
+		replicas: change,
+	})
+}
+
+// changedReplicas returns the sum of the increases or decreases after the time.
+func changedReplicas(changes []timedReplicas, after time.Time, increases bool) int {
+	sum := 0
+	for _, c := range changes {
+		if !c.time.After(after) {
+			continue
+		}
+		if (increases && c.replicas > 0) || (!increases && c.replicas < 0) {
+			sum += c.replicas
+		}
+	}
+	return sum
+}
+
+// pruneReplicas removes the entries at or before the time, entries are sorted by time.
+func pruneReplicas(entries []timedReplicas, before time.Time) []timedReplicas {
+	i := 0
+	for i < len(entries) && !entries[i].time.After(before) {
+		i++
+	}
+	return entries[i:]
+}
@@ -0,0 +1,188 @@
+package kapacitor
+
+import (
+	"testing"
+	"time"
+
+	"github.com/influxdata/kapacitor/pipeline"
+)
+
+func mustNewAutoscaleBehavior(t *testing.T, n *pipeline.K8sAutoscaleNode) autoscaleBehavior {
+	b, err := newAutoscaleBehavior(
+		int(n.Min),
+		int(n.Max),
+		n.IncreasePolicies,
+		n.DecreasePolicies,
+		n.SelectPolicy,
+		n.IncreaseStabilization,
+		n.DecreaseStabilization,
+		n.Schedules,
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+func newTestK8sAutoscaleNode() *pipeline.K8sAutoscaleNode {
+	return &pipeline.K8sAutoscaleNode{
+		Min:          1,
+		SelectPolicy: pipeline.AutoscaleSelectMax,
+	}
+}
+
+func TestAutoscaleBehavior_Stabilize(t *testing.T) {
+	n := newTestK8sAutoscaleNode()
+	n.DecreaseStabilization = 5 * time.Minute
+	b := mustNewAutoscaleBehavior(t, n)
+
+	start := time.Date(2017, 1, 1, 0, 0, 0, 0, time.UTC)
+	state := &resourceState{current: 10}
+	steps := []struct {
+		offset  time.Duration
+		desired int
+		exp     int
+	}{
+		{offset: 0, desired: 10, exp: 10},
+		{offset: time.Minute, desired: 4, exp: 10},
+		{offset: 2 * time.Minute, desired: 6, exp: 10},
+		// The desired count of 10 left the window.
+		{offset: 5*time.Minute + time.Second, desired: 4, exp: 6},
+		// Increases are not stabilized.
+		{offset: 6 * time.Minute, desired: 12, exp: 12},
+	}
+	for i, s := range steps {
+		if got := b.stabilize(state, s.desired, start.Add(s.offset)); got != s.exp {
+			t.Errorf("step %d: unexpected recommendation got %d exp %d", i, got, s.exp)
+		}
+	}
+}
+
+func TestAutoscaleBehavior_Limit(t *testing.T) {
+	start := time.Date(2017, 1, 1, 0, 0, 0, 0, time.UTC)
+	testCases := map[string]struct {
+		setup   func(n *pipeline.K8sAutoscaleNode)
+		current int
+		changes []timedReplicas
+		desired int
+		exp     int
+		limited bool
+	}{
+		"no-policies": {
+			setup:   func(n *pipeline.K8sAutoscaleNode) {},
+			current: 2,
+			desired: 20,
+			exp:     20,
+		},
+		"pods": {
+			setup: func(n *pipeline.K8sAutoscaleNode) {
+				n.IncreasePolicy(pipeline.AutoscalePodsPolicy, 4, time.Minute)
+			},
+			current: 2,
+			desired: 20,
+			exp:     6,
+			limited: true,
+		},
+		"pods-within-period": {
+			setup: func(n *pipeline.K8sAutoscaleNode) {
+				n.IncreasePolicy(pipeline.AutoscalePodsPolicy, 4, time.Minute)
+			},
+			current: 6,
+			changes: []timedReplicas{{time: start.Add(-30 * time.Second), replicas: 4}},
+			desired: 20,
+			exp:     6,
+			limited: true,
+		},
+		"pods-after-period": {
+			setup: func(n *pipeline.K8sAutoscaleNode) {
+				n.IncreasePolicy(pipeline.AutoscalePodsPolicy, 4, time.Minute)
+			},
+			current: 6,
+			changes: []timedReplicas{{time: start.Add(-time.Minute), replicas: 4}},
+			desired: 20,
+			exp:     10,
+			limited: true,
+		},
+		"select-max": {
+			setup: func(n *pipeline.K8sAutoscaleNode) {
+				n.IncreasePolicy(pipeline.AutoscalePodsPolicy, 4, time.Minute)
+				n.IncreasePolicy(pipeline.AutoscalePercentPolicy, 100, time.Minute)
+			},
+			current: 10,
+			desired: 50,
+			exp:     20,
+			limited: true,
+		},
+		"select-min": {
+			setup: func(n *pipeline.K8sAutoscaleNode) {
+				n.IncreasePolicy(pipeline.AutoscalePodsPolicy, 4, time.Minute)
+				n.IncreasePolicy(pipeline.AutoscalePercentPolicy, 100, time.Minute)
+				n.SelectPolicy = pipeline.AutoscaleSelectMin
+			},
+			current: 10,
+			desired: 50,
+			exp:     14,
+			limited: true,
+		},
+		"decrease-percent": {
+			setup: func(n *pipeline.K8sAutoscaleNode) {
+				n.DecreasePolicy(pipeline.AutoscalePercentPolicy, 10, 5*time.Minute)
+			},
+			current: 95,
+			changes: []timedReplicas{{time: start.Add(-time.Minute), replicas: -5}},
+			desired: 50,
+			exp:     90,
+			limited: true,
+		},
+		"decrease-within-limit": {
+			setup: func(n *pipeline.K8sAutoscaleNode) {
+				n.DecreasePolicy(pipeline.AutoscalePodsPolicy, 5, time.Minute)
+			},
+			current: 10,
+			desired: 8,
+			exp:     8,
+		},
+	}
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			n := newTestK8sAutoscaleNode()
+			tc.setup(n)
+			b := mustNewAutoscaleBehavior(t, n)
+			state := &resourceState{
+				current: tc.current,
+				changes: tc.changes,
+			}
+			got, limited := b.limit(state, tc.desired, start)
+			if got != tc.exp || limited != tc.limited {
+				t.Errorf("unexpected limit got %d (limited %v) exp %d (limited %v)", got, limited, tc.exp, tc.limited)
+			}
+		})
+	}
+}
+
+func TestAutoscaleBehavior_Bounds(t *testing.T) {
+	n := newTestK8sAutoscaleNode()
+	n.Min = 1
+	n.Max = 10
+	n.Schedule("0 9 * * *", 8*time.Hour, 5, 20)
+	b := mustNewAutoscaleBehavior(t, n)
+
+	testCases := []struct {
+		t        time.Time
+		min, max int
+	}{
+		{t: time.Date(2017, 1, 1, 8, 59, 0, 0, time.UTC), min: 1, max: 10},
+		{t: time.Date(2017, 1, 1, 9, 0, 0, 0, time.UTC), min: 5, max: 20},
+		{t: time.Date(2017, 1, 1, 16, 59, 0, 0, time.UTC), min: 5, max: 20},
+		{t: time.Date(2017, 1, 1, 17, 0, 0, 0, time.UTC), min: 1, max: 10},
+	}
+	for _, tc := range testCases {
+		min, max := b.bounds(tc.t)
+		if min != tc.min || max != tc.max {
+			t.Errorf("unexpected bounds at %v got (%d, %d) exp (%d, %d)", tc.t, min, max, tc.min, tc.max)
+		}
+	}
+	if got, exp := b.clamp(2, time.Date(2017, 1, 1, 12, 0, 0, 0, time.UTC)), 5; got != exp {
+		t.Errorf("unexpected clamped replicas got %d exp %d", got, exp)
+	}
+}
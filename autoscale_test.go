@@ -0,0 +1,44 @@
+package kapacitor
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"text/template"
+
+	"github.com/influxdata/kapacitor/services/httppost"
+)
+
+func TestHTTPAutoscaler_EscapesName(t *testing.T) {
+	var paths, bodies []string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		paths = append(paths, r.URL.EscapedPath())
+		body, _ := ioutil.ReadAll(r.Body)
+		bodies = append(bodies, string(body))
+		w.Write([]byte(`{"replicas":1}`))
+	}))
+	defer ts.Close()
+
+	a := &httpAutoscaler{
+		endpoint:      httppost.NewEndpoint(ts.URL, nil, httppost.BasicAuth{}, nil, nil),
+		replicasPath:  template.Must(template.New("replicasPath").Parse("/jobs/{{.Name}}")),
+		replicasField: "replicas",
+		scalePath:     template.Must(template.New("scalePath").Parse("/jobs/{{.Name}}/scale")),
+		scaleMethod:   "PUT",
+		scaleBody:     template.Must(template.New("scaleBody").Parse(`{"name":"{{.Name}}","replicas":{{.Replicas}}}`)),
+	}
+	id := httpResourceID(`web/api?x "v2"`)
+	if _, err := a.Replicas(id); err != nil {
+		t.Fatal(err)
+	}
+	if err := a.SetReplicas(id, 3); err != nil {
+		t.Fatal(err)
+	}
+	if exp := []string{"/jobs/web%2Fapi%3Fx%20%22v2%22", "/jobs/web%2Fapi%3Fx%20%22v2%22/scale"}; len(paths) != 2 || paths[0] != exp[0] || paths[1] != exp[1] {
+		t.Errorf("unexpected paths: got %q exp %q", paths, exp)
+	}
+	if exp := `{"name":"web/api?x \"v2\"","replicas":3}`; len(bodies) != 2 || bodies[1] != exp {
+		t.Errorf("unexpected scale body: got %q exp %q", bodies, exp)
+	}
+}
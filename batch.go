@@ -116,7 +116,7 @@ func (n *BatchNode) Queries(start, stop time.Time) ([]BatchQueries, error) {
 
 // Do not add the source batch node to the dot output
 // since its not really an edge.
-func (n *BatchNode) edot(*bytes.Buffer, bool) {}
+func (n *BatchNode) edot(*bytes.Buffer, bool, map[string]string) {}
 
 func (n *BatchNode) collectedCount() (count int64) {
 	for _, child := range n.children {
@@ -323,6 +323,7 @@ func (n *QueryNode) doQuery(in edge.Edge) error {
 					n.batchesQueried.Add(1)
 					n.pointsQueried.Add(int64(len(bch.Points())))
 
+					n.et.tm.trace(bch)
 					n.timer.Pause()
 					if err := in.Collect(bch); err != nil {
 						return err
@@ -11,7 +11,9 @@ import (
 	"net/http"
 	"net/url"
 	"path"
+	"sort"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/influxdata/influxdb/influxql"
@@ -31,9 +33,16 @@ const (
 	basePreviewPath   = "/kapacitor/v1preview"
 	pingPath          = basePath + "/ping"
 	logLevelPath      = basePath + "/loglevel"
+	logsPath          = basePreviewPath + "/logs"
 	debugVarsPath     = basePath + "/debug/vars"
 	tasksPath         = basePath + "/tasks"
+	taskRevisionsPath = "revisions"
+	taskDiffPath      = "diff"
+	taskRollbackPath  = "rollback"
 	templatesPath     = basePath + "/templates"
+	dependenciesPath  = basePath + "/task-dependencies"
+	usersPath         = basePath + "/users"
+	auditPath         = basePath + "/audit"
 	recordingsPath    = basePath + "/recordings"
 	recordStreamPath  = basePath + "/recordings/stream"
 	recordBatchPath   = basePath + "/recordings/batch"
@@ -47,9 +56,13 @@ const (
 	topicsPath        = alertsPath + "/topics"
 	topicEventsPath   = "events"
 	topicHandlersPath = "handlers"
+	syncPath          = basePath + "/sync"
 	storagePath       = basePath + "/storage"
 	storesPath        = storagePath + "/stores"
 	backupPath        = storagePath + "/backup"
+	migratePath       = storagePath + "/migrate"
+	restorePath       = storagePath + "/restore"
+	checkPath         = storagePath + "/check"
 )
 
 // HTTP configuration for connecting to Kapacitor
@@ -430,6 +443,19 @@ func (vt VarType) String() string {
 	return string(s)
 }
 
+// Labels are arbitrary key/value pairs attached to tasks, templates and topic handlers.
+type Labels map[string]string
+
+// String returns the labels as comma separated key=value pairs sorted by key.
+func (l Labels) String() string {
+	pairs := make([]string, 0, len(l))
+	for k, v := range l {
+		pairs = append(pairs, k+"="+v)
+	}
+	sort.Strings(pairs)
+	return strings.Join(pairs, ",")
+}
+
 type Vars map[string]Var
 
 func (vs *Vars) UnmarshalJSON(b []byte) error {
@@ -535,6 +561,86 @@ type Task struct {
 	Created        time.Time      `json:"created"`
 	Modified       time.Time      `json:"modified"`
 	LastEnabled    time.Time      `json:"last-enabled,omitempty"`
+	Revision       int            `json:"revision"`
+	Labels         Labels         `json:"labels,omitempty"`
+	Limits         TaskLimits     `json:"limits"`
+	// DependentTasks lists the enabled tasks fed by the task, only set when the task is disabled.
+	DependentTasks []string `json:"dependent-tasks,omitempty"`
+}
+
+// LimitPolicy decides what happens once a task reaches one of its limits.
+type LimitPolicy string
+
+const (
+	// DropLimitPolicy drops any new data that would exceed the limit.
+	DropLimitPolicy LimitPolicy = "drop"
+	// EvictLimitPolicy evicts the least recently used data to make room for the new data.
+	EvictLimitPolicy LimitPolicy = "evict"
+	// StopLimitPolicy stops the task with an error.
+	StopLimitPolicy LimitPolicy = "stop"
+)
+
+// TaskLimits limit the resources a task may use.
+// A zero limit means the resource is not limited.
+type TaskLimits struct {
+	// MaxGroups is the maximum number of groups per node.
+	MaxGroups int `json:"max-groups,omitempty"`
+	// MaxWindowPoints is the maximum number of points buffered per window.
+	MaxWindowPoints int `json:"max-window-points,omitempty"`
+	// MaxJoinBuffer is the maximum number of sets per join group waiting for their matches.
+	MaxJoinBuffer int `json:"max-join-buffer,omitempty"`
+	// Policy defaults to DropLimitPolicy.
+	Policy LimitPolicy `json:"policy,omitempty"`
+}
+
+func (l TaskLimits) String() string {
+	if l.MaxGroups == 0 && l.MaxWindowPoints == 0 && l.MaxJoinBuffer == 0 {
+		return "none"
+	}
+	var parts []string
+	if l.MaxGroups > 0 {
+		parts = append(parts, fmt.Sprintf("max-groups=%d", l.MaxGroups))
+	}
+	if l.MaxWindowPoints > 0 {
+		parts = append(parts, fmt.Sprintf("max-window-points=%d", l.MaxWindowPoints))
+	}
+	if l.MaxJoinBuffer > 0 {
+		parts = append(parts, fmt.Sprintf("max-join-buffer=%d", l.MaxJoinBuffer))
+	}
+	policy := l.Policy
+	if policy == "" {
+		policy = DropLimitPolicy
+	}
+	parts = append(parts, "policy="+string(policy))
+	return strings.Join(parts, " ")
+}
+
+// A TaskRevision is an immutable copy of a task definition.
+// A new revision is recorded each time the definition of a task changes.
+type TaskRevision struct {
+	Link       Link      `json:"link"`
+	TaskID     string    `json:"task-id"`
+	Revision   int       `json:"revision"`
+	TemplateID string    `json:"template-id"`
+	Type       TaskType  `json:"type"`
+	DBRPs      []DBRP    `json:"dbrps"`
+	TICKscript string    `json:"script"`
+	Vars       Vars      `json:"vars"`
+	Author     string    `json:"author,omitempty"`
+	Created    time.Time `json:"created"`
+}
+
+type TaskRevisions struct {
+	Link      Link           `json:"link"`
+	Revisions []TaskRevision `json:"revisions"`
+}
+
+// A TaskRevisionDiff is a unified diff between two revisions of a task.
+type TaskRevisionDiff struct {
+	Link Link   `json:"link"`
+	From int    `json:"from"`
+	To   int    `json:"to"`
+	Diff string `json:"diff"`
 }
 
 // A Template plus its read-only attributes.
@@ -548,6 +654,7 @@ type Template struct {
 	Error      string    `json:"error"`
 	Created    time.Time `json:"created"`
 	Modified   time.Time `json:"modified"`
+	Labels     Labels    `json:"labels,omitempty"`
 }
 
 // Information about a recording.
@@ -683,6 +790,18 @@ func (c *Client) TaskLink(id string) Link {
 	return Link{Relation: Self, Href: path.Join(tasksPath, id)}
 }
 
+func (c *Client) TaskRevisionsLink(id string) Link {
+	return Link{Relation: Self, Href: path.Join(tasksPath, id, taskRevisionsPath)}
+}
+
+func (c *Client) TaskRevisionLink(id string, revision int) Link {
+	return Link{Relation: Self, Href: path.Join(tasksPath, id, taskRevisionsPath, strconv.Itoa(revision))}
+}
+
+func (c *Client) UserLink(name string) Link {
+	return Link{Relation: Self, Href: path.Join(usersPath, name)}
+}
+
 func (c *Client) TemplateLink(id string) Link {
 	return Link{Relation: Self, Href: path.Join(templatesPath, id)}
 }
@@ -725,13 +844,15 @@ func (c *Client) StorageLink(name string) Link {
 }
 
 type CreateTaskOptions struct {
-	ID         string     `json:"id,omitempty"`
-	TemplateID string     `json:"template-id,omitempty"`
-	Type       TaskType   `json:"type,omitempty"`
-	DBRPs      []DBRP     `json:"dbrps,omitempty"`
-	TICKscript string     `json:"script,omitempty"`
-	Status     TaskStatus `json:"status,omitempty"`
-	Vars       Vars       `json:"vars,omitempty"`
+	ID         string      `json:"id,omitempty"`
+	TemplateID string      `json:"template-id,omitempty"`
+	Type       TaskType    `json:"type,omitempty"`
+	DBRPs      []DBRP      `json:"dbrps,omitempty"`
+	TICKscript string      `json:"script,omitempty"`
+	Status     TaskStatus  `json:"status,omitempty"`
+	Vars       Vars        `json:"vars,omitempty"`
+	Labels     Labels      `json:"labels,omitempty"`
+	Limits     *TaskLimits `json:"limits,omitempty"`
 }
 
 // Create a new task.
@@ -766,6 +887,10 @@ type UpdateTaskOptions struct {
 	TICKscript string     `json:"script,omitempty"`
 	Status     TaskStatus `json:"status,omitempty"`
 	Vars       Vars       `json:"vars,omitempty"`
+	// Labels replace the existing labels of the task if not nil.
+	Labels Labels `json:"labels"`
+	// Limits replace the existing limits of the task if not nil.
+	Limits *TaskLimits `json:"limits,omitempty"`
 }
 
 // Update an existing task.
@@ -874,9 +999,11 @@ func (c *Client) DeleteTask(link Link) error {
 type ListTasksOptions struct {
 	TaskOptions
 	Pattern string
-	Fields  []string
-	Offset  int
-	Limit   int
+	// Labels is a label selector, i.e. team=db,env!=dev
+	Labels string
+	Fields []string
+	Offset int
+	Limit  int
 }
 
 func (o *ListTasksOptions) Default() {
@@ -889,6 +1016,9 @@ func (o *ListTasksOptions) Default() {
 func (o *ListTasksOptions) Values() *url.Values {
 	v := o.TaskOptions.Values()
 	v.Set("pattern", o.Pattern)
+	if o.Labels != "" {
+		v.Set("labels", o.Labels)
+	}
 	for _, field := range o.Fields {
 		v.Add("fields", field)
 	}
@@ -927,6 +1057,135 @@ func (c *Client) ListTasks(opt *ListTasksOptions) ([]Task, error) {
 	return r.Tasks, nil
 }
 
+type ListTaskRevisionsOptions struct {
+	ScriptFormat string
+	Offset       int
+	Limit        int
+}
+
+func (o *ListTaskRevisionsOptions) Default() {
+	if o.ScriptFormat == "" {
+		o.ScriptFormat = "formatted"
+	}
+	if o.Limit == 0 {
+		o.Limit = 100
+	}
+}
+
+func (o *ListTaskRevisionsOptions) Values() *url.Values {
+	v := &url.Values{}
+	v.Set("script-format", o.ScriptFormat)
+	v.Set("offset", strconv.FormatInt(int64(o.Offset), 10))
+	v.Set("limit", strconv.FormatInt(int64(o.Limit), 10))
+	return v
+}
+
+// ListTaskRevisions returns the revisions of a task, most recent first.
+// The link must be a task revisions link, see TaskRevisionsLink.
+func (c *Client) ListTaskRevisions(link Link, opt *ListTaskRevisionsOptions) (TaskRevisions, error) {
+	revisions := TaskRevisions{}
+	if link.Href == "" {
+		return revisions, fmt.Errorf("invalid link %v", link)
+	}
+	if opt == nil {
+		opt = new(ListTaskRevisionsOptions)
+	}
+	opt.Default()
+
+	u := *c.url
+	u.Path = link.Href
+	u.RawQuery = opt.Values().Encode()
+
+	req, err := http.NewRequest("GET", u.String(), nil)
+	if err != nil {
+		return revisions, err
+	}
+
+	_, err = c.Do(req, &revisions, http.StatusOK)
+	return revisions, err
+}
+
+// TaskRevision returns a single revision of a task.
+// The link must be a task revision link, see TaskRevisionLink.
+func (c *Client) TaskRevision(link Link) (TaskRevision, error) {
+	r := TaskRevision{}
+	if link.Href == "" {
+		return r, fmt.Errorf("invalid link %v", link)
+	}
+
+	u := *c.url
+	u.Path = link.Href
+
+	req, err := http.NewRequest("GET", u.String(), nil)
+	if err != nil {
+		return r, err
+	}
+
+	_, err = c.Do(req, &r, http.StatusOK)
+	return r, err
+}
+
+// DiffTaskRevisions returns the diff between two revisions of a task.
+// The link must be a task revisions link, see TaskRevisionsLink.
+// If to is zero the current revision is used, if from is zero the revision preceding to is used.
+func (c *Client) DiffTaskRevisions(link Link, from, to int) (TaskRevisionDiff, error) {
+	d := TaskRevisionDiff{}
+	if link.Href == "" {
+		return d, fmt.Errorf("invalid link %v", link)
+	}
+
+	u := *c.url
+	u.Path = path.Join(link.Href, taskDiffPath)
+	v := url.Values{}
+	if from > 0 {
+		v.Set("from", strconv.Itoa(from))
+	}
+	if to > 0 {
+		v.Set("to", strconv.Itoa(to))
+	}
+	u.RawQuery = v.Encode()
+
+	req, err := http.NewRequest("GET", u.String(), nil)
+	if err != nil {
+		return d, err
+	}
+
+	_, err = c.Do(req, &d, http.StatusOK)
+	return d, err
+}
+
+type RollbackTaskOptions struct {
+	Revision int `json:"revision"`
+}
+
+// RollbackTask restores the definition of a task from one of its revisions.
+// The rollback itself is recorded as a new revision.
+func (c *Client) RollbackTask(link Link, revision int) (Task, error) {
+	t := Task{}
+	if link.Href == "" {
+		return t, fmt.Errorf("invalid link %v", link)
+	}
+
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	err := enc.Encode(RollbackTaskOptions{Revision: revision})
+	if err != nil {
+		return t, err
+	}
+
+	u := *c.url
+	u.Path = path.Join(link.Href, taskRollbackPath)
+
+	req, err := http.NewRequest("POST", u.String(), &buf)
+	if err != nil {
+		return t, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	_, err = c.Do(req, &t, http.StatusOK)
+	return t, err
+}
+
 func (c *Client) TaskOutput(link Link, name string) (*influxql.Result, error) {
 	u := *c.url
 	u.Path = path.Join(link.Href, name)
@@ -947,6 +1206,7 @@ type CreateTemplateOptions struct {
 	ID         string   `json:"id,omitempty"`
 	Type       TaskType `json:"type,omitempty"`
 	TICKscript string   `json:"script,omitempty"`
+	Labels     Labels   `json:"labels,omitempty"`
 }
 
 // Create a new template.
@@ -977,6 +1237,8 @@ type UpdateTemplateOptions struct {
 	ID         string   `json:"id,omitempty"`
 	Type       TaskType `json:"type,omitempty"`
 	TICKscript string   `json:"script,omitempty"`
+	// Labels replace the existing labels of the template if not nil.
+	Labels Labels `json:"labels"`
 }
 
 // Update an existing template.
@@ -1077,9 +1339,11 @@ func (c *Client) DeleteTemplate(link Link) error {
 type ListTemplatesOptions struct {
 	TemplateOptions
 	Pattern string
-	Fields  []string
-	Offset  int
-	Limit   int
+	// Labels is a label selector, i.e. team=db,env!=dev
+	Labels string
+	Fields []string
+	Offset int
+	Limit  int
 }
 
 func (o *ListTemplatesOptions) Default() {
@@ -1092,6 +1356,9 @@ func (o *ListTemplatesOptions) Default() {
 func (o *ListTemplatesOptions) Values() *url.Values {
 	v := o.TemplateOptions.Values()
 	v.Set("pattern", o.Pattern)
+	if o.Labels != "" {
+		v.Set("labels", o.Labels)
+	}
 	for _, field := range o.Fields {
 		v.Add("fields", field)
 	}
@@ -1130,6 +1397,411 @@ func (c *Client) ListTemplates(opt *ListTemplatesOptions) ([]Template, error) {
 	return r.Templates, nil
 }
 
+// ManagedByLabel is the label that marks tasks, templates and topic handlers
+// as managed by a sync.
+// Its value is the manager name of the sync.
+const ManagedByLabel = "managed-by"
+
+// DefaultSyncManager is the manager name used when SyncOptions.Manager is empty.
+const DefaultSyncManager = "kapacitor-sync"
+
+// SyncTopicHandlerOptions defines a topic handler as part of a sync.
+type SyncTopicHandlerOptions struct {
+	Topic string `json:"topic"`
+	TopicHandlerOptions
+}
+
+// SyncOptions is the complete desired set of tasks, templates and topic handlers for a manager.
+type SyncOptions struct {
+	// Manager is the value of the ManagedByLabel set on every synced object.
+	// Managed objects of the same manager that are not part of the sync are deleted.
+	Manager string `json:"manager,omitempty"`
+	// DryRun only computes the plan without applying it.
+	DryRun bool `json:"dry-run"`
+
+	Templates []CreateTemplateOptions   `json:"templates"`
+	Tasks     []CreateTaskOptions       `json:"tasks"`
+	Handlers  []SyncTopicHandlerOptions `json:"handlers"`
+}
+
+// SyncAction types
+const (
+	SyncCreate = "create"
+	SyncUpdate = "update"
+	SyncDelete = "delete"
+)
+
+// SyncAction is a single change of a sync plan.
+type SyncAction struct {
+	// Kind is one of "template", "task" or "handler".
+	Kind string `json:"kind"`
+	ID   string `json:"id"`
+	// Topic is only set for handlers.
+	Topic  string `json:"topic,omitempty"`
+	Action string `json:"action"`
+	// Diff is a unified diff of the definition for update actions.
+	Diff string `json:"diff,omitempty"`
+}
+
+// SyncResult is the plan of a sync and whether it was applied.
+type SyncResult struct {
+	Manager string       `json:"manager"`
+	Applied bool         `json:"applied"`
+	Actions []SyncAction `json:"actions"`
+}
+
+// Sync makes the tasks, templates and topic handlers managed by opt.Manager match the definitions in opt.
+// All changes are applied or none are.
+func (c *Client) Sync(opt SyncOptions) (SyncResult, error) {
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	err := enc.Encode(opt)
+	if err != nil {
+		return SyncResult{}, err
+	}
+
+	u := *c.url
+	u.Path = syncPath
+
+	req, err := http.NewRequest("POST", u.String(), &buf)
+	if err != nil {
+		return SyncResult{}, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	r := SyncResult{}
+	_, err = c.Do(req, &r, http.StatusOK)
+	return r, err
+}
+
+// A TaskDependency means the upstream task writes points,
+// through a KapacitorLoopbackNode, that the downstream task consumes.
+type TaskDependency struct {
+	Upstream        string `json:"upstream"`
+	Downstream      string `json:"downstream"`
+	Database        string `json:"db"`
+	RetentionPolicy string `json:"rp"`
+	// Measurement is empty if the upstream task keeps the measurement of the points.
+	Measurement string `json:"measurement,omitempty"`
+}
+
+// TaskDependencies is the graph of tasks that feed each other through loopbacks.
+type TaskDependencies struct {
+	Link         Link             `json:"link"`
+	Tasks        []string         `json:"tasks"`
+	Disabled     []string         `json:"disabled"`
+	Dependencies []TaskDependency `json:"dependencies"`
+	// Cycles are sets of tasks that feed each other in a loop.
+	Cycles [][]string `json:"cycles"`
+	Dot    string     `json:"dot"`
+}
+
+// IsDisabled reports whether the task is disabled.
+func (d TaskDependencies) IsDisabled(id string) bool {
+	for _, disabled := range d.Disabled {
+		if disabled == id {
+			return true
+		}
+	}
+	return false
+}
+
+// Downstream returns the IDs of the tasks the task directly feeds.
+func (d TaskDependencies) Downstream(id string) []string {
+	var ids []string
+	for _, dep := range d.Dependencies {
+		if dep.Upstream == id && (len(ids) == 0 || ids[len(ids)-1] != dep.Downstream) {
+			ids = append(ids, dep.Downstream)
+		}
+	}
+	return ids
+}
+
+// TaskDependencies returns the dependency graph of all tasks.
+func (c *Client) TaskDependencies() (TaskDependencies, error) {
+	u := *c.url
+	u.Path = dependenciesPath
+
+	req, err := http.NewRequest("GET", u.String(), nil)
+	if err != nil {
+		return TaskDependencies{}, err
+	}
+
+	d := TaskDependencies{}
+	_, err = c.Do(req, &d, http.StatusOK)
+	return d, err
+}
+
+// Privilege a user can be granted on an API endpoint or database.
+type Privilege string
+
+const (
+	ReadPrivilege   Privilege = "read"
+	WritePrivilege  Privilege = "write"
+	DeletePrivilege Privilege = "delete"
+	AllPrivileges   Privilege = "all"
+)
+
+// UserGrant gives a user privileges on either an API endpoint or a database.
+// Privileges on an endpoint also apply to all endpoints below it.
+type UserGrant struct {
+	// API path relative to /kapacitor/v1, i.e. /tasks.
+	API string `json:"api,omitempty"`
+	// Database the user may write to through the write endpoints.
+	Database   string      `json:"database,omitempty"`
+	Privileges []Privilege `json:"privileges"`
+}
+
+func (g UserGrant) String() string {
+	privileges := make([]string, len(g.Privileges))
+	for i, p := range g.Privileges {
+		privileges[i] = string(p)
+	}
+	resource := "api:" + g.API
+	if g.Database != "" {
+		resource = "db:" + g.Database
+	}
+	return resource + "=" + strings.Join(privileges, ",")
+}
+
+// User of the Kapacitor API.
+type User struct {
+	Link   Link        `json:"link"`
+	Name   string      `json:"name"`
+	Admin  bool        `json:"admin"`
+	Grants []UserGrant `json:"grants"`
+}
+
+type CreateUserOptions struct {
+	Name     string      `json:"name"`
+	Password string      `json:"password"`
+	Admin    bool        `json:"admin"`
+	Grants   []UserGrant `json:"grants,omitempty"`
+}
+
+// Create a new user.
+func (c *Client) CreateUser(opt CreateUserOptions) (User, error) {
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	err := enc.Encode(opt)
+	if err != nil {
+		return User{}, err
+	}
+
+	u := *c.url
+	u.Path = usersPath
+
+	req, err := http.NewRequest("POST", u.String(), &buf)
+	if err != nil {
+		return User{}, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	user := User{}
+	_, err = c.Do(req, &user, http.StatusOK)
+	return user, err
+}
+
+type UpdateUserOptions struct {
+	Password string `json:"password,omitempty"`
+	// Admin changes whether the user is an admin if not nil.
+	Admin *bool `json:"admin,omitempty"`
+	// Grants replace the existing grants of the user if not nil.
+	Grants []UserGrant `json:"grants"`
+}
+
+// Update an existing user.
+// Only fields that are not their default value will be updated.
+func (c *Client) UpdateUser(link Link, opt UpdateUserOptions) (User, error) {
+	user := User{}
+	if link.Href == "" {
+		return user, fmt.Errorf("invalid link %v", link)
+	}
+
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	err := enc.Encode(opt)
+	if err != nil {
+		return user, err
+	}
+
+	u := *c.url
+	u.Path = link.Href
+
+	req, err := http.NewRequest("PATCH", u.String(), &buf)
+	if err != nil {
+		return user, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	_, err = c.Do(req, &user, http.StatusOK)
+	return user, err
+}
+
+// Get information about a user.
+func (c *Client) User(link Link) (User, error) {
+	user := User{}
+	if link.Href == "" {
+		return user, fmt.Errorf("invalid link %v", link)
+	}
+
+	u := *c.url
+	u.Path = link.Href
+
+	req, err := http.NewRequest("GET", u.String(), nil)
+	if err != nil {
+		return user, err
+	}
+
+	_, err = c.Do(req, &user, http.StatusOK)
+	return user, err
+}
+
+// Delete a user.
+func (c *Client) DeleteUser(link Link) error {
+	if link.Href == "" {
+		return fmt.Errorf("invalid link %v", link)
+	}
+	u := *c.url
+	u.Path = link.Href
+
+	req, err := http.NewRequest("DELETE", u.String(), nil)
+	if err != nil {
+		return err
+	}
+
+	_, err = c.Do(req, nil, http.StatusNoContent)
+	return err
+}
+
+// AuditRecord records a single mutating API request.
+type AuditRecord struct {
+	Time time.Time `json:"time"`
+	// User that made the request, empty if authentication is disabled.
+	User string `json:"user"`
+	// Path of the resource relative to the API base path.
+	Resource string `json:"resource"`
+	// One of create, update, delete, enable or disable.
+	Action string `json:"action"`
+	Method string `json:"method"`
+	Status int    `json:"status"`
+	// Digests of the resource before and after the request.
+	Before string `json:"before,omitempty"`
+	After  string `json:"after,omitempty"`
+}
+
+type ListAuditRecordsOptions struct {
+	// Only records at or after Start, ignored if zero.
+	Start time.Time
+	// Only records before Stop, ignored if zero.
+	Stop time.Time
+	// Only records of the user.
+	User string
+	// Only records of resources with the prefix.
+	Resource string
+	Limit    int
+}
+
+func (o *ListAuditRecordsOptions) Default() {
+	if o.Limit == 0 {
+		o.Limit = 100
+	}
+}
+
+func (o *ListAuditRecordsOptions) Values() *url.Values {
+	v := &url.Values{}
+	if !o.Start.IsZero() {
+		v.Set("start", o.Start.Format(time.RFC3339Nano))
+	}
+	if !o.Stop.IsZero() {
+		v.Set("stop", o.Stop.Format(time.RFC3339Nano))
+	}
+	if o.User != "" {
+		v.Set("user", o.User)
+	}
+	if o.Resource != "" {
+		v.Set("resource", o.Resource)
+	}
+	v.Set("limit", strconv.FormatInt(int64(o.Limit), 10))
+	return v
+}
+
+// List audit records, newest first.
+func (c *Client) ListAuditRecords(opt *ListAuditRecordsOptions) ([]AuditRecord, error) {
+	if opt == nil {
+		opt = new(ListAuditRecordsOptions)
+	}
+	opt.Default()
+	u := *c.url
+	u.Path = auditPath
+	u.RawQuery = opt.Values().Encode()
+
+	req, err := http.NewRequest("GET", u.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	// Response type
+	type response struct {
+		Records []AuditRecord `json:"records"`
+	}
+
+	r := &response{}
+	_, err = c.Do(req, r, http.StatusOK)
+	if err != nil {
+		return nil, err
+	}
+	return r.Records, nil
+}
+
+type ListUsersOptions struct {
+	Pattern string
+	Offset  int
+	Limit   int
+}
+
+func (o *ListUsersOptions) Default() {
+	if o.Limit == 0 {
+		o.Limit = 100
+	}
+}
+
+func (o *ListUsersOptions) Values() *url.Values {
+	v := &url.Values{}
+	v.Set("pattern", o.Pattern)
+	v.Set("offset", strconv.FormatInt(int64(o.Offset), 10))
+	v.Set("limit", strconv.FormatInt(int64(o.Limit), 10))
+	return v
+}
+
+// List users matching the pattern.
+func (c *Client) ListUsers(opt *ListUsersOptions) ([]User, error) {
+	if opt == nil {
+		opt = new(ListUsersOptions)
+	}
+	opt.Default()
+	u := *c.url
+	u.Path = usersPath
+	u.RawQuery = opt.Values().Encode()
+
+	req, err := http.NewRequest("GET", u.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	// Response type
+	type response struct {
+		Users []User `json:"users"`
+	}
+
+	r := &response{}
+	_, err = c.Do(req, r, http.StatusOK)
+	if err != nil {
+		return nil, err
+	}
+	return r.Users, nil
+}
+
 // Get information about a recording.
 func (c *Client) Recording(link Link) (Recording, error) {
 	r := Recording{}
@@ -1940,6 +2612,7 @@ type TopicHandler struct {
 	Kind    string                 `json:"kind"`
 	Options map[string]interface{} `json:"options"`
 	Match   string                 `json:"match"`
+	Labels  Labels                 `json:"labels,omitempty"`
 }
 
 // TopicHandler retrieves an alert handler.
@@ -1967,6 +2640,7 @@ type TopicHandlerOptions struct {
 	Kind    string                 `json:"kind" yaml:"kind"`
 	Options map[string]interface{} `json:"options" yaml:"options"`
 	Match   string                 `json:"match" yaml:"match"`
+	Labels  Labels                 `json:"labels,omitempty" yaml:"labels"`
 }
 
 // CreateTopicHandler creates a new alert handler.
@@ -2064,6 +2738,8 @@ func (c *Client) DeleteTopicHandler(link Link) error {
 
 type ListTopicHandlersOptions struct {
 	Pattern string
+	// Labels is a label selector, i.e. team=db,env!=dev
+	Labels string
 }
 
 func (o *ListTopicHandlersOptions) Default() {}
@@ -2071,6 +2747,9 @@ func (o *ListTopicHandlersOptions) Default() {}
 func (o *ListTopicHandlersOptions) Values() *url.Values {
 	v := &url.Values{}
 	v.Set("pattern", o.Pattern)
+	if o.Labels != "" {
+		v.Set("labels", o.Labels)
+	}
 	return v
 }
 
@@ -2185,6 +2864,112 @@ func (c *Client) DoStorageAction(l Link, opt StorageActionOptions) error {
 	return nil
 }
 
+type StorageMigrateOptions struct {
+	// To is the URL of the storage backend the stores are copied to,
+	// i.e. sqlite3:///var/lib/kapacitor/kapacitor.sqlite or consul://localhost:8500/kapacitor.
+	To string `json:"to"`
+}
+
+type StorageMigration struct {
+	Stores []MigratedStore `json:"stores"`
+}
+
+type MigratedStore struct {
+	Namespace string `json:"namespace"`
+	Keys      int    `json:"keys"`
+}
+
+// MigrateStorage copies all stores of Kapacitor to another storage backend.
+// Kapacitor keeps using its configured backend until it is reconfigured.
+func (c *Client) MigrateStorage(opt StorageMigrateOptions) (StorageMigration, error) {
+	m := StorageMigration{}
+	u := *c.url
+	u.Path = migratePath
+
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	err := enc.Encode(opt)
+	if err != nil {
+		return m, err
+	}
+	req, err := http.NewRequest("POST", u.String(), &buf)
+	if err != nil {
+		return m, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	_, err = c.Do(req, &m, http.StatusOK)
+	if err != nil {
+		return m, err
+	}
+	return m, nil
+}
+
+type StorageRestore struct {
+	Stores []RestoredStore `json:"stores"`
+}
+
+type RestoredStore struct {
+	Namespace string `json:"namespace"`
+	Keys      int    `json:"keys"`
+}
+
+// Restore replaces all storage of Kapacitor with a backup.
+// The backup is rejected if it is corrupt or its store versions differ from the versions of Kapacitor.
+// Kapacitor must be restarted to load the restored tasks, alert handlers and configuration overrides.
+func (c *Client) Restore(backup io.Reader) (StorageRestore, error) {
+	restore := StorageRestore{}
+	u := *c.url
+	u.Path = restorePath
+
+	req, err := http.NewRequest("POST", u.String(), backup)
+	if err != nil {
+		return restore, err
+	}
+	req.Header.Set("Content-Type", "application/octet-stream")
+
+	_, err = c.Do(req, &restore, http.StatusOK)
+	if err != nil {
+		return restore, err
+	}
+	return restore, nil
+}
+
+type StorageCheck struct {
+	Stores []CheckedStore `json:"stores"`
+}
+
+type CheckedStore struct {
+	Name string `json:"name"`
+	// Objects is the number of objects checked.
+	Objects int             `json:"objects"`
+	Corrupt []CorruptObject `json:"corrupt"`
+}
+
+// CorruptObject is a stored object that cannot be decoded.
+type CorruptObject struct {
+	Key   string `json:"key"`
+	Error string `json:"error"`
+}
+
+// CheckStorage decodes every stored object and reports the objects that cannot be decoded.
+func (c *Client) CheckStorage() (StorageCheck, error) {
+	check := StorageCheck{}
+	u := *c.url
+	u.Path = checkPath
+
+	req, err := http.NewRequest("GET", u.String(), nil)
+	if err != nil {
+		return check, err
+	}
+
+	_, err = c.Do(req, &check, http.StatusOK)
+	if err != nil {
+		return check, err
+	}
+	return check, nil
+}
+
 // Backup requests a backup of all storage from Kapacitor.
 // A short read is possible, to verify that the backup was successful
 // check that the number of bytes read matches the returned size.
@@ -2209,15 +2994,24 @@ func (c *Client) Backup() (int64, io.ReadCloser, error) {
 
 type LogLevelOptions struct {
 	Level string `json:"level"`
+	// Subsystem is the name of a service whose level is set instead of the level of the server.
+	Subsystem string `json:"subsystem,omitempty"`
+	// Task is the ID of a task whose level is set instead of the level of the server.
+	Task string `json:"task,omitempty"`
 }
 
 // Set the logging level.
 // Level must be one of DEBUG, INFO, WARN, ERROR, or OFF
 func (c *Client) LogLevel(level string) error {
+	return c.SetLogLevel(LogLevelOptions{Level: level})
+}
+
+// Set the logging level of the server, a subsystem or a task.
+// The level DEFAULT removes the level of a subsystem or task.
+func (c *Client) SetLogLevel(opt LogLevelOptions) error {
 	u := *c.url
 	u.Path = logLevelPath
 
-	opt := LogLevelOptions{Level: level}
 	var buf bytes.Buffer
 	enc := json.NewEncoder(&buf)
 	err := enc.Encode(opt)
@@ -2235,6 +3029,38 @@ func (c *Client) LogLevel(level string) error {
 	return err
 }
 
+// Logs streams the log lines of the server whose keys have the values of the filter,
+// i.e. task=cpu_alert or node=alert2.
+// Each line is a JSON object followed by a newline.
+// The stream does not end until it is closed.
+func (c *Client) Logs(filter map[string]string) (io.ReadCloser, error) {
+	u := *c.url
+	u.Path = logsPath
+	v := url.Values{}
+	for key, value := range filter {
+		v.Set(key, value)
+	}
+	u.RawQuery = v.Encode()
+
+	req, err := http.NewRequest("GET", u.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	err = c.prepRequest(req)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		defer resp.Body.Close()
+		return nil, c.decodeError(resp)
+	}
+	return resp.Body, nil
+}
+
 type DebugVars struct {
 	ClusterID        string                 `json:"cluster_id"`
 	ServerID         string                 `json:"server_id"`
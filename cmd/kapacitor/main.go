@@ -11,6 +11,7 @@ import (
 	"net/http"
 	"os"
 	"path"
+	"path/filepath"
 	"sort"
 	"strconv"
 	"strings"
@@ -50,11 +51,13 @@ Commands:
 	define                Create/update a task.
 	define-template       Create/update a template.
 	define-topic-handler  Create/update an alert handler for a topic.
+	sync                  Create/update/delete tasks, templates and topic handlers from a directory.
 	replay                Replay a recording to a task.
 	replay-live           Replay data against a task without recording it.
 	enable                Enable and start running a task with live data.
 	disable               Stop running a task.
 	reload                Reload a running task with an updated task definition.
+	rollback              Restore a task definition from one of its revisions.
 	push                  Publish a task definition to another Kapacitor instance. Not implemented yet.
 	delete                Delete tasks, templates, recordings, replays, topics or topic-handlers.
 	list                  List information about tasks, templates, recordings, replays, topics, topic-handlers or service-tests.
@@ -62,8 +65,12 @@ Commands:
 	show-template         Display detailed information about a template.
 	show-topic-handler    Display detailed information about an alert handler for a topic.
 	show-topic            Display detailed information about an alert topic.
+	show-dependencies     Display the tasks that feed each other through loopbacks.
+	user                  Create, update, delete or list users.
 	backup                Backup the Kapacitor database.
+	storage               Migrate, restore or check the Kapacitor database.
 	level                 Sets the logging level on the kapacitord server.
+	logs                  Stream the logs of the kapacitord server.
 	stats                 Display various stats about Kapacitor.
 	version               Displays the Kapacitor version info.
 	vars                  Print debug vars in JSON format.
@@ -142,6 +149,10 @@ func main() {
 	case "define-topic-handler":
 		commandArgs = args
 		commandF = doDefineTopicHandler
+	case "sync":
+		syncFlags.Parse(args)
+		commandArgs = syncFlags.Args()
+		commandF = doSync
 	case "replay":
 		replayFlags.Parse(args)
 		commandArgs = replayFlags.Args()
@@ -154,19 +165,26 @@ func main() {
 		commandArgs = args
 		commandF = doReplayLive
 	case "enable":
-		commandArgs = args
+		enableFlags.Parse(args)
+		commandArgs = enableFlags.Args()
 		commandF = doEnable
 	case "disable":
-		commandArgs = args
+		disableFlags.Parse(args)
+		commandArgs = disableFlags.Args()
 		commandF = doDisable
 	case "reload":
 		commandArgs = args
 		commandF = doReload
-	case "delete":
+	case "rollback":
 		commandArgs = args
+		commandF = doRollback
+	case "delete":
+		deleteFlags.Parse(args)
+		commandArgs = deleteFlags.Args()
 		commandF = doDelete
 	case "list":
-		commandArgs = args
+		listFlags.Parse(args)
+		commandArgs = listFlags.Args()
 		commandF = doList
 	case "show":
 		showFlags.Parse(args)
@@ -181,12 +199,32 @@ func main() {
 	case "show-topic":
 		commandArgs = args
 		commandF = doShowTopic
+	case "show-dependencies":
+		commandArgs = args
+		commandF = doShowDependencies
+	case "user":
+		if len(args) == 0 {
+			userUsage()
+			os.Exit(2)
+		}
+		commandArgs = args
+		commandF = doUser
 	case "backup":
 		commandArgs = args
 		commandF = doBackup
+	case "storage":
+		if len(args) == 0 {
+			storageUsage()
+			os.Exit(2)
+		}
+		commandArgs = args
+		commandF = doStorage
 	case "level":
 		commandArgs = args
 		commandF = doLevel
+	case "logs":
+		commandArgs = args
+		commandF = doLogs
 	case "stats":
 		commandArgs = args
 		commandF = doStats
@@ -217,6 +255,7 @@ func init() {
 	defineFlags.Usage = defineUsage
 	defineTemplateFlags.Usage = defineTemplateUsage
 	showFlags.Usage = showUsage
+	syncFlags.Usage = syncUsage
 
 	recordStreamFlags.Usage = recordStreamUsage
 	recordBatchFlags.Usage = recordBatchUsage
@@ -262,6 +301,8 @@ func doHelp(args []string) error {
 			defineTemplateFlags.Usage()
 		case "define-topic-handler":
 			defineTopicHandlerUsage()
+		case "sync":
+			syncFlags.Usage()
 		case "replay":
 			replayFlags.Usage()
 		case "enable":
@@ -270,6 +311,8 @@ func doHelp(args []string) error {
 			disableUsage()
 		case "reload":
 			reloadUsage()
+		case "rollback":
+			rollbackUsage()
 		case "delete":
 			deleteUsage()
 		case "list":
@@ -282,10 +325,18 @@ func doHelp(args []string) error {
 			showTopicHandlerUsage()
 		case "show-topic":
 			showTopicUsage()
+		case "show-dependencies":
+			showDependenciesUsage()
+		case "user":
+			userUsage()
 		case "backup":
 			backupUsage()
+		case "storage":
+			storageUsage()
 		case "level":
 			levelUsage()
+		case "logs":
+			logsUsage()
 		case "help":
 			helpUsage()
 		case "stats":
@@ -544,6 +595,11 @@ var (
 	dvars       = defineFlags.String("vars", "", "Optional path to a JSON vars file")
 	dnoReload   = defineFlags.Bool("no-reload", false, "Do not reload the task even if it is enabled")
 	ddbrp       = make(dbrps, 0)
+
+	dmaxGroups       = defineFlags.Int("max-groups", 0, "Optional maximum number of groups per node, 0 means no limit")
+	dmaxWindowPoints = defineFlags.Int("max-window-points", 0, "Optional maximum number of points buffered per window, 0 means no limit")
+	dmaxJoinBuffer   = defineFlags.Int("max-join-buffer", 0, "Optional maximum number of sets per join group waiting for their matches, 0 means no limit")
+	dlimitPolicy     = defineFlags.String("limit-policy", "", "What happens once a limit is reached (drop|evict|stop), defaults to drop")
 )
 
 func init() {
@@ -636,6 +692,11 @@ For example:
 
 	NOTE: you must specify all 'dbrp' flags you desire if you wish to modify them.
 
+	You can limit the resources of the task, once a limit is reached new groups or points are
+	dropped, the least recently used are evicted or the task stops with an error:
+
+		$ kapacitor define my_task -max-groups 1000 -max-window-points 10000 -limit-policy evict
+
 Options:
 
 `
@@ -689,6 +750,7 @@ func doDefine(args []string) error {
 
 	l := cli.TaskLink(id)
 	task, _ := cli.Task(l, nil)
+	limits := defineLimits(task.Limits)
 	var err error
 	if task.ID == "" {
 		_, err = cli.CreateTask(client.CreateTaskOptions{
@@ -699,6 +761,7 @@ func doDefine(args []string) error {
 			TICKscript: script,
 			Vars:       vars,
 			Status:     client.Disabled,
+			Limits:     limits,
 		})
 	} else {
 		_, err = cli.UpdateTask(
@@ -709,6 +772,7 @@ func doDefine(args []string) error {
 				DBRPs:      ddbrp,
 				TICKscript: script,
 				Vars:       vars,
+				Limits:     limits,
 			},
 		)
 	}
@@ -729,6 +793,31 @@ func doDefine(args []string) error {
 	return nil
 }
 
+// defineLimits sets the limits given on the command line, leaving the other limits unmodified.
+// Returns nil if no limit was given.
+func defineLimits(limits client.TaskLimits) *client.TaskLimits {
+	set := false
+	defineFlags.Visit(func(f *flag.Flag) {
+		switch f.Name {
+		case "max-groups":
+			limits.MaxGroups = *dmaxGroups
+		case "max-window-points":
+			limits.MaxWindowPoints = *dmaxWindowPoints
+		case "max-join-buffer":
+			limits.MaxJoinBuffer = *dmaxJoinBuffer
+		case "limit-policy":
+			limits.Policy = client.LimitPolicy(*dlimitPolicy)
+		default:
+			return
+		}
+		set = true
+	})
+	if !set {
+		return nil
+	}
+	return &limits
+}
+
 // DefineTemplate
 var (
 	defineTemplateFlags = flag.NewFlagSet("define-template", flag.ExitOnError)
@@ -882,6 +971,238 @@ func doDefineTopicHandler(args []string) error {
 	return err
 }
 
+// Sync
+var (
+	syncFlags   = flag.NewFlagSet("sync", flag.ExitOnError)
+	syncManager = syncFlags.String("manager", client.DefaultSyncManager, "The manager name. Only objects labeled with this manager are deleted when they are absent from the directory.")
+	syncDryRun  = syncFlags.Bool("dry-run", false, "Only print the plan, do not apply it.")
+)
+
+func syncUsage() {
+	var u = `Usage: kapacitor sync [options] <directory>
+
+	Make the tasks, templates and topic handlers on the server match the definitions in a directory.
+
+	The directory is laid out as follows, where each options file may be YAML or JSON:
+
+		templates/<template ID>.tick         The TICKscript of a template.
+		templates/<template ID>.yaml         The template options, i.e. type and labels.
+		tasks/<task ID>.tick                 The TICKscript of a task.
+		tasks/<task ID>.yaml                 The task options, i.e. type, dbrps, status, template-id, vars and labels.
+		handlers/<topic ID>/<handler ID>.yaml  A topic handler, the same as for define-topic-handler.
+
+	A task using a template only needs its options file, with template-id and vars set.
+	Tasks are enabled unless their options set the status to disabled.
+
+	The plan of creates, updates and deletes is printed and then applied.
+	Either all changes are applied or none are.
+	Every synced object is labeled with managed-by=<manager>.
+	Objects labeled with the same manager that are absent from the directory are deleted.
+
+For example:
+
+	Show what would change:
+
+		$ kapacitor sync -dry-run path/to/dir
+
+	Apply the changes:
+
+		$ kapacitor sync path/to/dir
+
+Options:
+`
+	fmt.Fprintln(os.Stderr, u)
+	syncFlags.PrintDefaults()
+}
+
+func doSync(args []string) error {
+	if len(args) != 1 {
+		fmt.Fprintln(os.Stderr, "Must provide a directory.")
+		syncUsage()
+		os.Exit(2)
+	}
+	opts, err := loadSyncDir(args[0])
+	if err != nil {
+		return err
+	}
+	opts.Manager = *syncManager
+	opts.DryRun = *syncDryRun
+
+	result, err := cli.Sync(opts)
+	if err != nil {
+		return err
+	}
+	if len(result.Actions) == 0 {
+		fmt.Println("No changes.")
+		return nil
+	}
+	outFmt := "%-10s%-8s%s\n"
+	fmt.Fprintf(os.Stdout, outFmt, "Kind", "Action", "ID")
+	for _, a := range result.Actions {
+		id := a.ID
+		if a.Topic != "" {
+			id = path.Join(a.Topic, a.ID)
+		}
+		fmt.Fprintf(os.Stdout, outFmt, a.Kind, a.Action, id)
+	}
+	for _, a := range result.Actions {
+		if a.Diff != "" {
+			fmt.Println()
+			fmt.Print(a.Diff)
+		}
+	}
+	fmt.Println()
+	if result.Applied {
+		fmt.Printf("Applied %d changes.\n", len(result.Actions))
+	} else {
+		fmt.Println("Dry run, no changes applied.")
+	}
+	return nil
+}
+
+// syncDefinition is the TICKscript and options file of a template or task in a sync directory.
+type syncDefinition struct {
+	script      string
+	options     []byte
+	optionsPath string
+}
+
+func isSyncOptionsFile(name string) bool {
+	switch path.Ext(name) {
+	case ".yaml", ".yml", ".json":
+		return true
+	}
+	return false
+}
+
+// readSyncDefinitions reads the definitions in dir keyed by ID.
+// A missing directory has no definitions.
+func readSyncDefinitions(dir string) (map[string]*syncDefinition, error) {
+	files, err := ioutil.ReadDir(dir)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defs := make(map[string]*syncDefinition)
+	for _, f := range files {
+		name := f.Name()
+		if f.IsDir() || (path.Ext(name) != ".tick" && !isSyncOptionsFile(name)) {
+			continue
+		}
+		id := strings.TrimSuffix(name, path.Ext(name))
+		d := defs[id]
+		if d == nil {
+			d = new(syncDefinition)
+			defs[id] = d
+		}
+		p := filepath.Join(dir, name)
+		data, err := ioutil.ReadFile(p)
+		if err != nil {
+			return nil, err
+		}
+		if path.Ext(name) == ".tick" {
+			d.script = string(data)
+			continue
+		}
+		if d.optionsPath != "" {
+			return nil, fmt.Errorf("%s has more than one options file: %s and %s", id, d.optionsPath, p)
+		}
+		d.options = data
+		d.optionsPath = p
+	}
+	return defs, nil
+}
+
+func sortedSyncIDs(defs map[string]*syncDefinition) []string {
+	ids := make([]string, 0, len(defs))
+	for id := range defs {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+// loadSyncDir reads all definitions of a sync directory.
+func loadSyncDir(dir string) (client.SyncOptions, error) {
+	opts := client.SyncOptions{}
+
+	templates, err := readSyncDefinitions(filepath.Join(dir, "templates"))
+	if err != nil {
+		return opts, errors.Wrap(err, "failed to read templates")
+	}
+	for _, id := range sortedSyncIDs(templates) {
+		d := templates[id]
+		var o client.CreateTemplateOptions
+		if d.options != nil {
+			if err := yaml.Unmarshal(d.options, &o); err != nil {
+				return opts, errors.Wrapf(err, "failed to unmarshal template options file %q", d.optionsPath)
+			}
+		}
+		o.ID = id
+		if d.script != "" {
+			o.TICKscript = d.script
+		}
+		opts.Templates = append(opts.Templates, o)
+	}
+
+	tasks, err := readSyncDefinitions(filepath.Join(dir, "tasks"))
+	if err != nil {
+		return opts, errors.Wrap(err, "failed to read tasks")
+	}
+	for _, id := range sortedSyncIDs(tasks) {
+		d := tasks[id]
+		var o client.CreateTaskOptions
+		if d.options != nil {
+			if err := yaml.Unmarshal(d.options, &o); err != nil {
+				return opts, errors.Wrapf(err, "failed to unmarshal task options file %q", d.optionsPath)
+			}
+		}
+		o.ID = id
+		if d.script != "" {
+			o.TICKscript = d.script
+		}
+		opts.Tasks = append(opts.Tasks, o)
+	}
+
+	handlersDir := filepath.Join(dir, "handlers")
+	topics, err := ioutil.ReadDir(handlersDir)
+	if err != nil && !os.IsNotExist(err) {
+		return opts, errors.Wrap(err, "failed to read handlers")
+	}
+	for _, topic := range topics {
+		if !topic.IsDir() {
+			continue
+		}
+		topicDir := filepath.Join(handlersDir, topic.Name())
+		files, err := ioutil.ReadDir(topicDir)
+		if err != nil {
+			return opts, errors.Wrapf(err, "failed to read handlers of topic %s", topic.Name())
+		}
+		for _, f := range files {
+			if f.IsDir() || !isSyncOptionsFile(f.Name()) {
+				continue
+			}
+			p := filepath.Join(topicDir, f.Name())
+			data, err := ioutil.ReadFile(p)
+			if err != nil {
+				return opts, err
+			}
+			var o client.TopicHandlerOptions
+			if err := yaml.Unmarshal(data, &o); err != nil {
+				return opts, errors.Wrapf(err, "failed to unmarshal handler file %q", p)
+			}
+			o.ID = strings.TrimSuffix(f.Name(), path.Ext(f.Name()))
+			opts.Handlers = append(opts.Handlers, client.SyncTopicHandlerOptions{
+				Topic:               topic.Name(),
+				TopicHandlerOptions: o,
+			})
+		}
+	}
+	return opts, nil
+}
+
 // Replay
 var (
 	replayFlags = flag.NewFlagSet("replay", flag.ExitOnError)
@@ -1141,8 +1462,13 @@ func doReplayLive(args []string) error {
 }
 
 // Enable
+var (
+	enableFlags = flag.NewFlagSet("enable", flag.ExitOnError)
+	eLabels     = enableFlags.String("labels", "", "Optional label selector, i.e. team=db,env!=dev. Only tasks with matching labels are enabled.")
+)
+
 func enableUsage() {
-	var u = `Usage: kapacitor enable [task ID...]
+	var u = `Usage: kapacitor enable [-labels selector] [task ID...]
 
 	Enable and start a task running from the live data.
 
@@ -1155,16 +1481,27 @@ For example:
 	Or, you can enable by glob:
 
 		$ kapacitor enable *_alert
+
+	Or, you can enable by labels:
+
+		$ kapacitor enable -labels team=db,env!=dev
+
+Options:
 `
 	fmt.Fprintln(os.Stderr, u)
+	enableFlags.PrintDefaults()
 }
 
 func doEnable(args []string) error {
-	if len(args) < 1 {
-		fmt.Fprintln(os.Stderr, "Must pass at least one task ID")
+	if len(args) < 1 && *eLabels == "" {
+		fmt.Fprintln(os.Stderr, "Must pass at least one task ID or a label selector")
 		enableUsage()
 		os.Exit(2)
 	}
+	if len(args) == 0 {
+		// Use empty pattern to match all tasks with the labels
+		args = []string{""}
+	}
 
 	limit := 100
 	for _, pattern := range args {
@@ -1172,6 +1509,7 @@ func doEnable(args []string) error {
 		for {
 			tasks, err := cli.ListTasks(&client.ListTasksOptions{
 				Pattern: pattern,
+				Labels:  *eLabels,
 				Fields:  []string{"link"},
 				Offset:  offset,
 				Limit:   limit,
@@ -1198,9 +1536,13 @@ func doEnable(args []string) error {
 }
 
 // Disable
+var (
+	disableFlags = flag.NewFlagSet("disable", flag.ExitOnError)
+	dLabels      = disableFlags.String("labels", "", "Optional label selector, i.e. team=db,env!=dev. Only tasks with matching labels are disabled.")
+)
 
 func disableUsage() {
-	var u = `Usage: kapacitor disable [task ID...]
+	var u = `Usage: kapacitor disable [-labels selector] [task ID...]
 
 	Disable and stop a task running.
 
@@ -1213,16 +1555,36 @@ For example:
 	Or, you can disable by glob:
 
 		$ kapacitor disable *_alert
+
+	Or, you can disable by labels:
+
+		$ kapacitor disable -labels team=db,env!=dev
+
+Options:
 `
 	fmt.Fprintln(os.Stderr, u)
+	disableFlags.PrintDefaults()
 }
 
 func doDisable(args []string) error {
-	if len(args) < 1 {
-		fmt.Fprintln(os.Stderr, "Must pass at least one task ID")
+	if len(args) < 1 && *dLabels == "" {
+		fmt.Fprintln(os.Stderr, "Must pass at least one task ID or a label selector")
 		disableUsage()
 		os.Exit(2)
 	}
+	if len(args) == 0 {
+		// Use empty pattern to match all tasks with the labels
+		args = []string{""}
+	}
+
+	deps, err := cli.TaskDependencies()
+	if err != nil {
+		return errors.Wrap(err, "getting task dependencies")
+	}
+	var disabled []string
+	defer func() {
+		warnDependentTasks(deps, "disabled", disabled)
+	}()
 
 	limit := 100
 	for _, pattern := range args {
@@ -1230,6 +1592,7 @@ func doDisable(args []string) error {
 		for {
 			tasks, err := cli.ListTasks(&client.ListTasksOptions{
 				Pattern: pattern,
+				Labels:  *dLabels,
 				Fields:  []string{"link"},
 				Offset:  offset,
 				Limit:   limit,
@@ -1245,6 +1608,7 @@ func doDisable(args []string) error {
 				if err != nil {
 					return errors.Wrapf(err, "disabling task %s", task.ID)
 				}
+				disabled = append(disabled, task.ID)
 			}
 			if len(tasks) != limit {
 				break
@@ -1289,14 +1653,218 @@ func doReload(args []string) error {
 	return doEnable(args)
 }
 
+// Rollback
+
+func rollbackUsage() {
+	var u = `Usage: kapacitor rollback [task ID] [revision]
+
+	Restore the definition of a task from one of its revisions.
+	If the task is enabled it is restarted with the restored definition.
+
+	The rollback is itself recorded as a new revision of the task.
+	Use 'kapacitor list revisions' to find the available revisions and
+	'kapacitor show -revision N -diff' to see what a rollback would change.
+
+For example:
+
+		$ kapacitor rollback cpu_alert 3
+`
+	fmt.Fprintln(os.Stderr, u)
+}
+
+func doRollback(args []string) error {
+	if len(args) != 2 {
+		fmt.Fprintln(os.Stderr, "Must pass a task ID and a revision")
+		rollbackUsage()
+		os.Exit(2)
+	}
+	revision, err := strconv.Atoi(args[1])
+	if err != nil {
+		return fmt.Errorf("invalid revision %q: %v", args[1], err)
+	}
+	t, err := cli.RollbackTask(cli.TaskLink(args[0]), revision)
+	if err != nil {
+		return errors.Wrapf(err, "rolling back task %s", args[0])
+	}
+	fmt.Printf("Task %s rolled back to revision %d as revision %d\n", t.ID, revision, t.Revision)
+	return nil
+}
+
+// User
+var (
+	userFlags    = flag.NewFlagSet("user", flag.ExitOnError)
+	uPassword    = userFlags.String("password", "", "The password of the user.")
+	uAdmin       = userFlags.Bool("admin", false, "Whether the user is an admin with all privileges.")
+	uGrants      userGrants
+	uClearGrants = userFlags.Bool("clear-grants", false, "Remove all grants of the user when updating.")
+)
+
+func init() {
+	userFlags.Var(&uGrants, "grant", `A grant of the form api:/path=privileges or db:name=privileges, where privileges is a comma separated list of read, write, delete or all. The flag can be specified multiple times.`)
+	userFlags.Usage = userUsage
+}
+
+type userGrants []client.UserGrant
+
+func (g *userGrants) String() string {
+	return fmt.Sprint(*g)
+}
+
+func (g *userGrants) Set(value string) error {
+	parts := strings.SplitN(value, "=", 2)
+	if len(parts) != 2 || parts[1] == "" {
+		return errors.New("grant must be of the form api:/path=privileges or db:name=privileges")
+	}
+	grant := client.UserGrant{}
+	switch {
+	case strings.HasPrefix(parts[0], "api:"):
+		grant.API = strings.TrimPrefix(parts[0], "api:")
+	case strings.HasPrefix(parts[0], "db:"):
+		grant.Database = strings.TrimPrefix(parts[0], "db:")
+	default:
+		return fmt.Errorf("grant resource %q must start with 'api:' or 'db:'", parts[0])
+	}
+	for _, p := range strings.Split(parts[1], ",") {
+		grant.Privileges = append(grant.Privileges, client.Privilege(strings.TrimSpace(p)))
+	}
+	*g = append(*g, grant)
+	return nil
+}
+
+func userUsage() {
+	var u = `Usage: kapacitor user (create|update|delete|list|show) [options] [name]
+
+	Manage the users of the built-in user store.
+	The user store must be enabled in the [user-store] section of the configuration.
+
+	Create a user that may only read tasks and write to the telegraf database:
+
+		$ kapacitor user create -password secret -grant api:/tasks=read -grant db:telegraf=write bob
+
+	Give a user the privileges to manage tasks, including deleting them:
+
+		$ kapacitor user update -grant api:/tasks=all bob
+
+	Change the password of a user:
+
+		$ kapacitor user update -password new-secret bob
+
+	Delete a user:
+
+		$ kapacitor user delete bob
+
+	List users matching a pattern:
+
+		$ kapacitor user list 'b*'
+
+Options:
+`
+	fmt.Fprintln(os.Stderr, u)
+	userFlags.PrintDefaults()
+}
+
+func doUser(args []string) error {
+	action := args[0]
+	userFlags.Parse(args[1:])
+	args = userFlags.Args()
+	switch action {
+	case "list":
+		patterns := args
+		if len(patterns) == 0 {
+			patterns = []string{""}
+		}
+		outFmt := "%-20s%-7v%s\n"
+		fmt.Fprintf(os.Stdout, outFmt, "Name", "Admin", "Grants")
+		limit := 100
+		for _, pattern := range patterns {
+			offset := 0
+			for {
+				users, err := cli.ListUsers(&client.ListUsersOptions{
+					Pattern: pattern,
+					Offset:  offset,
+					Limit:   limit,
+				})
+				if err != nil {
+					return err
+				}
+				for _, u := range users {
+					fmt.Fprintf(os.Stdout, outFmt, u.Name, u.Admin, u.Grants)
+				}
+				if len(users) != limit {
+					break
+				}
+				offset += limit
+			}
+		}
+		return nil
+	}
+
+	if len(args) != 1 {
+		fmt.Fprintln(os.Stderr, "Must specify one user name")
+		userUsage()
+		os.Exit(2)
+	}
+	name := args[0]
+	var (
+		u   client.User
+		err error
+	)
+	switch action {
+	case "create":
+		if *uPassword == "" {
+			return errors.New("must specify a password")
+		}
+		u, err = cli.CreateUser(client.CreateUserOptions{
+			Name:     name,
+			Password: *uPassword,
+			Admin:    *uAdmin,
+			Grants:   uGrants,
+		})
+	case "update":
+		o := client.UpdateUserOptions{
+			Password: *uPassword,
+			Grants:   uGrants,
+		}
+		if *uClearGrants {
+			o.Grants = []client.UserGrant{}
+		}
+		userFlags.Visit(func(f *flag.Flag) {
+			if f.Name == "admin" {
+				o.Admin = uAdmin
+			}
+		})
+		u, err = cli.UpdateUser(cli.UserLink(name), o)
+	case "delete":
+		return cli.DeleteUser(cli.UserLink(name))
+	case "show":
+		u, err = cli.User(cli.UserLink(name))
+	default:
+		fmt.Fprintln(os.Stderr, "Unknown user action", action)
+		userUsage()
+		os.Exit(2)
+	}
+	if err != nil {
+		return err
+	}
+	fmt.Println("Name:", u.Name)
+	fmt.Println("Admin:", u.Admin)
+	fmt.Println("Grants:")
+	for _, g := range u.Grants {
+		fmt.Println("  " + g.String())
+	}
+	return nil
+}
+
 // Show
 var (
 	showFlags = flag.NewFlagSet("show", flag.ExitOnError)
 	sReplayId = showFlags.String("replay", "", "Optional replay ID. If set the task information is in the context of the running replay.")
+	sRevision = showFlags.Int("revision", 0, "Optional revision number. If set the definition of the task at that revision is shown.")
+	sDiff     = showFlags.Bool("diff", false, "Show the diff between the revision and the current task definition. Requires -revision.")
 )
 
 func showUsage() {
-	var u = `Usage: kapacitor show [-replay] [task ID]
+	var u = `Usage: kapacitor show [-replay] [-revision N [-diff]] [task ID]
 
 	Show details about a specific task.
 
@@ -1313,6 +1881,12 @@ func doShow(args []string) error {
 		os.Exit(2)
 	}
 
+	if *sRevision > 0 {
+		return doShowRevision(args[0], *sRevision, *sDiff)
+	} else if *sDiff {
+		return errors.New("-diff requires a -revision")
+	}
+
 	t, err := cli.Task(
 		cli.TaskLink(args[0]),
 		&client.TaskOptions{ReplayID: *sReplayId},
@@ -1330,32 +1904,138 @@ func doShow(args []string) error {
 	fmt.Println("Created:", t.Created.Format(time.RFC822))
 	fmt.Println("Modified:", t.Modified.Format(time.RFC822))
 	fmt.Println("LastEnabled:", t.LastEnabled.Format(time.RFC822))
+	fmt.Println("Revision:", t.Revision)
+	fmt.Println("Labels:", t.Labels)
+	fmt.Println("Limits:", t.Limits)
 	fmt.Println("Databases Retention Policies:", t.DBRPs)
 	fmt.Printf("TICKscript:\n%s\n", t.TICKscript)
-	if len(t.Vars) > 0 {
-		fmt.Println("Vars:")
-		varOutFmt := "%-30s%-10v%-40v\n"
-		fmt.Printf(varOutFmt, "Name", "Type", "Value")
-		vars := make([]string, 0, len(t.Vars))
-		for name := range t.Vars {
-			vars = append(vars, name)
-		}
-		sort.Strings(vars)
-		for _, name := range vars {
-			v := t.Vars[name]
-			value := v.Value
-			if list, ok := v.Value.([]client.Var); ok {
-				var err error
-				value, err = varListToStr(list)
-				if err != nil {
-					return errors.Wrapf(err, "invalid var %s", name)
-				}
+	if err := printTaskVars(t.Vars); err != nil {
+		return err
+	}
+	if t.Executing && t.Limits != (client.TaskLimits{}) {
+		printLimitUsage(t.ExecutionStats)
+	}
+	if path, ok := t.ExecutionStats.TaskStats["slowest_path"].(string); ok {
+		printSlowestPath(path, t.ExecutionStats)
+	}
+	fmt.Printf("DOT:\n%s\n", t.Dot)
+
+	return nil
+}
+
+func doShowRevision(id string, revision int, diff bool) error {
+	if diff {
+		d, err := cli.DiffTaskRevisions(cli.TaskRevisionsLink(id), revision, 0)
+		if err != nil {
+			return err
+		}
+		if d.Diff == "" {
+			fmt.Printf("Revision %d is identical to the current revision %d\n", d.From, d.To)
+			return nil
+		}
+		fmt.Print(d.Diff)
+		return nil
+	}
+
+	r, err := cli.TaskRevision(cli.TaskRevisionLink(id, revision))
+	if err != nil {
+		return err
+	}
+
+	fmt.Println("ID:", r.TaskID)
+	fmt.Println("Revision:", r.Revision)
+	fmt.Println("Author:", r.Author)
+	fmt.Println("Created:", r.Created.Format(time.RFC822))
+	fmt.Println("Template:", r.TemplateID)
+	fmt.Println("Type:", r.Type)
+	fmt.Println("Databases Retention Policies:", r.DBRPs)
+	fmt.Printf("TICKscript:\n%s\n", r.TICKscript)
+	return printTaskVars(r.Vars)
+}
+
+// printLimitUsage prints the resource usage of the nodes that enforce a task limit.
+func printLimitUsage(stats client.ExecutionStats) {
+	names := make([]string, 0, len(stats.NodeStats))
+	for name, ns := range stats.NodeStats {
+		for _, stat := range []string{"messages_dropped", "buffered_points", "buffered_sets"} {
+			if _, ok := ns[stat]; ok {
+				names = append(names, name)
+				break
 			}
-			fmt.Printf(varOutFmt, name, v.Type, value)
 		}
 	}
-	fmt.Printf("DOT:\n%s\n", t.Dot)
+	if len(names) == 0 {
+		return
+	}
+	sort.Strings(names)
+	sum := func(ns map[string]interface{}, stats ...string) float64 {
+		total := 0.0
+		for _, stat := range stats {
+			if v, ok := ns[stat].(float64); ok {
+				total += v
+			}
+		}
+		return total
+	}
+	fmt.Println("Limit usage:")
+	outFmt := "%-30s%-10v%-10v%-10v%-10v\n"
+	fmt.Printf(outFmt, "Node", "Groups", "Buffered", "Dropped", "Evicted")
+	for _, name := range names {
+		ns := stats.NodeStats[name]
+		fmt.Printf(outFmt,
+			name,
+			sum(ns, "working_cardinality"),
+			sum(ns, "buffered_points", "buffered_sets"),
+			sum(ns, "messages_dropped", "points_dropped", "sets_dropped"),
+			sum(ns, "groups_evicted", "points_evicted", "sets_evicted"),
+		)
+	}
+}
 
+// printSlowestPath prints the 99th percentile times of the traced messages of the nodes on the slowest path.
+func printSlowestPath(path string, stats client.ExecutionStats) {
+	fmt.Println("Slowest path:", path)
+	duration := func(ns map[string]interface{}, stat string) time.Duration {
+		v, _ := ns[stat].(float64)
+		return time.Duration(v)
+	}
+	outFmt := "%-30s%-15v%-15v%-15v\n"
+	fmt.Printf(outFmt, "Node", "Latency p99", "Wait p99", "Process p99")
+	for _, name := range strings.Split(path, " -> ") {
+		ns := stats.NodeStats[name]
+		fmt.Printf(outFmt,
+			name,
+			duration(ns, "trace_latency_p99_ns"),
+			duration(ns, "trace_queue_wait_p99_ns"),
+			duration(ns, "trace_processing_p99_ns"),
+		)
+	}
+}
+
+func printTaskVars(vars client.Vars) error {
+	if len(vars) == 0 {
+		return nil
+	}
+	fmt.Println("Vars:")
+	varOutFmt := "%-30s%-10v%-40v\n"
+	fmt.Printf(varOutFmt, "Name", "Type", "Value")
+	names := make([]string, 0, len(vars))
+	for name := range vars {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		v := vars[name]
+		value := v.Value
+		if list, ok := v.Value.([]client.Var); ok {
+			var err error
+			value, err = varListToStr(list)
+			if err != nil {
+				return errors.Wrapf(err, "invalid var %s", name)
+			}
+		}
+		fmt.Printf(varOutFmt, name, v.Type, value)
+	}
 	return nil
 }
 
@@ -1407,6 +2087,7 @@ func doShowTemplate(args []string) error {
 	fmt.Println("Type:", t.Type)
 	fmt.Println("Created:", t.Created.Format(time.RFC822))
 	fmt.Println("Modified:", t.Modified.Format(time.RFC822))
+	fmt.Println("Labels:", t.Labels)
 	fmt.Printf("TICKscript:\n%s\n", t.TICKscript)
 	fmt.Println("Vars:")
 	varOutFmt := "%-30s%-10v%-40v%-40s\n"
@@ -1467,6 +2148,7 @@ func doShowTopicHandler(args []string) error {
 	fmt.Println("Topic:", topic)
 	fmt.Println("Kind:", h.Kind)
 	fmt.Println("Match:", h.Match)
+	fmt.Println("Labels:", h.Labels)
 	fmt.Println("Options:", string(options))
 	return nil
 }
@@ -1537,15 +2219,99 @@ func doShowTopic(args []string) error {
 	return nil
 }
 
+// Show Dependencies
+
+func showDependenciesUsage() {
+	var u = `Usage: kapacitor show-dependencies [task ID]
+
+	Show which tasks feed each other through loopback nodes.
+
+	If a task ID is given only the tasks it feeds and the tasks that feed it are shown.
+	The DOT output can be rendered with graphviz, disabled tasks are dashed and loopback cycles are red.
+`
+	fmt.Fprintln(os.Stderr, u)
+}
+
+func doShowDependencies(args []string) error {
+	if len(args) > 1 {
+		fmt.Fprintln(os.Stderr, "Must specify at most one task ID")
+		showDependenciesUsage()
+		os.Exit(2)
+	}
+	deps, err := cli.TaskDependencies()
+	if err != nil {
+		return err
+	}
+	maxUpstream := 8    // len("Upstream")
+	maxDownstream := 10 // len("Downstream")
+	maxDBRP := 4        // len("DBRP")
+	var shown []client.TaskDependency
+	for _, d := range deps.Dependencies {
+		if len(args) == 1 && d.Upstream != args[0] && d.Downstream != args[0] {
+			continue
+		}
+		shown = append(shown, d)
+		if l := len(d.Upstream); l > maxUpstream {
+			maxUpstream = l
+		}
+		if l := len(d.Downstream); l > maxDownstream {
+			maxDownstream = l
+		}
+		if l := len(d.Database) + len(d.RetentionPolicy) + 5; l > maxDBRP {
+			maxDBRP = l
+		}
+	}
+	outFmt := fmt.Sprintf("%%-%ds%%-%ds%%-%ds%%s\n", maxUpstream+1, maxDownstream+1, maxDBRP+1)
+	fmt.Printf(outFmt, "Upstream", "Downstream", "DBRP", "Measurement")
+	for _, d := range shown {
+		fmt.Printf(outFmt, d.Upstream, d.Downstream, fmt.Sprintf("%q.%q", d.Database, d.RetentionPolicy), d.Measurement)
+	}
+	for _, c := range deps.Cycles {
+		fmt.Printf("Cycle: [%s]\n", strings.Join(c, ", "))
+	}
+	if len(args) == 0 {
+		fmt.Printf("DOT:\n%s\n", deps.Dot)
+	}
+	return nil
+}
+
+// warnDependentTasks warns about enabled tasks that no longer receive points
+// because the tasks that fed them were disabled or deleted.
+func warnDependentTasks(deps client.TaskDependencies, action string, ids []string) {
+	affected := make(map[string]bool, len(ids))
+	for _, id := range ids {
+		affected[id] = true
+	}
+	for _, id := range ids {
+		var enabled []string
+		for _, d := range deps.Downstream(id) {
+			if !affected[d] && !deps.IsDisabled(d) {
+				enabled = append(enabled, d)
+			}
+		}
+		if len(enabled) > 0 {
+			fmt.Fprintf(os.Stderr, "Warning: %s task %s feeds enabled tasks: %s\n", action, id, strings.Join(enabled, ", "))
+		}
+	}
+}
+
 // List
+var (
+	listFlags = flag.NewFlagSet("list", flag.ExitOnError)
+	lLabels   = listFlags.String("labels", "", "Optional label selector, i.e. team=db,env!=dev. Only applies to tasks, templates and topic-handlers.")
+)
 
 func listUsage() {
-	var u = `Usage: kapacitor list (tasks|templates|recordings|replays|topics|topic-handlers|service-tests) [ID or pattern]...
+	var u = `Usage: kapacitor list [-labels selector] (tasks|templates|recordings|replays|topics|topic-handlers|service-tests) [ID or pattern]...
 
 	List tasks, templates, recordings, replays, topics or handlers and their current state.
 
 	If no ID or pattern is given then all items will be listed.
 
+	Listing revisions requires the ID of a task, revisions are listed most recent first.
+
+		$ kapacitor list revisions [task ID]
+
 	Listing handlers requires that the topic ID or pattern be specified before the handler patterns.
 
 		$ kapacitor list topic-handlers [topicID or pattern] [ID or pattern]
@@ -1558,8 +2324,14 @@ func listUsage() {
 
 		$ kapacitor list topic-handlers system email*
 
+	For example list all tasks owned by the db team outside of dev
+
+		$ kapacitor list -labels team=db,env!=dev tasks
+
+Options:
 `
 	fmt.Fprintln(os.Stderr, u)
+	listFlags.PrintDefaults()
 }
 
 type TaskList []client.Task
@@ -1599,6 +2371,7 @@ func doList(args []string) error {
 			for {
 				tasks, err := cli.ListTasks(&client.ListTasksOptions{
 					Pattern: pattern,
+					Labels:  *lLabels,
 					Fields:  []string{"type", "status", "executing", "dbrps"},
 					Offset:  offset,
 					Limit:   limit,
@@ -1632,6 +2405,7 @@ func doList(args []string) error {
 			for {
 				templates, err := cli.ListTemplates(&client.ListTemplatesOptions{
 					Pattern: pattern,
+					Labels:  *lLabels,
 					Fields:  []string{"type", "vars"},
 					Offset:  offset,
 					Limit:   limit,
@@ -1739,6 +2513,30 @@ func doList(args []string) error {
 		for _, r := range allReplays {
 			fmt.Fprintf(os.Stdout, outFmt, r.ID, r.Task, r.Recording, r.Status, r.Clock, r.Date.Local().Format(time.RFC822))
 		}
+	case "revisions":
+		if len(args) != 2 {
+			return errors.New("must specify exactly one task ID to list revisions")
+		}
+		id := args[1]
+		outFmt := "%-10v%-20v%-23v\n"
+		fmt.Fprintf(os.Stdout, outFmt, "Revision", "Author", "Created")
+		offset := 0
+		for {
+			revisions, err := cli.ListTaskRevisions(cli.TaskRevisionsLink(id), &client.ListTaskRevisionsOptions{
+				Offset: offset,
+				Limit:  limit,
+			})
+			if err != nil {
+				return err
+			}
+			for _, r := range revisions.Revisions {
+				fmt.Fprintf(os.Stdout, outFmt, r.Revision, r.Author, r.Created.Local().Format(time.RFC822))
+			}
+			if len(revisions.Revisions) != limit {
+				break
+			}
+			offset += limit
+		}
 	case "service-tests":
 		outFmt := "%s\n"
 		fmt.Fprintf(os.Stdout, outFmt, "Service Name")
@@ -1781,6 +2579,7 @@ func doList(args []string) error {
 			for _, pattern := range patterns {
 				handlers, err := cli.ListTopicHandlers(topic.HandlersLink, &client.ListTopicHandlersOptions{
 					Pattern: pattern,
+					Labels:  *lLabels,
 				})
 				if err != nil {
 					return err
@@ -1844,8 +2643,13 @@ func doList(args []string) error {
 }
 
 // Delete
+var (
+	deleteFlags = flag.NewFlagSet("delete", flag.ExitOnError)
+	delLabels   = deleteFlags.String("labels", "", "Optional label selector, i.e. team=db,env!=dev. Only applies to tasks, templates and topic-handlers.")
+)
+
 func deleteUsage() {
-	var u = `Usage: kapacitor delete (tasks|templates|recordings|replays|topics|topic-handlers) [ID or pattern]...
+	var u = `Usage: kapacitor delete [-labels selector] (tasks|templates|recordings|replays|topics|topic-handlers) [ID or pattern]...
 
 	Delete a tasks, templates, recordings, replays, topics or handlers.
 
@@ -1873,24 +2677,53 @@ For example:
 	You can delete a handler in the topic 'system':
 
 		$ kapacitor delete topic-handlers system slack
+
+	You can delete all tasks with matching labels:
+
+		$ kapacitor delete -labels team=db,env=dev tasks
+
+Options:
 `
 	fmt.Fprintln(os.Stderr, u)
+	deleteFlags.PrintDefaults()
 }
 
 func doDelete(args []string) error {
-	if len(args) < 2 {
-		fmt.Fprintln(os.Stderr, "Must pass at least one ID")
+	labeled := *delLabels != ""
+	if len(args) < 2 && !(labeled && len(args) == 1) {
+		fmt.Fprintln(os.Stderr, "Must pass at least one ID or a label selector")
 		deleteUsage()
 		os.Exit(2)
 	}
+	if labeled {
+		switch args[0] {
+		case "tasks", "templates":
+			if len(args) == 1 {
+				// Use empty pattern to match everything with the labels
+				args = append(args, "")
+			}
+		case "topic-handlers":
+		default:
+			return fmt.Errorf("cannot delete '%s' by labels, only 'tasks', 'templates' and 'topic-handlers' have labels", args[0])
+		}
+	}
 
 	limit := 100
 	switch kind := args[0]; kind {
 	case "tasks":
+		deps, err := cli.TaskDependencies()
+		if err != nil {
+			return err
+		}
+		var deleted []string
+		defer func() {
+			warnDependentTasks(deps, "deleted", deleted)
+		}()
 		for _, pattern := range args[1:] {
 			for {
 				tasks, err := cli.ListTasks(&client.ListTasksOptions{
 					Pattern: pattern,
+					Labels:  *delLabels,
 					Fields:  []string{"link"},
 					Limit:   limit,
 				})
@@ -1902,6 +2735,7 @@ func doDelete(args []string) error {
 					if err != nil {
 						return err
 					}
+					deleted = append(deleted, task.ID)
 				}
 				if len(tasks) != limit {
 					break
@@ -1913,6 +2747,7 @@ func doDelete(args []string) error {
 			for {
 				templates, err := cli.ListTemplates(&client.ListTemplatesOptions{
 					Pattern: pattern,
+					Labels:  *delLabels,
 					Fields:  []string{"link"},
 					Limit:   limit,
 				})
@@ -1990,10 +2825,18 @@ func doDelete(args []string) error {
 			}
 		}
 	case "topic-handlers":
+		if len(args) < 2 {
+			return errors.New("must specify the topic of the handlers to delete")
+		}
 		topic := args[1]
-		for _, pattern := range args[2:] {
+		patterns := args[2:]
+		if labeled && len(patterns) == 0 {
+			patterns = []string{""}
+		}
+		for _, pattern := range patterns {
 			handlers, err := cli.ListTopicHandlers(cli.TopicHandlersLink(topic), &client.ListTopicHandlersOptions{
 				Pattern: pattern,
+				Labels:  *delLabels,
 			})
 			if err != nil {
 				return err
@@ -2012,21 +2855,90 @@ func doDelete(args []string) error {
 }
 
 // Level
+var (
+	levelFlags     = flag.NewFlagSet("level", flag.ExitOnError)
+	levelSubsystem = levelFlags.String("subsystem", "", "The name of a subsystem, i.e. udf, to set the level of instead of the server.")
+	levelTask      = levelFlags.String("task", "", "The ID of a task to set the level of instead of the server.")
+)
+
 func levelUsage() {
-	var u = `Usage: kapacitor level (debug|info|warn|error)
+	var u = `Usage: kapacitor level [-subsystem <name> | -task <id>] (debug|info|warn|error|default)
 
 	Sets the logging level on the kapacitord server.
+
+	With -subsystem or -task only the level of the subsystem or task is set,
+	overriding the level of the server. The level 'default' removes the override.
+
+Options:
 `
 	fmt.Fprintln(os.Stderr, u)
+	levelFlags.PrintDefaults()
 }
 
 func doLevel(args []string) error {
-	if len(args) == 0 {
+	levelFlags.Usage = levelUsage
+	levelFlags.Parse(args)
+	args = levelFlags.Args()
+	if len(args) != 1 {
 		fmt.Fprintln(os.Stderr, "Must pass a log level")
 		levelUsage()
 		os.Exit(2)
 	}
-	return cli.LogLevel(args[0])
+	return cli.SetLogLevel(client.LogLevelOptions{
+		Level:     args[0],
+		Subsystem: *levelSubsystem,
+		Task:      *levelTask,
+	})
+}
+
+// Logs
+var (
+	logsFlags = flag.NewFlagSet("logs", flag.ExitOnError)
+	logsTask  = logsFlags.String("task", "", "Only stream the lines of the task with the ID.")
+	logsNode  = logsFlags.String("node", "", "Only stream the lines of the node with the name, i.e. alert2.")
+)
+
+func logsUsage() {
+	var u = `Usage: kapacitor logs [-task <id>] [-node <name>] [key=value...]
+
+	Stream the log lines of the kapacitord server until interrupted.
+
+	Only the lines whose keys have all of the given values are streamed,
+	for example 'kapacitor logs -task cpu_alert lvl=error'.
+	Lines below the log level of the server are not logged and so are not streamed.
+
+Options:
+`
+	fmt.Fprintln(os.Stderr, u)
+	logsFlags.PrintDefaults()
+}
+
+func doLogs(args []string) error {
+	logsFlags.Usage = logsUsage
+	logsFlags.Parse(args)
+	filter := make(map[string]string)
+	for _, arg := range logsFlags.Args() {
+		parts := strings.SplitN(arg, "=", 2)
+		if len(parts) != 2 || parts[0] == "" {
+			fmt.Fprintf(os.Stderr, "Invalid filter %q, must be key=value\n", arg)
+			logsUsage()
+			os.Exit(2)
+		}
+		filter[parts[0]] = parts[1]
+	}
+	if *logsTask != "" {
+		filter["task"] = *logsTask
+	}
+	if *logsNode != "" {
+		filter["node"] = *logsNode
+	}
+	r, err := cli.Logs(filter)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+	_, err = io.Copy(os.Stdout, r)
+	return err
 }
 
 // Stats
@@ -2219,7 +3131,7 @@ func backupUsage() {
 
 	Perform a backup of the Kapacitor database.
 
-	To restore a database first stop Kapacitor, then replace the existing kapacitor.db file with the backup file.
+	To restore a database use 'kapacitor storage restore <backup file>'.
 `
 	fmt.Fprintln(os.Stderr, u)
 }
@@ -2246,3 +3158,124 @@ func doBackup(args []string) error {
 	}
 	return nil
 }
+
+// Storage
+
+var (
+	storageFlags = flag.NewFlagSet("storage", flag.ExitOnError)
+	sTo          = storageFlags.String("to", "", "The URL of the storage backend to migrate to.")
+)
+
+func init() {
+	storageFlags.Usage = storageUsage
+}
+
+func storageUsage() {
+	var u = `Usage: kapacitor storage (migrate|restore|check) [options]
+
+kapacitor storage migrate -to <storage URL>
+
+	Copy all stores of the Kapacitor database, i.e. the tasks, templates, recordings, topics,
+	handlers and configuration overrides, to another storage backend.
+	Stores already in the target backend are replaced.
+	Kapacitor keeps using its storage backend until the [storage] section
+	of its configuration is changed and it is restarted.
+
+	The storage URL is one of:
+
+		bolt:///var/lib/kapacitor/kapacitor.db
+		sqlite3:///var/lib/kapacitor/kapacitor.sqlite
+		consul://host:8500/kapacitor/storage?datacenter=dc1&token=secret
+
+	The sqlite3 driver is only compiled into kapacitord built with cgo and the sqlite3 build tag.
+	Only admin users can migrate, and only to the storage URLs listed
+	in the migrate-targets of the [storage] section.
+
+kapacitor storage restore <backup file>
+
+	Replace all stores of the Kapacitor database with a backup made by 'kapacitor backup'.
+	The backup is rejected if it is corrupt or its store versions differ from the versions of Kapacitor.
+	Restart Kapacitor to load the restored tasks, alert handlers and configuration overrides.
+	The stores are read only until then.
+	Backups cannot be restored while the cluster or ha service is enabled.
+	Only admin users can restore, and only backups up to the max-restore-size
+	of the [storage] section.
+
+kapacitor storage check
+
+	Decode every stored object and report the objects that cannot be decoded.
+
+Options:
+`
+	fmt.Fprintln(os.Stderr, u)
+	storageFlags.PrintDefaults()
+}
+
+func doStorage(args []string) error {
+	action := args[0]
+	storageFlags.Parse(args[1:])
+	switch action {
+	case "migrate":
+		if *sTo == "" {
+			return errors.New("must provide the storage URL to migrate to with -to")
+		}
+		m, err := cli.MigrateStorage(client.StorageMigrateOptions{To: *sTo})
+		if err != nil {
+			return errors.Wrap(err, "failed to migrate storage")
+		}
+		outFmt := "%-30s%s\n"
+		fmt.Fprintf(os.Stdout, outFmt, "Store", "Keys")
+		for _, store := range m.Stores {
+			fmt.Fprintf(os.Stdout, outFmt, store.Namespace, strconv.Itoa(store.Keys))
+		}
+		return nil
+	case "restore":
+		if storageFlags.NArg() != 1 {
+			return errors.New("must provide the path of the backup file")
+		}
+		f, err := os.Open(storageFlags.Arg(0))
+		if err != nil {
+			return errors.Wrap(err, "failed to open backup file")
+		}
+		defer f.Close()
+		restore, err := cli.Restore(f)
+		if err != nil {
+			return errors.Wrap(err, "failed to restore backup")
+		}
+		outFmt := "%-30s%s\n"
+		fmt.Fprintf(os.Stdout, outFmt, "Store", "Keys")
+		for _, store := range restore.Stores {
+			fmt.Fprintf(os.Stdout, outFmt, store.Namespace, strconv.Itoa(store.Keys))
+		}
+		fmt.Fprintln(os.Stdout, "Restart Kapacitor to load the restored data.")
+		return nil
+	case "check":
+		check, err := cli.CheckStorage()
+		if err != nil {
+			return errors.Wrap(err, "failed to check storage")
+		}
+		outFmt := "%-30s%-10s%s\n"
+		fmt.Fprintf(os.Stdout, outFmt, "Store", "Objects", "Corrupt")
+		corrupt := 0
+		for _, store := range check.Stores {
+			fmt.Fprintf(os.Stdout, outFmt, store.Name, strconv.Itoa(store.Objects), strconv.Itoa(len(store.Corrupt)))
+			corrupt += len(store.Corrupt)
+		}
+		if corrupt == 0 {
+			return nil
+		}
+		fmt.Fprintln(os.Stdout)
+		outFmt = "%-30s%-40s%s\n"
+		fmt.Fprintf(os.Stdout, outFmt, "Store", "Key", "Error")
+		for _, store := range check.Stores {
+			for _, o := range store.Corrupt {
+				fmt.Fprintf(os.Stdout, outFmt, store.Name, o.Key, o.Error)
+			}
+		}
+		return fmt.Errorf("found %d corrupt objects", corrupt)
+	default:
+		storageUsage()
+		os.Exit(2)
+	}
+	return nil
+}
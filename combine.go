@@ -45,11 +45,7 @@ func newCombineNode(et *ExecutingTask, n *pipeline.CombineNode, d NodeDiagnostic
 }
 
 func (n *CombineNode) runCombine([]byte) error {
-	consumer := edge.NewGroupedConsumer(
-		n.ins[0],
-		n,
-	)
-	n.statMap.Set(statCardinalityGauge, consumer.CardinalityVar())
+	consumer := n.newGroupedConsumer(n)
 	return consumer.Consume()
 }
 
@@ -0,0 +1,218 @@
+package kapacitor
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/influxdata/kapacitor/edge"
+	"github.com/influxdata/kapacitor/expvar"
+	"github.com/influxdata/kapacitor/models"
+	"github.com/influxdata/kapacitor/pipeline"
+)
+
+const (
+	statsCounterResets = "counter_resets"
+	statsCounterWraps  = "counter_wraps"
+)
+
+type CounterNode struct {
+	node
+	c *pipeline.CounterNode
+
+	resetsCount *expvar.Int
+	wrapsCount  *expvar.Int
+}
+
+// Create a new CounterNode which computes the rate or increase of counters.
+func newCounterNode(et *ExecutingTask, n *pipeline.CounterNode, d NodeDiagnostic) (*CounterNode, error) {
+	cn := &CounterNode{
+		node: node{Node: n, et: et, diag: d},
+		c:    n,
+	}
+	cn.node.runF = cn.runCounter
+	return cn, nil
+}
+
+func (n *CounterNode) runCounter([]byte) error {
+	n.resetsCount = &expvar.Int{}
+	n.wrapsCount = &expvar.Int{}
+
+	n.statMap.Set(statsCounterResets, n.resetsCount)
+	n.statMap.Set(statsCounterWraps, n.wrapsCount)
+
+	consumer := n.newGroupedConsumer(n)
+	return consumer.Consume()
+}
+
+func (n *CounterNode) NewGroup(group edge.GroupInfo, first edge.PointMeta) (edge.Receiver, error) {
+	return edge.NewReceiverFromForwardReceiverWithStats(
+		n.outs,
+		edge.NewTimedForwardReceiver(n.timer, &counterGroup{n: n}),
+	), nil
+}
+
+// counterSample is a value of a counter and its increase since the previous sample.
+type counterSample struct {
+	time  time.Time
+	value float64
+	delta float64
+}
+
+type counterGroup struct {
+	n       *CounterNode
+	begin   edge.BeginBatchMessage
+	samples []counterSample
+}
+
+func (g *counterGroup) BeginBatch(begin edge.BeginBatchMessage) (edge.Message, error) {
+	g.begin = begin.ShallowCopy()
+	g.samples = g.samples[:0]
+	return nil, nil
+}
+
+func (g *counterGroup) BatchPoint(bp edge.BatchPointMessage) (edge.Message, error) {
+	if err := g.add(bp); err != nil {
+		g.n.diag.Error("failed to add counter point", err)
+	}
+	return nil, nil
+}
+
+func (g *counterGroup) EndBatch(end edge.EndBatchMessage) (edge.Message, error) {
+	stop := g.begin.Time()
+	var start time.Time
+	if g.n.c.Period > 0 {
+		start = stop.Add(-g.n.c.Period)
+	}
+	value, ok := g.n.result(g.samples, start, stop)
+	if !ok {
+		return nil, nil
+	}
+	return edge.NewPointMessage(
+		g.begin.Name(), "", "",
+		g.begin.Dimensions(),
+		models.Fields{g.n.c.As: value},
+		g.begin.Tags(),
+		stop,
+	), nil
+}
+
+func (g *counterGroup) Point(p edge.PointMessage) (edge.Message, error) {
+	if err := g.add(p); err != nil {
+		g.n.diag.Error("failed to add counter point", err)
+		return nil, nil
+	}
+	// Drop the samples before the range of the point.
+	start := p.Time().Add(-g.n.c.Period)
+	i := 0
+	for i < len(g.samples) && g.samples[i].time.Before(start) {
+		i++
+	}
+	g.samples = append(g.samples[:0], g.samples[i:]...)
+
+	value, ok := g.n.result(g.samples, start, p.Time())
+	if !ok {
+		return nil, nil
+	}
+	p = p.ShallowCopy()
+	fields := p.Fields().Copy()
+	fields[g.n.c.As] = value
+	p.SetFields(fields)
+	return p, nil
+}
+
+// add appends the value of the counter of the point,
+// with its increase since the previous sample.
+func (g *counterGroup) add(p edge.FieldsTagsTimeGetter) error {
+	value, ok := numToFloat(p.Fields()[g.n.c.Field])
+	if !ok {
+		return fmt.Errorf("field %q is missing or not a number, got %T", g.n.c.Field, p.Fields()[g.n.c.Field])
+	}
+	s := counterSample{
+		time:  p.Time(),
+		value: value,
+	}
+	if l := len(g.samples); l > 0 {
+		s.delta = g.n.delta(g.samples[l-1].value, value)
+	}
+	g.samples = append(g.samples, s)
+	return nil
+}
+
+func (g *counterGroup) Barrier(b edge.BarrierMessage) (edge.Message, error) {
+	return b, nil
+}
+
+func (g *counterGroup) DeleteGroup(d edge.DeleteGroupMessage) (edge.Message, error) {
+	return d, nil
+}
+
+// delta returns the increase of the counter from prev to curr, handling resets and wrap-arounds.
+func (n *CounterNode) delta(prev, curr float64) float64 {
+	if curr >= prev {
+		return curr - prev
+	}
+	if max := n.c.Max; max > 0 && prev > max/2 {
+		n.wrapsCount.Add(1)
+		return max - prev + 1 + curr
+	}
+	n.resetsCount.Add(1)
+	return curr
+}
+
+// result returns the rate or increase of the samples within the range start to stop.
+// If start is zero the increase is not extrapolated.
+func (n *CounterNode) result(samples []counterSample, start, stop time.Time) (float64, bool) {
+	if len(samples) < 2 {
+		return 0, false
+	}
+	first, last := samples[0], samples[len(samples)-1]
+	sampled := last.time.Sub(first.time).Seconds()
+	if sampled <= 0 {
+		return 0, false
+	}
+	var increase float64
+	// The delta of the first sample is from before the range.
+	for _, s := range samples[1:] {
+		increase += s.delta
+	}
+
+	rangeSeconds := sampled
+	if !start.IsZero() {
+		increase = extrapolateIncrease(increase, first.value, sampled, float64(len(samples)-1),
+			first.time.Sub(start).Seconds(),
+			stop.Sub(last.time).Seconds(),
+		)
+		rangeSeconds = stop.Sub(start).Seconds()
+	}
+	if n.c.Method == pipeline.CounterIncrease {
+		return increase, true
+	}
+	return increase / (rangeSeconds / n.c.Unit.Seconds()), true
+}
+
+// extrapolateIncrease extrapolates the increase over the sampled seconds to the boundaries of the range,
+// the same as the rate and increase functions of Prometheus.
+func extrapolateIncrease(increase, firstValue, sampled, intervals, toStart, toEnd float64) float64 {
+	average := sampled / intervals
+	threshold := average * 1.1
+
+	// The counter cannot be extrapolated to before it was zero.
+	if increase > 0 && firstValue >= 0 {
+		if toZero := sampled * (firstValue / increase); toZero < toStart {
+			toStart = toZero
+		}
+	}
+
+	extrapolated := sampled
+	if toStart < threshold {
+		extrapolated += toStart
+	} else {
+		extrapolated += average / 2
+	}
+	if toEnd < threshold {
+		extrapolated += toEnd
+	} else {
+		extrapolated += average / 2
+	}
+	return increase * (extrapolated / sampled)
+}
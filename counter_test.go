@@ -0,0 +1,135 @@
+package kapacitor
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/influxdata/kapacitor/expvar"
+	"github.com/influxdata/kapacitor/pipeline"
+)
+
+func newTestCounterNode(method string, max float64) *CounterNode {
+	return &CounterNode{
+		c: &pipeline.CounterNode{
+			Method: method,
+			Max:    max,
+			Unit:   time.Second,
+		},
+		resetsCount: &expvar.Int{},
+		wrapsCount:  &expvar.Int{},
+	}
+}
+
+func TestCounterNode_Delta(t *testing.T) {
+	n := newTestCounterNode(pipeline.CounterIncrease, 4294967295)
+	testCases := []struct {
+		prev, curr float64
+		exp        float64
+	}{
+		{prev: 10, curr: 15, exp: 5},
+		// Wrap-around of a 32 bit counter
+		{prev: 4294967290, curr: 4, exp: 10},
+		// Reset
+		{prev: 1000, curr: 4, exp: 4},
+	}
+	for _, tc := range testCases {
+		if got := n.delta(tc.prev, tc.curr); got != tc.exp {
+			t.Errorf("unexpected delta from %v to %v: got %v exp %v", tc.prev, tc.curr, got, tc.exp)
+		}
+	}
+	if got := n.wrapsCount.IntValue(); got != 1 {
+		t.Errorf("unexpected wraps, got %d exp 1", got)
+	}
+	if got := n.resetsCount.IntValue(); got != 1 {
+		t.Errorf("unexpected resets, got %d exp 1", got)
+	}
+
+	// Without a max every decrease is a reset.
+	n = newTestCounterNode(pipeline.CounterIncrease, 0)
+	if got := n.delta(4294967290, 4); got != 4 {
+		t.Errorf("unexpected delta without max: got %v exp 4", got)
+	}
+}
+
+func TestCounterNode_Result(t *testing.T) {
+	start := time.Date(2017, 1, 1, 0, 0, 0, 0, time.UTC)
+	samples := func(values ...float64) []counterSample {
+		n := newTestCounterNode(pipeline.CounterIncrease, 0)
+		s := make([]counterSample, len(values))
+		for i, v := range values {
+			s[i] = counterSample{
+				time:  start.Add(time.Duration(15+i*10) * time.Second),
+				value: v,
+			}
+			if i > 0 {
+				s[i].delta = n.delta(values[i-1], v)
+			}
+		}
+		return s
+	}
+	testCases := []struct {
+		name    string
+		method  string
+		samples []counterSample
+		start   time.Time
+		stop    time.Time
+		exp     float64
+	}{
+		{
+			name:    "increase without extrapolation",
+			method:  pipeline.CounterIncrease,
+			samples: samples(100, 110, 120, 130),
+			stop:    start.Add(time.Minute),
+			exp:     30,
+		},
+		{
+			// Samples from 15s to 45s of the 60s range, extrapolated by half an interval at both ends.
+			name:    "increase",
+			method:  pipeline.CounterIncrease,
+			samples: samples(100, 110, 120, 130),
+			start:   start,
+			stop:    start.Add(time.Minute),
+			exp:     40,
+		},
+		{
+			name:    "rate",
+			method:  pipeline.CounterRate,
+			samples: samples(100, 110, 120, 130),
+			start:   start,
+			stop:    start.Add(time.Minute),
+			exp:     40.0 / 60.0,
+		},
+		{
+			// The counter started at 5, 2.5s before the first sample.
+			name:    "not extrapolated past zero",
+			method:  pipeline.CounterIncrease,
+			samples: samples(5, 25, 45, 65),
+			start:   start,
+			stop:    start.Add(time.Minute),
+			exp:     60 * (32.5 + 5) / 30,
+		},
+		{
+			name:    "reset",
+			method:  pipeline.CounterIncrease,
+			samples: samples(100, 110, 5, 15),
+			stop:    start.Add(time.Minute),
+			exp:     25,
+		},
+	}
+	for _, tc := range testCases {
+		n := newTestCounterNode(tc.method, 0)
+		got, ok := n.result(tc.samples, tc.start, tc.stop)
+		if !ok {
+			t.Errorf("%s: expected a result", tc.name)
+			continue
+		}
+		if math.Abs(got-tc.exp) > 1e-9 {
+			t.Errorf("%s: unexpected result, got %v exp %v", tc.name, got, tc.exp)
+		}
+	}
+
+	if _, ok := newTestCounterNode(pipeline.CounterRate, 0).result(samples(1), start, start.Add(time.Minute)); ok {
+		t.Error("expected no result for a single sample")
+	}
+}
@@ -0,0 +1,255 @@
+package kapacitor
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+
+	"github.com/influxdata/kapacitor/pipeline"
+)
+
+// TaskDependency is an edge of the task dependency graph.
+// The upstream task writes points through a KapacitorLoopbackNode that the downstream task consumes.
+type TaskDependency struct {
+	Upstream        string
+	Downstream      string
+	Database        string
+	RetentionPolicy string
+	// Measurement is empty if the loopback keeps the measurement of the points.
+	Measurement string
+}
+
+// DependencyGraph is the graph of tasks that feed each other through KapacitorLoopbackNodes.
+type DependencyGraph struct {
+	// Tasks in the graph sorted by ID.
+	Tasks []string
+	// Dependencies sorted by upstream and then downstream task.
+	Dependencies []TaskDependency
+}
+
+// NewDependencyGraph creates the dependency graph of the tasks.
+// Loopback outputs are matched with the DBRPs and the from() filters of stream tasks.
+func NewDependencyGraph(tasks []*Task) *DependencyGraph {
+	g := &DependencyGraph{
+		Tasks: make([]string, len(tasks)),
+	}
+	for i, t := range tasks {
+		g.Tasks[i] = t.ID
+	}
+	sort.Strings(g.Tasks)
+
+	for _, upstream := range tasks {
+		for _, out := range LoopbackOutputs(upstream) {
+			for _, downstream := range tasks {
+				if downstream.consumes(out.Database, out.RetentionPolicy, out.Measurement) {
+					out.Upstream = upstream.ID
+					out.Downstream = downstream.ID
+					g.Dependencies = append(g.Dependencies, out)
+				}
+			}
+		}
+	}
+	sort.Sort(dependencyList(g.Dependencies))
+	return g
+}
+
+type dependencyList []TaskDependency
+
+func (l dependencyList) Len() int      { return len(l) }
+func (l dependencyList) Swap(i, j int) { l[i], l[j] = l[j], l[i] }
+func (l dependencyList) Less(i, j int) bool {
+	a, b := l[i], l[j]
+	if a.Upstream != b.Upstream {
+		return a.Upstream < b.Upstream
+	}
+	if a.Downstream != b.Downstream {
+		return a.Downstream < b.Downstream
+	}
+	return a.Measurement < b.Measurement
+}
+
+// LoopbackOutputs returns the database, retention policy and measurement of each loopback node of the task.
+func LoopbackOutputs(t *Task) []TaskDependency {
+	var outputs []TaskDependency
+	_ = t.Pipeline.Walk(func(n pipeline.Node) error {
+		if l, ok := n.(*pipeline.KapacitorLoopbackNode); ok {
+			outputs = append(outputs, TaskDependency{
+				Database:        l.Database,
+				RetentionPolicy: l.RetentionPolicy,
+				Measurement:     l.Measurement,
+			})
+		}
+		return nil
+	})
+	return outputs
+}
+
+// consumes reports whether any from() node of the task receives points written to the database, retention policy and measurement.
+// An empty measurement matches any measurement.
+func (t *Task) consumes(database, retentionPolicy, measurement string) bool {
+	if t.Type != StreamTask {
+		return false
+	}
+	allowed := false
+	for _, dbrp := range t.DBRPs {
+		if dbrp.Database == database && dbrp.RetentionPolicy == retentionPolicy {
+			allowed = true
+			break
+		}
+	}
+	if !allowed {
+		return false
+	}
+	consumes := false
+	_ = t.Pipeline.Walk(func(n pipeline.Node) error {
+		f, ok := n.(*pipeline.FromNode)
+		if !ok {
+			return nil
+		}
+		if (f.Database == "" || f.Database == database) &&
+			(f.RetentionPolicy == "" || f.RetentionPolicy == retentionPolicy) &&
+			(f.Measurement == "" || measurement == "" || f.Measurement == measurement) {
+			consumes = true
+		}
+		return nil
+	})
+	return consumes
+}
+
+// Downstream returns the IDs of the tasks the task directly feeds.
+func (g *DependencyGraph) Downstream(id string) []string {
+	var ids []string
+	for _, d := range g.Dependencies {
+		if d.Upstream == id {
+			ids = appendUnique(ids, d.Downstream)
+		}
+	}
+	return ids
+}
+
+// Upstream returns the IDs of the tasks that directly feed the task.
+func (g *DependencyGraph) Upstream(id string) []string {
+	var ids []string
+	for _, d := range g.Dependencies {
+		if d.Downstream == id {
+			ids = appendUnique(ids, d.Upstream)
+		}
+	}
+	return ids
+}
+
+func appendUnique(ids []string, id string) []string {
+	for _, existing := range ids {
+		if existing == id {
+			return ids
+		}
+	}
+	return append(ids, id)
+}
+
+// Cycles returns the sets of tasks that feed each other in a loop.
+// Each cycle is sorted by task ID.
+func (g *DependencyGraph) Cycles() [][]string {
+	// Tarjan's strongly connected components algorithm,
+	// any component with more than one task or a task that feeds itself is a cycle.
+	var (
+		index    = make(map[string]int, len(g.Tasks))
+		lowlink  = make(map[string]int, len(g.Tasks))
+		onStack  = make(map[string]bool, len(g.Tasks))
+		stack    []string
+		next     int
+		cycles   [][]string
+		strongly func(id string)
+	)
+	strongly = func(id string) {
+		index[id] = next
+		lowlink[id] = next
+		next++
+		stack = append(stack, id)
+		onStack[id] = true
+		for _, d := range g.Downstream(id) {
+			if _, visited := index[d]; !visited {
+				strongly(d)
+				if lowlink[d] < lowlink[id] {
+					lowlink[id] = lowlink[d]
+				}
+			} else if onStack[d] && index[d] < lowlink[id] {
+				lowlink[id] = index[d]
+			}
+		}
+		if lowlink[id] != index[id] {
+			return
+		}
+		var component []string
+		for {
+			top := stack[len(stack)-1]
+			stack = stack[:len(stack)-1]
+			onStack[top] = false
+			component = append(component, top)
+			if top == id {
+				break
+			}
+		}
+		if len(component) > 1 || g.feeds(id, id) {
+			sort.Strings(component)
+			cycles = append(cycles, component)
+		}
+	}
+	for _, id := range g.Tasks {
+		if _, visited := index[id]; !visited {
+			strongly(id)
+		}
+	}
+	sort.Sort(cycleList(cycles))
+	return cycles
+}
+
+// cycleList sorts the cycles by their first task, the cycles are disjoint and sorted themselves.
+type cycleList [][]string
+
+func (l cycleList) Len() int           { return len(l) }
+func (l cycleList) Less(i, j int) bool { return l[i][0] < l[j][0] }
+func (l cycleList) Swap(i, j int)      { l[i], l[j] = l[j], l[i] }
+
+func (g *DependencyGraph) feeds(upstream, downstream string) bool {
+	for _, d := range g.Dependencies {
+		if d.Upstream == upstream && d.Downstream == downstream {
+			return true
+		}
+	}
+	return false
+}
+
+// Dot returns a graphviz .dot formatted byte array of the graph.
+// Disabled tasks are dashed and dependencies that are part of a cycle are red.
+func (g *DependencyGraph) Dot(disabled map[string]bool) []byte {
+	inCycle := make(map[string]int)
+	for i, c := range g.Cycles() {
+		for _, id := range c {
+			inCycle[id] = i + 1
+		}
+	}
+
+	var buf bytes.Buffer
+	buf.WriteString("digraph dependencies {\n")
+	for _, id := range g.Tasks {
+		if disabled[id] {
+			buf.WriteString(fmt.Sprintf("%q [style=\"dashed\"];\n", id))
+		} else {
+			buf.WriteString(fmt.Sprintf("%q;\n", id))
+		}
+	}
+	for _, d := range g.Dependencies {
+		label := fmt.Sprintf("%q.%q", d.Database, d.RetentionPolicy)
+		if d.Measurement != "" {
+			label += "." + d.Measurement
+		}
+		attrs := fmt.Sprintf("label=%q", label)
+		if c := inCycle[d.Upstream]; c != 0 && c == inCycle[d.Downstream] {
+			attrs += " color=\"red\""
+		}
+		buf.WriteString(fmt.Sprintf("%q -> %q [%s];\n", d.Upstream, d.Downstream, attrs))
+	}
+	buf.WriteString("}")
+	return buf.Bytes()
+}
@@ -0,0 +1,133 @@
+package kapacitor
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/influxdata/kapacitor/pipeline"
+	"github.com/influxdata/kapacitor/tick/stateful"
+)
+
+type noDeadman struct{}
+
+func (noDeadman) Interval() time.Duration { return 0 }
+func (noDeadman) Threshold() float64      { return 0 }
+func (noDeadman) Id() string              { return "" }
+func (noDeadman) Message() string         { return "" }
+func (noDeadman) Global() bool            { return false }
+
+func newDependencyTestTask(t *testing.T, id, script string, dbrps ...DBRP) *Task {
+	p, err := pipeline.CreatePipeline(script, pipeline.StreamEdge, stateful.NewScope(), noDeadman{}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &Task{
+		ID:       id,
+		Type:     StreamTask,
+		DBRPs:    dbrps,
+		Pipeline: p,
+	}
+}
+
+func TestDependencyGraph(t *testing.T) {
+	raw := DBRP{Database: "raw", RetentionPolicy: "autogen"}
+	derived := DBRP{Database: "derived", RetentionPolicy: "autogen"}
+	tasks := []*Task{
+		newDependencyTestTask(t, "mean", `
+stream
+	|from()
+		.measurement('cpu')
+	|window()
+		.period(10s)
+		.every(10s)
+	|mean('usage')
+	|kapacitorLoopback()
+		.database('derived')
+		.retentionPolicy('autogen')
+		.measurement('cpu_mean')
+`, raw),
+		newDependencyTestTask(t, "alert", `
+stream
+	|from()
+		.measurement('cpu_mean')
+	|alert()
+		.crit(lambda: "mean" > 90)
+`, derived),
+		newDependencyTestTask(t, "other", `
+stream
+	|from()
+		.measurement('mem')
+	|alert()
+		.crit(lambda: "used" > 90)
+`, derived),
+		newDependencyTestTask(t, "unrelated", `
+stream
+	|from()
+		.measurement('cpu_mean')
+	|alert()
+		.crit(lambda: "mean" > 90)
+`, raw),
+	}
+
+	g := NewDependencyGraph(tasks)
+	if exp, got := []string{"alert", "mean", "other", "unrelated"}, g.Tasks; !reflect.DeepEqual(exp, got) {
+		t.Errorf("unexpected tasks:\ngot\n%v\nexp\n%v", got, exp)
+	}
+	exp := []TaskDependency{{
+		Upstream:        "mean",
+		Downstream:      "alert",
+		Database:        "derived",
+		RetentionPolicy: "autogen",
+		Measurement:     "cpu_mean",
+	}}
+	if got := g.Dependencies; !reflect.DeepEqual(exp, got) {
+		t.Errorf("unexpected dependencies:\ngot\n%v\nexp\n%v", got, exp)
+	}
+	if exp, got := []string{"alert"}, g.Downstream("mean"); !reflect.DeepEqual(exp, got) {
+		t.Errorf("unexpected downstream tasks: got %v exp %v", got, exp)
+	}
+	if exp, got := []string{"mean"}, g.Upstream("alert"); !reflect.DeepEqual(exp, got) {
+		t.Errorf("unexpected upstream tasks: got %v exp %v", got, exp)
+	}
+	if cycles := g.Cycles(); len(cycles) != 0 {
+		t.Errorf("unexpected cycles: %v", cycles)
+	}
+}
+
+func TestDependencyGraph_Cycles(t *testing.T) {
+	a := DBRP{Database: "a", RetentionPolicy: "autogen"}
+	b := DBRP{Database: "b", RetentionPolicy: "autogen"}
+	c := DBRP{Database: "c", RetentionPolicy: "autogen"}
+	loop := func(db string) string {
+		return `
+stream
+	|from()
+	|kapacitorLoopback()
+		.database('` + db + `')
+		.retentionPolicy('autogen')
+`
+	}
+	tasks := []*Task{
+		newDependencyTestTask(t, "a", loop("b"), a),
+		newDependencyTestTask(t, "b", loop("a"), b),
+		newDependencyTestTask(t, "c", loop("a"), c),
+	}
+
+	g := NewDependencyGraph(tasks)
+	if exp, got := [][]string{{"a", "b"}}, g.Cycles(); !reflect.DeepEqual(exp, got) {
+		t.Errorf("unexpected cycles:\ngot\n%v\nexp\n%v", got, exp)
+	}
+
+	expDot := `digraph dependencies {
+"a";
+"b";
+"c" [style="dashed"];
+"a" -> "b" [label="\"b\".\"autogen\"" color="red"];
+"b" -> "a" [label="\"a\".\"autogen\"" color="red"];
+"c" -> "a" [label="\"a\".\"autogen\""];
+}`
+	if got := string(g.Dot(map[string]bool{"c": true})); got != expDot {
+		t.Errorf("unexpected dot:\ngot\n%s\nexp\n%s", got, expDot)
+	}
+}
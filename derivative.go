@@ -28,17 +28,13 @@ func newDerivativeNode(et *ExecutingTask, n *pipeline.DerivativeNode, d NodeDiag
 }
 
 func (n *DerivativeNode) runDerivative([]byte) error {
-	consumer := edge.NewGroupedConsumer(
-		n.ins[0],
-		n,
-	)
-	n.statMap.Set(statCardinalityGauge, consumer.CardinalityVar())
+	consumer := n.newGroupedConsumer(n)
 	return consumer.Consume()
 }
 
 func (n *DerivativeNode) NewGroup(group edge.GroupInfo, first edge.PointMeta) (edge.Receiver, error) {
 	return edge.NewReceiverFromForwardReceiverWithStats(
-		n.outs,
+		n.groupOuts(group),
 		edge.NewTimedForwardReceiver(n.timer, n.newGroup()),
 	), nil
 }
@@ -13,6 +13,7 @@ import (
 const (
 	statCollected = "collected"
 	statEmitted   = "emitted"
+	statDropped   = "dropped"
 
 	defaultEdgeBufferSize = 1000
 )
@@ -34,8 +35,31 @@ type Edge struct {
 	diag     EdgeDiagnostic
 }
 
-func newEdge(taskName, parentName, childName string, t pipeline.EdgeType, size int, d EdgeDiagnostic) edge.StatsEdge {
-	e := edge.NewStatsEdge(edge.NewChannelEdge(t, defaultEdgeBufferSize))
+// edgeOptions configure the edges created by newEdge.
+type edgeOptions struct {
+	size   int
+	policy edge.OverflowPolicy
+	// tracer records the traced messages to the child if it is not nil.
+	tracer *edge.Tracer
+	// transport creates the underlying edge, edge.NewBufferedEdge if nil.
+	transport edge.Transport
+}
+
+// newEdge creates an edge from the parent to the child.
+func newEdge(taskName, parentName, childName string, t pipeline.EdgeType, opts edgeOptions, d EdgeDiagnostic) edge.StatsEdge {
+	transport := opts.transport
+	if transport == nil {
+		transport = edge.NewBufferedEdge
+	}
+	ce := transport(t, opts.size, opts.policy)
+	dropped := expvar.IntVar(new(expvar.Int))
+	if de, ok := ce.(edge.DroppingEdge); ok {
+		dropped = de.DroppedVar()
+	}
+	if opts.tracer != nil {
+		ce = edge.NewTracingEdge(ce, opts.tracer)
+	}
+	e := edge.NewStatsEdge(ce)
 	tags := map[string]string{
 		"task":   taskName,
 		"parent": parentName,
@@ -45,6 +69,7 @@ func newEdge(taskName, parentName, childName string, t pipeline.EdgeType, size i
 	key, sm := vars.NewStatistic("edges", tags)
 	sm.Set(statCollected, e.CollectedVar())
 	sm.Set(statEmitted, e.EmittedVar())
+	sm.Set(statDropped, dropped)
 	return &Edge{
 		StatsEdge: e,
 		statsKey:  key,
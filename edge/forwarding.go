@@ -56,27 +56,34 @@ type forwardingBufferedReceiver struct {
 }
 
 func (fr *forwardingReceiver) BeginBatch(begin BeginBatchMessage) error {
-	return fr.forward(fr.r.BeginBatch(begin))
+	msg, err := fr.r.BeginBatch(begin)
+	return fr.forward(withTrace(begin, msg), err)
 }
 func (fr *forwardingReceiver) BatchPoint(bp BatchPointMessage) error {
-	return fr.forward(fr.r.BatchPoint(bp))
+	msg, err := fr.r.BatchPoint(bp)
+	return fr.forward(withTrace(bp, msg), err)
 }
 func (fr *forwardingReceiver) EndBatch(end EndBatchMessage) error {
-	return fr.forward(fr.r.EndBatch(end))
+	msg, err := fr.r.EndBatch(end)
+	return fr.forward(withTrace(end, msg), err)
 }
 
 func (fr *forwardingBufferedReceiver) BufferedBatch(batch BufferedBatchMessage) error {
-	return fr.forward(fr.b.BufferedBatch(batch))
+	msg, err := fr.b.BufferedBatch(batch)
+	return fr.forward(withTrace(batch, msg), err)
 }
 
 func (fr *forwardingReceiver) Point(p PointMessage) error {
-	return fr.forward(fr.r.Point(p))
+	msg, err := fr.r.Point(p)
+	return fr.forward(withTrace(p, msg), err)
 }
 func (fr *forwardingReceiver) Barrier(b BarrierMessage) error {
-	return fr.forward(fr.r.Barrier(b))
+	msg, err := fr.r.Barrier(b)
+	return fr.forward(withTrace(b, msg), err)
 }
 func (fr *forwardingReceiver) DeleteGroup(d DeleteGroupMessage) error {
-	return fr.forward(fr.r.DeleteGroup(d))
+	msg, err := fr.r.DeleteGroup(d)
+	return fr.forward(withTrace(d, msg), err)
 }
 
 func (fr *forwardingReceiver) forward(msg Message, err error) error {
@@ -1,6 +1,7 @@
 package edge
 
 import (
+	"container/list"
 	"errors"
 
 	"github.com/influxdata/kapacitor/expvar"
@@ -12,6 +13,18 @@ type GroupedConsumer interface {
 	Consumer
 	// CardinalityVar is an exported var that indicates the current number of groups being managed.
 	CardinalityVar() expvar.IntVar
+	// DroppedVar is an exported var that counts the messages dropped because of the group limit.
+	DroppedVar() expvar.IntVar
+	// EvictedVar is an exported var that counts the groups evicted because of the group limit.
+	EvictedVar() expvar.IntVar
+}
+
+// GroupLimits limits the number of groups a grouped consumer manages.
+type GroupLimits struct {
+	// MaxGroups is the maximum number of groups, zero means no limit.
+	MaxGroups int
+	// Policy decides what happens to a new group once MaxGroups has been reached.
+	Policy LimitPolicy
 }
 
 // GroupedReceiver creates and deletes receivers as groups are created and deleted.
@@ -34,16 +47,41 @@ type groupedConsumer struct {
 	groups      map[models.GroupID]Receiver
 	current     Receiver
 	cardinality *expvar.Int
+
+	limits  GroupLimits
+	dropped *expvar.Int
+	evicted *expvar.Int
+	// Groups ordered from most to least recently used, only maintained when limited.
+	lru      *list.List
+	elements map[models.GroupID]*list.Element
 }
 
 // NewGroupedConsumer creates a new grouped consumer for edge e and grouped receiver r.
 func NewGroupedConsumer(e Edge, r GroupedReceiver) GroupedConsumer {
+	return NewLimitedGroupedConsumer(e, r, GroupLimits{})
+}
+
+// NewLimitedGroupedConsumer creates a new grouped consumer for edge e and grouped receiver r,
+// that manages at most limits.MaxGroups groups.
+func NewLimitedGroupedConsumer(e Edge, r GroupedReceiver, limits GroupLimits) GroupedConsumer {
+	gc := newGroupedConsumer(r, limits)
+	gc.consumer = NewConsumerWithReceiver(e, gc)
+	return gc
+}
+
+func newGroupedConsumer(r GroupedReceiver, limits GroupLimits) *groupedConsumer {
 	gc := &groupedConsumer{
 		gr:          r,
 		groups:      make(map[models.GroupID]Receiver),
 		cardinality: new(expvar.Int),
+		limits:      limits,
+		dropped:     new(expvar.Int),
+		evicted:     new(expvar.Int),
+	}
+	if limits.MaxGroups > 0 {
+		gc.lru = list.New()
+		gc.elements = make(map[models.GroupID]*list.Element)
 	}
-	gc.consumer = NewConsumerWithReceiver(e, gc)
 	return gc
 }
 
@@ -53,10 +91,29 @@ func (c *groupedConsumer) Consume() error {
 func (c *groupedConsumer) CardinalityVar() expvar.IntVar {
 	return c.cardinality
 }
+func (c *groupedConsumer) DroppedVar() expvar.IntVar {
+	return c.dropped
+}
+func (c *groupedConsumer) EvictedVar() expvar.IntVar {
+	return c.evicted
+}
 
 func (c *groupedConsumer) getOrCreateGroup(group GroupInfo, first PointMeta) (Receiver, error) {
 	r, ok := c.groups[group.ID]
 	if !ok {
+		if c.limits.MaxGroups > 0 && len(c.groups) >= c.limits.MaxGroups {
+			switch c.limits.Policy {
+			case DropPolicy:
+				c.dropped.Add(1)
+				return droppedReceiver{}, nil
+			case EvictPolicy:
+				if err := c.evictGroup(); err != nil {
+					return nil, err
+				}
+			default:
+				return nil, LimitError{Resource: "groups", Limit: c.limits.MaxGroups}
+			}
+		}
 		c.cardinality.Add(1)
 		recv, err := c.gr.NewGroup(group, first)
 		if err != nil {
@@ -65,9 +122,29 @@ func (c *groupedConsumer) getOrCreateGroup(group GroupInfo, first PointMeta) (Re
 		c.groups[group.ID] = recv
 		r = recv
 	}
+	if c.lru != nil {
+		if e, ok := c.elements[group.ID]; ok {
+			c.lru.MoveToFront(e)
+		} else {
+			c.elements[group.ID] = c.lru.PushFront(group.ID)
+		}
+	}
 	return r, nil
 }
 
+// evictGroup deletes the least recently used group.
+// The delete group message is passed on to the group's receiver so that its state is released downstream as well.
+func (c *groupedConsumer) evictGroup() error {
+	e := c.lru.Back()
+	if e == nil {
+		return nil
+	}
+	id := c.lru.Remove(e).(models.GroupID)
+	delete(c.elements, id)
+	c.evicted.Add(1)
+	return c.DeleteGroup(NewDeleteGroupMessage(id))
+}
+
 func (c *groupedConsumer) BeginBatch(begin BeginBatchMessage) error {
 	r, err := c.getOrCreateGroup(begin.GroupInfo(), begin)
 	if err != nil {
@@ -123,7 +200,22 @@ func (c *groupedConsumer) DeleteGroup(d DeleteGroupMessage) error {
 	if ok {
 		delete(c.groups, id)
 		c.cardinality.Add(-1)
+		if e, ok := c.elements[id]; ok {
+			c.lru.Remove(e)
+			delete(c.elements, id)
+		}
 		return r.DeleteGroup(d)
 	}
 	return nil
 }
+
+// droppedReceiver discards all messages for a group that exceeded the group limit.
+type droppedReceiver struct{}
+
+func (droppedReceiver) BeginBatch(BeginBatchMessage) error       { return nil }
+func (droppedReceiver) BatchPoint(BatchPointMessage) error       { return nil }
+func (droppedReceiver) EndBatch(EndBatchMessage) error           { return nil }
+func (droppedReceiver) BufferedBatch(BufferedBatchMessage) error { return nil }
+func (droppedReceiver) Point(PointMessage) error                 { return nil }
+func (droppedReceiver) Barrier(BarrierMessage) error             { return nil }
+func (droppedReceiver) DeleteGroup(DeleteGroupMessage) error     { return nil }
@@ -0,0 +1,110 @@
+package edge_test
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/influxdata/kapacitor/edge"
+	"github.com/influxdata/kapacitor/models"
+	"github.com/influxdata/kapacitor/pipeline"
+)
+
+// groupRecorder records the points received and the groups deleted per group.
+type groupRecorder struct {
+	points  map[string]int
+	deleted []string
+}
+
+func (r *groupRecorder) NewGroup(group edge.GroupInfo, first edge.PointMeta) (edge.Receiver, error) {
+	return &groupRecorderReceiver{r: r, host: group.Tags["host"]}, nil
+}
+
+type groupRecorderReceiver struct {
+	noopReceiver
+	r    *groupRecorder
+	host string
+}
+
+func (gr *groupRecorderReceiver) Point(p edge.PointMessage) error {
+	gr.r.points[gr.host]++
+	return nil
+}
+
+func (gr *groupRecorderReceiver) DeleteGroup(d edge.DeleteGroupMessage) error {
+	gr.r.deleted = append(gr.r.deleted, gr.host)
+	return nil
+}
+
+func hostPoint(host string) edge.PointMessage {
+	return edge.NewPointMessage(
+		name,
+		db,
+		rp,
+		models.Dimensions{TagNames: []string{"host"}},
+		models.Fields{"value": 1.0},
+		models.Tags{"host": host},
+		now,
+	)
+}
+
+func TestGroupedConsumer_Limits(t *testing.T) {
+	hosts := []string{"a", "b", "a", "c", "b", "d"}
+	testCases := []struct {
+		policy  edge.LimitPolicy
+		points  map[string]int
+		deleted []string
+		dropped int64
+		evicted int64
+		err     error
+	}{
+		{
+			policy:  edge.DropPolicy,
+			points:  map[string]int{"a": 2, "b": 2},
+			dropped: 2,
+		},
+		{
+			policy: edge.EvictPolicy,
+			// c evicts the least recently used group b, b then evicts a, d evicts c.
+			points:  map[string]int{"a": 2, "b": 2, "c": 1, "d": 1},
+			deleted: []string{"b", "a", "c"},
+			evicted: 3,
+		},
+		{
+			policy: edge.StopPolicy,
+			points: map[string]int{"a": 2, "b": 1},
+			err:    edge.LimitError{Resource: "groups", Limit: 2},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.policy.String(), func(t *testing.T) {
+			e := edge.NewChannelEdge(pipeline.StreamEdge, defaultEdgeBufferSize)
+			r := &groupRecorder{points: make(map[string]int)}
+			consumer := edge.NewLimitedGroupedConsumer(e, r, edge.GroupLimits{
+				MaxGroups: 2,
+				Policy:    tc.policy,
+			})
+			for _, host := range hosts {
+				e.Collect(hostPoint(host))
+			}
+			e.Close()
+			if err := consumer.Consume(); !reflect.DeepEqual(err, tc.err) {
+				t.Fatalf("unexpected error: got %v exp %v", err, tc.err)
+			}
+			if !reflect.DeepEqual(r.points, tc.points) {
+				t.Errorf("unexpected points: got %v exp %v", r.points, tc.points)
+			}
+			if !reflect.DeepEqual(r.deleted, tc.deleted) {
+				t.Errorf("unexpected deleted groups: got %v exp %v", r.deleted, tc.deleted)
+			}
+			if got := consumer.DroppedVar().IntValue(); got != tc.dropped {
+				t.Errorf("unexpected dropped count: got %d exp %d", got, tc.dropped)
+			}
+			if got := consumer.EvictedVar().IntValue(); got != tc.evicted {
+				t.Errorf("unexpected evicted count: got %d exp %d", got, tc.evicted)
+			}
+			if got := consumer.CardinalityVar().IntValue(); got > 2 {
+				t.Errorf("cardinality exceeds the limit: %d", got)
+			}
+		})
+	}
+}
@@ -0,0 +1,59 @@
+package edge
+
+import (
+	"fmt"
+)
+
+// LimitPolicy decides what happens once a resource limit has been reached.
+type LimitPolicy int
+
+const (
+	// DropPolicy drops any new data that would exceed the limit.
+	DropPolicy LimitPolicy = iota
+	// EvictPolicy evicts the least recently used data to make room for the new data.
+	EvictPolicy
+	// StopPolicy returns a LimitError, which stops the task.
+	StopPolicy
+)
+
+func (p LimitPolicy) String() string {
+	switch p {
+	case DropPolicy:
+		return "drop"
+	case EvictPolicy:
+		return "evict"
+	case StopPolicy:
+		return "stop"
+	default:
+		return "unknown"
+	}
+}
+
+func (p LimitPolicy) MarshalText() ([]byte, error) {
+	return []byte(p.String()), nil
+}
+
+func (p *LimitPolicy) UnmarshalText(text []byte) error {
+	switch string(text) {
+	case "drop":
+		*p = DropPolicy
+	case "evict":
+		*p = EvictPolicy
+	case "stop":
+		*p = StopPolicy
+	default:
+		return fmt.Errorf("unknown limit policy %q, must be one of 'drop', 'evict' or 'stop'", string(text))
+	}
+	return nil
+}
+
+// LimitError is returned when a limit has been reached and the policy is StopPolicy.
+type LimitError struct {
+	// Resource is the name of the limited resource, i.e. groups.
+	Resource string
+	Limit    int
+}
+
+func (e LimitError) Error() string {
+	return fmt.Sprintf("limit of %d %s reached", e.Limit, e.Resource)
+}
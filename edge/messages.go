@@ -176,6 +176,8 @@ type pointMessage struct {
 	fields models.Fields
 
 	time time.Time
+
+	trace *Trace
 }
 
 func NewPointMessage(
@@ -209,6 +211,13 @@ func (*pointMessage) Type() MessageType {
 	return Point
 }
 
+func (pm *pointMessage) Trace() *Trace {
+	return pm.trace
+}
+func (pm *pointMessage) SetTrace(t *Trace) {
+	pm.trace = t
+}
+
 func (pm *pointMessage) Name() string {
 	return pm.name
 }
@@ -394,6 +403,8 @@ type beginBatchMessage struct {
 	// If non-zero expect a batch with SizeHint points,
 	// otherwise an unknown number of points are coming.
 	sizeHint int
+
+	trace *Trace
 }
 
 func NewBeginBatchMessage(
@@ -429,6 +440,13 @@ func (bb *beginBatchMessage) ShallowCopy() BeginBatchMessage {
 	return c
 }
 
+func (bb *beginBatchMessage) Trace() *Trace {
+	return bb.trace
+}
+func (bb *beginBatchMessage) SetTrace(t *Trace) {
+	bb.trace = t
+}
+
 func (bb *beginBatchMessage) Name() string {
 	return bb.name
 }
@@ -637,6 +655,18 @@ func (bb *bufferedBatchMessage) SetBegin(begin BeginBatchMessage) {
 	bb.begin = begin
 }
 
+// Trace returns the trace of the begin message of the batch.
+func (bb *bufferedBatchMessage) Trace() *Trace {
+	return TraceOf(bb.begin)
+}
+
+// SetTrace sets the trace of the begin message of the batch.
+func (bb *bufferedBatchMessage) SetTrace(t *Trace) {
+	if b, ok := bb.begin.(Traced); ok {
+		b.SetTrace(t)
+	}
+}
+
 func (bb *bufferedBatchMessage) Name() string {
 	return bb.begin.Name()
 }
@@ -915,6 +945,12 @@ type deleteGroupMessage struct {
 	groupID models.GroupID
 }
 
+func NewDeleteGroupMessage(groupID models.GroupID) DeleteGroupMessage {
+	return &deleteGroupMessage{
+		groupID: groupID,
+	}
+}
+
 func (d *deleteGroupMessage) Type() MessageType {
 	return DeleteGroup
 }
@@ -0,0 +1,252 @@
+package edge
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/influxdata/kapacitor/expvar"
+	"github.com/influxdata/kapacitor/pipeline"
+)
+
+// OverflowPolicy decides what an edge does with a new message once its buffer is full.
+type OverflowPolicy int
+
+const (
+	// BlockPolicy blocks the sending node until the receiving node has made room.
+	BlockPolicy OverflowPolicy = iota
+	// DropOldestPolicy drops the oldest buffered data message to make room for the new message.
+	DropOldestPolicy
+	// DropNewestPolicy drops the new data message.
+	DropNewestPolicy
+)
+
+func (p OverflowPolicy) String() string {
+	switch p {
+	case BlockPolicy:
+		return pipeline.BlockOverflow
+	case DropOldestPolicy:
+		return pipeline.DropOldestOverflow
+	case DropNewestPolicy:
+		return pipeline.DropNewestOverflow
+	default:
+		return "unknown"
+	}
+}
+
+func (p OverflowPolicy) MarshalText() ([]byte, error) {
+	return []byte(p.String()), nil
+}
+
+func (p *OverflowPolicy) UnmarshalText(text []byte) error {
+	switch string(text) {
+	case "", pipeline.BlockOverflow:
+		*p = BlockPolicy
+	case pipeline.DropOldestOverflow:
+		*p = DropOldestPolicy
+	case pipeline.DropNewestOverflow:
+		*p = DropNewestPolicy
+	default:
+		return fmt.Errorf("unknown overflow policy %q, must be one of %q, %q or %q",
+			string(text), pipeline.BlockOverflow, pipeline.DropOldestOverflow, pipeline.DropNewestOverflow)
+	}
+	return nil
+}
+
+// Transport creates the edges that carry the messages between nodes.
+type Transport func(typ pipeline.EdgeType, size int, policy OverflowPolicy) Edge
+
+// NewBufferedEdge is the default Transport.
+// Edges that block use channels, edges that drop messages use a queue so that they can drop any buffered message.
+func NewBufferedEdge(typ pipeline.EdgeType, size int, policy OverflowPolicy) Edge {
+	if policy == BlockPolicy {
+		return NewChannelEdge(typ, size)
+	}
+	return newQueueEdge(typ, size, policy)
+}
+
+// DroppingEdge is an edge that drops messages when its buffer is full.
+type DroppingEdge interface {
+	Edge
+	// DroppedVar is an exported var that represents the number of messages dropped by this edge.
+	// Dropped messages have been collected but are never emitted.
+	DroppedVar() expvar.IntVar
+}
+
+// droppable reports whether the message carries data that can be dropped.
+// Dropping any other message, i.e. the end of a batch or a barrier, would break the receiving node.
+func droppable(m Message) bool {
+	switch m.Type() {
+	case Point, BatchPoint, BufferedBatch:
+		return true
+	default:
+		return false
+	}
+}
+
+// queueEdge is an implementation of Edge using a queue,
+// which drops data messages according to its policy when the queue is full.
+// When there is no data message to drop the edge blocks.
+type queueEdge struct {
+	typ    pipeline.EdgeType
+	size   int
+	policy OverflowPolicy
+
+	mu    sync.Mutex
+	queue []Message
+	state edgeState
+
+	// readable and writable are signaled when a message has been queued or dequeued.
+	readable chan struct{}
+	writable chan struct{}
+	aborting chan struct{}
+
+	dropped *expvar.Int
+	// onDrop is called with each dropped message if it is not nil.
+	onDrop func(Message)
+}
+
+func newQueueEdge(typ pipeline.EdgeType, size int, policy OverflowPolicy) *queueEdge {
+	if size < 1 {
+		size = 1
+	}
+	return &queueEdge{
+		typ:      typ,
+		size:     size,
+		policy:   policy,
+		queue:    make([]Message, 0, size),
+		state:    edgeOpen,
+		readable: make(chan struct{}, 1),
+		writable: make(chan struct{}, 1),
+		aborting: make(chan struct{}),
+		dropped:  new(expvar.Int),
+	}
+}
+
+func signal(c chan struct{}) {
+	select {
+	case c <- struct{}{}:
+	default:
+	}
+}
+
+func (e *queueEdge) Collect(m Message) error {
+	e.mu.Lock()
+	for {
+		switch e.state {
+		case edgeAborted:
+			e.mu.Unlock()
+			return ErrAborted
+		case edgeClosed:
+			e.mu.Unlock()
+			return errors.New("edge closed cannot collect")
+		}
+		if len(e.queue) < e.size {
+			e.queue = append(e.queue, m)
+			e.mu.Unlock()
+			signal(e.readable)
+			return nil
+		}
+		if e.overflow(m) {
+			e.mu.Unlock()
+			signal(e.readable)
+			return nil
+		}
+		e.mu.Unlock()
+		select {
+		case <-e.writable:
+		case <-e.aborting:
+			return ErrAborted
+		}
+		e.mu.Lock()
+	}
+}
+
+// overflow applies the policy to the new message and reports whether the message has been handled.
+// Must be called with the lock held.
+func (e *queueEdge) overflow(m Message) bool {
+	switch e.policy {
+	case DropNewestPolicy:
+		if droppable(m) {
+			e.drop(m)
+			return true
+		}
+	case DropOldestPolicy:
+		for i, q := range e.queue {
+			if droppable(q) {
+				last := len(e.queue) - 1
+				copy(e.queue[i:], e.queue[i+1:])
+				e.queue[last] = m
+				e.drop(q)
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func (e *queueEdge) drop(m Message) {
+	e.dropped.Add(1)
+	if e.onDrop != nil {
+		e.onDrop(m)
+	}
+}
+
+func (e *queueEdge) Emit() (Message, bool) {
+	e.mu.Lock()
+	for {
+		if e.state == edgeAborted {
+			e.mu.Unlock()
+			return nil, false
+		}
+		if len(e.queue) > 0 {
+			m := e.queue[0]
+			e.queue[0] = nil
+			e.queue = e.queue[1:]
+			e.mu.Unlock()
+			signal(e.writable)
+			return m, true
+		}
+		if e.state == edgeClosed {
+			e.mu.Unlock()
+			return nil, false
+		}
+		e.mu.Unlock()
+		select {
+		case <-e.readable:
+		case <-e.aborting:
+			return nil, false
+		}
+		e.mu.Lock()
+	}
+}
+
+func (e *queueEdge) Close() error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.state != edgeOpen {
+		return errors.New("edge not open cannot close")
+	}
+	e.state = edgeClosed
+	signal(e.readable)
+	return nil
+}
+
+func (e *queueEdge) Abort() {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.state == edgeAborted {
+		//nothing to do, already aborted
+		return
+	}
+	close(e.aborting)
+	e.state = edgeAborted
+}
+
+func (e *queueEdge) Type() pipeline.EdgeType {
+	return e.typ
+}
+
+func (e *queueEdge) DroppedVar() expvar.IntVar {
+	return e.dropped
+}
@@ -0,0 +1,110 @@
+package edge_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/influxdata/kapacitor/edge"
+	"github.com/influxdata/kapacitor/models"
+	"github.com/influxdata/kapacitor/pipeline"
+)
+
+func newValuePoint(v int64) edge.PointMessage {
+	return edge.NewPointMessage(name, db, rp, models.Dimensions{}, models.Fields{"value": v}, nil, now)
+}
+
+func TestBufferedEdge_Overflow(t *testing.T) {
+	barrier := edge.NewBarrierMessage(now)
+	testCases := []struct {
+		policy edge.OverflowPolicy
+		in     []edge.Message
+		exp    []interface{}
+	}{
+		{
+			policy: edge.DropNewestPolicy,
+			in:     []edge.Message{newValuePoint(1), newValuePoint(2), newValuePoint(3), newValuePoint(4)},
+			exp:    []interface{}{int64(1), int64(2)},
+		},
+		{
+			policy: edge.DropOldestPolicy,
+			in:     []edge.Message{newValuePoint(1), newValuePoint(2), newValuePoint(3), newValuePoint(4)},
+			exp:    []interface{}{int64(3), int64(4)},
+		},
+		{
+			// Barriers are never dropped, the oldest point is dropped instead.
+			policy: edge.DropOldestPolicy,
+			in:     []edge.Message{barrier, newValuePoint(1), newValuePoint(2)},
+			exp:    []interface{}{edge.Barrier, int64(2)},
+		},
+	}
+	for _, tc := range testCases {
+		e := edge.NewBufferedEdge(pipeline.StreamEdge, 2, tc.policy)
+		for _, m := range tc.in {
+			if err := e.Collect(m); err != nil {
+				t.Fatal(err)
+			}
+		}
+		e.Close()
+		var got []interface{}
+		for m, ok := e.Emit(); ok; m, ok = e.Emit() {
+			if p, ok := m.(edge.PointMessage); ok {
+				got = append(got, p.Fields()["value"])
+			} else {
+				got = append(got, m.Type())
+			}
+		}
+		if len(got) != len(tc.exp) {
+			t.Fatalf("%v: unexpected messages: got %v exp %v", tc.policy, got, tc.exp)
+		}
+		for i := range got {
+			if got[i] != tc.exp[i] {
+				t.Errorf("%v: unexpected messages: got %v exp %v", tc.policy, got, tc.exp)
+				break
+			}
+		}
+		if got, exp := e.(edge.DroppingEdge).DroppedVar().IntValue(), int64(len(tc.in)-len(tc.exp)); got != exp {
+			t.Errorf("%v: unexpected dropped count: got %d exp %d", tc.policy, got, exp)
+		}
+	}
+}
+
+func TestBufferedEdge_BlocksOnControlMessages(t *testing.T) {
+	e := edge.NewBufferedEdge(pipeline.StreamEdge, 1, edge.DropNewestPolicy)
+	if err := e.Collect(newValuePoint(1)); err != nil {
+		t.Fatal(err)
+	}
+	collected := make(chan error, 1)
+	go func() {
+		collected <- e.Collect(edge.NewBarrierMessage(now))
+	}()
+	select {
+	case err := <-collected:
+		t.Fatalf("expected the barrier to wait for room, got %v", err)
+	case <-time.After(10 * time.Millisecond):
+	}
+	if m, ok := e.Emit(); !ok || m.Type() != edge.Point {
+		t.Fatalf("expected point, got %v", m)
+	}
+	if err := <-collected; err != nil {
+		t.Fatal(err)
+	}
+	if m, ok := e.Emit(); !ok || m.Type() != edge.Barrier {
+		t.Fatalf("expected barrier, got %v", m)
+	}
+}
+
+func TestBufferedEdge_Abort(t *testing.T) {
+	e := edge.NewBufferedEdge(pipeline.StreamEdge, 1, edge.DropOldestPolicy)
+	emitted := make(chan bool, 1)
+	go func() {
+		_, ok := e.Emit()
+		emitted <- ok
+	}()
+	e.Abort()
+	if <-emitted {
+		t.Error("expected no message from aborted edge")
+	}
+	if err := e.Collect(newValuePoint(1)); err != edge.ErrAborted {
+		t.Errorf("unexpected error: got %v exp %v", err, edge.ErrAborted)
+	}
+}
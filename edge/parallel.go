@@ -0,0 +1,258 @@
+package edge
+
+import (
+	"fmt"
+	"hash/fnv"
+	"sync"
+
+	"github.com/influxdata/kapacitor/models"
+	"github.com/influxdata/kapacitor/timer"
+)
+
+// ParallelGroupedConsumer is a grouped consumer that hash partitions the groups across several workers.
+// The messages of a group are received in order by the worker of the group.
+type ParallelGroupedConsumer interface {
+	GroupedConsumer
+	// Outs returns the edges the receiver of a group forwards its messages to.
+	// The edges merge the messages of the workers into the output edges of the consumer,
+	// so that the batches of different workers are not interleaved.
+	Outs(group models.GroupID) []StatsEdge
+}
+
+// parallelQueueSize is the number of messages queued for each worker.
+const parallelQueueSize = 100
+
+type parallelGroupedConsumer struct {
+	*groupedConsumer
+	workers []*parallelWorker
+	outs    [][]StatsEdge
+
+	// pending counts the messages queued for the workers that have not been received.
+	pending sync.WaitGroup
+
+	errMu sync.Mutex
+	err   error
+}
+
+// NewParallelGroupedConsumer creates a new grouped consumer for edge e and grouped receiver r,
+// whose groups are received by n workers concurrently.
+// The receivers of the groups must forward to the edges returned by Outs instead of outs.
+// Each worker times the messages it receives with a timer from newTimer.
+func NewParallelGroupedConsumer(e Edge, r GroupedReceiver, outs []StatsEdge, limits GroupLimits, n int, newTimer func() timer.Timer) ParallelGroupedConsumer {
+	c := &parallelGroupedConsumer{
+		workers: make([]*parallelWorker, n),
+		outs:    make([][]StatsEdge, n),
+	}
+	// The groups and their limits are managed by the consumer,
+	// only the receivers of the groups run on the workers.
+	c.groupedConsumer = newGroupedConsumer(partitionedGroupedReceiver{c: c, r: r}, limits)
+	c.groupedConsumer.consumer = NewConsumerWithReceiver(e, c)
+	mus := make([]sync.Mutex, len(outs))
+	for i := range c.workers {
+		c.workers[i] = &parallelWorker{
+			c:     c,
+			tasks: make(chan parallelTask, parallelQueueSize),
+			timer: newTimer(),
+		}
+		c.outs[i] = make([]StatsEdge, len(outs))
+		for j, out := range outs {
+			c.outs[i][j] = &mergingEdge{StatsEdge: out, mu: &mus[j]}
+		}
+	}
+	return c
+}
+
+// partition returns the index of the worker of the group.
+func (c *parallelGroupedConsumer) partition(group models.GroupID) int {
+	h := fnv.New32a()
+	h.Write([]byte(group))
+	return int(h.Sum32() % uint32(len(c.workers)))
+}
+
+func (c *parallelGroupedConsumer) Outs(group models.GroupID) []StatsEdge {
+	return c.outs[c.partition(group)]
+}
+
+func (c *parallelGroupedConsumer) Consume() error {
+	var wg sync.WaitGroup
+	wg.Add(len(c.workers))
+	for _, w := range c.workers {
+		go func(w *parallelWorker) {
+			defer wg.Done()
+			w.run()
+		}(w)
+	}
+	err := c.consumer.Consume()
+	for _, w := range c.workers {
+		close(w.tasks)
+	}
+	wg.Wait()
+	if err != nil {
+		return err
+	}
+	return c.error()
+}
+
+// Barrier waits until the workers have received all previous messages before passing on the barrier,
+// so that no message of any group is forwarded after the barrier.
+func (c *parallelGroupedConsumer) Barrier(b BarrierMessage) error {
+	c.pending.Wait()
+	if err := c.groupedConsumer.Barrier(b); err != nil {
+		return err
+	}
+	c.pending.Wait()
+	return c.error()
+}
+
+func (c *parallelGroupedConsumer) setError(err error) {
+	c.errMu.Lock()
+	defer c.errMu.Unlock()
+	if c.err == nil {
+		c.err = err
+	}
+}
+
+func (c *parallelGroupedConsumer) error() error {
+	c.errMu.Lock()
+	defer c.errMu.Unlock()
+	return c.err
+}
+
+// queue passes the message to the worker of the group.
+func (c *parallelGroupedConsumer) queue(w *parallelWorker, r Receiver, m Message) error {
+	if err := c.error(); err != nil {
+		return err
+	}
+	c.pending.Add(1)
+	w.tasks <- parallelTask{r: r, m: m}
+	return nil
+}
+
+// partitionedGroupedReceiver creates the receivers of the groups that pass the messages to the worker of their group.
+type partitionedGroupedReceiver struct {
+	c *parallelGroupedConsumer
+	r GroupedReceiver
+}
+
+func (pr partitionedGroupedReceiver) NewGroup(group GroupInfo, first PointMeta) (Receiver, error) {
+	r, err := pr.r.NewGroup(group, first)
+	if err != nil {
+		return nil, err
+	}
+	return &partitionedReceiver{
+		c: pr.c,
+		w: pr.c.workers[pr.c.partition(group.ID)],
+		r: r,
+	}, nil
+}
+
+type partitionedReceiver struct {
+	c *parallelGroupedConsumer
+	w *parallelWorker
+	r Receiver
+}
+
+func (r *partitionedReceiver) BeginBatch(begin BeginBatchMessage) error {
+	return r.c.queue(r.w, r.r, begin)
+}
+func (r *partitionedReceiver) BatchPoint(bp BatchPointMessage) error {
+	return r.c.queue(r.w, r.r, bp)
+}
+func (r *partitionedReceiver) EndBatch(end EndBatchMessage) error {
+	return r.c.queue(r.w, r.r, end)
+}
+func (r *partitionedReceiver) BufferedBatch(batch BufferedBatchMessage) error {
+	return r.c.queue(r.w, r.r, batch)
+}
+func (r *partitionedReceiver) Point(p PointMessage) error {
+	return r.c.queue(r.w, r.r, p)
+}
+func (r *partitionedReceiver) Barrier(b BarrierMessage) error {
+	return r.c.queue(r.w, r.r, b)
+}
+func (r *partitionedReceiver) DeleteGroup(d DeleteGroupMessage) error {
+	return r.c.queue(r.w, r.r, d)
+}
+
+type parallelTask struct {
+	r Receiver
+	m Message
+}
+
+type parallelWorker struct {
+	c     *parallelGroupedConsumer
+	tasks chan parallelTask
+	timer timer.Timer
+}
+
+func (w *parallelWorker) run() {
+	for t := range w.tasks {
+		// Once a worker failed the remaining messages are discarded.
+		if w.c.error() == nil {
+			w.timer.Start()
+			err := receive(t.r, t.m)
+			w.timer.Stop()
+			if err != nil {
+				w.c.setError(err)
+			}
+		}
+		w.c.pending.Done()
+	}
+}
+
+// receive passes the message to the receiver.
+func receive(r Receiver, msg Message) error {
+	switch m := msg.(type) {
+	case BeginBatchMessage:
+		return r.BeginBatch(m)
+	case BatchPointMessage:
+		return r.BatchPoint(m)
+	case EndBatchMessage:
+		return r.EndBatch(m)
+	case BufferedBatchMessage:
+		return receiveBufferedBatch(r, m)
+	case PointMessage:
+		return r.Point(m)
+	case BarrierMessage:
+		return r.Barrier(m)
+	case DeleteGroupMessage:
+		return r.DeleteGroup(m)
+	default:
+		return fmt.Errorf("unexpected message of type %T", msg)
+	}
+}
+
+// mergingEdge merges the messages of a worker into an output edge.
+// The messages of a batch are buffered until its end and then collected at once.
+// Only the worker collects into the edge, so the buffer is not shared.
+type mergingEdge struct {
+	StatsEdge
+	mu    *sync.Mutex
+	batch []Message
+}
+
+func (e *mergingEdge) Collect(m Message) error {
+	switch m.Type() {
+	case BeginBatch:
+		e.batch = append(e.batch[:0], m)
+		return nil
+	case BatchPoint:
+		e.batch = append(e.batch, m)
+		return nil
+	case EndBatch:
+		batch := append(e.batch, m)
+		e.batch = e.batch[:0]
+		e.mu.Lock()
+		defer e.mu.Unlock()
+		for _, bm := range batch {
+			if err := e.StatsEdge.Collect(bm); err != nil {
+				return err
+			}
+		}
+		return nil
+	default:
+		e.mu.Lock()
+		defer e.mu.Unlock()
+		return e.StatsEdge.Collect(m)
+	}
+}
@@ -0,0 +1,194 @@
+package edge_test
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/influxdata/kapacitor/edge"
+	"github.com/influxdata/kapacitor/models"
+	"github.com/influxdata/kapacitor/pipeline"
+	"github.com/influxdata/kapacitor/timer"
+)
+
+// passReceiver forwards all messages unchanged.
+type passReceiver struct{}
+
+func (passReceiver) BeginBatch(begin edge.BeginBatchMessage) (edge.Message, error) {
+	return begin, nil
+}
+func (passReceiver) BatchPoint(bp edge.BatchPointMessage) (edge.Message, error) {
+	return bp, nil
+}
+func (passReceiver) EndBatch(end edge.EndBatchMessage) (edge.Message, error) {
+	return end, nil
+}
+func (passReceiver) Point(p edge.PointMessage) (edge.Message, error) {
+	// Give the other workers a chance to run.
+	time.Sleep(time.Microsecond)
+	return p, nil
+}
+func (passReceiver) Barrier(b edge.BarrierMessage) (edge.Message, error) {
+	return b, nil
+}
+func (passReceiver) DeleteGroup(d edge.DeleteGroupMessage) (edge.Message, error) {
+	return d, nil
+}
+
+// parallelForwarder creates group receivers that forward to the outs of the parallel consumer.
+type parallelForwarder struct {
+	c edge.ParallelGroupedConsumer
+}
+
+func (f *parallelForwarder) NewGroup(group edge.GroupInfo, first edge.PointMeta) (edge.Receiver, error) {
+	return edge.NewReceiverFromForwardReceiverWithStats(f.c.Outs(group.ID), passReceiver{}), nil
+}
+
+func newParallelConsumer(in edge.Edge, out edge.StatsEdge) edge.ParallelGroupedConsumer {
+	f := new(parallelForwarder)
+	f.c = edge.NewParallelGroupedConsumer(in, f, []edge.StatsEdge{out}, edge.GroupLimits{}, 4, timer.NewNoOp)
+	return f.c
+}
+
+func TestParallelGroupedConsumer_Stream(t *testing.T) {
+	in := edge.NewChannelEdge(pipeline.StreamEdge, defaultEdgeBufferSize)
+	out := edge.NewStatsEdge(edge.NewChannelEdge(pipeline.StreamEdge, defaultEdgeBufferSize))
+	consumer := newParallelConsumer(in, out)
+
+	hosts := []string{"a", "b", "c", "d", "e", "f", "g", "h"}
+	var barrierTime time.Time
+	go func() {
+		for i := 0; i < 40; i++ {
+			for _, host := range hosts {
+				p := hostPoint(host).ShallowCopy()
+				p.SetFields(models.Fields{"value": int64(i)})
+				in.Collect(p)
+			}
+			if i == 19 {
+				in.Collect(edge.NewBarrierMessage(barrierTime))
+			}
+		}
+		in.Close()
+	}()
+	if err := consumer.Consume(); err != nil {
+		t.Fatal(err)
+	}
+	out.Close()
+
+	last := make(map[string]int64)
+	barriers := 0
+	for m, ok := out.Emit(); ok; m, ok = out.Emit() {
+		switch m := m.(type) {
+		case edge.BarrierMessage:
+			barriers++
+		case edge.PointMessage:
+			host := m.Tags()["host"]
+			v := m.Fields()["value"].(int64)
+			if l, ok := last[host]; ok && v != l+1 {
+				t.Fatalf("unexpected order of group %s: got %d after %d", host, v, l)
+			}
+			last[host] = v
+			if v < 20 && barriers > 0 {
+				t.Fatalf("point %d of group %s forwarded after a barrier", v, host)
+			}
+			if v >= 20 && barriers < len(hosts) {
+				t.Fatalf("point %d of group %s forwarded before all barriers", v, host)
+			}
+		}
+	}
+	if barriers != len(hosts) {
+		t.Errorf("unexpected number of barriers: got %d exp %d", barriers, len(hosts))
+	}
+	for _, host := range hosts {
+		if got := last[host]; got != 39 {
+			t.Errorf("unexpected last point of group %s: got %d exp 39", host, got)
+		}
+	}
+}
+
+func TestParallelGroupedConsumer_Batch(t *testing.T) {
+	in := edge.NewChannelEdge(pipeline.BatchEdge, defaultEdgeBufferSize)
+	out := edge.NewStatsEdge(edge.NewChannelEdge(pipeline.BatchEdge, defaultEdgeBufferSize))
+	consumer := newParallelConsumer(in, out)
+
+	hosts := []string{"a", "b", "c", "d", "e", "f", "g", "h"}
+	dims := models.Dimensions{TagNames: []string{"host"}}
+	go func() {
+		for i := 0; i < 10; i++ {
+			for _, host := range hosts {
+				tags := models.Tags{"host": host}
+				in.Collect(edge.NewBeginBatchMessage(name, tags, dims.ByName, now, 3))
+				for j := 0; j < 3; j++ {
+					in.Collect(edge.NewBatchPointMessage(models.Fields{"value": int64(j)}, tags, now))
+				}
+				in.Collect(edge.NewEndBatchMessage())
+			}
+		}
+		in.Close()
+	}()
+	if err := consumer.Consume(); err != nil {
+		t.Fatal(err)
+	}
+	out.Close()
+
+	batches := make(map[string]int)
+	var current string
+	var points int
+	for m, ok := out.Emit(); ok; m, ok = out.Emit() {
+		switch m := m.(type) {
+		case edge.BeginBatchMessage:
+			if current != "" {
+				t.Fatalf("batch of group %s started within batch of group %s", m.Tags()["host"], current)
+			}
+			current = m.Tags()["host"]
+			points = 0
+		case edge.BatchPointMessage:
+			if host := m.Tags()["host"]; host != current {
+				t.Fatalf("point of group %s within batch of group %s", host, current)
+			}
+			points++
+		case edge.EndBatchMessage:
+			if points != 3 {
+				t.Errorf("unexpected number of points in batch of group %s: %d", current, points)
+			}
+			batches[current]++
+			current = ""
+		}
+	}
+	for _, host := range hosts {
+		if got := batches[host]; got != 10 {
+			t.Errorf("unexpected number of batches of group %s: got %d exp 10", host, got)
+		}
+	}
+}
+
+// failingReceiver fails on the points of group b.
+type failingReceiver struct {
+	noopReceiver
+	host string
+}
+
+func (r failingReceiver) Point(p edge.PointMessage) error {
+	if r.host == "b" {
+		return fmt.Errorf("failed %s", r.host)
+	}
+	return nil
+}
+
+type failingGroups struct{}
+
+func (failingGroups) NewGroup(group edge.GroupInfo, first edge.PointMeta) (edge.Receiver, error) {
+	return failingReceiver{host: group.Tags["host"]}, nil
+}
+
+func TestParallelGroupedConsumer_Error(t *testing.T) {
+	in := edge.NewChannelEdge(pipeline.StreamEdge, defaultEdgeBufferSize)
+	consumer := edge.NewParallelGroupedConsumer(in, failingGroups{}, nil, edge.GroupLimits{}, 2, timer.NewNoOp)
+	for _, host := range []string{"a", "b", "a", "c"} {
+		in.Collect(hostPoint(host))
+	}
+	in.Close()
+	if err := consumer.Consume(); err == nil || err.Error() != "failed b" {
+		t.Errorf("unexpected error: got %v exp failed b", err)
+	}
+}
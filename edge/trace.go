@@ -0,0 +1,158 @@
+package edge
+
+import (
+	"sync"
+	"time"
+
+	"github.com/influxdata/kapacitor/expvar"
+	"github.com/influxdata/kapacitor/pipeline"
+)
+
+// Trace follows a sampled message through the nodes of a task.
+type Trace struct {
+	// Ingest is the time the message was received by Kapacitor.
+	Ingest time.Time
+}
+
+// Traced is a message that can be traced.
+type Traced interface {
+	Trace() *Trace
+	SetTrace(*Trace)
+}
+
+// TraceOf returns the trace of the message or nil if the message is not traced.
+func TraceOf(m Message) *Trace {
+	if t, ok := m.(Traced); ok {
+		return t.Trace()
+	}
+	return nil
+}
+
+// withTrace sets the trace of in on the message out that a node forwards because of in,
+// so that the trace follows the messages a node creates.
+func withTrace(in, out Message) Message {
+	if out == nil || out == in {
+		return out
+	}
+	if t := TraceOf(in); t != nil {
+		if o, ok := out.(Traced); ok && o.Trace() == nil {
+			o.SetTrace(t)
+		}
+	}
+	return out
+}
+
+// Tracer records the times of the traced messages received by a node.
+type Tracer struct {
+	// Latency is the time in nanoseconds from the ingest of a message until the node received it.
+	Latency *expvar.Histogram
+	// QueueWait is the time in nanoseconds a message waited in an edge of the node.
+	QueueWait *expvar.Histogram
+	// Processing is the time in nanoseconds the node spent on a message,
+	// until it was ready to receive the next message.
+	Processing *expvar.Histogram
+}
+
+// NewTracer returns a tracer with buckets from 1µs to about 17s.
+func NewTracer() *Tracer {
+	bounds := expvar.ExponentialBounds(float64(time.Microsecond), 2, 25)
+	return &Tracer{
+		Latency:    expvar.NewHistogram(bounds),
+		QueueWait:  expvar.NewHistogram(bounds),
+		Processing: expvar.NewHistogram(bounds),
+	}
+}
+
+type tracingEdge struct {
+	edge Edge
+	t    *Tracer
+
+	mu sync.Mutex
+	// The collect times of the traced messages in the edge.
+	collected map[Message]time.Time
+
+	// Only accessed by the receiving node.
+	received time.Time
+	batching bool
+}
+
+// NewTracingEdge creates an edge that records the times of the traced messages
+// that pass through it to the tracer of the receiving node.
+func NewTracingEdge(e Edge, t *Tracer) Edge {
+	te := &tracingEdge{
+		edge:      e,
+		t:         t,
+		collected: make(map[Message]time.Time),
+	}
+	if qe, ok := e.(*queueEdge); ok {
+		// Forget the dropped messages, they are never emitted.
+		qe.onDrop = te.forget
+	}
+	return te
+}
+
+func (e *tracingEdge) forget(m Message) {
+	if TraceOf(m) == nil {
+		return
+	}
+	e.mu.Lock()
+	delete(e.collected, m)
+	e.mu.Unlock()
+}
+
+func (e *tracingEdge) Collect(m Message) error {
+	if TraceOf(m) == nil {
+		return e.edge.Collect(m)
+	}
+	e.mu.Lock()
+	e.collected[m] = time.Now()
+	e.mu.Unlock()
+	err := e.edge.Collect(m)
+	if err != nil {
+		e.forget(m)
+	}
+	return err
+}
+
+func (e *tracingEdge) Emit() (Message, bool) {
+	// The previous message is processed once the node asks for the next one,
+	// the time spent waiting for the next message is not part of it.
+	if !e.received.IsZero() && !e.batching {
+		e.t.Processing.Observe(float64(time.Since(e.received)))
+		e.received = time.Time{}
+	}
+	m, ok := e.edge.Emit()
+	now := time.Now()
+	if !ok {
+		return m, ok
+	}
+	if m.Type() == EndBatch {
+		// A traced batch is processed once the node is ready to receive the message after its end.
+		e.batching = false
+	}
+	if t := TraceOf(m); t != nil {
+		e.mu.Lock()
+		collected, ok := e.collected[m]
+		delete(e.collected, m)
+		e.mu.Unlock()
+		if ok {
+			e.t.QueueWait.Observe(float64(now.Sub(collected)))
+		}
+		e.t.Latency.Observe(float64(now.Sub(t.Ingest)))
+		e.received = now
+		e.batching = m.Type() == BeginBatch
+	}
+	return m, ok
+}
+
+func (e *tracingEdge) Close() error {
+	return e.edge.Close()
+}
+
+func (e *tracingEdge) Abort() {
+	e.edge.Abort()
+}
+
+func (e *tracingEdge) Type() pipeline.EdgeType {
+	return e.edge.Type()
+}
@@ -0,0 +1,162 @@
+package edge_test
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/influxdata/kapacitor/edge"
+	"github.com/influxdata/kapacitor/expvar"
+	"github.com/influxdata/kapacitor/models"
+	"github.com/influxdata/kapacitor/pipeline"
+)
+
+func TestTracingEdge(t *testing.T) {
+	tracer := edge.NewTracer()
+	e := edge.NewTracingEdge(edge.NewChannelEdge(pipeline.StreamEdge, defaultEdgeBufferSize), tracer)
+
+	traced := point.ShallowCopy()
+	ingest := time.Now().Add(-time.Second)
+	traced.(edge.Traced).SetTrace(&edge.Trace{Ingest: ingest})
+
+	if err := e.Collect(point); err != nil {
+		t.Fatal(err)
+	}
+	if err := e.Collect(traced); err != nil {
+		t.Fatal(err)
+	}
+	e.Close()
+
+	// Untraced messages are not recorded.
+	if _, ok := e.Emit(); !ok {
+		t.Fatal("expected message")
+	}
+	if got := tracer.Latency.Snapshot().Count; got != 0 {
+		t.Fatalf("unexpected latency count after untraced message: %d", got)
+	}
+
+	if m, ok := e.Emit(); !ok || edge.TraceOf(m) == nil {
+		t.Fatal("expected traced message")
+	}
+	latency := tracer.Latency.Snapshot()
+	if latency.Count != 1 || latency.Sum < float64(time.Second) {
+		t.Errorf("unexpected latency: count %d sum %v", latency.Count, time.Duration(latency.Sum))
+	}
+	if got := tracer.QueueWait.Snapshot().Count; got != 1 {
+		t.Errorf("unexpected queue wait count: %d", got)
+	}
+	// The processing of the traced message ends when the node asks for the next message.
+	if got := tracer.Processing.Snapshot().Count; got != 0 {
+		t.Errorf("unexpected processing count before next message: %d", got)
+	}
+	if _, ok := e.Emit(); ok {
+		t.Fatal("expected closed edge")
+	}
+	if got := tracer.Processing.Snapshot().Count; got != 1 {
+		t.Errorf("unexpected processing count: %d", got)
+	}
+}
+
+func TestTracingEdge_IdleWait(t *testing.T) {
+	tracer := edge.NewTracer()
+	e := edge.NewTracingEdge(edge.NewChannelEdge(pipeline.StreamEdge, defaultEdgeBufferSize), tracer)
+
+	traced := point.ShallowCopy()
+	traced.(edge.Traced).SetTrace(&edge.Trace{Ingest: time.Now()})
+	if err := e.Collect(traced); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := e.Emit(); !ok {
+		t.Fatal("expected message")
+	}
+
+	// The time the node waits for the next message is not counted as processing.
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		e.Emit()
+	}()
+	idle := 50 * time.Millisecond
+	time.Sleep(idle)
+	e.Close()
+	<-done
+	processing := tracer.Processing.Snapshot()
+	if processing.Count != 1 || processing.Sum >= float64(idle) {
+		t.Errorf("unexpected processing: count %d sum %v", processing.Count, time.Duration(processing.Sum))
+	}
+}
+
+type newPointReceiver struct{}
+
+func (newPointReceiver) BeginBatch(begin edge.BeginBatchMessage) (edge.Message, error) {
+	return begin, nil
+}
+func (newPointReceiver) BatchPoint(bp edge.BatchPointMessage) (edge.Message, error) {
+	return bp, nil
+}
+func (newPointReceiver) EndBatch(end edge.EndBatchMessage) (edge.Message, error) {
+	return end, nil
+}
+func (newPointReceiver) Point(p edge.PointMessage) (edge.Message, error) {
+	return edge.NewPointMessage(p.Name(), "", "", p.Dimensions(), models.Fields{"count": 1}, p.Tags(), p.Time()), nil
+}
+func (newPointReceiver) Barrier(b edge.BarrierMessage) (edge.Message, error) {
+	return b, nil
+}
+func (newPointReceiver) DeleteGroup(d edge.DeleteGroupMessage) (edge.Message, error) {
+	return d, nil
+}
+
+func TestForwardingReceiver_Trace(t *testing.T) {
+	out := edge.NewChannelEdge(pipeline.StreamEdge, defaultEdgeBufferSize)
+	r := edge.NewReceiverFromForwardReceiver([]edge.Edge{out}, newPointReceiver{})
+
+	trace := &edge.Trace{Ingest: now}
+	traced := point.ShallowCopy()
+	traced.(edge.Traced).SetTrace(trace)
+	if err := r.Point(traced); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.Point(point); err != nil {
+		t.Fatal(err)
+	}
+	out.Close()
+
+	m, _ := out.Emit()
+	if got := edge.TraceOf(m); got != trace {
+		t.Errorf("expected the trace of the input on the new point, got %v", got)
+	}
+	m, _ = out.Emit()
+	if got := edge.TraceOf(m); got != nil {
+		t.Errorf("expected no trace on the new point of an untraced input, got %v", got)
+	}
+}
+
+func TestHistogram_Quantile(t *testing.T) {
+	h := expvar.NewHistogram([]float64{1, 2, 4, 8})
+	for _, v := range []float64{0.5, 1.5, 1.5, 3, 3, 3, 3, 6, 6, 20} {
+		h.Observe(v)
+	}
+	s := h.Snapshot()
+	if exp := []int64{1, 2, 4, 2, 1}; !reflect.DeepEqual(s.Counts, exp) {
+		t.Fatalf("unexpected counts: got %v exp %v", s.Counts, exp)
+	}
+	testCases := []struct {
+		q   float64
+		exp float64
+	}{
+		{q: 0.1, exp: 1},
+		{q: 0.5, exp: 3},
+		{q: 0.8, exp: 6},
+		// The last bucket has no upper bound.
+		{q: 0.99, exp: 8},
+	}
+	for _, tc := range testCases {
+		if got := s.Quantile(tc.q); got != tc.exp {
+			t.Errorf("unexpected %v quantile: got %v exp %v", tc.q, got, tc.exp)
+		}
+	}
+	if got, exp := s.Mean(), 4.75; got != exp {
+		t.Errorf("unexpected mean: got %v exp %v", got, exp)
+	}
+}
@@ -63,11 +63,7 @@ func newEvalNode(et *ExecutingTask, n *pipeline.EvalNode, d NodeDiagnostic) (*Ev
 }
 
 func (n *EvalNode) runEval(snapshot []byte) error {
-	consumer := edge.NewGroupedConsumer(
-		n.ins[0],
-		n,
-	)
-	n.statMap.Set(statCardinalityGauge, consumer.CardinalityVar())
+	consumer := n.newGroupedConsumer(n)
 
 	return consumer.Consume()
 
@@ -75,7 +71,7 @@ func (n *EvalNode) runEval(snapshot []byte) error {
 
 func (n *EvalNode) NewGroup(group edge.GroupInfo, first edge.PointMeta) (edge.Receiver, error) {
 	return edge.NewReceiverFromForwardReceiverWithStats(
-		n.outs,
+		n.groupOuts(group),
 		edge.NewTimedForwardReceiver(n.timer, n.newGroup()),
 	), nil
 }
@@ -148,6 +148,125 @@ func (v *Float) Set(value float64) {
 	atomic.StoreUint64(&v.f, math.Float64bits(value))
 }
 
+// Histogram counts observed values in buckets and satisfies the expvar.Var interface.
+type Histogram struct {
+	mu sync.Mutex
+	// The upper bounds of the buckets, the last bucket has no upper bound.
+	bounds []float64
+	counts []int64
+	count  int64
+	sum    float64
+}
+
+// NewHistogram returns a histogram with the upper bounds of its buckets,
+// which must be sorted, and a last bucket without an upper bound.
+func NewHistogram(bounds []float64) *Histogram {
+	return &Histogram{
+		bounds: bounds,
+		counts: make([]int64, len(bounds)+1),
+	}
+}
+
+// ExponentialBounds returns count bounds starting at start, each factor times the previous bound.
+func ExponentialBounds(start, factor float64, count int) []float64 {
+	bounds := make([]float64, count)
+	for i := range bounds {
+		bounds[i] = start
+		start *= factor
+	}
+	return bounds
+}
+
+// Observe adds the value to the bucket with the smallest upper bound that is not below the value.
+func (v *Histogram) Observe(value float64) {
+	i := sort.SearchFloat64s(v.bounds, value)
+	v.mu.Lock()
+	v.counts[i]++
+	v.count++
+	v.sum += value
+	v.mu.Unlock()
+}
+
+// HistogramSnapshot is a copy of the buckets of a histogram.
+type HistogramSnapshot struct {
+	// Bounds are the upper bounds of the buckets, excluding the last bucket.
+	Bounds []float64
+	// Counts are the number of values of each bucket, not cumulative.
+	Counts []int64
+	Count  int64
+	Sum    float64
+}
+
+func (v *Histogram) Snapshot() HistogramSnapshot {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	counts := make([]int64, len(v.counts))
+	copy(counts, v.counts)
+	return HistogramSnapshot{
+		Bounds: v.bounds,
+		Counts: counts,
+		Count:  v.count,
+		Sum:    v.sum,
+	}
+}
+
+// Mean returns the mean of the observed values, or 0 if there are none.
+func (s HistogramSnapshot) Mean() float64 {
+	if s.Count == 0 {
+		return 0
+	}
+	return s.Sum / float64(s.Count)
+}
+
+// Quantile estimates the q-quantile of the observed values by interpolating within its bucket.
+// Values in the last bucket are estimated as the largest bound.
+func (s HistogramSnapshot) Quantile(q float64) float64 {
+	if s.Count == 0 {
+		return 0
+	}
+	if len(s.Bounds) == 0 {
+		return s.Mean()
+	}
+	rank := q * float64(s.Count)
+	var cumulative float64
+	for i, c := range s.Counts {
+		if c == 0 {
+			continue
+		}
+		if cumulative+float64(c) < rank {
+			cumulative += float64(c)
+			continue
+		}
+		if i == len(s.Bounds) {
+			return s.Bounds[len(s.Bounds)-1]
+		}
+		lower := 0.0
+		if i > 0 {
+			lower = s.Bounds[i-1]
+		}
+		return lower + (s.Bounds[i]-lower)*(rank-cumulative)/float64(c)
+	}
+	return s.Bounds[len(s.Bounds)-1]
+}
+
+func (v *Histogram) String() string {
+	s := v.Snapshot()
+	var b bytes.Buffer
+	fmt.Fprintf(&b, `{"count": %d, "sum": %s, "buckets": {`, s.Count, strconv.FormatFloat(s.Sum, 'g', -1, 64))
+	for i, c := range s.Counts {
+		if i > 0 {
+			b.WriteString(", ")
+		}
+		bound := "+Inf"
+		if i < len(s.Bounds) {
+			bound = strconv.FormatFloat(s.Bounds[i], 'g', -1, 64)
+		}
+		fmt.Fprintf(&b, "%q: %d", bound, c)
+	}
+	b.WriteString("}}")
+	return b.String()
+}
+
 // Map is a string-to-expvar.Var map variable that satisfies the expvar.Var interface.
 type Map struct {
 	mu sync.RWMutex
@@ -0,0 +1,208 @@
+package kapacitor
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/influxdata/influxdb/influxql"
+	"github.com/influxdata/kapacitor/edge"
+	"github.com/influxdata/kapacitor/models"
+	"github.com/influxdata/kapacitor/pipeline"
+)
+
+type ForecastNode struct {
+	node
+	f *pipeline.ForecastNode
+
+	thresholdField string
+}
+
+// Create a new ForecastNode which forecasts the values of a field.
+func newForecastNode(et *ExecutingTask, n *pipeline.ForecastNode, d NodeDiagnostic) (*ForecastNode, error) {
+	fn := &ForecastNode{
+		node:           node{Node: n, et: et, diag: d},
+		f:              n,
+		thresholdField: n.As + "_time_to_threshold",
+	}
+	fn.node.runF = fn.runForecast
+	return fn, nil
+}
+
+func (n *ForecastNode) runForecast([]byte) error {
+	consumer := n.newGroupedConsumer(n)
+	return consumer.Consume()
+}
+
+func (n *ForecastNode) NewGroup(group edge.GroupInfo, first edge.PointMeta) (edge.Receiver, error) {
+	return edge.NewReceiverFromForwardReceiverWithStats(
+		n.outs,
+		edge.NewTimedForwardReceiver(n.timer, &forecastGroup{n: n}),
+	), nil
+}
+
+type forecastGroup struct {
+	n      *ForecastNode
+	begin  edge.BeginBatchMessage
+	points []influxql.FloatPoint
+}
+
+func (g *forecastGroup) BeginBatch(begin edge.BeginBatchMessage) (edge.Message, error) {
+	g.begin = begin.ShallowCopy()
+	g.points = g.points[:0]
+	return nil, nil
+}
+
+func (g *forecastGroup) BatchPoint(bp edge.BatchPointMessage) (edge.Message, error) {
+	if err := g.add(bp); err != nil {
+		g.n.diag.Error("failed to forecast point", err)
+	}
+	return nil, nil
+}
+
+func (g *forecastGroup) EndBatch(end edge.EndBatchMessage) (edge.Message, error) {
+	fields, ok := g.n.forecast(g.points)
+	if !ok {
+		return nil, nil
+	}
+	return edge.NewPointMessage(
+		g.begin.Name(), "", "",
+		g.begin.Dimensions(),
+		fields,
+		g.begin.Tags(),
+		g.begin.Time(),
+	), nil
+}
+
+func (g *forecastGroup) Point(p edge.PointMessage) (edge.Message, error) {
+	if err := g.add(p); err != nil {
+		g.n.diag.Error("failed to forecast point", err)
+		return nil, nil
+	}
+	// Drop the values that are older than the period.
+	oldest := p.Time().Add(-g.n.f.Period).UnixNano()
+	i := 0
+	for i < len(g.points) && g.points[i].Time <= oldest {
+		i++
+	}
+	g.points = append(g.points[:0], g.points[i:]...)
+
+	forecast, ok := g.n.forecast(g.points)
+	if !ok {
+		return nil, nil
+	}
+	p = p.ShallowCopy()
+	fields := p.Fields().Copy()
+	for k, v := range forecast {
+		fields[k] = v
+	}
+	p.SetFields(fields)
+	return p, nil
+}
+
+// add appends the value of the field of the point.
+func (g *forecastGroup) add(p edge.FieldsTagsTimeGetter) error {
+	value, ok := numToFloat(p.Fields()[g.n.f.Field])
+	if !ok {
+		return fmt.Errorf("field %q is missing or not a number, got %T", g.n.f.Field, p.Fields()[g.n.f.Field])
+	}
+	g.points = append(g.points, influxql.FloatPoint{
+		Time:  p.Time().UnixNano(),
+		Value: value,
+	})
+	return nil
+}
+
+func (g *forecastGroup) Barrier(b edge.BarrierMessage) (edge.Message, error) {
+	return b, nil
+}
+
+func (g *forecastGroup) DeleteGroup(d edge.DeleteGroupMessage) (edge.Message, error) {
+	return d, nil
+}
+
+// forecast fits the model to the points and returns the forecast fields.
+func (n *ForecastNode) forecast(points []influxql.FloatPoint) (models.Fields, bool) {
+	if len(points) < 2 {
+		return nil, false
+	}
+	var predicted, ttt float64
+	var crosses, ok bool
+	switch n.f.Method {
+	case pipeline.ForecastHoltWinters:
+		predicted, ttt, crosses, ok = n.holtWinters(points)
+	default:
+		predicted, ttt, crosses, ok = n.linear(points)
+	}
+	if !ok {
+		return nil, false
+	}
+	fields := models.Fields{n.f.As: predicted}
+	if n.f.HasThreshold && crosses {
+		fields[n.thresholdField] = ttt
+	}
+	return fields, true
+}
+
+// linear fits a least squares line to the points.
+// It returns the predicted value at the horizon and the seconds until the line crosses the threshold.
+func (n *ForecastNode) linear(points []influxql.FloatPoint) (predicted, ttt float64, crosses, ok bool) {
+	// Times are in seconds since the first point to keep the sums small.
+	start := points[0].Time
+	var sumX, sumY, sumXX, sumXY float64
+	for _, p := range points {
+		x := float64(p.Time-start) / float64(time.Second)
+		sumX += x
+		sumY += p.Value
+		sumXX += x * x
+		sumXY += x * p.Value
+	}
+	count := float64(len(points))
+	denom := count*sumXX - sumX*sumX
+	if denom == 0 {
+		// All points have the same time.
+		return 0, 0, false, false
+	}
+	slope := (count*sumXY - sumX*sumY) / denom
+	intercept := (sumY - slope*sumX) / count
+
+	last := float64(points[len(points)-1].Time-start) / float64(time.Second)
+	current := intercept + slope*last
+	predicted = current + slope*n.f.Horizon.Seconds()
+
+	threshold := n.f.ThresholdValue
+	switch {
+	case current == threshold:
+		return predicted, 0, true, true
+	case current < threshold && slope > 0, current > threshold && slope < 0:
+		return predicted, (threshold - current) / slope, true, true
+	}
+	return predicted, 0, false, true
+}
+
+// holtWinters fits the Holt-Winters model of the holtWinters InfluxQL function to the points.
+// It returns the predicted value at the horizon and the seconds until the forecast crosses the threshold.
+func (n *ForecastNode) holtWinters(points []influxql.FloatPoint) (predicted, ttt float64, crosses, ok bool) {
+	h := int((n.f.Horizon + n.f.Interval - 1) / n.f.Interval)
+	r := influxql.NewFloatHoltWintersReducer(h, int(n.f.Season), false, n.f.Interval)
+	for i := range points {
+		r.AggregateFloat(&points[i])
+	}
+	forecast := r.Emit()
+	if len(forecast) == 0 {
+		return 0, 0, false, false
+	}
+	predicted = forecast[len(forecast)-1].Value
+
+	last := points[len(points)-1]
+	threshold := n.f.ThresholdValue
+	if last.Value == threshold {
+		return predicted, 0, true, true
+	}
+	below := last.Value < threshold
+	for _, p := range forecast {
+		if p.Value == threshold || (p.Value > threshold) == below {
+			return predicted, float64(p.Time-last.Time) / float64(time.Second), true, true
+		}
+	}
+	return predicted, 0, false, true
+}
@@ -0,0 +1,110 @@
+package kapacitor
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/influxdata/influxdb/influxql"
+	"github.com/influxdata/kapacitor/pipeline"
+)
+
+func forecastPoints(values ...float64) []influxql.FloatPoint {
+	points := make([]influxql.FloatPoint, len(values))
+	for i, v := range values {
+		points[i] = influxql.FloatPoint{
+			Time:  int64(i) * int64(time.Minute),
+			Value: v,
+		}
+	}
+	return points
+}
+
+func TestForecastNode_Linear(t *testing.T) {
+	testCases := []struct {
+		name      string
+		values    []float64
+		threshold float64
+		predicted float64
+		ttt       float64
+		crosses   bool
+	}{
+		{
+			name:      "rising",
+			values:    []float64{10, 20, 30, 40},
+			threshold: 100,
+			predicted: 100,
+			ttt:       360,
+			crosses:   true,
+		},
+		{
+			name:      "falling",
+			values:    []float64{40, 30, 20, 10},
+			threshold: 0,
+			predicted: -50,
+			ttt:       60,
+			crosses:   true,
+		},
+		{
+			name:      "away from threshold",
+			values:    []float64{40, 30, 20, 10},
+			threshold: 100,
+			predicted: -50,
+		},
+		{
+			name:      "flat",
+			values:    []float64{10, 10, 10},
+			threshold: 100,
+			predicted: 10,
+		},
+	}
+	for _, tc := range testCases {
+		n := &ForecastNode{f: &pipeline.ForecastNode{
+			Horizon:        6 * time.Minute,
+			ThresholdValue: tc.threshold,
+			HasThreshold:   true,
+		}}
+		predicted, ttt, crosses, ok := n.linear(forecastPoints(tc.values...))
+		if !ok {
+			t.Fatalf("%s: expected a forecast", tc.name)
+		}
+		if math.Abs(predicted-tc.predicted) > 1e-9 {
+			t.Errorf("%s: unexpected predicted value, got %v exp %v", tc.name, predicted, tc.predicted)
+		}
+		if crosses != tc.crosses {
+			t.Errorf("%s: unexpected crosses, got %v exp %v", tc.name, crosses, tc.crosses)
+		} else if crosses && math.Abs(ttt-tc.ttt) > 1e-9 {
+			t.Errorf("%s: unexpected time to threshold, got %v exp %v", tc.name, ttt, tc.ttt)
+		}
+	}
+}
+
+func TestForecastNode_HoltWinters(t *testing.T) {
+	n := &ForecastNode{f: &pipeline.ForecastNode{
+		Method:         pipeline.ForecastHoltWinters,
+		Horizon:        10 * time.Minute,
+		Interval:       time.Minute,
+		ThresholdValue: 100,
+		HasThreshold:   true,
+	}}
+	predicted, ttt, crosses, ok := n.holtWinters(forecastPoints(10, 20, 30, 40, 50, 60))
+	if !ok {
+		t.Fatal("expected a forecast")
+	}
+	// The trend reaches 160 ten minutes after the last value.
+	if math.Abs(predicted-160) > 5 {
+		t.Errorf("unexpected predicted value, got %v exp ~160", predicted)
+	}
+	if !crosses {
+		t.Fatal("expected the forecast to cross the threshold")
+	}
+	// The trend reaches 100 four minutes after the last value.
+	if ttt != 240 {
+		t.Errorf("unexpected time to threshold, got %v exp 240", ttt)
+	}
+
+	// Values that do not fill an interval cannot be forecast.
+	if _, _, _, ok := n.holtWinters([]influxql.FloatPoint{{Time: 0, Value: 1}, {Time: 1, Value: 2}}); ok {
+		t.Error("expected no forecast")
+	}
+}
@@ -77,11 +77,7 @@ func (n *HTTPOutNode) runOut([]byte) error {
 		return err
 	}
 
-	consumer := edge.NewGroupedConsumer(
-		n.ins[0],
-		n,
-	)
-	n.statMap.Set(statCardinalityGauge, consumer.CardinalityVar())
+	consumer := n.newGroupedConsumer(n)
 
 	return consumer.Consume()
 }
@@ -52,11 +52,7 @@ type baseReduceContext struct {
 }
 
 func (n *InfluxQLNode) runInfluxQL([]byte) error {
-	consumer := edge.NewGroupedConsumer(
-		n.ins[0],
-		n,
-	)
-	n.statMap.Set(statCardinalityGauge, consumer.CardinalityVar())
+	consumer := n.newGroupedConsumer(n)
 	return consumer.Consume()
 }
 
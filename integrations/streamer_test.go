@@ -14,6 +14,8 @@ import (
 	"path"
 	"path/filepath"
 	"reflect"
+	"strings"
+	"sync"
 	"sync/atomic"
 	"testing"
 	"text/template"
@@ -34,6 +36,7 @@ import (
 	"github.com/influxdata/kapacitor/services/alert/alerttest"
 	"github.com/influxdata/kapacitor/services/alerta"
 	"github.com/influxdata/kapacitor/services/alerta/alertatest"
+	"github.com/influxdata/kapacitor/services/cluster"
 	"github.com/influxdata/kapacitor/services/diagnostic"
 	"github.com/influxdata/kapacitor/services/hipchat"
 	"github.com/influxdata/kapacitor/services/hipchat/hipchattest"
@@ -1999,6 +2002,50 @@ stream
 	testStreamerWithOutput(t, "TestStream_EvalGroups", script, 3*time.Second, er, false, nil)
 }
 
+func TestStream_EvalGroups_Parallel(t *testing.T) {
+	var script = `
+stream
+	|from()
+		.measurement('types')
+		.groupBy('group')
+	|eval(lambda: count())
+		.as('count')
+		.parallel(4)
+	|where(lambda: "count" > 0)
+		.parallel(2)
+	|httpOut('TestStream_EvalGroups')
+`
+	er := models.Result{
+		Series: models.Rows{
+			{
+				Name:    "types",
+				Tags:    map[string]string{"group": "A"},
+				Columns: []string{"time", "count"},
+				Values: [][]interface{}{
+					{
+						time.Date(1971, 1, 1, 0, 0, 1, 0, time.UTC),
+						2.0,
+					},
+				},
+			},
+			{
+				Name:    "types",
+				Tags:    map[string]string{"group": "B"},
+				Columns: []string{"time", "count"},
+				Values: [][]interface{}{
+					{
+						time.Date(1971, 1, 1, 0, 0, 1, 0, time.UTC),
+						2.0,
+					},
+				},
+			},
+		},
+	}
+
+	// The data of the serial test is used, the groups are output in any order.
+	testStreamerWithOutput(t, "TestStream_EvalGroups", script, 3*time.Second, er, true, nil)
+}
+
 func TestStream_Eval_Time(t *testing.T) {
 	var script = `
 stream
@@ -9203,6 +9250,189 @@ stream
 	}
 }
 
+func TestStream_AutoscaleDryRun(t *testing.T) {
+	var script = `
+stream
+	|from()
+		.measurement('scale')
+		.groupBy('deployment')
+	|k8sAutoscale()
+		.resourceNameTag('deployment')
+		.replicas(lambda: int("replicas"))
+		.increasePolicy('pods', 1, 1m)
+		.decreaseStabilization(1m)
+		.dryRun()
+	|httpOut('TestStream_Autoscale')
+`
+	er := models.Result{
+		Series: models.Rows{
+			{
+				Name: "scale",
+				Tags: map[string]string{
+					"deployment": "serviceA",
+					"namespace":  "default",
+					"kind":       "deployments",
+					"resource":   "serviceA",
+				},
+				Columns: []string{"time", "dry_run", "new", "old"},
+				Values: [][]interface{}{[]interface{}{
+					time.Date(1971, 1, 1, 0, 0, 1, 0, time.UTC),
+					true,
+					2.0,
+					1.0,
+				}},
+			},
+			{
+				Name: "scale",
+				Tags: map[string]string{
+					"deployment": "serviceB",
+					"namespace":  "default",
+					"kind":       "deployments",
+					"resource":   "serviceB",
+				},
+				Columns: []string{"time", "dry_run", "new", "old"},
+				Values: [][]interface{}{[]interface{}{
+					time.Date(1971, 1, 1, 0, 0, 1, 0, time.UTC),
+					true,
+					11.0,
+					10.0,
+				}},
+			},
+		},
+	}
+
+	tmInit := func(tm *kapacitor.TaskMaster) {
+		k8sAutoscale := k8stest.Client{}
+		k8sAutoscale.ScalesGetFunc = func(kind, name string) (*k8s.Scale, error) {
+			var replicas int32
+			switch name {
+			case "serviceA":
+				replicas = 1
+			case "serviceB":
+				replicas = 10
+			}
+			return &k8s.Scale{
+				ObjectMeta: k8s.ObjectMeta{
+					Name: name,
+				},
+				Spec: k8s.ScaleSpec{
+					Replicas: replicas,
+				},
+			}, nil
+		}
+		k8sAutoscale.ScalesUpdateFunc = func(kind string, scale *k8s.Scale) error {
+			t.Errorf("unexpected update of %s in dry run", scale.Name)
+			return nil
+		}
+		tm.K8sService = k8sAutoscale
+	}
+
+	testStreamerWithOutput(t, "TestStream_Autoscale", script, 13*time.Second, er, false, tmInit)
+}
+
+func TestStream_HTTPAutoscale(t *testing.T) {
+	var mu sync.Mutex
+	replicas := map[string]int{
+		"serviceA": 1,
+		"serviceB": 10,
+	}
+	updates := make(map[string][]int)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		parts := strings.Split(strings.TrimPrefix(r.URL.Path, "/v1/job/"), "/")
+		name := parts[0]
+		switch {
+		case r.Method == "GET" && len(parts) == 1:
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"TaskGroups": []interface{}{
+					map[string]interface{}{"Count": replicas[name]},
+				},
+			})
+		case r.Method == "POST" && len(parts) == 2 && parts[1] == "scale":
+			var body struct {
+				Count int
+			}
+			if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+				t.Error(err)
+			}
+			replicas[name] = body.Count
+			updates[name] = append(updates[name], body.Count)
+		default:
+			t.Errorf("unexpected request %s %s", r.Method, r.URL.Path)
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer ts.Close()
+
+	var script = `
+stream
+	|from()
+		.measurement('scale')
+		.groupBy('deployment')
+	|httpAutoscale()
+		.endpoint('nomad')
+		.resourceNameTag('deployment')
+		.replicasPath('/v1/job/{{.Name}}')
+		.replicasField('TaskGroups.0.Count')
+		.scalePath('/v1/job/{{.Name}}/scale')
+		.scaleMethod('POST')
+		.scaleBody('{"Count":{{.Replicas}}}')
+		.replicas(lambda: int("replicas"))
+	|httpOut('TestStream_Autoscale')
+`
+	er := models.Result{
+		Series: models.Rows{
+			{
+				Name: "scale",
+				Tags: map[string]string{
+					"deployment": "serviceA",
+					"resource":   "serviceA",
+				},
+				Columns: []string{"time", "new", "old"},
+				Values: [][]interface{}{[]interface{}{
+					time.Date(1971, 1, 1, 0, 0, 4, 0, time.UTC),
+					2.0,
+					1000.0,
+				}},
+			},
+			{
+				Name: "scale",
+				Tags: map[string]string{
+					"deployment": "serviceB",
+					"resource":   "serviceB",
+				},
+				Columns: []string{"time", "new", "old"},
+				Values: [][]interface{}{[]interface{}{
+					time.Date(1971, 1, 1, 0, 0, 4, 0, time.UTC),
+					20.0,
+					1000.0,
+				}},
+			},
+		},
+	}
+
+	tmInit := func(tm *kapacitor.TaskMaster) {
+		c := httppost.Config{}
+		c.URL = ts.URL
+		c.Endpoint = "nomad"
+		sl, _ := httppost.NewService(httppost.Configs{c}, diagService.NewHTTPPostHandler())
+		tm.HTTPPostService = sl
+	}
+
+	testStreamerWithOutput(t, "TestStream_Autoscale", script, 13*time.Second, er, false, tmInit)
+
+	expUpdates := map[string][]int{
+		"serviceA": []int{2, 1, 1000, 2},
+		"serviceB": []int{20, 1, 1000, 20},
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if !reflect.DeepEqual(updates, expUpdates) {
+		t.Errorf("unexpected updates\ngot\n%v\nexp\n%v\n", updates, expUpdates)
+	}
+}
+
 func TestStream_KapacitorLoopback_PreventLoop(t *testing.T) {
 
 	var script = `
@@ -10331,6 +10561,7 @@ stream
 			"increase_events":     int64(1),
 			"decrease_events":     int64(0),
 			"cooldown_drops":      int64(0),
+			"policy_limits":       int64(0),
 		},
 	}
 
@@ -10695,6 +10926,209 @@ data
 	testStreamerWithOutput(t, "TestStream_StateTracking", script, 4*time.Second, er, false, nil)
 }
 
+func TestStream_Anomaly(t *testing.T) {
+	var script = `
+stream
+	|from()
+		.measurement('requests')
+		.groupBy('service')
+	|anomaly('rate')
+		.alpha(0.2)
+	|httpOut('TestStream_Anomaly')
+`
+	er := models.Result{
+		Series: models.Rows{
+			{
+				Name:    "requests",
+				Tags:    map[string]string{"service": "api"},
+				Columns: []string{"time", "anomaly_expected", "anomaly_lower", "anomaly_score", "anomaly_upper", "rate"},
+				Values: [][]interface{}{
+					{
+						time.Date(1971, 1, 1, 0, 0, 12, 0, time.UTC),
+						10.03475613696,
+						7.036568668089423,
+						19.977313697359566,
+						13.032943605830578,
+						30.0,
+					},
+				},
+			},
+		},
+	}
+
+	testStreamerWithOutput(t, "TestStream_Anomaly", script, 13*time.Second, er, false, nil)
+}
+
+func TestStream_Forecast(t *testing.T) {
+	var script = `
+stream
+	|from()
+		.measurement('disk')
+		.groupBy('host')
+	|forecast('used_percent')
+		.horizon(5s)
+		.period(10s)
+		.threshold(100.0)
+	|httpOut('TestStream_Forecast')
+`
+	er := models.Result{
+		Series: models.Rows{
+			{
+				Name:    "disk",
+				Tags:    map[string]string{"host": "serverA"},
+				Columns: []string{"time", "forecast", "forecast_time_to_threshold", "used_percent"},
+				Values: [][]interface{}{
+					{
+						time.Date(1971, 1, 1, 0, 0, 9, 0, time.UTC),
+						75.0,
+						10.0,
+						50.0,
+					},
+				},
+			},
+		},
+	}
+
+	testStreamerWithOutput(t, "TestStream_Forecast", script, 10*time.Second, er, false, nil)
+}
+
+func TestStream_Quantiles(t *testing.T) {
+	var script = `
+stream
+	|from()
+		.measurement('requests')
+		.groupBy('service')
+	|quantiles('latency', 0.5, 0.9)
+		.period(10s)
+	|httpOut('TestStream_Quantiles')
+`
+	er := models.Result{
+		Series: models.Rows{
+			{
+				Name:    "requests",
+				Tags:    map[string]string{"service": "api"},
+				Columns: []string{"time", "latency_count", "latency_p50", "latency_p90"},
+				Values: [][]interface{}{
+					{
+						time.Date(1971, 1, 1, 0, 0, 10, 0, time.UTC),
+						10.0,
+						// Within 1% of 5 and 9
+						5.002829575110683,
+						8.93541864376352,
+					},
+				},
+			},
+		},
+	}
+
+	testStreamerWithOutput(t, "TestStream_Quantiles", script, 11*time.Second, er, false, nil)
+}
+
+func TestStream_QuantilesBuckets(t *testing.T) {
+	var script = `
+stream
+	|from()
+		.measurement('latency_bucket')
+		.groupBy('service')
+	|quantiles('count', 0.5, 0.75)
+		.merge('buckets')
+		.period(10s)
+		.as('latency')
+	|httpOut('TestStream_QuantilesBuckets')
+`
+	er := models.Result{
+		Series: models.Rows{
+			{
+				Name:    "latency_bucket",
+				Tags:    map[string]string{"service": "api"},
+				Columns: []string{"time", "latency_count", "latency_p50", "latency_p75"},
+				Values: [][]interface{}{
+					{
+						time.Date(1971, 1, 1, 0, 0, 10, 0, time.UTC),
+						100.0,
+						0.1,
+						0.35,
+					},
+				},
+			},
+		},
+	}
+
+	testStreamerWithOutput(t, "TestStream_QuantilesBuckets", script, 11*time.Second, er, false, nil)
+}
+
+func TestStream_Rate(t *testing.T) {
+	var script = `
+stream
+	|from()
+		.measurement('net')
+		.groupBy('host')
+	|rate('bytes')
+		.period(10s)
+		.max(100.0)
+		.as('bytes_rate')
+	|httpOut('TestStream_Rate')
+`
+	// Increases of 5, 11 when wrapping past 100, 5, 2 after a reset and 2,
+	// extrapolated by half the sample interval to the start of the range.
+	er := models.Result{
+		Series: models.Rows{
+			{
+				Name:    "net",
+				Tags:    map[string]string{"host": "serverA"},
+				Columns: []string{"time", "bytes", "bytes_rate"},
+				Values: [][]interface{}{
+					{
+						time.Date(1971, 1, 1, 0, 0, 5, 0, time.UTC),
+						4.0,
+						2.7500000000000004,
+					},
+				},
+			},
+		},
+	}
+
+	testStreamerWithOutput(t, "TestStream_Rate", script, 6*time.Second, er, false, nil)
+}
+
+func TestStream_TopK(t *testing.T) {
+	var script = `
+stream
+	|from()
+		.measurement('syslog')
+	|topk(2, 'messages')
+		.by('host')
+		.period(4s)
+		.every(2s)
+	|httpOut('TestStream_TopK')
+`
+	er := models.Result{
+		Series: models.Rows{
+			{
+				Name:    "syslog",
+				Tags:    nil,
+				Columns: []string{"time", "host", "messages", "rank"},
+				Values: [][]interface{}{
+					{
+						time.Date(1971, 1, 1, 0, 0, 4, 0, time.UTC),
+						"b",
+						13.0,
+						1.0,
+					},
+					{
+						time.Date(1971, 1, 1, 0, 0, 4, 0, time.UTC),
+						"a",
+						6.0,
+						2.0,
+					},
+				},
+			},
+		},
+	}
+
+	testStreamerWithOutput(t, "TestStream_TopK", script, 5*time.Second, er, false, nil)
+}
+
 // Helper test function for streamer
 func testStreamer(
 	t *testing.T,
@@ -10977,6 +11411,7 @@ func createTaskMaster() (*kapacitor.TaskMaster, error) {
 	as := alertservice.NewService(diagService.NewAlertServiceHandler())
 	as.StorageService = storagetest.New()
 	as.HTTPDService = httpdService
+	as.ClusterService = cluster.NewService(cluster.NewConfig(), nil)
 	if err := as.Open(); err != nil {
 		return nil, err
 	}
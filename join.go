@@ -32,8 +32,25 @@ type JoinNode struct {
 
 	reported    map[int]bool
 	allReported bool
+
+	limits joinLimits
+}
+
+// joinLimits limits the number of sets per group waiting for their matches.
+type joinLimits struct {
+	maxSets  int
+	policy   edge.LimitPolicy
+	buffered *expvar.Int
+	dropped  *expvar.Int
+	evicted  *expvar.Int
 }
 
+const (
+	statBufferedSets = "buffered_sets"
+	statSetsDropped  = "sets_dropped"
+	statSetsEvicted  = "sets_evicted"
+)
+
 // Create a new JoinNode, which takes pairs from parent streams combines them into a single point.
 func newJoinNode(et *ExecutingTask, n *pipeline.JoinNode, d NodeDiagnostic) (*JoinNode, error) {
 	jn := &JoinNode{
@@ -44,6 +61,13 @@ func newJoinNode(et *ExecutingTask, n *pipeline.JoinNode, d NodeDiagnostic) (*Jo
 		specificGroupsBuffer: make(map[models.GroupID][]srcPoint),
 		lowMarks:             make(map[srcGroup]time.Time),
 		reported:             make(map[int]bool),
+		limits: joinLimits{
+			maxSets:  et.Task.Limits.MaxJoinBuffer,
+			policy:   et.Task.Limits.Policy,
+			buffered: new(expvar.Int),
+			dropped:  new(expvar.Int),
+			evicted:  new(expvar.Int),
+		},
 	}
 	// Set fill
 	switch fill := n.Fill.(type) {
@@ -75,6 +99,11 @@ func (n *JoinNode) runJoin([]byte) error {
 		return int64(l)
 	}
 	n.statMap.Set(statCardinalityGauge, expvar.NewIntFuncGauge(valueF))
+	if n.limits.maxSets > 0 {
+		n.statMap.Set(statBufferedSets, n.limits.buffered)
+		n.statMap.Set(statSetsDropped, n.limits.dropped)
+		n.statMap.Set(statSetsEvicted, n.limits.evicted)
+	}
 
 	return consumer.Consume()
 }
@@ -115,20 +144,18 @@ func (n *JoinNode) doMessage(src int, m messageMeta) error {
 	defer n.timer.Stop()
 	if len(n.j.Dimensions) > 0 {
 		// Match points with their group based on join dimensions.
-		n.matchPoints(srcPoint{Src: src, Msg: m})
-	} else {
-		// Just send point on to group, we are not joining on specific dimensions.
-		group := n.getOrCreateGroup(m.GroupID())
-		group.Collect(src, m)
+		return n.matchPoints(srcPoint{Src: src, Msg: m})
 	}
-	return nil
+	// Just send point on to group, we are not joining on specific dimensions.
+	group := n.getOrCreateGroup(m.GroupID())
+	return group.Collect(src, m)
 }
 
 // The purpose of this method is to match more specific points
 // with the less specific points as they arrive.
 //
 // Where 'more specific' means, that a point has more dimensions than the join.on dimensions.
-func (n *JoinNode) matchPoints(p srcPoint) {
+func (n *JoinNode) matchPoints(p srcPoint) error {
 	// Specific points may be sent to the joinset without a matching point, but not the other way around.
 	// This is because the specific points have the needed specific tag data.
 	// The joinset will later handle the fill inner/outer join operations.
@@ -172,7 +199,9 @@ func (n *JoinNode) matchPoints(p srcPoint) {
 			st := buf[i].Msg.Time().Round(n.j.Tolerance)
 			if st.Before(lowMark) {
 				// Send point by itself since it won't get a match.
-				n.sendSpecificPoint(buf[i])
+				if err := n.sendSpecificPoint(buf[i]); err != nil {
+					return err
+				}
 			} else {
 				break
 			}
@@ -198,7 +227,9 @@ func (n *JoinNode) matchPoints(p srcPoint) {
 			pt := match.Msg.Time().Round(n.j.Tolerance)
 			if pt.Equal(t) {
 				// Option 1, send both points
-				n.sendMatchPoint(p, match)
+				if err := n.sendMatchPoint(p, match); err != nil {
+					return err
+				}
 				matched = true
 			}
 			if !pt.Before(lowMark) {
@@ -216,7 +247,9 @@ func (n *JoinNode) matchPoints(p srcPoint) {
 			if n.allReported && t.Before(lowMark) {
 				// Option 3
 				// Send this specific point by itself since it won't get a match.
-				n.sendSpecificPoint(p)
+				if err := n.sendSpecificPoint(p); err != nil {
+					return err
+				}
 			} else {
 				// Option 2
 				// Cache this point for when its match arrives.
@@ -234,7 +267,9 @@ func (n *JoinNode) matchPoints(p srcPoint) {
 		for i = 0; i < l; i++ {
 			st := buf[i].Msg.Time().Round(n.j.Tolerance)
 			if st.Equal(t) {
-				n.sendMatchPoint(buf[i], p)
+				if err := n.sendMatchPoint(buf[i], p); err != nil {
+					return err
+				}
 			} else {
 				break
 			}
@@ -242,11 +277,12 @@ func (n *JoinNode) matchPoints(p srcPoint) {
 		// Remove all sent points
 		n.specificGroupsBuffer[groupId] = buf[i:]
 	}
+	return nil
 }
 
 // Add the specific tags from the specific point to the matched point
 // and then send both on to the group.
-func (n *JoinNode) sendMatchPoint(specific, matched srcPoint) {
+func (n *JoinNode) sendMatchPoint(specific, matched srcPoint) error {
 	var newMatched messageMeta
 	switch msg := matched.Msg.(type) {
 	case edge.BufferedBatchMessage:
@@ -262,15 +298,17 @@ func (n *JoinNode) sendMatchPoint(specific, matched srcPoint) {
 	}
 	group := n.getOrCreateGroup(specific.Msg.GroupID())
 	// Collect specific point
-	group.Collect(specific.Src, specific.Msg)
+	if err := group.Collect(specific.Src, specific.Msg); err != nil {
+		return err
+	}
 	// Collect new matched point
-	group.Collect(matched.Src, newMatched)
+	return group.Collect(matched.Src, newMatched)
 }
 
 // Send only the specific point to the group
-func (n *JoinNode) sendSpecificPoint(specific srcPoint) {
+func (n *JoinNode) sendSpecificPoint(specific srcPoint) error {
 	group := n.getOrCreateGroup(specific.Msg.GroupID())
-	group.Collect(specific.Src, specific.Msg)
+	return group.Collect(specific.Src, specific.Msg)
 }
 
 // safely get the group for the point or create one if it doesn't exist.
@@ -300,6 +338,8 @@ type joinGroup struct {
 	sets       map[time.Time][]*joinset
 	head       []time.Time
 	oldestTime time.Time
+	// size is the number of sets waiting to be emitted.
+	size int
 }
 
 func (g *joinGroup) Finish() error {
@@ -310,17 +350,9 @@ func (g *joinGroup) Finish() error {
 // emit the oldest set if we have collected enough data.
 func (g *joinGroup) Collect(src int, p timeMessage) error {
 	t := p.Time().Round(g.n.j.Tolerance)
-	if t.Before(g.oldestTime) || g.oldestTime.IsZero() {
-		g.oldestTime = t
-	}
 
 	var set *joinset
 	sets := g.sets[t]
-	if len(sets) == 0 {
-		set = g.newJoinset(t)
-		sets = append(sets, set)
-		g.sets[t] = sets
-	}
 	for i := 0; i < len(sets); i++ {
 		if !sets[i].Has(src) {
 			set = sets[i]
@@ -328,9 +360,16 @@ func (g *joinGroup) Collect(src int, p timeMessage) error {
 		}
 	}
 	if set == nil {
+		if ok, err := g.reserve(); !ok {
+			return err
+		}
 		set = g.newJoinset(t)
-		sets = append(sets, set)
-		g.sets[t] = sets
+		g.sets[t] = append(g.sets[t], set)
+		g.size++
+		g.n.limits.buffered.Add(1)
+	}
+	if t.Before(g.oldestTime) || g.oldestTime.IsZero() {
+		g.oldestTime = t
 	}
 	set.Set(src, p)
 
@@ -351,6 +390,29 @@ func (g *joinGroup) Collect(src int, p timeMessage) error {
 	return nil
 }
 
+// reserve room for a new set, reports false if the point must be dropped because of the join buffer limit.
+func (g *joinGroup) reserve() (bool, error) {
+	l := g.n.limits
+	if l.maxSets == 0 || g.size < l.maxSets {
+		return true, nil
+	}
+	switch l.policy {
+	case edge.DropPolicy:
+		l.dropped.Add(1)
+		return false, nil
+	case edge.EvictPolicy:
+		// Emit the oldest sets without waiting for their matches.
+		size := g.size
+		if err := g.emit(false); err != nil {
+			return false, err
+		}
+		l.evicted.Add(int64(size - g.size))
+		return true, nil
+	default:
+		return false, edge.LimitError{Resource: "join sets", Limit: l.maxSets}
+	}
+}
+
 func (g *joinGroup) newJoinset(t time.Time) *joinset {
 	return newJoinset(
 		g.n,
@@ -384,6 +446,8 @@ func (g *joinGroup) emit(onlyReadySets bool) error {
 	} else {
 		g.sets[g.oldestTime] = sets[i:]
 	}
+	g.size -= i
+	g.n.limits.buffered.Add(-int64(i))
 
 	g.oldestTime = time.Time{}
 	for t := range g.sets {
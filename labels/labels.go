@@ -0,0 +1,193 @@
+// Package labels provides the key/value labels that can be attached to
+// tasks, templates and alert handlers.
+package labels
+
+import (
+	"fmt"
+	"net/url"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+var (
+	validKey   = regexp.MustCompile(`^[-\._/\p{L}0-9]+$`)
+	validValue = regexp.MustCompile(`^[-\._/\p{L}0-9]*$`)
+)
+
+// Validate returns an error if any label key or value contains invalid characters.
+// Keys must not be empty and may only contain letters, numbers, '-', '.', '_' and '/'.
+// Values may be empty and are restricted to the same characters.
+func Validate(l map[string]string) error {
+	for k, v := range l {
+		if !validKey.MatchString(k) {
+			return fmt.Errorf("label key must contain only letters, numbers, '-', '.', '_' and '/'. %q", k)
+		}
+		if !validValue.MatchString(v) {
+			return fmt.Errorf("label value must contain only letters, numbers, '-', '.', '_' and '/'. %q=%q", k, v)
+		}
+	}
+	return nil
+}
+
+// Equal reports whether both sets of labels are the same.
+// A nil set is equal to an empty set.
+func Equal(a, b map[string]string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for k, v := range a {
+		if bv, ok := b[k]; !ok || bv != v {
+			return false
+		}
+	}
+	return true
+}
+
+// Copy returns a copy of the labels, or nil if there are none.
+func Copy(l map[string]string) map[string]string {
+	if len(l) == 0 {
+		return nil
+	}
+	c := make(map[string]string, len(l))
+	for k, v := range l {
+		c[k] = v
+	}
+	return c
+}
+
+// IndexValue returns the value used to index the label key=value.
+// Keys and values are escaped so that the index value never contains a '/'.
+func IndexValue(key, value string) string {
+	return escape(key) + "=" + escape(value)
+}
+
+// escape escapes all reserved characters of s, including '/' and '='.
+func escape(s string) string {
+	return strings.Replace(url.QueryEscape(s), "+", "%20", -1)
+}
+
+// IndexValues returns the index values of all labels.
+func IndexValues(l map[string]string) []string {
+	values := make([]string, 0, len(l))
+	for k, v := range l {
+		values = append(values, IndexValue(k, v))
+	}
+	sort.Strings(values)
+	return values
+}
+
+// Operator of a selector requirement.
+type Operator int
+
+const (
+	// Equals requires the label to be set to the value.
+	Equals Operator = iota
+	// NotEquals requires the label to be absent or set to a different value.
+	NotEquals
+	// Exists requires the label to be set.
+	Exists
+	// NotExists requires the label to be absent.
+	NotExists
+)
+
+// Requirement is a single condition of a selector.
+type Requirement struct {
+	Key      string
+	Operator Operator
+	Value    string
+}
+
+// Matches reports whether the labels meet the requirement.
+func (r Requirement) Matches(l map[string]string) bool {
+	v, ok := l[r.Key]
+	switch r.Operator {
+	case Equals:
+		return ok && v == r.Value
+	case NotEquals:
+		return !ok || v != r.Value
+	case Exists:
+		return ok
+	case NotExists:
+		return !ok
+	}
+	return false
+}
+
+func (r Requirement) String() string {
+	switch r.Operator {
+	case Equals:
+		return r.Key + "=" + r.Value
+	case NotEquals:
+		return r.Key + "!=" + r.Value
+	case NotExists:
+		return "!" + r.Key
+	}
+	return r.Key
+}
+
+// Selector selects the labels that meet all of its requirements.
+// An empty selector selects everything.
+type Selector []Requirement
+
+// ParseSelector parses a comma separated list of requirements.
+// Each requirement is one of key=value, key!=value, key or !key,
+// where the last two require the key to be set or not set respectively.
+func ParseSelector(s string) (Selector, error) {
+	var sel Selector
+	for _, term := range strings.Split(s, ",") {
+		term = strings.TrimSpace(term)
+		if term == "" {
+			continue
+		}
+		var r Requirement
+		switch {
+		case strings.Contains(term, "!="):
+			parts := strings.SplitN(term, "!=", 2)
+			r = Requirement{Key: parts[0], Operator: NotEquals, Value: parts[1]}
+		case strings.Contains(term, "="):
+			parts := strings.SplitN(term, "=", 2)
+			r = Requirement{Key: parts[0], Operator: Equals, Value: parts[1]}
+		case strings.HasPrefix(term, "!"):
+			r = Requirement{Key: term[1:], Operator: NotExists}
+		default:
+			r = Requirement{Key: term, Operator: Exists}
+		}
+		r.Key = strings.TrimSpace(r.Key)
+		r.Value = strings.TrimSpace(r.Value)
+		if err := Validate(map[string]string{r.Key: r.Value}); err != nil {
+			return nil, fmt.Errorf("invalid selector requirement %q: %v", term, err)
+		}
+		sel = append(sel, r)
+	}
+	return sel, nil
+}
+
+// Matches reports whether the labels meet all requirements of the selector.
+func (s Selector) Matches(l map[string]string) bool {
+	for _, r := range s {
+		if !r.Matches(l) {
+			return false
+		}
+	}
+	return true
+}
+
+// Equality returns the key and value of the first equality requirement.
+// Objects matching the selector can be found through the index value of that label.
+func (s Selector) Equality() (string, string, bool) {
+	for _, r := range s {
+		if r.Operator == Equals {
+			return r.Key, r.Value, true
+		}
+	}
+	return "", "", false
+}
+
+func (s Selector) String() string {
+	terms := make([]string, len(s))
+	for i, r := range s {
+		terms[i] = r.String()
+	}
+	return strings.Join(terms, ",")
+}
@@ -0,0 +1,91 @@
+package labels_test
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/influxdata/kapacitor/labels"
+)
+
+func TestParseSelector(t *testing.T) {
+	testCases := []struct {
+		selector string
+		exp      labels.Selector
+		err      bool
+	}{
+		{
+			selector: "",
+			exp:      nil,
+		},
+		{
+			selector: "team=db, env!=dev,critical,!deprecated",
+			exp: labels.Selector{
+				{Key: "team", Operator: labels.Equals, Value: "db"},
+				{Key: "env", Operator: labels.NotEquals, Value: "dev"},
+				{Key: "critical", Operator: labels.Exists},
+				{Key: "deprecated", Operator: labels.NotExists},
+			},
+		},
+		{
+			selector: "example.com/owner=",
+			exp: labels.Selector{
+				{Key: "example.com/owner", Operator: labels.Equals, Value: ""},
+			},
+		},
+		{
+			selector: "=db",
+			err:      true,
+		},
+		{
+			selector: "team=d b",
+			err:      true,
+		},
+	}
+	for _, tc := range testCases {
+		got, err := labels.ParseSelector(tc.selector)
+		if tc.err {
+			if err == nil {
+				t.Errorf("%q: expected error", tc.selector)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%q: unexpected error: %v", tc.selector, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, tc.exp) {
+			t.Errorf("%q: unexpected selector got %v exp %v", tc.selector, got, tc.exp)
+		}
+	}
+}
+
+func TestSelector_Matches(t *testing.T) {
+	l := map[string]string{
+		"team": "db",
+		"env":  "prod",
+	}
+	testCases := []struct {
+		selector string
+		exp      bool
+	}{
+		{selector: "", exp: true},
+		{selector: "team=db", exp: true},
+		{selector: "team=web", exp: false},
+		{selector: "team=db,env!=dev", exp: true},
+		{selector: "team=db,env!=prod", exp: false},
+		{selector: "owner!=me", exp: true},
+		{selector: "env", exp: true},
+		{selector: "owner", exp: false},
+		{selector: "!owner", exp: true},
+		{selector: "!env", exp: false},
+	}
+	for _, tc := range testCases {
+		sel, err := labels.ParseSelector(tc.selector)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := sel.Matches(l); got != tc.exp {
+			t.Errorf("%q: unexpected match got %v exp %v", tc.selector, got, tc.exp)
+		}
+	}
+}
@@ -24,6 +24,16 @@ const (
 	statErrorCount       = "errors"
 	statCardinalityGauge = "working_cardinality"
 	statAverageExecTime  = "avg_exec_time_ns"
+	// Messages of new groups dropped because of the group limit, a group may drop any number of messages.
+	statGroupMessagesDropped = "messages_dropped"
+	statGroupsEvicted        = "groups_evicted"
+
+	statTraceLatency       = "latency_ns"
+	statTraceQueueWait     = "queue_wait_ns"
+	statTraceProcessing    = "processing_ns"
+	statTraceLatencyP99    = "trace_latency_p99_ns"
+	statTraceQueueWaitP99  = "trace_queue_wait_p99_ns"
+	statTraceProcessingP99 = "trace_processing_p99_ns"
 )
 
 type NodeDiagnostic interface {
@@ -92,7 +102,11 @@ type Node interface {
 	abortParentEdges()
 
 	// executing dot
-	edot(buf *bytes.Buffer, labels bool)
+	// slowest maps each node on the slowest path to the next node on the path
+	edot(buf *bytes.Buffer, labels bool, slowest map[string]string)
+
+	// tracer of the messages the node receives, nil if tracing is disabled
+	tracer() *edge.Tracer
 
 	nodeStatsByGroup() map[models.GroupID]nodeStats
 
@@ -105,7 +119,7 @@ type Node interface {
 	stats() map[string]interface{}
 }
 
-//implementation of Node
+// implementation of Node
 type node struct {
 	pipeline.Node
 	et         *ExecutingTask
@@ -125,6 +139,13 @@ type node struct {
 	statMap    *kexpvar.Map
 
 	nodeErrors *kexpvar.Int
+
+	traces    *edge.Tracer
+	tracesKey string
+
+	avgExecVar *MaxDuration
+	// parallel is the consumer of the node if its groups are received by several workers.
+	parallel edge.ParallelGroupedConsumer
 }
 
 func (n *node) addParentEdge(e edge.StatsEdge) {
@@ -145,14 +166,98 @@ func (n *node) init() {
 		"kind": n.Desc(),
 	}
 	n.statsKey, n.statMap = vars.NewStatistic("nodes", tags)
-	avgExecVar := &MaxDuration{}
-	n.statMap.Set(statAverageExecTime, avgExecVar)
+	n.avgExecVar = &MaxDuration{}
+	n.statMap.Set(statAverageExecTime, n.avgExecVar)
 	n.nodeErrors = &kexpvar.Int{}
 	n.statMap.Set(statErrorCount, n.nodeErrors)
 	n.diag = newNodeDiagnostic(n, n.diag)
 	n.statMap.Set(statCardinalityGauge, kexpvar.NewIntFuncGauge(nil))
-	n.timer = n.et.tm.TimingService.NewTimer(avgExecVar)
+	if n.parallelism() > 1 {
+		// Timers are not safe for concurrent use, each worker times the messages it receives instead.
+		n.timer = timer.NewNoOp()
+	} else {
+		n.timer = n.et.tm.TimingService.NewTimer(n.avgExecVar)
+	}
 	n.errCh = make(chan error, 1)
+	if n.et.tm.TraceSampleRate > 0 {
+		n.initTraces(tags)
+	}
+}
+
+// initTraces publishes the histograms of the traced messages the node receives,
+// and their 99th percentiles as stats of the node.
+func (n *node) initTraces(tags map[string]string) {
+	n.traces = edge.NewTracer()
+	var traceMap *kexpvar.Map
+	n.tracesKey, traceMap = vars.NewStatistic("traces", tags)
+	for _, t := range []struct {
+		stat, p99 string
+		h         *kexpvar.Histogram
+	}{
+		{statTraceLatency, statTraceLatencyP99, n.traces.Latency},
+		{statTraceQueueWait, statTraceQueueWaitP99, n.traces.QueueWait},
+		{statTraceProcessing, statTraceProcessingP99, n.traces.Processing},
+	} {
+		h := t.h
+		traceMap.Set(t.stat, h)
+		n.statMap.Set(t.p99, kexpvar.NewIntFuncGauge(func() int64 {
+			return int64(h.Snapshot().Quantile(0.99))
+		}))
+	}
+}
+
+func (n *node) tracer() *edge.Tracer {
+	return n.traces
+}
+
+// newGroupedConsumer creates a grouped consumer of the first parent edge,
+// limited to the maximum number of groups of the task.
+// If the node is parallel the groups are received by its workers,
+// and their receivers must forward to the edges of groupOuts.
+func (n *node) newGroupedConsumer(r edge.GroupedReceiver) edge.GroupedConsumer {
+	limits := n.et.Task.Limits
+	groupLimits := edge.GroupLimits{
+		MaxGroups: limits.MaxGroups,
+		Policy:    limits.Policy,
+	}
+	var consumer edge.GroupedConsumer
+	if workers := n.parallelism(); workers > 1 {
+		n.parallel = edge.NewParallelGroupedConsumer(
+			n.ins[0],
+			r,
+			n.outs,
+			groupLimits,
+			workers,
+			func() timer.Timer {
+				return n.et.tm.TimingService.NewTimer(n.avgExecVar)
+			},
+		)
+		consumer = n.parallel
+	} else {
+		consumer = edge.NewLimitedGroupedConsumer(n.ins[0], r, groupLimits)
+	}
+	n.statMap.Set(statCardinalityGauge, consumer.CardinalityVar())
+	if limits.MaxGroups > 0 {
+		n.statMap.Set(statGroupMessagesDropped, consumer.DroppedVar())
+		n.statMap.Set(statGroupsEvicted, consumer.EvictedVar())
+	}
+	return consumer
+}
+
+// parallelism returns the number of workers that receive the groups of the node.
+func (n *node) parallelism() int {
+	if p, ok := n.Node.(pipeline.Parallelizer); ok {
+		return int(p.Parallelism())
+	}
+	return 0
+}
+
+// groupOuts returns the edges the receiver of the group forwards to.
+func (n *node) groupOuts(group edge.GroupInfo) []edge.StatsEdge {
+	if n.parallel != nil {
+		return n.parallel.Outs(group.ID)
+	}
+	return n.outs
 }
 
 func (n *node) start(snapshot []byte) {
@@ -187,6 +292,9 @@ func (n *node) stop() {
 		n.stopF()
 	}
 	vars.DeleteStatistic(n.statsKey)
+	if n.tracesKey != "" {
+		vars.DeleteStatistic(n.tracesKey)
+	}
 }
 
 // no-op snapshot
@@ -215,7 +323,7 @@ func (n *node) addChild(c Node) (edge.StatsEdge, error) {
 	n.children = append(n.children, c)
 
 	d := n.et.tm.diag.WithEdgeContext(n.et.Task.ID, n.Name(), c.Name())
-	edge := newEdge(n.et.Task.ID, n.Name(), c.Name(), n.Provides(), defaultEdgeBufferSize, d)
+	edge := newEdge(n.et.Task.ID, n.Name(), c.Name(), n.Provides(), n.et.edgeOptions(c), d)
 	if edge == nil {
 		return nil, fmt.Errorf("unknown edge type %s", n.Provides())
 	}
@@ -248,7 +356,7 @@ func (n *node) closeChildEdges() {
 	}
 }
 
-func (n *node) edot(buf *bytes.Buffer, labels bool) {
+func (n *node) edot(buf *bytes.Buffer, labels bool, slowest map[string]string) {
 	if labels {
 		// Print all stats on node.
 		buf.WriteString(
@@ -279,11 +387,16 @@ func (n *node) edot(buf *bytes.Buffer, labels bool) {
 		buf.Write([]byte("\"];\n"))
 
 		for i, c := range n.children {
+			var color string
+			if slowest[n.Name()] == c.Name() {
+				color = ` color="red"`
+			}
 			buf.Write([]byte(
-				fmt.Sprintf("%s -> %s [label=\"processed=%d\"];\n",
+				fmt.Sprintf("%s -> %s [label=\"processed=%d\"%s];\n",
 					n.Name(),
 					c.Name(),
 					n.outs[i].Collected(),
+					color,
 				),
 			))
 		}
@@ -311,11 +424,16 @@ func (n *node) edot(buf *bytes.Buffer, labels bool) {
 		})
 		buf.Write([]byte("];\n"))
 		for i, c := range n.children {
+			var slowestAttr string
+			if slowest[n.Name()] == c.Name() {
+				slowestAttr = ` slowest="true"`
+			}
 			buf.Write([]byte(
-				fmt.Sprintf("%s -> %s [processed=\"%d\"];\n",
+				fmt.Sprintf("%s -> %s [processed=\"%d\"%s];\n",
 					n.Name(),
 					c.Name(),
 					n.outs[i].Collected(),
+					slowestAttr,
 				),
 			))
 		}
@@ -0,0 +1,110 @@
+package pipeline
+
+import (
+	"errors"
+	"fmt"
+)
+
+const (
+	// AnomalyHourOfDay keeps a separate baseline for each hour of the day.
+	AnomalyHourOfDay = "hour-of-day"
+	// AnomalyDayOfWeek keeps a separate baseline for each day of the week.
+	AnomalyDayOfWeek = "day-of-week"
+	// AnomalyHourOfWeek keeps a separate baseline for each hour of each day of the week.
+	AnomalyHourOfWeek = "hour-of-week"
+)
+
+// Score how anomalous the values of a field are compared to a baseline learned per group.
+//
+// The baseline is an exponentially weighted moving mean and variance of the field.
+// With a season the node keeps a separate baseline for each hour of the day,
+// day of the week or hour of the week, in UTC, so that i.e. the nightly drop in traffic is not anomalous.
+//
+// Each point is scored against the baseline before the baseline learns its value.
+// The following fields are added to each point, prefixed with the As property:
+//
+//    * _score    -- number of standard deviations the value is away from the expected value, negative if below.
+//    * _expected -- expected value, the mean of the baseline.
+//    * _lower    -- lower band, the expected value minus Sigmas standard deviations.
+//    * _upper    -- upper band, the expected value plus Sigmas standard deviations.
+//
+// Until a baseline has learned Warmup values the score is 0.
+// The baselines are part of the task snapshot so that they survive restarts.
+//
+// Example:
+//     stream
+//         |from()
+//             .measurement('requests')
+//             .groupBy('service')
+//         |anomaly('rate')
+//             .season('hour-of-week')
+//             .alpha(0.2)
+//             .sigmas(3.0)
+//         |alert()
+//             .warn(lambda: abs("anomaly_score") > 3.0)
+//             .crit(lambda: abs("anomaly_score") > 5.0)
+//             .message('{{ index .Fields "rate" }} is outside {{ index .Fields "anomaly_lower" }} - {{ index .Fields "anomaly_upper" }}')
+//
+type AnomalyNode struct {
+	chainnode
+
+	// The field to score.
+	// tick:ignore
+	Field string
+
+	// Season of the baselines, one of 'hour-of-day', 'day-of-week' or 'hour-of-week'.
+	// If empty a single baseline is kept per group.
+	Season string
+
+	// Alpha is the weight of each new value in the baseline, between 0 and 1.
+	// Larger values adapt faster to changes.
+	// Default: 0.1
+	Alpha float64
+
+	// Sigmas is the width of the bands in standard deviations.
+	// Default: 3.0
+	Sigmas float64
+
+	// Warmup is the number of values a baseline learns before points are scored.
+	// Default: 10
+	Warmup int64
+
+	// As is the prefix of the added fields.
+	// Default: anomaly
+	As string
+}
+
+func newAnomalyNode(wants EdgeType, field string) *AnomalyNode {
+	return &AnomalyNode{
+		chainnode: newBasicChainNode("anomaly", wants, wants),
+		Field:     field,
+		Alpha:     0.1,
+		Sigmas:    3.0,
+		Warmup:    10,
+		As:        "anomaly",
+	}
+}
+
+func (n *AnomalyNode) validate() error {
+	if n.Field == "" {
+		return errors.New("must specify a field")
+	}
+	switch n.Season {
+	case "", AnomalyHourOfDay, AnomalyDayOfWeek, AnomalyHourOfWeek:
+	default:
+		return fmt.Errorf("invalid season %q, must be one of '%s', '%s' or '%s'", n.Season, AnomalyHourOfDay, AnomalyDayOfWeek, AnomalyHourOfWeek)
+	}
+	if n.Alpha <= 0 || n.Alpha > 1 {
+		return fmt.Errorf("alpha must be > 0 and <= 1, got %v", n.Alpha)
+	}
+	if n.Sigmas <= 0 {
+		return fmt.Errorf("sigmas must be > 0, got %v", n.Sigmas)
+	}
+	if n.Warmup < 0 {
+		return fmt.Errorf("warmup must be >= 0, got %d", n.Warmup)
+	}
+	if n.As == "" {
+		return errors.New("as must not be empty")
+	}
+	return nil
+}
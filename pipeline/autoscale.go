@@ -0,0 +1,106 @@
+package pipeline
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/gorhill/cronexpr"
+)
+
+const (
+	// AutoscalePodsPolicy limits the change in replicas to a number of replicas per period.
+	AutoscalePodsPolicy = "pods"
+	// AutoscalePercentPolicy limits the change in replicas to a percentage of the replicas per period.
+	AutoscalePercentPolicy = "percent"
+
+	// AutoscaleSelectMax selects the policy that allows the largest change.
+	AutoscaleSelectMax = "max"
+	// AutoscaleSelectMin selects the policy that allows the smallest change.
+	AutoscaleSelectMin = "min"
+)
+
+// AutoscalePolicy limits how much the replicas of a resource may change within a period.
+type AutoscalePolicy struct {
+	// Type is either "pods" or "percent".
+	Type string
+	// Value is the number of replicas or the percentage of the replicas at the start of the period.
+	Value int64
+	// Period is the sliding window in which the changes are counted.
+	Period time.Duration
+}
+
+func (p AutoscalePolicy) validate() error {
+	if p.Type != AutoscalePodsPolicy && p.Type != AutoscalePercentPolicy {
+		return fmt.Errorf("invalid policy type %q, must be %q or %q", p.Type, AutoscalePodsPolicy, AutoscalePercentPolicy)
+	}
+	if p.Value <= 0 {
+		return fmt.Errorf("policy value must be > 0, got %d", p.Value)
+	}
+	if p.Period <= 0 {
+		return fmt.Errorf("policy period must be > 0, got %v", p.Period)
+	}
+	return nil
+}
+
+// AutoscaleSchedule overrides the min and max replicas for a duration each time a cron expression fires.
+type AutoscaleSchedule struct {
+	// Cron is the cron expression of the start of the schedule.
+	Cron string
+	// Duration is how long the overrides apply after each start.
+	Duration time.Duration
+	Min      int64
+	// If 0 then there is no upper limit.
+	Max int64
+}
+
+func (s AutoscaleSchedule) validate() error {
+	if _, err := cronexpr.Parse(s.Cron); err != nil {
+		return fmt.Errorf("invalid schedule cron %q: %v", s.Cron, err)
+	}
+	if s.Duration <= 0 {
+		return fmt.Errorf("schedule duration must be > 0, got %v", s.Duration)
+	}
+	if s.Min < 1 {
+		return fmt.Errorf("schedule min must be >= 1, got %d", s.Min)
+	}
+	if s.Max != 0 && s.Max < s.Min {
+		return fmt.Errorf("schedule max must be 0 or >= min, got %d", s.Max)
+	}
+	return nil
+}
+
+// validateAutoscaleBehavior validates the scaling behavior properties shared by the autoscale nodes.
+func validateAutoscaleBehavior(
+	increasePolicies,
+	decreasePolicies []AutoscalePolicy,
+	selectPolicy string,
+	increaseStabilization,
+	decreaseStabilization time.Duration,
+	schedules []AutoscaleSchedule,
+) error {
+	for _, p := range increasePolicies {
+		if err := p.validate(); err != nil {
+			return fmt.Errorf("invalid increase policy: %v", err)
+		}
+	}
+	for _, p := range decreasePolicies {
+		if err := p.validate(); err != nil {
+			return fmt.Errorf("invalid decrease policy: %v", err)
+		}
+	}
+	if selectPolicy != AutoscaleSelectMax && selectPolicy != AutoscaleSelectMin {
+		return fmt.Errorf("invalid selectPolicy %q, must be %q or %q", selectPolicy, AutoscaleSelectMax, AutoscaleSelectMin)
+	}
+	if increaseStabilization < 0 {
+		return fmt.Errorf("increaseStabilization must be >= 0, got %v", increaseStabilization)
+	}
+	if decreaseStabilization < 0 {
+		return fmt.Errorf("decreaseStabilization must be >= 0, got %v", decreaseStabilization)
+	}
+	for _, s := range schedules {
+		if err := s.validate(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,133 @@
+package pipeline
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+const (
+	// CounterRate computes the per unit rate of a counter.
+	CounterRate = "rate"
+	// CounterIncrease computes the increase of a counter.
+	CounterIncrease = "increase"
+)
+
+// Compute the rate or increase of a counter, like the rate and increase functions of Prometheus.
+//
+// A decrease of the counter is a reset, after which the counter started again from zero.
+// If the Max property is set a decrease can also be a wrap-around past the largest value of the counter.
+// A decrease is a wrap-around if the counter was within half of its range of Max,
+// otherwise it is a reset.
+//
+// The increase is extrapolated to the boundaries of the range, so that it is not
+// underestimated when the samples do not cover the whole range.
+// Like Prometheus the increase is not extrapolated past the time the counter would have been zero,
+// or more than half the average interval between samples past the first and last sample.
+//
+// For batch edges one point is emitted per batch with the time of the batch.
+// The range ends at the time of the batch and starts Period before it.
+// If Period is not set the range starts at the first point of the batch and nothing is extrapolated.
+//
+// For stream edges the range of each point is the Period before the point
+// and the result is set on the point.
+// The node keeps the points of each group within the Period.
+//
+// At least two points are needed within a range, otherwise nothing is emitted.
+//
+// Example:
+//     stream
+//         |from()
+//             .measurement('net')
+//             .groupBy('host', 'interface')
+//         |rate('bytes_recv')
+//             .period(5m)
+//             // 32 bit counter
+//             .max(4294967295.0)
+//             .as('bytes_recv_rate')
+//
+// Example:
+//     stream
+//         |from()
+//             .measurement('requests')
+//         |window()
+//             .period(1h)
+//             .every(1h)
+//         |increase('count')
+//             .period(1h)
+//             .as('hourly_requests')
+//
+// Available Statistics:
+//
+//    * counter_resets -- number of times a counter was reset.
+//    * counter_wraps  -- number of times a counter wrapped around past the Max.
+//
+type CounterNode struct {
+	chainnode
+
+	// The field of the counter.
+	// tick:ignore
+	Field string
+
+	// Method is either 'rate' or 'increase'.
+	// tick:ignore
+	Method string
+
+	// Period is the length of the range of each result.
+	// Required for stream edges.
+	Period time.Duration
+
+	// Max is the largest value of the counter before it wraps around to zero,
+	// i.e. 4294967295 for 32 bit counters.
+	// If 0 every decrease is a reset.
+	Max float64
+
+	// The time unit of the rate.
+	// Default: 1s
+	Unit time.Duration
+
+	// The name of the result field.
+	// Default: the name of the field
+	As string
+}
+
+func newCounterNode(wants EdgeType, method, field string) *CounterNode {
+	provides := wants
+	if wants == BatchEdge {
+		provides = StreamEdge
+	}
+	return &CounterNode{
+		chainnode: newBasicChainNode(method, wants, provides),
+		Field:     field,
+		Method:    method,
+		Unit:      time.Second,
+		As:        field,
+	}
+}
+
+func (n *CounterNode) validate() error {
+	if n.Field == "" {
+		return errors.New("must specify a field")
+	}
+	switch n.Method {
+	case CounterRate, CounterIncrease:
+	default:
+		return fmt.Errorf("invalid method %q", n.Method)
+	}
+	if n.Period < 0 {
+		return fmt.Errorf("period must be >= 0, got %v", n.Period)
+	}
+	if n.Wants() == StreamEdge && n.Period == 0 {
+		return errors.New("must specify a period for stream edges")
+	}
+	if n.Max < 0 {
+		return fmt.Errorf("max must be >= 0, got %v", n.Max)
+	}
+	if n.Unit <= 0 {
+		return fmt.Errorf("unit must be > 0, got %v", n.Unit)
+	}
+	if n.As == "" {
+		return errors.New("as must not be empty")
+	}
+	return nil
+}
@@ -26,6 +26,7 @@ import (
 //
 type EvalNode struct {
 	chainnode
+	parallel
 
 	// The name of the field that results from applying the expression.
 	// tick:ignore
@@ -0,0 +1,135 @@
+package pipeline
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+const (
+	// ForecastLinear fits a least squares line to the values.
+	ForecastLinear = "linear"
+	// ForecastHoltWinters fits the Holt-Winters model used by the holtWinters InfluxQL function.
+	ForecastHoltWinters = "holt-winters"
+)
+
+// Forecast the values of a field per group, i.e. to alert before a disk fills up.
+//
+// A model is fit to the values of the field and extrapolated Horizon past the last value.
+// The model is either a linear regression or the Holt-Winters model of the holtWinters InfluxQL function.
+// Holt-Winters needs evenly spaced values, so the values are rounded to the Interval property
+// and a Season can be set to the number of intervals in a seasonal pattern.
+//
+// For batch edges the model is fit to each batch and a single point is emitted per batch.
+// For stream edges the model is fit to the values within the last Period of each point,
+// and the forecast fields are added to the point.
+// Points or batches with fewer than two values are dropped.
+//
+// The following fields are set, prefixed with the As property:
+//
+//    * (no suffix)         -- predicted value at the horizon.
+//    * _time_to_threshold  -- seconds until the forecast crosses the threshold, only if a threshold is set.
+//
+// The time to threshold is only set if the forecast crosses the threshold.
+// A linear forecast may cross the threshold past the horizon,
+// while a Holt-Winters forecast only crosses it within the horizon.
+//
+// Example:
+//     stream
+//         |from()
+//             .measurement('disk')
+//             .groupBy('host', 'path')
+//         |window()
+//             .period(1h)
+//             .every(5m)
+//         |forecast('used_percent')
+//             .horizon(6h)
+//             .threshold(100.0)
+//         |alert()
+//             // Full within 4h
+//             .crit(lambda: isPresent("forecast_time_to_threshold") AND "forecast_time_to_threshold" < 4.0 * 3600.0)
+//
+type ForecastNode struct {
+	chainnode
+
+	// The field to forecast.
+	// tick:ignore
+	Field string
+
+	// Horizon is how far past the last value to forecast.
+	Horizon time.Duration
+
+	// Method is the model to fit, either 'linear' or 'holt-winters'.
+	// Default: linear
+	Method string
+
+	// Interval is the spacing of the values for the Holt-Winters model.
+	// Required for the 'holt-winters' method.
+	Interval time.Duration
+
+	// Season is the number of intervals in a seasonal pattern of the Holt-Winters model.
+	// Values less than 2 disable seasonality.
+	Season int64
+
+	// Period is the time range of the values the model is fit to for stream edges.
+	// Required for stream edges.
+	Period time.Duration
+
+	// The threshold of the time to threshold estimate.
+	// tick:ignore
+	ThresholdValue float64 `tick:"Threshold"`
+
+	// Whether a threshold was set.
+	// tick:ignore
+	HasThreshold bool
+
+	// As is the name of the predicted field and the prefix of the other fields.
+	// Default: forecast
+	As string
+}
+
+func newForecastNode(wants EdgeType, field string) *ForecastNode {
+	return &ForecastNode{
+		chainnode: newBasicChainNode("forecast", wants, StreamEdge),
+		Field:     field,
+		Method:    ForecastLinear,
+		As:        "forecast",
+	}
+}
+
+// Estimate the time until the forecast crosses the threshold,
+// set in seconds as the `_time_to_threshold` field.
+// tick:property
+func (n *ForecastNode) Threshold(value float64) *ForecastNode {
+	n.ThresholdValue = value
+	n.HasThreshold = true
+	return n
+}
+
+func (n *ForecastNode) validate() error {
+	if n.Field == "" {
+		return errors.New("must specify a field")
+	}
+	if n.Horizon <= 0 {
+		return fmt.Errorf("horizon must be > 0, got %v", n.Horizon)
+	}
+	switch n.Method {
+	case ForecastLinear:
+	case ForecastHoltWinters:
+		if n.Interval <= 0 {
+			return fmt.Errorf("interval must be > 0 for the '%s' method, got %v", ForecastHoltWinters, n.Interval)
+		}
+	default:
+		return fmt.Errorf("invalid method %q, must be '%s' or '%s'", n.Method, ForecastLinear, ForecastHoltWinters)
+	}
+	if n.Season < 0 {
+		return fmt.Errorf("season must be >= 0, got %d", n.Season)
+	}
+	if n.Wants() == StreamEdge && n.Period <= 0 {
+		return errors.New("must specify a period for stream edges")
+	}
+	if n.As == "" {
+		return errors.New("as must not be empty")
+	}
+	return nil
+}
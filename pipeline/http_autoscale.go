@@ -0,0 +1,292 @@
+package pipeline
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/influxdata/kapacitor/tick/ast"
+)
+
+const (
+	DefaultHTTPAutoscaleReplicasField = "replicas"
+	DefaultHTTPAutoscaleScaleMethod   = "PUT"
+	DefaultHTTPAutoscaleScaleBody     = `{"replicas":{{.Replicas}}}`
+)
+
+// HTTPAutoscaleNode triggers autoscale events for a resource of any service
+// that exposes its replica count over HTTP, i.e. Nomad, ECS compatible or in-house schedulers.
+// The node also outputs points for the triggered events.
+//
+// The service is reached through an endpoint of an [[httppost]] section of the configuration,
+// which provides the base URL, headers and basic auth of the requests.
+// The current replicas are read from the JSON response of a GET request to the ReplicasPath
+// and changed with a request to the ScalePath with the ScaleBody.
+// The paths and the body are Go templates with the fields `.Name`, the name of the resource,
+// and `.Replicas`, the new replica count, which is only set for the scale request.
+// The name is escaped as a path segment in the paths and as the content of a JSON string in the body.
+//
+// Example:
+//     stream
+//         |from()
+//             .measurement('requests')
+//             .groupBy('job')
+//         |window()
+//             .period(5m)
+//             .every(5m)
+//         |mean('rps')
+//             .as('rps')
+//         |httpAutoscale()
+//             // The [[httppost]] endpoint named 'nomad' has the url of the Nomad API.
+//             .endpoint('nomad')
+//             .resourceNameTag('job')
+//             .replicasPath('/v1/job/{{.Name}}')
+//             .replicasField('TaskGroups.0.Count')
+//             .scalePath('/v1/job/{{.Name}}/scale')
+//             .scaleMethod('POST')
+//             .scaleBody('{"Count":{{.Replicas}},"Target":{"Group":"web"}}')
+//             .min(1)
+//             .max(20)
+//             .replicas(lambda: int(ceil("rps" / 100.0)))
+//         |influxDBOut()
+//             .database('deployments')
+//             .measurement('scale_events')
+//
+// Any time the httpAutoscale node changes a replica count, it emits a point.
+// The point is tagged with the resource name using the ResourceTag property.
+// In addition the group by tags will be preserved on the emitted point.
+// The point contains two fields: `old`, and `new` representing change in the replicas.
+//
+// The scaling behavior properties are the same as those of the K8sAutoscaleNode.
+//
+// Available Statistics:
+//
+//    * increase_events -- number of times the replica count was increased.
+//    * decrease_events -- number of times the replica count was decreased.
+//    * cooldown_drops  -- number of times an event was dropped because of a cooldown timer.
+//    * policy_limits   -- number of times a change was limited by an increase or decrease policy.
+//    * errors          -- number of errors encountered, typically related to communicating with the service.
+//
+type HTTPAutoscaleNode struct {
+	chainnode
+
+	// Endpoint is the name of an [[httppost]] endpoint of the configuration.
+	Endpoint string
+
+	// ResourceName is the name of the resource to autoscale.
+	ResourceName string
+
+	// ResourceNameTag is the name of a tag that names the resource to autoscale.
+	ResourceNameTag string
+
+	// ReplicasPath is the template of the path, relative to the endpoint URL, that returns the current replicas.
+	ReplicasPath string
+
+	// ReplicasField is the field of the JSON response that contains the current replicas.
+	// Nested fields and array elements are separated by '.'.
+	// Default: replicas
+	ReplicasField string
+
+	// ScalePath is the template of the path, relative to the endpoint URL, used to set the replicas.
+	// Default: the ReplicasPath
+	ScalePath string
+
+	// ScaleMethod is the HTTP method used to set the replicas, one of PUT, POST or PATCH.
+	// Default: PUT
+	ScaleMethod string
+
+	// ScaleBody is the template of the body used to set the replicas.
+	// Default: {"replicas":{{.Replicas}}}
+	ScaleBody string
+
+	// CurrentField is the name of a field into which the current replica count will be set as an int.
+	// If empty no field will be set.
+	// Useful for computing deltas on the current state.
+	//
+	// Example:
+	//    |httpAutoscale()
+	//        .currentField('replicas')
+	//        // Increase the replicas by 1 if the qps is over the threshold
+	//        .replicas(lambda: if("qps" > threshold, "replicas" + 1, "replicas"))
+	//
+	CurrentField string
+
+	// The maximum scale factor to set.
+	// If 0 then there is no upper limit.
+	// Default: 0, a.k.a no limit.
+	Max int64
+
+	// The minimum scale factor to set.
+	// Default: 1
+	Min int64
+
+	// Replicas is a lambda expression that should evaluate to the desired number of replicas for the resource.
+	Replicas *ast.LambdaNode
+
+	// Only one increase event can be triggered per resource every IncreaseCooldown interval.
+	IncreaseCooldown time.Duration
+	// Only one decrease event can be triggered per resource every DecreaseCooldown interval.
+	DecreaseCooldown time.Duration
+
+	// Policies that limit how much the replicas may increase within a period.
+	// tick:ignore
+	IncreasePolicies []AutoscalePolicy `tick:"IncreasePolicy"`
+	// Policies that limit how much the replicas may decrease within a period.
+	// tick:ignore
+	DecreasePolicies []AutoscalePolicy `tick:"DecreasePolicy"`
+
+	// SelectPolicy chooses between multiple increase or decrease policies.
+	// Either "max" to use the policy that allows the largest change or "min" for the smallest change.
+	// Default: max
+	SelectPolicy string
+
+	// IncreaseStabilization is the window of desired replica counts used when increasing the replicas.
+	// The replicas are only increased to the smallest desired count within the window.
+	IncreaseStabilization time.Duration
+	// DecreaseStabilization is the window of desired replica counts used when decreasing the replicas.
+	// The replicas are only decreased to the largest desired count within the window.
+	DecreaseStabilization time.Duration
+
+	// Schedules that override the min and max replicas.
+	// tick:ignore
+	Schedules []AutoscaleSchedule `tick:"Schedule"`
+
+	// Emit the scaling decisions without changing the replicas.
+	// tick:ignore
+	IsDryRun bool `tick:"DryRun"`
+
+	// ResourceTag is the name of a tag to use when tagging emitted points with the resource.
+	// If empty the point will not be tagged with the resource.
+	// Default: resource
+	ResourceTag string
+}
+
+func newHTTPAutoscaleNode(e EdgeType) *HTTPAutoscaleNode {
+	return &HTTPAutoscaleNode{
+		chainnode:     newBasicChainNode("http_autoscale", e, StreamEdge),
+		ReplicasField: DefaultHTTPAutoscaleReplicasField,
+		ScaleMethod:   DefaultHTTPAutoscaleScaleMethod,
+		ScaleBody:     DefaultHTTPAutoscaleScaleBody,
+		Min:           1,
+		SelectPolicy:  AutoscaleSelectMax,
+		ResourceTag:   DefaultResourceTag,
+	}
+}
+
+func (n *HTTPAutoscaleNode) validate() error {
+	if n.Endpoint == "" {
+		return errors.New("must specify an endpoint")
+	}
+	if (n.ResourceName != "" && n.ResourceNameTag != "") ||
+		(n.ResourceNameTag == "" && n.ResourceName == "") {
+		return fmt.Errorf("must specify exactly one of ResourceName or ResourceNameTag")
+	}
+	if n.ReplicasPath == "" {
+		return errors.New("must specify a replicasPath")
+	}
+	if n.ReplicasField == "" {
+		return errors.New("must specify a replicasField")
+	}
+	switch strings.ToUpper(n.ScaleMethod) {
+	case "PUT", "POST", "PATCH":
+	default:
+		return fmt.Errorf("invalid scaleMethod, must be 'PUT', 'POST' or 'PATCH', got %s", n.ScaleMethod)
+	}
+	for name, tmpl := range map[string]string{
+		"replicasPath": n.ReplicasPath,
+		"scalePath":    n.ScalePath,
+		"scaleBody":    n.ScaleBody,
+	} {
+		if _, err := template.New(name).Parse(tmpl); err != nil {
+			return fmt.Errorf("invalid %s template: %v", name, err)
+		}
+	}
+	if n.Min < 1 {
+		return fmt.Errorf("min must be >= 1, got %d", n.Min)
+	}
+	if n.Replicas == nil {
+		return errors.New("must provide a replicas lambda expression")
+	}
+	return validateAutoscaleBehavior(
+		n.IncreasePolicies,
+		n.DecreasePolicies,
+		n.SelectPolicy,
+		n.IncreaseStabilization,
+		n.DecreaseStabilization,
+		n.Schedules,
+	)
+}
+
+// Limit the increase of the replicas within a sliding period.
+// The type is either 'pods' to add at most value replicas per period
+// or 'percent' to add at most value percent of the replicas at the start of the period.
+// When multiple increase policies are set the SelectPolicy property chooses between them.
+//
+// Example:
+//    |httpAutoscale()
+//        // Add at most 4 replicas or double the replicas every minute, whichever is more.
+//        .increasePolicy('pods', 4, 1m)
+//        .increasePolicy('percent', 100, 1m)
+//
+// tick:property
+func (n *HTTPAutoscaleNode) IncreasePolicy(typ string, value int64, period time.Duration) *HTTPAutoscaleNode {
+	n.IncreasePolicies = append(n.IncreasePolicies, AutoscalePolicy{
+		Type:   typ,
+		Value:  value,
+		Period: period,
+	})
+	return n
+}
+
+// Limit the decrease of the replicas within a sliding period.
+// The type is either 'pods' to remove at most value replicas per period
+// or 'percent' to remove at most value percent of the replicas at the start of the period.
+// When multiple decrease policies are set the SelectPolicy property chooses between them.
+//
+// Example:
+//    |httpAutoscale()
+//        // Remove at most 10 percent of the replicas every 5 minutes.
+//        .decreasePolicy('percent', 10, 5m)
+//
+// tick:property
+func (n *HTTPAutoscaleNode) DecreasePolicy(typ string, value int64, period time.Duration) *HTTPAutoscaleNode {
+	n.DecreasePolicies = append(n.DecreasePolicies, AutoscalePolicy{
+		Type:   typ,
+		Value:  value,
+		Period: period,
+	})
+	return n
+}
+
+// Override the min and max replicas for a duration each time the cron expression fires.
+// A max of 0 means there is no upper limit.
+// If multiple schedules apply at the same time the first one is used.
+//
+// Example:
+//    |httpAutoscale()
+//        .min(1)
+//        .max(10)
+//        // Keep between 5 and 20 replicas during business hours.
+//        .schedule('0 9 * * 1-5', 8h, 5, 20)
+//
+// tick:property
+func (n *HTTPAutoscaleNode) Schedule(cron string, duration time.Duration, min, max int64) *HTTPAutoscaleNode {
+	n.Schedules = append(n.Schedules, AutoscaleSchedule{
+		Cron:     cron,
+		Duration: duration,
+		Min:      min,
+		Max:      max,
+	})
+	return n
+}
+
+// Emit the scaling decisions as points without sending the scale requests.
+// The current replicas are still read when a resource is first seen.
+// The emitted points have a `dry_run` field set to true.
+// tick:property
+func (n *HTTPAutoscaleNode) DryRun() *HTTPAutoscaleNode {
+	n.IsDryRun = true
+	return n
+}
@@ -69,11 +69,18 @@ const (
 // In addition the group by tags will be preserved on the emitted point.
 // The point contains two fields: `old`, and `new` representing change in the replicas.
 //
+// Similar to the Kubernetes Horizontal Pod Autoscaler the changes can be shaped further.
+// Stabilization windows only act on the largest (for decreases) or smallest (for increases)
+// desired replica count within the window, increase and decrease policies limit the change
+// in replicas per period, and schedules override the min and max replicas at certain times.
+// A dry run emits the points without changing the replicas, to try out a configuration.
+//
 // Available Statistics:
 //
 //    * increase_events -- number of times the replica count was increased.
 //    * decrease_events -- number of times the replica count was decreased.
 //    * cooldown_drops  -- number of times an event was dropped because of a cooldown timer.
+//    * policy_limits   -- number of times a change was limited by an increase or decrease policy.
 //    * errors          -- number of errors encountered, typically related to communicating with the Kubernetes API.
 //
 type K8sAutoscaleNode struct {
@@ -125,6 +132,33 @@ type K8sAutoscaleNode struct {
 	// Only one decrease event can be triggered per resource every DecreaseCooldown interval.
 	DecreaseCooldown time.Duration
 
+	// Policies that limit how much the replicas may increase within a period.
+	// tick:ignore
+	IncreasePolicies []AutoscalePolicy `tick:"IncreasePolicy"`
+	// Policies that limit how much the replicas may decrease within a period.
+	// tick:ignore
+	DecreasePolicies []AutoscalePolicy `tick:"DecreasePolicy"`
+
+	// SelectPolicy chooses between multiple increase or decrease policies.
+	// Either "max" to use the policy that allows the largest change or "min" for the smallest change.
+	// Default: max
+	SelectPolicy string
+
+	// IncreaseStabilization is the window of desired replica counts used when increasing the replicas.
+	// The replicas are only increased to the smallest desired count within the window.
+	IncreaseStabilization time.Duration
+	// DecreaseStabilization is the window of desired replica counts used when decreasing the replicas.
+	// The replicas are only decreased to the largest desired count within the window.
+	DecreaseStabilization time.Duration
+
+	// Schedules that override the min and max replicas.
+	// tick:ignore
+	Schedules []AutoscaleSchedule `tick:"Schedule"`
+
+	// Emit the scaling decisions without changing the replicas.
+	// tick:ignore
+	IsDryRun bool `tick:"DryRun"`
+
 	// NamespaceTag is the name of a tag to use when tagging emitted points with the namespace.
 	// If empty the point will not be tagged with the resource.
 	// Default: namespace
@@ -145,6 +179,7 @@ func newK8sAutoscaleNode(e EdgeType) *K8sAutoscaleNode {
 	k := &K8sAutoscaleNode{
 		chainnode:    newBasicChainNode("k8s_autoscale", e, StreamEdge),
 		Min:          1,
+		SelectPolicy: AutoscaleSelectMax,
 		Kind:         client.DeploymentsKind,
 		NamespaceTag: DefaultNamespaceTag,
 		KindTag:      DefaultKindTag,
@@ -167,5 +202,84 @@ func (n *K8sAutoscaleNode) validate() error {
 	if n.Replicas == nil {
 		return errors.New("must provide a replicas lambda expression")
 	}
-	return nil
+	return validateAutoscaleBehavior(
+		n.IncreasePolicies,
+		n.DecreasePolicies,
+		n.SelectPolicy,
+		n.IncreaseStabilization,
+		n.DecreaseStabilization,
+		n.Schedules,
+	)
+}
+
+// Limit the increase of the replicas within a sliding period.
+// The type is either 'pods' to add at most value replicas per period
+// or 'percent' to add at most value percent of the replicas at the start of the period.
+// When multiple increase policies are set the SelectPolicy property chooses between them.
+//
+// Example:
+//    |k8sAutoscale()
+//        // Add at most 4 replicas or double the replicas every minute, whichever is more.
+//        .increasePolicy('pods', 4, 1m)
+//        .increasePolicy('percent', 100, 1m)
+//
+// tick:property
+func (n *K8sAutoscaleNode) IncreasePolicy(typ string, value int64, period time.Duration) *K8sAutoscaleNode {
+	n.IncreasePolicies = append(n.IncreasePolicies, AutoscalePolicy{
+		Type:   typ,
+		Value:  value,
+		Period: period,
+	})
+	return n
+}
+
+// Limit the decrease of the replicas within a sliding period.
+// The type is either 'pods' to remove at most value replicas per period
+// or 'percent' to remove at most value percent of the replicas at the start of the period.
+// When multiple decrease policies are set the SelectPolicy property chooses between them.
+//
+// Example:
+//    |k8sAutoscale()
+//        // Remove at most 10 percent of the replicas every 5 minutes.
+//        .decreasePolicy('percent', 10, 5m)
+//
+// tick:property
+func (n *K8sAutoscaleNode) DecreasePolicy(typ string, value int64, period time.Duration) *K8sAutoscaleNode {
+	n.DecreasePolicies = append(n.DecreasePolicies, AutoscalePolicy{
+		Type:   typ,
+		Value:  value,
+		Period: period,
+	})
+	return n
+}
+
+// Override the min and max replicas for a duration each time the cron expression fires.
+// A max of 0 means there is no upper limit.
+// If multiple schedules apply at the same time the first one is used.
+//
+// Example:
+//    |k8sAutoscale()
+//        .min(1)
+//        .max(10)
+//        // Keep between 5 and 20 replicas during business hours.
+//        .schedule('0 9 * * 1-5', 8h, 5, 20)
+//
+// tick:property
+func (n *K8sAutoscaleNode) Schedule(cron string, duration time.Duration, min, max int64) *K8sAutoscaleNode {
+	n.Schedules = append(n.Schedules, AutoscaleSchedule{
+		Cron:     cron,
+		Duration: duration,
+		Min:      min,
+		Max:      max,
+	})
+	return n
+}
+
+// Emit the scaling decisions as points without changing the replicas through the Kubernetes API.
+// The current replicas are still read when a resource is first seen.
+// The emitted points have a `dry_run` field set to true.
+// tick:property
+func (n *K8sAutoscaleNode) DryRun() *K8sAutoscaleNode {
+	n.IsDryRun = true
+	return n
 }
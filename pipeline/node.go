@@ -76,8 +76,21 @@ type Node interface {
 
 	// Return .dot string to graph DAG
 	dot(buf *bytes.Buffer)
+
+	// The buffer size and overflow policy of the edges into the node.
+	EdgeOptions() (size int64, overflow string)
+	validateEdgeOptions() error
 }
 
+const (
+	// The edge blocks the sending node until the receiving node has made room.
+	BlockOverflow = "block"
+	// The edge drops the oldest buffered point or batch.
+	DropOldestOverflow = "drop-oldest"
+	// The edge drops the new point or batch.
+	DropNewestOverflow = "drop-newest"
+)
+
 type node struct {
 	p        *Pipeline
 	desc     string
@@ -89,6 +102,20 @@ type node struct {
 	provides EdgeType
 	tm       bool
 	pm       bool
+
+	// The number of messages the edges into the node buffer.
+	// When set on the stream or batch node it is the default for all nodes of the task,
+	// including the edge that receives the data of the task.
+	// Zero uses the default of the task or 1000.
+	EdgeBuffer int64
+
+	// What the edges into the node do once their buffer is full,
+	// one of 'block', 'drop-oldest' or 'drop-newest'.
+	// Only points and batches are dropped and the drops are counted in the `dropped` stat of the edge.
+	// Dropping keeps a slow node, i.e. a stuck HTTP post, from blocking the rest of the task and the writes of other tasks.
+	// When set on the stream or batch node it is the default for all nodes of the task.
+	// Empty uses the default of the task or 'block'.
+	EdgeOverflow string
 }
 
 // tick:ignore
@@ -176,6 +203,23 @@ func (n *node) validate() error {
 	return nil
 }
 
+// tick:ignore
+func (n *node) EdgeOptions() (int64, string) {
+	return n.EdgeBuffer, n.EdgeOverflow
+}
+
+func (n *node) validateEdgeOptions() error {
+	if n.EdgeBuffer < 0 {
+		return fmt.Errorf("invalid edgeBuffer %d, must be positive", n.EdgeBuffer)
+	}
+	switch n.EdgeOverflow {
+	case "", BlockOverflow, DropOldestOverflow, DropNewestOverflow:
+	default:
+		return fmt.Errorf("invalid edgeOverflow %q, must be one of %q, %q or %q", n.EdgeOverflow, BlockOverflow, DropOldestOverflow, DropNewestOverflow)
+	}
+	return nil
+}
+
 func (n *node) dot(buf *bytes.Buffer) {
 	for _, c := range n.children {
 		buf.Write([]byte(fmt.Sprintf("%s -> %s;\n", n.Name(), c.Name())))
@@ -291,6 +335,36 @@ func (n *node) Deadman(threshold float64, interval time.Duration, expr ...*ast.L
 	return an
 }
 
+// Parallelizer is a node that can receive its groups on several workers.
+type Parallelizer interface {
+	// The number of workers of the node, zero or one means the groups are received serially.
+	Parallelism() int64
+}
+
+// parallel is embedded by the group-aware nodes that can receive their groups on several workers.
+type parallel struct {
+	// The number of workers that receive the groups of the node concurrently.
+	// The groups are hash partitioned across the workers, so that each group is received in order by a single worker,
+	// and the output of the workers is merged before the next node.
+	// Use it for CPU heavy nodes with many groups, the default of zero receives all groups serially.
+	//
+	// UDF nodes do not support it: every group is sent to the single UDF process of the node,
+	// so parallelize the work inside the UDF instead.
+	Parallel int64
+}
+
+// tick:ignore
+func (p *parallel) Parallelism() int64 {
+	return p.Parallel
+}
+
+func (p *parallel) validateParallel() error {
+	if p.Parallel < 0 {
+		return fmt.Errorf("invalid parallel %d, must be positive", p.Parallel)
+	}
+	return nil
+}
+
 // ---------------------------------
 // Chaining methods
 //
@@ -475,6 +549,13 @@ func (n *chainnode) SwarmAutoscale() *SwarmAutoscaleNode {
 	return k
 }
 
+// Create a node that can trigger autoscale events for a service controlled over HTTP.
+func (n *chainnode) HttpAutoscale() *HTTPAutoscaleNode {
+	k := newHTTPAutoscaleNode(n.Provides())
+	n.linkChild(k)
+	return k
+}
+
 // Create a node that tracks duration in a given state.
 func (n *chainnode) StateDuration(expression *ast.LambdaNode) *StateDurationNode {
 	sd := newStateDurationNode(n.provides, expression)
@@ -488,3 +569,50 @@ func (n *chainnode) StateCount(expression *ast.LambdaNode) *StateCountNode {
 	n.linkChild(sc)
 	return sc
 }
+
+// Create a node that scores the values of a field against a baseline learned per group.
+func (n *chainnode) Anomaly(field string) *AnomalyNode {
+	a := newAnomalyNode(n.provides, field)
+	n.linkChild(a)
+	return a
+}
+
+// Create a node that forecasts the values of a field per group.
+func (n *chainnode) Forecast(field string) *ForecastNode {
+	f := newForecastNode(n.provides, field)
+	n.linkChild(f)
+	return f
+}
+
+// Create a node that computes quantiles of a field with bounded memory.
+func (n *chainnode) Quantiles(field string, quantiles ...float64) *QuantilesNode {
+	q := newQuantilesNode(n.provides, field, quantiles)
+	n.linkChild(q)
+	return q
+}
+
+// Create a node that computes the per unit rate of a counter, handling resets and wrap-arounds.
+func (n *chainnode) Rate(field string) *CounterNode {
+	c := newCounterNode(n.provides, CounterRate, field)
+	n.linkChild(c)
+	return c
+}
+
+// Create a node that computes the increase of a counter, handling resets and wrap-arounds.
+func (n *chainnode) Increase(field string) *CounterNode {
+	c := newCounterNode(n.provides, CounterIncrease, field)
+	n.linkChild(c)
+	return c
+}
+
+// Create a node that ranks the K largest keys of a stream by the sum of a field.
+//
+// NOTE: Topk can only be applied to stream edges.
+func (n *chainnode) Topk(k int64, field string) *TopKNode {
+	if n.Provides() != StreamEdge {
+		panic("cannot Topk batch edge")
+	}
+	t := newTopKNode(k, field)
+	n.linkChild(t)
+	return t
+}
@@ -93,6 +93,16 @@ func createPipelineAndVars(
 	}
 	if err = p.Walk(
 		func(n Node) error {
+			if err := n.validateEdgeOptions(); err != nil {
+				return fmt.Errorf("%s: %v", n.Name(), err)
+			}
+			if p, ok := n.(interface {
+				validateParallel() error
+			}); ok {
+				if err := p.validateParallel(); err != nil {
+					return fmt.Errorf("%s: %v", n.Name(), err)
+				}
+			}
 			return n.validate()
 		}); err != nil {
 		return nil, nil, err
@@ -96,3 +96,50 @@ func TestPipelineSort(t *testing.T) {
 
 	assert.Equal(sorted, p.sorted)
 }
+
+func TestTICK_To_Pipeline_EdgeOptions(t *testing.T) {
+	var tickScript = `
+stream
+	.edgeBuffer(100)
+	.edgeOverflow('drop-oldest')
+	|from()
+	|httpPost('http://localhost:9999')
+		.edgeBuffer(10)
+		.edgeOverflow('drop-newest')
+`
+
+	scope := stateful.NewScope()
+	p, err := CreatePipeline(tickScript, StreamEdge, scope, deadman{}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	src := p.sources[0]
+	if size, overflow := src.EdgeOptions(); size != 100 || overflow != DropOldestOverflow {
+		t.Errorf("unexpected edge options of the stream node: %d %s", size, overflow)
+	}
+	post := src.Children()[0].Children()[0]
+	if size, overflow := post.EdgeOptions(); size != 10 || overflow != DropNewestOverflow {
+		t.Errorf("unexpected edge options of the httpPost node: %d %s", size, overflow)
+	}
+
+	_, err = CreatePipeline(`stream|from().edgeOverflow('drop-all')`, StreamEdge, stateful.NewScope(), deadman{}, nil)
+	if exp := `from1: invalid edgeOverflow "drop-all", must be one of "block", "drop-oldest" or "drop-newest"`; err == nil || err.Error() != exp {
+		t.Errorf("unexpected error: got %v exp %s", err, exp)
+	}
+}
+
+func TestTICK_To_Pipeline_Parallel(t *testing.T) {
+	p, err := CreatePipeline(`stream|from()|eval(lambda: "value" * 2.0).as('double').parallel(8)`, StreamEdge, stateful.NewScope(), deadman{}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	eval := p.sources[0].Children()[0].Children()[0].(*EvalNode)
+	if got, exp := eval.Parallelism(), int64(8); got != exp {
+		t.Errorf("unexpected parallelism: got %d exp %d", got, exp)
+	}
+
+	_, err = CreatePipeline(`stream|from()|where(lambda: TRUE).parallel(-1)`, StreamEdge, stateful.NewScope(), deadman{}, nil)
+	if exp := "where2: invalid parallel -1, must be positive"; err == nil || err.Error() != exp {
+		t.Errorf("unexpected error: got %v exp %s", err, exp)
+	}
+}
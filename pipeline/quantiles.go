@@ -0,0 +1,154 @@
+package pipeline
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+const (
+	// QuantilesMergeSketch merges sketches encoded as string fields.
+	QuantilesMergeSketch = "sketch"
+	// QuantilesMergeBuckets merges the counts of histogram buckets.
+	QuantilesMergeBuckets = "buckets"
+
+	DefaultQuantilesAccuracy  = 0.01
+	DefaultQuantilesMaxBins   = 2048
+	DefaultQuantilesBucketTag = "le"
+)
+
+// Compute quantiles of a field with bounded memory.
+// Unlike the percentile InfluxQL function the values are not buffered,
+// instead they are counted in a DDSketch, which returns each quantile within
+// a relative Accuracy of the true value.
+// The memory of the sketch is bounded by the MaxBins property.
+//
+// For batch edges the quantiles of each batch are emitted as a single point.
+// For stream edges the quantiles are computed over consecutive periods, aligned to the Period,
+// and emitted once a point of a later period arrives.
+// The emitted points have the time of the end of the batch or period.
+//
+// The following fields are set, prefixed with the As property:
+//
+//    * _p<quantile> -- the value of each quantile, i.e. _p50, _p99 or _p99_9 for the quantiles 0.5, 0.99 and 0.999.
+//    * _count       -- the number of values.
+//
+// Example:
+//     stream
+//         |from()
+//             .measurement('requests')
+//             .groupBy('service')
+//         |quantiles('latency', 0.5, 0.9, 0.99)
+//             .period(1m)
+//         |influxDBOut()
+//             .database('latency')
+//
+// With the Merge property the node combines pre-aggregated data arriving as points.
+// In 'sketch' mode the field is a sketch encoded as a string, as set by the SketchField property of another quantiles node.
+// In 'buckets' mode the points are the buckets of Prometheus style histograms.
+// Each bucket has a tag, 'le' by default, with its upper bound and the field is the count of values up to that bound.
+// The counts of equal buckets are summed and the quantiles are interpolated within the buckets,
+// the same as the histogram_quantile function of Prometheus.
+//
+// Example:
+//     stream
+//         |from()
+//             .measurement('http_request_duration_seconds_bucket')
+//             .groupBy('service')
+//         |quantiles('count', 0.5, 0.99)
+//             .merge('buckets')
+//             .period(1m)
+//             .as('latency')
+//
+type QuantilesNode struct {
+	chainnode
+
+	// The field of the values.
+	// tick:ignore
+	Field string
+
+	// The quantiles to compute, between 0 and 1.
+	// tick:ignore
+	Quantiles []float64
+
+	// Period is the length of the periods of stream edges.
+	// Required for stream edges.
+	Period time.Duration
+
+	// Accuracy is the relative accuracy of the quantiles, between 0 and 1.
+	// Default: 0.01
+	Accuracy float64
+
+	// MaxBins is the maximum number of bins of the sketch.
+	// Once reached the bins of the smallest values are merged, reducing their accuracy.
+	// Default: 2048
+	MaxBins int64
+
+	// Merge combines pre-aggregated data, either 'sketch' or 'buckets'.
+	// If empty the field contains the values.
+	Merge string
+
+	// BucketTag is the tag with the upper bound of the buckets in 'buckets' mode.
+	// Default: le
+	BucketTag string
+
+	// SketchField is the name of a field into which the sketch is encoded as a string.
+	// The field can be merged by another quantiles node in 'sketch' mode.
+	// If empty no field is set.
+	SketchField string
+
+	// As is the prefix of the added fields.
+	// Default: the name of the field
+	As string
+}
+
+func newQuantilesNode(wants EdgeType, field string, quantiles []float64) *QuantilesNode {
+	return &QuantilesNode{
+		chainnode: newBasicChainNode("quantiles", wants, StreamEdge),
+		Field:     field,
+		Quantiles: quantiles,
+		Accuracy:  DefaultQuantilesAccuracy,
+		MaxBins:   DefaultQuantilesMaxBins,
+		BucketTag: DefaultQuantilesBucketTag,
+		As:        field,
+	}
+}
+
+func (n *QuantilesNode) validate() error {
+	if n.Field == "" {
+		return errors.New("must specify a field")
+	}
+	if len(n.Quantiles) == 0 {
+		return errors.New("must specify at least one quantile")
+	}
+	for _, q := range n.Quantiles {
+		if q < 0 || q > 1 {
+			return fmt.Errorf("quantiles must be >= 0 and <= 1, got %v", q)
+		}
+	}
+	if n.Wants() == StreamEdge && n.Period <= 0 {
+		return errors.New("must specify a period for stream edges")
+	}
+	if n.Accuracy <= 0 || n.Accuracy >= 1 {
+		return fmt.Errorf("accuracy must be > 0 and < 1, got %v", n.Accuracy)
+	}
+	if n.MaxBins < 1 {
+		return fmt.Errorf("maxBins must be >= 1, got %d", n.MaxBins)
+	}
+	switch n.Merge {
+	case "", QuantilesMergeSketch:
+	case QuantilesMergeBuckets:
+		if n.BucketTag == "" {
+			return errors.New("must specify a bucketTag in 'buckets' mode")
+		}
+		if n.SketchField != "" {
+			return errors.New("cannot set a sketchField in 'buckets' mode")
+		}
+	default:
+		return fmt.Errorf("invalid merge %q, must be '%s' or '%s'", n.Merge, QuantilesMergeSketch, QuantilesMergeBuckets)
+	}
+	if n.As == "" {
+		return errors.New("as must not be empty")
+	}
+	return nil
+}
@@ -0,0 +1,116 @@
+package pipeline
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// TopKNode finds the K largest keys of a stream by the sum of a field, i.e. the noisiest hosts,
+// with bounded memory.
+//
+// The keys are the values of the By tags.
+// The sums are estimated with the space-saving algorithm, which keeps a fixed number of
+// counters, set by the Capacity property, instead of a counter for every key.
+// Keys whose sum is larger than 1/Capacity of the total are always found.
+//
+// The sums are computed over a sliding Period and a ranked batch is emitted every Every interval,
+// once a point of the next interval arrives.
+// The Period is split into Every long intervals, each with its own counters.
+// The topk node computes the top keys within each group, so it does not need the grouping to be undone first.
+//
+// Each point of the emitted batch is tagged with the group and By tags and has two fields:
+// the estimated sum, named by the As property, and `rank`, starting at 1 for the largest key.
+//
+// Example:
+//     stream
+//         |from()
+//             .measurement('syslog')
+//         |topk(10, 'messages')
+//             .by('host')
+//             .period(10m)
+//             .every(1m)
+//         |httpOut('noisiest')
+//
+type TopKNode struct {
+	chainnode
+
+	// The number of keys to emit.
+	// tick:ignore
+	K int64
+
+	// The field to sum.
+	// tick:ignore
+	Field string
+
+	// The tags of the keys.
+	// tick:ignore
+	ByTags []string `tick:"By"`
+
+	// Period is the length of the sliding period of the sums.
+	Period time.Duration
+
+	// Every is how often the ranked batch is emitted.
+	// Default: the Period
+	Every time.Duration
+
+	// Capacity is the number of counters of each interval.
+	// Default: 10 times K, at least 100
+	Capacity int64
+
+	// The name of the field of the sums.
+	// Default: the name of the field
+	As string
+}
+
+func newTopKNode(k int64, field string) *TopKNode {
+	capacity := 10 * k
+	if capacity < 100 {
+		capacity = 100
+	}
+	return &TopKNode{
+		chainnode: newBasicChainNode("topk", StreamEdge, BatchEdge),
+		K:         k,
+		Field:     field,
+		Capacity:  capacity,
+		As:        field,
+	}
+}
+
+// The tags whose values are the keys that are ranked.
+// tick:property
+func (n *TopKNode) By(tags ...string) *TopKNode {
+	n.ByTags = tags
+	return n
+}
+
+func (n *TopKNode) validate() error {
+	if n.K < 1 {
+		return fmt.Errorf("k must be >= 1, got %d", n.K)
+	}
+	if n.Field == "" {
+		return errors.New("must specify a field")
+	}
+	if len(n.ByTags) == 0 {
+		return errors.New("must specify at least one by tag")
+	}
+	if n.Period <= 0 {
+		return fmt.Errorf("period must be > 0, got %v", n.Period)
+	}
+	if n.Every < 0 {
+		return fmt.Errorf("every must be >= 0, got %v", n.Every)
+	}
+	if n.Every > n.Period {
+		return fmt.Errorf("every must be <= period, got %v > %v", n.Every, n.Period)
+	}
+	if n.Capacity < n.K {
+		return fmt.Errorf("capacity must be >= k, got %d < %d", n.Capacity, n.K)
+	}
+	if n.As == "" {
+		return errors.New("as must not be empty")
+	}
+	if n.As == "rank" {
+		return errors.New("as must not be rank")
+	}
+	return nil
+}
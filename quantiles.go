@@ -0,0 +1,280 @@
+package kapacitor
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/influxdata/kapacitor/edge"
+	"github.com/influxdata/kapacitor/models"
+	"github.com/influxdata/kapacitor/pipeline"
+	"github.com/influxdata/kapacitor/sketch"
+)
+
+type QuantilesNode struct {
+	node
+	q *pipeline.QuantilesNode
+
+	quantileFields []string
+	countField     string
+}
+
+// Create a new QuantilesNode which computes quantiles with sketches.
+func newQuantilesNode(et *ExecutingTask, n *pipeline.QuantilesNode, d NodeDiagnostic) (*QuantilesNode, error) {
+	qn := &QuantilesNode{
+		node:       node{Node: n, et: et, diag: d},
+		q:          n,
+		countField: n.As + "_count",
+	}
+	for _, q := range n.Quantiles {
+		qn.quantileFields = append(qn.quantileFields, quantileFieldName(n.As, q))
+	}
+	qn.node.runF = qn.runQuantiles
+	return qn, nil
+}
+
+func (n *QuantilesNode) runQuantiles([]byte) error {
+	consumer := n.newGroupedConsumer(n)
+	return consumer.Consume()
+}
+
+func (n *QuantilesNode) NewGroup(group edge.GroupInfo, first edge.PointMeta) (edge.Receiver, error) {
+	g := &quantilesGroup{
+		n:    n,
+		name: first.Name(),
+		tags: group.Tags,
+		dims: group.Dimensions,
+	}
+	if err := g.reset(); err != nil {
+		return nil, err
+	}
+	return edge.NewReceiverFromForwardReceiverWithStats(
+		n.outs,
+		edge.NewTimedForwardReceiver(n.timer, g),
+	), nil
+}
+
+type quantilesGroup struct {
+	n    *QuantilesNode
+	name string
+	tags models.Tags
+	dims models.Dimensions
+
+	// Start of the current period of stream edges.
+	start time.Time
+
+	sketch  *sketch.DDSketch
+	buckets map[float64]float64
+}
+
+// reset clears the values of the group.
+func (g *quantilesGroup) reset() error {
+	if g.n.q.Merge == pipeline.QuantilesMergeBuckets {
+		g.buckets = make(map[float64]float64)
+		return nil
+	}
+	s, err := sketch.New(g.n.q.Accuracy, int(g.n.q.MaxBins))
+	if err != nil {
+		return err
+	}
+	g.sketch = s
+	return nil
+}
+
+func (g *quantilesGroup) BeginBatch(begin edge.BeginBatchMessage) (edge.Message, error) {
+	g.name = begin.Name()
+	g.start = begin.Time()
+	return nil, g.reset()
+}
+
+func (g *quantilesGroup) BatchPoint(bp edge.BatchPointMessage) (edge.Message, error) {
+	if err := g.add(bp); err != nil {
+		g.n.diag.Error("failed to add point to quantiles", err)
+	}
+	return nil, nil
+}
+
+func (g *quantilesGroup) EndBatch(end edge.EndBatchMessage) (edge.Message, error) {
+	return g.emit(g.start), nil
+}
+
+func (g *quantilesGroup) Point(p edge.PointMessage) (edge.Message, error) {
+	start := p.Time().Truncate(g.n.q.Period)
+	var msg edge.Message
+	if start.After(g.start) {
+		if !g.start.IsZero() {
+			msg = g.emit(g.start.Add(g.n.q.Period))
+			if err := g.reset(); err != nil {
+				return nil, err
+			}
+		}
+		g.start = start
+	}
+	if err := g.add(p); err != nil {
+		g.n.diag.Error("failed to add point to quantiles", err)
+	}
+	return msg, nil
+}
+
+// add adds the value of the field of the point to the sketch or buckets.
+func (g *quantilesGroup) add(p edge.FieldsTagsTimeGetter) error {
+	field := g.n.q.Field
+	value := p.Fields()[field]
+	switch g.n.q.Merge {
+	case pipeline.QuantilesMergeSketch:
+		encoded, ok := value.(string)
+		if !ok {
+			return fmt.Errorf("field %q is not an encoded sketch, got %T", field, value)
+		}
+		s, err := sketch.Decode(encoded)
+		if err != nil {
+			return err
+		}
+		return g.sketch.Merge(s)
+	case pipeline.QuantilesMergeBuckets:
+		count, ok := numToFloat(value)
+		if !ok {
+			return fmt.Errorf("field %q is missing or not a number, got %T", field, value)
+		}
+		le, ok := p.Tags()[g.n.q.BucketTag]
+		if !ok {
+			return fmt.Errorf("missing bucket tag %q", g.n.q.BucketTag)
+		}
+		upper, err := strconv.ParseFloat(le, 64)
+		if err != nil {
+			return fmt.Errorf("invalid bucket tag %q: %v", g.n.q.BucketTag, err)
+		}
+		g.buckets[upper] += count
+		return nil
+	default:
+		v, ok := numToFloat(value)
+		if !ok {
+			return fmt.Errorf("field %q is missing or not a number, got %T", field, value)
+		}
+		g.sketch.Add(v)
+		return nil
+	}
+}
+
+// emit returns a point with the quantiles, or nil if there are no values.
+func (g *quantilesGroup) emit(t time.Time) edge.Message {
+	fields := make(models.Fields, len(g.n.quantileFields)+2)
+	if g.n.q.Merge == pipeline.QuantilesMergeBuckets {
+		buckets := sortBuckets(g.buckets)
+		if len(buckets) == 0 || buckets[len(buckets)-1].count == 0 {
+			return nil
+		}
+		for i, q := range g.n.q.Quantiles {
+			fields[g.n.quantileFields[i]] = bucketQuantile(q, buckets)
+		}
+		fields[g.n.countField] = int64(math.Floor(buckets[len(buckets)-1].count + 0.5))
+	} else {
+		count := g.sketch.Count()
+		if count == 0 {
+			return nil
+		}
+		for i, q := range g.n.q.Quantiles {
+			fields[g.n.quantileFields[i]] = g.sketch.Quantile(q)
+		}
+		fields[g.n.countField] = int64(count)
+		if g.n.q.SketchField != "" {
+			fields[g.n.q.SketchField] = g.sketch.Encode()
+		}
+	}
+	return edge.NewPointMessage(
+		g.name, "", "",
+		g.dims,
+		fields,
+		g.tags,
+		t,
+	)
+}
+
+func (g *quantilesGroup) Barrier(b edge.BarrierMessage) (edge.Message, error) {
+	return b, nil
+}
+
+func (g *quantilesGroup) DeleteGroup(d edge.DeleteGroupMessage) (edge.Message, error) {
+	return d, nil
+}
+
+// quantileFieldName returns the name of the field of the quantile, i.e. prefix_p99_9 for 0.999.
+func quantileFieldName(prefix string, q float64) string {
+	if q >= 1 {
+		return prefix + "_p100"
+	}
+	// Shift the decimal point of the quantile by two digits to get the percentile.
+	digits := strings.TrimPrefix(strconv.FormatFloat(q, 'f', -1, 64), "0")
+	digits = strings.TrimPrefix(digits, ".")
+	for len(digits) < 2 {
+		digits += "0"
+	}
+	percentile := strings.TrimPrefix(digits[:2], "0")
+	if percentile == "" {
+		percentile = "0"
+	}
+	if rest := digits[2:]; rest != "" {
+		percentile += "_" + rest
+	}
+	return prefix + "_p" + percentile
+}
+
+// histogramBucket is a bucket of a histogram with the count of values up to the upper bound.
+type histogramBucket struct {
+	upper float64
+	count float64
+}
+
+type histogramBuckets []histogramBucket
+
+func (b histogramBuckets) Len() int           { return len(b) }
+func (b histogramBuckets) Less(i, j int) bool { return b[i].upper < b[j].upper }
+func (b histogramBuckets) Swap(i, j int)      { b[i], b[j] = b[j], b[i] }
+
+func sortBuckets(buckets map[float64]float64) []histogramBucket {
+	sorted := make([]histogramBucket, 0, len(buckets))
+	for upper, count := range buckets {
+		sorted = append(sorted, histogramBucket{upper: upper, count: count})
+	}
+	sort.Sort(histogramBuckets(sorted))
+	// Counts are cumulative, fix any that are not monotonic.
+	for i := 1; i < len(sorted); i++ {
+		if sorted[i].count < sorted[i-1].count {
+			sorted[i].count = sorted[i-1].count
+		}
+	}
+	return sorted
+}
+
+// bucketQuantile interpolates the quantile within the sorted buckets,
+// the same as the histogram_quantile function of Prometheus.
+// If there is no +Inf bucket the largest bucket is used as the total count.
+func bucketQuantile(q float64, buckets []histogramBucket) float64 {
+	total := buckets[len(buckets)-1].count
+	rank := q * total
+	b := sort.Search(len(buckets)-1, func(i int) bool { return buckets[i].count >= rank })
+
+	if math.IsInf(buckets[b].upper, 1) {
+		if b == 0 {
+			return math.NaN()
+		}
+		// The quantile is in the +Inf bucket, return the largest finite bound.
+		return buckets[b-1].upper
+	}
+	if b == 0 && buckets[0].upper <= 0 {
+		return buckets[0].upper
+	}
+	var lower, below float64
+	if b > 0 {
+		lower = buckets[b-1].upper
+		below = buckets[b-1].count
+	}
+	count := buckets[b].count - below
+	if count == 0 {
+		return buckets[b].upper
+	}
+	return lower + (buckets[b].upper-lower)*((rank-below)/count)
+}
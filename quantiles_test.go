@@ -0,0 +1,54 @@
+package kapacitor
+
+import (
+	"math"
+	"testing"
+)
+
+func TestQuantileFieldName(t *testing.T) {
+	testCases := map[float64]string{
+		0:      "latency_p0",
+		0.05:   "latency_p5",
+		0.5:    "latency_p50",
+		0.99:   "latency_p99",
+		0.999:  "latency_p99_9",
+		0.9999: "latency_p99_99",
+		1:      "latency_p100",
+	}
+	for q, exp := range testCases {
+		if got := quantileFieldName("latency", q); got != exp {
+			t.Errorf("unexpected field name for %v: got %s exp %s", q, got, exp)
+		}
+	}
+}
+
+func TestBucketQuantile(t *testing.T) {
+	buckets := sortBuckets(map[float64]float64{
+		0.1:         50,
+		0.5:         90,
+		1:           98,
+		math.Inf(1): 100,
+	})
+	testCases := []struct {
+		q   float64
+		exp float64
+	}{
+		{q: 0.25, exp: 0.05},
+		{q: 0.5, exp: 0.1},
+		{q: 0.7, exp: 0.3},
+		{q: 0.94, exp: 0.75},
+		// Within the +Inf bucket
+		{q: 0.99, exp: 1},
+	}
+	for _, tc := range testCases {
+		if got := bucketQuantile(tc.q, buckets); math.Abs(got-tc.exp) > 1e-9 {
+			t.Errorf("unexpected quantile %v: got %v exp %v", tc.q, got, tc.exp)
+		}
+	}
+
+	// Counts that are not monotonic are fixed.
+	buckets = sortBuckets(map[float64]float64{1: 10, 2: 5, 4: 20})
+	if got := bucketQuantile(0.75, buckets); got != 3 {
+		t.Errorf("unexpected quantile of non monotonic buckets: got %v exp 3", got)
+	}
+}
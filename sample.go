@@ -33,11 +33,7 @@ func newSampleNode(et *ExecutingTask, n *pipeline.SampleNode, d NodeDiagnostic)
 }
 
 func (n *SampleNode) runSample([]byte) error {
-	consumer := edge.NewGroupedConsumer(
-		n.ins[0],
-		n,
-	)
-	n.statMap.Set(statCardinalityGauge, consumer.CardinalityVar())
+	consumer := n.newGroupedConsumer(n)
 	return consumer.Consume()
 }
 
@@ -13,7 +13,9 @@ import (
 
 	"github.com/influxdata/kapacitor/command"
 	"github.com/influxdata/kapacitor/services/alerta"
+	"github.com/influxdata/kapacitor/services/audit"
 	"github.com/influxdata/kapacitor/services/azure"
+	"github.com/influxdata/kapacitor/services/cluster"
 	"github.com/influxdata/kapacitor/services/config"
 	"github.com/influxdata/kapacitor/services/consul"
 	"github.com/influxdata/kapacitor/services/deadman"
@@ -22,6 +24,7 @@ import (
 	"github.com/influxdata/kapacitor/services/ec2"
 	"github.com/influxdata/kapacitor/services/file_discovery"
 	"github.com/influxdata/kapacitor/services/gce"
+	"github.com/influxdata/kapacitor/services/ha"
 	"github.com/influxdata/kapacitor/services/hipchat"
 	"github.com/influxdata/kapacitor/services/httpd"
 	"github.com/influxdata/kapacitor/services/httppost"
@@ -51,6 +54,7 @@ import (
 	"github.com/influxdata/kapacitor/services/triton"
 	"github.com/influxdata/kapacitor/services/udf"
 	"github.com/influxdata/kapacitor/services/udp"
+	"github.com/influxdata/kapacitor/services/user_store"
 	"github.com/influxdata/kapacitor/services/victorops"
 	"github.com/pkg/errors"
 
@@ -64,7 +68,11 @@ type Config struct {
 	HTTP           httpd.Config      `toml:"http"`
 	Replay         replay.Config     `toml:"replay"`
 	Storage        storage.Config    `toml:"storage"`
+	Cluster        cluster.Config    `toml:"cluster"`
+	HA             ha.Config         `toml:"ha"`
 	Task           task_store.Config `toml:"task"`
+	UserStore      user_store.Config `toml:"user-store"`
+	Audit          audit.Config      `toml:"audit"`
 	InfluxDB       []influxdb.Config `toml:"influxdb" override:"influxdb,element-key=name"`
 	Logging        diagnostic.Config `toml:"logging"`
 	ConfigOverride config.Config     `toml:"config-override"`
@@ -131,8 +139,12 @@ func NewConfig() *Config {
 
 	c.HTTP = httpd.NewConfig()
 	c.Storage = storage.NewConfig()
+	c.Cluster = cluster.NewConfig()
+	c.HA = ha.NewConfig()
 	c.Replay = replay.NewConfig()
 	c.Task = task_store.NewConfig()
+	c.UserStore = user_store.NewConfig()
+	c.Audit = audit.NewConfig()
 	c.InfluxDB = []influxdb.Config{influxdb.NewConfig()}
 	c.Logging = diagnostic.NewConfig()
 	c.ConfigOverride = config.NewConfig()
@@ -181,6 +193,7 @@ func NewDemoConfig() (*Config, error) {
 	c.Replay.Dir = filepath.Join(homeDir, ".kapacitor", c.Replay.Dir)
 	c.Task.Dir = filepath.Join(homeDir, ".kapacitor", c.Task.Dir)
 	c.Storage.BoltDBPath = filepath.Join(homeDir, ".kapacitor", c.Storage.BoltDBPath)
+	c.Audit.Path = filepath.Join(homeDir, ".kapacitor", c.Audit.Path)
 	c.DataDir = filepath.Join(homeDir, ".kapacitor", c.DataDir)
 
 	return c, nil
@@ -194,6 +207,9 @@ func (c *Config) Validate() error {
 	if c.DataDir == "" {
 		return fmt.Errorf("must configure valid data dir")
 	}
+	if err := c.Logging.Validate(); err != nil {
+		return errors.Wrap(err, "logging")
+	}
 	if err := c.Replay.Validate(); err != nil {
 		return errors.Wrap(err, "replay")
 	}
@@ -203,9 +219,35 @@ func (c *Config) Validate() error {
 	if err := c.HTTP.Validate(); err != nil {
 		return errors.Wrap(err, "http")
 	}
+	if err := c.Cluster.Validate(); err != nil {
+		return errors.Wrap(err, "cluster")
+	}
+	if c.Cluster.Enabled && c.Cluster.DiscovererService != "" && c.discoverer(c.Cluster.DiscovererService, c.Cluster.DiscovererID) == nil {
+		return fmt.Errorf("cluster: unknown discoverer %s %q", c.Cluster.DiscovererService, c.Cluster.DiscovererID)
+	}
+	if err := c.HA.Validate(); err != nil {
+		return errors.Wrap(err, "ha")
+	}
+	if c.HA.Enabled && c.Cluster.Enabled {
+		return errors.New("ha and cluster cannot both be enabled")
+	}
+	if c.HA.Enabled && c.HA.Backend == ha.ConsulBackend {
+		if _, ok := c.consul(c.HA.ConsulID); !ok {
+			return fmt.Errorf("ha: unknown consul %q", c.HA.ConsulID)
+		}
+	}
 	if err := c.Task.Validate(); err != nil {
 		return errors.Wrap(err, "task")
 	}
+	if err := c.UserStore.Validate(); err != nil {
+		return errors.Wrap(err, "user-store")
+	}
+	if err := c.Audit.Validate(); err != nil {
+		return errors.Wrap(err, "audit")
+	}
+	if err := c.Stats.Validate(); err != nil {
+		return errors.Wrap(err, "stats")
+	}
 	// Validate the set of InfluxDB configs.
 	// All names should be unique.
 	names := make(map[string]bool, len(c.InfluxDB))
@@ -375,6 +417,65 @@ func (c *Config) Validate() error {
 	return nil
 }
 
+// discoverer returns the enabled discoverer of the service with the id, or nil if there is none.
+func (c *Config) discoverer(service, id string) scraper.Discoverer {
+	var discoverers []scraper.Discoverer
+	add := func(enabled bool, d scraper.Discoverer) {
+		if enabled {
+			discoverers = append(discoverers, d)
+		}
+	}
+	for _, d := range c.Azure {
+		add(d.Enabled, d)
+	}
+	for _, d := range c.Consul {
+		add(d.Enabled, d)
+	}
+	for _, d := range c.DNS {
+		add(d.Enabled, d)
+	}
+	for _, d := range c.EC2 {
+		add(d.Enabled, d)
+	}
+	for _, d := range c.FileDiscovery {
+		add(d.Enabled, d)
+	}
+	for _, d := range c.GCE {
+		add(d.Enabled, d)
+	}
+	for _, d := range c.Marathon {
+		add(d.Enabled, d)
+	}
+	for _, d := range c.Nerve {
+		add(d.Enabled, d)
+	}
+	for _, d := range c.Serverset {
+		add(d.Enabled, d)
+	}
+	for _, d := range c.StaticDiscovery {
+		add(d.Enabled, d)
+	}
+	for _, d := range c.Triton {
+		add(d.Enabled, d)
+	}
+	for _, d := range discoverers {
+		if d.Service() == service && d.ServiceID() == id {
+			return d
+		}
+	}
+	return nil
+}
+
+// consul returns the Consul configuration with the ID.
+func (c *Config) consul(id string) (consul.Config, bool) {
+	for _, cc := range c.Consul {
+		if cc.ID == id {
+			return cc, true
+		}
+	}
+	return consul.Config{}, false
+}
+
 func (c *Config) ApplyEnvOverrides() error {
 	return c.applyEnvOverrides("KAPACITOR", "", reflect.ValueOf(c))
 }
@@ -9,6 +9,7 @@ import (
 	"runtime"
 	"runtime/pprof"
 	"sync"
+	"time"
 
 	"github.com/influxdata/influxdb/influxql"
 	"github.com/influxdata/influxdb/services/collectd"
@@ -23,7 +24,9 @@ import (
 	"github.com/influxdata/kapacitor/server/vars"
 	"github.com/influxdata/kapacitor/services/alert"
 	"github.com/influxdata/kapacitor/services/alerta"
+	"github.com/influxdata/kapacitor/services/audit"
 	"github.com/influxdata/kapacitor/services/azure"
+	"github.com/influxdata/kapacitor/services/cluster"
 	"github.com/influxdata/kapacitor/services/config"
 	"github.com/influxdata/kapacitor/services/consul"
 	"github.com/influxdata/kapacitor/services/deadman"
@@ -32,6 +35,7 @@ import (
 	"github.com/influxdata/kapacitor/services/ec2"
 	"github.com/influxdata/kapacitor/services/file_discovery"
 	"github.com/influxdata/kapacitor/services/gce"
+	"github.com/influxdata/kapacitor/services/ha"
 	"github.com/influxdata/kapacitor/services/hipchat"
 	"github.com/influxdata/kapacitor/services/httpd"
 	"github.com/influxdata/kapacitor/services/httppost"
@@ -63,6 +67,7 @@ import (
 	"github.com/influxdata/kapacitor/services/triton"
 	"github.com/influxdata/kapacitor/services/udf"
 	"github.com/influxdata/kapacitor/services/udp"
+	"github.com/influxdata/kapacitor/services/user_store"
 	"github.com/influxdata/kapacitor/services/victorops"
 	"github.com/influxdata/kapacitor/uuid"
 	"github.com/influxdata/kapacitor/waiter"
@@ -107,6 +112,8 @@ type Server struct {
 	AuthService           auth.Interface
 	HTTPDService          *httpd.Service
 	StorageService        *storage.Service
+	ClusterService        *cluster.Service
+	HAService             *ha.Service
 	AlertService          *alert.Service
 	TaskStore             *task_store.Service
 	ReplayService         *replay.Service
@@ -188,6 +195,7 @@ func New(c *Config, buildInfo BuildInfo, diagService *diagnostic.Service) (*Serv
 	kd := diagService.NewKapacitorHandler()
 	s.TaskMaster = kapacitor.NewTaskMaster(kapacitor.MainTaskMaster, vars.Info, kd)
 	s.TaskMaster.DefaultRetentionPolicy = c.DefaultRetentionPolicy
+	s.TaskMaster.TraceSampleRate = c.Stats.TracingSampleRate
 	s.TaskMaster.Commander = s.Commander
 	s.TaskMasterLookup.Set(s.TaskMaster)
 	if err := s.TaskMaster.Open(); err != nil {
@@ -197,7 +205,14 @@ func New(c *Config, buildInfo BuildInfo, diagService *diagnostic.Service) (*Serv
 	// Append Kapacitor services.
 	s.initHTTPDService()
 	s.appendStorageService()
+	if err := s.appendClusterService(); err != nil {
+		return nil, errors.Wrap(err, "cluster service")
+	}
+	if err := s.appendHAService(); err != nil {
+		return nil, errors.Wrap(err, "ha service")
+	}
 	s.appendAuthService()
+	s.appendAuditService()
 	s.appendConfigOverrideService()
 	s.appendTesterService()
 
@@ -313,16 +328,99 @@ func (s *Server) appendStorageService() {
 	srv := storage.NewService(s.config.Storage, d)
 
 	srv.HTTPDService = s.HTTPDService
+	srv.Replicated = s.config.Cluster.Enabled || s.config.HA.Enabled
 
 	s.StorageService = srv
 	s.AppendService("storage", srv)
 }
 
+func (s *Server) appendClusterService() error {
+	c := s.config.Cluster
+	if c.Name == "" {
+		c.Name = s.hostname
+	}
+	if c.AdvertiseURL == "" {
+		u, err := s.advertiseURL()
+		if err != nil {
+			return err
+		}
+		c.AdvertiseURL = u
+	}
+	d := s.DiagService.NewClusterHandler()
+	srv := cluster.NewService(c, d)
+
+	srv.Discoverer = s.config.discoverer(c.DiscovererService, c.DiscovererID)
+	srv.DefaultRetentionPolicy = s.config.DefaultRetentionPolicy
+	srv.HTTPDService = s.HTTPDService
+	srv.StorageService = s.StorageService
+	srv.PointsWriter = s.TaskMaster
+
+	// Forward the writes to the members owning the tasks.
+	s.HTTPDService.Handler.PointsWriter = srv
+
+	s.ClusterService = srv
+	s.AppendService("cluster", srv)
+	return nil
+}
+
+func (s *Server) appendHAService() error {
+	c := s.config.HA
+	if c.Name == "" {
+		c.Name = s.hostname
+	}
+	if c.AdvertiseURL == "" {
+		u, err := s.advertiseURL()
+		if err != nil {
+			return err
+		}
+		c.AdvertiseURL = u
+	}
+	d := s.DiagService.NewHAHandler()
+	srv := ha.NewService(c, d)
+
+	if c.Enabled {
+		switch c.Backend {
+		case ha.FileBackend:
+			srv.Elector = ha.NewFileElector(c.Path, time.Duration(c.LeaseDuration), time.Duration(c.RenewInterval))
+		case ha.ConsulBackend:
+			cc, _ := s.config.consul(c.ConsulID)
+			e, err := ha.NewConsulElector(cc, c.ConsulKey, time.Duration(c.LeaseDuration))
+			if err != nil {
+				return errors.Wrap(err, "failed to create consul client")
+			}
+			srv.Elector = e
+		}
+	}
+	srv.HTTPDService = s.HTTPDService
+	srv.StorageService = s.ClusterService
+	srv.ClusterService = s.ClusterService
+
+	s.HTTPDService.Handler.RoleService = srv
+
+	s.HAService = srv
+	s.AppendService("ha", srv)
+	return nil
+}
+
+// advertiseURL returns the URL of the HTTP API of this instance from the hostname.
+func (s *Server) advertiseURL() (string, error) {
+	port, err := s.config.HTTP.Port()
+	if err != nil {
+		return "", errors.Wrap(err, "failed to get http port")
+	}
+	scheme := "http"
+	if s.config.HTTP.HttpsEnabled {
+		scheme = "https"
+	}
+	return fmt.Sprintf("%s://%s:%d", scheme, s.hostname, port), nil
+}
+
 func (s *Server) appendConfigOverrideService() {
 	d := s.DiagService.NewConfigOverrideHandler()
 	srv := config.NewService(s.config.ConfigOverride, s.config, d, s.configUpdates)
 	srv.HTTPDService = s.HTTPDService
-	srv.StorageService = s.StorageService
+	srv.StorageService = s.HAService
+	srv.ClusterService = s.HAService
 
 	s.ConfigOverrideService = srv
 	s.AppendService("config", srv)
@@ -334,7 +432,8 @@ func (s *Server) initAlertService() {
 
 	srv.Commander = s.Commander
 	srv.HTTPDService = s.HTTPDService
-	srv.StorageService = s.StorageService
+	srv.StorageService = s.HAService
+	srv.ClusterService = s.HAService
 
 	s.AlertService = srv
 	s.TaskMaster.AlertService = srv
@@ -382,7 +481,7 @@ func (s *Server) appendInfluxDBService() error {
 	srv.ClusterIDWaiter = w
 
 	srv.HTTPDService = s.HTTPDService
-	srv.PointsWriter = s.TaskMaster
+	srv.PointsWriter = s.ClusterService
 	srv.AuthService = s.AuthService
 	srv.ClientCreator = iclient.ClientCreator{}
 
@@ -412,9 +511,11 @@ func (s *Server) appendHTTPDService() {
 func (s *Server) appendTaskStoreService() {
 	d := s.DiagService.NewTaskStoreHandler()
 	srv := task_store.NewService(s.config.Task, d)
-	srv.StorageService = s.StorageService
+	srv.StorageService = s.HAService
+	srv.ClusterService = s.HAService
 	srv.HTTPDService = s.HTTPDService
 	srv.TaskMasterLookup = s.TaskMasterLookup
+	srv.AlertService = s.AlertService
 
 	s.TaskStore = srv
 	s.TaskMaster.TaskStore = srv
@@ -479,6 +580,17 @@ func (s *Server) appendUDFService() {
 }
 
 func (s *Server) appendAuthService() {
+	if s.config.UserStore.Enabled {
+		d := s.DiagService.NewUserStoreHandler()
+		srv := user_store.NewService(s.config.UserStore, d)
+		srv.StorageService = s.HAService
+		srv.HTTPDService = s.HTTPDService
+
+		s.AuthService = srv
+		s.HTTPDService.Handler.AuthService = srv
+		s.AppendService("auth", srv)
+		return
+	}
 	d := s.DiagService.NewNoAuthHandler()
 	srv := noauth.NewService(d)
 
@@ -487,6 +599,18 @@ func (s *Server) appendAuthService() {
 	s.AppendService("auth", srv)
 }
 
+func (s *Server) appendAuditService() {
+	if !s.config.Audit.Enabled {
+		return
+	}
+	d := s.DiagService.NewAuditHandler()
+	srv := audit.NewService(s.config.Audit, d)
+	srv.HTTPDService = s.HTTPDService
+
+	s.HTTPDService.Handler.AuditService = srv
+	s.AppendService("audit", srv)
+}
+
 func (s *Server) appendMQTTService() error {
 	cs := s.config.MQTT
 	d := s.DiagService.NewMQTTHandler()
@@ -669,7 +793,7 @@ func (s *Server) appendCollectdService() error {
 	srv.SetLogOutput(w)
 
 	srv.MetaClient = s.MetaClient
-	srv.PointsWriter = s.TaskMaster
+	srv.PointsWriter = s.ClusterService
 	s.AppendService("collectd", srv)
 
 	return nil
@@ -690,7 +814,7 @@ func (s *Server) appendOpenTSDBService() error {
 	}
 	srv.SetLogOutput(w)
 
-	srv.PointsWriter = s.TaskMaster
+	srv.PointsWriter = s.ClusterService
 	srv.MetaClient = s.MetaClient
 	s.AppendService("opentsdb", srv)
 	return nil
@@ -711,7 +835,7 @@ func (s *Server) appendGraphiteServices() error {
 		}
 		srv.SetLogOutput(w)
 
-		srv.PointsWriter = s.TaskMaster
+		srv.PointsWriter = s.ClusterService
 		srv.MetaClient = s.MetaClient
 		s.AppendService(fmt.Sprintf("graphite%d", i), srv)
 	}
@@ -725,7 +849,7 @@ func (s *Server) appendUDPServices() {
 		}
 		d := s.DiagService.NewUDPHandler()
 		srv := udp.NewService(c, d)
-		srv.PointsWriter = s.TaskMaster
+		srv.PointsWriter = s.ClusterService
 		s.AppendService(fmt.Sprintf("udp%d", i), srv)
 	}
 }
@@ -1,12 +1,19 @@
 package server_test
 
 import (
+	"bytes"
 	"context"
+	crand "crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
 	"encoding/json"
 	"fmt"
 	"io/ioutil"
+	"math/big"
 	"math/rand"
+	"net"
 	"net/http"
+	"net/http/httptest"
 	"net/mail"
 	"net/url"
 	"os"
@@ -34,6 +41,7 @@ import (
 	"github.com/influxdata/kapacitor/services/alert/alerttest"
 	"github.com/influxdata/kapacitor/services/alerta/alertatest"
 	"github.com/influxdata/kapacitor/services/hipchat/hipchattest"
+	"github.com/influxdata/kapacitor/services/httpd"
 	"github.com/influxdata/kapacitor/services/httppost"
 	"github.com/influxdata/kapacitor/services/httppost/httpposttest"
 	"github.com/influxdata/kapacitor/services/k8s"
@@ -48,6 +56,7 @@ import (
 	"github.com/influxdata/kapacitor/services/slack/slacktest"
 	"github.com/influxdata/kapacitor/services/smtp/smtptest"
 	"github.com/influxdata/kapacitor/services/snmptrap/snmptraptest"
+	"github.com/influxdata/kapacitor/services/storage"
 	"github.com/influxdata/kapacitor/services/swarm"
 	"github.com/influxdata/kapacitor/services/talk/talktest"
 	"github.com/influxdata/kapacitor/services/telegram"
@@ -57,6 +66,7 @@ import (
 	"github.com/influxdata/kapacitor/services/victorops/victoropstest"
 	"github.com/k-sone/snmpgo"
 	"github.com/pkg/errors"
+	"golang.org/x/crypto/bcrypt"
 )
 
 var udfDir string
@@ -127,451 +137,1476 @@ func TestServer_Pprof_Index(t *testing.T) {
 		})
 	}
 }
-func TestServer_Authenticate_Fail(t *testing.T) {
-	conf := NewConfig()
-	conf.HTTP.AuthEnabled = true
-	s := OpenServer(conf)
-	cli, err := client.New(client.Config{
-		URL: s.URL(),
-	})
-	if err != nil {
-		t.Fatal(err)
-	}
+func TestServer_Metrics(t *testing.T) {
+	s, cli := OpenDefaultServer()
 	defer s.Close()
-	_, _, err = cli.Ping()
-	if err == nil {
-		t.Error("expected authentication error")
-	} else if exp, got := "unable to parse authentication credentials", err.Error(); got != exp {
-		t.Errorf("unexpected error message: got %q exp %q", got, exp)
-	}
-}
 
-func TestServer_Authenticate_User(t *testing.T) {
-	conf := NewConfig()
-	conf.HTTP.AuthEnabled = true
-	s := OpenServer(conf)
-	cli, err := client.New(client.Config{
-		URL: s.URL(),
-		Credentials: &client.Credentials{
-			Method:   client.UserAuthentication,
-			Username: "bob",
-			Password: "bob's secure password",
-		},
-	})
-	if err != nil {
-		t.Fatal(err)
-	}
-	defer s.Close()
-	_, version, err := cli.Ping()
-	if err != nil {
+	id := "testMetricsTask"
+	if _, err := cli.CreateTask(client.CreateTaskOptions{
+		ID:   id,
+		Type: client.StreamTask,
+		DBRPs: []client.DBRP{{
+			Database:        "mydb",
+			RetentionPolicy: "myrp",
+		}},
+		TICKscript: `stream
+    |from()
+        .measurement('test')
+`,
+		Status: client.Enabled,
+	}); err != nil {
 		t.Fatal(err)
 	}
-	if version != "testServer" {
-		t.Fatal("unexpected version", version)
-	}
-}
-
-func TestServer_Authenticate_Bearer_Fail(t *testing.T) {
-	secret := "secret"
-	// Create a new token object, specifying signing method and the claims
-	// you would like it to contain.
-	token := jwt.NewWithClaims(jwt.SigningMethodHS512, jwt.MapClaims{
-		"username": "bob",
-		"exp":      time.Now().Add(10 * time.Second).Unix(),
-	})
 
-	// Sign and get the complete encoded token as a string using the secret
-	tokenString, err := token.SignedString([]byte(secret))
+	r, err := http.Get("http://" + s.HTTPDService.Addr().String() + "/metrics")
 	if err != nil {
 		t.Fatal(err)
 	}
-
-	conf := NewConfig()
-	conf.HTTP.AuthEnabled = true
-	// Use a different secret so the token is invalid
-	conf.HTTP.SharedSecret = secret + "extra secret"
-	s := OpenServer(conf)
-	cli, err := client.New(client.Config{
-		URL: s.URL(),
-		Credentials: &client.Credentials{
-			Method: client.BearerAuthentication,
-			Token:  tokenString,
-		},
-	})
-	if err != nil {
-		t.Fatal(err)
+	defer r.Body.Close()
+	if got, exp := r.StatusCode, http.StatusOK; got != exp {
+		t.Fatalf("unexpected status code got %d exp %d", got, exp)
 	}
-	defer s.Close()
-	_, _, err = cli.Ping()
-	if err == nil {
-		t.Error("expected authentication error")
-	} else if exp, got := "invalid token: signature is invalid", err.Error(); got != exp {
-		t.Errorf("unexpected error message: got %q exp %q", got, exp)
+	if got, exp := r.Header.Get("Content-Type"), "text/plain; version=0.0.4"; got != exp {
+		t.Errorf("unexpected content type got %s exp %s", got, exp)
 	}
-}
-
-func TestServer_Authenticate_Bearer_Expired(t *testing.T) {
-	secret := "secret"
-	// Create a new token object, specifying signing method and the claims
-	// you would like it to contain.
-	token := jwt.NewWithClaims(jwt.SigningMethodHS512, jwt.MapClaims{
-		"username": "bob",
-		"exp":      time.Now().Add(-10 * time.Second).Unix(),
-	})
-
-	// Sign and get the complete encoded token as a string using the secret
-	tokenString, err := token.SignedString([]byte(secret))
+	b, err := ioutil.ReadAll(r.Body)
 	if err != nil {
 		t.Fatal(err)
 	}
+	body := string(b)
 
-	conf := NewConfig()
-	conf.HTTP.AuthEnabled = true
-	conf.HTTP.SharedSecret = secret
-	s := OpenServer(conf)
-	cli, err := client.New(client.Config{
-		URL: s.URL(),
-		Credentials: &client.Credentials{
-			Method: client.BearerAuthentication,
-			Token:  tokenString,
-		},
-	})
-	if err != nil {
-		t.Fatal(err)
+	for _, exp := range []string{
+		"# TYPE kapacitor_num_enabled_tasks gauge\nkapacitor_num_enabled_tasks 1\n",
+		"# TYPE kapacitor_nodes_errors_total counter\n",
+		"# TYPE kapacitor_nodes_avg_exec_time_ns gauge\n",
+		"# TYPE kapacitor_edges_collected_total counter\n",
+		"# TYPE go_goroutines gauge\n",
+		"# TYPE go_memstats_alloc_bytes_total counter\n",
+	} {
+		if !strings.Contains(body, exp) {
+			t.Errorf("expected metrics to contain %q", exp)
+		}
 	}
-	defer s.Close()
-	_, _, err = cli.Ping()
-	if err == nil {
-		t.Error("expected authentication error")
-	} else if exp, got := "invalid token: Token is expired", err.Error(); got != exp {
-		t.Errorf("unexpected error message: got %q exp %q", got, exp)
+	var found bool
+	for _, line := range strings.Split(body, "\n") {
+		if strings.HasPrefix(line, "kapacitor_nodes_errors_total{") &&
+			strings.Contains(line, `node="from1"`) &&
+			strings.Contains(line, `task="`+id+`"`) &&
+			strings.Contains(line, `type="stream"`) &&
+			strings.HasSuffix(line, "} 0") {
+			found = true
+		}
 	}
-}
-
-func TestServer_Authenticate_Bearer(t *testing.T) {
-	secret := "secret"
-	// Create a new token object, specifying signing method and the claims
-	// you would like it to contain.
-	token := jwt.NewWithClaims(jwt.SigningMethodHS512, jwt.MapClaims{
-		"username": "bob",
-		"exp":      time.Now().Add(10 * time.Second).Unix(),
-	})
-
-	// Sign and get the complete encoded token as a string using the secret
-	tokenString, err := token.SignedString([]byte(secret))
-	if err != nil {
-		t.Fatal(err)
+	if !found {
+		t.Errorf("expected errors of the from node of the task, got:\n%s", body)
 	}
+}
 
+func TestServer_Tracing(t *testing.T) {
 	conf := NewConfig()
-	conf.HTTP.AuthEnabled = true
-	conf.HTTP.SharedSecret = secret
+	conf.Stats.TracingSampleRate = 1
 	s := OpenServer(conf)
-	cli, err := client.New(client.Config{
-		URL: s.URL(),
-		Credentials: &client.Credentials{
-			Method: client.BearerAuthentication,
-			Token:  tokenString,
-		},
-	})
-	if err != nil {
-		t.Fatal(err)
-	}
-	defer s.Close()
-	_, version, err := cli.Ping()
-	if err != nil {
-		t.Fatal(err)
-	}
-	if version != "testServer" {
-		t.Fatal("unexpected version", version)
-	}
-}
-
-func TestServer_CreateTask(t *testing.T) {
-	s, cli := OpenDefaultServer()
+	cli := Client(s)
 	defer s.Close()
 
-	id := "testTaskID"
-	ttype := client.StreamTask
-	dbrps := []client.DBRP{
-		{
+	task, err := cli.CreateTask(client.CreateTaskOptions{
+		ID:   "testTracingTask",
+		Type: client.StreamTask,
+		DBRPs: []client.DBRP{{
 			Database:        "mydb",
 			RetentionPolicy: "myrp",
-		},
-		{
-			Database:        "otherdb",
-			RetentionPolicy: "default",
-		},
-	}
-	tick := `stream
+		}},
+		TICKscript: `stream
     |from()
         .measurement('test')
-`
-	task, err := cli.CreateTask(client.CreateTaskOptions{
-		ID:         id,
-		Type:       ttype,
-		DBRPs:      dbrps,
-		TICKscript: tick,
-		Status:     client.Disabled,
+    |eval(lambda: "value" * 2.0)
+        .as('double')
+`,
+		Status: client.Enabled,
 	})
 	if err != nil {
 		t.Fatal(err)
 	}
 
-	ti, err := cli.Task(task.Link, nil)
-	if err != nil {
-		t.Fatal(err)
-	}
+	points := `test value=1 0000000000
+test value=2 0000000001
+test value=3 0000000002
+`
+	v := url.Values{}
+	v.Add("precision", "s")
+	s.MustWrite("mydb", "myrp", points, v)
 
-	if ti.Error != "" {
-		t.Fatal(ti.Error)
-	}
-	if ti.ID != id {
-		t.Fatalf("unexpected id got %s exp %s", ti.ID, id)
-	}
-	if ti.Type != client.StreamTask {
-		t.Fatalf("unexpected type got %v exp %v", ti.Type, client.StreamTask)
-	}
-	if ti.Status != client.Disabled {
-		t.Fatalf("unexpected status got %v exp %v", ti.Status, client.Disabled)
+	exp := "stream0 -> from1 -> eval2"
+	var got interface{}
+	for i := 0; i < 100; i++ {
+		task, err = cli.Task(task.Link, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got = task.ExecutionStats.TaskStats["slowest_path"]
+		if got == exp {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
 	}
-	if !reflect.DeepEqual(ti.DBRPs, dbrps) {
-		t.Fatalf("unexpected dbrps got %s exp %s", ti.DBRPs, dbrps)
+	if got != exp {
+		t.Fatalf("unexpected slowest path: got %v exp %v", got, exp)
 	}
-	if ti.TICKscript != tick {
-		t.Fatalf("unexpected TICKscript got %s exp %s", ti.TICKscript, tick)
+	if _, ok := task.ExecutionStats.NodeStats["eval2"]["trace_latency_p99_ns"]; !ok {
+		t.Errorf("expected trace stats of the eval node, got %v", task.ExecutionStats.NodeStats["eval2"])
 	}
-	dot := "digraph testTaskID {\nstream0 -> from1;\n}"
-	if ti.Dot != dot {
-		t.Fatalf("unexpected dot\ngot\n%s\nexp\n%s\n", ti.Dot, dot)
+	if !strings.Contains(task.Dot, `from1 -> eval2 [processed="3" slowest="true"];`) {
+		t.Errorf("expected the edge on the slowest path to be marked, got:\n%s", task.Dot)
 	}
 }
 
-func TestServer_EnableTask(t *testing.T) {
+func TestServer_EdgeOverflow(t *testing.T) {
 	s, cli := OpenDefaultServer()
 	defer s.Close()
 
-	id := "testTaskID"
-	ttype := client.StreamTask
-	dbrps := []client.DBRP{
-		{
+	// The endpoint never answers until the end of the test, so the httpPost node is stuck.
+	unblock := make(chan struct{})
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-unblock
+	}))
+	defer ts.Close()
+	defer close(unblock)
+
+	if _, err := cli.CreateTask(client.CreateTaskOptions{
+		ID:   "testEdgeOverflowTask",
+		Type: client.StreamTask,
+		DBRPs: []client.DBRP{{
 			Database:        "mydb",
 			RetentionPolicy: "myrp",
-		},
-		{
-			Database:        "otherdb",
-			RetentionPolicy: "default",
-		},
-	}
-	tick := `stream
+		}},
+		TICKscript: fmt.Sprintf(`stream
     |from()
         .measurement('test')
-`
-	task, err := cli.CreateTask(client.CreateTaskOptions{
-		ID:         id,
-		Type:       ttype,
-		DBRPs:      dbrps,
-		TICKscript: tick,
-		Status:     client.Disabled,
-	})
-	if err != nil {
-		t.Fatal(err)
-	}
-
-	_, err = cli.UpdateTask(task.Link, client.UpdateTaskOptions{
+    |httpPost('%s')
+        .edgeBuffer(2)
+        .edgeOverflow('drop-newest')
+`, ts.URL),
 		Status: client.Enabled,
-	})
-	if err != nil {
+	}); err != nil {
 		t.Fatal(err)
 	}
 
-	ti, err := cli.Task(task.Link, nil)
-	if err != nil {
-		t.Fatal(err)
+	var points string
+	for i := 0; i < 20; i++ {
+		points += fmt.Sprintf("test value=%d %010d\n", i, i)
 	}
+	v := url.Values{}
+	v.Add("precision", "s")
+	s.MustWrite("mydb", "myrp", points, v)
 
-	if ti.Error != "" {
-		t.Fatal(ti.Error)
-	}
-	if ti.ID != id {
-		t.Fatalf("unexpected id got %s exp %s", ti.ID, id)
+	// All points are collected by the edge of the stuck node,
+	// at most one point is processed and two are buffered, the rest are dropped.
+	var collected, dropped float64
+	for i := 0; i < 100 && (collected != 20 || dropped < 17); i++ {
+		r, err := http.Get("http://" + s.HTTPDService.Addr().String() + "/metrics")
+		if err != nil {
+			t.Fatal(err)
+		}
+		b, err := ioutil.ReadAll(r.Body)
+		r.Body.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, line := range strings.Split(string(b), "\n") {
+			if !strings.Contains(line, `child="http_post2"`) || !strings.Contains(line, `task="testEdgeOverflowTask"`) {
+				continue
+			}
+			fields := strings.Fields(line)
+			value, _ := strconv.ParseFloat(fields[len(fields)-1], 64)
+			switch {
+			case strings.HasPrefix(line, "kapacitor_edges_collected_total{"):
+				collected = value
+			case strings.HasPrefix(line, "kapacitor_edges_dropped_total{"):
+				dropped = value
+			}
+		}
+		time.Sleep(10 * time.Millisecond)
 	}
-	if ti.Type != client.StreamTask {
-		t.Fatalf("unexpected type got %v exp %v", ti.Type, client.StreamTask)
+	if collected != 20 || dropped < 17 {
+		t.Errorf("expected the edge of the stuck node to drop points: collected %v dropped %v", collected, dropped)
 	}
-	if ti.Status != client.Enabled {
-		t.Fatalf("unexpected status got %v exp %v", ti.Status, client.Enabled)
+}
+
+// newClusterConfig returns the config of a cluster member listening on a free port.
+func newClusterConfig(t *testing.T, name string, members ...string) *server.Config {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
 	}
-	if ti.Executing != true {
-		t.Fatalf("unexpected executing got %v exp %v", ti.Executing, true)
+	addr := l.Addr().String()
+	l.Close()
+
+	c := NewConfig()
+	c.HTTP.BindAddress = addr
+	c.Cluster.Enabled = true
+	c.Cluster.Name = name
+	c.Cluster.AdvertiseURL = "http://" + addr
+	c.Cluster.Members = members
+	c.Cluster.HeartbeatInterval = toml.Duration(50 * time.Millisecond)
+	c.Cluster.MemberTimeout = toml.Duration(500 * time.Millisecond)
+	return c
+}
+
+func TestServer_Cluster(t *testing.T) {
+	s1 := OpenServer(newClusterConfig(t, "a"))
+	defer s1.Close()
+	cli1 := Client(s1)
+	s2 := OpenServer(newClusterConfig(t, "b", s1.Config.Cluster.AdvertiseURL))
+	cli2 := Client(s2)
+	closed := false
+	defer func() {
+		if !closed {
+			s2.Close()
+		}
+	}()
+
+	// Tasks created on one member are replicated to the other and assigned to one of them.
+	const n = 8
+	for i := 0; i < n; i++ {
+		if _, err := cli2.CreateTask(client.CreateTaskOptions{
+			ID:   fmt.Sprintf("task%d", i),
+			Type: client.StreamTask,
+			DBRPs: []client.DBRP{{
+				Database:        "mydb",
+				RetentionPolicy: "myrp",
+			}},
+			TICKscript: "stream|from().measurement('test')",
+			Status:     client.Enabled,
+		}); err != nil {
+			t.Fatal(err)
+		}
 	}
-	if !reflect.DeepEqual(ti.DBRPs, dbrps) {
-		t.Fatalf("unexpected dbrps got %s exp %s", ti.DBRPs, dbrps)
+	owners := func(clis ...*client.Client) (map[string]*client.Client, error) {
+		owners := make(map[string]*client.Client)
+		for _, cli := range clis {
+			tasks, err := cli.ListTasks(nil)
+			if err != nil {
+				return nil, err
+			}
+			if len(tasks) != n {
+				return nil, fmt.Errorf("unexpected number of tasks: got %d exp %d", len(tasks), n)
+			}
+			for _, task := range tasks {
+				if !task.Executing {
+					continue
+				}
+				if _, ok := owners[task.ID]; ok {
+					return nil, fmt.Errorf("task %s is executing on several members", task.ID)
+				}
+				owners[task.ID] = cli
+			}
+		}
+		if len(owners) != n {
+			return nil, fmt.Errorf("unexpected number of executing tasks: got %d exp %d", len(owners), n)
+		}
+		return owners, nil
 	}
-	if ti.TICKscript != tick {
-		t.Fatalf("unexpected TICKscript got %s exp %s", ti.TICKscript, tick)
+	var assigned map[string]*client.Client
+	var err error
+	for i := 0; i < 100; i++ {
+		if assigned, err = owners(cli1, cli2); err == nil {
+			counts := make(map[*client.Client]int)
+			for _, cli := range assigned {
+				counts[cli]++
+			}
+			if counts[cli1] > 0 && counts[cli2] > 0 {
+				break
+			}
+			err = fmt.Errorf("expected the tasks to be spread over both members, got %d and %d", counts[cli1], counts[cli2])
+		}
+		time.Sleep(50 * time.Millisecond)
 	}
-	dot := `digraph testTaskID {
-graph [throughput="0.00 points/s"];
-
-stream0 [avg_exec_time_ns="0s" errors="0" working_cardinality="0" ];
-stream0 -> from1 [processed="0"];
-
-from1 [avg_exec_time_ns="0s" errors="0" working_cardinality="0" ];
-}`
-	if ti.Dot != dot {
-		t.Fatalf("unexpected dot\ngot\n%s\nexp\n%s\n", ti.Dot, dot)
+	if err != nil {
+		t.Fatal(err)
 	}
-}
 
-func TestServer_EnableTaskOnCreate(t *testing.T) {
-	s, cli := OpenDefaultServer()
-	defer s.Close()
+	// Writes to one member are forwarded to the members owning the tasks.
+	s1.MustWrite("mydb", "myrp", "test value=1 0000000000\ntest value=2 0000000001\n", url.Values{"precision": {"s"}})
+	for id, cli := range assigned {
+		var collected interface{}
+		for i := 0; i < 100 && collected != 2.0; i++ {
+			task, err := cli.Task(cli.TaskLink(id), nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			collected = task.ExecutionStats.NodeStats["from1"]["collected"]
+			time.Sleep(50 * time.Millisecond)
+		}
+		if collected != 2.0 {
+			t.Errorf("task %s: unexpected number of collected points: got %v exp 2", id, collected)
+		}
+	}
 
-	id := "testTaskID"
-	ttype := client.StreamTask
-	dbrps := []client.DBRP{
-		{
-			Database:        "mydb",
-			RetentionPolicy: "myrp",
-		},
-		{
-			Database:        "otherdb",
-			RetentionPolicy: "default",
+	// Handler specs are replicated.
+	if _, err := cli1.CreateTopicHandler(cli1.TopicHandlersLink("topic"), client.TopicHandlerOptions{
+		ID:   "handler",
+		Kind: "log",
+		Options: map[string]interface{}{
+			"path": filepath.Join(MustTempDir(), "alert.log"),
 		},
+	}); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 100; i++ {
+		if _, err = cli2.TopicHandler(cli2.TopicHandlerLink("topic", "handler")); err == nil {
+			break
+		}
+		time.Sleep(50 * time.Millisecond)
 	}
-	tick := `stream
-    |from()
-        .measurement('test')
-`
-	task, err := cli.CreateTask(client.CreateTaskOptions{
-		ID:         id,
-		Type:       ttype,
-		DBRPs:      dbrps,
-		TICKscript: tick,
-		Status:     client.Enabled,
-	})
 	if err != nil {
 		t.Fatal(err)
 	}
 
-	ti, err := cli.Task(task.Link, nil)
+	// The tasks of a member that dies are reassigned.
+	s2.Stop()
+	for i := 0; i < 100; i++ {
+		if _, err = owners(cli1); err == nil {
+			break
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
 	if err != nil {
 		t.Fatal(err)
 	}
 
-	if ti.Error != "" {
-		t.Fatal(ti.Error)
-	}
-	if ti.ID != id {
-		t.Fatalf("unexpected id got %s exp %s", ti.ID, id)
+	// A member that rejoins catches up on the updates and deletes it missed,
+	// without adding the deleted keys back.
+	if err := cli1.DeleteTask(cli1.TaskLink("task0")); err != nil {
+		t.Fatal(err)
 	}
-	if ti.Type != client.StreamTask {
-		t.Fatalf("unexpected type got %v exp %v", ti.Type, client.StreamTask)
+	const updated = "stream|from().measurement('updated')"
+	if _, err := cli1.UpdateTask(cli1.TaskLink("task1"), client.UpdateTaskOptions{TICKscript: updated}); err != nil {
+		t.Fatal(err)
 	}
-	if ti.Status != client.Enabled {
-		t.Fatalf("unexpected status got %v exp %v", ti.Status, client.Enabled)
+	s2.Start()
+	cli2 = Client(s2)
+	caughtUp := func(cli *client.Client) error {
+		tasks, err := cli.ListTasks(nil)
+		if err != nil {
+			return err
+		}
+		if len(tasks) != n-1 {
+			return fmt.Errorf("unexpected number of tasks: got %d exp %d", len(tasks), n-1)
+		}
+		for _, task := range tasks {
+			if task.ID == "task0" {
+				return errors.New("deleted task0 exists")
+			}
+			if task.ID == "task1" && !strings.Contains(task.TICKscript, "'updated'") {
+				return fmt.Errorf("task1 was not updated: %s", task.TICKscript)
+			}
+		}
+		return nil
 	}
-	if ti.Executing != true {
-		t.Fatalf("unexpected executing got %v exp %v", ti.Executing, true)
+	for i := 0; i < 100; i++ {
+		if err = caughtUp(cli2); err == nil {
+			break
+		}
+		time.Sleep(50 * time.Millisecond)
 	}
-	if !reflect.DeepEqual(ti.DBRPs, dbrps) {
-		t.Fatalf("unexpected dbrps got %s exp %s", ti.DBRPs, dbrps)
+	if err != nil {
+		t.Fatal(err)
 	}
-	if ti.TICKscript != tick {
-		t.Fatalf("unexpected TICKscript got %s exp %s", ti.TICKscript, tick)
+	// Give the first member time to merge the stores of the rejoined member.
+	time.Sleep(500 * time.Millisecond)
+	if err := caughtUp(cli1); err != nil {
+		t.Fatal(err)
 	}
-	dot := `digraph testTaskID {
-graph [throughput="0.00 points/s"];
-
-stream0 [avg_exec_time_ns="0s" errors="0" working_cardinality="0" ];
-stream0 -> from1 [processed="0"];
+	s2.Close()
+	closed = true
+}
 
-from1 [avg_exec_time_ns="0s" errors="0" working_cardinality="0" ];
-}`
-	if ti.Dot != dot {
-		t.Fatalf("unexpected dot\ngot\n%s\nexp\n%s\n", ti.Dot, dot)
+func newHAConfig(t *testing.T, name, path string) *server.Config {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
 	}
+	addr := l.Addr().String()
+	l.Close()
+
+	c := NewConfig()
+	c.HTTP.BindAddress = addr
+	c.HA.Enabled = true
+	c.HA.Name = name
+	c.HA.AdvertiseURL = "http://" + addr
+	c.HA.Path = path
+	c.HA.RenewInterval = toml.Duration(50 * time.Millisecond)
+	c.HA.LeaseDuration = toml.Duration(300 * time.Millisecond)
+	return c
 }
 
-func TestServer_DisableTask(t *testing.T) {
-	s, cli := OpenDefaultServer()
-	defer s.Close()
+func TestServer_HA(t *testing.T) {
+	path := filepath.Join(MustTempDir(), "lease.db")
+	c1 := newHAConfig(t, "a", path)
+	c1.UserStore.Enabled = true
+	s1 := OpenServer(c1)
+	closed := false
+	defer func() {
+		if !closed {
+			s1.Close()
+		}
+	}()
+	cli1 := Client(s1)
+	c2 := newHAConfig(t, "b", path)
+	c2.UserStore.Enabled = true
+	s2 := OpenServer(c2)
+	defer s2.Close()
+	cli2 := Client(s2)
+
+	role := func(s *Server) string {
+		resp, err := http.Get(s.URL() + "/ping")
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		return resp.Header.Get("X-Kapacitor-Role")
+	}
+	if got, exp := role(s1), "leader"; got != exp {
+		t.Fatalf("unexpected role of s1: got %q exp %q", got, exp)
+	}
+	if got, exp := role(s2), "follower"; got != exp {
+		t.Fatalf("unexpected role of s2: got %q exp %q", got, exp)
+	}
+	// The leader stat is exported as a gauge.
+	resp, err := http.Get("http://" + s1.HTTPDService.Addr().String() + "/metrics")
+	if err != nil {
+		t.Fatal(err)
+	}
+	metrics, err := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(metrics), "# TYPE kapacitor_ha_leader gauge\n") {
+		t.Errorf("expected the leader gauge in the metrics:\n%s", metrics)
+	}
+	// A restore would bypass the replication to the followers.
+	if _, err := cli1.Restore(bytes.NewReader(nil)); err == nil || !strings.Contains(err.Error(), "cannot restore a backup while the cluster or ha service is enabled") {
+		t.Errorf("expected error restoring a backup with ha enabled, got %v", err)
+	}
 
-	id := "testTaskID"
-	ttype := client.StreamTask
-	dbrps := []client.DBRP{
-		{
+	// Tasks created on the leader are copied to the follower, but only run on the leader.
+	if _, err := cli1.CreateTask(client.CreateTaskOptions{
+		ID:   "testTaskID",
+		Type: client.StreamTask,
+		DBRPs: []client.DBRP{{
 			Database:        "mydb",
 			RetentionPolicy: "myrp",
-		},
-		{
-			Database:        "otherdb",
-			RetentionPolicy: "default",
-		},
+		}},
+		TICKscript: "stream|from().measurement('test')",
+		Status:     client.Enabled,
+	}); err != nil {
+		t.Fatal(err)
+	}
+	var task client.Task
+	for i := 0; i < 100; i++ {
+		if task, err = cli2.Task(cli2.TaskLink("testTaskID"), nil); err == nil {
+			break
+		}
+		time.Sleep(50 * time.Millisecond)
 	}
-	tick := `stream
-    |from()
-        .measurement('test')
-`
-	task, err := cli.CreateTask(client.CreateTaskOptions{
-		ID:         id,
-		Type:       ttype,
-		DBRPs:      dbrps,
-		TICKscript: tick,
-		Status:     client.Disabled,
-	})
 	if err != nil {
 		t.Fatal(err)
 	}
+	if task.Executing {
+		t.Error("expected the task not to be executing on the follower")
+	}
+	if task, err = cli1.Task(cli1.TaskLink("testTaskID"), nil); err != nil {
+		t.Fatal(err)
+	} else if !task.Executing {
+		t.Error("expected the task to be executing on the leader")
+	}
 
-	_, err = cli.UpdateTask(task.Link, client.UpdateTaskOptions{
-		Status: client.Enabled,
-	})
-	if err != nil {
+	// Config overrides set on the leader are applied by the follower.
+	if err := cli1.ConfigUpdate(cli1.ConfigElementLink("smtp", ""), client.ConfigUpdateAction{
+		Set: map[string]interface{}{
+			"global": true,
+		},
+	}); err != nil {
 		t.Fatal(err)
 	}
+	for i := 0; i < 100 && !s2.TaskMaster.SMTPService.Global(); i++ {
+		time.Sleep(50 * time.Millisecond)
+	}
+	if !s2.TaskMaster.SMTPService.Global() {
+		t.Error("expected the config override to be applied on the follower")
+	}
 
-	_, err = cli.UpdateTask(task.Link, client.UpdateTaskOptions{
-		Status: client.Disabled,
-	})
+	// Users created on the leader are copied to the follower.
+	if _, err := cli1.CreateUser(client.CreateUserOptions{
+		Name:     "bob",
+		Password: "bob's secure password",
+	}); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 100; i++ {
+		if _, err = cli2.User(cli2.UserLink("bob")); err == nil {
+			break
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
 	if err != nil {
 		t.Fatal(err)
 	}
 
-	ti, err := cli.Task(task.Link, nil)
+	// Followers reject changes, which the next copy of the stores of the leader would overwrite.
+	if _, err := cli2.UpdateTask(cli2.TaskLink("testTaskID"), client.UpdateTaskOptions{Status: client.Disabled}); err == nil {
+		t.Error("expected the follower to reject the update")
+	}
+	req, err := http.NewRequest("DELETE", s2.URL()+"/tasks/testTaskID", nil)
 	if err != nil {
 		t.Fatal(err)
 	}
-
-	if ti.Error != "" {
-		t.Fatal(ti.Error)
+	resp, err = http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
 	}
-	if ti.ID != id {
-		t.Fatalf("unexpected id got %s exp %s", ti.ID, id)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusServiceUnavailable {
+		t.Errorf("unexpected status of follower delete: got %d exp %d", resp.StatusCode, http.StatusServiceUnavailable)
 	}
-	if ti.Type != client.StreamTask {
-		t.Fatalf("unexpected type got %v exp %v", ti.Type, client.StreamTask)
+	if got, exp := resp.Header.Get("X-Kapacitor-Leader"), s1.Config.HA.AdvertiseURL; got != exp {
+		t.Errorf("unexpected leader of follower delete: got %q exp %q", got, exp)
 	}
-	if ti.Status != client.Disabled {
-		t.Fatalf("unexpected status got %v exp %v", ti.Status, client.Disabled)
+	if task, err = cli2.Task(cli2.TaskLink("testTaskID"), nil); err != nil {
+		t.Fatal(err)
+	} else if task.Status != client.Enabled {
+		t.Errorf("unexpected status of the task on the follower: %v", task.Status)
 	}
-	if !reflect.DeepEqual(ti.DBRPs, dbrps) {
-		t.Fatalf("unexpected dbrps got %s exp %s", ti.DBRPs, dbrps)
+
+	// The follower takes over once the leader dies.
+	s1.Close()
+	closed = true
+	for i := 0; i < 100; i++ {
+		if task, err = cli2.Task(cli2.TaskLink("testTaskID"), nil); err != nil {
+			t.Fatal(err)
+		}
+		if task.Executing {
+			break
+		}
+		time.Sleep(50 * time.Millisecond)
 	}
-	if ti.TICKscript != tick {
-		t.Fatalf("unexpected TICKscript got %s exp %s", ti.TICKscript, tick)
+	if !task.Executing {
+		t.Error("expected the task to be executing on the new leader")
 	}
-	dot := "digraph testTaskID {\nstream0 -> from1;\n}"
-	if ti.Dot != dot {
-		t.Fatalf("unexpected dot\ngot\n%s\nexp\n%s\n", ti.Dot, dot)
+	if got, exp := role(s2), "leader"; got != exp {
+		t.Fatalf("unexpected role of s2: got %q exp %q", got, exp)
 	}
 }
 
-func TestServer_DeleteTask(t *testing.T) {
-	s, cli := OpenDefaultServer()
+func TestServer_Authenticate_Fail(t *testing.T) {
+	conf := NewConfig()
+	conf.HTTP.AuthEnabled = true
+	s := OpenServer(conf)
+	cli, err := client.New(client.Config{
+		URL: s.URL(),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
 	defer s.Close()
-
+	_, _, err = cli.Ping()
+	if err == nil {
+		t.Error("expected authentication error")
+	} else if exp, got := "unable to parse authentication credentials", err.Error(); got != exp {
+		t.Errorf("unexpected error message: got %q exp %q", got, exp)
+	}
+}
+
+func TestServer_Authenticate_User(t *testing.T) {
+	conf := NewConfig()
+	conf.HTTP.AuthEnabled = true
+	s := OpenServer(conf)
+	cli, err := client.New(client.Config{
+		URL: s.URL(),
+		Credentials: &client.Credentials{
+			Method:   client.UserAuthentication,
+			Username: "bob",
+			Password: "bob's secure password",
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	_, version, err := cli.Ping()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if version != "testServer" {
+		t.Fatal("unexpected version", version)
+	}
+}
+
+func TestServer_Authenticate_Bearer_Fail(t *testing.T) {
+	secret := "secret"
+	// Create a new token object, specifying signing method and the claims
+	// you would like it to contain.
+	token := jwt.NewWithClaims(jwt.SigningMethodHS512, jwt.MapClaims{
+		"username": "bob",
+		"exp":      time.Now().Add(10 * time.Second).Unix(),
+	})
+
+	// Sign and get the complete encoded token as a string using the secret
+	tokenString, err := token.SignedString([]byte(secret))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	conf := NewConfig()
+	conf.HTTP.AuthEnabled = true
+	// Use a different secret so the token is invalid
+	conf.HTTP.SharedSecret = secret + "extra secret"
+	s := OpenServer(conf)
+	cli, err := client.New(client.Config{
+		URL: s.URL(),
+		Credentials: &client.Credentials{
+			Method: client.BearerAuthentication,
+			Token:  tokenString,
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	_, _, err = cli.Ping()
+	if err == nil {
+		t.Error("expected authentication error")
+	} else if exp, got := "invalid token: signature is invalid", err.Error(); got != exp {
+		t.Errorf("unexpected error message: got %q exp %q", got, exp)
+	}
+}
+
+func TestServer_Authenticate_Bearer_Expired(t *testing.T) {
+	secret := "secret"
+	// Create a new token object, specifying signing method and the claims
+	// you would like it to contain.
+	token := jwt.NewWithClaims(jwt.SigningMethodHS512, jwt.MapClaims{
+		"username": "bob",
+		"exp":      time.Now().Add(-10 * time.Second).Unix(),
+	})
+
+	// Sign and get the complete encoded token as a string using the secret
+	tokenString, err := token.SignedString([]byte(secret))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	conf := NewConfig()
+	conf.HTTP.AuthEnabled = true
+	conf.HTTP.SharedSecret = secret
+	s := OpenServer(conf)
+	cli, err := client.New(client.Config{
+		URL: s.URL(),
+		Credentials: &client.Credentials{
+			Method: client.BearerAuthentication,
+			Token:  tokenString,
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	_, _, err = cli.Ping()
+	if err == nil {
+		t.Error("expected authentication error")
+	} else if exp, got := "invalid token: Token is expired", err.Error(); got != exp {
+		t.Errorf("unexpected error message: got %q exp %q", got, exp)
+	}
+}
+
+func TestServer_Authenticate_Bearer(t *testing.T) {
+	secret := "secret"
+	// Create a new token object, specifying signing method and the claims
+	// you would like it to contain.
+	token := jwt.NewWithClaims(jwt.SigningMethodHS512, jwt.MapClaims{
+		"username": "bob",
+		"exp":      time.Now().Add(10 * time.Second).Unix(),
+	})
+
+	// Sign and get the complete encoded token as a string using the secret
+	tokenString, err := token.SignedString([]byte(secret))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	conf := NewConfig()
+	conf.HTTP.AuthEnabled = true
+	conf.HTTP.SharedSecret = secret
+	s := OpenServer(conf)
+	cli, err := client.New(client.Config{
+		URL: s.URL(),
+		Credentials: &client.Credentials{
+			Method: client.BearerAuthentication,
+			Token:  tokenString,
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	_, version, err := cli.Ping()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if version != "testServer" {
+		t.Fatal("unexpected version", version)
+	}
+}
+
+func TestServer_Authenticate_OIDC(t *testing.T) {
+	key, err := rsa.GenerateKey(crand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	jwks := fmt.Sprintf(`{"keys":[{"kty":"RSA","kid":"test","use":"sig","alg":"RS256","n":%q,"e":%q}]}`,
+		base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+		base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+	)
+	jwksFile := filepath.Join(MustTempDir(), "jwks.json")
+	if err := ioutil.WriteFile(jwksFile, []byte(jwks), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	conf := NewConfig()
+	conf.HTTP.AuthEnabled = true
+	conf.HTTP.OIDC.Enabled = true
+	conf.HTTP.OIDC.JWKSFile = jwksFile
+	conf.HTTP.OIDC.Issuer = "https://sso.example.com"
+	conf.HTTP.OIDC.Audience = "kapacitor"
+	conf.HTTP.OIDC.ClaimMappings = []httpd.ClaimMapping{
+		{Claim: "groups", Value: "monitoring", API: "/ping", Privileges: []string{"read"}},
+		{Claim: "groups", Value: "monitoring", API: "/tasks", Privileges: []string{"read"}},
+	}
+	s := OpenServer(conf)
+	defer s.Close()
+
+	newClient := func(claims jwt.MapClaims) *client.Client {
+		token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+		token.Header["kid"] = "test"
+		tokenString, err := token.SignedString(key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		cli, err := client.New(client.Config{
+			URL: s.URL(),
+			Credentials: &client.Credentials{
+				Method: client.BearerAuthentication,
+				Token:  tokenString,
+			},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return cli
+	}
+	exp := time.Now().Add(time.Minute).Unix()
+
+	cli := newClient(jwt.MapClaims{
+		"iss":    "https://sso.example.com",
+		"aud":    "kapacitor",
+		"sub":    "bob",
+		"exp":    exp,
+		"groups": []string{"monitoring"},
+	})
+	if _, _, err := cli.Ping(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := cli.ListTasks(nil); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := cli.CreateTask(client.CreateTaskOptions{
+		ID:         "testOIDCTask",
+		Type:       client.StreamTask,
+		DBRPs:      []client.DBRP{{Database: "mydb", RetentionPolicy: "myrp"}},
+		TICKscript: "stream\n    |from()\n",
+	}); err == nil {
+		t.Error("expected error creating task without write privilege")
+	}
+
+	if _, _, err := newClient(jwt.MapClaims{
+		"iss":    "https://sso.example.com",
+		"aud":    "other",
+		"sub":    "bob",
+		"exp":    exp,
+		"groups": []string{"monitoring"},
+	}).Ping(); err == nil {
+		t.Error("expected authentication error with wrong audience")
+	}
+	if _, _, err := newClient(jwt.MapClaims{
+		"iss":    "https://sso.example.com",
+		"aud":    "kapacitor",
+		"sub":    "bob",
+		"exp":    exp,
+		"groups": []string{"other"},
+	}).Ping(); err == nil {
+		t.Error("expected authorization error without mapped group")
+	}
+}
+
+func TestServer_UserStore(t *testing.T) {
+	conf := NewConfig()
+	conf.HTTP.AuthEnabled = true
+	conf.UserStore.Enabled = true
+	conf.UserStore.BcryptCost = bcrypt.MinCost
+	conf.UserStore.AdminUsername = "admin"
+	conf.UserStore.AdminPassword = "admin password"
+	conf.Storage.MigrateTargets = []string{"bolt://" + filepath.Join(MustTempDir(), "migrated.db")}
+	conf.Storage.MaxRestoreSize = 1024
+	s := OpenServer(conf)
+	defer s.Close()
+	newClient := func(username, password string) *client.Client {
+		cli, err := client.New(client.Config{
+			URL: s.URL(),
+			Credentials: &client.Credentials{
+				Method:   client.UserAuthentication,
+				Username: username,
+				Password: password,
+			},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return cli
+	}
+
+	if _, _, err := newClient("admin", "wrong password").Ping(); err == nil {
+		t.Error("expected authentication error with wrong password")
+	}
+	admin := newClient("admin", "admin password")
+	user, err := admin.CreateUser(client.CreateUserOptions{
+		Name:     "bob",
+		Password: "bob's password",
+		Grants: []client.UserGrant{
+			{API: "/ping", Privileges: []client.Privilege{client.ReadPrivilege}},
+			{API: "/tasks", Privileges: []client.Privilege{client.ReadPrivilege, client.WritePrivilege}},
+			{Database: "mydb", Privileges: []client.Privilege{client.WritePrivilege}},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	exp := client.User{
+		Link: client.Link{Relation: client.Self, Href: "/kapacitor/v1/users/bob"},
+		Name: "bob",
+		Grants: []client.UserGrant{
+			{API: "/ping", Privileges: []client.Privilege{client.ReadPrivilege}},
+			{API: "/tasks", Privileges: []client.Privilege{client.ReadPrivilege, client.WritePrivilege}},
+			{Database: "mydb", Privileges: []client.Privilege{client.WritePrivilege}},
+		},
+	}
+	if !reflect.DeepEqual(user, exp) {
+		t.Errorf("unexpected user:\ngot\n%+v\nexp\n%+v", user, exp)
+	}
+	if _, err := admin.CreateUser(client.CreateUserOptions{Name: "bob", Password: "other"}); err == nil {
+		t.Error("expected error creating existing user")
+	}
+
+	bob := newClient("bob", "bob's password")
+	if _, _, err := bob.Ping(); err != nil {
+		t.Fatal(err)
+	}
+	task, err := bob.CreateTask(client.CreateTaskOptions{
+		ID:         "testUserStoreTask",
+		Type:       client.StreamTask,
+		DBRPs:      []client.DBRP{{Database: "mydb", RetentionPolicy: "myrp"}},
+		TICKscript: "stream\n    |from()\n",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := bob.DeleteTask(task.Link); err == nil {
+		t.Error("expected error deleting task without delete privilege")
+	}
+	if _, err := bob.ListUsers(nil); err == nil {
+		t.Error("expected error listing users without privilege")
+	}
+
+	user, err = admin.UpdateUser(admin.UserLink("bob"), client.UpdateUserOptions{
+		Password: "bob's new password",
+		Grants: []client.UserGrant{
+			{API: "/", Privileges: []client.Privilege{client.AllPrivileges}},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := bob.Ping(); err == nil {
+		t.Error("expected authentication error with old password")
+	}
+	bob = newClient("bob", "bob's new password")
+	if err := bob.DeleteTask(task.Link); err != nil {
+		t.Fatal(err)
+	}
+	users, err := bob.ListUsers(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if exp, got := 2, len(users); exp != got {
+		t.Errorf("unexpected number of users: got %d exp %d", got, exp)
+	}
+
+	// Privileges on the users API do not allow managing users without being an admin.
+	forbidden := func(err error) {
+		if err == nil || !strings.Contains(err.Error(), "only admin users can manage users") {
+			t.Errorf("expected forbidden error, got %v", err)
+		}
+	}
+	_, err = bob.CreateUser(client.CreateUserOptions{Name: "mallory", Password: "mallory's password", Admin: true})
+	forbidden(err)
+	isAdmin := true
+	_, err = bob.UpdateUser(bob.UserLink("bob"), client.UpdateUserOptions{Admin: &isAdmin})
+	forbidden(err)
+	_, err = bob.UpdateUser(bob.UserLink("admin"), client.UpdateUserOptions{Password: "taken over"})
+	forbidden(err)
+	forbidden(bob.DeleteUser(bob.UserLink("admin")))
+	// The stores hold the users, so only admins can migrate them.
+	if _, err := bob.MigrateStorage(client.StorageMigrateOptions{To: conf.Storage.MigrateTargets[0]}); err == nil || !strings.Contains(err.Error(), "only admin users can migrate storage") {
+		t.Errorf("expected forbidden error migrating storage, got %v", err)
+	}
+	if _, err := admin.MigrateStorage(client.StorageMigrateOptions{To: conf.Storage.MigrateTargets[0]}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := bob.Restore(bytes.NewReader(nil)); err == nil || !strings.Contains(err.Error(), "only admin users can restore storage") {
+		t.Errorf("expected forbidden error restoring storage, got %v", err)
+	}
+	if _, err := admin.Restore(bytes.NewReader(make([]byte, conf.Storage.MaxRestoreSize+1))); err == nil || !strings.Contains(err.Error(), "larger than the storage max-restore-size") {
+		t.Errorf("expected error restoring a backup larger than max-restore-size, got %v", err)
+	}
+	req, err := http.NewRequest("DELETE", s.URL()+"/users/admin", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.SetBasicAuth("bob", "bob's new password")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if exp, got := http.StatusForbidden, resp.StatusCode; exp != got {
+		t.Errorf("unexpected status deleting user without being an admin: got %d exp %d", got, exp)
+	}
+	if _, err := bob.UpdateUser(bob.UserLink("bob"), client.UpdateUserOptions{Password: "bob's newest password"}); err != nil {
+		t.Fatal(err)
+	}
+	bob = newClient("bob", "bob's newest password")
+	if _, _, err := bob.Ping(); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := admin.DeleteUser(admin.UserLink("bob")); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := bob.Ping(); err == nil {
+		t.Error("expected authentication error for deleted user")
+	}
+}
+
+func TestServer_Audit(t *testing.T) {
+	conf := NewConfig()
+	conf.HTTP.AuthEnabled = true
+	conf.UserStore.Enabled = true
+	conf.UserStore.BcryptCost = bcrypt.MinCost
+	conf.UserStore.AdminUsername = "admin"
+	conf.UserStore.AdminPassword = "admin password"
+	conf.Audit.Enabled = true
+	conf.Audit.Path = filepath.Join(MustTempDir(), "audit.log")
+	s := OpenServer(conf)
+	defer s.Close()
+	cli, err := client.New(client.Config{
+		URL: s.URL(),
+		Credentials: &client.Credentials{
+			Method:   client.UserAuthentication,
+			Username: "admin",
+			Password: "admin password",
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	start := time.Now()
+	task, err := cli.CreateTask(client.CreateTaskOptions{
+		ID:         "testAuditTask",
+		Type:       client.StreamTask,
+		DBRPs:      []client.DBRP{{Database: "mydb", RetentionPolicy: "myrp"}},
+		TICKscript: "stream\n    |from()\n",
+		Status:     client.Enabled,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Processing points changes the stats of the task but not the task itself.
+	if _, err := s.Write("mydb", "myrp", "cpu value=1 0000000000", url.Values{"u": {"admin"}, "p": {"admin password"}}); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; ; i++ {
+		ti, err := cli.Task(task.Link, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if ti.ExecutionStats.NodeStats["stream0"]["emitted"] == 1.0 {
+			break
+		}
+		if i == 100 {
+			t.Fatal("timed out waiting for task to process point")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if _, err := cli.UpdateTask(task.Link, client.UpdateTaskOptions{Status: client.Disabled}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := cli.UpdateTask(task.Link, client.UpdateTaskOptions{TICKscript: "stream\n    |from()\n        .measurement('cpu')\n"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := cli.DeleteTask(task.Link); err != nil {
+		t.Fatal(err)
+	}
+	// Reads are not recorded.
+	if _, err := cli.ListTasks(nil); err != nil {
+		t.Fatal(err)
+	}
+
+	records, err := cli.ListAuditRecords(&client.ListAuditRecordsOptions{
+		Start:    start.Add(-time.Second),
+		User:     "admin",
+		Resource: "/tasks",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	type record struct {
+		Resource string
+		Action   string
+		Method   string
+		Status   int
+		Before   bool
+		After    bool
+	}
+	exp := []record{
+		{Resource: "/tasks/testAuditTask", Action: "delete", Method: "DELETE", Status: http.StatusNoContent, Before: true},
+		{Resource: "/tasks/testAuditTask", Action: "update", Method: "PATCH", Status: http.StatusOK, Before: true, After: true},
+		{Resource: "/tasks/testAuditTask", Action: "disable", Method: "PATCH", Status: http.StatusOK, Before: true, After: true},
+		{Resource: "/tasks", Action: "create", Method: "POST", Status: http.StatusOK, After: true},
+	}
+	got := make([]record, len(records))
+	for i, r := range records {
+		if r.User != "admin" {
+			t.Errorf("unexpected user of record %d: got %q exp %q", i, r.User, "admin")
+		}
+		got[i] = record{
+			Resource: r.Resource,
+			Action:   r.Action,
+			Method:   r.Method,
+			Status:   r.Status,
+			Before:   r.Before != "",
+			After:    r.After != "",
+		}
+	}
+	if !reflect.DeepEqual(got, exp) {
+		t.Fatalf("unexpected audit records:\ngot %+v\nexp %+v", got, exp)
+	}
+	if records[1].Before == records[1].After {
+		t.Error("expected digest to change with update")
+	}
+	// The digest after each change matches the digest before the next change,
+	// even though the task executed in between.
+	for i := 0; i < len(records)-1; i++ {
+		if records[i].Before != records[i+1].After {
+			t.Errorf("digest before %s does not match digest after %s: %s != %s", records[i].Action, records[i+1].Action, records[i].Before, records[i+1].After)
+		}
+	}
+
+	records, err = cli.ListAuditRecords(&client.ListAuditRecordsOptions{User: "bob"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 0 {
+		t.Errorf("expected no records for user bob, got %d", len(records))
+	}
+	records, err = cli.ListAuditRecords(&client.ListAuditRecordsOptions{Stop: start.Add(-time.Second)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 0 {
+		t.Errorf("expected no records before start, got %d", len(records))
+	}
+}
+
+func TestServer_LogLevel(t *testing.T) {
+	s, cli := OpenDefaultServer()
+	defer s.Close()
+
+	testCases := []struct {
+		opt client.LogLevelOptions
+		ok  bool
+	}{
+		{opt: client.LogLevelOptions{Level: "info"}, ok: true},
+		{opt: client.LogLevelOptions{Level: "debug", Subsystem: "udf"}, ok: true},
+		{opt: client.LogLevelOptions{Level: "debug", Task: "cpu_alert"}, ok: true},
+		{opt: client.LogLevelOptions{Level: "default", Task: "cpu_alert"}, ok: true},
+		{opt: client.LogLevelOptions{Level: "default"}},
+		{opt: client.LogLevelOptions{Level: "verbose", Subsystem: "udf"}},
+		{opt: client.LogLevelOptions{Level: "debug", Subsystem: "udf", Task: "cpu_alert"}},
+	}
+	for _, tc := range testCases {
+		err := cli.SetLogLevel(tc.opt)
+		if tc.ok && err != nil {
+			t.Errorf("unexpected error setting level %+v: %v", tc.opt, err)
+		} else if !tc.ok && err == nil {
+			t.Errorf("expected error setting level %+v", tc.opt)
+		}
+	}
+}
+
+func TestServer_Logs(t *testing.T) {
+	s, cli := OpenDefaultServer()
+	defer s.Close()
+
+	id := "testLogsTask"
+	r, err := cli.Logs(map[string]string{"task": id})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+
+	if _, err := cli.CreateTask(client.CreateTaskOptions{
+		ID:   id,
+		Type: client.StreamTask,
+		DBRPs: []client.DBRP{{
+			Database:        "mydb",
+			RetentionPolicy: "myrp",
+		}},
+		TICKscript: `stream
+    |from()
+        .measurement('test')
+`,
+		Status: client.Enabled,
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	lines := make(chan map[string]interface{})
+	go func() {
+		defer close(lines)
+		dec := json.NewDecoder(r)
+		for {
+			var line map[string]interface{}
+			if err := dec.Decode(&line); err != nil {
+				return
+			}
+			lines <- line
+		}
+	}()
+	timeout := time.After(10 * time.Second)
+	for {
+		select {
+		case line, ok := <-lines:
+			if !ok {
+				t.Fatal("log stream ended")
+			}
+			if got := line["task"]; got != id {
+				t.Fatalf("unexpected task of streamed line: got %v exp %s", got, id)
+			}
+			if line["msg"] == "started task" {
+				return
+			}
+		case <-timeout:
+			t.Fatal("timed out waiting for started task log line")
+		}
+	}
+}
+
+func TestServer_CreateTask(t *testing.T) {
+	s, cli := OpenDefaultServer()
+	defer s.Close()
+
+	id := "testTaskID"
+	ttype := client.StreamTask
+	dbrps := []client.DBRP{
+		{
+			Database:        "mydb",
+			RetentionPolicy: "myrp",
+		},
+		{
+			Database:        "otherdb",
+			RetentionPolicy: "default",
+		},
+	}
+	tick := `stream
+    |from()
+        .measurement('test')
+`
+	task, err := cli.CreateTask(client.CreateTaskOptions{
+		ID:         id,
+		Type:       ttype,
+		DBRPs:      dbrps,
+		TICKscript: tick,
+		Status:     client.Disabled,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ti, err := cli.Task(task.Link, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if ti.Error != "" {
+		t.Fatal(ti.Error)
+	}
+	if ti.ID != id {
+		t.Fatalf("unexpected id got %s exp %s", ti.ID, id)
+	}
+	if ti.Type != client.StreamTask {
+		t.Fatalf("unexpected type got %v exp %v", ti.Type, client.StreamTask)
+	}
+	if ti.Status != client.Disabled {
+		t.Fatalf("unexpected status got %v exp %v", ti.Status, client.Disabled)
+	}
+	if !reflect.DeepEqual(ti.DBRPs, dbrps) {
+		t.Fatalf("unexpected dbrps got %s exp %s", ti.DBRPs, dbrps)
+	}
+	if ti.TICKscript != tick {
+		t.Fatalf("unexpected TICKscript got %s exp %s", ti.TICKscript, tick)
+	}
+	dot := "digraph testTaskID {\nstream0 -> from1;\n}"
+	if ti.Dot != dot {
+		t.Fatalf("unexpected dot\ngot\n%s\nexp\n%s\n", ti.Dot, dot)
+	}
+}
+
+func TestServer_EnableTask(t *testing.T) {
+	s, cli := OpenDefaultServer()
+	defer s.Close()
+
+	id := "testTaskID"
+	ttype := client.StreamTask
+	dbrps := []client.DBRP{
+		{
+			Database:        "mydb",
+			RetentionPolicy: "myrp",
+		},
+		{
+			Database:        "otherdb",
+			RetentionPolicy: "default",
+		},
+	}
+	tick := `stream
+    |from()
+        .measurement('test')
+`
+	task, err := cli.CreateTask(client.CreateTaskOptions{
+		ID:         id,
+		Type:       ttype,
+		DBRPs:      dbrps,
+		TICKscript: tick,
+		Status:     client.Disabled,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = cli.UpdateTask(task.Link, client.UpdateTaskOptions{
+		Status: client.Enabled,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ti, err := cli.Task(task.Link, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if ti.Error != "" {
+		t.Fatal(ti.Error)
+	}
+	if ti.ID != id {
+		t.Fatalf("unexpected id got %s exp %s", ti.ID, id)
+	}
+	if ti.Type != client.StreamTask {
+		t.Fatalf("unexpected type got %v exp %v", ti.Type, client.StreamTask)
+	}
+	if ti.Status != client.Enabled {
+		t.Fatalf("unexpected status got %v exp %v", ti.Status, client.Enabled)
+	}
+	if ti.Executing != true {
+		t.Fatalf("unexpected executing got %v exp %v", ti.Executing, true)
+	}
+	if !reflect.DeepEqual(ti.DBRPs, dbrps) {
+		t.Fatalf("unexpected dbrps got %s exp %s", ti.DBRPs, dbrps)
+	}
+	if ti.TICKscript != tick {
+		t.Fatalf("unexpected TICKscript got %s exp %s", ti.TICKscript, tick)
+	}
+	dot := `digraph testTaskID {
+graph [throughput="0.00 points/s"];
+
+stream0 [avg_exec_time_ns="0s" errors="0" working_cardinality="0" ];
+stream0 -> from1 [processed="0"];
+
+from1 [avg_exec_time_ns="0s" errors="0" working_cardinality="0" ];
+}`
+	if ti.Dot != dot {
+		t.Fatalf("unexpected dot\ngot\n%s\nexp\n%s\n", ti.Dot, dot)
+	}
+}
+
+func TestServer_EnableTaskOnCreate(t *testing.T) {
+	s, cli := OpenDefaultServer()
+	defer s.Close()
+
+	id := "testTaskID"
+	ttype := client.StreamTask
+	dbrps := []client.DBRP{
+		{
+			Database:        "mydb",
+			RetentionPolicy: "myrp",
+		},
+		{
+			Database:        "otherdb",
+			RetentionPolicy: "default",
+		},
+	}
+	tick := `stream
+    |from()
+        .measurement('test')
+`
+	task, err := cli.CreateTask(client.CreateTaskOptions{
+		ID:         id,
+		Type:       ttype,
+		DBRPs:      dbrps,
+		TICKscript: tick,
+		Status:     client.Enabled,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ti, err := cli.Task(task.Link, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if ti.Error != "" {
+		t.Fatal(ti.Error)
+	}
+	if ti.ID != id {
+		t.Fatalf("unexpected id got %s exp %s", ti.ID, id)
+	}
+	if ti.Type != client.StreamTask {
+		t.Fatalf("unexpected type got %v exp %v", ti.Type, client.StreamTask)
+	}
+	if ti.Status != client.Enabled {
+		t.Fatalf("unexpected status got %v exp %v", ti.Status, client.Enabled)
+	}
+	if ti.Executing != true {
+		t.Fatalf("unexpected executing got %v exp %v", ti.Executing, true)
+	}
+	if !reflect.DeepEqual(ti.DBRPs, dbrps) {
+		t.Fatalf("unexpected dbrps got %s exp %s", ti.DBRPs, dbrps)
+	}
+	if ti.TICKscript != tick {
+		t.Fatalf("unexpected TICKscript got %s exp %s", ti.TICKscript, tick)
+	}
+	dot := `digraph testTaskID {
+graph [throughput="0.00 points/s"];
+
+stream0 [avg_exec_time_ns="0s" errors="0" working_cardinality="0" ];
+stream0 -> from1 [processed="0"];
+
+from1 [avg_exec_time_ns="0s" errors="0" working_cardinality="0" ];
+}`
+	if ti.Dot != dot {
+		t.Fatalf("unexpected dot\ngot\n%s\nexp\n%s\n", ti.Dot, dot)
+	}
+}
+
+func TestServer_DisableTask(t *testing.T) {
+	s, cli := OpenDefaultServer()
+	defer s.Close()
+
+	id := "testTaskID"
+	ttype := client.StreamTask
+	dbrps := []client.DBRP{
+		{
+			Database:        "mydb",
+			RetentionPolicy: "myrp",
+		},
+		{
+			Database:        "otherdb",
+			RetentionPolicy: "default",
+		},
+	}
+	tick := `stream
+    |from()
+        .measurement('test')
+`
+	task, err := cli.CreateTask(client.CreateTaskOptions{
+		ID:         id,
+		Type:       ttype,
+		DBRPs:      dbrps,
+		TICKscript: tick,
+		Status:     client.Disabled,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = cli.UpdateTask(task.Link, client.UpdateTaskOptions{
+		Status: client.Enabled,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = cli.UpdateTask(task.Link, client.UpdateTaskOptions{
+		Status: client.Disabled,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ti, err := cli.Task(task.Link, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if ti.Error != "" {
+		t.Fatal(ti.Error)
+	}
+	if ti.ID != id {
+		t.Fatalf("unexpected id got %s exp %s", ti.ID, id)
+	}
+	if ti.Type != client.StreamTask {
+		t.Fatalf("unexpected type got %v exp %v", ti.Type, client.StreamTask)
+	}
+	if ti.Status != client.Disabled {
+		t.Fatalf("unexpected status got %v exp %v", ti.Status, client.Disabled)
+	}
+	if !reflect.DeepEqual(ti.DBRPs, dbrps) {
+		t.Fatalf("unexpected dbrps got %s exp %s", ti.DBRPs, dbrps)
+	}
+	if ti.TICKscript != tick {
+		t.Fatalf("unexpected TICKscript got %s exp %s", ti.TICKscript, tick)
+	}
+	dot := "digraph testTaskID {\nstream0 -> from1;\n}"
+	if ti.Dot != dot {
+		t.Fatalf("unexpected dot\ngot\n%s\nexp\n%s\n", ti.Dot, dot)
+	}
+}
+
+func TestServer_DeleteTask(t *testing.T) {
+	s, cli := OpenDefaultServer()
+	defer s.Close()
+
 	id := "testTaskID"
 	ttype := client.StreamTask
 	dbrps := []client.DBRP{
@@ -1849,24 +2884,266 @@ stream
 				Value: "value",
 				Type:  client.VarString,
 			},
-		},
-	})
-	if err != nil {
-		t.Fatal(err)
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := cli.UpdateTask(task.Link, client.UpdateTaskOptions{
+		Status: client.Enabled,
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	endpoint := fmt.Sprintf("%s/tasks/%s/count", s.URL(), taskId)
+
+	// Request data before any writes and expect null responses
+	nullResponse := `{"series":null}`
+	if err := s.HTTPGetRetry(endpoint, nullResponse, 100, time.Millisecond*5); err != nil {
+		t.Error(err)
+	}
+
+	points := `test value=1 0000000000
+test value=1 0000000001
+test value=1 0000000001
+test value=1 0000000002
+test value=1 0000000002
+test value=1 0000000003
+test value=1 0000000003
+test value=1 0000000004
+test value=1 0000000005
+test value=1 0000000005
+test value=1 0000000005
+test value=1 0000000006
+test value=1 0000000007
+test value=1 0000000008
+test value=1 0000000009
+test value=1 0000000010
+test value=1 0000000011
+`
+	v := url.Values{}
+	v.Add("precision", "s")
+	s.MustWrite("mydb", "myrp", points, v)
+
+	exp := `{"series":[{"name":"test","columns":["time","count"],"values":[["1970-01-01T00:00:10Z",15]]}]}`
+	if err := s.HTTPGetRetry(endpoint, exp, 100, time.Millisecond*5); err != nil {
+		t.Error(err)
+	}
+}
+func TestServer_StreamTemplateTask_UpdateTemplate(t *testing.T) {
+	s, cli := OpenDefaultServer()
+	defer s.Close()
+
+	templateId := "testStreamTemplate"
+	taskId := "testStreamTask"
+	ttype := client.StreamTask
+	dbrps := []client.DBRP{{
+		Database:        "mydb",
+		RetentionPolicy: "myrp",
+	}}
+	tickWrong := `
+stream
+    |from()
+        .measurement('test')
+    |window()
+        .period(10s)
+        .every(10s)
+    |count('wrong')
+    |httpOut('count')
+`
+	tickCorrect := `
+var field string
+stream
+    |from()
+        .measurement('test')
+    |window()
+        .period(10s)
+        .every(10s)
+    |count(field)
+    |httpOut('count')
+`
+	template, err := cli.CreateTemplate(client.CreateTemplateOptions{
+		ID:         templateId,
+		Type:       ttype,
+		TICKscript: tickWrong,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err = cli.CreateTask(client.CreateTaskOptions{
+		ID:         taskId,
+		TemplateID: templateId,
+		DBRPs:      dbrps,
+		Status:     client.Enabled,
+		Vars: client.Vars{
+			"field": {
+				Value: "value",
+				Type:  client.VarString,
+			},
+		},
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := cli.UpdateTemplate(template.Link, client.UpdateTemplateOptions{
+		TICKscript: tickCorrect,
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	endpoint := fmt.Sprintf("%s/tasks/%s/count", s.URL(), taskId)
+
+	// Request data before any writes and expect null responses
+	nullResponse := `{"series":null}`
+	if err := s.HTTPGetRetry(endpoint, nullResponse, 100, time.Millisecond*5); err != nil {
+		t.Error(err)
+	}
+
+	points := `test value=1 0000000000
+test value=1 0000000001
+test value=1 0000000001
+test value=1 0000000002
+test value=1 0000000002
+test value=1 0000000003
+test value=1 0000000003
+test value=1 0000000004
+test value=1 0000000005
+test value=1 0000000005
+test value=1 0000000005
+test value=1 0000000006
+test value=1 0000000007
+test value=1 0000000008
+test value=1 0000000009
+test value=1 0000000010
+test value=1 0000000011
+`
+	v := url.Values{}
+	v.Add("precision", "s")
+	s.MustWrite("mydb", "myrp", points, v)
+
+	exp := `{"series":[{"name":"test","columns":["time","count"],"values":[["1970-01-01T00:00:10Z",15]]}]}`
+	if err := s.HTTPGetRetry(endpoint, exp, 100, time.Millisecond*5); err != nil {
+		t.Error(err)
+	}
+}
+func TestServer_StreamTemplateTask_UpdateTemplate_Rollback(t *testing.T) {
+	s, cli := OpenDefaultServer()
+	defer s.Close()
+
+	templateId := "testStreamTemplate"
+	taskId := "testStreamTask"
+	ttype := client.StreamTask
+	dbrps := []client.DBRP{{
+		Database:        "mydb",
+		RetentionPolicy: "myrp",
+	}}
+	tickCorrect := `
+var field string
+stream
+    |from()
+        .measurement('test')
+    |window()
+        .period(10s)
+        .every(10s)
+    |count(field)
+    |httpOut('count')
+`
+	tickNewVar := `
+var field string
+var period duration
+stream
+    |from()
+        .measurement('test')
+    |window()
+        .period(period)
+        .every(period)
+    |count(field)
+    |httpOut('count')
+`
+	template, err := cli.CreateTemplate(client.CreateTemplateOptions{
+		ID:         templateId,
+		Type:       ttype,
+		TICKscript: tickCorrect,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Create several tasks
+	count := 5
+	tasks := make([]client.Task, count)
+	for i := 0; i < count; i++ {
+		if task, err := cli.CreateTask(client.CreateTaskOptions{
+			ID:         fmt.Sprintf("%s-%d", taskId, i),
+			TemplateID: templateId,
+			DBRPs:      dbrps,
+			Status:     client.Enabled,
+			Vars: client.Vars{
+				"field": {
+					Value: "value",
+					Type:  client.VarString,
+				},
+			},
+		}); err != nil {
+			t.Fatal(err)
+		} else {
+			tasks[i] = task
+		}
+	}
+
+	if _, err := cli.UpdateTemplate(template.Link, client.UpdateTemplateOptions{
+		TICKscript: tickNewVar,
+	}); err == nil {
+		t.Error("expected error for breaking template update, got nil")
+	} else if got, exp := err.Error(), `error reloading associated task testStreamTask-0: missing value for var "period".`; exp != got {
+		t.Errorf("unexpected error for breaking template update, got %s exp %s", got, exp)
+	}
+
+	// Get all tasks and make sure their TICKscript has the original value
+	for _, task := range tasks {
+		if gotTask, err := cli.Task(task.Link, &client.TaskOptions{ScriptFormat: "raw"}); err != nil {
+			t.Fatal(err)
+		} else if got, exp := gotTask.TICKscript, tickCorrect; got != exp {
+			t.Errorf("unexpected task TICKscript:\ngot\n%s\nexp\n%s\n", got, exp)
+		}
+	}
+
+	// Update all tasks with new var
+	for _, task := range tasks {
+		if _, err := cli.UpdateTask(task.Link, client.UpdateTaskOptions{
+			Vars: client.Vars{
+				"field": {
+					Value: "value",
+					Type:  client.VarString,
+				},
+				"period": {
+					Value: 10 * time.Second,
+					Type:  client.VarDuration,
+				},
+			},
+		}); err != nil {
+			t.Fatal(err)
+		}
 	}
 
-	if _, err := cli.UpdateTask(task.Link, client.UpdateTaskOptions{
-		Status: client.Enabled,
+	// Now update template should succeed since the tasks are updated too.
+	if _, err := cli.UpdateTemplate(template.Link, client.UpdateTemplateOptions{
+		TICKscript: tickNewVar,
 	}); err != nil {
 		t.Fatal(err)
 	}
 
-	endpoint := fmt.Sprintf("%s/tasks/%s/count", s.URL(), taskId)
+	for _, task := range tasks {
+		taskId := task.ID
+		endpoint := fmt.Sprintf("%s/tasks/%s/count", s.URL(), taskId)
 
-	// Request data before any writes and expect null responses
-	nullResponse := `{"series":null}`
-	if err := s.HTTPGetRetry(endpoint, nullResponse, 100, time.Millisecond*5); err != nil {
-		t.Error(err)
+		// Request data before any writes and expect null responses
+		nullResponse := `{"series":null}`
+		if err := s.HTTPGetRetry(endpoint, nullResponse, 100, time.Millisecond*5); err != nil {
+			t.Error(err)
+		}
 	}
 
 	points := `test value=1 0000000000
@@ -1891,558 +3168,1076 @@ test value=1 0000000011
 	v.Add("precision", "s")
 	s.MustWrite("mydb", "myrp", points, v)
 
-	exp := `{"series":[{"name":"test","columns":["time","count"],"values":[["1970-01-01T00:00:10Z",15]]}]}`
-	if err := s.HTTPGetRetry(endpoint, exp, 100, time.Millisecond*5); err != nil {
-		t.Error(err)
+	for _, task := range tasks {
+		taskId := task.ID
+		endpoint := fmt.Sprintf("%s/tasks/%s/count", s.URL(), taskId)
+
+		exp := `{"series":[{"name":"test","columns":["time","count"],"values":[["1970-01-01T00:00:10Z",15]]}]}`
+		if err := s.HTTPGetRetry(endpoint, exp, 100, time.Millisecond*5); err != nil {
+			t.Error(err)
+		}
 	}
 }
-func TestServer_StreamTemplateTask_UpdateTemplate(t *testing.T) {
+
+func TestServer_UpdateTaskID(t *testing.T) {
 	s, cli := OpenDefaultServer()
 	defer s.Close()
 
-	templateId := "testStreamTemplate"
-	taskId := "testStreamTask"
+	id := "testTaskID"
 	ttype := client.StreamTask
-	dbrps := []client.DBRP{{
-		Database:        "mydb",
-		RetentionPolicy: "myrp",
-	}}
-	tickWrong := `
-stream
+	dbrps := []client.DBRP{
+		{
+			Database:        "mydb",
+			RetentionPolicy: "myrp",
+		},
+		{
+			Database:        "otherdb",
+			RetentionPolicy: "default",
+		},
+	}
+	tick := `stream
     |from()
         .measurement('test')
-    |window()
-        .period(10s)
-        .every(10s)
-    |count('wrong')
-    |httpOut('count')
 `
-	tickCorrect := `
-var field string
-stream
+	task, err := cli.CreateTask(client.CreateTaskOptions{
+		ID:         id,
+		Type:       ttype,
+		DBRPs:      dbrps,
+		TICKscript: tick,
+		Status:     client.Disabled,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ti, err := cli.Task(task.Link, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if ti.Error != "" {
+		t.Fatal(ti.Error)
+	}
+	if ti.ID != id {
+		t.Fatalf("unexpected id got %s exp %s", ti.ID, id)
+	}
+	if ti.Type != client.StreamTask {
+		t.Fatalf("unexpected type got %v exp %v", ti.Type, client.StreamTask)
+	}
+	if ti.Status != client.Disabled {
+		t.Fatalf("unexpected status got %v exp %v", ti.Status, client.Disabled)
+	}
+	if !reflect.DeepEqual(ti.DBRPs, dbrps) {
+		t.Fatalf("unexpected dbrps got %s exp %s", ti.DBRPs, dbrps)
+	}
+	if ti.TICKscript != tick {
+		t.Fatalf("unexpected TICKscript got %s exp %s", ti.TICKscript, tick)
+	}
+	dot := "digraph testTaskID {\nstream0 -> from1;\n}"
+	if ti.Dot != dot {
+		t.Fatalf("unexpected dot\ngot\n%s\nexp\n%s\n", ti.Dot, dot)
+	}
+
+	newID := "newTaskID"
+	task, err = cli.UpdateTask(task.Link, client.UpdateTaskOptions{
+		ID: newID,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got, exp := task.Link.Href, "/kapacitor/v1/tasks/newTaskID"; got != exp {
+		t.Fatalf("unexpected task link got %s exp %s", got, exp)
+	}
+
+	ti, err = cli.Task(task.Link, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if ti.Error != "" {
+		t.Fatal(ti.Error)
+	}
+	if ti.ID != newID {
+		t.Fatalf("unexpected id got %s exp %s", ti.ID, newID)
+	}
+	if ti.Type != client.StreamTask {
+		t.Fatalf("unexpected type got %v exp %v", ti.Type, client.StreamTask)
+	}
+	if ti.Status != client.Disabled {
+		t.Fatalf("unexpected status got %v exp %v", ti.Status, client.Disabled)
+	}
+	if !reflect.DeepEqual(ti.DBRPs, dbrps) {
+		t.Fatalf("unexpected dbrps got %s exp %s", ti.DBRPs, dbrps)
+	}
+	if ti.TICKscript != tick {
+		t.Fatalf("unexpected TICKscript got %s exp %s", ti.TICKscript, tick)
+	}
+	dot = "digraph newTaskID {\nstream0 -> from1;\n}"
+	if ti.Dot != dot {
+		t.Fatalf("unexpected dot\ngot\n%s\nexp\n%s\n", ti.Dot, dot)
+	}
+}
+func TestServer_UpdateTaskID_Fail(t *testing.T) {
+	s, cli := OpenDefaultServer()
+	defer s.Close()
+
+	id := "testTaskID"
+	newID := "anotherTaskID"
+	ttype := client.StreamTask
+	dbrps := []client.DBRP{
+		{
+			Database:        "mydb",
+			RetentionPolicy: "myrp",
+		},
+		{
+			Database:        "otherdb",
+			RetentionPolicy: "default",
+		},
+	}
+	tick := `stream
     |from()
         .measurement('test')
-    |window()
-        .period(10s)
-        .every(10s)
-    |count(field)
-    |httpOut('count')
 `
-	template, err := cli.CreateTemplate(client.CreateTemplateOptions{
-		ID:         templateId,
+	task, err := cli.CreateTask(client.CreateTaskOptions{
+		ID:         id,
 		Type:       ttype,
-		TICKscript: tickWrong,
+		DBRPs:      dbrps,
+		TICKscript: tick,
+		Status:     client.Disabled,
 	})
 	if err != nil {
 		t.Fatal(err)
 	}
 
-	if _, err = cli.CreateTask(client.CreateTaskOptions{
-		ID:         taskId,
-		TemplateID: templateId,
+	ti, err := cli.Task(task.Link, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if ti.Error != "" {
+		t.Fatal(ti.Error)
+	}
+	if ti.ID != id {
+		t.Fatalf("unexpected id got %s exp %s", ti.ID, id)
+	}
+	if ti.Type != client.StreamTask {
+		t.Fatalf("unexpected type got %v exp %v", ti.Type, client.StreamTask)
+	}
+	if ti.Status != client.Disabled {
+		t.Fatalf("unexpected status got %v exp %v", ti.Status, client.Disabled)
+	}
+	if !reflect.DeepEqual(ti.DBRPs, dbrps) {
+		t.Fatalf("unexpected dbrps got %s exp %s", ti.DBRPs, dbrps)
+	}
+	if ti.TICKscript != tick {
+		t.Fatalf("unexpected TICKscript got %s exp %s", ti.TICKscript, tick)
+	}
+	dot := "digraph testTaskID {\nstream0 -> from1;\n}"
+	if ti.Dot != dot {
+		t.Fatalf("unexpected dot\ngot\n%s\nexp\n%s\n", ti.Dot, dot)
+	}
+
+	// Create conflicting task
+	if _, err := cli.CreateTask(client.CreateTaskOptions{
+		ID:         newID,
+		Type:       ttype,
 		DBRPs:      dbrps,
-		Status:     client.Enabled,
-		Vars: client.Vars{
-			"field": {
-				Value: "value",
-				Type:  client.VarString,
-			},
-		},
+		TICKscript: tick,
+		Status:     client.Disabled,
 	}); err != nil {
 		t.Fatal(err)
 	}
-
-	if _, err := cli.UpdateTemplate(template.Link, client.UpdateTemplateOptions{
-		TICKscript: tickCorrect,
-	}); err != nil {
-		t.Fatal(err)
+
+	if _, err := cli.UpdateTask(task.Link, client.UpdateTaskOptions{
+		ID: newID,
+	}); err == nil {
+		t.Fatal("expected error on name conflict")
+	}
+
+	// Can still get old task
+	ti, err = cli.Task(task.Link, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if ti.Error != "" {
+		t.Fatal(ti.Error)
+	}
+	if ti.ID != id {
+		t.Fatalf("unexpected id got %s exp %s", ti.ID, id)
+	}
+	if ti.Type != client.StreamTask {
+		t.Fatalf("unexpected type got %v exp %v", ti.Type, client.StreamTask)
+	}
+	if ti.Status != client.Disabled {
+		t.Fatalf("unexpected status got %v exp %v", ti.Status, client.Disabled)
 	}
-
-	endpoint := fmt.Sprintf("%s/tasks/%s/count", s.URL(), taskId)
-
-	// Request data before any writes and expect null responses
-	nullResponse := `{"series":null}`
-	if err := s.HTTPGetRetry(endpoint, nullResponse, 100, time.Millisecond*5); err != nil {
-		t.Error(err)
+	if !reflect.DeepEqual(ti.DBRPs, dbrps) {
+		t.Fatalf("unexpected dbrps got %s exp %s", ti.DBRPs, dbrps)
 	}
-
-	points := `test value=1 0000000000
-test value=1 0000000001
-test value=1 0000000001
-test value=1 0000000002
-test value=1 0000000002
-test value=1 0000000003
-test value=1 0000000003
-test value=1 0000000004
-test value=1 0000000005
-test value=1 0000000005
-test value=1 0000000005
-test value=1 0000000006
-test value=1 0000000007
-test value=1 0000000008
-test value=1 0000000009
-test value=1 0000000010
-test value=1 0000000011
-`
-	v := url.Values{}
-	v.Add("precision", "s")
-	s.MustWrite("mydb", "myrp", points, v)
-
-	exp := `{"series":[{"name":"test","columns":["time","count"],"values":[["1970-01-01T00:00:10Z",15]]}]}`
-	if err := s.HTTPGetRetry(endpoint, exp, 100, time.Millisecond*5); err != nil {
-		t.Error(err)
+	if ti.TICKscript != tick {
+		t.Fatalf("unexpected TICKscript got %s exp %s", ti.TICKscript, tick)
+	}
+	if ti.Dot != dot {
+		t.Fatalf("unexpected dot\ngot\n%s\nexp\n%s\n", ti.Dot, dot)
 	}
 }
-func TestServer_StreamTemplateTask_UpdateTemplate_Rollback(t *testing.T) {
+func TestServer_UpdateTaskID_Enabled(t *testing.T) {
 	s, cli := OpenDefaultServer()
 	defer s.Close()
 
-	templateId := "testStreamTemplate"
-	taskId := "testStreamTask"
+	id := "testTaskID"
 	ttype := client.StreamTask
-	dbrps := []client.DBRP{{
-		Database:        "mydb",
-		RetentionPolicy: "myrp",
-	}}
-	tickCorrect := `
-var field string
-stream
-    |from()
-        .measurement('test')
-    |window()
-        .period(10s)
-        .every(10s)
-    |count(field)
-    |httpOut('count')
-`
-	tickNewVar := `
-var field string
-var period duration
-stream
+	dbrps := []client.DBRP{
+		{
+			Database:        "mydb",
+			RetentionPolicy: "myrp",
+		},
+		{
+			Database:        "otherdb",
+			RetentionPolicy: "default",
+		},
+	}
+	tick := `stream
     |from()
         .measurement('test')
-    |window()
-        .period(period)
-        .every(period)
-    |count(field)
-    |httpOut('count')
 `
-	template, err := cli.CreateTemplate(client.CreateTemplateOptions{
-		ID:         templateId,
+	task, err := cli.CreateTask(client.CreateTaskOptions{
+		ID:         id,
 		Type:       ttype,
-		TICKscript: tickCorrect,
+		DBRPs:      dbrps,
+		TICKscript: tick,
+		Status:     client.Enabled,
 	})
 	if err != nil {
 		t.Fatal(err)
 	}
 
-	// Create several tasks
-	count := 5
-	tasks := make([]client.Task, count)
-	for i := 0; i < count; i++ {
-		if task, err := cli.CreateTask(client.CreateTaskOptions{
-			ID:         fmt.Sprintf("%s-%d", taskId, i),
-			TemplateID: templateId,
-			DBRPs:      dbrps,
-			Status:     client.Enabled,
-			Vars: client.Vars{
-				"field": {
-					Value: "value",
-					Type:  client.VarString,
-				},
-			},
-		}); err != nil {
-			t.Fatal(err)
-		} else {
-			tasks[i] = task
-		}
+	ti, err := cli.Task(task.Link, nil)
+	if err != nil {
+		t.Fatal(err)
 	}
 
-	if _, err := cli.UpdateTemplate(template.Link, client.UpdateTemplateOptions{
-		TICKscript: tickNewVar,
-	}); err == nil {
-		t.Error("expected error for breaking template update, got nil")
-	} else if got, exp := err.Error(), `error reloading associated task testStreamTask-0: missing value for var "period".`; exp != got {
-		t.Errorf("unexpected error for breaking template update, got %s exp %s", got, exp)
+	if ti.Error != "" {
+		t.Fatal(ti.Error)
 	}
-
-	// Get all tasks and make sure their TICKscript has the original value
-	for _, task := range tasks {
-		if gotTask, err := cli.Task(task.Link, &client.TaskOptions{ScriptFormat: "raw"}); err != nil {
-			t.Fatal(err)
-		} else if got, exp := gotTask.TICKscript, tickCorrect; got != exp {
-			t.Errorf("unexpected task TICKscript:\ngot\n%s\nexp\n%s\n", got, exp)
-		}
+	if ti.ID != id {
+		t.Fatalf("unexpected id got %s exp %s", ti.ID, id)
 	}
-
-	// Update all tasks with new var
-	for _, task := range tasks {
-		if _, err := cli.UpdateTask(task.Link, client.UpdateTaskOptions{
-			Vars: client.Vars{
-				"field": {
-					Value: "value",
-					Type:  client.VarString,
-				},
-				"period": {
-					Value: 10 * time.Second,
-					Type:  client.VarDuration,
-				},
-			},
-		}); err != nil {
-			t.Fatal(err)
-		}
+	if ti.Type != client.StreamTask {
+		t.Fatalf("unexpected type got %v exp %v", ti.Type, client.StreamTask)
+	}
+	if ti.Status != client.Enabled {
+		t.Fatalf("unexpected status got %v exp %v", ti.Status, client.Enabled)
+	}
+	if !reflect.DeepEqual(ti.DBRPs, dbrps) {
+		t.Fatalf("unexpected dbrps got %s exp %s", ti.DBRPs, dbrps)
+	}
+	if ti.TICKscript != tick {
+		t.Fatalf("unexpected TICKscript got %s exp %s", ti.TICKscript, tick)
+	}
+	if !ti.Executing {
+		t.Fatal("expected task to be executing")
 	}
 
-	// Now update template should succeed since the tasks are updated too.
-	if _, err := cli.UpdateTemplate(template.Link, client.UpdateTemplateOptions{
-		TICKscript: tickNewVar,
-	}); err != nil {
+	newID := "newTaskID"
+	task, err = cli.UpdateTask(task.Link, client.UpdateTaskOptions{
+		ID: newID,
+	})
+	if err != nil {
 		t.Fatal(err)
 	}
 
-	for _, task := range tasks {
-		taskId := task.ID
-		endpoint := fmt.Sprintf("%s/tasks/%s/count", s.URL(), taskId)
-
-		// Request data before any writes and expect null responses
-		nullResponse := `{"series":null}`
-		if err := s.HTTPGetRetry(endpoint, nullResponse, 100, time.Millisecond*5); err != nil {
-			t.Error(err)
-		}
+	if got, exp := task.Link.Href, "/kapacitor/v1/tasks/newTaskID"; got != exp {
+		t.Fatalf("unexpected task link got %s exp %s", got, exp)
 	}
 
-	points := `test value=1 0000000000
-test value=1 0000000001
-test value=1 0000000001
-test value=1 0000000002
-test value=1 0000000002
-test value=1 0000000003
-test value=1 0000000003
-test value=1 0000000004
-test value=1 0000000005
-test value=1 0000000005
-test value=1 0000000005
-test value=1 0000000006
-test value=1 0000000007
-test value=1 0000000008
-test value=1 0000000009
-test value=1 0000000010
-test value=1 0000000011
-`
-	v := url.Values{}
-	v.Add("precision", "s")
-	s.MustWrite("mydb", "myrp", points, v)
-
-	for _, task := range tasks {
-		taskId := task.ID
-		endpoint := fmt.Sprintf("%s/tasks/%s/count", s.URL(), taskId)
+	ti, err = cli.Task(task.Link, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
 
-		exp := `{"series":[{"name":"test","columns":["time","count"],"values":[["1970-01-01T00:00:10Z",15]]}]}`
-		if err := s.HTTPGetRetry(endpoint, exp, 100, time.Millisecond*5); err != nil {
-			t.Error(err)
-		}
+	if ti.Error != "" {
+		t.Fatal(ti.Error)
+	}
+	if ti.ID != newID {
+		t.Fatalf("unexpected id got %s exp %s", ti.ID, newID)
+	}
+	if ti.Type != client.StreamTask {
+		t.Fatalf("unexpected type got %v exp %v", ti.Type, client.StreamTask)
+	}
+	if ti.Status != client.Enabled {
+		t.Fatalf("unexpected status got %v exp %v", ti.Status, client.Enabled)
+	}
+	if !reflect.DeepEqual(ti.DBRPs, dbrps) {
+		t.Fatalf("unexpected dbrps got %s exp %s", ti.DBRPs, dbrps)
+	}
+	if ti.TICKscript != tick {
+		t.Fatalf("unexpected TICKscript got %s exp %s", ti.TICKscript, tick)
+	}
+	if !ti.Executing {
+		t.Fatal("expected task to be executing")
 	}
 }
 
-func TestServer_UpdateTaskID(t *testing.T) {
-	s, cli := OpenDefaultServer()
+func TestServer_TaskRevisions(t *testing.T) {
+	c := NewConfig()
+	c.Task.RevisionRetention = 3
+	s := OpenServer(c)
+	cli := Client(s)
 	defer s.Close()
 
 	id := "testTaskID"
-	ttype := client.StreamTask
 	dbrps := []client.DBRP{
 		{
 			Database:        "mydb",
 			RetentionPolicy: "myrp",
 		},
-		{
-			Database:        "otherdb",
-			RetentionPolicy: "default",
-		},
 	}
-	tick := `stream
+	ticks := []string{
+		`stream
     |from()
         .measurement('test')
-`
+`,
+		`stream
+    |from()
+        .measurement('test2')
+`,
+		`stream
+    |from()
+        .measurement('test3')
+`,
+	}
 	task, err := cli.CreateTask(client.CreateTaskOptions{
 		ID:         id,
-		Type:       ttype,
+		Type:       client.StreamTask,
 		DBRPs:      dbrps,
-		TICKscript: tick,
+		TICKscript: ticks[0],
 		Status:     client.Disabled,
 	})
 	if err != nil {
 		t.Fatal(err)
 	}
+	if got, exp := task.Revision, 1; got != exp {
+		t.Fatalf("unexpected revision got %d exp %d", got, exp)
+	}
 
-	ti, err := cli.Task(task.Link, nil)
+	// Changing only the status does not create a revision
+	task, err = cli.UpdateTask(task.Link, client.UpdateTaskOptions{
+		Status: client.Enabled,
+	})
 	if err != nil {
 		t.Fatal(err)
 	}
-
-	if ti.Error != "" {
-		t.Fatal(ti.Error)
-	}
-	if ti.ID != id {
-		t.Fatalf("unexpected id got %s exp %s", ti.ID, id)
+	if got, exp := task.Revision, 1; got != exp {
+		t.Fatalf("unexpected revision got %d exp %d", got, exp)
 	}
-	if ti.Type != client.StreamTask {
-		t.Fatalf("unexpected type got %v exp %v", ti.Type, client.StreamTask)
+
+	for _, tick := range ticks[1:] {
+		task, err = cli.UpdateTask(task.Link, client.UpdateTaskOptions{
+			TICKscript: tick,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
 	}
-	if ti.Status != client.Disabled {
-		t.Fatalf("unexpected status got %v exp %v", ti.Status, client.Disabled)
+	if got, exp := task.Revision, 3; got != exp {
+		t.Fatalf("unexpected revision got %d exp %d", got, exp)
 	}
-	if !reflect.DeepEqual(ti.DBRPs, dbrps) {
-		t.Fatalf("unexpected dbrps got %s exp %s", ti.DBRPs, dbrps)
+
+	revisions, err := cli.ListTaskRevisions(cli.TaskRevisionsLink(id), nil)
+	if err != nil {
+		t.Fatal(err)
 	}
-	if ti.TICKscript != tick {
-		t.Fatalf("unexpected TICKscript got %s exp %s", ti.TICKscript, tick)
+	if got, exp := len(revisions.Revisions), 3; got != exp {
+		t.Fatalf("unexpected number of revisions got %d exp %d", got, exp)
 	}
-	dot := "digraph testTaskID {\nstream0 -> from1;\n}"
-	if ti.Dot != dot {
-		t.Fatalf("unexpected dot\ngot\n%s\nexp\n%s\n", ti.Dot, dot)
+	for i, r := range revisions.Revisions {
+		if got, exp := r.Revision, 3-i; got != exp {
+			t.Errorf("unexpected revision at %d got %d exp %d", i, got, exp)
+		}
+		if got, exp := r.TICKscript, ticks[2-i]; got != exp {
+			t.Errorf("unexpected TICKscript for revision %d got %s exp %s", r.Revision, got, exp)
+		}
+		if !reflect.DeepEqual(r.DBRPs, dbrps) {
+			t.Errorf("unexpected dbrps for revision %d got %s exp %s", r.Revision, r.DBRPs, dbrps)
+		}
 	}
 
-	newID := "newTaskID"
-	task, err = cli.UpdateTask(task.Link, client.UpdateTaskOptions{
-		ID: newID,
-	})
+	diff, err := cli.DiffTaskRevisions(cli.TaskRevisionsLink(id), 1, 0)
 	if err != nil {
 		t.Fatal(err)
 	}
-
-	if got, exp := task.Link.Href, "/kapacitor/v1/tasks/newTaskID"; got != exp {
-		t.Fatalf("unexpected task link got %s exp %s", got, exp)
+	if got, exp := diff.To, 3; got != exp {
+		t.Fatalf("unexpected diff to revision got %d exp %d", got, exp)
+	}
+	if !strings.Contains(diff.Diff, "-        .measurement('test')\n") || !strings.Contains(diff.Diff, "+        .measurement('test3')\n") {
+		t.Fatalf("unexpected diff:\n%s", diff.Diff)
 	}
 
-	ti, err = cli.Task(task.Link, nil)
+	task, err = cli.RollbackTask(task.Link, 1)
 	if err != nil {
 		t.Fatal(err)
 	}
+	if got, exp := task.Revision, 4; got != exp {
+		t.Fatalf("unexpected revision got %d exp %d", got, exp)
+	}
+	if got, exp := task.TICKscript, ticks[0]; got != exp {
+		t.Fatalf("unexpected TICKscript got %s exp %s", got, exp)
+	}
+	if !task.Executing {
+		t.Fatal("expected rolled back task to be executing")
+	}
 
-	if ti.Error != "" {
-		t.Fatal(ti.Error)
+	// Only the configured number of revisions are retained
+	revisions, err = cli.ListTaskRevisions(cli.TaskRevisionsLink(id), nil)
+	if err != nil {
+		t.Fatal(err)
 	}
-	if ti.ID != newID {
-		t.Fatalf("unexpected id got %s exp %s", ti.ID, newID)
+	if got, exp := len(revisions.Revisions), 3; got != exp {
+		t.Fatalf("unexpected number of revisions got %d exp %d", got, exp)
 	}
-	if ti.Type != client.StreamTask {
-		t.Fatalf("unexpected type got %v exp %v", ti.Type, client.StreamTask)
+	if _, err := cli.TaskRevision(cli.TaskRevisionLink(id, 1)); err == nil {
+		t.Fatal("expected revision 1 to have been pruned")
 	}
-	if ti.Status != client.Disabled {
-		t.Fatalf("unexpected status got %v exp %v", ti.Status, client.Disabled)
+	r, err := cli.TaskRevision(cli.TaskRevisionLink(id, 4))
+	if err != nil {
+		t.Fatal(err)
 	}
-	if !reflect.DeepEqual(ti.DBRPs, dbrps) {
-		t.Fatalf("unexpected dbrps got %s exp %s", ti.DBRPs, dbrps)
+	if got, exp := r.TICKscript, ticks[0]; got != exp {
+		t.Fatalf("unexpected TICKscript got %s exp %s", got, exp)
 	}
-	if ti.TICKscript != tick {
-		t.Fatalf("unexpected TICKscript got %s exp %s", ti.TICKscript, tick)
+
+	// Revisions are deleted with the task
+	if err := cli.DeleteTask(task.Link); err != nil {
+		t.Fatal(err)
 	}
-	dot = "digraph newTaskID {\nstream0 -> from1;\n}"
-	if ti.Dot != dot {
-		t.Fatalf("unexpected dot\ngot\n%s\nexp\n%s\n", ti.Dot, dot)
+	if _, err := cli.ListTaskRevisions(cli.TaskRevisionsLink(id), nil); err == nil {
+		t.Fatal("expected error listing revisions of deleted task")
 	}
 }
-func TestServer_UpdateTaskID_Fail(t *testing.T) {
+
+func TestServer_Sync(t *testing.T) {
 	s, cli := OpenDefaultServer()
 	defer s.Close()
 
-	id := "testTaskID"
-	newID := "anotherTaskID"
-	ttype := client.StreamTask
 	dbrps := []client.DBRP{
 		{
 			Database:        "mydb",
 			RetentionPolicy: "myrp",
 		},
-		{
-			Database:        "otherdb",
-			RetentionPolicy: "default",
-		},
 	}
-	tick := `stream
+	templateTick := `var measurement string
+stream
     |from()
-        .measurement('test')
+        .measurement(measurement)
 `
-	task, err := cli.CreateTask(client.CreateTaskOptions{
-		ID:         id,
-		Type:       ttype,
+	opts := client.SyncOptions{
+		DryRun: true,
+		Templates: []client.CreateTemplateOptions{{
+			ID:         "measurement_template",
+			Type:       client.StreamTask,
+			TICKscript: templateTick,
+		}},
+		Tasks: []client.CreateTaskOptions{
+			{
+				ID:         "plain",
+				Type:       client.StreamTask,
+				DBRPs:      dbrps,
+				TICKscript: "stream\n    |from()\n        .measurement('test')\n",
+				Labels:     client.Labels{"team": "db"},
+			},
+			{
+				ID:         "templated",
+				TemplateID: "measurement_template",
+				DBRPs:      dbrps,
+				Status:     client.Disabled,
+				Vars: client.Vars{
+					"measurement": {Type: client.VarString, Value: "cpu"},
+				},
+			},
+		},
+		Handlers: []client.SyncTopicHandlerOptions{{
+			Topic: "system",
+			TopicHandlerOptions: client.TopicHandlerOptions{
+				ID:   "slack",
+				Kind: "slack",
+				Options: map[string]interface{}{
+					"channel": "#alerts",
+				},
+			},
+		}},
+	}
+
+	// An unmanaged task is never touched by a sync
+	if _, err := cli.CreateTask(client.CreateTaskOptions{
+		ID:         "unmanaged",
+		Type:       client.StreamTask,
 		DBRPs:      dbrps,
-		TICKscript: tick,
-		Status:     client.Disabled,
-	})
-	if err != nil {
+		TICKscript: "stream\n    |from()\n",
+	}); err != nil {
 		t.Fatal(err)
 	}
 
-	ti, err := cli.Task(task.Link, nil)
+	expActions := []client.SyncAction{
+		{Kind: "template", ID: "measurement_template", Action: client.SyncCreate},
+		{Kind: "task", ID: "plain", Action: client.SyncCreate},
+		{Kind: "task", ID: "templated", Action: client.SyncCreate},
+		{Kind: "handler", ID: "slack", Topic: "system", Action: client.SyncCreate},
+	}
+	result, err := cli.Sync(opts)
 	if err != nil {
 		t.Fatal(err)
 	}
+	if result.Applied {
+		t.Error("dry run was applied")
+	}
+	if !reflect.DeepEqual(result.Actions, expActions) {
+		t.Fatalf("unexpected plan:\ngot\n%+v\nexp\n%+v\n", result.Actions, expActions)
+	}
+	if tasks, err := cli.ListTasks(nil); err != nil {
+		t.Fatal(err)
+	} else if len(tasks) != 1 {
+		t.Fatalf("dry run created tasks: %v", tasks)
+	}
 
-	if ti.Error != "" {
-		t.Fatal(ti.Error)
+	opts.DryRun = false
+	result, err = cli.Sync(opts)
+	if err != nil {
+		t.Fatal(err)
 	}
-	if ti.ID != id {
-		t.Fatalf("unexpected id got %s exp %s", ti.ID, id)
+	if !result.Applied {
+		t.Error("sync was not applied")
 	}
-	if ti.Type != client.StreamTask {
-		t.Fatalf("unexpected type got %v exp %v", ti.Type, client.StreamTask)
+	if !reflect.DeepEqual(result.Actions, expActions) {
+		t.Fatalf("unexpected actions:\ngot\n%+v\nexp\n%+v\n", result.Actions, expActions)
 	}
-	if ti.Status != client.Disabled {
-		t.Fatalf("unexpected status got %v exp %v", ti.Status, client.Disabled)
+	plain, err := cli.Task(cli.TaskLink("plain"), nil)
+	if err != nil {
+		t.Fatal(err)
 	}
-	if !reflect.DeepEqual(ti.DBRPs, dbrps) {
-		t.Fatalf("unexpected dbrps got %s exp %s", ti.DBRPs, dbrps)
+	if got, exp := plain.Labels, (client.Labels{"team": "db", client.ManagedByLabel: client.DefaultSyncManager}); !reflect.DeepEqual(got, exp) {
+		t.Errorf("unexpected labels got %v exp %v", got, exp)
 	}
-	if ti.TICKscript != tick {
-		t.Fatalf("unexpected TICKscript got %s exp %s", ti.TICKscript, tick)
+	if plain.Status != client.Enabled || !plain.Executing {
+		t.Errorf("expected synced task to be enabled and executing, got %v %v", plain.Status, plain.Executing)
 	}
-	dot := "digraph testTaskID {\nstream0 -> from1;\n}"
-	if ti.Dot != dot {
-		t.Fatalf("unexpected dot\ngot\n%s\nexp\n%s\n", ti.Dot, dot)
+	templated, err := cli.Task(cli.TaskLink("templated"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if templated.Status != client.Disabled || templated.TemplateID != "measurement_template" {
+		t.Errorf("unexpected templated task %+v", templated)
+	}
+	handler, err := cli.TopicHandler(cli.TopicHandlerLink("system", "slack"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, exp := handler.Labels, (client.Labels{client.ManagedByLabel: client.DefaultSyncManager}); !reflect.DeepEqual(got, exp) {
+		t.Errorf("unexpected handler labels got %v exp %v", got, exp)
 	}
 
-	// Create conflicting task
-	if _, err := cli.CreateTask(client.CreateTaskOptions{
-		ID:         newID,
-		Type:       ttype,
-		DBRPs:      dbrps,
-		TICKscript: tick,
-		Status:     client.Disabled,
-	}); err != nil {
+	// Syncing the same definitions again changes nothing
+	result, err = cli.Sync(opts)
+	if err != nil {
 		t.Fatal(err)
 	}
+	if len(result.Actions) != 0 {
+		t.Fatalf("expected no actions, got %+v", result.Actions)
+	}
 
-	if _, err := cli.UpdateTask(task.Link, client.UpdateTaskOptions{
-		ID: newID,
-	}); err == nil {
-		t.Fatal("expected error on name conflict")
+	// An invalid definition fails the whole sync
+	invalid := opts
+	invalid.Tasks = append([]client.CreateTaskOptions{{
+		ID:         "new",
+		Type:       client.StreamTask,
+		DBRPs:      dbrps,
+		TICKscript: "stream\n    |from()\n",
+	}}, opts.Tasks...)
+	invalid.Handlers = []client.SyncTopicHandlerOptions{{
+		Topic:               "system",
+		TopicHandlerOptions: client.TopicHandlerOptions{ID: "slack", Kind: "unknown"},
+	}}
+	if _, err := cli.Sync(invalid); err == nil {
+		t.Fatal("expected error from invalid sync")
+	}
+	if _, err := cli.Task(cli.TaskLink("new"), nil); err == nil {
+		t.Fatal("expected no task to be created by a failed sync")
 	}
 
-	// Can still get old task
-	ti, err = cli.Task(task.Link, nil)
+	// A task that fails to start fails the whole sync
+	unstartable := opts
+	unstartable.Tasks = append([]client.CreateTaskOptions{{
+		ID:    "unstartable",
+		Type:  client.StreamTask,
+		DBRPs: dbrps,
+		// The invalid ID template is only parsed when the task starts
+		TICKscript: "stream\n    |from()\n    |alert()\n        .id('{{ .Name')\n",
+	}}, opts.Tasks...)
+	vars, err := cli.DebugVars()
+	if err != nil {
+		t.Fatal(err)
+	}
+	numTasks := vars.NumTasks
+	if _, err := cli.Sync(unstartable); err == nil {
+		t.Fatal("expected error from sync of a task that fails to start")
+	}
+	if _, err := cli.Task(cli.TaskLink("unstartable"), nil); err == nil {
+		t.Fatal("expected task that failed to start to be deleted")
+	}
+	vars, err = cli.DebugVars()
 	if err != nil {
 		t.Fatal(err)
 	}
+	if got, exp := vars.NumTasks, numTasks; got != exp {
+		t.Errorf("unexpected number of tasks after failed sync got %d exp %d", got, exp)
+	}
 
-	if ti.Error != "" {
-		t.Fatal(ti.Error)
+	// An update that fails to start restores the original task
+	unstartableUpdate := opts
+	unstartableUpdate.Tasks = append([]client.CreateTaskOptions{}, opts.Tasks...)
+	unstartableUpdate.Tasks[0].TICKscript = "stream\n    |from()\n    |alert()\n        .id('{{ .Name')\n"
+	numEnabledTasks := vars.NumEnabledTasks
+	if _, err := cli.Sync(unstartableUpdate); err == nil {
+		t.Fatal("expected error from sync of an update that fails to start")
 	}
-	if ti.ID != id {
-		t.Fatalf("unexpected id got %s exp %s", ti.ID, id)
+	plain, err = cli.Task(cli.TaskLink("plain"), nil)
+	if err != nil {
+		t.Fatal(err)
 	}
-	if ti.Type != client.StreamTask {
-		t.Fatalf("unexpected type got %v exp %v", ti.Type, client.StreamTask)
+	if plain.TICKscript != opts.Tasks[0].TICKscript || !plain.Executing {
+		t.Errorf("expected the original task to be restored and executing, got %q executing %v", plain.TICKscript, plain.Executing)
 	}
-	if ti.Status != client.Disabled {
-		t.Fatalf("unexpected status got %v exp %v", ti.Status, client.Disabled)
+	vars, err = cli.DebugVars()
+	if err != nil {
+		t.Fatal(err)
 	}
-	if !reflect.DeepEqual(ti.DBRPs, dbrps) {
-		t.Fatalf("unexpected dbrps got %s exp %s", ti.DBRPs, dbrps)
+	if got, exp := vars.NumEnabledTasks, numEnabledTasks; got != exp {
+		t.Errorf("unexpected number of enabled tasks after failed sync got %d exp %d", got, exp)
 	}
-	if ti.TICKscript != tick {
-		t.Fatalf("unexpected TICKscript got %s exp %s", ti.TICKscript, tick)
+
+	// Remove the templated task and its template and change the plain task
+	opts.Templates = nil
+	opts.Tasks = opts.Tasks[:1]
+	opts.Tasks[0].TICKscript = "stream\n    |from()\n        .measurement('test2')\n"
+	opts.Handlers = nil
+	result, err = cli.Sync(opts)
+	if err != nil {
+		t.Fatal(err)
 	}
-	if ti.Dot != dot {
-		t.Fatalf("unexpected dot\ngot\n%s\nexp\n%s\n", ti.Dot, dot)
+	expKinds := []string{"template delete measurement_template", "task update plain", "task delete templated", "handler delete slack"}
+	gotKinds := make([]string, len(result.Actions))
+	for i, a := range result.Actions {
+		gotKinds[i] = fmt.Sprintf("%s %s %s", a.Kind, a.Action, a.ID)
+	}
+	if !reflect.DeepEqual(gotKinds, expKinds) {
+		t.Fatalf("unexpected actions:\ngot\n%v\nexp\n%v\n", gotKinds, expKinds)
+	}
+	if !strings.Contains(result.Actions[1].Diff, "+        .measurement('test2')") {
+		t.Errorf("unexpected diff:\n%s", result.Actions[1].Diff)
+	}
+	plain, err = cli.Task(cli.TaskLink("plain"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, exp := plain.Revision, 2; got != exp {
+		t.Errorf("unexpected revision got %d exp %d", got, exp)
+	}
+	if !plain.Executing {
+		t.Error("expected updated task to be executing")
+	}
+	tasks, err := cli.ListTasks(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ids := make([]string, len(tasks))
+	for i, task := range tasks {
+		ids[i] = task.ID
+	}
+	if exp := []string{"plain", "unmanaged"}; !reflect.DeepEqual(ids, exp) {
+		t.Errorf("unexpected tasks got %v exp %v", ids, exp)
+	}
+	if templates, err := cli.ListTemplates(nil); err != nil {
+		t.Fatal(err)
+	} else if len(templates) != 0 {
+		t.Errorf("expected template to be deleted, got %v", templates)
+	}
+	if _, err := cli.TopicHandler(cli.TopicHandlerLink("system", "slack")); err == nil {
+		t.Error("expected handler to be deleted")
 	}
 }
-func TestServer_UpdateTaskID_Enabled(t *testing.T) {
+
+func TestServer_Labels(t *testing.T) {
 	s, cli := OpenDefaultServer()
 	defer s.Close()
 
-	id := "testTaskID"
-	ttype := client.StreamTask
 	dbrps := []client.DBRP{
 		{
 			Database:        "mydb",
 			RetentionPolicy: "myrp",
 		},
-		{
-			Database:        "otherdb",
-			RetentionPolicy: "default",
-		},
 	}
+	tick := "stream\n    |from()\n        .measurement('test')\n"
+	tasks := []client.CreateTaskOptions{
+		{ID: "db_prod", Labels: client.Labels{"team": "db", "env": "prod"}},
+		{ID: "db_dev", Labels: client.Labels{"team": "db", "env": "dev"}},
+		{ID: "web_prod", Labels: client.Labels{"team": "web", "env": "prod"}},
+		{ID: "unlabeled"},
+	}
+	for _, o := range tasks {
+		o.Type = client.StreamTask
+		o.DBRPs = dbrps
+		o.TICKscript = tick
+		o.Status = client.Disabled
+		if _, err := cli.CreateTask(o); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := cli.CreateTask(client.CreateTaskOptions{
+		ID:         "invalid",
+		Type:       client.StreamTask,
+		DBRPs:      dbrps,
+		TICKscript: tick,
+		Labels:     client.Labels{"team": "d b"},
+	}); err == nil {
+		t.Error("expected error creating task with invalid label value")
+	}
+
+	listTasks := func(selector string) []string {
+		ts, err := cli.ListTasks(&client.ListTasksOptions{
+			Labels: selector,
+			Fields: []string{"labels"},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		ids := make([]string, len(ts))
+		for i, task := range ts {
+			ids[i] = task.ID
+		}
+		return ids
+	}
+	testCases := []struct {
+		selector string
+		exp      []string
+	}{
+		{selector: "", exp: []string{"db_dev", "db_prod", "unlabeled", "web_prod"}},
+		{selector: "team=db", exp: []string{"db_dev", "db_prod"}},
+		{selector: "team=db,env!=dev", exp: []string{"db_prod"}},
+		{selector: "env=prod", exp: []string{"db_prod", "web_prod"}},
+		{selector: "team", exp: []string{"db_dev", "db_prod", "web_prod"}},
+		{selector: "!team", exp: []string{"unlabeled"}},
+		{selector: "team!=db", exp: []string{"unlabeled", "web_prod"}},
+		{selector: "team=ops", exp: []string{}},
+	}
+	for _, tc := range testCases {
+		if got := listTasks(tc.selector); !reflect.DeepEqual(got, tc.exp) {
+			t.Errorf("unexpected tasks for selector %q: got %v exp %v", tc.selector, got, tc.exp)
+		}
+	}
+	if _, err := cli.ListTasks(&client.ListTasksOptions{Labels: "team=d b"}); err == nil {
+		t.Error("expected error listing tasks with invalid selector")
+	}
+
+	// Changing labels updates the index
+	if _, err := cli.UpdateTask(cli.TaskLink("db_dev"), client.UpdateTaskOptions{
+		Labels: client.Labels{"team": "ops"},
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if got, exp := listTasks("team=db"), []string{"db_prod"}; !reflect.DeepEqual(got, exp) {
+		t.Errorf("unexpected tasks after update: got %v exp %v", got, exp)
+	}
+	if got, exp := listTasks("team=ops"), []string{"db_dev"}; !reflect.DeepEqual(got, exp) {
+		t.Errorf("unexpected tasks after update: got %v exp %v", got, exp)
+	}
+
+	// Labels survive a restart
+	s.Restart()
+	if got, exp := listTasks("env=prod"), []string{"db_prod", "web_prod"}; !reflect.DeepEqual(got, exp) {
+		t.Errorf("unexpected tasks after restart: got %v exp %v", got, exp)
+	}
+
+	// Templates
+	for _, o := range []client.CreateTemplateOptions{
+		{ID: "db_template", Labels: client.Labels{"team": "db"}},
+		{ID: "web_template", Labels: client.Labels{"team": "web"}},
+	} {
+		o.Type = client.StreamTask
+		o.TICKscript = tick
+		if _, err := cli.CreateTemplate(o); err != nil {
+			t.Fatal(err)
+		}
+	}
+	templates, err := cli.ListTemplates(&client.ListTemplatesOptions{Labels: "team=web"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(templates) != 1 || templates[0].ID != "web_template" {
+		t.Errorf("unexpected templates for selector team=web: %v", templates)
+	}
+	if !reflect.DeepEqual(templates[0].Labels, client.Labels{"team": "web"}) {
+		t.Errorf("unexpected template labels: %v", templates[0].Labels)
+	}
+
+	// Topic handlers
+	for _, o := range []client.TopicHandlerOptions{
+		{ID: "db_slack", Kind: "slack", Labels: client.Labels{"team": "db"}},
+		{ID: "web_slack", Kind: "slack", Labels: client.Labels{"team": "web"}},
+	} {
+		if _, err := cli.CreateTopicHandler(cli.TopicHandlersLink("system"), o); err != nil {
+			t.Fatal(err)
+		}
+	}
+	handlers, err := cli.ListTopicHandlers(cli.TopicHandlersLink("system"), &client.ListTopicHandlersOptions{
+		Labels: "team!=db",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(handlers.Handlers) != 1 || handlers.Handlers[0].ID != "web_slack" {
+		t.Errorf("unexpected handlers for selector team!=db: %v", handlers.Handlers)
+	}
+}
+
+func TestServer_TaskLimits(t *testing.T) {
+	s, cli := OpenDefaultServer()
+	defer s.Close()
+
+	dbrps := []client.DBRP{{
+		Database:        "mydb",
+		RetentionPolicy: "myrp",
+	}}
 	tick := `stream
     |from()
         .measurement('test')
+        .groupBy('host')
+    |window()
+        .period(10s)
+        .every(10s)
+    |count('value')
 `
+	if _, err := cli.CreateTask(client.CreateTaskOptions{
+		ID:         "invalid",
+		Type:       client.StreamTask,
+		DBRPs:      dbrps,
+		TICKscript: tick,
+		Limits:     &client.TaskLimits{MaxGroups: 2, Policy: "ignore"},
+	}); err == nil {
+		t.Error("expected error creating task with unknown limit policy")
+	}
+
+	limits := client.TaskLimits{
+		MaxGroups:       2,
+		MaxWindowPoints: 3,
+		Policy:          client.DropLimitPolicy,
+	}
 	task, err := cli.CreateTask(client.CreateTaskOptions{
-		ID:         id,
-		Type:       ttype,
+		ID:         "testTaskLimits",
+		Type:       client.StreamTask,
 		DBRPs:      dbrps,
 		TICKscript: tick,
 		Status:     client.Enabled,
+		Limits:     &limits,
 	})
 	if err != nil {
 		t.Fatal(err)
 	}
-
-	ti, err := cli.Task(task.Link, nil)
-	if err != nil {
-		t.Fatal(err)
+	if !reflect.DeepEqual(task.Limits, limits) {
+		t.Errorf("unexpected limits: got %v exp %v", task.Limits, limits)
 	}
 
-	if ti.Error != "" {
-		t.Fatal(ti.Error)
-	}
-	if ti.ID != id {
-		t.Fatalf("unexpected id got %s exp %s", ti.ID, id)
-	}
-	if ti.Type != client.StreamTask {
-		t.Fatalf("unexpected type got %v exp %v", ti.Type, client.StreamTask)
-	}
-	if ti.Status != client.Enabled {
-		t.Fatalf("unexpected status got %v exp %v", ti.Status, client.Enabled)
-	}
-	if !reflect.DeepEqual(ti.DBRPs, dbrps) {
-		t.Fatalf("unexpected dbrps got %s exp %s", ti.DBRPs, dbrps)
+	points := `test,host=a value=1 0000000000
+test,host=a value=1 0000000001
+test,host=b value=1 0000000001
+test,host=a value=1 0000000002
+test,host=c value=1 0000000002
+test,host=a value=1 0000000003
+test,host=a value=1 0000000004
+test,host=b value=1 0000000004
+test,host=a value=1 0000000005
+test,host=a value=1 0000000010
+test,host=b value=1 0000000010
+`
+	v := url.Values{}
+	v.Add("precision", "s")
+	s.MustWrite("mydb", "myrp", points, v)
+
+	// Only the first three points of each window are buffered,
+	// they remain buffered after the window of host a is emitted until the next window is emitted.
+	exp := map[string]interface{}{
+		"working_cardinality": 2.0,
+		"messages_dropped":    1.0,
+		"groups_evicted":      0.0,
+		"buffered_points":     6.0,
+		"points_dropped":      4.0,
+		"points_evicted":      0.0,
+	}
+	var got map[string]interface{}
+	for i := 0; i < 100; i++ {
+		task, err = cli.Task(task.Link, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got = make(map[string]interface{}, len(exp))
+		for stat := range exp {
+			got[stat] = task.ExecutionStats.NodeStats["window2"][stat]
+		}
+		if reflect.DeepEqual(got, exp) && task.ExecutionStats.NodeStats["window2"]["emitted"] == 1.0 {
+			break
+		}
+		time.Sleep(5 * time.Millisecond)
 	}
-	if ti.TICKscript != tick {
-		t.Fatalf("unexpected TICKscript got %s exp %s", ti.TICKscript, tick)
+	if !reflect.DeepEqual(got, exp) {
+		t.Errorf("unexpected window stats:\ngot\n%v\nexp\n%v", got, exp)
 	}
-	if !ti.Executing {
-		t.Fatal("expected task to be executing")
+	if got, exp := task.ExecutionStats.NodeStats["window2"]["emitted"], 1.0; got != exp {
+		t.Errorf("unexpected number of windows emitted: got %v exp %v", got, exp)
 	}
 
-	newID := "newTaskID"
+	// Changing the limits restarts the task.
+	limits = client.TaskLimits{
+		MaxGroups: 1,
+		Policy:    client.StopLimitPolicy,
+	}
 	task, err = cli.UpdateTask(task.Link, client.UpdateTaskOptions{
-		ID: newID,
+		Limits: &limits,
 	})
 	if err != nil {
 		t.Fatal(err)
 	}
+	if !reflect.DeepEqual(task.Limits, limits) {
+		t.Errorf("unexpected limits: got %v exp %v", task.Limits, limits)
+	}
+	if _, ok := task.ExecutionStats.NodeStats["window2"]["buffered_points"]; ok {
+		t.Error("expected window point limit to be removed")
+	}
 
-	if got, exp := task.Link.Href, "/kapacitor/v1/tasks/newTaskID"; got != exp {
-		t.Fatalf("unexpected task link got %s exp %s", got, exp)
+	// Exceeding the group limit with the stop policy stops the task.
+	s.MustWrite("mydb", "myrp", `test,host=a value=1 0000000020
+test,host=b value=1 0000000020
+`, v)
+	for i := 0; i < 100; i++ {
+		task, err = cli.Task(task.Link, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if task.Error != "" {
+			break
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	if exp := "limit of 1 groups reached"; !strings.Contains(task.Error, exp) {
+		t.Errorf("unexpected task error: got %q exp error containing %q", task.Error, exp)
 	}
+}
 
-	ti, err = cli.Task(task.Link, nil)
+func TestServer_TaskDependencies(t *testing.T) {
+	s, cli := OpenDefaultServer()
+	defer s.Close()
+
+	tasks := []client.CreateTaskOptions{
+		{
+			ID:    "upstream",
+			Type:  client.StreamTask,
+			DBRPs: []client.DBRP{{Database: "mydb", RetentionPolicy: "myrp"}},
+			TICKscript: `stream
+    |from()
+        .measurement('test')
+    |kapacitorLoopback()
+        .database('loop')
+        .retentionPolicy('autogen')
+        .measurement('looped')
+`,
+			Status: client.Enabled,
+		},
+		{
+			ID:    "downstream",
+			Type:  client.StreamTask,
+			DBRPs: []client.DBRP{{Database: "loop", RetentionPolicy: "autogen"}},
+			TICKscript: `stream
+    |from()
+        .measurement('looped')
+    |kapacitorLoopback()
+        .database('mydb')
+        .retentionPolicy('myrp')
+        .measurement('test')
+`,
+			Status: client.Disabled,
+		},
+	}
+	for _, o := range tasks {
+		if _, err := cli.CreateTask(o); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	deps, err := cli.TaskDependencies()
 	if err != nil {
 		t.Fatal(err)
 	}
-
-	if ti.Error != "" {
-		t.Fatal(ti.Error)
+	exp := client.TaskDependencies{
+		Link:     client.Link{Relation: client.Self, Href: "/kapacitor/v1/task-dependencies"},
+		Tasks:    []string{"downstream", "upstream"},
+		Disabled: []string{"downstream"},
+		Dependencies: []client.TaskDependency{
+			{Upstream: "downstream", Downstream: "upstream", Database: "mydb", RetentionPolicy: "myrp", Measurement: "test"},
+			{Upstream: "upstream", Downstream: "downstream", Database: "loop", RetentionPolicy: "autogen", Measurement: "looped"},
+		},
+		Cycles: [][]string{{"downstream", "upstream"}},
+		Dot: `digraph dependencies {
+"downstream" [style="dashed"];
+"upstream";
+"downstream" -> "upstream" [label="\"mydb\".\"myrp\".test" color="red"];
+"upstream" -> "downstream" [label="\"loop\".\"autogen\".looped" color="red"];
+}`,
 	}
-	if ti.ID != newID {
-		t.Fatalf("unexpected id got %s exp %s", ti.ID, newID)
+	if !reflect.DeepEqual(deps, exp) {
+		t.Errorf("unexpected dependencies:\ngot\n%+v\nexp\n%+v", deps, exp)
 	}
-	if ti.Type != client.StreamTask {
-		t.Fatalf("unexpected type got %v exp %v", ti.Type, client.StreamTask)
+	if exp, got := []string{"upstream"}, deps.Downstream("downstream"); !reflect.DeepEqual(exp, got) {
+		t.Errorf("unexpected downstream tasks: got %v exp %v", got, exp)
 	}
-	if ti.Status != client.Enabled {
-		t.Fatalf("unexpected status got %v exp %v", ti.Status, client.Enabled)
+
+	// Disabling the upstream task reports the enabled tasks it feeds.
+	if _, err := cli.UpdateTask(cli.TaskLink("downstream"), client.UpdateTaskOptions{Status: client.Enabled}); err != nil {
+		t.Fatal(err)
 	}
-	if !reflect.DeepEqual(ti.DBRPs, dbrps) {
-		t.Fatalf("unexpected dbrps got %s exp %s", ti.DBRPs, dbrps)
+	task, err := cli.UpdateTask(cli.TaskLink("upstream"), client.UpdateTaskOptions{Status: client.Disabled})
+	if err != nil {
+		t.Fatal(err)
 	}
-	if ti.TICKscript != tick {
-		t.Fatalf("unexpected TICKscript got %s exp %s", ti.TICKscript, tick)
+	if exp, got := []string{"downstream"}, task.DependentTasks; !reflect.DeepEqual(exp, got) {
+		t.Errorf("unexpected dependent tasks on disable: got %v exp %v", got, exp)
 	}
-	if !ti.Executing {
-		t.Fatal("expected task to be executing")
+
+	// Deleting a task reports the enabled tasks it fed.
+	if _, err := cli.UpdateTask(cli.TaskLink("upstream"), client.UpdateTaskOptions{Status: client.Enabled}); err != nil {
+		t.Fatal(err)
+	}
+	for _, tc := range []struct {
+		id  string
+		exp string
+	}{
+		{id: "upstream", exp: "downstream"},
+		{id: "downstream", exp: ""},
+	} {
+		req, err := http.NewRequest("DELETE", s.URL()+"/tasks/"+tc.id, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusNoContent {
+			t.Fatalf("unexpected status deleting %s: %d", tc.id, resp.StatusCode)
+		}
+		if got := resp.Header.Get("X-Kapacitor-Dependent-Tasks"); got != tc.exp {
+			t.Errorf("unexpected dependent tasks on delete of %s: got %q exp %q", tc.id, got, tc.exp)
+		}
 	}
 }
 
@@ -10147,3 +11942,226 @@ func TestStorage_Backup(t *testing.T) {
 		t.Fatalf("unexpected dot\ngot\n%s\nexp\n%s\n", ti.Dot, dot)
 	}
 }
+
+func TestStorage_Migrate(t *testing.T) {
+	dir, err := ioutil.TempDir("", "kapacitor-migrate")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "migrated.db")
+
+	c := NewConfig()
+	c.Storage.MigrateTargets = []string{"bolt://" + path}
+	s := OpenServer(c)
+	cli := Client(s)
+	defer s.Close()
+
+	id := "testTaskID"
+	tick := `stream
+    |from()
+        .measurement('test')
+`
+	if _, err := cli.CreateTask(client.CreateTaskOptions{
+		ID:         id,
+		Type:       client.StreamTask,
+		DBRPs:      []client.DBRP{{Database: "mydb", RetentionPolicy: "myrp"}},
+		TICKscript: tick,
+		Status:     client.Disabled,
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := cli.MigrateStorage(client.StorageMigrateOptions{
+		To: "bolt://" + filepath.Join(dir, "other.db"),
+	}); err == nil || !strings.Contains(err.Error(), "is not one of the storage migrate-targets") {
+		t.Errorf("expected error migrating to a storage URL not in the migrate-targets, got %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "other.db")); !os.IsNotExist(err) {
+		t.Error("expected storage not to be migrated to a storage URL not in the migrate-targets")
+	}
+
+	m, err := cli.MigrateStorage(client.StorageMigrateOptions{
+		To: "bolt://" + path,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	found := false
+	for _, store := range m.Stores {
+		if store.Namespace == "task_store" {
+			found = true
+			if store.Keys == 0 {
+				t.Error("expected task_store keys to be migrated")
+			}
+		}
+	}
+	if !found {
+		t.Fatalf("task_store not migrated, got %v", m.Stores)
+	}
+
+	// Restart the server on the migrated database
+	s.Stop()
+	s.Config.Storage.BoltDBPath = path
+	s.Start()
+
+	ti, err := cli.Task(cli.TaskLink(id), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ti.Error != "" {
+		t.Fatal(ti.Error)
+	}
+	if ti.TICKscript != tick {
+		t.Fatalf("unexpected TICKscript got %s exp %s", ti.TICKscript, tick)
+	}
+
+	if _, err := cli.MigrateStorage(client.StorageMigrateOptions{To: "nope"}); err == nil {
+		t.Error("expected error migrating to invalid URL")
+	}
+}
+
+func TestStorage_Restore(t *testing.T) {
+	s, cli := OpenDefaultServer()
+	defer s.Close()
+
+	create := func(id string) client.Task {
+		task, err := cli.CreateTask(client.CreateTaskOptions{
+			ID:         id,
+			Type:       client.StreamTask,
+			DBRPs:      []client.DBRP{{Database: "mydb", RetentionPolicy: "myrp"}},
+			TICKscript: "stream\n    |from()\n        .measurement('test')\n",
+			Status:     client.Disabled,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return task
+	}
+	create("backedUp")
+
+	_, r, err := cli.Backup()
+	if err != nil {
+		t.Fatal(err)
+	}
+	backup, err := ioutil.ReadAll(r)
+	r.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	create("notBackedUp")
+
+	restore, err := cli.Restore(bytes.NewReader(backup))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(restore.Stores) == 0 {
+		t.Fatal("expected restored stores")
+	}
+
+	tasks, err := cli.ListTasks(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var ids []string
+	for _, task := range tasks {
+		ids = append(ids, task.ID)
+	}
+	if exp := []string{"backedUp"}; !reflect.DeepEqual(ids, exp) {
+		t.Errorf("unexpected tasks after restore: got %v exp %v", ids, exp)
+	}
+
+	// The stores are read only until the restart loads the restored data.
+	if _, err := cli.CreateTask(client.CreateTaskOptions{
+		ID:         "afterRestore",
+		Type:       client.StreamTask,
+		DBRPs:      []client.DBRP{{Database: "mydb", RetentionPolicy: "myrp"}},
+		TICKscript: "stream\n    |from()\n        .measurement('test')\n",
+		Status:     client.Disabled,
+	}); err == nil || !strings.Contains(err.Error(), "restart Kapacitor") {
+		t.Errorf("expected error creating a task after restore, got %v", err)
+	}
+	s.Restart()
+	cli = Client(s)
+	create("afterRestart")
+
+	// Corrupt backups are rejected
+	if _, err := cli.Restore(bytes.NewReader(backup[:len(backup)/2])); err == nil {
+		t.Error("expected error restoring truncated backup")
+	}
+}
+
+func TestStorage_Check(t *testing.T) {
+	s, cli := OpenDefaultServer()
+	defer s.Close()
+
+	if _, err := cli.CreateTask(client.CreateTaskOptions{
+		ID:         "testTaskID",
+		Type:       client.StreamTask,
+		DBRPs:      []client.DBRP{{Database: "mydb", RetentionPolicy: "myrp"}},
+		TICKscript: "stream\n    |from()\n        .measurement('test')\n",
+		Status:     client.Disabled,
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	check, err := cli.CheckStorage()
+	if err != nil {
+		t.Fatal(err)
+	}
+	found := false
+	for _, store := range check.Stores {
+		if len(store.Corrupt) != 0 {
+			t.Errorf("unexpected corrupt objects in %s: %v", store.Name, store.Corrupt)
+		}
+		if store.Name == "tasks" {
+			found = true
+			if store.Objects != 1 {
+				t.Errorf("unexpected task objects got %d exp 1", store.Objects)
+			}
+		}
+	}
+	if !found {
+		t.Errorf("tasks store not checked, got %v", check.Stores)
+	}
+}
+
+func TestStorage_ScheduledBackups(t *testing.T) {
+	c := NewConfig()
+	c.Storage.BackupDir = MustTempDir()
+	c.Storage.BackupInterval = toml.Duration(10 * time.Millisecond)
+	c.Storage.BackupRetention = 2
+	defer os.RemoveAll(c.Storage.BackupDir)
+	s := OpenServer(c)
+	defer s.Close()
+
+	var backups []string
+	// The backups are named by the second they are made at.
+	for i := 0; i < 150; i++ {
+		time.Sleep(20 * time.Millisecond)
+		var err error
+		backups, err = filepath.Glob(filepath.Join(c.Storage.BackupDir, "kapacitor-*.db"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(backups) == 2 {
+			break
+		}
+	}
+	if len(backups) != 2 {
+		t.Fatalf("unexpected number of backups got %d exp 2", len(backups))
+	}
+	for _, b := range backups {
+		backup, err := storage.OpenBackup(b)
+		if os.IsNotExist(errors.Cause(err)) {
+			// Pruned by a later backup
+			continue
+		}
+		if err != nil {
+			t.Errorf("invalid backup %s: %v", b, err)
+			continue
+		}
+		backup.Close()
+	}
+}
@@ -0,0 +1,266 @@
+package vars
+
+import (
+	"bufio"
+	"expvar"
+	"io"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+
+	kexpvar "github.com/influxdata/kapacitor/expvar"
+)
+
+const (
+	prometheusCounter   = "counter"
+	prometheusGauge     = "gauge"
+	prometheusHistogram = "histogram"
+)
+
+// gaugeNames are the names of the stats that are gauges even though their vars can only be added to,
+// i.e. the number of points a window node buffers.
+var gaugeNames = map[string]bool{
+	NumTasksVarName:         true,
+	NumEnabledTasksVarName:  true,
+	NumSubscriptionsVarName: true,
+	"buffered_points":       true,
+	"buffered_sets":         true,
+	"working_cardinality":   true,
+	// Whether the instance is the high availability leader and the number of cluster members.
+	"leader":  true,
+	"members": true,
+}
+
+type prometheusSample struct {
+	// The suffix of the name of the metric, i.e. _bucket of histograms.
+	suffix string
+	labels map[string]string
+	value  string
+}
+
+type prometheusFamily struct {
+	typ     string
+	samples []prometheusSample
+}
+
+// prometheusFamilies holds the metrics by name, so that the samples of each metric are written together.
+type prometheusFamilies map[string]*prometheusFamily
+
+func (fs prometheusFamilies) add(name, typ string, labels map[string]string, value string) {
+	fs.addSample(name, typ, prometheusSample{labels: labels, value: value})
+}
+
+func (fs prometheusFamilies) addSample(name, typ string, s prometheusSample) {
+	f, ok := fs[name]
+	if !ok {
+		f = &prometheusFamily{typ: typ}
+		fs[name] = f
+	}
+	f.samples = append(f.samples, s)
+}
+
+// addVar adds the value of an int, float or histogram var.
+// Vars that can only be added to are counters, unless their name is a known gauge,
+// all other int and float vars are gauges.
+func (fs prometheusFamilies) addVar(prefix, key string, labels map[string]string, v expvar.Var) {
+	if h, ok := v.(*kexpvar.Histogram); ok {
+		fs.addHistogram(prometheusName(prefix+"_"+key), labels, h.Snapshot())
+		return
+	}
+	typ := prometheusGauge
+	switch v.(type) {
+	case *kexpvar.Int, *kexpvar.IntSum:
+		if !gaugeNames[key] {
+			typ = prometheusCounter
+		}
+	}
+	var value string
+	switch v := v.(type) {
+	case kexpvar.IntVar:
+		value = strconv.FormatInt(v.IntValue(), 10)
+	case kexpvar.FloatVar:
+		value = strconv.FormatFloat(v.FloatValue(), 'g', -1, 64)
+	default:
+		return
+	}
+	name := prometheusName(prefix + "_" + key)
+	if typ == prometheusCounter {
+		name += "_total"
+	}
+	fs.add(name, typ, labels, value)
+}
+
+// addHistogram adds the cumulative buckets, the sum and the count of a histogram.
+func (fs prometheusFamilies) addHistogram(name string, labels map[string]string, h kexpvar.HistogramSnapshot) {
+	var cumulative int64
+	for i, c := range h.Counts {
+		cumulative += c
+		le := "+Inf"
+		if i < len(h.Bounds) {
+			le = strconv.FormatFloat(h.Bounds[i], 'g', -1, 64)
+		}
+		bucketLabels := make(map[string]string, len(labels)+1)
+		for k, v := range labels {
+			bucketLabels[k] = v
+		}
+		bucketLabels["le"] = le
+		fs.addSample(name, prometheusHistogram, prometheusSample{
+			suffix: "_bucket",
+			labels: bucketLabels,
+			value:  strconv.FormatInt(cumulative, 10),
+		})
+	}
+	fs.addSample(name, prometheusHistogram, prometheusSample{
+		suffix: "_sum",
+		labels: labels,
+		value:  strconv.FormatFloat(h.Sum, 'g', -1, 64),
+	})
+	fs.addSample(name, prometheusHistogram, prometheusSample{
+		suffix: "_count",
+		labels: labels,
+		value:  strconv.FormatInt(h.Count, 10),
+	})
+}
+
+// WritePrometheus writes all stats in the Prometheus text exposition format.
+//
+// The stats of each statistic are named by the name of the statistic and the stat,
+// i.e. the errors of nodes are kapacitor_nodes_errors_total,
+// and are labeled by the tags of the statistic, i.e. task, node and type.
+// The Go runtime stats are named like the stats of the Prometheus Go client.
+func WritePrometheus(w io.Writer) error {
+	fs := make(prometheusFamilies)
+
+	// Global expvars
+	expvar.Do(func(kv expvar.KeyValue) {
+		if _, ok := kv.Value.(*kexpvar.Map); ok {
+			return
+		}
+		fs.addVar(Product, kv.Key, nil, kv.Value)
+	})
+	fs.add(Product+"_uptime_seconds", prometheusGauge, nil, strconv.FormatFloat(uptime().Seconds(), 'g', -1, 64))
+	fs.add(Product+"_info", prometheusGauge, map[string]string{
+		ClusterIDVarName: ClusterIDVar.StringValue(),
+		ServerIDVarName:  ServerIDVar.StringValue(),
+		HostVarName:      HostVar.StringValue(),
+		VersionVarName:   VersionVar.StringValue(),
+	}, "1")
+
+	// All other specific statistics
+	stats.Do(func(kv expvar.KeyValue) {
+		var name string
+		labels := make(map[string]string)
+		var values *kexpvar.Map
+		kv.Value.(*kexpvar.Map).Do(func(subKV expvar.KeyValue) {
+			switch subKV.Key {
+			case "name":
+				name = subKV.Value.(*kexpvar.String).StringValue()
+			case "tags":
+				subKV.Value.(*kexpvar.Map).Do(func(t expvar.KeyValue) {
+					labels[prometheusName(t.Key)] = t.Value.(kexpvar.StringVar).StringValue()
+				})
+			case "values":
+				values = subKV.Value.(*kexpvar.Map)
+			}
+		})
+		if values == nil {
+			return
+		}
+		values.Do(func(v expvar.KeyValue) {
+			fs.addVar(Product+"_"+name, v.Key, labels, v.Value)
+		})
+	})
+
+	// Go runtime stats
+	var rt runtime.MemStats
+	runtime.ReadMemStats(&rt)
+	for _, m := range []struct {
+		name  string
+		typ   string
+		value float64
+	}{
+		{"go_goroutines", prometheusGauge, float64(runtime.NumGoroutine())},
+		{"go_memstats_alloc_bytes", prometheusGauge, float64(rt.Alloc)},
+		{"go_memstats_alloc_bytes_total", prometheusCounter, float64(rt.TotalAlloc)},
+		{"go_memstats_sys_bytes", prometheusGauge, float64(rt.Sys)},
+		{"go_memstats_lookups_total", prometheusCounter, float64(rt.Lookups)},
+		{"go_memstats_mallocs_total", prometheusCounter, float64(rt.Mallocs)},
+		{"go_memstats_frees_total", prometheusCounter, float64(rt.Frees)},
+		{"go_memstats_heap_alloc_bytes", prometheusGauge, float64(rt.HeapAlloc)},
+		{"go_memstats_heap_sys_bytes", prometheusGauge, float64(rt.HeapSys)},
+		{"go_memstats_heap_idle_bytes", prometheusGauge, float64(rt.HeapIdle)},
+		{"go_memstats_heap_inuse_bytes", prometheusGauge, float64(rt.HeapInuse)},
+		{"go_memstats_heap_released_bytes", prometheusGauge, float64(rt.HeapReleased)},
+		{"go_memstats_heap_objects", prometheusGauge, float64(rt.HeapObjects)},
+		{"go_memstats_gc_pause_seconds_total", prometheusCounter, float64(rt.PauseTotalNs) / 1e9},
+		{"go_memstats_gc_total", prometheusCounter, float64(rt.NumGC)},
+	} {
+		fs.add(m.name, m.typ, nil, strconv.FormatFloat(m.value, 'g', -1, 64))
+	}
+
+	return fs.write(w)
+}
+
+// write writes the metrics sorted by name.
+func (fs prometheusFamilies) write(w io.Writer) error {
+	names := make([]string, 0, len(fs))
+	for name := range fs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	bw := bufio.NewWriter(w)
+	for _, name := range names {
+		f := fs[name]
+		bw.WriteString("# TYPE ")
+		bw.WriteString(name)
+		bw.WriteByte(' ')
+		bw.WriteString(f.typ)
+		bw.WriteByte('\n')
+		for _, s := range f.samples {
+			bw.WriteString(name)
+			bw.WriteString(s.suffix)
+			writePrometheusLabels(bw, s.labels)
+			bw.WriteByte(' ')
+			bw.WriteString(s.value)
+			bw.WriteByte('\n')
+		}
+	}
+	return bw.Flush()
+}
+
+func writePrometheusLabels(w *bufio.Writer, labels map[string]string) {
+	if len(labels) == 0 {
+		return
+	}
+	keys := make([]string, 0, len(labels))
+	for k := range labels {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	w.WriteByte('{')
+	for i, k := range keys {
+		if i > 0 {
+			w.WriteByte(',')
+		}
+		w.WriteString(k)
+		w.WriteString(`="`)
+		w.WriteString(labelValueReplacer.Replace(labels[k]))
+		w.WriteByte('"')
+	}
+	w.WriteByte('}')
+}
+
+var labelValueReplacer = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+// prometheusName replaces the characters that are not valid in metric and label names with underscores.
+func prometheusName(name string) string {
+	b := []byte(name)
+	for i, c := range b {
+		if !(c == '_' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || i > 0 && c >= '0' && c <= '9') {
+			b[i] = '_'
+		}
+	}
+	return string(b)
+}
@@ -122,6 +122,10 @@ func GetStatsData() ([]StatsData, error) {
 						data.Values[kv.Key] = v.IntValue()
 					case kexpvar.FloatVar:
 						data.Values[kv.Key] = v.FloatValue()
+					case *kexpvar.Histogram:
+						h := v.Snapshot()
+						data.Values[kv.Key+"_count"] = h.Count
+						data.Values[kv.Key+"_sum"] = h.Sum
 					default:
 						panic(fmt.Sprintf("unknown expvar.Var type for stats %T", kv.Value))
 					}
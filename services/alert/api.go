@@ -13,6 +13,7 @@ import (
 	jsonpatch "github.com/evanphx/json-patch"
 	"github.com/influxdata/kapacitor/alert"
 	client "github.com/influxdata/kapacitor/client/v1"
+	"github.com/influxdata/kapacitor/labels"
 	"github.com/influxdata/kapacitor/services/httpd"
 )
 
@@ -277,6 +278,7 @@ func (s *apiServer) convertHandlerSpec(spec HandlerSpec) client.TopicHandler {
 		Kind:    spec.Kind,
 		Options: spec.Options,
 		Match:   spec.Match,
+		Labels:  spec.Labels,
 	}
 }
 
@@ -333,15 +335,23 @@ func (s *apiServer) handleListHandlers(topic string, w http.ResponseWriter, r *h
 		httpd.HttpError(w, fmt.Sprint("invalid pattern: ", err.Error()), true, http.StatusBadRequest)
 		return
 	}
+	selector, err := labels.ParseSelector(r.URL.Query().Get("labels"))
+	if err != nil {
+		httpd.HttpError(w, fmt.Sprint("invalid labels: ", err.Error()), true, http.StatusBadRequest)
+		return
+	}
 	specs, err := s.Registrar.HandlerSpecs(topic, pattern)
 	if err != nil {
 		httpd.HttpError(w, fmt.Sprint("failed to get handler specs: ", err.Error()), true, http.StatusInternalServerError)
 		return
 	}
 
-	handlers := make([]client.TopicHandler, len(specs))
-	for i, spec := range specs {
-		handlers[i] = s.convertHandlerSpec(spec)
+	handlers := make([]client.TopicHandler, 0, len(specs))
+	for _, spec := range specs {
+		if !selector.Matches(spec.Labels) {
+			continue
+		}
+		handlers = append(handlers, s.convertHandlerSpec(spec))
 	}
 	sort.Sort(sortedHandlers(handlers))
 	th := client.TopicHandlers{
@@ -8,6 +8,7 @@ import (
 	"time"
 
 	"github.com/influxdata/kapacitor/alert"
+	"github.com/influxdata/kapacitor/labels"
 	"github.com/influxdata/kapacitor/services/storage"
 	"github.com/pkg/errors"
 )
@@ -46,6 +47,7 @@ type HandlerSpecDAO interface {
 	ListTx(tx storage.ReadOnlyTx, topic, pattern string, offset, limit int) ([]HandlerSpec, error)
 
 	Rebuild() error
+	Check() (storage.CheckResult, error)
 }
 
 //--------------------------------------------------------------------
@@ -69,6 +71,7 @@ type HandlerSpec struct {
 	Kind    string                 `json:"kind"`
 	Options map[string]interface{} `json:"options"`
 	Match   string                 `json:"match"`
+	Labels  map[string]string      `json:"labels,omitempty"`
 }
 
 var validHandlerID = regexp.MustCompile(`^[-\._\p{L}0-9]+$`)
@@ -84,6 +87,9 @@ func (h HandlerSpec) Validate() error {
 	if h.Kind == "" {
 		return errors.New("handler Kind must not be empty")
 	}
+	if err := labels.Validate(h.Labels); err != nil {
+		return err
+	}
 	return nil
 }
 
@@ -124,10 +130,22 @@ const (
 	handlerPrefix = "handlers"
 )
 
+const labelsIndex = "labels"
+
 func newHandlerSpecKV(store storage.Interface) (*handlerSpecKV, error) {
 	c := storage.DefaultIndexedStoreConfig(handlerPrefix, func() storage.BinaryObject {
 		return new(HandlerSpec)
 	})
+	c.Indexes = append(c.Indexes, storage.Index{
+		Name: labelsIndex,
+		ValuesFunc: func(o storage.BinaryObject) ([]string, error) {
+			h, ok := o.(*HandlerSpec)
+			if !ok {
+				return nil, storage.ImpossibleTypeErr(h, o)
+			}
+			return labels.IndexValues(h.Labels), nil
+		},
+	})
 	istore, err := storage.NewIndexedStore(store, c)
 	if err != nil {
 		return nil, err
@@ -216,6 +234,10 @@ func (kv *handlerSpecKV) Rebuild() error {
 	return kv.store.Rebuild()
 }
 
+func (kv *handlerSpecKV) Check() (storage.CheckResult, error) {
+	return kv.store.Check()
+}
+
 var (
 	ErrNoTopicStateExists = errors.New("no topic state exists")
 )
@@ -239,6 +261,7 @@ type TopicStateDAO interface {
 	List(pattern string, offset, limit int) ([]TopicState, error)
 
 	Rebuild() error
+	Check() (storage.CheckResult, error)
 }
 
 const topicStateVersion = 1
@@ -338,3 +361,7 @@ func (kv *topicStateKV) List(pattern string, offset, limit int) ([]TopicState, e
 func (kv *topicStateKV) Rebuild() error {
 	return kv.store.Rebuild()
 }
+
+func (kv *topicStateKV) Check() (storage.CheckResult, error) {
+	return kv.store.Check()
+}
@@ -71,6 +71,10 @@ type Service struct {
 
 	Commander command.Commander
 
+	ClusterService interface {
+		Watch(namespace string, f func())
+	}
+
 	diag Diagnostic
 
 	AlertaService interface {
@@ -178,6 +182,9 @@ func (s *Service) Open() error {
 		return err
 	}
 
+	// Follow the handler specs changed by other members.
+	s.ClusterService.Watch(alertNamespace, s.syncHandlerSpecs)
+
 	s.APIServer.HTTPDService = s.HTTPDService
 	if err := s.APIServer.Open(); err != nil {
 		return err
@@ -341,6 +348,64 @@ func (s *Service) loadSavedHandlerSpecs() error {
 	return nil
 }
 
+// syncHandlerSpecs registers, replaces and deregisters the handlers
+// so that they match the saved handler specs.
+func (s *Service) syncHandlerSpecs() {
+	saved := make(map[string]map[string]bool)
+	var specs []HandlerSpec
+	offset := 0
+	limit := 100
+	for {
+		page, err := s.specsDAO.List("*", "", offset, limit)
+		if err != nil {
+			s.diag.Error("failed to list handler specs", err)
+			return
+		}
+		specs = append(specs, page...)
+		offset += limit
+		if len(page) != limit {
+			break
+		}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, spec := range specs {
+		if saved[spec.Topic] == nil {
+			saved[spec.Topic] = make(map[string]bool)
+		}
+		saved[spec.Topic][spec.ID] = true
+
+		old, ok := s.handlers[spec.Topic][spec.ID]
+		if ok && reflect.DeepEqual(old.Spec, spec) {
+			continue
+		}
+		h, err := s.createHandlerFromSpec(spec)
+		if err != nil {
+			s.diag.Error("failed to load handler", err)
+			continue
+		}
+		s.setTopicHandler(spec.Topic, spec.ID, h)
+		if ok {
+			s.topics.ReplaceHandler(spec.Topic, old.Handler, h.Handler)
+		} else {
+			s.topics.RegisterHandler(spec.Topic, h.Handler)
+		}
+	}
+	for topic, handlers := range s.handlers {
+		for id, h := range handlers {
+			if saved[topic][id] {
+				continue
+			}
+			s.topics.DeregisterHandler(topic, h.Handler)
+			if ha, ok := h.Handler.(closer); ok {
+				ha.Close()
+			}
+			delete(handlers, id)
+		}
+	}
+}
+
 func (s *Service) convertEventStatesToAlert(states map[string]EventState) map[string]alert.EventState {
 	newStates := make(map[string]alert.EventState, len(states))
 	for id, state := range states {
@@ -681,6 +746,36 @@ func (s *Service) HandlerSpecs(topic, pattern string) ([]HandlerSpec, error) {
 	return handlers, nil
 }
 
+// AllHandlerSpecs returns the handler specs of every topic.
+func (s *Service) AllHandlerSpecs() ([]HandlerSpec, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var handlers []HandlerSpec
+	for _, topicHandlers := range s.handlers {
+		for _, h := range topicHandlers {
+			handlers = append(handlers, h.Spec)
+		}
+	}
+	return handlers, nil
+}
+
+// ValidateHandlerSpec checks that a handler can be created from the spec
+// without registering it.
+func (s *Service) ValidateHandlerSpec(spec HandlerSpec) error {
+	if err := spec.Validate(); err != nil {
+		return err
+	}
+	h, err := s.createHandlerFromSpec(spec)
+	if err != nil {
+		return err
+	}
+	if c, ok := h.Handler.(closer); ok {
+		c.Close()
+	}
+	return nil
+}
+
 func decodeOptions(options map[string]interface{}, c interface{}) error {
 	dec, err := mapstructure.NewDecoder(&mapstructure.DecoderConfig{
 		ErrorUnused: true,
@@ -0,0 +1,45 @@
+package audit
+
+import "fmt"
+
+const (
+	// Default maximum size of the audit log before it is rotated, 100MB.
+	DefaultMaxSize = 100 * 1024 * 1024
+	// Default number of rotated audit logs kept.
+	DefaultMaxBackups = 5
+)
+
+type Config struct {
+	// Record mutating API requests.
+	Enabled bool `toml:"enabled"`
+	// Path to the JSON lines audit log.
+	Path string `toml:"path"`
+	// Size in bytes at which the log is rotated.
+	MaxSize int64 `toml:"max-size"`
+	// Number of rotated logs kept as path.1 through path.N.
+	MaxBackups int `toml:"max-backups"`
+}
+
+func NewConfig() Config {
+	return Config{
+		Path:       "./audit.log",
+		MaxSize:    DefaultMaxSize,
+		MaxBackups: DefaultMaxBackups,
+	}
+}
+
+func (c Config) Validate() error {
+	if !c.Enabled {
+		return nil
+	}
+	if c.Path == "" {
+		return fmt.Errorf("must specify audit log path")
+	}
+	if c.MaxSize <= 0 {
+		return fmt.Errorf("max-size must be positive, got %d", c.MaxSize)
+	}
+	if c.MaxBackups < 0 {
+		return fmt.Errorf("max-backups must not be negative, got %d", c.MaxBackups)
+	}
+	return nil
+}
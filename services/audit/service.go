@@ -0,0 +1,320 @@
+// Package audit records mutating API requests to a rotating JSON lines file
+// and serves the recorded requests through the /audit API endpoint.
+package audit
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/influxdata/kapacitor/audit"
+	"github.com/influxdata/kapacitor/services/httpd"
+	"github.com/pkg/errors"
+)
+
+const (
+	auditPath = "/audit"
+
+	// Default number of records returned by the /audit endpoint.
+	defaultQueryLimit = 100
+)
+
+type Diagnostic interface {
+	Error(msg string, err error)
+}
+
+type Service struct {
+	path       string
+	maxSize    int64
+	maxBackups int
+
+	mu   sync.Mutex
+	file *os.File
+	size int64
+
+	routes []httpd.Route
+
+	HTTPDService interface {
+		AddRoutes([]httpd.Route) error
+		DelRoutes([]httpd.Route)
+	}
+
+	diag Diagnostic
+}
+
+func NewService(c Config, d Diagnostic) *Service {
+	return &Service{
+		path:       c.Path,
+		maxSize:    c.MaxSize,
+		maxBackups: c.MaxBackups,
+		diag:       d,
+	}
+}
+
+func (s *Service) Open() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.openFile(); err != nil {
+		return err
+	}
+
+	s.routes = []httpd.Route{
+		{
+			Method:      "GET",
+			Pattern:     auditPath,
+			HandlerFunc: s.handleListRecords,
+		},
+	}
+	return s.HTTPDService.AddRoutes(s.routes)
+}
+
+func (s *Service) Close() error {
+	if s.HTTPDService != nil {
+		s.HTTPDService.DelRoutes(s.routes)
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.file != nil {
+		err := s.file.Close()
+		s.file = nil
+		return err
+	}
+	return nil
+}
+
+// openFile opens the audit log for appending.
+func (s *Service) openFile() error {
+	f, err := os.OpenFile(s.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		return errors.Wrap(err, "failed to open audit log")
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return errors.Wrap(err, "failed to stat audit log")
+	}
+	s.file = f
+	s.size = info.Size()
+	return nil
+}
+
+// Record appends the record to the audit log, rotating the log if it would exceed its maximum size.
+func (s *Service) Record(r audit.Record) {
+	data, err := json.Marshal(r)
+	if err != nil {
+		s.diag.Error("failed to encode audit record", err)
+		return
+	}
+	data = append(data, '\n')
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.file == nil {
+		return
+	}
+	if s.size > 0 && s.size+int64(len(data)) > s.maxSize {
+		if err := s.rotate(); err != nil {
+			s.diag.Error("failed to rotate audit log", err)
+			if s.file == nil {
+				return
+			}
+		}
+	}
+	n, err := s.file.Write(data)
+	s.size += int64(n)
+	if err != nil {
+		s.diag.Error("failed to write audit record", err)
+	}
+}
+
+// rotate shifts each backup path.i to path.i+1, moves the log to path.1 and opens a new empty log.
+// The oldest backup beyond max-backups is overwritten.
+func (s *Service) rotate() error {
+	if err := s.file.Close(); err != nil {
+		return err
+	}
+	s.file = nil
+	if s.maxBackups == 0 {
+		if err := os.Remove(s.path); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	} else {
+		for i := s.maxBackups - 1; i > 0; i-- {
+			if err := os.Rename(s.backupPath(i), s.backupPath(i+1)); err != nil && !os.IsNotExist(err) {
+				return err
+			}
+		}
+		if err := os.Rename(s.path, s.backupPath(1)); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	return s.openFile()
+}
+
+func (s *Service) backupPath(i int) string {
+	return fmt.Sprintf("%s.%d", s.path, i)
+}
+
+// Filter selects audit records.
+type Filter struct {
+	// Records at or after Start, ignored if zero.
+	Start time.Time
+	// Records before Stop, ignored if zero.
+	Stop time.Time
+	// Records of the user, ignored if empty.
+	User string
+	// Records of resources with the prefix, ignored if empty.
+	Resource string
+}
+
+func (f Filter) Match(r audit.Record) bool {
+	if !f.Start.IsZero() && r.Time.Before(f.Start) {
+		return false
+	}
+	if !f.Stop.IsZero() && !r.Time.Before(f.Stop) {
+		return false
+	}
+	if f.User != "" && r.User != f.User {
+		return false
+	}
+	if f.Resource != "" && !strings.HasPrefix(r.Resource, f.Resource) {
+		return false
+	}
+	return true
+}
+
+// Records returns up to limit of the most recent records that match the filter, newest first.
+func (s *Service) Records(f Filter, limit int) ([]audit.Record, error) {
+	files, err := s.openLogs()
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		for _, file := range files {
+			file.Close()
+		}
+	}()
+
+	var records []audit.Record
+	// Read the current log first and then each backup from newest to oldest.
+	for _, file := range files {
+		if len(records) >= limit {
+			break
+		}
+		matches, err := readRecords(file, f, limit-len(records))
+		if err != nil {
+			return nil, err
+		}
+		for j := len(matches) - 1; j >= 0; j-- {
+			records = append(records, matches[j])
+		}
+	}
+	return records, nil
+}
+
+// openLogs opens the current log and each backup from newest to oldest.
+// The files are opened while holding the lock so that a concurrent rotation cannot shift them,
+// they are read afterwards without blocking new records.
+func (s *Service) openLogs() ([]*os.File, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	files := make([]*os.File, 0, s.maxBackups+1)
+	for i := 0; i <= s.maxBackups; i++ {
+		p := s.path
+		if i > 0 {
+			p = s.backupPath(i)
+		}
+		file, err := os.Open(p)
+		if err != nil {
+			if os.IsNotExist(err) {
+				continue
+			}
+			for _, f := range files {
+				f.Close()
+			}
+			return nil, err
+		}
+		files = append(files, file)
+	}
+	return files, nil
+}
+
+// readRecords reads the last limit records of the log file that match the filter, oldest first.
+func readRecords(file *os.File, f Filter, limit int) ([]audit.Record, error) {
+	records := make([]audit.Record, 0, limit)
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(nil, 1024*1024)
+	for scanner.Scan() {
+		var r audit.Record
+		if err := json.Unmarshal(scanner.Bytes(), &r); err != nil {
+			// Skip partially written records.
+			continue
+		}
+		if !f.Match(r) {
+			continue
+		}
+		if len(records) == limit {
+			// Keep only the most recent matches.
+			records = append(records[1:], r)
+			continue
+		}
+		records = append(records, r)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, errors.Wrapf(err, "failed to read audit log %q", file.Name())
+	}
+	return records, nil
+}
+
+func (s *Service) handleListRecords(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	f := Filter{
+		User:     q.Get("user"),
+		Resource: q.Get("resource"),
+	}
+	var err error
+	if start := q.Get("start"); start != "" {
+		f.Start, err = time.Parse(time.RFC3339Nano, start)
+		if err != nil {
+			httpd.HttpError(w, fmt.Sprintf("invalid start parameter %q must be an RFC3339 time: %s", start, err), true, http.StatusBadRequest)
+			return
+		}
+	}
+	if stop := q.Get("stop"); stop != "" {
+		f.Stop, err = time.Parse(time.RFC3339Nano, stop)
+		if err != nil {
+			httpd.HttpError(w, fmt.Sprintf("invalid stop parameter %q must be an RFC3339 time: %s", stop, err), true, http.StatusBadRequest)
+			return
+		}
+	}
+
+	limit := int64(defaultQueryLimit)
+	if limitStr := q.Get("limit"); limitStr != "" {
+		limit, err = strconv.ParseInt(limitStr, 10, 64)
+		if err != nil || limit <= 0 {
+			httpd.HttpError(w, fmt.Sprintf("invalid limit parameter %q must be a positive integer", limitStr), true, http.StatusBadRequest)
+			return
+		}
+	}
+
+	records, err := s.Records(f, int(limit))
+	if err != nil {
+		httpd.HttpError(w, fmt.Sprintf("failed to read audit records: %s", err), true, http.StatusInternalServerError)
+		return
+	}
+	response := struct {
+		Records []audit.Record `json:"records"`
+	}{
+		Records: records,
+	}
+	if response.Records == nil {
+		response.Records = []audit.Record{}
+	}
+	w.Write(httpd.MarshalJSON(response, true))
+}
@@ -0,0 +1,99 @@
+package audit
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/influxdata/kapacitor/audit"
+)
+
+type diag struct {
+	t *testing.T
+}
+
+func (d diag) Error(msg string, err error) {
+	d.t.Errorf("%s: %v", msg, err)
+}
+
+func TestService_Rotate(t *testing.T) {
+	dir, err := ioutil.TempDir("", "audit-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	c := NewConfig()
+	c.Enabled = true
+	c.Path = filepath.Join(dir, "audit.log")
+	// Each record is a little over 100 bytes, so the log is rotated after every second record.
+	c.MaxSize = 250
+	c.MaxBackups = 2
+	s := NewService(c, diag{t: t})
+	if err := s.openFile(); err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	start := time.Date(2017, 1, 1, 0, 0, 0, 0, time.UTC)
+	users := []string{"alice", "bob"}
+	for i := 0; i < 8; i++ {
+		s.Record(audit.Record{
+			Time:     start.Add(time.Duration(i) * time.Minute),
+			User:     users[i%2],
+			Resource: "/tasks/t",
+			Action:   audit.UpdateAction,
+			Method:   "PATCH",
+			Status:   200,
+		})
+	}
+
+	for _, p := range []string{c.Path, c.Path + ".1", c.Path + ".2"} {
+		if _, err := os.Stat(p); err != nil {
+			t.Errorf("expected log file %s: %v", p, err)
+		}
+	}
+	if _, err := os.Stat(c.Path + ".3"); !os.IsNotExist(err) {
+		t.Errorf("expected only %d backups", c.MaxBackups)
+	}
+
+	// The two oldest records were rotated out.
+	records, err := s.Records(Filter{}, 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, exp := len(records), 6; got != exp {
+		t.Fatalf("unexpected number of records: got %d exp %d", got, exp)
+	}
+	for i, r := range records {
+		if exp := start.Add(time.Duration(7-i) * time.Minute); !r.Time.Equal(exp) {
+			t.Errorf("unexpected time of record %d: got %v exp %v", i, r.Time, exp)
+		}
+	}
+
+	records, err = s.Records(Filter{User: "alice", Start: start.Add(5 * time.Minute)}, 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, exp := len(records), 1; got != exp {
+		t.Fatalf("unexpected number of filtered records: got %d exp %d", got, exp)
+	}
+	if exp := start.Add(6 * time.Minute); !records[0].Time.Equal(exp) {
+		t.Errorf("unexpected time of filtered record: got %v exp %v", records[0].Time, exp)
+	}
+
+	records, err = s.Records(Filter{}, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, exp := len(records), 3; got != exp {
+		t.Fatalf("unexpected number of limited records: got %d exp %d", got, exp)
+	}
+	for i, r := range records {
+		if exp := start.Add(time.Duration(7-i) * time.Minute); !r.Time.Equal(exp) {
+			t.Errorf("unexpected time of limited record %d: got %v exp %v", i, r.Time, exp)
+		}
+	}
+}
@@ -0,0 +1,82 @@
+package cluster
+
+import (
+	"fmt"
+	"net/url"
+	"time"
+
+	"github.com/influxdata/influxdb/toml"
+)
+
+const (
+	DefaultHeartbeatInterval = toml.Duration(2 * time.Second)
+	DefaultMemberTimeout     = toml.Duration(10 * time.Second)
+	DefaultVirtualNodes      = 64
+)
+
+type Config struct {
+	Enabled bool `toml:"enabled"`
+	// Name uniquely identifies this member in the cluster.
+	// Defaults to the hostname.
+	Name string `toml:"name"`
+	// AdvertiseURL is the URL of the HTTP API of this member as reachable by the other members.
+	// Defaults to the hostname and the port of the HTTP API.
+	AdvertiseURL string `toml:"advertise-url"`
+	// Members is a static list of URLs of the HTTP API of other members.
+	// It only needs to name some of the members, the rest are learned from them.
+	Members []string `toml:"members"`
+	// DiscovererService and DiscovererID name a discoverer, i.e. a [[dns]] or [[static-discovery]] section,
+	// that finds the addresses of other members.
+	DiscovererService string `toml:"discoverer-service"`
+	DiscovererID      string `toml:"discoverer-id"`
+	// HeartbeatInterval is how often the members are pinged.
+	HeartbeatInterval toml.Duration `toml:"heartbeat-interval"`
+	// MemberTimeout is how long a member may not be heard from before it is considered dead
+	// and its tasks are reassigned.
+	MemberTimeout toml.Duration `toml:"member-timeout"`
+	// VirtualNodes is the number of points of each member on the hash ring.
+	VirtualNodes int `toml:"virtual-nodes"`
+	// Username and Password authenticate the requests to other members,
+	// when authentication is enabled on their HTTP API.
+	Username string `toml:"username"`
+	Password string `toml:"password"`
+	// InsecureSkipVerify skips the verification of the certificates of the other members.
+	InsecureSkipVerify bool `toml:"insecure-skip-verify"`
+}
+
+func NewConfig() Config {
+	return Config{
+		HeartbeatInterval: DefaultHeartbeatInterval,
+		MemberTimeout:     DefaultMemberTimeout,
+		VirtualNodes:      DefaultVirtualNodes,
+	}
+}
+
+func (c Config) Validate() error {
+	if !c.Enabled {
+		return nil
+	}
+	if c.AdvertiseURL != "" {
+		if _, err := url.Parse(c.AdvertiseURL); err != nil {
+			return fmt.Errorf("invalid advertise-url %q: %v", c.AdvertiseURL, err)
+		}
+	}
+	for _, m := range c.Members {
+		if _, err := url.Parse(memberURL(m)); err != nil {
+			return fmt.Errorf("invalid member %q: %v", m, err)
+		}
+	}
+	if (c.DiscovererService == "") != (c.DiscovererID == "") {
+		return fmt.Errorf("discoverer-service and discoverer-id must be set together")
+	}
+	if c.HeartbeatInterval <= 0 {
+		return fmt.Errorf("heartbeat-interval must be positive")
+	}
+	if c.MemberTimeout <= c.HeartbeatInterval {
+		return fmt.Errorf("member-timeout must be greater than heartbeat-interval")
+	}
+	if c.VirtualNodes < 1 {
+		return fmt.Errorf("virtual-nodes must be positive")
+	}
+	return nil
+}
@@ -0,0 +1,431 @@
+package cluster
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/influxdata/kapacitor/keyvalue"
+	"github.com/influxdata/kapacitor/services/httpd"
+	"github.com/influxdata/kapacitor/services/storage"
+)
+
+// Store returns the namespaced store of the storage service.
+// The changes to the store are replicated to all members of the cluster.
+func (s *Service) Store(namespace string) storage.Interface {
+	store := s.StorageService.Store(namespace)
+	if !s.conf.Enabled {
+		return store
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if r, ok := s.wrapped[namespace]; ok {
+		return r
+	}
+	if s.versions == nil {
+		s.versions = s.StorageService.Store(versionsNamespace)
+	}
+	r := &replicatedStore{
+		namespace: namespace,
+		store:     store,
+		s:         s,
+	}
+	s.stores[namespace] = store
+	s.wrapped[namespace] = r
+	return r
+}
+
+func (s *Service) Register(name string, store storage.StoreActioner) {
+	s.StorageService.Register(name, store)
+}
+
+func (s *Service) Versions() storage.Versions {
+	return s.StorageService.Versions()
+}
+
+var (
+	errQueueFull        = errors.New("request queue is full")
+	errUnknownNamespace = errors.New("unknown namespace")
+)
+
+// versionsNamespace stores the version of each replicated key, by namespace and key.
+const versionsNamespace = "cluster_versions"
+
+// version orders the changes to a key made by different members,
+// so that each member keeps the latest change no matter the order it receives the changes in.
+// Deleted keys keep their version as a tombstone, so that a member that missed the delete
+// does not add the key back once it rejoins.
+type version struct {
+	// Time of the change in nanoseconds, it always increases for a key.
+	Time int64 `json:"time"`
+	// Member that made the change, it breaks ties between changes made at the same time.
+	Member  string `json:"member"`
+	Deleted bool   `json:"deleted,omitempty"`
+}
+
+// newer reports whether the change of v replaces the change of o.
+func (v version) newer(o version) bool {
+	if v.Time != o.Time {
+		return v.Time > o.Time
+	}
+	return v.Member > o.Member
+}
+
+func versionKey(namespace, key string) string {
+	return namespace + "/" + key
+}
+
+// getVersion returns the version of the key, the zero version if the key was never changed by a member.
+func getVersion(tx storage.ReadOnlyTx, namespace, key string) (version, error) {
+	var v version
+	kv, err := tx.Get(versionKey(namespace, key))
+	if err != nil {
+		if err == storage.ErrNoKeyExists {
+			return v, nil
+		}
+		return v, err
+	}
+	err = json.Unmarshal(kv.Value, &v)
+	return v, err
+}
+
+// op is a change to a key of a store.
+type op struct {
+	Key    string `json:"key"`
+	Value  []byte `json:"value,omitempty"`
+	Delete bool   `json:"delete,omitempty"`
+	// Version is zero for changes sent by members that do not version their changes.
+	Version version `json:"version"`
+}
+
+type replication struct {
+	Namespace string `json:"namespace"`
+	Ops       []op   `json:"ops"`
+}
+
+// replicate sends the changes of a committed transaction to all members.
+func (s *Service) replicate(namespace string, ops []op) {
+	if len(ops) > 0 {
+		body, err := json.Marshal(replication{Namespace: namespace, Ops: ops})
+		if err != nil {
+			s.diag.Error("failed to encode replication", err)
+			return
+		}
+		r := request{
+			path: storagePath,
+			body: body,
+		}
+		var missed []*member
+		s.mu.RLock()
+		for _, m := range s.members {
+			if !s.queue(m, r) {
+				s.diag.Error("failed to replicate changes to member", errQueueFull, keyvalue.KV("member", m.Name))
+				missed = append(missed, m)
+			}
+		}
+		s.mu.RUnlock()
+		if len(missed) > 0 {
+			// Catch up on the changes the members missed.
+			s.mu.Lock()
+			for _, m := range missed {
+				m.merged = false
+			}
+			s.mu.Unlock()
+		}
+		s.statMap.Add(statReplicatedOps, int64(len(ops)))
+	}
+}
+
+// stamp sets the versions of the changes made by this member and records them.
+// Must be called with the update lock held.
+func (s *Service) stamp(namespace string, ops []op) error {
+	now := time.Now().UnixNano()
+	return s.versions.Update(func(tx storage.Tx) error {
+		for i := range ops {
+			prev, err := getVersion(tx, namespace, ops[i].Key)
+			if err != nil {
+				return err
+			}
+			t := now
+			if t <= prev.Time {
+				t = prev.Time + 1
+			}
+			ops[i].Version = version{Time: t, Member: s.name, Deleted: ops[i].Delete}
+			if err := putVersion(tx, namespace, ops[i]); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func putVersion(tx storage.Tx, namespace string, o op) error {
+	data, err := json.Marshal(o.Version)
+	if err != nil {
+		return err
+	}
+	return tx.Put(versionKey(namespace, o.Key), data)
+}
+
+// apply applies the changes of another member that are newer than the changes of this member
+// to the underlying store of the namespace.
+// Unversioned changes are always applied.
+func (s *Service) apply(namespace string, ops []op) error {
+	s.mu.RLock()
+	store, ok := s.stores[namespace]
+	s.mu.RUnlock()
+	if !ok {
+		return errUnknownNamespace
+	}
+
+	s.updateMu.Lock()
+	defer s.updateMu.Unlock()
+	var newer []op
+	err := s.versions.View(func(tx storage.ReadOnlyTx) error {
+		for _, o := range ops {
+			if o.Version.Time == 0 {
+				newer = append(newer, o)
+				continue
+			}
+			local, err := getVersion(tx, namespace, o.Key)
+			if err != nil {
+				return err
+			}
+			if o.Version.newer(local) {
+				newer = append(newer, o)
+			}
+		}
+		return nil
+	})
+	if err != nil || len(newer) == 0 {
+		return err
+	}
+	err = store.Update(func(tx storage.Tx) error {
+		for _, o := range newer {
+			var err error
+			if o.Delete {
+				err = tx.Delete(o.Key)
+			} else {
+				// Empty values are decoded as nil
+				err = tx.Put(o.Key, append([]byte{}, o.Value...))
+			}
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	err = s.versions.Update(func(tx storage.Tx) error {
+		for _, o := range newer {
+			if o.Version.Time == 0 {
+				continue
+			}
+			if err := putVersion(tx, namespace, o); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	s.notify(namespace)
+	return nil
+}
+
+// snapshot holds the keys of a store with their versions and the tombstones of its deleted keys.
+type snapshot struct {
+	KeyValues []op `json:"key_values"`
+}
+
+// merge applies the changes of the stores of a member which are newer than the changes of this member,
+// including deletes, so that a member catches up on the changes it missed.
+// Unversioned keys are only added if they are missing, as there is no way to know which value is newer.
+func (s *Service) merge(m *member) error {
+	s.mu.RLock()
+	namespaces := make([]string, 0, len(s.stores))
+	for ns := range s.stores {
+		namespaces = append(namespaces, ns)
+	}
+	s.mu.RUnlock()
+	for _, ns := range namespaces {
+		var snap snapshot
+		if err := s.do(s.client, "GET", m.URL, storagePath, url.Values{"namespace": {ns}}, nil, &snap); err != nil {
+			s.diag.Error("failed to get stores of member", err, keyvalue.KV("member", m.Name), keyvalue.KV("namespace", ns))
+			return err
+		}
+		s.mu.RLock()
+		store := s.stores[ns]
+		s.mu.RUnlock()
+		var changes, unversioned []op
+		for _, kv := range snap.KeyValues {
+			if kv.Version.Time != 0 {
+				changes = append(changes, kv)
+			} else if !kv.Delete {
+				unversioned = append(unversioned, kv)
+			}
+		}
+		// Unversioned keys are added unless this member has the key or deleted it.
+		var missing []op
+		err := store.View(func(tx storage.ReadOnlyTx) error {
+			for _, kv := range unversioned {
+				exists, err := tx.Exists(kv.Key)
+				if err != nil {
+					return err
+				}
+				if !exists {
+					missing = append(missing, kv)
+				}
+			}
+			return nil
+		})
+		if err == nil {
+			err = s.versions.View(func(tx storage.ReadOnlyTx) error {
+				for _, kv := range missing {
+					local, err := getVersion(tx, ns, kv.Key)
+					if err != nil {
+						return err
+					}
+					if local.Time == 0 {
+						changes = append(changes, kv)
+					}
+				}
+				return nil
+			})
+		}
+		if err == nil && len(changes) > 0 {
+			err = s.apply(ns, changes)
+		}
+		if err != nil {
+			s.diag.Error("failed to merge stores of member", err, keyvalue.KV("member", m.Name), keyvalue.KV("namespace", ns))
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *Service) handleSnapshot(w http.ResponseWriter, r *http.Request) {
+	ns := r.URL.Query().Get("namespace")
+	s.mu.RLock()
+	store, ok := s.stores[ns]
+	s.mu.RUnlock()
+	if !ok {
+		httpd.HttpError(w, errUnknownNamespace.Error()+" "+ns, true, http.StatusNotFound)
+		return
+	}
+	versions := make(map[string]version)
+	err := s.versions.View(func(tx storage.ReadOnlyTx) error {
+		prefix := versionKey(ns, "")
+		kvs, err := tx.List(prefix)
+		if err != nil {
+			return err
+		}
+		for _, kv := range kvs {
+			var v version
+			if err := json.Unmarshal(kv.Value, &v); err != nil {
+				return err
+			}
+			versions[strings.TrimPrefix(kv.Key, prefix)] = v
+		}
+		return nil
+	})
+	if err != nil {
+		httpd.HttpError(w, err.Error(), true, http.StatusInternalServerError)
+		return
+	}
+	var snap snapshot
+	err = store.View(func(tx storage.ReadOnlyTx) error {
+		kvs, err := tx.List("")
+		if err != nil {
+			return err
+		}
+		snap.KeyValues = make([]op, len(kvs))
+		for i, kv := range kvs {
+			snap.KeyValues[i] = op{Key: kv.Key, Value: kv.Value, Version: versions[kv.Key]}
+			delete(versions, kv.Key)
+		}
+		return nil
+	})
+	if err != nil {
+		httpd.HttpError(w, err.Error(), true, http.StatusInternalServerError)
+		return
+	}
+	for key, v := range versions {
+		if v.Deleted {
+			snap.KeyValues = append(snap.KeyValues, op{Key: key, Delete: true, Version: v})
+		}
+	}
+	w.Write(httpd.MarshalJSON(snap, false))
+}
+
+func (s *Service) handleReplicate(w http.ResponseWriter, r *http.Request) {
+	var rep replication
+	if err := json.NewDecoder(r.Body).Decode(&rep); err != nil {
+		httpd.HttpError(w, "invalid replication: "+err.Error(), true, http.StatusBadRequest)
+		return
+	}
+	if err := s.apply(rep.Namespace, rep.Ops); err != nil {
+		code := http.StatusInternalServerError
+		if err == errUnknownNamespace {
+			code = http.StatusNotFound
+		}
+		httpd.HttpError(w, err.Error(), true, code)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// replicatedStore records the changes of the transactions to a store and replicates them once committed.
+type replicatedStore struct {
+	namespace string
+	store     storage.Interface
+	s         *Service
+}
+
+func (r *replicatedStore) View(f func(storage.ReadOnlyTx) error) error {
+	return r.store.View(f)
+}
+
+func (r *replicatedStore) Update(f func(storage.Tx) error) error {
+	r.s.updateMu.Lock()
+	defer r.s.updateMu.Unlock()
+	var ops []op
+	err := r.store.Update(func(tx storage.Tx) error {
+		return f(&recordingTx{Tx: tx, ops: &ops})
+	})
+	if err != nil {
+		return err
+	}
+	if err := r.s.stamp(r.namespace, ops); err != nil {
+		return err
+	}
+	r.s.replicate(r.namespace, ops)
+	return nil
+}
+
+type recordingTx struct {
+	storage.Tx
+	ops *[]op
+}
+
+func (tx *recordingTx) Put(key string, value []byte) error {
+	if err := tx.Tx.Put(key, value); err != nil {
+		return err
+	}
+	*tx.ops = append(*tx.ops, op{Key: key, Value: append([]byte(nil), value...)})
+	return nil
+}
+
+func (tx *recordingTx) Delete(key string) error {
+	if err := tx.Tx.Delete(key); err != nil {
+		return err
+	}
+	*tx.ops = append(*tx.ops, op{Key: key, Delete: true})
+	return nil
+}
@@ -0,0 +1,64 @@
+package cluster
+
+import (
+	"crypto/md5"
+	"encoding/binary"
+	"sort"
+	"strconv"
+)
+
+// Ring assigns keys to members by consistent hashing.
+// Each member owns several points on the ring, so that the keys of a member that leaves
+// are spread over the remaining members and only the keys of that member move.
+type Ring struct {
+	points  []uint32
+	members map[uint32]string
+}
+
+// NewRing creates a ring of the members with n points for each member.
+func NewRing(members []string, n int) *Ring {
+	r := &Ring{
+		points:  make([]uint32, 0, len(members)*n),
+		members: make(map[uint32]string, len(members)*n),
+	}
+	// Sort the members so that collisions are resolved the same way on every member.
+	sorted := append([]string(nil), members...)
+	sort.Strings(sorted)
+	for _, m := range sorted {
+		for i := 0; i < n; i++ {
+			p := hash(m + "#" + strconv.Itoa(i))
+			if _, ok := r.members[p]; ok {
+				continue
+			}
+			r.members[p] = m
+			r.points = append(r.points, p)
+		}
+	}
+	sort.Sort(ringPoints(r.points))
+	return r
+}
+
+type ringPoints []uint32
+
+func (p ringPoints) Len() int           { return len(p) }
+func (p ringPoints) Less(i, j int) bool { return p[i] < p[j] }
+func (p ringPoints) Swap(i, j int)      { p[i], p[j] = p[j], p[i] }
+
+// Owner returns the member that owns the key, or the empty string if the ring is empty.
+func (r *Ring) Owner(key string) string {
+	if len(r.points) == 0 {
+		return ""
+	}
+	h := hash(key)
+	i := sort.Search(len(r.points), func(i int) bool { return r.points[i] >= h })
+	if i == len(r.points) {
+		i = 0
+	}
+	return r.members[r.points[i]]
+}
+
+// hash spreads similar keys, i.e. task IDs that only differ by a suffix, evenly over the ring.
+func hash(s string) uint32 {
+	sum := md5.Sum([]byte(s))
+	return binary.BigEndian.Uint32(sum[:4])
+}
@@ -0,0 +1,45 @@
+package cluster_test
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/influxdata/kapacitor/services/cluster"
+)
+
+func TestRing_Owner(t *testing.T) {
+	r1 := cluster.NewRing([]string{"a", "b", "c"}, 64)
+	r2 := cluster.NewRing([]string{"c", "a", "b"}, 64)
+	owned := make(map[string]int)
+	for i := 0; i < 300; i++ {
+		key := fmt.Sprintf("task%d", i)
+		o := r1.Owner(key)
+		if o2 := r2.Owner(key); o != o2 {
+			t.Fatalf("owner of %s depends on the order of the members: %s != %s", key, o, o2)
+		}
+		owned[o]++
+	}
+	for _, m := range []string{"a", "b", "c"} {
+		if owned[m] < 50 {
+			t.Errorf("member %s owns too few keys: %d of 300", m, owned[m])
+		}
+	}
+}
+
+func TestRing_RemoveMember(t *testing.T) {
+	before := cluster.NewRing([]string{"a", "b", "c"}, 64)
+	after := cluster.NewRing([]string{"a", "c"}, 64)
+	for i := 0; i < 300; i++ {
+		key := fmt.Sprintf("task%d", i)
+		o := before.Owner(key)
+		if o != "b" && after.Owner(key) != o {
+			t.Errorf("key %s moved from %s to %s", key, o, after.Owner(key))
+		}
+	}
+}
+
+func TestRing_Empty(t *testing.T) {
+	if o := cluster.NewRing(nil, 64).Owner("task"); o != "" {
+		t.Errorf("unexpected owner %q", o)
+	}
+}
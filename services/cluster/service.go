@@ -0,0 +1,748 @@
+package cluster
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/influxdata/influxdb/models"
+	kexpvar "github.com/influxdata/kapacitor/expvar"
+	"github.com/influxdata/kapacitor/keyvalue"
+	"github.com/influxdata/kapacitor/server/vars"
+	"github.com/influxdata/kapacitor/services/httpd"
+	"github.com/influxdata/kapacitor/services/scraper"
+	"github.com/influxdata/kapacitor/services/storage"
+	plog "github.com/prometheus/common/log"
+	pmodel "github.com/prometheus/common/model"
+	"github.com/prometheus/prometheus/config"
+	"github.com/prometheus/prometheus/discovery"
+)
+
+const (
+	clusterPath = "/cluster"
+	membersPath = clusterPath + "/members"
+	pingPath    = clusterPath + "/ping"
+	writePath   = clusterPath + "/write"
+	storagePath = clusterPath + "/storage"
+)
+
+const (
+	statMembers         = "members"
+	statForwardedPoints = "forwarded_points"
+	statDroppedPoints   = "dropped_points"
+	statReplicatedOps   = "replicated_ops"
+)
+
+// queueSize is the number of requests queued for each member.
+const queueSize = 1000
+
+type Diagnostic interface {
+	Error(msg string, err error, ctx ...keyvalue.T)
+	MemberUp(name, url string)
+	MemberDown(name string)
+	DiscoveryLogger() plog.Logger
+}
+
+// DBRP is a database and retention policy pair a stream task reads from.
+type DBRP struct {
+	Database        string
+	RetentionPolicy string
+}
+
+// Service runs this member of the cluster.
+// It tracks the live members, assigns the tasks to them, forwards the writes
+// to the members owning the stream tasks reading them and replicates the stores to all members.
+//
+// When the cluster is disabled the service behaves as a cluster with this single member.
+type Service struct {
+	conf Config
+	name string
+	url  string
+
+	mu sync.RWMutex
+	// members are the live members by name, not including this member.
+	members map[string]*member
+	// learned are the URLs of members named by other members that have not been reached yet.
+	learned map[string]bool
+	// discovered are the URLs found by the discoverer.
+	discovered []string
+	ring       *Ring
+	// streams are the DBRPs of each enabled stream task.
+	streams map[string][]DBRP
+	// forwards are the members owning the stream tasks reading each DBRP.
+	forwards map[DBRP][]*member
+	// stores are the underlying stores of the replicated namespaces.
+	stores  map[string]storage.Interface
+	wrapped map[string]*replicatedStore
+	// versions holds the versions of the keys of the replicated namespaces.
+	versions storage.Interface
+	watchers []*watcher
+
+	// updateMu serializes the changes to the replicated stores with their versions.
+	updateMu sync.Mutex
+
+	pingClient *http.Client
+	client     *http.Client
+	routes     []httpd.Route
+
+	cancelDiscovery context.CancelFunc
+	closing         chan struct{}
+	wg              sync.WaitGroup
+
+	statKey    string
+	statMap    *kexpvar.Map
+	membersVar *kexpvar.Int
+
+	// Discoverer finds the addresses of other members if it is set.
+	Discoverer scraper.Discoverer
+	// DefaultRetentionPolicy is used to route the writes without a retention policy.
+	DefaultRetentionPolicy string
+
+	HTTPDService interface {
+		AddRoutes([]httpd.Route) error
+		DelRoutes([]httpd.Route)
+	}
+	StorageService interface {
+		Store(namespace string) storage.Interface
+		Register(name string, store storage.StoreActioner)
+		Versions() storage.Versions
+	}
+	// PointsWriter writes the points to the tasks of this member.
+	PointsWriter interface {
+		WritePoints(database, retentionPolicy string, consistencyLevel models.ConsistencyLevel, points []models.Point) error
+	}
+
+	diag Diagnostic
+}
+
+// member is another live member of the cluster.
+type member struct {
+	memberInfo
+	lastSeen time.Time
+	// requests are sent to the member in order.
+	requests chan request
+	// merged is set once the stores of the member have been merged.
+	merged  bool
+	merging bool
+}
+
+type memberInfo struct {
+	Name string `json:"name"`
+	URL  string `json:"url"`
+}
+
+type request struct {
+	path  string
+	query url.Values
+	body  []byte
+}
+
+func NewService(c Config, d Diagnostic) *Service {
+	transport := &http.Transport{
+		Proxy: http.ProxyFromEnvironment,
+		TLSClientConfig: &tls.Config{
+			InsecureSkipVerify: c.InsecureSkipVerify,
+		},
+	}
+	return &Service{
+		conf:     c,
+		name:     c.Name,
+		url:      strings.TrimSuffix(c.AdvertiseURL, "/"),
+		members:  make(map[string]*member),
+		learned:  make(map[string]bool),
+		ring:     NewRing([]string{c.Name}, c.VirtualNodes),
+		streams:  make(map[string][]DBRP),
+		forwards: make(map[DBRP][]*member),
+		stores:   make(map[string]storage.Interface),
+		wrapped:  make(map[string]*replicatedStore),
+		pingClient: &http.Client{
+			Transport: transport,
+			Timeout:   time.Duration(c.HeartbeatInterval),
+		},
+		client: &http.Client{
+			Transport: transport,
+			Timeout:   time.Duration(c.MemberTimeout),
+		},
+		closing: make(chan struct{}),
+		diag:    d,
+	}
+}
+
+func (s *Service) Open() error {
+	if !s.conf.Enabled {
+		return nil
+	}
+	s.statKey, s.statMap = vars.NewStatistic("cluster", map[string]string{"member": s.name})
+	s.membersVar = new(kexpvar.Int)
+	s.membersVar.Set(1)
+	s.statMap.Set(statMembers, s.membersVar)
+
+	s.routes = []httpd.Route{
+		{
+			Method:      "GET",
+			Pattern:     membersPath,
+			HandlerFunc: s.handleMembers,
+		},
+		{
+			Method:      "POST",
+			Pattern:     pingPath,
+			HandlerFunc: s.handlePing,
+			NoAudit:     true,
+			Local:       true,
+		},
+		{
+			Method:      "POST",
+			Pattern:     writePath,
+			HandlerFunc: s.handleWrite,
+			NoJSON:      true,
+			NoAudit:     true,
+			Local:       true,
+		},
+		{
+			Method:      "GET",
+			Pattern:     storagePath,
+			HandlerFunc: s.handleSnapshot,
+		},
+		{
+			Method:      "POST",
+			Pattern:     storagePath,
+			HandlerFunc: s.handleReplicate,
+			NoAudit:     true,
+			Local:       true,
+		},
+	}
+	if err := s.HTTPDService.AddRoutes(s.routes); err != nil {
+		return err
+	}
+
+	// Find the members that are already up before the tasks are assigned,
+	// without joining them before the HTTP API of this member is listening.
+	s.heartbeat(true)
+
+	if s.Discoverer != nil {
+		sc := new(config.ScrapeConfig)
+		s.Discoverer.Prom(sc)
+		ctx, cancel := context.WithCancel(context.Background())
+		s.cancelDiscovery = cancel
+		ts := discovery.NewTargetSet(s)
+		go ts.Run(ctx)
+		ts.UpdateProviders(discovery.ProvidersFromConfig(sc.ServiceDiscoveryConfig, s.diag.DiscoveryLogger()))
+	}
+
+	s.wg.Add(1)
+	go s.run()
+	return nil
+}
+
+func (s *Service) Close() error {
+	if !s.conf.Enabled {
+		return nil
+	}
+	close(s.closing)
+	if s.cancelDiscovery != nil {
+		s.cancelDiscovery()
+	}
+	s.HTTPDService.DelRoutes(s.routes)
+	s.wg.Wait()
+	vars.DeleteStatistic(s.statKey)
+	return nil
+}
+
+func (s *Service) run() {
+	defer s.wg.Done()
+	ticker := time.NewTicker(time.Duration(s.conf.HeartbeatInterval))
+	defer ticker.Stop()
+	for {
+		select {
+		case <-s.closing:
+			return
+		case <-ticker.C:
+			s.heartbeat(false)
+		}
+	}
+}
+
+// Sync receives the targets found by the discoverer.
+func (s *Service) Sync(groups []*config.TargetGroup) {
+	var urls []string
+	for _, g := range groups {
+		for _, t := range g.Targets {
+			urls = append(urls, memberURL(string(t[pmodel.AddressLabel])))
+		}
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.discovered = urls
+}
+
+// memberURL adds the default scheme to an address without one.
+func memberURL(addr string) string {
+	if !strings.Contains(addr, "://") {
+		addr = "http://" + addr
+	}
+	return strings.TrimSuffix(addr, "/")
+}
+
+// heartbeat pings all known addresses of members, expires the members not heard from in time
+// and merges the stores of the members that have not been merged.
+// A joining member is not added to the members it pings.
+func (s *Service) heartbeat(joining bool) {
+	var wg sync.WaitGroup
+	req := pingRequest{
+		memberInfo: memberInfo{Name: s.name, URL: s.url},
+		Joining:    joining,
+	}
+	for _, u := range s.targets() {
+		wg.Add(1)
+		go func(u string) {
+			defer wg.Done()
+			var resp pingResponse
+			err := s.do(s.pingClient, "POST", u, pingPath, nil, req, &resp)
+			s.pinged(u, resp, err)
+		}(u)
+	}
+	wg.Wait()
+	s.expire()
+	if !joining {
+		s.mergeMembers()
+	}
+}
+
+// mergeMembers merges the stores of the members that have not been merged since they joined
+// or since a request to them failed.
+func (s *Service) mergeMembers() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, m := range s.members {
+		if m.merged || m.merging {
+			continue
+		}
+		m.merging = true
+		s.wg.Add(1)
+		go func(m *member) {
+			defer s.wg.Done()
+			err := s.merge(m)
+			s.mu.Lock()
+			m.merging = false
+			m.merged = err == nil
+			s.mu.Unlock()
+		}(m)
+	}
+}
+
+// targets returns the URLs of all members to ping.
+func (s *Service) targets() []string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	set := make(map[string]bool)
+	for _, m := range s.conf.Members {
+		set[memberURL(m)] = true
+	}
+	for _, u := range s.discovered {
+		set[u] = true
+	}
+	for u := range s.learned {
+		set[u] = true
+	}
+	for _, m := range s.members {
+		set[m.URL] = true
+	}
+	delete(set, s.url)
+	targets := make([]string, 0, len(set))
+	for u := range set {
+		targets = append(targets, u)
+	}
+	return targets
+}
+
+type pingRequest struct {
+	memberInfo
+	// Joining is set by a member that is not ready to be added to the members yet.
+	Joining bool `json:"joining,omitempty"`
+}
+
+type pingResponse struct {
+	memberInfo
+	// Members are the live members known to the member, including itself.
+	Members []memberInfo `json:"members"`
+}
+
+// pinged records the response of a member to a ping.
+func (s *Service) pinged(u string, resp pingResponse, err error) {
+	s.mu.Lock()
+	delete(s.learned, u)
+	if err != nil || resp.Name == s.name {
+		s.mu.Unlock()
+		return
+	}
+	joined := s.seen(resp.memberInfo)
+	for _, info := range resp.Members {
+		if _, ok := s.members[info.Name]; !ok && info.Name != s.name {
+			s.learned[info.URL] = true
+		}
+	}
+	s.mu.Unlock()
+	if joined != nil {
+		s.joined(joined)
+	}
+}
+
+// seen marks the member as alive and returns it if it joined.
+// Must be called with the lock held.
+func (s *Service) seen(info memberInfo) *member {
+	select {
+	case <-s.closing:
+		return nil
+	default:
+	}
+	if m, ok := s.members[info.Name]; ok {
+		m.lastSeen = time.Now()
+		m.URL = info.URL
+		return nil
+	}
+	m := &member{
+		memberInfo: info,
+		lastSeen:   time.Now(),
+		requests:   make(chan request, queueSize),
+	}
+	s.members[info.Name] = m
+	s.wg.Add(1)
+	go s.send(m)
+	s.rebuild()
+	return m
+}
+
+// joined reassigns the tasks once a member joined.
+func (s *Service) joined(m *member) {
+	s.diag.MemberUp(m.Name, m.URL)
+	s.notify("")
+}
+
+// expire removes the members that have not been heard from in time and reassigns their tasks.
+func (s *Service) expire() {
+	s.mu.Lock()
+	var left []string
+	for name, m := range s.members {
+		if time.Since(m.lastSeen) > time.Duration(s.conf.MemberTimeout) {
+			delete(s.members, name)
+			close(m.requests)
+			left = append(left, name)
+		}
+	}
+	if len(left) > 0 {
+		s.rebuild()
+	}
+	s.mu.Unlock()
+	for _, name := range left {
+		s.diag.MemberDown(name)
+	}
+	if len(left) > 0 {
+		s.notify("")
+	}
+}
+
+// rebuild recreates the ring of the live members and the forwards of the stream tasks.
+// Must be called with the lock held.
+func (s *Service) rebuild() {
+	names := []string{s.name}
+	for name := range s.members {
+		names = append(names, name)
+	}
+	s.ring = NewRing(names, s.conf.VirtualNodes)
+	if s.membersVar != nil {
+		s.membersVar.Set(int64(len(names)))
+	}
+	s.forwards = make(map[DBRP][]*member)
+	for id, dbrps := range s.streams {
+		m, ok := s.members[s.ring.Owner(id)]
+		if !ok {
+			// Owned by this member
+			continue
+		}
+		for _, dbrp := range dbrps {
+			if !containsMember(s.forwards[dbrp], m) {
+				s.forwards[dbrp] = append(s.forwards[dbrp], m)
+			}
+		}
+	}
+}
+
+func containsMember(members []*member, m *member) bool {
+	for _, o := range members {
+		if o == m {
+			return true
+		}
+	}
+	return false
+}
+
+// send sends the queued requests to the member until it is removed.
+func (s *Service) send(m *member) {
+	defer s.wg.Done()
+	for {
+		select {
+		case <-s.closing:
+			return
+		case r, ok := <-m.requests:
+			if !ok {
+				return
+			}
+			if err := s.do(s.client, "POST", m.URL, r.path, r.query, r.body, nil); err != nil {
+				s.diag.Error("failed to send request to member", err, keyvalue.KV("member", m.Name))
+				// Catch up on the changes the member missed.
+				s.mu.Lock()
+				m.merged = false
+				s.mu.Unlock()
+			}
+		}
+	}
+}
+
+// queue queues a request for the member, reporting whether the queue had room.
+// Must be called with the read lock held, so that the member is not removed concurrently.
+func (s *Service) queue(m *member, r request) bool {
+	select {
+	case m.requests <- r:
+		return true
+	default:
+		return false
+	}
+}
+
+// do sends a request to a member.
+// The body is sent as is if it is a byte slice, otherwise it is encoded as JSON.
+// The JSON response is decoded into result if it is not nil.
+func (s *Service) do(client *http.Client, method, base, path string, query url.Values, body, result interface{}) error {
+	var data []byte
+	switch b := body.(type) {
+	case nil:
+	case []byte:
+		data = b
+	default:
+		var err error
+		data, err = json.Marshal(b)
+		if err != nil {
+			return err
+		}
+	}
+	u := base + httpd.BasePath + path
+	if len(query) > 0 {
+		u += "?" + query.Encode()
+	}
+	req, err := http.NewRequest(method, u, bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	if s.conf.Username != "" {
+		req.SetBasicAuth(s.conf.Username, s.conf.Password)
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		msg, _ := ioutil.ReadAll(resp.Body)
+		return fmt.Errorf("unexpected response code %d from %s: %s", resp.StatusCode, u, bytes.TrimSpace(msg))
+	}
+	if result != nil {
+		return json.NewDecoder(resp.Body).Decode(result)
+	}
+	return nil
+}
+
+// Owns reports whether the task is assigned to this member.
+func (s *Service) Owns(taskID string) bool {
+	if !s.conf.Enabled {
+		return true
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.ring.Owner(taskID) == s.name
+}
+
+// SetStreamTasks sets the DBRPs of all enabled stream tasks of the cluster,
+// so that their writes are forwarded to the members owning them.
+func (s *Service) SetStreamTasks(streams map[string][]DBRP) {
+	if !s.conf.Enabled {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.streams = streams
+	s.rebuild()
+}
+
+// WritePoints writes the points to the tasks of this member and forwards them to the members
+// owning the stream tasks reading the database and retention policy.
+func (s *Service) WritePoints(database, retentionPolicy string, consistencyLevel models.ConsistencyLevel, points []models.Point) error {
+	if err := s.PointsWriter.WritePoints(database, retentionPolicy, consistencyLevel, points); err != nil {
+		return err
+	}
+	if !s.conf.Enabled {
+		return nil
+	}
+	if retentionPolicy == "" {
+		retentionPolicy = s.DefaultRetentionPolicy
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	members := s.forwards[DBRP{Database: database, RetentionPolicy: retentionPolicy}]
+	if len(members) == 0 {
+		return nil
+	}
+	var buf bytes.Buffer
+	for _, p := range points {
+		buf.WriteString(p.String())
+		buf.WriteByte('\n')
+	}
+	r := request{
+		path:  writePath,
+		query: url.Values{"db": {database}, "rp": {retentionPolicy}},
+		body:  buf.Bytes(),
+	}
+	for _, m := range members {
+		if s.queue(m, r) {
+			s.statMap.Add(statForwardedPoints, int64(len(points)))
+		} else {
+			s.statMap.Add(statDroppedPoints, int64(len(points)))
+		}
+	}
+	return nil
+}
+
+type watcher struct {
+	namespace string
+	signal    chan struct{}
+}
+
+// Watch calls f whenever the members of the cluster change or the store of the namespace
+// is changed by another member.
+// The changes made by this member are not notified, they are applied by the caller itself.
+// The calls are made from a separate goroutine and coalesced while f is running.
+func (s *Service) Watch(namespace string, f func()) {
+	if !s.conf.Enabled {
+		return
+	}
+	w := &watcher{
+		namespace: namespace,
+		signal:    make(chan struct{}, 1),
+	}
+	s.mu.Lock()
+	s.watchers = append(s.watchers, w)
+	s.mu.Unlock()
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		for {
+			select {
+			case <-s.closing:
+				return
+			case <-w.signal:
+				f()
+			}
+		}
+	}()
+}
+
+// notify signals the watchers of the namespace, or all watchers if the namespace is empty.
+func (s *Service) notify(namespace string) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	for _, w := range s.watchers {
+		if namespace == "" || w.namespace == namespace {
+			select {
+			case w.signal <- struct{}{}:
+			default:
+			}
+		}
+	}
+}
+
+type membersResponse struct {
+	Name    string       `json:"name"`
+	Members []memberInfo `json:"members"`
+}
+
+// liveMembers returns all live members including this member sorted by name.
+// Must be called with the read lock held.
+func (s *Service) liveMembers() []memberInfo {
+	members := []memberInfo{{Name: s.name, URL: s.url}}
+	for _, m := range s.members {
+		members = append(members, m.memberInfo)
+	}
+	sort.Sort(memberList(members))
+	return members
+}
+
+type memberList []memberInfo
+
+func (l memberList) Len() int           { return len(l) }
+func (l memberList) Less(i, j int) bool { return l[i].Name < l[j].Name }
+func (l memberList) Swap(i, j int)      { l[i], l[j] = l[j], l[i] }
+
+func (s *Service) handleMembers(w http.ResponseWriter, r *http.Request) {
+	s.mu.RLock()
+	resp := membersResponse{
+		Name:    s.name,
+		Members: s.liveMembers(),
+	}
+	s.mu.RUnlock()
+	w.Write(httpd.MarshalJSON(resp, true))
+}
+
+func (s *Service) handlePing(w http.ResponseWriter, r *http.Request) {
+	var req pingRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		httpd.HttpError(w, "invalid ping: "+err.Error(), true, http.StatusBadRequest)
+		return
+	}
+	info := req.memberInfo
+	s.mu.Lock()
+	var joined *member
+	if info.Name != s.name {
+		if !req.Joining {
+			joined = s.seen(info)
+		}
+	} else if info.URL != s.url {
+		s.diag.Error("conflicting member", fmt.Errorf("member name %q is already in use", info.Name), keyvalue.KV("url", info.URL))
+	}
+	resp := pingResponse{
+		memberInfo: memberInfo{Name: s.name, URL: s.url},
+		Members:    s.liveMembers(),
+	}
+	s.mu.Unlock()
+	if joined != nil {
+		s.joined(joined)
+	}
+	w.Write(httpd.MarshalJSON(resp, false))
+}
+
+func (s *Service) handleWrite(w http.ResponseWriter, r *http.Request) {
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		httpd.HttpError(w, err.Error(), true, http.StatusBadRequest)
+		return
+	}
+	points, err := models.ParsePointsWithPrecision(body, time.Now().UTC(), "n")
+	if err != nil {
+		httpd.HttpError(w, err.Error(), true, http.StatusBadRequest)
+		return
+	}
+	// Forwarded writes are only written to the tasks of this member.
+	if err := s.PointsWriter.WritePoints(r.URL.Query().Get("db"), r.URL.Query().Get("rp"), models.ConsistencyLevelAny, points); err != nil {
+		httpd.HttpError(w, err.Error(), true, http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -29,6 +29,7 @@ type OverrideDAO interface {
 	List(prefix string) ([]Override, error)
 
 	Rebuild() error
+	Check() (storage.CheckResult, error)
 }
 
 //--------------------------------------------------------------------
@@ -132,3 +133,7 @@ func (kv *overrideKV) List(prefix string) ([]Override, error) {
 func (kv *overrideKV) Rebuild() error {
 	return kv.store.Rebuild()
 }
+
+func (kv *overrideKV) Check() (storage.CheckResult, error) {
+	return kv.store.Check()
+}
@@ -5,8 +5,10 @@ import (
 	"fmt"
 	"net/http"
 	"path"
+	"reflect"
 	"regexp"
 	"strings"
+	"sync"
 	"time"
 
 	client "github.com/influxdata/kapacitor/client/v1"
@@ -47,10 +49,19 @@ type Service struct {
 
 	overrides OverrideDAO
 
+	// Guards applied and closed.
+	mu sync.Mutex
+	// applied are the sections as they were applied to the services.
+	applied map[string][]interface{}
+	closed  bool
+
 	StorageService interface {
 		Store(namespace string) storage.Interface
 		Register(name string, store storage.StoreActioner)
 	}
+	ClusterService interface {
+		Watch(namespace string, f func())
+	}
 	HTTPDService interface {
 		AddRoutes([]httpd.Route) error
 		DelRoutes([]httpd.Route)
@@ -109,15 +120,88 @@ func (s *Service) Open() error {
 	}
 
 	err = s.HTTPDService.AddRoutes(s.routes)
-	return errors.Wrap(err, "failed to add API routes")
+	if err != nil {
+		return errors.Wrap(err, "failed to add API routes")
+	}
+
+	if s.enabled {
+		// The overrides are applied by the server once opened,
+		// follow the overrides changed by the leader or other members.
+		applied, err := s.Config()
+		if err != nil {
+			s.diag.Error("failed to read config overrides", err)
+		}
+		s.applied = applied
+		s.ClusterService.Watch(configNamespace, s.syncOverrides)
+	}
+	return nil
 }
 
 func (s *Service) Close() error {
+	s.mu.Lock()
+	s.closed = true
 	close(s.updates)
+	s.mu.Unlock()
 	s.HTTPDService.DelRoutes(s.routes)
 	return nil
 }
 
+// syncOverrides applies the sections whose overrides have been changed by another instance.
+func (s *Service) syncOverrides() {
+	config, err := s.Config()
+	if err != nil {
+		s.diag.Error("failed to read config overrides", err)
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return
+	}
+	if s.applied == nil {
+		s.applied = make(map[string][]interface{}, len(config))
+	}
+	for section, values := range config {
+		if reflect.DeepEqual(s.applied[section], values) {
+			continue
+		}
+		if err := s.update(section, values); err != nil {
+			s.diag.Error("failed to apply config overrides", err)
+			continue
+		}
+		s.applied[section] = values
+	}
+}
+
+// update sends the new values of the section to its service and waits for the result.
+// Must be called with the lock held.
+func (s *Service) update(section string, values []interface{}) error {
+	errC := make(chan error, 1)
+	cu := ConfigUpdate{
+		Name:      section,
+		NewConfig: values,
+		ErrC:      errC,
+	}
+	sendTimer := time.NewTimer(updateTimeout)
+	defer sendTimer.Stop()
+	select {
+	case <-sendTimer.C:
+		return fmt.Errorf("failed to send configuration update %s: timeout", section)
+	case s.updates <- cu:
+	}
+	recvTimer := time.NewTimer(updateTimeout)
+	defer recvTimer.Stop()
+	select {
+	case <-recvTimer.C:
+		return fmt.Errorf("failed to update configuration %s: timeout", section)
+	case err := <-errC:
+		if err != nil {
+			return fmt.Errorf("failed to update configuration %s: %v", section, err)
+		}
+	}
+	return nil
+}
+
 type updateAction struct {
 	section    string
 	element    string
@@ -286,6 +370,11 @@ func (s *Service) handleUpdateSection(w http.ResponseWriter, r *http.Request) {
 		httpd.HttpError(w, err.Error(), true, http.StatusInternalServerError)
 		return
 	}
+	s.mu.Lock()
+	if s.applied != nil {
+		s.applied[section] = sectionList
+	}
+	s.mu.Unlock()
 
 	// Success
 	w.WriteHeader(http.StatusNoContent)
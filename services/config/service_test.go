@@ -53,10 +53,15 @@ type TestConfig struct {
 	SectionCs []SectionC `override:"section-c,element-key=name"`
 }
 
+type noCluster struct{}
+
+func (noCluster) Watch(namespace string, f func()) {}
+
 func OpenNewSerivce(testConfig interface{}, updates chan<- config.ConfigUpdate) (*config.Service, *httpdtest.Server) {
 	c := config.NewConfig()
 	service := config.NewService(c, testConfig, diagService.NewConfigOverrideHandler(), updates)
 	service.StorageService = storagetest.New()
+	service.ClusterService = noCluster{}
 	server := httpdtest.NewServer(testing.Verbose())
 	service.HTTPDService = server
 	if err := service.Open(); err != nil {
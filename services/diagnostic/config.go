@@ -1,13 +1,82 @@
 package diagnostic
 
+import (
+	"fmt"
+	"strings"
+
+	"github.com/influxdata/influxdb/toml"
+)
+
+const (
+	// LogfmtFormat writes each line as logfmt key value pairs.
+	LogfmtFormat = "logfmt"
+	// JSONFormat writes each line as a JSON object.
+	JSONFormat = "json"
+)
+
 type Config struct {
 	File  string `toml:"file"`
 	Level string `toml:"level"`
+	// Format of the lines, either logfmt or json.
+	Format string `toml:"format"`
+
+	// Levels of subsystems, by the name of the service, that override the level.
+	Subsystems map[string]string `toml:"subsystems"`
+	// Levels of tasks, by task ID, that override the level and the levels of subsystems.
+	Tasks map[string]string `toml:"tasks"`
+
+	// Size in bytes at which the log file is rotated, 0 disables rotation by size.
+	MaxSize int64 `toml:"max-size"`
+	// Age at which the log file is rotated, 0 disables rotation by age.
+	MaxAge toml.Duration `toml:"max-age"`
+	// Number of rotated log files kept as file.1 through file.N.
+	MaxBackups int `toml:"max-backups"`
 }
 
 func NewConfig() Config {
 	return Config{
-		File:  "STDERR",
-		Level: "DEBUG",
+		File:       "STDERR",
+		Level:      "DEBUG",
+		Format:     LogfmtFormat,
+		MaxBackups: 5,
+	}
+}
+
+func (c Config) Validate() error {
+	if !validLevel(c.Level) {
+		return fmt.Errorf("invalid level %q", c.Level)
+	}
+	switch c.Format {
+	case "", LogfmtFormat, JSONFormat:
+	default:
+		return fmt.Errorf("invalid format %q, must be %q or %q", c.Format, LogfmtFormat, JSONFormat)
+	}
+	for name, level := range c.Subsystems {
+		if !validLevel(level) {
+			return fmt.Errorf("invalid level %q of subsystem %q", level, name)
+		}
+	}
+	for id, level := range c.Tasks {
+		if !validLevel(level) {
+			return fmt.Errorf("invalid level %q of task %q", level, id)
+		}
+	}
+	if c.MaxSize < 0 {
+		return fmt.Errorf("max-size must not be negative, got %d", c.MaxSize)
+	}
+	if c.MaxAge < 0 {
+		return fmt.Errorf("max-age must not be negative, got %v", c.MaxAge)
+	}
+	if c.MaxBackups < 0 {
+		return fmt.Errorf("max-backups must not be negative, got %d", c.MaxBackups)
+	}
+	return nil
+}
+
+func validLevel(lvl string) bool {
+	switch strings.ToUpper(lvl) {
+	case "INFO", "ERROR", "WARN", "DEBUG":
+		return true
 	}
+	return false
 }
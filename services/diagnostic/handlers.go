@@ -516,6 +516,10 @@ func (h *StorageHandler) Error(msg string, err error) {
 	h.l.Error(msg, klog.Error(err))
 }
 
+func (h *StorageHandler) BackupCreated(path string) {
+	h.l.Info("created backup", klog.String("path", path))
+}
+
 // TaskStore Handler
 
 type TaskStoreHandler struct {
@@ -550,6 +554,10 @@ func (h *TaskStoreHandler) Migrated(entity, id string) {
 	h.l.Debug("entity was migrated to new storage service", klog.String(entity, id))
 }
 
+func (h *TaskStoreHandler) DependentTasks(action, taskID string, downstream []string) {
+	h.l.Warn("task "+action+" while it feeds enabled tasks", klog.String("task", taskID), klog.Strings("downstream", downstream))
+}
+
 // VictorOps Handler
 
 type VictorOpsHandler struct {
@@ -922,6 +930,73 @@ func (h *NoAuthHandler) FakedSubscriptionUserToken() {
 	h.l.Warn("using noauth auth backend. Faked authentication for subscription user token")
 }
 
+// UserStore handler
+
+type UserStoreHandler struct {
+	l *klog.Logger
+}
+
+func (h *UserStoreHandler) Error(msg string, err error) {
+	h.l.Error(msg, klog.Error(err))
+}
+
+func (h *UserStoreHandler) CreatedAdminUser(username string) {
+	h.l.Info("created admin user", klog.String("user", username))
+}
+
+// Audit handler
+
+type AuditHandler struct {
+	l *klog.Logger
+}
+
+func (h *AuditHandler) Error(msg string, err error) {
+	h.l.Error(msg, klog.Error(err))
+}
+
+// Cluster handler
+
+type ClusterHandler struct {
+	l *klog.Logger
+}
+
+func (h *ClusterHandler) Error(msg string, err error, ctx ...keyvalue.T) {
+	Error(h.l, msg, err, ctx)
+}
+
+func (h *ClusterHandler) MemberUp(name, url string) {
+	h.l.Info("member joined cluster", klog.String("member", name), klog.String("url", url))
+}
+
+func (h *ClusterHandler) MemberDown(name string) {
+	h.l.Warn("member left cluster", klog.String("member", name))
+}
+
+func (h *ClusterHandler) DiscoveryLogger() plog.Logger {
+	return &ScraperHandler{
+		l:   h.l,
+		buf: bytes.NewBuffer(nil),
+	}
+}
+
+// HA handler
+
+type HAHandler struct {
+	l *klog.Logger
+}
+
+func (h *HAHandler) Error(msg string, err error, ctx ...keyvalue.T) {
+	Error(h.l, msg, err, ctx)
+}
+
+func (h *HAHandler) BecameLeader() {
+	h.l.Info("became leader")
+}
+
+func (h *HAHandler) BecameFollower(leader string) {
+	h.l.Info("became follower", klog.String("leader", leader))
+}
+
 // Stats handler
 
 type StatsHandler struct {
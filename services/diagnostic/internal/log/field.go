@@ -30,6 +30,8 @@ func writeString(w *bufio.Writer, s string) (n int, err error) {
 
 type Field interface {
 	WriteTo(w *bufio.Writer) (n int64, err error)
+	// WriteJSONTo writes the field as one or more comma separated JSON object members.
+	WriteJSONTo(w *bufio.Writer) (n int64, err error)
 }
 
 // String
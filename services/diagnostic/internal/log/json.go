@@ -0,0 +1,140 @@
+package log
+
+import (
+	"bufio"
+	"encoding/json"
+	"strconv"
+	"time"
+)
+
+// writeJSONString writes s as a JSON string.
+func writeJSONString(w *bufio.Writer, s string) (n int, err error) {
+	b, err := json.Marshal(s)
+	if err != nil {
+		return 0, err
+	}
+	return w.Write(b)
+}
+
+// writeJSONMember writes the key of a member followed by the raw JSON value.
+func writeJSONMember(w *bufio.Writer, key []byte, value string) (n int64, err error) {
+	var m int
+
+	m, err = writeJSONString(w, string(key))
+	n += int64(m)
+	if err != nil {
+		return
+	}
+
+	err = w.WriteByte(':')
+	n += 1
+	if err != nil {
+		return
+	}
+
+	m, err = w.WriteString(value)
+	n += int64(m)
+	return
+}
+
+// writeJSONStringMember writes the key of a member followed by the string value.
+func writeJSONStringMember(w *bufio.Writer, key []byte, value string) (n int64, err error) {
+	b, err := json.Marshal(value)
+	if err != nil {
+		return 0, err
+	}
+	return writeJSONMember(w, key, string(b))
+}
+
+func (s StringField) WriteJSONTo(w *bufio.Writer) (n int64, err error) {
+	return writeJSONStringMember(w, s.key, s.value)
+}
+
+func (s StringerField) WriteJSONTo(w *bufio.Writer) (n int64, err error) {
+	return writeJSONStringMember(w, s.key, s.value.String())
+}
+
+func (s GroupedField) WriteJSONTo(w *bufio.Writer) (n int64, err error) {
+	var m int
+	var k int64
+
+	m, err = writeJSONString(w, string(s.key))
+	n += int64(m)
+	if err != nil {
+		return
+	}
+
+	m, err = w.WriteString(":{")
+	n += int64(m)
+	if err != nil {
+		return
+	}
+
+	for i, value := range s.values {
+		if i != 0 {
+			err = w.WriteByte(',')
+			n += 1
+			if err != nil {
+				return
+			}
+		}
+		k, err = value.WriteJSONTo(w)
+		n += k
+		if err != nil {
+			return
+		}
+	}
+
+	err = w.WriteByte('}')
+	n += 1
+	return
+}
+
+func (s StringsField) WriteJSONTo(w *bufio.Writer) (n int64, err error) {
+	values := s.values
+	if values == nil {
+		values = []string{}
+	}
+	b, err := json.Marshal(values)
+	if err != nil {
+		return 0, err
+	}
+	return writeJSONMember(w, s.key, string(b))
+}
+
+func (s IntField) WriteJSONTo(w *bufio.Writer) (n int64, err error) {
+	return writeJSONMember(w, s.key, strconv.Itoa(s.value))
+}
+
+func (s Int64Field) WriteJSONTo(w *bufio.Writer) (n int64, err error) {
+	return writeJSONMember(w, s.key, strconv.FormatInt(s.value, 10))
+}
+
+func (s Float64Field) WriteJSONTo(w *bufio.Writer) (n int64, err error) {
+	b, err := json.Marshal(s.value)
+	if err != nil {
+		// NaN and infinities are not valid JSON numbers.
+		return writeJSONStringMember(w, s.key, strconv.FormatFloat(s.value, 'f', -1, 64))
+	}
+	return writeJSONMember(w, s.key, string(b))
+}
+
+func (s BoolField) WriteJSONTo(w *bufio.Writer) (n int64, err error) {
+	return writeJSONMember(w, s.key, strconv.FormatBool(s.value))
+}
+
+func (s ErrorField) WriteJSONTo(w *bufio.Writer) (n int64, err error) {
+	errStr := "nil"
+	if s.err != nil {
+		errStr = s.err.Error()
+	}
+	return writeJSONStringMember(w, []byte("err"), errStr)
+}
+
+func (s TimeField) WriteJSONTo(w *bufio.Writer) (n int64, err error) {
+	return writeJSONStringMember(w, s.key, s.value.Format(time.RFC3339Nano))
+}
+
+func (s DurationField) WriteJSONTo(w *bufio.Writer) (n int64, err error) {
+	return writeJSONStringMember(w, s.key, s.value.String())
+}
@@ -2,6 +2,7 @@ package log
 
 import (
 	"bufio"
+	"bytes"
 	"io"
 	"sync"
 	"time"
@@ -18,17 +19,39 @@ const (
 	ErrorLevel
 )
 
-func defaultLevelF(lvl Level) bool {
+// ContextLevelF reports whether a line of the level is logged,
+// given the context of the logger and the fields of the line.
+type ContextLevelF func(lvl Level, context, fields []Field) bool
+
+func defaultLevelF(lvl Level, context, fields []Field) bool {
 	return true
 }
 
+// TapF receives each logged line with its level and message, the context of the logger and the fields of the line.
+// render returns the line as JSON, so that only the lines the tap uses are rendered.
+type TapF func(level, msg string, context, fields []Field, render func() []byte)
+
+// tap is shared by a logger and all of its children.
+type tap struct {
+	mu sync.RWMutex
+	f  TapF
+}
+
+func (t *tap) get() TapF {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	return t.f
+}
+
 type Logger struct {
 	mu      *sync.Mutex
 	context []Field
 	w       *bufio.Writer
+	json    bool
+	tap     *tap
 
 	levelMu sync.RWMutex
-	levelF  func(lvl Level) bool
+	levelF  ContextLevelF
 }
 
 func NewLogger(w io.Writer) *Logger {
@@ -36,31 +59,72 @@ func NewLogger(w io.Writer) *Logger {
 	return &Logger{
 		mu:     &mu,
 		w:      bufio.NewWriter(w),
+		tap:    &tap{},
 		levelF: defaultLevelF,
 	}
 }
 
+// NewJSONLogger returns a logger that writes each line as a JSON object.
+func NewJSONLogger(w io.Writer) *Logger {
+	l := NewLogger(w)
+	l.json = true
+	return l
+}
+
 // LevelF set on parent applies to self and any future children
 func (l *Logger) SetLevelF(f func(Level) bool) {
+	l.SetContextLevelF(func(lvl Level, context, fields []Field) bool {
+		return f(lvl)
+	})
+}
+
+// SetContextLevelF sets a level func that can depend on the fields of the line.
+// Like SetLevelF it applies to self and any future children.
+func (l *Logger) SetContextLevelF(f ContextLevelF) {
 	l.levelMu.Lock()
 	defer l.levelMu.Unlock()
 	l.levelF = f
 }
 
+// SetTap sets a func that receives every line that is logged, after it passes the level func.
+// Unlike the level func it applies to self and all children, including existing ones.
+// A nil func removes the tap.
+func (l *Logger) SetTap(f TapF) {
+	l.tap.mu.Lock()
+	defer l.tap.mu.Unlock()
+	l.tap.f = f
+}
+
+// StringValue returns the value of the last string field with the key.
+func StringValue(key string, fields ...[]Field) (string, bool) {
+	var value string
+	var found bool
+	for _, fs := range fields {
+		for _, f := range fs {
+			if s, ok := f.(StringField); ok && string(s.key) == key {
+				value, found = s.value, true
+			}
+		}
+	}
+	return value, found
+}
+
 func (l *Logger) With(ctx ...Field) *Logger {
 	l.mu.Lock()
 	defer l.mu.Unlock()
 	return &Logger{
 		mu:      l.mu,
-		context: append(l.context, ctx...),
+		context: append(l.context[:len(l.context):len(l.context)], ctx...),
 		w:       l.w,
+		json:    l.json,
+		tap:     l.tap,
 		levelF:  l.levelF,
 	}
 }
 
 func (l *Logger) Error(msg string, ctx ...Field) {
 	l.levelMu.RLock()
-	logLine := l.levelF(ErrorLevel)
+	logLine := l.levelF(ErrorLevel, l.context, ctx)
 	l.levelMu.RUnlock()
 	if logLine {
 		l.Log(time.Now(), "error", msg, ctx)
@@ -69,7 +133,7 @@ func (l *Logger) Error(msg string, ctx ...Field) {
 
 func (l *Logger) Debug(msg string, ctx ...Field) {
 	l.levelMu.RLock()
-	logLine := l.levelF(DebugLevel)
+	logLine := l.levelF(DebugLevel, l.context, ctx)
 	l.levelMu.RUnlock()
 	if logLine {
 		l.Log(time.Now(), "debug", msg, ctx)
@@ -78,7 +142,7 @@ func (l *Logger) Debug(msg string, ctx ...Field) {
 
 func (l *Logger) Warn(msg string, ctx ...Field) {
 	l.levelMu.RLock()
-	logLine := l.levelF(WarnLevel)
+	logLine := l.levelF(WarnLevel, l.context, ctx)
 	l.levelMu.RUnlock()
 	if logLine {
 		l.Log(time.Now(), "warn", msg, ctx)
@@ -87,7 +151,7 @@ func (l *Logger) Warn(msg string, ctx ...Field) {
 
 func (l *Logger) Info(msg string, ctx ...Field) {
 	l.levelMu.RLock()
-	logLine := l.levelF(InfoLevel)
+	logLine := l.levelF(InfoLevel, l.context, ctx)
 	l.levelMu.RUnlock()
 	if logLine {
 		l.Log(time.Now(), "info", msg, ctx)
@@ -96,9 +160,23 @@ func (l *Logger) Info(msg string, ctx ...Field) {
 
 // TODO: actually care about errors?
 func (l *Logger) Log(now time.Time, level string, msg string, ctx []Field) {
+	if f := l.tap.get(); f != nil {
+		f(level, msg, l.context, ctx, func() []byte {
+			var buf bytes.Buffer
+			w := bufio.NewWriter(&buf)
+			l.writeJSON(w, now, level, msg, ctx)
+			return buf.Bytes()
+		})
+	}
+
 	l.mu.Lock()
 	defer l.mu.Unlock()
 
+	if l.json {
+		l.writeJSON(l.w, now, level, msg, ctx)
+		return
+	}
+
 	writeTimestamp(l.w, now)
 	l.w.WriteByte(' ')
 	writeLevel(l.w, level)
@@ -135,3 +213,26 @@ func writeMessage(w *bufio.Writer, msg string) {
 	w.Write([]byte("msg="))
 	writeString(w, msg)
 }
+
+func (l *Logger) writeJSON(w *bufio.Writer, now time.Time, level string, msg string, ctx []Field) {
+	w.WriteString(`{"ts":`)
+	writeJSONString(w, now.Format(RFC3339Milli))
+	w.WriteString(`,"lvl":`)
+	writeJSONString(w, level)
+	w.WriteString(`,"msg":`)
+	writeJSONString(w, msg)
+
+	for _, f := range l.context {
+		w.WriteByte(',')
+		f.WriteJSONTo(w)
+	}
+
+	for _, f := range ctx {
+		w.WriteByte(',')
+		f.WriteJSONTo(w)
+	}
+
+	w.WriteString("}\n")
+
+	w.Flush()
+}
@@ -429,3 +429,90 @@ func TestLogger_SetLeveF(t *testing.T) {
 		return
 	}
 }
+
+func TestJSONLogger(t *testing.T) {
+	now := time.Now()
+	nowStr := now.Format(log.RFC3339Milli)
+	buf := bytes.NewBuffer(nil)
+	l := log.NewJSONLogger(buf).With(log.String("service", "udf"))
+
+	l.Log(now, "info", "a \"quoted\" message", []log.Field{
+		log.Int("int", 10),
+		log.Int64("int64", -2),
+		log.Float64("float", 0.5),
+		log.Bool("bool", true),
+		log.Error(errors.New("failed")),
+		log.Strings("strings", []string{"a", "b"}),
+		log.Duration("duration", time.Second),
+		log.Time("time", defaultTime),
+		log.Stringer("stringer", testStringer("s")),
+		log.GroupedFields("group", []log.Field{log.String("a", "1"), log.Int("b", 2)}),
+	})
+	exp := fmt.Sprintf(`{"ts":%q,"lvl":"info","msg":"a \"quoted\" message","service":"udf","int":10,"int64":-2,"float":0.5,"bool":true,"err":"failed","strings":["a","b"],"duration":"1s","time":"2009-11-10T23:00:00Z","stringer":"s","group":{"a":"1","b":2}}`+"\n", nowStr)
+	if got := buf.String(); got != exp {
+		t.Fatalf("unexpected JSON log line:\ngot %s\nexp %s", got, exp)
+	}
+}
+
+func TestLogger_SetContextLevelF(t *testing.T) {
+	buf := bytes.NewBuffer(nil)
+	l := log.NewLogger(buf)
+	// Only debug lines of the udf service are logged.
+	l.SetContextLevelF(func(lvl log.Level, context, fields []log.Field) bool {
+		if service, ok := log.StringValue("service", context, fields); ok && service == "udf" {
+			return true
+		}
+		return lvl >= log.InfoLevel
+	})
+	udf := l.With(log.String("service", "udf"))
+	other := l.With(log.String("service", "http"))
+
+	udf.Debug("udf")
+	if buf.Len() == 0 {
+		t.Error("expected debug line of the udf service")
+	}
+	buf.Reset()
+	other.Debug("http")
+	if buf.Len() != 0 {
+		t.Errorf("unexpected debug line of the http service: %s", buf.String())
+	}
+	other.Debug("http", log.String("service", "udf"))
+	if buf.Len() == 0 {
+		t.Error("expected debug line with the fields of the udf service")
+	}
+}
+
+func TestLogger_SetTap(t *testing.T) {
+	now := time.Now()
+	nowStr := now.Format(log.RFC3339Milli)
+	buf := bytes.NewBuffer(nil)
+	l := log.NewLogger(buf)
+	// The tap applies to children created before it is set.
+	child := l.With(log.String("task", "cpu_alert"))
+
+	var lines []string
+	l.SetTap(func(level, msg string, context, fields []log.Field, render func() []byte) {
+		if task, ok := log.StringValue("task", context, fields); !ok || task != "cpu_alert" {
+			t.Errorf("unexpected task: %q", task)
+		}
+		if level != "info" || msg != "msg" {
+			t.Errorf("unexpected level and message: %q %q", level, msg)
+		}
+		lines = append(lines, string(render()))
+	})
+	child.Log(now, "info", "msg", []log.Field{log.Int("count", 1)})
+
+	exp := fmt.Sprintf(`{"ts":%q,"lvl":"info","msg":"msg","task":"cpu_alert","count":1}`+"\n", nowStr)
+	if len(lines) != 1 || lines[0] != exp {
+		t.Fatalf("unexpected tapped lines:\ngot %q\nexp %q", lines, exp)
+	}
+	if exp := fmt.Sprintf("ts=%s lvl=info msg=msg task=cpu_alert count=1\n", nowStr); buf.String() != exp {
+		t.Errorf("unexpected log line:\ngot %s\nexp %s", buf.String(), exp)
+	}
+
+	l.SetTap(nil)
+	child.Log(now, "info", "msg", nil)
+	if len(lines) != 1 {
+		t.Errorf("unexpected tapped line after removing the tap: %q", lines[1:])
+	}
+}
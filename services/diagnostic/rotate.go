@@ -0,0 +1,120 @@
+package diagnostic
+
+import (
+	"fmt"
+	"os"
+	"sync"
+	"time"
+)
+
+// rotatingFile is a log file that is rotated once it exceeds its maximum size or age.
+type rotatingFile struct {
+	path       string
+	maxSize    int64
+	maxAge     time.Duration
+	maxBackups int
+
+	mu     sync.Mutex
+	file   *os.File
+	size   int64
+	opened time.Time
+}
+
+func openRotatingFile(path string, maxSize int64, maxAge time.Duration, maxBackups int) (*rotatingFile, error) {
+	f := &rotatingFile{
+		path:       path,
+		maxSize:    maxSize,
+		maxAge:     maxAge,
+		maxBackups: maxBackups,
+	}
+	if err := f.open(); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+// open opens the log file for appending.
+func (f *rotatingFile) open() error {
+	file, err := os.OpenFile(f.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0640)
+	if err != nil {
+		return err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return err
+	}
+	f.file = file
+	f.size = info.Size()
+	f.opened = time.Now()
+	return nil
+}
+
+// Write writes to the log file, rotating the file first if the write would exceed its maximum size
+// or the file is older than its maximum age.
+func (f *rotatingFile) Write(b []byte) (int, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.file == nil {
+		if err := f.open(); err != nil {
+			return 0, err
+		}
+	}
+	if f.size > 0 && f.shouldRotate(len(b)) {
+		if err := f.rotate(); err != nil {
+			// Keep logging to the current file if it could not be rotated.
+			if f.file == nil {
+				return 0, err
+			}
+		}
+	}
+	n, err := f.file.Write(b)
+	f.size += int64(n)
+	return n, err
+}
+
+func (f *rotatingFile) shouldRotate(n int) bool {
+	if f.maxSize > 0 && f.size+int64(n) > f.maxSize {
+		return true
+	}
+	return f.maxAge > 0 && time.Since(f.opened) > f.maxAge
+}
+
+// rotate shifts each backup path.i to path.i+1, moves the log to path.1 and opens a new empty log.
+// The oldest backup beyond max-backups is overwritten.
+func (f *rotatingFile) rotate() error {
+	if err := f.file.Close(); err != nil {
+		return err
+	}
+	f.file = nil
+	if f.maxBackups == 0 {
+		if err := os.Remove(f.path); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	} else {
+		for i := f.maxBackups - 1; i > 0; i-- {
+			if err := os.Rename(f.backupPath(i), f.backupPath(i+1)); err != nil && !os.IsNotExist(err) {
+				return err
+			}
+		}
+		if err := os.Rename(f.path, f.backupPath(1)); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	return f.open()
+}
+
+func (f *rotatingFile) backupPath(i int) string {
+	return fmt.Sprintf("%s.%d", f.path, i)
+}
+
+func (f *rotatingFile) Close() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.file == nil {
+		return nil
+	}
+	err := f.file.Close()
+	f.file = nil
+	return err
+}
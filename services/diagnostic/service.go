@@ -8,6 +8,7 @@ import (
 	"path"
 	"strings"
 	"sync"
+	"time"
 
 	klog "github.com/influxdata/kapacitor/services/diagnostic/internal/log"
 )
@@ -30,6 +31,12 @@ type Service struct {
 
 	mu    sync.RWMutex
 	level string
+	// Levels that override the level for subsystems and tasks.
+	subsystems map[string]string
+	tasks      map[string]string
+
+	subsMu      sync.RWMutex
+	subscribers map[*logSubscriber]struct{}
 }
 
 func NewService(c Config, stdout, stderr io.Writer) *Service {
@@ -52,16 +59,66 @@ func (s *Service) SetLogLevelFromName(lvl string) error {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 	level := strings.ToUpper(lvl)
-	switch level {
-	case "INFO", "ERROR", "WARN", "DEBUG":
-		s.level = level
-	default:
+	if !validLevel(level) {
 		return errors.New("invalid log level")
 	}
+	s.level = level
+	return nil
+}
 
+// SetSubsystemLogLevel overrides the log level of a subsystem, by the name of its service.
+// The level "DEFAULT" removes the override.
+func (s *Service) SetSubsystemLogLevel(subsystem, lvl string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return setLevelOverride(s.subsystems, subsystem, lvl)
+}
+
+// SetTaskLogLevel overrides the log level of a task.
+// The level "DEFAULT" removes the override.
+func (s *Service) SetTaskLogLevel(task, lvl string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return setLevelOverride(s.tasks, task, lvl)
+}
+
+func setLevelOverride(overrides map[string]string, name, lvl string) error {
+	if name == "" {
+		return errors.New("must specify a name")
+	}
+	level := strings.ToUpper(lvl)
+	if level == "DEFAULT" {
+		delete(overrides, name)
+		return nil
+	}
+	if !validLevel(level) {
+		return errors.New("invalid log level")
+	}
+	overrides[name] = level
 	return nil
 }
 
+// logLevel returns the level of a line, the level of its task, subsystem or the global level.
+func (s *Service) logLevel(context, fields []klog.Field) klog.Level {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if len(s.tasks) > 0 {
+		if task, ok := klog.StringValue("task", context, fields); ok {
+			if level, ok := s.tasks[task]; ok {
+				return logLevelFromName(level)
+			}
+		}
+	}
+	if len(s.subsystems) > 0 {
+		if subsystem, ok := klog.StringValue("service", context, fields); ok {
+			if level, ok := s.subsystems[subsystem]; ok {
+				return logLevelFromName(level)
+			}
+		}
+	}
+	return logLevelFromName(s.level)
+}
+
 func logLevelFromName(lvl string) klog.Level {
 	var level klog.Level
 	switch lvl {
@@ -80,13 +137,19 @@ func logLevelFromName(lvl string) klog.Level {
 
 func (s *Service) Open() error {
 	s.mu.Lock()
-	s.level = s.c.Level
+	s.level = strings.ToUpper(s.c.Level)
+	s.subsystems = make(map[string]string, len(s.c.Subsystems))
+	for name, level := range s.c.Subsystems {
+		s.subsystems[name] = strings.ToUpper(level)
+	}
+	s.tasks = make(map[string]string, len(s.c.Tasks))
+	for id, level := range s.c.Tasks {
+		s.tasks[id] = strings.ToUpper(level)
+	}
 	s.mu.Unlock()
 
-	levelF := func(lvl klog.Level) bool {
-		s.mu.RLock()
-		defer s.mu.RUnlock()
-		return lvl >= logLevelFromName(s.level)
+	levelF := func(lvl klog.Level, context, fields []klog.Field) bool {
+		return lvl >= s.logLevel(context, fields)
 	}
 
 	switch s.c.File {
@@ -103,15 +166,19 @@ func (s *Service) Open() error {
 			}
 		}
 
-		f, err := os.OpenFile(s.c.File, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0640)
+		f, err := openRotatingFile(s.c.File, s.c.MaxSize, time.Duration(s.c.MaxAge), s.c.MaxBackups)
 		if err != nil {
 			return err
 		}
 		s.f = f
 	}
 
-	s.logger = klog.NewLogger(s.f)
-	s.logger.SetLevelF(levelF)
+	if s.c.Format == JSONFormat {
+		s.logger = klog.NewJSONLogger(s.f)
+	} else {
+		s.logger = klog.NewLogger(s.f)
+	}
+	s.logger.SetContextLevelF(levelF)
 	return nil
 }
 
@@ -290,6 +357,30 @@ func (s *Service) NewNoAuthHandler() *NoAuthHandler {
 	}
 }
 
+func (s *Service) NewUserStoreHandler() *UserStoreHandler {
+	return &UserStoreHandler{
+		l: s.logger.With(klog.String("service", "user-store")),
+	}
+}
+
+func (s *Service) NewAuditHandler() *AuditHandler {
+	return &AuditHandler{
+		l: s.logger.With(klog.String("service", "audit")),
+	}
+}
+
+func (s *Service) NewClusterHandler() *ClusterHandler {
+	return &ClusterHandler{
+		l: s.logger.With(klog.String("service", "cluster")),
+	}
+}
+
+func (s *Service) NewHAHandler() *HAHandler {
+	return &HAHandler{
+		l: s.logger.With(klog.String("service", "ha")),
+	}
+}
+
 func (s *Service) NewStatsHandler() *StatsHandler {
 	return &StatsHandler{
 		l: s.logger.With(klog.String("service", "stats")),
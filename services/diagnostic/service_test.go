@@ -0,0 +1,151 @@
+package diagnostic
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	klog "github.com/influxdata/kapacitor/services/diagnostic/internal/log"
+)
+
+func TestService_LevelOverrides(t *testing.T) {
+	buf := bytes.NewBuffer(nil)
+	c := NewConfig()
+	c.Level = "info"
+	c.Format = JSONFormat
+	c.Subsystems = map[string]string{"udf": "debug"}
+	s := NewService(c, nil, buf)
+	if err := s.Open(); err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	udf := s.NewUDFServiceHandler().l
+	httpd := s.NewHTTPDHandler().l
+
+	lines := func() []map[string]interface{} {
+		defer buf.Reset()
+		var lines []map[string]interface{}
+		for _, l := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+			if l == "" {
+				continue
+			}
+			var line map[string]interface{}
+			if err := json.Unmarshal([]byte(l), &line); err != nil {
+				t.Fatalf("invalid JSON line %q: %v", l, err)
+			}
+			lines = append(lines, line)
+		}
+		return lines
+	}
+
+	udf.Debug("udf debug")
+	httpd.Debug("http debug")
+	httpd.Debug("task debug", klog.String("task", "cpu_alert"))
+	if got := lines(); len(got) != 1 || got[0]["msg"] != "udf debug" || got[0]["service"] != "udf" {
+		t.Fatalf("unexpected lines with subsystem override: %v", got)
+	}
+
+	if err := s.SetTaskLogLevel("cpu_alert", "DEBUG"); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.SetSubsystemLogLevel("udf", "default"); err != nil {
+		t.Fatal(err)
+	}
+	udf.Debug("udf debug")
+	httpd.Debug("task debug", klog.String("task", "cpu_alert"))
+	if got := lines(); len(got) != 1 || got[0]["msg"] != "task debug" {
+		t.Fatalf("unexpected lines with task override: %v", got)
+	}
+
+	if err := s.SetTaskLogLevel("cpu_alert", "verbose"); err == nil {
+		t.Error("expected error setting an invalid level")
+	}
+}
+
+func TestService_Rotate(t *testing.T) {
+	dir, err := ioutil.TempDir("", "diagnostic")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	c := NewConfig()
+	c.File = filepath.Join(dir, "kapacitor.log")
+	c.MaxSize = 200
+	c.MaxBackups = 2
+	s := NewService(c, nil, nil)
+	if err := s.Open(); err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	l := s.NewHTTPDHandler().l
+	for i := 0; i < 20; i++ {
+		l.Info("a line that is long enough to rotate the log after a few lines")
+	}
+
+	for _, p := range []string{c.File, c.File + ".1", c.File + ".2"} {
+		info, err := os.Stat(p)
+		if err != nil {
+			t.Fatalf("expected log file %s: %v", p, err)
+		}
+		if info.Size() > c.MaxSize {
+			t.Errorf("log file %s exceeds max size: %d", p, info.Size())
+		}
+	}
+	if _, err := os.Stat(c.File + ".3"); !os.IsNotExist(err) {
+		t.Errorf("expected at most %d backups", c.MaxBackups)
+	}
+}
+
+func TestService_SubscribeLogs(t *testing.T) {
+	s := NewService(NewConfig(), nil, ioutil.Discard)
+	if err := s.Open(); err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	l := s.NewHTTPDHandler().l
+	lines, cancel := s.SubscribeLogs(map[string]string{"task": "cpu_alert"}, 2)
+
+	l.Info("other task", klog.String("task", "mem_alert"))
+	task := l.With(klog.String("task", "cpu_alert"))
+	task.Info("first")
+	task.Info("second", klog.Int("count", 2))
+	// Dropped, the buffer is full.
+	task.Info("third")
+
+	for _, exp := range []string{"first", "second"} {
+		var line map[string]interface{}
+		if err := json.Unmarshal(<-lines, &line); err != nil {
+			t.Fatal(err)
+		}
+		if got := line["msg"]; got != exp {
+			t.Errorf("unexpected line: got %v exp %s", got, exp)
+		}
+		if got := line["task"]; got != "cpu_alert" {
+			t.Errorf("unexpected task: got %v", got)
+		}
+	}
+	select {
+	case line := <-lines:
+		t.Errorf("unexpected line after full buffer: %s", line)
+	default:
+	}
+
+	cancel()
+	task.Info("after cancel")
+	select {
+	case line := <-lines:
+		t.Errorf("unexpected line after cancel: %s", line)
+	default:
+	}
+	if len(s.subscribers) != 0 {
+		t.Errorf("expected no subscribers after cancel, got %d", len(s.subscribers))
+	}
+}
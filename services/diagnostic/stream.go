@@ -0,0 +1,89 @@
+package diagnostic
+
+import (
+	klog "github.com/influxdata/kapacitor/services/diagnostic/internal/log"
+)
+
+// logSubscriber receives the log lines that match its filter.
+type logSubscriber struct {
+	filter map[string]string
+	lines  chan []byte
+}
+
+// matches reports whether every key of the filter has the value in the line.
+// The keys lvl and msg match the level and message, all other keys match string fields.
+func (sub *logSubscriber) matches(level, msg string, context, fields []klog.Field) bool {
+	for k, v := range sub.filter {
+		var value string
+		switch k {
+		case "lvl":
+			value = level
+		case "msg":
+			value = msg
+		default:
+			var ok bool
+			if value, ok = klog.StringValue(k, context, fields); !ok {
+				return false
+			}
+		}
+		if value != v {
+			return false
+		}
+	}
+	return true
+}
+
+// SubscribeLogs returns a channel of the log lines, as JSON, whose keys have the values of the filter,
+// i.e. task=cpu_alert, node=alert2 or lvl=error.
+// At most buffer lines are buffered, when the buffer is full lines are dropped
+// so that a slow subscriber never blocks logging.
+// The returned func ends the subscription and must be called once the lines are no longer read.
+func (s *Service) SubscribeLogs(filter map[string]string, buffer int) (<-chan []byte, func()) {
+	sub := &logSubscriber{
+		filter: filter,
+		lines:  make(chan []byte, buffer),
+	}
+
+	s.subsMu.Lock()
+	defer s.subsMu.Unlock()
+	if s.subscribers == nil {
+		s.subscribers = make(map[*logSubscriber]struct{})
+	}
+	s.subscribers[sub] = struct{}{}
+	if len(s.subscribers) == 1 {
+		s.logger.SetTap(s.publishLog)
+	}
+
+	return sub.lines, func() {
+		s.subsMu.Lock()
+		defer s.subsMu.Unlock()
+		if _, ok := s.subscribers[sub]; !ok {
+			return
+		}
+		delete(s.subscribers, sub)
+		if len(s.subscribers) == 0 {
+			// Stop rendering lines for the tap when nobody is listening.
+			s.logger.SetTap(nil)
+		}
+	}
+}
+
+// publishLog sends the line to the subscribers whose filter matches it.
+// The line is only rendered if a filter matches it.
+func (s *Service) publishLog(level, msg string, context, fields []klog.Field, render func() []byte) {
+	s.subsMu.RLock()
+	defer s.subsMu.RUnlock()
+	var line []byte
+	for sub := range s.subscribers {
+		if !sub.matches(level, msg, context, fields) {
+			continue
+		}
+		if line == nil {
+			line = render()
+		}
+		select {
+		case sub.lines <- line:
+		default:
+		}
+	}
+}
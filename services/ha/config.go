@@ -0,0 +1,97 @@
+package ha
+
+import (
+	"fmt"
+	"net/url"
+	"time"
+
+	"github.com/influxdata/influxdb/toml"
+)
+
+const (
+	FileBackend   = "file"
+	ConsulBackend = "consul"
+
+	DefaultBackend       = FileBackend
+	DefaultConsulKey     = "kapacitor/leader"
+	DefaultLeaseDuration = toml.Duration(10 * time.Second)
+	DefaultRenewInterval = toml.Duration(2 * time.Second)
+
+	// minConsulLeaseDuration is the shortest TTL of a Consul session.
+	minConsulLeaseDuration = toml.Duration(10 * time.Second)
+)
+
+type Config struct {
+	Enabled bool `toml:"enabled"`
+	// Name uniquely identifies this instance.
+	// Defaults to the hostname.
+	Name string `toml:"name"`
+	// AdvertiseURL is the URL of the HTTP API of this instance as reachable by the other instance.
+	// Defaults to the hostname and the port of the HTTP API.
+	AdvertiseURL string `toml:"advertise-url"`
+	// Backend holds the lease of the leader, either "file" or "consul".
+	Backend string `toml:"backend"`
+	// Path is the path of the lease file shared by the instances, for the file backend.
+	Path string `toml:"path"`
+	// ConsulID names the [[consul]] section of the Consul agent holding the lease, for the consul backend.
+	ConsulID string `toml:"consul-id"`
+	// ConsulKey is the key of the lease in Consul.
+	ConsulKey string `toml:"consul-key"`
+	// LeaseDuration is how long the leader holds the lease without renewing it,
+	// i.e. how long it takes the follower to take over once the leader died.
+	LeaseDuration toml.Duration `toml:"lease-duration"`
+	// RenewInterval is how often the lease is renewed by the leader, or tried to be acquired by the follower,
+	// and how often the follower copies the stores of the leader.
+	RenewInterval toml.Duration `toml:"renew-interval"`
+	// Username and Password authenticate the requests to the leader,
+	// when authentication is enabled on its HTTP API.
+	Username string `toml:"username"`
+	Password string `toml:"password"`
+	// InsecureSkipVerify skips the verification of the certificate of the leader.
+	InsecureSkipVerify bool `toml:"insecure-skip-verify"`
+}
+
+func NewConfig() Config {
+	return Config{
+		Backend:       DefaultBackend,
+		ConsulKey:     DefaultConsulKey,
+		LeaseDuration: DefaultLeaseDuration,
+		RenewInterval: DefaultRenewInterval,
+	}
+}
+
+func (c Config) Validate() error {
+	if !c.Enabled {
+		return nil
+	}
+	if c.AdvertiseURL != "" {
+		if _, err := url.Parse(c.AdvertiseURL); err != nil {
+			return fmt.Errorf("invalid advertise-url %q: %v", c.AdvertiseURL, err)
+		}
+	}
+	switch c.Backend {
+	case FileBackend:
+		if c.Path == "" {
+			return fmt.Errorf("path must be set for the %s backend", FileBackend)
+		}
+	case ConsulBackend:
+		if c.ConsulID == "" {
+			return fmt.Errorf("consul-id must be set for the %s backend", ConsulBackend)
+		}
+		if c.ConsulKey == "" {
+			return fmt.Errorf("consul-key must be set for the %s backend", ConsulBackend)
+		}
+		if c.LeaseDuration < minConsulLeaseDuration {
+			return fmt.Errorf("lease-duration must be at least %v for the %s backend", minConsulLeaseDuration, ConsulBackend)
+		}
+	default:
+		return fmt.Errorf("unknown backend %q, must be one of %q or %q", c.Backend, FileBackend, ConsulBackend)
+	}
+	if c.RenewInterval <= 0 {
+		return fmt.Errorf("renew-interval must be positive")
+	}
+	if c.LeaseDuration <= c.RenewInterval {
+		return fmt.Errorf("lease-duration must be greater than renew-interval")
+	}
+	return nil
+}
@@ -0,0 +1,131 @@
+package ha
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/hashicorp/consul/api"
+	"github.com/influxdata/kapacitor/services/consul"
+)
+
+// consulLockDelay is how long the lease cannot be acquired once the session of the leader expired.
+const consulLockDelay = time.Second
+
+// ConsulElector holds the lease in a key of Consul, locked by a session of the leader.
+// The session expires and releases the lease if the leader does not renew it in time.
+type ConsulElector struct {
+	key      string
+	ttl      time.Duration
+	kv       *api.KV
+	sessions *api.Session
+	session  string
+}
+
+// NewConsulElector creates an elector granting leases of the given duration in the key
+// of the Consul agent of the configuration.
+func NewConsulElector(c consul.Config, key string, ttl time.Duration) (*ConsulElector, error) {
+	conf := &api.Config{
+		Address:    c.Address,
+		Scheme:     c.Scheme,
+		Datacenter: c.Datacenter,
+		Token:      c.Token,
+		TLSConfig: api.TLSConfig{
+			Address:            c.SSLServerName,
+			CAFile:             c.SSLCA,
+			CertFile:           c.SSLCert,
+			KeyFile:            c.SSLKey,
+			InsecureSkipVerify: c.InsecureSkipVerify,
+		},
+	}
+	if c.Username != "" {
+		conf.HttpAuth = &api.HttpBasicAuth{
+			Username: c.Username,
+			Password: c.Password,
+		}
+	}
+	cli, err := api.NewClient(conf)
+	if err != nil {
+		return nil, err
+	}
+	return &ConsulElector{
+		key:      key,
+		ttl:      ttl,
+		kv:       cli.KV(),
+		sessions: cli.Session(),
+	}, nil
+}
+
+func (e *ConsulElector) Acquire(candidate Lease) (Lease, error) {
+	if err := e.renewSession(); err != nil {
+		return Lease{}, err
+	}
+	value, err := json.Marshal(candidate)
+	if err != nil {
+		return Lease{}, err
+	}
+	acquired, _, err := e.kv.Acquire(&api.KVPair{
+		Key:     e.key,
+		Value:   value,
+		Session: e.session,
+	}, nil)
+	if err != nil {
+		return Lease{}, err
+	}
+	if acquired {
+		return candidate, nil
+	}
+	pair, _, err := e.kv.Get(e.key, nil)
+	if err != nil {
+		return Lease{}, err
+	}
+	var holder Lease
+	if pair == nil || pair.Session == "" {
+		return holder, nil
+	}
+	err = json.Unmarshal(pair.Value, &holder)
+	return holder, err
+}
+
+// renewSession renews the session of the candidate, or creates a new one if it expired.
+func (e *ConsulElector) renewSession() error {
+	if e.session != "" {
+		entry, _, err := e.sessions.Renew(e.session, nil)
+		if err != nil {
+			return err
+		}
+		if entry != nil {
+			return nil
+		}
+	}
+	id, _, err := e.sessions.Create(&api.SessionEntry{
+		Name:      "kapacitor leader lease",
+		TTL:       e.ttl.String(),
+		LockDelay: consulLockDelay,
+		Behavior:  api.SessionBehaviorRelease,
+	}, nil)
+	if err != nil {
+		return err
+	}
+	e.session = id
+	return nil
+}
+
+func (e *ConsulElector) Release(candidate Lease) error {
+	if e.session == "" {
+		return nil
+	}
+	_, _, err := e.kv.Release(&api.KVPair{
+		Key:     e.key,
+		Session: e.session,
+	}, nil)
+	return err
+}
+
+func (e *ConsulElector) Close() error {
+	if e.session == "" {
+		return nil
+	}
+	_, err := e.sessions.Destroy(e.session, nil)
+	e.session = ""
+	return err
+}
@@ -0,0 +1,123 @@
+package ha
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/boltdb/bolt"
+)
+
+// Lease identifies the instance holding the lease, i.e. the leader.
+type Lease struct {
+	Name string `json:"name"`
+	URL  string `json:"url"`
+}
+
+// Elector elects the leader by granting a lease to one of the candidates.
+type Elector interface {
+	// Acquire acquires the lease for the candidate, or renews it if the candidate already holds it,
+	// and returns the holder of the lease.
+	// The returned lease is empty if no candidate holds the lease.
+	Acquire(candidate Lease) (Lease, error)
+	// Release releases the lease if the candidate holds it.
+	Release(candidate Lease) error
+	Close() error
+}
+
+var (
+	leaseBucket = []byte("lease")
+	leaseKey    = []byte("leader")
+)
+
+type fileLease struct {
+	Lease
+	Expires time.Time `json:"expires"`
+}
+
+// FileElector holds the lease in a bolt file shared by the candidates.
+// The file is only opened while the lease is acquired or released,
+// so that the lock of the file is held by one candidate at a time.
+type FileElector struct {
+	path    string
+	ttl     time.Duration
+	timeout time.Duration
+}
+
+// NewFileElector creates an elector granting leases of the given duration in the file at the path.
+// The candidates must share the clock, i.e. run on the same host or on hosts with synchronized clocks.
+func NewFileElector(path string, ttl, timeout time.Duration) *FileElector {
+	return &FileElector{
+		path:    path,
+		ttl:     ttl,
+		timeout: timeout,
+	}
+}
+
+func (e *FileElector) Acquire(candidate Lease) (Lease, error) {
+	var holder Lease
+	err := e.update(func(b *bolt.Bucket) error {
+		l, err := readLease(b)
+		if err != nil {
+			return err
+		}
+		now := time.Now()
+		if l.Name == "" || l.Name == candidate.Name || now.After(l.Expires) {
+			l = fileLease{
+				Lease:   candidate,
+				Expires: now.Add(e.ttl),
+			}
+			data, err := json.Marshal(l)
+			if err != nil {
+				return err
+			}
+			if err := b.Put(leaseKey, data); err != nil {
+				return err
+			}
+		}
+		holder = l.Lease
+		return nil
+	})
+	return holder, err
+}
+
+func (e *FileElector) Release(candidate Lease) error {
+	return e.update(func(b *bolt.Bucket) error {
+		l, err := readLease(b)
+		if err != nil {
+			return err
+		}
+		if l.Name != candidate.Name {
+			return nil
+		}
+		return b.Delete(leaseKey)
+	})
+}
+
+func (e *FileElector) Close() error {
+	return nil
+}
+
+func (e *FileElector) update(f func(*bolt.Bucket) error) error {
+	db, err := bolt.Open(e.path, 0600, &bolt.Options{Timeout: e.timeout})
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+	return db.Update(func(tx *bolt.Tx) error {
+		b, err := tx.CreateBucketIfNotExists(leaseBucket)
+		if err != nil {
+			return err
+		}
+		return f(b)
+	})
+}
+
+func readLease(b *bolt.Bucket) (fileLease, error) {
+	var l fileLease
+	data := b.Get(leaseKey)
+	if data == nil {
+		return l, nil
+	}
+	err := json.Unmarshal(data, &l)
+	return l, err
+}
@@ -0,0 +1,59 @@
+package ha_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/influxdata/kapacitor/services/ha"
+)
+
+func TestFileElector(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ha")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "lease.db")
+	ttl := 100 * time.Millisecond
+
+	a := ha.Lease{Name: "a", URL: "http://a:9092"}
+	b := ha.Lease{Name: "b", URL: "http://b:9092"}
+	ea := ha.NewFileElector(path, ttl, time.Second)
+	eb := ha.NewFileElector(path, ttl, time.Second)
+
+	acquire := func(e ha.Elector, c, exp ha.Lease) {
+		holder, err := e.Acquire(c)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if holder != exp {
+			t.Fatalf("unexpected holder of the lease for %s: got %v exp %v", c.Name, holder, exp)
+		}
+	}
+
+	// The first candidate acquires the lease and keeps it while renewing it.
+	acquire(ea, a, a)
+	acquire(eb, b, a)
+	time.Sleep(ttl / 2)
+	acquire(ea, a, a)
+	time.Sleep(ttl / 2)
+	acquire(eb, b, a)
+
+	// The lease is acquired by the other candidate once it expired.
+	time.Sleep(2 * ttl)
+	acquire(eb, b, b)
+	acquire(ea, a, b)
+
+	// The lease is acquired by the other candidate once it is released.
+	if err := ea.Release(a); err != nil {
+		t.Fatal(err)
+	}
+	acquire(ea, a, b)
+	if err := eb.Release(b); err != nil {
+		t.Fatal(err)
+	}
+	acquire(ea, a, a)
+}
@@ -0,0 +1,216 @@
+package ha
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+
+	"github.com/influxdata/kapacitor/keyvalue"
+	"github.com/influxdata/kapacitor/services/httpd"
+	"github.com/influxdata/kapacitor/services/storage"
+)
+
+// Store returns the namespaced store of the storage service.
+// The store is copied by the followers while this instance is the leader,
+// and replaced with the store of the leader while this instance is a follower.
+func (s *Service) Store(namespace string) storage.Interface {
+	store := s.StorageService.Store(namespace)
+	if !s.conf.Enabled {
+		return store
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.stores[namespace] = store
+	return &revisionedStore{
+		Interface: store,
+		s:         s,
+	}
+}
+
+func (s *Service) Register(name string, store storage.StoreActioner) {
+	s.StorageService.Register(name, store)
+}
+
+func (s *Service) Versions() storage.Versions {
+	return s.StorageService.Versions()
+}
+
+// revision returns the current revision of the stores.
+// Must be called with the read lock held.
+func (s *Service) revision() string {
+	return s.epoch + "-" + strconv.FormatUint(s.changes, 10)
+}
+
+type keyValue struct {
+	Key   string `json:"key"`
+	Value []byte `json:"value"`
+}
+
+type snapshot struct {
+	Revision string                `json:"revision"`
+	Stores   map[string][]keyValue `json:"stores"`
+}
+
+func (s *Service) handleSnapshot(w http.ResponseWriter, r *http.Request) {
+	s.mu.RLock()
+	isLeader := s.isLeader
+	snap := snapshot{
+		Revision: s.revision(),
+		Stores:   make(map[string][]keyValue, len(s.stores)),
+	}
+	stores := make(map[string]storage.Interface, len(s.stores))
+	for ns, store := range s.stores {
+		stores[ns] = store
+	}
+	s.mu.RUnlock()
+
+	if !isLeader {
+		httpd.HttpError(w, "not the leader", true, http.StatusServiceUnavailable)
+		return
+	}
+	if r.URL.Query().Get("revision") == snap.Revision {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+	// The revision is read before the stores, so that changes made meanwhile are copied by the next sync.
+	for ns, store := range stores {
+		kvs, err := list(store)
+		if err != nil {
+			httpd.HttpError(w, err.Error(), true, http.StatusInternalServerError)
+			return
+		}
+		snap.Stores[ns] = kvs
+	}
+	w.Write(httpd.MarshalJSON(snap, false))
+}
+
+// sync replaces the stores of this follower with the stores of the leader, if they changed.
+func (s *Service) sync(leader Lease) {
+	s.mu.RLock()
+	revision := s.synced
+	s.mu.RUnlock()
+
+	snap, err := s.snapshot(leader, revision)
+	if err != nil {
+		s.diag.Error("failed to copy stores of leader", err, keyvalue.KV("leader", leader.Name))
+		return
+	}
+	if snap == nil {
+		// Unchanged
+		return
+	}
+	for ns, kvs := range snap.Stores {
+		changed, err := replace(s.StorageService.Store(ns), kvs)
+		if err != nil {
+			s.diag.Error("failed to replace store with store of leader", err, keyvalue.KV("leader", leader.Name), keyvalue.KV("namespace", ns))
+			return
+		}
+		if changed {
+			s.notify(ns)
+		}
+	}
+	s.mu.Lock()
+	s.synced = snap.Revision
+	s.mu.Unlock()
+	s.statMap.Add(statSyncs, 1)
+}
+
+// snapshot gets the stores of the leader, or nil if they have not changed since the revision.
+func (s *Service) snapshot(leader Lease, revision string) (*snapshot, error) {
+	u := leader.URL + httpd.BasePath + storagePath + "?" + url.Values{"revision": {revision}}.Encode()
+	req, err := http.NewRequest("GET", u, nil)
+	if err != nil {
+		return nil, err
+	}
+	if s.conf.Username != "" {
+		req.SetBasicAuth(s.conf.Username, s.conf.Password)
+	}
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	switch resp.StatusCode {
+	case http.StatusOK:
+	case http.StatusNotModified:
+		return nil, nil
+	default:
+		msg, _ := ioutil.ReadAll(resp.Body)
+		return nil, fmt.Errorf("unexpected response code %d from %s: %s", resp.StatusCode, u, bytes.TrimSpace(msg))
+	}
+	snap := new(snapshot)
+	if err := json.NewDecoder(resp.Body).Decode(snap); err != nil {
+		return nil, err
+	}
+	return snap, nil
+}
+
+func list(store storage.Interface) (kvs []keyValue, err error) {
+	err = store.View(func(tx storage.ReadOnlyTx) error {
+		all, err := tx.List("")
+		if err != nil {
+			return err
+		}
+		kvs = make([]keyValue, len(all))
+		for i, kv := range all {
+			kvs[i] = keyValue{Key: kv.Key, Value: kv.Value}
+		}
+		return nil
+	})
+	return
+}
+
+// replace replaces the keys of the store with the keys, reporting whether any key changed.
+func replace(store storage.Interface, kvs []keyValue) (changed bool, err error) {
+	err = store.Update(func(tx storage.Tx) error {
+		existing, err := tx.List("")
+		if err != nil {
+			return err
+		}
+		values := make(map[string][]byte, len(existing))
+		for _, kv := range existing {
+			values[kv.Key] = kv.Value
+		}
+		for _, kv := range kvs {
+			if v, ok := values[kv.Key]; ok {
+				delete(values, kv.Key)
+				if bytes.Equal(v, kv.Value) {
+					continue
+				}
+			}
+			// Empty values are decoded as nil
+			if err := tx.Put(kv.Key, append([]byte{}, kv.Value...)); err != nil {
+				return err
+			}
+			changed = true
+		}
+		for key := range values {
+			if err := tx.Delete(key); err != nil {
+				return err
+			}
+			changed = true
+		}
+		return nil
+	})
+	return
+}
+
+// revisionedStore changes the revision of the stores whenever it is updated.
+type revisionedStore struct {
+	storage.Interface
+	s *Service
+}
+
+func (r *revisionedStore) Update(f func(storage.Tx) error) error {
+	if err := r.Interface.Update(f); err != nil {
+		return err
+	}
+	r.s.mu.Lock()
+	r.s.changes++
+	r.s.mu.Unlock()
+	return nil
+}
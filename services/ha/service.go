@@ -0,0 +1,315 @@
+package ha
+
+import (
+	"crypto/tls"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	kexpvar "github.com/influxdata/kapacitor/expvar"
+	"github.com/influxdata/kapacitor/keyvalue"
+	"github.com/influxdata/kapacitor/server/vars"
+	"github.com/influxdata/kapacitor/services/cluster"
+	"github.com/influxdata/kapacitor/services/httpd"
+	"github.com/influxdata/kapacitor/services/storage"
+)
+
+const (
+	haPath      = "/ha"
+	storagePath = haPath + "/storage"
+)
+
+const (
+	statLeader        = "leader"
+	statLeaderChanges = "leader_changes"
+	statSyncs         = "syncs"
+)
+
+// The roles reported by the service.
+const (
+	RoleLeader   = "leader"
+	RoleFollower = "follower"
+)
+
+type Diagnostic interface {
+	Error(msg string, err error, ctx ...keyvalue.T)
+	BecameLeader()
+	BecameFollower(leader string)
+}
+
+// Service elects the leader among two or more instances.
+// Only the leader runs the tasks, while the followers copy the stores of the leader,
+// so that one of them can take over once the leader dies.
+//
+// When disabled the service passes through to the cluster service.
+type Service struct {
+	conf Config
+	self Lease
+
+	mu sync.RWMutex
+	// leader is the holder of the lease, it is empty if unknown.
+	leader   Lease
+	isLeader bool
+	// renewed is when the lease was last acquired or renewed by this instance.
+	renewed time.Time
+	// stores are the underlying stores of the replicated namespaces.
+	stores map[string]storage.Interface
+	// epoch and changes make up the revision of the stores, which changes whenever a store changes.
+	epoch   string
+	changes uint64
+	// synced is the revision of the stores of the leader last copied by this follower.
+	synced   string
+	watchers []*watcher
+
+	client *http.Client
+	routes []httpd.Route
+
+	closing chan struct{}
+	wg      sync.WaitGroup
+
+	statKey   string
+	statMap   *kexpvar.Map
+	leaderVar *kexpvar.Int
+
+	Elector Elector
+
+	HTTPDService interface {
+		AddRoutes([]httpd.Route) error
+		DelRoutes([]httpd.Route)
+	}
+	StorageService interface {
+		Store(namespace string) storage.Interface
+		Register(name string, store storage.StoreActioner)
+		Versions() storage.Versions
+	}
+	ClusterService interface {
+		Owns(taskID string) bool
+		Watch(namespace string, f func())
+		SetStreamTasks(streams map[string][]cluster.DBRP)
+	}
+
+	diag Diagnostic
+}
+
+type watcher struct {
+	namespace string
+	signal    chan struct{}
+}
+
+func NewService(c Config, d Diagnostic) *Service {
+	return &Service{
+		conf: c,
+		self: Lease{
+			Name: c.Name,
+			URL:  strings.TrimSuffix(c.AdvertiseURL, "/"),
+		},
+		stores: make(map[string]storage.Interface),
+		epoch:  fmt.Sprintf("%s-%d", c.Name, time.Now().UnixNano()),
+		client: &http.Client{
+			Transport: &http.Transport{
+				Proxy: http.ProxyFromEnvironment,
+				TLSClientConfig: &tls.Config{
+					InsecureSkipVerify: c.InsecureSkipVerify,
+				},
+			},
+			Timeout: time.Duration(c.LeaseDuration),
+		},
+		closing: make(chan struct{}),
+		diag:    d,
+	}
+}
+
+func (s *Service) Open() error {
+	if !s.conf.Enabled {
+		return nil
+	}
+	s.statKey, s.statMap = vars.NewStatistic("ha", map[string]string{"name": s.self.Name})
+	s.leaderVar = new(kexpvar.Int)
+	s.statMap.Set(statLeader, s.leaderVar)
+
+	s.routes = []httpd.Route{
+		{
+			Method:      "GET",
+			Pattern:     storagePath,
+			HandlerFunc: s.handleSnapshot,
+			NoAudit:     true,
+		},
+	}
+	if err := s.HTTPDService.AddRoutes(s.routes); err != nil {
+		return err
+	}
+
+	// Elect the leader before the tasks are started.
+	s.elect()
+
+	s.wg.Add(1)
+	go s.run()
+	return nil
+}
+
+func (s *Service) Close() error {
+	if !s.conf.Enabled {
+		return nil
+	}
+	close(s.closing)
+	s.HTTPDService.DelRoutes(s.routes)
+	s.wg.Wait()
+
+	// Hand over to a follower right away instead of once the lease expired.
+	s.mu.RLock()
+	isLeader := s.isLeader
+	s.mu.RUnlock()
+	if isLeader {
+		if err := s.Elector.Release(s.self); err != nil {
+			s.diag.Error("failed to release lease", err)
+		}
+	}
+	vars.DeleteStatistic(s.statKey)
+	return s.Elector.Close()
+}
+
+func (s *Service) run() {
+	defer s.wg.Done()
+	ticker := time.NewTicker(time.Duration(s.conf.RenewInterval))
+	defer ticker.Stop()
+	for {
+		select {
+		case <-s.closing:
+			return
+		case <-ticker.C:
+			s.elect()
+		}
+	}
+}
+
+// elect acquires or renews the lease and changes the role of this instance if the holder changed.
+// A follower then copies the stores of the leader.
+func (s *Service) elect() {
+	// The lease is renewed for the lease duration from some time during the call,
+	// so the renewal is counted from before the call to never overestimate the lease.
+	renewed := time.Now()
+	holder, err := s.Elector.Acquire(s.self)
+	now := time.Now()
+
+	s.mu.Lock()
+	wasLeader := s.isLeader
+	if err != nil {
+		s.diag.Error("failed to acquire lease", err)
+		// The lease may be acquired by another instance once it expires,
+		// so step down early enough to never have two leaders.
+		if s.isLeader && now.Sub(s.renewed) >= time.Duration(s.conf.LeaseDuration-s.conf.RenewInterval) {
+			s.isLeader = false
+			s.leader = Lease{}
+		}
+	} else {
+		s.leader = holder
+		s.isLeader = holder.Name == s.self.Name
+		if s.isLeader {
+			s.renewed = renewed
+		}
+	}
+	isLeader := s.isLeader
+	leader := s.leader
+	s.mu.Unlock()
+
+	if isLeader != wasLeader {
+		s.statMap.Add(statLeaderChanges, 1)
+		if isLeader {
+			s.leaderVar.Set(1)
+			s.diag.BecameLeader()
+		} else {
+			s.leaderVar.Set(0)
+			s.diag.BecameFollower(leader.Name)
+		}
+		// Start or stop the tasks.
+		s.notify("")
+	}
+	if !isLeader && leader.URL != "" {
+		s.sync(leader)
+	}
+}
+
+// Role returns the role of this instance, or the empty string if the service is disabled.
+func (s *Service) Role() string {
+	if !s.conf.Enabled {
+		return ""
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if s.isLeader {
+		return RoleLeader
+	}
+	return RoleFollower
+}
+
+// Leader returns the URL of the leader, if it is known, when this instance is a follower.
+func (s *Service) Leader() (string, bool) {
+	if !s.conf.Enabled {
+		return "", false
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if s.isLeader {
+		return "", false
+	}
+	return s.leader.URL, true
+}
+
+// Owns reports whether the task runs on this instance, i.e. whether this instance is the leader.
+func (s *Service) Owns(taskID string) bool {
+	if !s.conf.Enabled {
+		return s.ClusterService.Owns(taskID)
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.isLeader
+}
+
+func (s *Service) SetStreamTasks(streams map[string][]cluster.DBRP) {
+	s.ClusterService.SetStreamTasks(streams)
+}
+
+// Watch calls f whenever the role of this instance changes or the store of the namespace
+// has been copied from the leader.
+// The calls are made from a separate goroutine and coalesced while f is running.
+func (s *Service) Watch(namespace string, f func()) {
+	if !s.conf.Enabled {
+		s.ClusterService.Watch(namespace, f)
+		return
+	}
+	w := &watcher{
+		namespace: namespace,
+		signal:    make(chan struct{}, 1),
+	}
+	s.mu.Lock()
+	s.watchers = append(s.watchers, w)
+	s.mu.Unlock()
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		for {
+			select {
+			case <-s.closing:
+				return
+			case <-w.signal:
+				f()
+			}
+		}
+	}()
+}
+
+// notify signals the watchers of the namespace, or all watchers if the namespace is empty.
+func (s *Service) notify(namespace string) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	for _, w := range s.watchers {
+		if namespace == "" || w.namespace == namespace {
+			select {
+			case w.signal <- struct{}{}:
+			default:
+			}
+		}
+	}
+}
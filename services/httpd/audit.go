@@ -0,0 +1,212 @@
+package httpd
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/influxdata/kapacitor/audit"
+	"github.com/influxdata/kapacitor/auth"
+)
+
+// isMutating reports whether requests with the method change the state of the server.
+func isMutating(method string) bool {
+	switch method {
+	case "POST", "PATCH", "PUT", "DELETE":
+		return true
+	}
+	return false
+}
+
+// audit wraps the handler of a mutating route so that each request is recorded in the audit log.
+func (h *Handler) audit(route Route, inner AuthorizationHandler) AuthorizationHandler {
+	if route.NoAudit || !isMutating(route.Method) {
+		return inner
+	}
+	return func(w http.ResponseWriter, r *http.Request, user auth.User) {
+		if h.AuditService == nil {
+			inner(w, r, user)
+			return
+		}
+		// Requests below an anchored pattern address a single item, i.e. /tasks/ID,
+		// all others address a collection.
+		item := strings.HasSuffix(route.Pattern, "/") && len(r.URL.Path) > len(route.Pattern)
+		record := audit.Record{
+			Time:     time.Now().UTC(),
+			Resource: strings.TrimPrefix(r.URL.Path, BasePath),
+			Action:   auditAction(r, item),
+			Method:   r.Method,
+		}
+		if user.Name() != auth.AdminUser.Name() {
+			record.User = user.Name()
+		}
+		if item {
+			record.Before = h.stateDigest(r.URL.Path)
+		}
+
+		aw := &auditResponseWriter{
+			ResponseWriter: w,
+			status:         http.StatusOK,
+		}
+		inner(aw, r, user)
+
+		record.Status = aw.status
+		if aw.body.Len() > 0 && aw.status < http.StatusMultipleChoices && r.Method != "DELETE" {
+			record.After = digest(aw.body.Bytes())
+		}
+		h.AuditService.Record(record)
+	}
+}
+
+// auditAction returns the audit action of the request.
+// Updates that only change the status of a task are recorded as enables or disables.
+func auditAction(r *http.Request, item bool) string {
+	switch r.Method {
+	case "DELETE":
+		return audit.DeleteAction
+	case "POST":
+		if !item {
+			return audit.CreateAction
+		}
+	case "PATCH":
+		body, err := ioutil.ReadAll(r.Body)
+		r.Body.Close()
+		r.Body = ioutil.NopCloser(bytes.NewReader(body))
+		if err != nil {
+			break
+		}
+		var update struct {
+			Status string `json:"status"`
+		}
+		if json.Unmarshal(body, &update) == nil {
+			switch update.Status {
+			case "enabled":
+				return audit.EnableAction
+			case "disabled":
+				return audit.DisableAction
+			}
+		}
+	}
+	return audit.UpdateAction
+}
+
+// addStateRoute registers GET routes of the API so that the state of a resource
+// can be read before it is changed.
+func (h *Handler) addStateRoute(r Route) error {
+	if r.Method != "GET" || !strings.HasPrefix(r.Pattern, BasePath+"/") {
+		return nil
+	}
+	var handler http.HandlerFunc
+	switch hf := r.HandlerFunc.(type) {
+	case func(http.ResponseWriter, *http.Request, auth.User):
+		handler = func(w http.ResponseWriter, r *http.Request) {
+			hf(w, r, auth.AdminUser)
+		}
+	case func(http.ResponseWriter, *http.Request):
+		handler = hf
+	default:
+		return nil
+	}
+	return h.stateMux.Handle(r.Pattern, handler)
+}
+
+// stateDigest returns the digest of the resource at the path as returned by its GET handler,
+// or an empty string if it does not exist.
+func (h *Handler) stateDigest(path string) string {
+	r, err := http.NewRequest("GET", path, nil)
+	if err != nil {
+		return ""
+	}
+	handler, pattern := h.stateMux.Handler(r)
+	if pattern == "" {
+		return ""
+	}
+	w := &digestResponseWriter{
+		header: make(http.Header),
+		status: http.StatusOK,
+	}
+	handler.ServeHTTP(w, r)
+	if w.status != http.StatusOK {
+		return ""
+	}
+	return digest(w.body.Bytes())
+}
+
+// volatileFields are the fields of resources that change without the resource being changed,
+// i.e. the execution stats of a task, and so are left out of digests.
+var volatileFields = []string{
+	"stats",
+	"executing",
+	"error",
+	"dot",
+	"created",
+	"modified",
+	"last-enabled",
+	"dependent-tasks",
+}
+
+// digest returns the digest of the canonical form of a JSON resource,
+// so that the digest after a change matches the digest before the next change.
+// The canonical form leaves out the volatile fields and orders the fields by name.
+func digest(body []byte) string {
+	var resource map[string]interface{}
+	dec := json.NewDecoder(bytes.NewReader(body))
+	dec.UseNumber()
+	if err := dec.Decode(&resource); err == nil {
+		for _, f := range volatileFields {
+			delete(resource, f)
+		}
+		if canonical, err := json.Marshal(resource); err == nil {
+			body = canonical
+		}
+	}
+	sum := sha256.Sum256(body)
+	return hex.EncodeToString(sum[:])
+}
+
+// auditResponseWriter records the status and body of a response.
+type auditResponseWriter struct {
+	http.ResponseWriter
+	status int
+	body   bytes.Buffer
+}
+
+func (w *auditResponseWriter) WriteHeader(status int) {
+	w.status = status
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *auditResponseWriter) Write(b []byte) (int, error) {
+	w.body.Write(b)
+	return w.ResponseWriter.Write(b)
+}
+
+func (w *auditResponseWriter) Flush() {
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// digestResponseWriter records the status and body of a response without sending it.
+type digestResponseWriter struct {
+	header http.Header
+	status int
+	body   bytes.Buffer
+}
+
+func (w *digestResponseWriter) Header() http.Header {
+	return w.header
+}
+
+func (w *digestResponseWriter) WriteHeader(status int) {
+	w.status = status
+}
+
+func (w *digestResponseWriter) Write(b []byte) (int, error) {
+	return w.body.Write(b)
+}
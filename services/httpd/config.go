@@ -24,6 +24,7 @@ type Config struct {
 	HttpsCertificate string        `toml:"https-certificate"`
 	ShutdownTimeout  toml.Duration `toml:"shutdown-timeout"`
 	SharedSecret     string        `toml:"shared-secret"`
+	OIDC             OIDCConfig    `toml:"oidc"`
 
 	// Enable gzipped encoding
 	// NOTE: this is ignored in toml since it is only consumed by the tests
@@ -36,6 +37,7 @@ func NewConfig() Config {
 		LogEnabled:       true,
 		HttpsCertificate: "/etc/ssl/kapacitor.pem",
 		ShutdownTimeout:  DefaultShutdownTimeout,
+		OIDC:             NewOIDCConfig(),
 		GZIP:             true,
 	}
 }
@@ -53,6 +55,9 @@ func (c Config) Validate() error {
 	} else if pn > 65535 || pn < 0 {
 		return fmt.Errorf("invalid http bind address port %d: out of range", pn)
 	}
+	if err := c.OIDC.Validate(); err != nil {
+		return errors.Wrap(err, "oidc")
+	}
 
 	return nil
 }
@@ -1,6 +1,7 @@
 package httpd
 
 import (
+	"bytes"
 	"compress/gzip"
 	"encoding/json"
 	"errors"
@@ -18,8 +19,10 @@ import (
 	"github.com/influxdata/influxdb/influxql"
 	"github.com/influxdata/influxdb/models"
 	"github.com/influxdata/influxdb/uuid"
+	"github.com/influxdata/kapacitor/audit"
 	"github.com/influxdata/kapacitor/auth"
 	"github.com/influxdata/kapacitor/client/v1"
+	"github.com/influxdata/kapacitor/server/vars"
 )
 
 // statistics gathered by the httpd package.
@@ -40,6 +43,8 @@ const (
 	BasePreviewPath = "/kapacitor/v1preview"
 	// Name of the special user for subscriptions
 	SubscriptionUser = "~subscriber"
+	// Number of log lines buffered for each log stream
+	logsBufferSize = 1000
 )
 
 // AuthenticationMethod defines the type of authentication used.
@@ -61,15 +66,24 @@ type Route struct {
 	NoGzip      bool
 	NoJSON      bool
 	BypassAuth  bool
+	// NoAudit excludes a mutating route from the audit log.
+	NoAudit bool
+	// Local marks a mutating route that only changes this instance,
+	// so that it is served by high availability followers.
+	Local bool
 }
 
 // Handler represents an HTTP handler for the Kapacitor API server.
 type Handler struct {
 	methodMux map[string]*ServeMux
+	// GET routes of the API used to digest the state of resources for the audit log.
+	stateMux *ServeMux
 
 	requireAuthentication bool
 	exposePprof           bool
 	sharedSecret          string
+	// Validates bearer tokens signed by an OpenID Connect provider, nil if not enabled.
+	oidc *oidcAuthenticator
 
 	allowGzip bool
 
@@ -77,12 +91,24 @@ type Handler struct {
 
 	AuthService auth.Interface
 
+	AuditService audit.Recorder
+
 	PointsWriter interface {
 		WritePoints(database, retentionPolicy string, consistencyLevel models.ConsistencyLevel, points []models.Point) error
 	}
 
+	// RoleService reports the role of this instance in the ping response
+	// and the leader that serves the mutating requests followers reject.
+	RoleService interface {
+		Role() string
+		Leader() (url string, follower bool)
+	}
+
 	DiagService interface {
 		SetLogLevelFromName(lvl string) error
+		SetSubsystemLogLevel(subsystem, lvl string) error
+		SetTaskLogLevel(task, lvl string) error
+		SubscribeLogs(filter map[string]string, buffer int) (<-chan []byte, func())
 	}
 
 	diag Diagnostic
@@ -109,6 +135,7 @@ func NewHandler(
 ) *Handler {
 	h := &Handler{
 		methodMux:             make(map[string]*ServeMux),
+		stateMux:              NewServeMux(),
 		requireAuthentication: requireAuthentication,
 		exposePprof:           pprofEnabled,
 		sharedSecret:          sharedSecret,
@@ -165,6 +192,8 @@ func NewHandler(
 			Method:      "POST",
 			Pattern:     BasePath + "/write",
 			HandlerFunc: h.serveWrite,
+			NoAudit:     true,
+			Local:       true,
 		},
 		{
 			// Satisfy CORS checks.
@@ -177,6 +206,8 @@ func NewHandler(
 			Method:      "POST",
 			Pattern:     "/write",
 			HandlerFunc: h.serveWrite,
+			NoAudit:     true,
+			Local:       true,
 		},
 		{
 			// Satisfy CORS checks.
@@ -195,6 +226,15 @@ func NewHandler(
 			Method:      "POST",
 			Pattern:     BasePath + "/loglevel",
 			HandlerFunc: h.serveLogLevel,
+			Local:       true,
+		},
+		{
+			// Stream log lines
+			Method:      "GET",
+			Pattern:     BasePreviewPath + "/logs",
+			HandlerFunc: h.serveLogs,
+			NoGzip:      true,
+			NoJSON:      true,
 		},
 		{
 			Method:      "GET",
@@ -237,6 +277,13 @@ func NewHandler(
 			HandlerFunc: serveExpvar,
 			BypassAuth:  true,
 		},
+		{
+			Method:      "GET",
+			Pattern:     "/metrics",
+			HandlerFunc: servePrometheus,
+			NoJSON:      true,
+			BypassAuth:  true,
+		},
 	})
 
 	return h
@@ -293,7 +340,7 @@ func (h *Handler) addRawRoute(r Route) error {
 	var handler http.Handler
 	// If it's a handler func that requires special authorization, wrap it in authentication only.
 	if hf, ok := r.HandlerFunc.(func(http.ResponseWriter, *http.Request, auth.User)); ok {
-		handler = authenticate(authorizeForward(hf), h, h.requireAuthentication)
+		handler = authenticate(h.leaderOnly(r, h.audit(r, authorizeForward(hf))), h, h.requireAuthentication)
 	}
 
 	// This is a normal handler signature so perform standard authentication/authorization.
@@ -302,7 +349,7 @@ func (h *Handler) addRawRoute(r Route) error {
 		if r.BypassAuth && h.exposePprof {
 			requireAuth = false
 		}
-		handler = authenticate(authorize(hf), h, requireAuth)
+		handler = authenticate(h.leaderOnly(r, h.audit(r, authorize(hf))), h, requireAuth)
 	}
 	if handler == nil {
 		return errors.New("route does not have valid handler function")
@@ -328,7 +375,10 @@ func (h *Handler) addRawRoute(r Route) error {
 	if !ok {
 		return fmt.Errorf("unsupported method %q", r.Method)
 	}
-	return mux.Handle(r.Pattern, handler)
+	if err := mux.Handle(r.Pattern, handler); err != nil {
+		return err
+	}
+	return h.addStateRoute(r)
 }
 
 func (h *Handler) DelRoutes(routes []Route) {
@@ -349,6 +399,9 @@ func (h *Handler) delRawRoute(r Route) {
 	if ok {
 		mux.Deregister(r.Pattern)
 	}
+	if r.Method == "GET" {
+		h.stateMux.Deregister(r.Pattern)
+	}
 }
 
 // RewritePreview rewrites the URL path from BasePreviewPath to BasePath,
@@ -376,7 +429,7 @@ func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
-// serveLogLevel sets the log level of the server
+// serveLogLevel sets the log level of the server, a subsystem or a task
 func (h *Handler) serveLogLevel(w http.ResponseWriter, r *http.Request) {
 	var opt client.LogLevelOptions
 	dec := json.NewDecoder(r.Body)
@@ -385,7 +438,16 @@ func (h *Handler) serveLogLevel(w http.ResponseWriter, r *http.Request) {
 		HttpError(w, "invalid json: "+err.Error(), true, http.StatusBadRequest)
 		return
 	}
-	err = h.DiagService.SetLogLevelFromName(opt.Level)
+	switch {
+	case opt.Subsystem != "" && opt.Task != "":
+		err = errors.New("cannot set the level of both a subsystem and a task")
+	case opt.Subsystem != "":
+		err = h.DiagService.SetSubsystemLogLevel(opt.Subsystem, opt.Level)
+	case opt.Task != "":
+		err = h.DiagService.SetTaskLogLevel(opt.Task, opt.Level)
+	default:
+		err = h.DiagService.SetLogLevelFromName(opt.Level)
+	}
 	if err != nil {
 		HttpError(w, err.Error(), true, http.StatusBadRequest)
 		return
@@ -393,6 +455,48 @@ func (h *Handler) serveLogLevel(w http.ResponseWriter, r *http.Request) {
 	w.WriteHeader(http.StatusNoContent)
 }
 
+// serveLogs streams the log lines whose keys have the values of the query parameters,
+// as chunked JSON lines or as server-sent events if the client accepts them.
+func (h *Handler) serveLogs(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		HttpError(w, "streaming is not supported", true, http.StatusInternalServerError)
+		return
+	}
+	filter := make(map[string]string)
+	for k, values := range r.URL.Query() {
+		filter[k] = values[len(values)-1]
+	}
+	lines, cancel := h.DiagService.SubscribeLogs(filter, logsBufferSize)
+	defer cancel()
+
+	sse := strings.Contains(r.Header.Get("Accept"), "text/event-stream")
+	if sse {
+		w.Header().Set("Content-Type", "text/event-stream")
+	} else {
+		w.Header().Set("Content-Type", "application/json")
+	}
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case line := <-lines:
+			if sse {
+				w.Write([]byte("data: "))
+				w.Write(bytes.TrimSuffix(line, []byte("\n")))
+				w.Write([]byte("\n\n"))
+			} else {
+				w.Write(line)
+			}
+			flusher.Flush()
+		}
+	}
+}
+
 // serveRoutes returns a list of all routs and their methods
 func (h *Handler) serveRoutes(w http.ResponseWriter, r *http.Request) {
 	routes := make(map[string][]string)
@@ -424,11 +528,40 @@ func ServeOptions(w http.ResponseWriter, r *http.Request) {
 }
 
 // servePing returns a simple response to let the client know the server is running.
+// The role of the server is reported when high availability is enabled.
 func (h *Handler) servePing(w http.ResponseWriter, r *http.Request) {
 	h.statMap.Add(statPingRequest, 1)
+	if h.RoleService != nil {
+		if role := h.RoleService.Role(); role != "" {
+			w.Header().Set("X-Kapacitor-Role", role)
+		}
+	}
 	w.WriteHeader(http.StatusNoContent)
 }
 
+// leaderOnly wraps the handler of a mutating route so that high availability followers reject its requests,
+// since the next copy of the stores of the leader would overwrite their changes.
+// The rejection names the leader the request must be sent to.
+func (h *Handler) leaderOnly(route Route, inner AuthorizationHandler) AuthorizationHandler {
+	if route.Local || !isMutating(route.Method) {
+		return inner
+	}
+	return func(w http.ResponseWriter, r *http.Request, user auth.User) {
+		if h.RoleService != nil {
+			if leader, follower := h.RoleService.Leader(); follower {
+				if leader == "" {
+					HttpError(w, "this instance is a follower and the leader is unknown", true, http.StatusServiceUnavailable)
+					return
+				}
+				w.Header().Set("X-Kapacitor-Leader", leader)
+				HttpError(w, fmt.Sprintf("this instance is a follower, send the request to the leader at %s", leader), true, http.StatusServiceUnavailable)
+				return
+			}
+		}
+		inner(w, r, user)
+	}
+}
+
 func (h *Handler) serveWrite(w http.ResponseWriter, r *http.Request, user auth.User) {
 	h.statMap.Add(statWriteRequest, 1)
 
@@ -553,6 +686,14 @@ func serveExpvar(w http.ResponseWriter, r *http.Request) {
 	fmt.Fprintf(w, "\n}\n")
 }
 
+// servePrometheus serves all stats in the Prometheus text exposition format.
+func servePrometheus(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	if err := vars.WritePrometheus(w); err != nil {
+		HttpError(w, err.Error(), true, http.StatusInternalServerError)
+	}
+}
+
 // HttpError writes an error to the client in a standard format.
 func HttpError(w http.ResponseWriter, err string, pretty bool, code int) {
 	w.WriteHeader(code)
@@ -613,6 +754,9 @@ func authenticate(inner AuthorizationHandler, h *Handler, requireAuthentication
 			}
 		case BearerAuthentication:
 			keyLookupFn := func(token *jwt.Token) (interface{}, error) {
+				if h.oidc != nil && h.oidc.supports(token.Method) {
+					return h.oidc.key(token)
+				}
 				// Check for expected signing method.
 				if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
 					return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
@@ -643,6 +787,14 @@ func authenticate(inner AuthorizationHandler, h *Handler, requireAuthentication
 				return
 			}
 
+			if h.oidc != nil && h.oidc.supports(token.Method) {
+				if user, err = h.oidc.User(claims); err != nil {
+					HttpError(w, err.Error(), false, http.StatusUnauthorized)
+					return
+				}
+				break
+			}
+
 			// Get the username from the token.
 			username, ok := claims["username"].(string)
 			if !ok {
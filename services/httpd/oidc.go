@@ -0,0 +1,399 @@
+package httpd
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	jwt "github.com/dgrijalva/jwt-go"
+	"github.com/influxdata/influxdb/toml"
+	"github.com/influxdata/kapacitor/auth"
+	"github.com/pkg/errors"
+)
+
+const (
+	DefaultOIDCUsernameClaim       = "sub"
+	DefaultOIDCJWKSRefreshInterval = toml.Duration(time.Hour)
+
+	// Minimum time between reloads of the JWKS caused by tokens signed with an unknown key.
+	jwksMinReloadInterval = 10 * time.Second
+)
+
+// OIDCConfig configures validation of bearer tokens signed by an OpenID Connect or OAuth2 provider.
+type OIDCConfig struct {
+	Enabled bool `toml:"enabled"`
+	// Path to a file containing the JSON Web Key Set of the provider.
+	JWKSFile string `toml:"jwks-file"`
+	// URL of the JSON Web Key Set of the provider.
+	JWKSURL string `toml:"jwks-url"`
+	// How often the key set is reloaded.
+	JWKSRefreshInterval toml.Duration `toml:"jwks-refresh-interval"`
+	// Required iss claim of tokens, not checked if empty.
+	Issuer string `toml:"issuer"`
+	// Required aud claim of tokens, not checked if empty.
+	Audience string `toml:"audience"`
+	// Claim that contains the username.
+	UsernameClaim string `toml:"username-claim"`
+	// Mappings from claims to privileges.
+	ClaimMappings []ClaimMapping `toml:"claim-mapping"`
+}
+
+// ClaimMapping grants privileges to users whose token has a claim with the value.
+// If the claim is a list, i.e. groups, any element may match the value.
+type ClaimMapping struct {
+	// Name of the claim, nested claims are separated by '.'.
+	Claim string `toml:"claim"`
+	Value string `toml:"value"`
+	// Make the user an admin with all privileges.
+	Admin bool `toml:"admin"`
+	// API path relative to /kapacitor/v1 the privileges apply to.
+	API string `toml:"api"`
+	// Database the privileges apply to.
+	Database   string   `toml:"database"`
+	Privileges []string `toml:"privileges"`
+}
+
+func NewOIDCConfig() OIDCConfig {
+	return OIDCConfig{
+		JWKSRefreshInterval: DefaultOIDCJWKSRefreshInterval,
+		UsernameClaim:       DefaultOIDCUsernameClaim,
+	}
+}
+
+func (c OIDCConfig) Validate() error {
+	if !c.Enabled {
+		return nil
+	}
+	if (c.JWKSFile == "") == (c.JWKSURL == "") {
+		return errors.New("must set exactly one of jwks-file or jwks-url")
+	}
+	if c.UsernameClaim == "" {
+		return errors.New("must set username-claim")
+	}
+	for _, m := range c.ClaimMappings {
+		if m.Claim == "" {
+			return errors.New("claim-mapping must set claim")
+		}
+		if m.Admin {
+			continue
+		}
+		if (m.API == "") == (m.Database == "") {
+			return fmt.Errorf("claim-mapping for %s=%s must set exactly one of api or database", m.Claim, m.Value)
+		}
+		if len(m.Privileges) == 0 {
+			return fmt.Errorf("claim-mapping for %s=%s must set privileges", m.Claim, m.Value)
+		}
+		for _, p := range m.Privileges {
+			if _, err := auth.ParsePrivilege(p); err != nil {
+				return errors.Wrapf(err, "claim-mapping for %s=%s", m.Claim, m.Value)
+			}
+		}
+	}
+	return nil
+}
+
+// oidcAuthenticator validates RSA and ECDSA signed tokens against a JSON Web Key Set
+// and maps their claims to a user.
+type oidcAuthenticator struct {
+	c OIDCConfig
+
+	mu     sync.Mutex
+	keys   map[string]interface{}
+	loaded time.Time
+	// Time of the last reload, reloads are limited to one per jwksMinReloadInterval.
+	attempted time.Time
+	// Closed once the reload in progress completes, nil if no reload is in progress.
+	reloading chan struct{}
+}
+
+func newOIDCAuthenticator(c OIDCConfig) *oidcAuthenticator {
+	return &oidcAuthenticator{c: c}
+}
+
+// supports reports whether the token is signed with a method validated by the key set.
+func (a *oidcAuthenticator) supports(m jwt.SigningMethod) bool {
+	switch m.(type) {
+	case *jwt.SigningMethodRSA, *jwt.SigningMethodECDSA:
+		return true
+	}
+	return false
+}
+
+// load reads the key set and replaces the current keys.
+func (a *oidcAuthenticator) load() error {
+	keys, err := a.fetch()
+	if err != nil {
+		return err
+	}
+	a.mu.Lock()
+	a.keys = keys
+	a.loaded = time.Now()
+	a.mu.Unlock()
+	return nil
+}
+
+// fetch reads the key set from the configured file or URL.
+func (a *oidcAuthenticator) fetch() (map[string]interface{}, error) {
+	var data []byte
+	if a.c.JWKSFile != "" {
+		var err error
+		data, err = ioutil.ReadFile(a.c.JWKSFile)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to read jwks file")
+		}
+	} else {
+		client := http.Client{Timeout: 10 * time.Second}
+		resp, err := client.Get(a.c.JWKSURL)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to get jwks")
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			return nil, fmt.Errorf("failed to get jwks: unexpected status %s", resp.Status)
+		}
+		data, err = ioutil.ReadAll(resp.Body)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to read jwks")
+		}
+	}
+	return parseJWKS(data)
+}
+
+// key returns the public key the token was signed with.
+// The key set is reloaded when it is older than the refresh interval or does not contain the key.
+// The key set is fetched without holding the lock so that requests signed with known keys are not blocked.
+func (a *oidcAuthenticator) key(token *jwt.Token) (interface{}, error) {
+	kid, _ := token.Header["kid"].(string)
+
+	a.mu.Lock()
+	key, ok := a.lookup(kid)
+	now := time.Now()
+	stale := now.Sub(a.loaded) > time.Duration(a.c.JWKSRefreshInterval)
+	reloading := a.reloading
+	switch {
+	case reloading == nil && (!ok || stale) && now.Sub(a.attempted) > jwksMinReloadInterval:
+		a.attempted = now
+		reloading = make(chan struct{})
+		a.reloading = reloading
+		a.mu.Unlock()
+
+		err := a.load()
+
+		a.mu.Lock()
+		a.reloading = nil
+		close(reloading)
+		if err != nil && !ok {
+			a.mu.Unlock()
+			return nil, err
+		}
+		key, ok = a.lookup(kid)
+	case reloading != nil && !ok:
+		// Wait for the reload in progress, it may add the key.
+		a.mu.Unlock()
+		<-reloading
+		a.mu.Lock()
+		key, ok = a.lookup(kid)
+	}
+	a.mu.Unlock()
+	if !ok {
+		return nil, fmt.Errorf("unknown signing key %q", kid)
+	}
+	return key, nil
+}
+
+func (a *oidcAuthenticator) lookup(kid string) (interface{}, bool) {
+	if kid == "" && len(a.keys) == 1 {
+		for _, k := range a.keys {
+			return k, true
+		}
+	}
+	k, ok := a.keys[kid]
+	return k, ok
+}
+
+// User validates the issuer and audience of the claims and returns the user they map to.
+func (a *oidcAuthenticator) User(claims jwt.MapClaims) (auth.User, error) {
+	if a.c.Issuer != "" && !claims.VerifyIssuer(a.c.Issuer, true) {
+		return auth.User{}, errors.New("invalid token issuer")
+	}
+	if a.c.Audience != "" && !verifyAudience(claims["aud"], a.c.Audience) {
+		return auth.User{}, errors.New("invalid token audience")
+	}
+	username, ok := claimValue(claims, a.c.UsernameClaim).(string)
+	if !ok || username == "" {
+		return auth.User{}, fmt.Errorf("token must contain a %s claim", a.c.UsernameClaim)
+	}
+	admin := false
+	privileges := make(map[string][]auth.Privilege)
+	for _, m := range a.c.ClaimMappings {
+		if !claimMatches(claimValue(claims, m.Claim), m.Value) {
+			continue
+		}
+		if m.Admin {
+			admin = true
+			continue
+		}
+		resource := auth.APIResource(m.API)
+		if m.Database != "" {
+			resource = auth.DatabaseResource(m.Database)
+		}
+		for _, p := range m.Privileges {
+			// Privileges are validated with the config.
+			privilege, _ := auth.ParsePrivilege(p)
+			privileges[resource] = append(privileges[resource], privilege)
+		}
+	}
+	return auth.NewUser(username, nil, admin, privileges), nil
+}
+
+// verifyAudience reports whether the aud claim, either a string or a list of strings, contains the audience.
+func verifyAudience(aud interface{}, audience string) bool {
+	switch aud := aud.(type) {
+	case string:
+		return aud == audience
+	case []interface{}:
+		for _, a := range aud {
+			if s, ok := a.(string); ok && s == audience {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// claimValue returns the value of the claim, where nested claims are separated by '.'.
+func claimValue(claims map[string]interface{}, name string) interface{} {
+	parts := strings.Split(name, ".")
+	var v interface{} = claims
+	for _, p := range parts {
+		m, ok := v.(map[string]interface{})
+		if !ok {
+			return nil
+		}
+		v = m[p]
+	}
+	return v
+}
+
+func claimMatches(v interface{}, value string) bool {
+	switch v := v.(type) {
+	case nil:
+		return false
+	case []interface{}:
+		for _, e := range v {
+			if claimMatches(e, value) {
+				return true
+			}
+		}
+		return false
+	case string:
+		return v == value
+	default:
+		return fmt.Sprint(v) == value
+	}
+}
+
+type jsonWebKey struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	// RSA
+	N string `json:"n"`
+	E string `json:"e"`
+	// ECDSA
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+// parseJWKS parses the RSA and ECDSA signing keys of a JSON Web Key Set by their key ID.
+func parseJWKS(data []byte) (map[string]interface{}, error) {
+	var set struct {
+		Keys []jsonWebKey `json:"keys"`
+	}
+	if err := json.Unmarshal(data, &set); err != nil {
+		return nil, errors.Wrap(err, "invalid jwks")
+	}
+	keys := make(map[string]interface{}, len(set.Keys))
+	for _, k := range set.Keys {
+		if k.Use != "" && k.Use != "sig" {
+			continue
+		}
+		var (
+			key interface{}
+			err error
+		)
+		switch k.Kty {
+		case "RSA":
+			key, err = k.rsaKey()
+		case "EC":
+			key, err = k.ecdsaKey()
+		default:
+			continue
+		}
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid jwks key %q", k.Kid)
+		}
+		keys[k.Kid] = key
+	}
+	return keys, nil
+}
+
+func (k jsonWebKey) rsaKey() (*rsa.PublicKey, error) {
+	n, err := base64.RawURLEncoding.DecodeString(k.N)
+	if err != nil {
+		return nil, errors.Wrap(err, "invalid modulus")
+	}
+	e, err := base64.RawURLEncoding.DecodeString(k.E)
+	if err != nil {
+		return nil, errors.Wrap(err, "invalid exponent")
+	}
+	exponent := new(big.Int).SetBytes(e)
+	if !exponent.IsInt64() || exponent.Int64() > 1<<31-1 {
+		return nil, errors.New("exponent too large")
+	}
+	return &rsa.PublicKey{
+		N: new(big.Int).SetBytes(n),
+		E: int(exponent.Int64()),
+	}, nil
+}
+
+func (k jsonWebKey) ecdsaKey() (*ecdsa.PublicKey, error) {
+	var curve elliptic.Curve
+	switch k.Crv {
+	case "P-256":
+		curve = elliptic.P256()
+	case "P-384":
+		curve = elliptic.P384()
+	case "P-521":
+		curve = elliptic.P521()
+	default:
+		return nil, fmt.Errorf("unsupported curve %q", k.Crv)
+	}
+	x, err := base64.RawURLEncoding.DecodeString(k.X)
+	if err != nil {
+		return nil, errors.Wrap(err, "invalid x coordinate")
+	}
+	y, err := base64.RawURLEncoding.DecodeString(k.Y)
+	if err != nil {
+		return nil, errors.Wrap(err, "invalid y coordinate")
+	}
+	key := &ecdsa.PublicKey{
+		Curve: curve,
+		X:     new(big.Int).SetBytes(x),
+		Y:     new(big.Int).SetBytes(y),
+	}
+	if !curve.IsOnCurve(key.X, key.Y) {
+		return nil, errors.New("point is not on the curve")
+	}
+	return key, nil
+}
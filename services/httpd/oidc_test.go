@@ -0,0 +1,193 @@
+package httpd
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	jwt "github.com/dgrijalva/jwt-go"
+	"github.com/influxdata/kapacitor/auth"
+)
+
+func Test_ParseJWKS(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 1024)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	enc := base64.RawURLEncoding.EncodeToString
+	jwks := fmt.Sprintf(`{"keys":[
+{"kty":"RSA","kid":"rsa","use":"sig","n":%q,"e":%q},
+{"kty":"EC","kid":"ec","crv":"P-256","x":%q,"y":%q},
+{"kty":"RSA","kid":"enc","use":"enc","n":%q,"e":%q},
+{"kty":"oct","kid":"secret","k":"c2VjcmV0"}
+]}`,
+		enc(rsaKey.N.Bytes()), enc(big.NewInt(int64(rsaKey.E)).Bytes()),
+		enc(ecKey.X.Bytes()), enc(ecKey.Y.Bytes()),
+		enc(rsaKey.N.Bytes()), enc(big.NewInt(int64(rsaKey.E)).Bytes()),
+	)
+	keys, err := parseJWKS([]byte(jwks))
+	if err != nil {
+		t.Fatal(err)
+	}
+	exp := map[string]interface{}{
+		"rsa": &rsaKey.PublicKey,
+		"ec":  &ecKey.PublicKey,
+	}
+	if !reflect.DeepEqual(keys, exp) {
+		t.Errorf("unexpected keys:\ngot\n%v\nexp\n%v", keys, exp)
+	}
+
+	if _, err := parseJWKS([]byte(`{"keys":[{"kty":"EC","kid":"bad","crv":"P-256","x":"AQ","y":"AQ"}]}`)); err == nil {
+		t.Error("expected error parsing key not on the curve")
+	}
+}
+
+func Test_OIDCAuthenticator_User(t *testing.T) {
+	a := newOIDCAuthenticator(OIDCConfig{
+		Issuer:        "https://sso.example.com",
+		Audience:      "kapacitor",
+		UsernameClaim: "email",
+		ClaimMappings: []ClaimMapping{
+			{Claim: "groups", Value: "ops", API: "/tasks", Privileges: []string{"read", "write"}},
+			{Claim: "groups", Value: "writers", Database: "mydb", Privileges: []string{"write"}},
+			{Claim: "realm.role", Value: "admin", Admin: true},
+		},
+	})
+	testCases := []struct {
+		claims jwt.MapClaims
+		user   auth.User
+		err    bool
+	}{
+		{
+			claims: jwt.MapClaims{
+				"iss":    "https://sso.example.com",
+				"aud":    []interface{}{"other", "kapacitor"},
+				"email":  "bob@example.com",
+				"groups": []interface{}{"ops", "writers"},
+			},
+			user: auth.NewUser("bob@example.com", nil, false, map[string][]auth.Privilege{
+				"/api/tasks":           {auth.ReadPrivilege, auth.WritePrivilege},
+				"/database/mydb_clean": {auth.WritePrivilege},
+			}),
+		},
+		{
+			claims: jwt.MapClaims{
+				"iss":   "https://sso.example.com",
+				"aud":   "kapacitor",
+				"email": "alice@example.com",
+				"realm": map[string]interface{}{"role": "admin"},
+			},
+			user: auth.NewUser("alice@example.com", nil, true, map[string][]auth.Privilege{}),
+		},
+		{
+			claims: jwt.MapClaims{
+				"iss":   "https://other.example.com",
+				"aud":   "kapacitor",
+				"email": "bob@example.com",
+			},
+			err: true,
+		},
+		{
+			claims: jwt.MapClaims{
+				"iss":   "https://sso.example.com",
+				"aud":   "other",
+				"email": "bob@example.com",
+			},
+			err: true,
+		},
+		{
+			claims: jwt.MapClaims{
+				"iss": "https://sso.example.com",
+				"aud": "kapacitor",
+				"sub": "bob",
+			},
+			err: true,
+		},
+	}
+	for i, tc := range testCases {
+		user, err := a.User(tc.claims)
+		if tc.err {
+			if err == nil {
+				t.Errorf("%d: expected error", i)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%d: unexpected error: %v", i, err)
+			continue
+		}
+		if !reflect.DeepEqual(user, tc.user) {
+			t.Errorf("%d: unexpected user:\ngot\n%v\nexp\n%v", i, user, tc.user)
+		}
+	}
+}
+
+func Test_OIDCAuthenticator_KeyReload(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 1024)
+	if err != nil {
+		t.Fatal(err)
+	}
+	enc := base64.RawURLEncoding.EncodeToString
+	jwks := fmt.Sprintf(`{"keys":[{"kty":"RSA","kid":"rsa","n":%q,"e":%q}]}`,
+		enc(rsaKey.N.Bytes()), enc(big.NewInt(int64(rsaKey.E)).Bytes()))
+	var fetches int32
+	release := make(chan struct{})
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&fetches, 1) > 1 {
+			<-release
+		}
+		w.Write([]byte(jwks))
+	}))
+	defer ts.Close()
+
+	a := newOIDCAuthenticator(OIDCConfig{
+		JWKSURL:             ts.URL,
+		JWKSRefreshInterval: DefaultOIDCJWKSRefreshInterval,
+	})
+	if err := a.load(); err != nil {
+		t.Fatal(err)
+	}
+
+	// Unknown keys trigger a single reload, known keys are not blocked by it.
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := a.key(&jwt.Token{Header: map[string]interface{}{"kid": "unknown"}}); err == nil {
+				t.Error("expected error for unknown key")
+			}
+		}()
+	}
+	for atomic.LoadInt32(&fetches) < 2 {
+		time.Sleep(time.Millisecond)
+	}
+	if _, err := a.key(&jwt.Token{Header: map[string]interface{}{"kid": "rsa"}}); err != nil {
+		t.Fatal(err)
+	}
+	close(release)
+	wg.Wait()
+
+	// Reloads are rate limited.
+	if _, err := a.key(&jwt.Token{Header: map[string]interface{}{"kid": "unknown"}}); err == nil {
+		t.Error("expected error for unknown key")
+	}
+	if got := atomic.LoadInt32(&fetches); got != 2 {
+		t.Errorf("unexpected number of jwks fetches: got %d exp 2", got)
+	}
+}
@@ -11,6 +11,8 @@ import (
 	"strings"
 	"sync"
 	"time"
+
+	"github.com/pkg/errors"
 )
 
 type Diagnostic interface {
@@ -114,6 +116,9 @@ func NewService(c Config, hostname string, d Diagnostic) *Service {
 		diag: d,
 		httpServerErrorLogger: d.NewHTTPServerErrorLogger(),
 	}
+	if c.OIDC.Enabled {
+		s.Handler.oidc = newOIDCAuthenticator(c.OIDC)
+	}
 	return s
 }
 
@@ -123,6 +128,11 @@ func (s *Service) Open() error {
 	defer s.mu.Unlock()
 	s.diag.StartingService()
 	s.diag.AuthenticationEnabled(s.Handler.requireAuthentication)
+	if s.Handler.oidc != nil {
+		if err := s.Handler.oidc.load(); err != nil {
+			return errors.Wrap(err, "oidc")
+		}
+	}
 
 	// Open listener.
 	if s.https {
@@ -6,6 +6,7 @@ import (
 	"fmt"
 	"io"
 	"net/http"
+	"strings"
 	"sync"
 	"text/template"
 
@@ -79,15 +80,24 @@ func (e *Endpoint) RowTemplate() *template.Template {
 }
 
 func (e *Endpoint) NewHTTPRequest(body io.Reader) (req *http.Request, err error) {
+	return e.NewRequest("POST", "", body)
+}
+
+// NewRequest creates a request with the method to the path relative to the URL of the endpoint.
+func (e *Endpoint) NewRequest(method, path string, body io.Reader) (req *http.Request, err error) {
 	e.mu.RLock()
 	defer e.mu.RUnlock()
 	if e.closed {
 		return nil, errors.New("endpoint was closed")
 	}
 
-	req, err = http.NewRequest("POST", e.url, body)
+	u := e.url
+	if path != "" {
+		u = strings.TrimSuffix(u, "/") + path
+	}
+	req, err = http.NewRequest(method, u, body)
 	if err != nil {
-		return nil, fmt.Errorf("failed to create POST request: %v", err)
+		return nil, fmt.Errorf("failed to create %s request: %v", method, err)
 	}
 
 	if e.auth.valid() {
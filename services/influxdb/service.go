@@ -139,6 +139,7 @@ func (s *Service) Open() error {
 			Method:      "POST",
 			Pattern:     subscriptionsPath,
 			HandlerFunc: s.handleSubscriptions,
+			Local:       true,
 		},
 	}
 
@@ -42,6 +42,7 @@ type RecordingDAO interface {
 
 	// Rebuild fixes all indexes of the data.
 	Rebuild() error
+	Check() (storage.CheckResult, error)
 }
 
 //--------------------------------------------------------------------
@@ -131,6 +132,10 @@ func (kv *recordingKV) Rebuild() error {
 	return kv.store.Rebuild()
 }
 
+func (kv *recordingKV) Check() (storage.CheckResult, error) {
+	return kv.store.Check()
+}
+
 func (kv *recordingKV) error(err error) error {
 	if err == storage.ErrNoObjectExists {
 		return ErrNoRecordingExists
@@ -205,6 +210,7 @@ type ReplayDAO interface {
 
 	// Rebuild rebuilds all indexes for the storage
 	Rebuild() error
+	Check() (storage.CheckResult, error)
 }
 
 type Clock int
@@ -325,3 +331,7 @@ func (kv *replayKV) List(pattern string, offset, limit int) ([]Replay, error) {
 func (kv *replayKV) Rebuild() error {
 	return kv.store.Rebuild()
 }
+
+func (kv *replayKV) Check() (storage.CheckResult, error) {
+	return kv.store.Check()
+}
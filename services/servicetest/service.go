@@ -63,6 +63,7 @@ func (s *Service) Open() error {
 			Method:      "POST",
 			Pattern:     testPathAnchored,
 			HandlerFunc: s.handleTest,
+			Local:       true,
 		},
 	}
 
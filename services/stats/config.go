@@ -1,6 +1,7 @@
 package stats
 
 import (
+	"fmt"
 	"time"
 
 	"github.com/influxdata/influxdb/toml"
@@ -21,6 +22,9 @@ type Config struct {
 	RetentionPolicy         string        `toml:"retention-policy"`
 	TimingSampleRate        float64       `toml:"timing-sample-rate"`
 	TimingMovingAverageSize int           `toml:"timing-movavg-size"`
+	// The fraction of the points and batches that are traced through the nodes of the tasks.
+	// If 0 nothing is traced.
+	TracingSampleRate float64 `toml:"tracing-sample-rate"`
 }
 
 func NewConfig() Config {
@@ -33,3 +37,10 @@ func NewConfig() Config {
 		TimingMovingAverageSize: DefaultTimingMovingAverageSize,
 	}
 }
+
+func (c Config) Validate() error {
+	if c.TracingSampleRate < 0 || c.TracingSampleRate > 1 {
+		return fmt.Errorf("tracing-sample-rate must be between 0 and 1, got %v", c.TracingSampleRate)
+	}
+	return nil
+}
@@ -3,12 +3,17 @@ package storage
 import (
 	"encoding/json"
 	"fmt"
+	"io"
+	"io/ioutil"
 	"net/http"
+	"os"
 	"path"
+	"sort"
 	"strconv"
 	"strings"
 
 	"github.com/boltdb/bolt"
+	"github.com/influxdata/kapacitor/auth"
 	client "github.com/influxdata/kapacitor/client/v1"
 	"github.com/influxdata/kapacitor/services/httpd"
 )
@@ -17,6 +22,9 @@ const (
 	storagePath            = "/storage"
 	storagePathAnchored    = storagePath + "/"
 	backupPath             = storagePath + "/backup"
+	migratePath            = storagePath + "/migrate"
+	restorePath            = storagePath + "/restore"
+	checkPath              = storagePath + "/check"
 	storesPath             = storagePath + "/stores"
 	storesPathAnchored     = storesPath + "/"
 	storesBasePath         = httpd.BasePath + storesPath
@@ -25,9 +33,17 @@ const (
 
 type APIServer struct {
 	Registrar StoreActionerRegistrar
-	DB        *bolt.DB
-	routes    []httpd.Route
-	diag      Diagnostic
+	Backend   Backend
+	// MigrateTargets are the storage URLs handleMigrate may copy the stores to.
+	MigrateTargets []string
+	// MaxRestoreSize is the maximum size in bytes of an uploaded backup.
+	MaxRestoreSize int64
+	// Replicated is set when the stores are replicated by the cluster or HA services.
+	Replicated bool
+	// restored is called before a backup is restored.
+	restored func()
+	routes   []httpd.Route
+	diag     Diagnostic
 
 	HTTPDService interface {
 		AddRoutes([]httpd.Route) error
@@ -50,6 +66,22 @@ func (s *APIServer) Open() error {
 			Pattern:     storesPath,
 			HandlerFunc: s.handleListStores,
 		},
+		{
+			Method:      "POST",
+			Pattern:     migratePath,
+			HandlerFunc: s.handleMigrate,
+			Local:       true,
+		},
+		{
+			Method:      "POST",
+			Pattern:     restorePath,
+			HandlerFunc: s.handleRestore,
+		},
+		{
+			Method:      "GET",
+			Pattern:     checkPath,
+			HandlerFunc: s.handleCheck,
+		},
 		{
 			Method:      "POST",
 			Pattern:     storagePathAnchored,
@@ -69,7 +101,12 @@ func (s *APIServer) Close() error {
 }
 
 func (s *APIServer) handleBackup(w http.ResponseWriter, r *http.Request) {
-	err := s.DB.View(func(tx *bolt.Tx) error {
+	b, ok := s.Backend.(*BoltBackend)
+	if !ok {
+		httpd.HttpError(w, "backups are only supported by the bolt storage backend", true, http.StatusNotImplemented)
+		return
+	}
+	err := b.DB.View(func(tx *bolt.Tx) error {
 		w.Header().Set("Content-Type", "application/octet-stream")
 		w.Header().Set("Content-Disposition", `attachment; filename="kapacitor.db"`)
 		w.Header().Set("Content-Length", strconv.Itoa(int(tx.Size())))
@@ -86,6 +123,165 @@ func (s *APIServer) handleBackup(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+// handleMigrate copies all stores to another backend.
+func (s *APIServer) handleMigrate(w http.ResponseWriter, r *http.Request, user auth.User) {
+	// The stores hold the credentials of the alert handlers and users,
+	// they are only copied by admins to the configured backends.
+	if !user.IsAdmin() {
+		httpd.HttpError(w, "only admin users can migrate storage", true, http.StatusForbidden)
+		return
+	}
+	opts := client.StorageMigrateOptions{}
+	if err := json.NewDecoder(r.Body).Decode(&opts); err != nil {
+		httpd.HttpError(w, fmt.Sprintf("failed to unmarshal storage migration %v", err), true, http.StatusBadRequest)
+		return
+	}
+	if !s.migrateTarget(opts.To) {
+		httpd.HttpError(w, fmt.Sprintf("storage URL %q is not one of the storage migrate-targets", opts.To), true, http.StatusForbidden)
+		return
+	}
+	c, err := ParseBackendURL(opts.To)
+	if err != nil {
+		httpd.HttpError(w, fmt.Sprintf("invalid storage URL: %v", err), true, http.StatusBadRequest)
+		return
+	}
+	to, err := OpenBackend(c)
+	if err != nil {
+		httpd.HttpError(w, fmt.Sprintf("failed to open storage %q: %v", opts.To, err), true, http.StatusBadRequest)
+		return
+	}
+	defer to.Close()
+	copied, err := Copy(s.Backend, to)
+	if err != nil {
+		httpd.HttpError(w, fmt.Sprintf("failed to migrate storage: %v", err), true, http.StatusInternalServerError)
+		return
+	}
+	migration := client.StorageMigration{
+		Stores: make([]client.MigratedStore, 0, len(copied)),
+	}
+	for _, ns := range sortedNamespaces(copied) {
+		migration.Stores = append(migration.Stores, client.MigratedStore{
+			Namespace: ns,
+			Keys:      copied[ns],
+		})
+	}
+	w.WriteHeader(http.StatusOK)
+	w.Write(httpd.MarshalJSON(migration, true))
+}
+
+// sortedNamespaces returns the namespaces of the key counts sorted by name.
+func sortedNamespaces(keys map[string]int) []string {
+	namespaces := make([]string, 0, len(keys))
+	for ns := range keys {
+		namespaces = append(namespaces, ns)
+	}
+	sort.Strings(namespaces)
+	return namespaces
+}
+
+func (s *APIServer) migrateTarget(to string) bool {
+	for _, target := range s.MigrateTargets {
+		if to == target {
+			return true
+		}
+	}
+	return false
+}
+
+// handleRestore replaces all stores with the stores of the uploaded backup.
+// The stores are read only once restored, until Kapacitor is restarted to load them.
+func (s *APIServer) handleRestore(w http.ResponseWriter, r *http.Request, user auth.User) {
+	// The backup replaces the users too, so it could add any admin.
+	if !user.IsAdmin() {
+		httpd.HttpError(w, "only admin users can restore storage", true, http.StatusForbidden)
+		return
+	}
+	if s.Replicated {
+		httpd.HttpError(w, "cannot restore a backup while the cluster or ha service is enabled, disable it and restart Kapacitor first", true, http.StatusConflict)
+		return
+	}
+	f, err := ioutil.TempFile("", "kapacitor-restore")
+	if err != nil {
+		httpd.HttpError(w, fmt.Sprintf("failed to create backup file: %v", err), true, http.StatusInternalServerError)
+		return
+	}
+	defer os.Remove(f.Name())
+	// Read one more byte than the limit to detect larger backups.
+	n, err := io.Copy(f, io.LimitReader(r.Body, s.MaxRestoreSize+1))
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		httpd.HttpError(w, fmt.Sprintf("failed to read backup: %v", err), true, http.StatusBadRequest)
+		return
+	}
+	if n > s.MaxRestoreSize {
+		httpd.HttpError(w, fmt.Sprintf("backup is larger than the storage max-restore-size of %d bytes", s.MaxRestoreSize), true, http.StatusRequestEntityTooLarge)
+		return
+	}
+	backup, err := OpenBackup(f.Name())
+	if err != nil {
+		httpd.HttpError(w, err.Error(), true, http.StatusBadRequest)
+		return
+	}
+	defer backup.Close()
+	if err := CheckVersions(backup, s.Backend); err != nil {
+		httpd.HttpError(w, fmt.Sprintf("cannot restore backup: %v", err), true, http.StatusBadRequest)
+		return
+	}
+	// The running services must not write the data they hold over the restored data.
+	if s.restored != nil {
+		s.restored()
+	}
+	restored, err := Restore(backup, s.Backend)
+	if err != nil {
+		httpd.HttpError(w, fmt.Sprintf("failed to restore backup: %v", err), true, http.StatusInternalServerError)
+		return
+	}
+	restore := client.StorageRestore{
+		Stores: make([]client.RestoredStore, 0, len(restored)),
+	}
+	for _, ns := range sortedNamespaces(restored) {
+		restore.Stores = append(restore.Stores, client.RestoredStore{
+			Namespace: ns,
+			Keys:      restored[ns],
+		})
+	}
+	w.WriteHeader(http.StatusOK)
+	w.Write(httpd.MarshalJSON(restore, true))
+}
+
+// handleCheck decodes the objects of all registered stores.
+func (s *APIServer) handleCheck(w http.ResponseWriter, r *http.Request) {
+	names := s.Registrar.List()
+	sort.Strings(names)
+	check := client.StorageCheck{
+		Stores: make([]client.CheckedStore, len(names)),
+	}
+	for i, name := range names {
+		store, _ := s.Registrar.Get(name)
+		result, err := store.Check()
+		if err != nil {
+			httpd.HttpError(w, fmt.Sprintf("failed to check %q: %v", name, err), true, http.StatusInternalServerError)
+			return
+		}
+		checked := client.CheckedStore{
+			Name:    name,
+			Objects: result.Objects,
+			Corrupt: make([]client.CorruptObject, len(result.Corrupt)),
+		}
+		for j, c := range result.Corrupt {
+			checked.Corrupt[j] = client.CorruptObject{
+				Key:   c.Key,
+				Error: c.Err.Error(),
+			}
+		}
+		check.Stores[i] = checked
+	}
+	w.WriteHeader(http.StatusOK)
+	w.Write(httpd.MarshalJSON(check, true))
+}
+
 func (s *APIServer) handleListStores(w http.ResponseWriter, r *http.Request) {
 	storages := s.Registrar.List()
 	list := client.StorageList{
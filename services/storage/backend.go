@@ -0,0 +1,170 @@
+package storage
+
+import (
+	"fmt"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/boltdb/bolt"
+	"github.com/pkg/errors"
+)
+
+// Backend holds the namespaced stores of the storage service.
+type Backend interface {
+	// Store returns the store of the namespace.
+	Store(namespace string) Interface
+	// Namespaces returns the namespaces holding at least one key.
+	Namespaces() ([]string, error)
+	Close() error
+}
+
+// OpenBackend opens the backend of the configuration.
+func OpenBackend(c Config) (Backend, error) {
+	switch c.Backend {
+	case BackendBolt, "":
+		db, err := bolt.Open(c.BoltDBPath, 0600, &bolt.Options{Timeout: time.Second})
+		if err != nil {
+			return nil, errors.Wrapf(err, "open boltdb @ %q", c.BoltDBPath)
+		}
+		return NewBoltBackend(db), nil
+	case BackendSQL:
+		return NewSQLBackend(c.SQL)
+	case BackendConsul:
+		return NewConsulBackend(c.Consul)
+	default:
+		return nil, fmt.Errorf("unknown storage backend %q", c.Backend)
+	}
+}
+
+// ParseBackendURL returns the configuration of the backend at the URL.
+// The URL is one of:
+//
+//	bolt:///var/lib/kapacitor/kapacitor.db
+//	sqlite3:///var/lib/kapacitor/kapacitor.sqlite
+//	consul://host:8500/kapacitor?datacenter=dc1&token=secret
+//
+// Other schemes are used as the name of the SQL driver with the URL as the data source.
+func ParseBackendURL(s string) (Config, error) {
+	u, err := url.Parse(s)
+	if err != nil {
+		return Config{}, err
+	}
+	c := NewConfig()
+	switch u.Scheme {
+	case "":
+		return Config{}, fmt.Errorf("missing scheme in storage URL %q", s)
+	case BackendBolt:
+		c.Backend = BackendBolt
+		c.BoltDBPath = u.Host + u.Path
+	case "sqlite3", "sqlite":
+		c.Backend = BackendSQL
+		c.SQL.Driver = "sqlite3"
+		c.SQL.DataSource = u.Host + u.Path
+	case BackendConsul:
+		c.Backend = BackendConsul
+		q := u.Query()
+		c.Consul.Address = u.Host
+		if scheme := q.Get("scheme"); scheme != "" {
+			c.Consul.Scheme = scheme
+		}
+		c.Consul.Datacenter = q.Get("datacenter")
+		c.Consul.Token = q.Get("token")
+		if prefix := strings.Trim(u.Path, "/"); prefix != "" {
+			c.Consul.Prefix = prefix
+		}
+	default:
+		c.Backend = BackendSQL
+		c.SQL.Driver = u.Scheme
+		c.SQL.DataSource = s
+	}
+	return c, c.Validate()
+}
+
+// Copy replaces the stores of the target backend with the stores of the source backend,
+// and returns the number of keys copied for each namespace.
+// Each store is copied in one transaction, but the stores are not copied at the same point in time.
+func Copy(from, to Backend) (map[string]int, error) {
+	namespaces, err := from.Namespaces()
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to list namespaces")
+	}
+	sort.Strings(namespaces)
+	copied := make(map[string]int, len(namespaces))
+	for _, ns := range namespaces {
+		var kvs []*KeyValue
+		if err := from.Store(ns).View(func(tx ReadOnlyTx) error {
+			kvs, err = tx.List("")
+			return err
+		}); err != nil {
+			return copied, errors.Wrapf(err, "failed to read store %q", ns)
+		}
+		if err := replaceStore(to.Store(ns), kvs); err != nil {
+			return copied, errors.Wrapf(err, "failed to write store %q", ns)
+		}
+		copied[ns] = len(kvs)
+	}
+	return copied, nil
+}
+
+// replaceStore replaces all keys of the store with the key values in one transaction.
+func replaceStore(store Interface, kvs []*KeyValue) error {
+	return store.Update(func(tx Tx) error {
+		existing, err := tx.List("")
+		if err != nil {
+			return err
+		}
+		for _, kv := range existing {
+			if err := tx.Delete(kv.Key); err != nil {
+				return err
+			}
+		}
+		for _, kv := range kvs {
+			if err := tx.Put(kv.Key, kv.Value); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// BoltBackend keeps each namespace in a bucket of a bolt database.
+type BoltBackend struct {
+	DB *bolt.DB
+}
+
+func NewBoltBackend(db *bolt.DB) *BoltBackend {
+	return &BoltBackend{DB: db}
+}
+
+func (b *BoltBackend) Store(namespace string) Interface {
+	return NewBolt(b.DB, namespace)
+}
+
+func (b *BoltBackend) Namespaces() (namespaces []string, err error) {
+	err = b.DB.View(func(tx *bolt.Tx) error {
+		return tx.ForEach(func(name []byte, bucket *bolt.Bucket) error {
+			if k, _ := bucket.Cursor().First(); k != nil {
+				namespaces = append(namespaces, string(name))
+			}
+			return nil
+		})
+	})
+	return
+}
+
+func (b *BoltBackend) Close() error {
+	return b.DB.Close()
+}
+
+// sortKeyValues sorts the key values by key, as they are listed by the bolt backend.
+func sortKeyValues(kvs []*KeyValue) {
+	sort.Sort(keyValues(kvs))
+}
+
+type keyValues []*KeyValue
+
+func (kvs keyValues) Len() int           { return len(kvs) }
+func (kvs keyValues) Less(i, j int) bool { return kvs[i].Key < kvs[j].Key }
+func (kvs keyValues) Swap(i, j int)      { kvs[i], kvs[j] = kvs[j], kvs[i] }
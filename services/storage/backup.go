@@ -0,0 +1,244 @@
+package storage
+
+import (
+	"encoding/binary"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/boltdb/bolt"
+	"github.com/pkg/errors"
+)
+
+const (
+	backupPrefix     = "kapacitor-"
+	backupExt        = ".db"
+	backupTimeFormat = "20060102T150405Z"
+
+	// boltMagic identifies the meta pages of a bolt database.
+	boltMagic = 0xED0CDAED
+)
+
+// WriteBackup writes all stores of the backend to a bolt database file,
+// which can be restored into a backend of any type.
+// The backup of a bolt backend is a consistent copy of its database,
+// the stores of other backends are not copied at the same point in time.
+func WriteBackup(b Backend, path string) error {
+	tmp := path + ".tmp"
+	if err := writeBackup(b, tmp); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+func writeBackup(b Backend, path string) error {
+	if bb, ok := b.(*BoltBackend); ok {
+		return bb.DB.View(func(tx *bolt.Tx) error {
+			return tx.CopyFile(path, 0600)
+		})
+	}
+	db, err := bolt.Open(path, 0600, &bolt.Options{Timeout: time.Second})
+	if err != nil {
+		return err
+	}
+	backup := NewBoltBackend(db)
+	_, err = Copy(b, backup)
+	if cerr := backup.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+// OpenBackup opens a backup read only and checks the integrity of its bolt database.
+func OpenBackup(path string) (*BoltBackend, error) {
+	if err := checkBoltSize(path); err != nil {
+		return nil, errors.Wrap(err, "invalid backup")
+	}
+	db, err := bolt.Open(path, 0600, &bolt.Options{Timeout: time.Second, ReadOnly: true})
+	if err != nil {
+		return nil, errors.Wrap(err, "invalid backup")
+	}
+	if err := db.View(func(tx *bolt.Tx) error {
+		var first error
+		// Drain the errors so that the check completes.
+		for err := range tx.Check() {
+			if first == nil {
+				first = err
+			}
+		}
+		return first
+	}); err != nil {
+		db.Close()
+		return nil, errors.Wrap(err, "corrupt backup")
+	}
+	return NewBoltBackend(db), nil
+}
+
+// checkBoltSize returns an error if a bolt database file is shorter than its meta pages claim.
+// Bolt maps the file into memory and faults reading the pages past the end of a truncated file.
+// The meta pages are read in little endian, the byte order of the platforms Kapacitor runs on.
+func checkBoltSize(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	size := uint64(info.Size())
+	// The meta page is the page header followed by the
+	// magic, version, page size, flags, root bucket, freelist and high water mark.
+	meta := make([]byte, 64)
+	if _, err := f.ReadAt(meta, 0); err != nil {
+		return errors.New("not a bolt database")
+	}
+	if binary.LittleEndian.Uint32(meta[16:]) != boltMagic {
+		return errors.New("not a bolt database")
+	}
+	pageSize := uint64(binary.LittleEndian.Uint32(meta[24:]))
+	if pageSize == 0 {
+		return errors.New("not a bolt database")
+	}
+	for _, offset := range []uint64{0, pageSize} {
+		if _, err := f.ReadAt(meta, int64(offset)); err != nil {
+			return errors.New("truncated bolt database")
+		}
+		if binary.LittleEndian.Uint32(meta[16:]) != boltMagic {
+			continue
+		}
+		if pages := binary.LittleEndian.Uint64(meta[56:]); pages > size/pageSize {
+			return fmt.Errorf("truncated bolt database, %d of %d pages", size/pageSize, pages)
+		}
+	}
+	return nil
+}
+
+// CheckVersions returns an error if the backup has a store version
+// that differs from the version of the store in the backend.
+// The stores of a backup without versions are upgraded the next time Kapacitor starts.
+func CheckVersions(backup, b Backend) error {
+	versions, err := storeVersions(b)
+	if err != nil {
+		return errors.Wrap(err, "failed to read store versions")
+	}
+	backupVersions, err := storeVersions(backup)
+	if err != nil {
+		return errors.Wrap(err, "failed to read backup store versions")
+	}
+	for id, version := range backupVersions {
+		if exp, ok := versions[id]; !ok || version != exp {
+			return fmt.Errorf("backup store %q has version %q, expected version %q", id, version, exp)
+		}
+	}
+	return nil
+}
+
+func storeVersions(b Backend) (map[string]string, error) {
+	versions := make(map[string]string)
+	err := b.Store(versionsNamespace).View(func(tx ReadOnlyTx) error {
+		kvs, err := tx.List("")
+		if err != nil {
+			return err
+		}
+		for _, kv := range kvs {
+			versions[kv.Key] = string(kv.Value)
+		}
+		return nil
+	})
+	return versions, err
+}
+
+// Restore replaces all stores of the backend with the stores of the backup,
+// and returns the number of keys restored for each namespace.
+// The stores missing from the backup are emptied.
+// The stores of a bolt backend are replaced in one transaction.
+func Restore(backup *BoltBackend, to Backend) (map[string]int, error) {
+	if b, ok := to.(*BoltBackend); ok {
+		return restoreBolt(backup.DB, b.DB)
+	}
+	namespaces, err := to.Namespaces()
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to list namespaces")
+	}
+	restored, err := Copy(backup, to)
+	if err != nil {
+		return restored, err
+	}
+	for _, ns := range namespaces {
+		if _, ok := restored[ns]; ok {
+			continue
+		}
+		if err := replaceStore(to.Store(ns), nil); err != nil {
+			return restored, errors.Wrapf(err, "failed to empty store %q", ns)
+		}
+	}
+	return restored, nil
+}
+
+func restoreBolt(from, to *bolt.DB) (map[string]int, error) {
+	restored := make(map[string]int)
+	err := from.View(func(src *bolt.Tx) error {
+		return to.Update(func(dst *bolt.Tx) error {
+			var names [][]byte
+			if err := dst.ForEach(func(name []byte, _ *bolt.Bucket) error {
+				names = append(names, append([]byte{}, name...))
+				return nil
+			}); err != nil {
+				return err
+			}
+			for _, name := range names {
+				if err := dst.DeleteBucket(name); err != nil {
+					return err
+				}
+			}
+			return src.ForEach(func(name []byte, b *bolt.Bucket) error {
+				bucket, err := dst.CreateBucket(name)
+				if err != nil {
+					return err
+				}
+				return b.ForEach(func(k, v []byte) error {
+					if v == nil {
+						// The stores do not nest buckets.
+						return nil
+					}
+					restored[string(name)]++
+					return bucket.Put(k, v)
+				})
+			})
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+	return restored, nil
+}
+
+// backupName returns the file name of a scheduled backup made at t.
+func backupName(t time.Time) string {
+	return backupPrefix + t.UTC().Format(backupTimeFormat) + backupExt
+}
+
+// pruneBackups removes the oldest scheduled backups of the directory
+// so that at most retention backups remain.
+func pruneBackups(dir string, retention int) error {
+	paths, err := filepath.Glob(filepath.Join(dir, backupPrefix+"*"+backupExt))
+	if err != nil {
+		return err
+	}
+	if len(paths) <= retention {
+		return nil
+	}
+	// The names sort in the order the backups were made.
+	sort.Strings(paths)
+	for _, p := range paths[:len(paths)-retention] {
+		if err := os.Remove(p); err != nil {
+			return err
+		}
+	}
+	return nil
+}
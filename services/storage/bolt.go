@@ -112,7 +112,7 @@ func (b *Bolt) list(tx *bolt.Tx, prefixStr string) (kvs []*KeyValue, err error)
 	cursor := bucket.Cursor()
 	prefix := []byte(prefixStr)
 
-	for key, v := cursor.Seek(prefix); bytes.HasPrefix(key, prefix); key, v = cursor.Next() {
+	for key, v := cursor.Seek(prefix); key != nil && bytes.HasPrefix(key, prefix); key, v = cursor.Next() {
 		value := make([]byte, len(v))
 		copy(value, v)
 
@@ -1,21 +1,129 @@
 package storage
 
-import "fmt"
+import (
+	"fmt"
+	"regexp"
+	"time"
+
+	"github.com/influxdata/influxdb/toml"
+)
+
+const (
+	BackendBolt   = "bolt"
+	BackendSQL    = "sql"
+	BackendConsul = "consul"
+
+	DefaultSQLTable     = "kapacitor_storage"
+	DefaultConsulPrefix = "kapacitor/storage"
+
+	DefaultBackupInterval  = 24 * time.Hour
+	DefaultBackupRetention = 7
+	// Default maximum size of an uploaded backup, 1GB.
+	DefaultMaxRestoreSize = 1024 * 1024 * 1024
+)
+
+var validTable = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
 
 type Config struct {
+	// Backend is the storage backend, one of "bolt", "sql" or "consul".
+	Backend string `toml:"backend"`
 	// Path to a boltdb database file.
 	BoltDBPath string `toml:"boltdb"`
+
+	// BackupDir is the directory of the scheduled backups.
+	// Backups are not scheduled if it is empty.
+	BackupDir string `toml:"backup-dir"`
+	// BackupInterval is the time between scheduled backups.
+	BackupInterval toml.Duration `toml:"backup-interval"`
+	// BackupRetention is the number of scheduled backups kept in the backup directory.
+	BackupRetention int `toml:"backup-retention"`
+
+	// MigrateTargets are the storage URLs the stores can be migrated to through the API.
+	// Migration through the API is disabled if it is empty.
+	MigrateTargets []string `toml:"migrate-targets"`
+	// MaxRestoreSize is the maximum size in bytes of a backup uploaded to be restored.
+	MaxRestoreSize int64 `toml:"max-restore-size"`
+
+	SQL    SQLConfig    `toml:"sql"`
+	Consul ConsulConfig `toml:"consul"`
+}
+
+type SQLConfig struct {
+	// Driver is the name of the database/sql driver, i.e. "sqlite3".
+	// The sqlite3 driver is only compiled into kapacitord built with cgo and the sqlite3 build tag.
+	Driver string `toml:"driver"`
+	// DataSource is the driver specific data source name, i.e. the path of the SQLite database.
+	DataSource string `toml:"data-source"`
+	// Table holds the keys of all namespaces, it is created if it does not exist.
+	Table string `toml:"table"`
+}
+
+type ConsulConfig struct {
+	// Address of the Consul agent, including the scheme if it is not http.
+	Address    string `toml:"address"`
+	Scheme     string `toml:"scheme"`
+	Datacenter string `toml:"datacenter"`
+	Token      string `toml:"token"`
+	// Prefix of the keys of all namespaces.
+	Prefix string `toml:"prefix"`
 }
 
 func NewConfig() Config {
 	return Config{
-		BoltDBPath: "./kapacitor.db",
+		Backend:         BackendBolt,
+		BoltDBPath:      "./kapacitor.db",
+		BackupInterval:  toml.Duration(DefaultBackupInterval),
+		BackupRetention: DefaultBackupRetention,
+		MaxRestoreSize:  DefaultMaxRestoreSize,
+		SQL: SQLConfig{
+			Table: DefaultSQLTable,
+		},
+		Consul: ConsulConfig{
+			Address: "127.0.0.1:8500",
+			Scheme:  "http",
+			Prefix:  DefaultConsulPrefix,
+		},
 	}
 }
 
 func (c Config) Validate() error {
-	if c.BoltDBPath == "" {
-		return fmt.Errorf("must specify storage 'boltdb' path")
+	if c.BackupDir != "" {
+		if c.BackupInterval <= 0 {
+			return fmt.Errorf("storage 'backup-interval' must be positive")
+		}
+		if c.BackupRetention < 1 {
+			return fmt.Errorf("storage 'backup-retention' must be at least 1")
+		}
+	}
+	if c.MaxRestoreSize <= 0 {
+		return fmt.Errorf("storage 'max-restore-size' must be positive, got %d", c.MaxRestoreSize)
+	}
+	for _, target := range c.MigrateTargets {
+		if _, err := ParseBackendURL(target); err != nil {
+			return fmt.Errorf("invalid storage 'migrate-targets' URL %q: %v", target, err)
+		}
+	}
+	switch c.Backend {
+	case BackendBolt, "":
+		if c.BoltDBPath == "" {
+			return fmt.Errorf("must specify storage 'boltdb' path")
+		}
+	case BackendSQL:
+		if c.SQL.Driver == "" {
+			return fmt.Errorf("must specify storage sql 'driver'")
+		}
+		if c.SQL.DataSource == "" {
+			return fmt.Errorf("must specify storage sql 'data-source'")
+		}
+		if !validTable.MatchString(c.SQL.Table) {
+			return fmt.Errorf("invalid storage sql 'table' %q", c.SQL.Table)
+		}
+	case BackendConsul:
+		if c.Consul.Address == "" {
+			return fmt.Errorf("must specify storage consul 'address'")
+		}
+	default:
+		return fmt.Errorf("unknown storage backend %q, must be one of %q, %q or %q", c.Backend, BackendBolt, BackendSQL, BackendConsul)
 	}
 	return nil
 }
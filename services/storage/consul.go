@@ -0,0 +1,236 @@
+package storage
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/hashicorp/consul/api"
+)
+
+// maxConsulTxnOps is the maximum number of operations of a Consul transaction.
+const maxConsulTxnOps = 64
+
+// ConsulKV implementation of Store.
+// The keys of a namespace are kept under the prefix of the namespace.
+//
+// The writes of a transaction are buffered and committed in Consul transactions,
+// which are atomic for up to 64 writes. The transactions are serialized by the backend,
+// but the reads are not isolated from other instances writing to the same prefix.
+type ConsulKV struct {
+	kv     *api.KV
+	prefix string
+	// mu serializes the transactions of the backend.
+	mu *sync.Mutex
+}
+
+func (s *ConsulKV) View(f func(tx ReadOnlyTx) error) error {
+	return DoView(s, f)
+}
+
+func (s *ConsulKV) Update(f func(tx Tx) error) error {
+	return DoUpdate(s, f)
+}
+
+func (s *ConsulKV) BeginTx() (Tx, error) {
+	s.mu.Lock()
+	return &consulTx{
+		s:        s,
+		writable: true,
+		writes:   make(map[string]*api.KVTxnOp),
+	}, nil
+}
+
+func (s *ConsulKV) BeginReadOnlyTx() (ReadOnlyTx, error) {
+	return &consulTx{s: s}, nil
+}
+
+type consulTx struct {
+	s        *ConsulKV
+	writable bool
+	done     bool
+	// writes are the buffered writes by key.
+	writes map[string]*api.KVTxnOp
+}
+
+func (t *consulTx) Get(key string) (*KeyValue, error) {
+	if op, ok := t.writes[key]; ok {
+		if op.Verb == api.KVDelete {
+			return nil, ErrNoKeyExists
+		}
+		return &KeyValue{Key: key, Value: op.Value}, nil
+	}
+	pair, _, err := t.s.kv.Get(t.s.prefix+key, nil)
+	if err != nil {
+		return nil, err
+	}
+	if pair == nil {
+		return nil, ErrNoKeyExists
+	}
+	return &KeyValue{
+		Key:   key,
+		Value: append([]byte{}, pair.Value...),
+	}, nil
+}
+
+func (t *consulTx) Exists(key string) (bool, error) {
+	_, err := t.Get(key)
+	if err == ErrNoKeyExists {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+func (t *consulTx) List(prefix string) ([]*KeyValue, error) {
+	pairs, _, err := t.s.kv.List(t.s.prefix+prefix, nil)
+	if err != nil {
+		return nil, err
+	}
+	values := make(map[string][]byte, len(pairs))
+	for _, pair := range pairs {
+		values[strings.TrimPrefix(pair.Key, t.s.prefix)] = pair.Value
+	}
+	for key, op := range t.writes {
+		if !strings.HasPrefix(key, prefix) {
+			continue
+		}
+		if op.Verb == api.KVDelete {
+			delete(values, key)
+		} else {
+			values[key] = op.Value
+		}
+	}
+	kvs := make([]*KeyValue, 0, len(values))
+	for key, value := range values {
+		kvs = append(kvs, &KeyValue{
+			Key:   key,
+			Value: append([]byte{}, value...),
+		})
+	}
+	sortKeyValues(kvs)
+	return kvs, nil
+}
+
+func (t *consulTx) Put(key string, value []byte) error {
+	t.writes[key] = &api.KVTxnOp{
+		Verb:  api.KVSet,
+		Key:   t.s.prefix + key,
+		Value: append([]byte{}, value...),
+	}
+	return nil
+}
+
+func (t *consulTx) Delete(key string) error {
+	t.writes[key] = &api.KVTxnOp{
+		Verb: api.KVDelete,
+		Key:  t.s.prefix + key,
+	}
+	return nil
+}
+
+func (t *consulTx) Commit() error {
+	if t.done {
+		return nil
+	}
+	defer t.finish()
+	keys := make([]string, 0, len(t.writes))
+	for key := range t.writes {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	ops := make(api.KVTxnOps, 0, maxConsulTxnOps)
+	for i, key := range keys {
+		ops = append(ops, t.writes[key])
+		if len(ops) == maxConsulTxnOps || i == len(keys)-1 {
+			ok, resp, _, err := t.s.kv.Txn(ops, nil)
+			if err != nil {
+				return err
+			}
+			if !ok {
+				return fmt.Errorf("consul transaction rolled back: %v", txnErrors(resp))
+			}
+			ops = ops[:0]
+		}
+	}
+	return nil
+}
+
+func (t *consulTx) Rollback() error {
+	if !t.done {
+		t.finish()
+	}
+	return nil
+}
+
+func (t *consulTx) finish() {
+	t.done = true
+	if t.writable {
+		t.s.mu.Unlock()
+	}
+}
+
+func txnErrors(resp *api.KVTxnResponse) string {
+	if resp == nil {
+		return "unknown error"
+	}
+	msgs := make([]string, len(resp.Errors))
+	for i, e := range resp.Errors {
+		msgs[i] = e.What
+	}
+	return strings.Join(msgs, ", ")
+}
+
+// ConsulBackend keeps the namespaces under a prefix of the Consul KV store.
+type ConsulBackend struct {
+	kv     *api.KV
+	prefix string
+	mu     sync.Mutex
+}
+
+func NewConsulBackend(c ConsulConfig) (*ConsulBackend, error) {
+	cli, err := api.NewClient(&api.Config{
+		Address:    c.Address,
+		Scheme:     c.Scheme,
+		Datacenter: c.Datacenter,
+		Token:      c.Token,
+	})
+	if err != nil {
+		return nil, err
+	}
+	prefix := strings.Trim(c.Prefix, "/")
+	if prefix != "" {
+		prefix += "/"
+	}
+	return &ConsulBackend{
+		kv:     cli.KV(),
+		prefix: prefix,
+	}, nil
+}
+
+func (b *ConsulBackend) Store(namespace string) Interface {
+	return &ConsulKV{
+		kv:     b.kv,
+		prefix: b.prefix + namespace + "/",
+		mu:     &b.mu,
+	}
+}
+
+func (b *ConsulBackend) Namespaces() ([]string, error) {
+	keys, _, err := b.kv.Keys(b.prefix, "/", nil)
+	if err != nil {
+		return nil, err
+	}
+	var namespaces []string
+	for _, key := range keys {
+		ns := strings.TrimPrefix(key, b.prefix)
+		if strings.HasSuffix(ns, "/") {
+			namespaces = append(namespaces, strings.TrimSuffix(ns, "/"))
+		}
+	}
+	return namespaces, nil
+}
+
+func (b *ConsulBackend) Close() error {
+	return nil
+}
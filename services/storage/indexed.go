@@ -29,11 +29,16 @@ type BinaryObject interface {
 
 type NewObjectF func() BinaryObject
 type ValueFunc func(BinaryObject) (string, error)
+type ValuesFunc func(BinaryObject) ([]string, error)
 
 type Index struct {
 	Name      string
 	ValueFunc ValueFunc
-	Unique    bool
+	// ValuesFunc is used instead of ValueFunc for indexes
+	// where an object has any number of values, i.e. labels.
+	// Such an index cannot be unique.
+	ValuesFunc ValuesFunc
+	Unique     bool
 }
 
 func (idx Index) ValueOf(o BinaryObject) (string, error) {
@@ -47,6 +52,25 @@ func (idx Index) ValueOf(o BinaryObject) (string, error) {
 	return value, nil
 }
 
+// ValuesOf returns all values of the index for the object.
+func (idx Index) ValuesOf(o BinaryObject) ([]string, error) {
+	if idx.ValuesFunc == nil {
+		value, err := idx.ValueOf(o)
+		if err != nil {
+			return nil, err
+		}
+		return []string{value}, nil
+	}
+	values, err := idx.ValuesFunc(o)
+	if err != nil {
+		return nil, err
+	}
+	for i := range values {
+		values[i] = values[i] + "/" + o.ObjectID()
+	}
+	return values, nil
+}
+
 // Indexed provides basic CRUD operations and maintains indexes.
 type IndexedStore struct {
 	store Interface
@@ -110,9 +134,12 @@ func (c IndexedStoreConfig) Validate() error {
 		if !validPath(idx.Name) {
 			return fmt.Errorf("invalid index name %q", idx.Name)
 		}
-		if idx.ValueFunc == nil {
+		if idx.ValueFunc == nil && idx.ValuesFunc == nil {
 			return fmt.Errorf("index %q does not have a ValueF function", idx.Name)
 		}
+		if idx.ValuesFunc != nil && idx.Unique {
+			return fmt.Errorf("index %q has many values and cannot be unique", idx.Name)
+		}
 	}
 	return nil
 }
@@ -225,34 +252,33 @@ func (s *IndexedStore) putTx(tx Tx, o BinaryObject, allowReplace, requireReplace
 	}
 	// Put all indexes
 	for _, idx := range s.indexes {
-		// Get new index key
-		newValue, err := idx.ValueOf(o)
+		// Get new index values
+		newValues, err := idx.ValuesOf(o)
 		if err != nil {
 			return err
 		}
-		newIndexKey := s.indexKey(idx.Name, newValue)
 
-		// Get old index key, if we are replacing
-		var oldValue string
+		// Get old index values, if we are replacing
+		var oldValues []string
 		if replacing {
-			var err error
-			oldValue, err = idx.ValueOf(old)
+			oldValues, err = idx.ValuesOf(old)
 			if err != nil {
 				return err
 			}
 		}
-		oldIndexKey := s.indexKey(idx.Name, oldValue)
 
-		if !replacing || (replacing && oldIndexKey != newIndexKey) {
-			// Update new key
-			err := tx.Put(newIndexKey, []byte(o.ObjectID()))
-			if err != nil {
-				return err
+		// Remove old keys
+		for _, v := range oldValues {
+			if !containsValue(newValues, v) {
+				if err := tx.Delete(s.indexKey(idx.Name, v)); err != nil {
+					return err
+				}
 			}
-			if replacing {
-				// Remove old key
-				err = tx.Delete(oldIndexKey)
-				if err != nil {
+		}
+		// Update new keys
+		for _, v := range newValues {
+			if !containsValue(oldValues, v) {
+				if err := tx.Put(s.indexKey(idx.Name, v), []byte(o.ObjectID())); err != nil {
 					return err
 				}
 			}
@@ -261,6 +287,15 @@ func (s *IndexedStore) putTx(tx Tx, o BinaryObject, allowReplace, requireReplace
 	return nil
 }
 
+func containsValue(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
 func (s *IndexedStore) Delete(id string) error {
 	return s.store.Update(func(tx Tx) error {
 		return s.DeleteTx(tx, id)
@@ -284,14 +319,14 @@ func (s *IndexedStore) DeleteTx(tx Tx, id string) error {
 
 	// Delete all indexes
 	for _, idx := range s.indexes {
-		value, err := idx.ValueOf(o)
+		values, err := idx.ValuesOf(o)
 		if err != nil {
 			return err
 		}
-		indexKey := s.indexKey(idx.Name, value)
-		err = tx.Delete(indexKey)
-		if err != nil {
-			return err
+		for _, v := range values {
+			if err := tx.Delete(s.indexKey(idx.Name, v)); err != nil {
+				return err
+			}
 		}
 	}
 	return nil
@@ -323,6 +358,30 @@ func (s *IndexedStore) ReverseListTx(tx ReadOnlyTx, index, pattern string, offse
 	return s.list(tx, index, pattern, offset, limit, true)
 }
 
+// ListValue returns all objects with the given value of a non unique index, sorted by ID.
+func (s *IndexedStore) ListValue(index, value string) (objects []BinaryObject, err error) {
+	err = s.store.View(func(tx ReadOnlyTx) error {
+		objects, err = s.ListValueTx(tx, index, value)
+		return err
+	})
+	return
+}
+func (s *IndexedStore) ListValueTx(tx ReadOnlyTx, index, value string) ([]BinaryObject, error) {
+	ids, err := tx.List(s.indexKey(index, value) + "/")
+	if err != nil {
+		return nil, err
+	}
+	objects := make([]BinaryObject, len(ids))
+	for i, id := range ids {
+		o, err := s.GetTx(tx, string(id.Value))
+		if err != nil {
+			return nil, err
+		}
+		objects[i] = o
+	}
+	return objects, nil
+}
+
 func (s *IndexedStore) list(tx ReadOnlyTx, index, pattern string, offset, limit int, reverse bool) ([]BinaryObject, error) {
 	// List all object ids sorted by index
 	ids, err := tx.List(s.indexKey(index, "") + "/")
@@ -372,6 +431,33 @@ func (s *IndexedStore) list(tx ReadOnlyTx, index, pattern string, offset, limit
 	return objects, nil
 }
 
+// Check decodes all objects of the store and reports the objects
+// that cannot be decoded or are not stored under the key of their ID.
+func (s *IndexedStore) Check() (result CheckResult, err error) {
+	err = s.store.View(func(tx ReadOnlyTx) error {
+		data, err := tx.List(s.dataPrefix)
+		if err != nil {
+			return err
+		}
+		for _, kv := range data {
+			result.Objects++
+			o := s.newObject()
+			if err := o.UnmarshalBinary(kv.Value); err != nil {
+				result.Corrupt = append(result.Corrupt, CorruptObject{Key: kv.Key, Err: err})
+				continue
+			}
+			if key := s.dataKey(o.ObjectID()); key != kv.Key {
+				result.Corrupt = append(result.Corrupt, CorruptObject{
+					Key: kv.Key,
+					Err: fmt.Errorf("object %q belongs under key %q", o.ObjectID(), key),
+				})
+			}
+		}
+		return nil
+	})
+	return
+}
+
 // Rebuild completely rebuilds all indexes for the store.
 func (s *IndexedStore) Rebuild() error {
 	return s.store.Update(func(tx Tx) error {
@@ -399,14 +485,16 @@ func (s *IndexedStore) RebuildTx(tx Tx) error {
 			return errors.Wrapf(err, "failed to unmarshal object with key: %q", kv.Key)
 		}
 		for _, idx := range s.indexes {
-			v, err := idx.ValueOf(o)
+			values, err := idx.ValuesOf(o)
 			if err != nil {
 				return errors.Wrapf(err, "failed to get index value for object with key: %q", kv.Key)
 			}
-			key := s.indexKey(idx.Name, v)
-			err = tx.Put(key, []byte(o.ObjectID()))
-			if err != nil {
-				return errors.Wrapf(err, "failed to update index for object with key: %q", kv.Key)
+			for _, v := range values {
+				key := s.indexKey(idx.Name, v)
+				err = tx.Put(key, []byte(o.ObjectID()))
+				if err != nil {
+					return errors.Wrapf(err, "failed to update index for object with key: %q", kv.Key)
+				}
 			}
 		}
 	}
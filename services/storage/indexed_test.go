@@ -3,6 +3,7 @@ package storage_test
 import (
 	"encoding/json"
 	"reflect"
+	"strings"
 	"testing"
 	"time"
 
@@ -218,3 +219,124 @@ func TestIndexedStore_CRUD(t *testing.T) {
 		})
 	}
 }
+
+func TestIndexedStore_ListValue(t *testing.T) {
+	for name, sc := range stores {
+		t.Run(name, func(t *testing.T) {
+			db, err := sc()
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer db.Close()
+
+			s := db.Store("values")
+			c := storage.DefaultIndexedStoreConfig("values", func() storage.BinaryObject {
+				return new(object)
+			})
+			c.Indexes = append(c.Indexes, storage.Index{
+				Name: "words",
+				ValuesFunc: func(o storage.BinaryObject) ([]string, error) {
+					obj, ok := o.(*object)
+					if !ok {
+						return nil, storage.ImpossibleTypeErr(obj, o)
+					}
+					return strings.Fields(obj.Value), nil
+				},
+			})
+			is, err := storage.NewIndexedStore(s, c)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			o1 := &object{ID: "1", Value: "a b"}
+			o2 := &object{ID: "2", Value: "b c"}
+			if err := is.Create(o1); err != nil {
+				t.Fatal(err)
+			}
+			if err := is.Create(o2); err != nil {
+				t.Fatal(err)
+			}
+			check := func(value string, exp []storage.BinaryObject) {
+				got, err := is.ListValue("words", value)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if len(got) != len(exp) || (len(exp) > 0 && !reflect.DeepEqual(got, exp)) {
+					t.Errorf("unexpected objects for value %q:\ngot\n%s\nexp\n%s\n", value, spew.Sdump(got), spew.Sdump(exp))
+				}
+			}
+			check("a", []storage.BinaryObject{o1})
+			check("b", []storage.BinaryObject{o1, o2})
+			check("c", []storage.BinaryObject{o2})
+
+			// Replacing an object updates only the changed values
+			o1.Value = "b d"
+			if err := is.Replace(o1); err != nil {
+				t.Fatal(err)
+			}
+			check("a", nil)
+			check("b", []storage.BinaryObject{o1, o2})
+			check("d", []storage.BinaryObject{o1})
+
+			// Rebuilding keeps all values
+			if err := is.Rebuild(); err != nil {
+				t.Fatal(err)
+			}
+			check("b", []storage.BinaryObject{o1, o2})
+
+			// Deleting an object removes all of its values
+			if err := is.Delete("2"); err != nil {
+				t.Fatal(err)
+			}
+			check("b", []storage.BinaryObject{o1})
+			check("c", nil)
+		})
+	}
+}
+
+func TestIndexedStore_Check(t *testing.T) {
+	for name, sc := range stores {
+		t.Run(name, func(t *testing.T) {
+			db, err := sc()
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer db.Close()
+
+			s := db.Store("check")
+			c := storage.DefaultIndexedStoreConfig("check", func() storage.BinaryObject {
+				return new(object)
+			})
+			is, err := storage.NewIndexedStore(s, c)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := is.Create(&object{ID: "1", Value: "a"}); err != nil {
+				t.Fatal(err)
+			}
+			if err := s.Update(func(tx storage.Tx) error {
+				if err := tx.Put("/check/data/2", []byte("{")); err != nil {
+					return err
+				}
+				return tx.Put("/check/data/3", []byte(`{"ID":"4"}`))
+			}); err != nil {
+				t.Fatal(err)
+			}
+
+			result, err := is.Check()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got, exp := result.Objects, 3; got != exp {
+				t.Errorf("unexpected objects checked: got %d exp %d", got, exp)
+			}
+			var keys []string
+			for _, o := range result.Corrupt {
+				keys = append(keys, o.Key)
+			}
+			if exp := []string{"/check/data/2", "/check/data/3"}; !reflect.DeepEqual(keys, exp) {
+				t.Errorf("unexpected corrupt keys: got %v exp %v", keys, exp)
+			}
+		})
+	}
+}
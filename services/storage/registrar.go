@@ -6,6 +6,21 @@ import "sync"
 type StoreActioner interface {
 	// Rebuild the entire store, this should be considered to be an expensive action.
 	Rebuild() error
+	// Check decodes every object of the store and reports the objects that cannot be decoded.
+	Check() (CheckResult, error)
+}
+
+// CheckResult is the result of checking the objects of a store.
+type CheckResult struct {
+	// Objects is the number of objects checked.
+	Objects int
+	Corrupt []CorruptObject
+}
+
+// CorruptObject is a stored object that cannot be decoded.
+type CorruptObject struct {
+	Key string
+	Err error
 }
 
 type StoreActionerRegistrar interface {
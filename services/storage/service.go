@@ -3,29 +3,43 @@ package storage
 import (
 	"os"
 	"path"
+	"path/filepath"
 	"sync"
+	"sync/atomic"
+	"time"
 
-	"github.com/boltdb/bolt"
 	"github.com/influxdata/kapacitor/services/httpd"
 	"github.com/pkg/errors"
 )
 
 type Diagnostic interface {
 	Error(msg string, err error)
+	BackupCreated(path string)
 }
 
 type Service struct {
-	dbpath string
+	conf Config
 
-	boltdb *bolt.DB
-	stores map[string]Interface
-	mu     sync.Mutex
+	backend Backend
+	stores  map[string]Interface
+	mu      sync.Mutex
 
 	registrar StoreActionerRegistrar
 	apiServer *APIServer
 
 	versions Versions
 
+	// restored is set once a backup is restored,
+	// the stores are read only until the restart since the services still hold the data they replaced.
+	restored int32
+
+	closing chan struct{}
+	wg      sync.WaitGroup
+
+	// Replicated is set when the stores are replicated by the cluster or HA services.
+	// Backups are not restored then, the restore would bypass the replication.
+	Replicated bool
+
 	HTTPDService interface {
 		AddRoutes([]httpd.Route) error
 		DelRoutes([]httpd.Route)
@@ -36,7 +50,7 @@ type Service struct {
 
 func NewService(conf Config, d Diagnostic) *Service {
 	return &Service{
-		dbpath: conf.BoltDBPath,
+		conf:   conf,
 		diag:   d,
 		stores: make(map[string]Interface),
 	}
@@ -49,22 +63,30 @@ const (
 func (s *Service) Open() error {
 	s.mu.Lock()
 	defer s.mu.Unlock()
-	err := os.MkdirAll(path.Dir(s.dbpath), 0755)
-	if err != nil {
-		return errors.Wrapf(err, "mkdir dirs %q", s.dbpath)
+	if s.conf.Backend == BackendBolt || s.conf.Backend == "" {
+		err := os.MkdirAll(path.Dir(s.conf.BoltDBPath), 0755)
+		if err != nil {
+			return errors.Wrapf(err, "mkdir dirs %q", s.conf.BoltDBPath)
+		}
 	}
-	db, err := bolt.Open(s.dbpath, 0600, nil)
+	backend, err := OpenBackend(s.conf)
 	if err != nil {
-		return errors.Wrapf(err, "open boltdb @ %q", s.dbpath)
+		return err
 	}
-	s.boltdb = db
+	s.backend = backend
 
 	s.registrar = NewStorageResitrar()
 	s.apiServer = &APIServer{
-		DB:           s.boltdb,
-		Registrar:    s.registrar,
-		HTTPDService: s.HTTPDService,
-		diag:         s.diag,
+		Backend:        s.backend,
+		Registrar:      s.registrar,
+		MigrateTargets: s.conf.MigrateTargets,
+		MaxRestoreSize: s.conf.MaxRestoreSize,
+		Replicated:     s.Replicated,
+		HTTPDService:   s.HTTPDService,
+		diag:           s.diag,
+		restored: func() {
+			atomic.StoreInt32(&s.restored, 1)
+		},
 	}
 
 	if err := s.apiServer.Open(); err != nil {
@@ -73,19 +95,33 @@ func (s *Service) Open() error {
 
 	s.versions = NewVersions(s.store(versionsNamespace))
 
+	if s.conf.BackupDir != "" {
+		if err := os.MkdirAll(s.conf.BackupDir, 0755); err != nil {
+			return errors.Wrapf(err, "mkdir backup dir %q", s.conf.BackupDir)
+		}
+		s.closing = make(chan struct{})
+		s.wg.Add(1)
+		go s.scheduleBackups()
+	}
+
 	return nil
 }
 
 func (s *Service) Close() error {
 	s.mu.Lock()
 	defer s.mu.Unlock()
+	if s.closing != nil {
+		close(s.closing)
+		s.wg.Wait()
+		s.closing = nil
+	}
 	if s.apiServer != nil {
 		if err := s.apiServer.Close(); err != nil {
 			return err
 		}
 	}
-	if s.boltdb != nil {
-		return s.boltdb.Close()
+	if s.backend != nil {
+		return s.backend.Close()
 	}
 	return nil
 }
@@ -102,12 +138,28 @@ func (s *Service) store(name string) Interface {
 	if store, ok := s.stores[name]; ok {
 		return store
 	} else {
-		store = NewBolt(s.boltdb, name)
+		store = &restorableStore{
+			Interface: s.backend.Store(name),
+			s:         s,
+		}
 		s.stores[name] = store
 		return store
 	}
 }
 
+// restorableStore refuses the updates once a backup is restored.
+type restorableStore struct {
+	Interface
+	s *Service
+}
+
+func (s *restorableStore) Update(f func(Tx) error) error {
+	if atomic.LoadInt32(&s.s.restored) == 1 {
+		return ErrRestored
+	}
+	return s.Interface.Update(f)
+}
+
 func (s *Service) Versions() Versions {
 	return s.versions
 }
@@ -115,3 +167,31 @@ func (s *Service) Versions() Versions {
 func (s *Service) Register(name string, store StoreActioner) {
 	s.registrar.Register(name, store)
 }
+
+// scheduleBackups writes a backup to the backup directory every backup interval
+// and removes the backups beyond the retention.
+func (s *Service) scheduleBackups() {
+	defer s.wg.Done()
+	ticker := time.NewTicker(time.Duration(s.conf.BackupInterval))
+	defer ticker.Stop()
+	for {
+		select {
+		case <-s.closing:
+			return
+		case t := <-ticker.C:
+			s.backup(t)
+		}
+	}
+}
+
+func (s *Service) backup(t time.Time) {
+	path := filepath.Join(s.conf.BackupDir, backupName(t))
+	if err := WriteBackup(s.backend, path); err != nil {
+		s.diag.Error("failed to write scheduled backup", err)
+		return
+	}
+	s.diag.BackupCreated(path)
+	if err := pruneBackups(s.conf.BackupDir, s.conf.BackupRetention); err != nil {
+		s.diag.Error("failed to remove old backups", err)
+	}
+}
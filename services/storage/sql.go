@@ -0,0 +1,219 @@
+package storage
+
+import (
+	"database/sql"
+	"fmt"
+	"unicode/utf8"
+)
+
+// SQL implementation of Store.
+// The keys of all namespaces are kept in one table of a database of any database/sql driver.
+type SQL struct {
+	db        *sql.DB
+	table     string
+	namespace string
+}
+
+func NewSQL(db *sql.DB, table, namespace string) *SQL {
+	return &SQL{
+		db:        db,
+		table:     table,
+		namespace: namespace,
+	}
+}
+
+func (s *SQL) View(f func(tx ReadOnlyTx) error) error {
+	return DoView(s, f)
+}
+
+func (s *SQL) Update(f func(tx Tx) error) error {
+	return DoUpdate(s, f)
+}
+
+func (s *SQL) BeginTx() (Tx, error) {
+	return s.newTx()
+}
+
+func (s *SQL) BeginReadOnlyTx() (ReadOnlyTx, error) {
+	return s.newTx()
+}
+
+func (s *SQL) newTx() (*sqlTx, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	return &sqlTx{
+		s:  s,
+		tx: tx,
+	}, nil
+}
+
+// sqlTx wraps an underlying sql.Tx type to implement the Tx interface.
+type sqlTx struct {
+	s  *SQL
+	tx *sql.Tx
+}
+
+func (t *sqlTx) Get(key string) (*KeyValue, error) {
+	value := []byte{}
+	err := t.tx.QueryRow(
+		"SELECT store_value FROM "+t.s.table+" WHERE namespace = $1 AND store_key = $2",
+		t.s.namespace, key,
+	).Scan(&value)
+	if err == sql.ErrNoRows {
+		return nil, ErrNoKeyExists
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &KeyValue{
+		Key:   key,
+		Value: value,
+	}, nil
+}
+
+func (t *sqlTx) Exists(key string) (bool, error) {
+	_, err := t.Get(key)
+	if err == ErrNoKeyExists {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+func (t *sqlTx) List(prefix string) ([]*KeyValue, error) {
+	rows, err := t.tx.Query(
+		"SELECT store_key, store_value FROM "+t.s.table+" WHERE namespace = $1 AND substr(store_key, 1, $2) = $3",
+		t.s.namespace, utf8.RuneCountInString(prefix), prefix,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var kvs []*KeyValue
+	for rows.Next() {
+		kv := &KeyValue{Value: []byte{}}
+		if err := rows.Scan(&kv.Key, &kv.Value); err != nil {
+			return nil, err
+		}
+		kvs = append(kvs, kv)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	// The order of the database depends on its collation.
+	sortKeyValues(kvs)
+	return kvs, nil
+}
+
+func (t *sqlTx) Put(key string, value []byte) error {
+	if value == nil {
+		value = []byte{}
+	}
+	_, err := t.tx.Exec(
+		"INSERT INTO "+t.s.table+" (namespace, store_key, store_value) VALUES ($1, $2, $3)"+
+			" ON CONFLICT (namespace, store_key) DO UPDATE SET store_value = excluded.store_value",
+		t.s.namespace, key, value,
+	)
+	return err
+}
+
+func (t *sqlTx) Delete(key string) error {
+	_, err := t.tx.Exec(
+		"DELETE FROM "+t.s.table+" WHERE namespace = $1 AND store_key = $2",
+		t.s.namespace, key,
+	)
+	return err
+}
+
+func (t *sqlTx) Commit() error {
+	return t.tx.Commit()
+}
+
+func (t *sqlTx) Rollback() error {
+	err := t.tx.Rollback()
+	if err == sql.ErrTxDone {
+		// Already committed
+		return nil
+	}
+	return err
+}
+
+func driverRegistered(name string) bool {
+	for _, d := range sql.Drivers() {
+		if d == name {
+			return true
+		}
+	}
+	return false
+}
+
+// SQLBackend keeps the namespaces in a table of a SQL database.
+type SQLBackend struct {
+	db    *sql.DB
+	table string
+}
+
+// NewSQLBackend opens the database and creates the table if it does not exist.
+func NewSQLBackend(c SQLConfig) (*SQLBackend, error) {
+	if c.Driver == "sqlite" {
+		c.Driver = "sqlite3"
+	}
+	if !driverRegistered(c.Driver) {
+		if c.Driver == "sqlite3" {
+			return nil, fmt.Errorf("the sqlite3 driver is not compiled into kapacitord, build it with cgo and the sqlite3 build tag")
+		}
+		return nil, fmt.Errorf("the %s driver is not compiled into kapacitord", c.Driver)
+	}
+	db, err := sql.Open(c.Driver, c.DataSource)
+	if err != nil {
+		return nil, fmt.Errorf("open %s database: %v", c.Driver, err)
+	}
+	valueType := "BLOB"
+	switch c.Driver {
+	case "sqlite3":
+		// SQLite locks the whole database while writing.
+		db.SetMaxOpenConns(1)
+	case "postgres", "pgx":
+		valueType = "BYTEA"
+	}
+	if _, err := db.Exec(
+		"CREATE TABLE IF NOT EXISTS " + c.Table + " (" +
+			"namespace TEXT NOT NULL, " +
+			"store_key TEXT NOT NULL, " +
+			"store_value " + valueType + " NOT NULL, " +
+			"PRIMARY KEY (namespace, store_key))",
+	); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("create table %s: %v", c.Table, err)
+	}
+	return &SQLBackend{
+		db:    db,
+		table: c.Table,
+	}, nil
+}
+
+func (b *SQLBackend) Store(namespace string) Interface {
+	return NewSQL(b.db, b.table, namespace)
+}
+
+func (b *SQLBackend) Namespaces() ([]string, error) {
+	rows, err := b.db.Query("SELECT DISTINCT namespace FROM " + b.table)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var namespaces []string
+	for rows.Next() {
+		var ns string
+		if err := rows.Scan(&ns); err != nil {
+			return nil, err
+		}
+		namespaces = append(namespaces, ns)
+	}
+	return namespaces, rows.Err()
+}
+
+func (b *SQLBackend) Close() error {
+	return b.db.Close()
+}
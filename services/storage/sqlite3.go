@@ -0,0 +1,8 @@
+// +build sqlite3
+
+package storage
+
+import (
+	// Register the sqlite3 driver, it requires cgo and Go 1.16 or later.
+	_ "github.com/mattn/go-sqlite3"
+)
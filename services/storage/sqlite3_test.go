@@ -0,0 +1,47 @@
+// +build sqlite3
+
+package storage_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/influxdata/kapacitor/services/storage"
+)
+
+func init() {
+	stores["sql"] = newSQL
+	backends["sql"] = func(s storeCloser) storage.Backend {
+		return s.(sqlDB).SQLBackend
+	}
+}
+
+type sqlDB struct {
+	*storage.SQLBackend
+	dir string
+}
+
+func newSQL() (storeCloser, error) {
+	tmpDir, err := ioutil.TempDir("", "storage-sql")
+	if err != nil {
+		return nil, err
+	}
+	c := storage.NewConfig().SQL
+	c.Driver = "sqlite3"
+	c.DataSource = filepath.Join(tmpDir, "kapacitor.sqlite")
+	b, err := storage.NewSQLBackend(c)
+	if err != nil {
+		os.RemoveAll(tmpDir)
+		return nil, err
+	}
+	return sqlDB{
+		SQLBackend: b,
+		dir:        tmpDir,
+	}, nil
+}
+
+func (s sqlDB) Close() {
+	s.SQLBackend.Close()
+	os.RemoveAll(s.dir)
+}
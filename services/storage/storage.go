@@ -5,6 +5,7 @@ import "errors"
 // Common errors that can be returned
 var (
 	ErrNoKeyExists = errors.New("no key exists")
+	ErrRestored    = errors.New("a backup was restored, restart Kapacitor to load it")
 )
 
 // ReadOperator provides an interface for performing read operations.
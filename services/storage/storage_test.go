@@ -2,13 +2,21 @@ package storage_test
 
 import (
 	"bytes"
+	"encoding/json"
 	"fmt"
 	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
 	"os"
 	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
 	"testing"
 
 	"github.com/boltdb/bolt"
+	"github.com/hashicorp/consul/api"
 	"github.com/influxdata/kapacitor/services/storage"
 	"github.com/pkg/errors"
 )
@@ -21,8 +29,19 @@ type createStoreCloser func() (storeCloser, error)
 // stores is a map of all storage implementations,
 // each test will be run against the stores found in this map.
 var stores = map[string]createStoreCloser{
-	"bolt": newBolt,
-	"mem":  newMemStore,
+	"bolt":   newBolt,
+	"mem":    newMemStore,
+	"consul": newConsul,
+}
+
+// backends returns the backend of the stores supporting backups.
+var backends = map[string]func(storeCloser) storage.Backend{
+	"bolt": func(s storeCloser) storage.Backend {
+		return storage.NewBoltBackend(s.(boltDB).db)
+	},
+	"consul": func(s storeCloser) storage.Backend {
+		return s.(consulKV).ConsulBackend
+	},
 }
 
 type storeCloser interface {
@@ -79,6 +98,107 @@ func (s memStore) Store(name string) storage.Interface {
 func (s memStore) Close() {
 }
 
+type consulKV struct {
+	*storage.ConsulBackend
+	server *httptest.Server
+}
+
+func newConsul() (storeCloser, error) {
+	server := httptest.NewServer(newFakeConsul())
+	c := storage.NewConfig().Consul
+	c.Address = strings.TrimPrefix(server.URL, "http://")
+	b, err := storage.NewConsulBackend(c)
+	if err != nil {
+		server.Close()
+		return nil, err
+	}
+	return consulKV{
+		ConsulBackend: b,
+		server:        server,
+	}, nil
+}
+
+func (c consulKV) Close() {
+	c.ConsulBackend.Close()
+	c.server.Close()
+}
+
+// fakeConsul serves the parts of the Consul KV API used by the consul backend.
+type fakeConsul struct {
+	mu  sync.Mutex
+	kvs map[string][]byte
+}
+
+func newFakeConsul() *fakeConsul {
+	return &fakeConsul{
+		kvs: make(map[string][]byte),
+	}
+}
+
+func (c *fakeConsul) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	switch {
+	case r.Method == "GET" && strings.HasPrefix(r.URL.Path, "/v1/kv/"):
+		key := strings.TrimPrefix(r.URL.Path, "/v1/kv/")
+		q := r.URL.Query()
+		var result interface{}
+		found := false
+		if _, ok := q["keys"]; ok {
+			keys := make(map[string]bool)
+			for k := range c.kvs {
+				if !strings.HasPrefix(k, key) {
+					continue
+				}
+				rest := strings.TrimPrefix(k, key)
+				if sep := q.Get("separator"); sep != "" {
+					if i := strings.Index(rest, sep); i >= 0 {
+						rest = rest[:i+len(sep)]
+					}
+				}
+				keys[key+rest] = true
+			}
+			list := make([]string, 0, len(keys))
+			for k := range keys {
+				list = append(list, k)
+			}
+			sort.Strings(list)
+			result, found = list, len(list) > 0
+		} else {
+			var pairs []*api.KVPair
+			_, recurse := q["recurse"]
+			for k, v := range c.kvs {
+				if k == key || recurse && strings.HasPrefix(k, key) {
+					pairs = append(pairs, &api.KVPair{Key: k, Value: v})
+				}
+			}
+			result, found = pairs, len(pairs) > 0
+		}
+		if !found {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		json.NewEncoder(w).Encode(result)
+	case r.Method == "PUT" && r.URL.Path == "/v1/txn":
+		var ops api.TxnOps
+		if err := json.NewDecoder(r.Body).Decode(&ops); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		for _, op := range ops {
+			switch op.KV.Verb {
+			case api.KVSet:
+				c.kvs[op.KV.Key] = op.KV.Value
+			case api.KVDelete:
+				delete(c.kvs, op.KV.Key)
+			}
+		}
+		json.NewEncoder(w).Encode(api.TxnResponse{})
+	default:
+		http.NotFound(w, r)
+	}
+}
+
 func TestStorage_CRUD(t *testing.T) {
 	for name, sc := range stores {
 		t.Run(name, func(t *testing.T) {
@@ -311,3 +431,188 @@ func TestStorage_Update_Concurrent(t *testing.T) {
 		})
 	}
 }
+
+func TestCopy(t *testing.T) {
+	from, err := newBolt()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer from.Close()
+	to, err := newConsul()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer to.Close()
+
+	put := func(s storage.Interface, kvs ...string) {
+		if err := s.Update(func(tx storage.Tx) error {
+			for i := 0; i < len(kvs); i += 2 {
+				if err := tx.Put(kvs[i], []byte(kvs[i+1])); err != nil {
+					return err
+				}
+			}
+			return nil
+		}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	put(from.Store("tasks"), "task0", "a", "task1", "b")
+	put(from.Store("templates"), "template0", "c")
+	// Keys missing from the source are removed from the target.
+	put(to.Store("tasks"), "task2", "d")
+
+	fromBackend := storage.NewBoltBackend(from.(boltDB).db)
+	toBackend := to.(consulKV).ConsulBackend
+	copied, err := storage.Copy(fromBackend, toBackend)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if exp := map[string]int{"tasks": 2, "templates": 1}; !reflect.DeepEqual(copied, exp) {
+		t.Errorf("unexpected copied keys: got %v exp %v", copied, exp)
+	}
+
+	namespaces, err := toBackend.Namespaces()
+	if err != nil {
+		t.Fatal(err)
+	}
+	sort.Strings(namespaces)
+	if exp := []string{"tasks", "templates"}; !reflect.DeepEqual(namespaces, exp) {
+		t.Errorf("unexpected namespaces: got %v exp %v", namespaces, exp)
+	}
+	for _, ns := range namespaces {
+		var exp, got []*storage.KeyValue
+		from.Store(ns).View(func(tx storage.ReadOnlyTx) error {
+			exp, err = tx.List("")
+			return err
+		})
+		to.Store(ns).View(func(tx storage.ReadOnlyTx) error {
+			got, err = tx.List("")
+			return err
+		})
+		if !reflect.DeepEqual(got, exp) {
+			t.Errorf("unexpected keys of %s: got %v exp %v", ns, got, exp)
+		}
+	}
+}
+
+func TestBackup_Restore(t *testing.T) {
+	put := func(s storage.Interface, kvs ...string) {
+		if err := s.Update(func(tx storage.Tx) error {
+			for i := 0; i < len(kvs); i += 2 {
+				if err := tx.Put(kvs[i], []byte(kvs[i+1])); err != nil {
+					return err
+				}
+			}
+			return nil
+		}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	list := func(s storage.Interface) (kvs []*storage.KeyValue) {
+		if err := s.View(func(tx storage.ReadOnlyTx) (err error) {
+			kvs, err = tx.List("")
+			return
+		}); err != nil {
+			t.Fatal(err)
+		}
+		return
+	}
+
+	for name, backend := range backends {
+		t.Run(name, func(t *testing.T) {
+			from, err := newBolt()
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer from.Close()
+			to, err := stores[name]()
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer to.Close()
+
+			put(from.Store("versions"), "handler_specs", "1")
+			put(from.Store("tasks"), "task0", "a", "task1", "b")
+			put(from.Store("templates"), "template0", "c")
+			path := filepath.Join(from.(boltDB).dir, "backup.db")
+			if err := storage.WriteBackup(storage.NewBoltBackend(from.(boltDB).db), path); err != nil {
+				t.Fatal(err)
+			}
+
+			put(to.Store("versions"), "handler_specs", "1")
+			put(to.Store("tasks"), "task2", "d")
+			// Stores missing from the backup are emptied.
+			put(to.Store("recordings"), "recording0", "e")
+
+			backup, err := storage.OpenBackup(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer backup.Close()
+			toBackend := backend(to)
+			if err := storage.CheckVersions(backup, toBackend); err != nil {
+				t.Fatal(err)
+			}
+			restored, err := storage.Restore(backup, toBackend)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if exp := map[string]int{"tasks": 2, "templates": 1, "versions": 1}; !reflect.DeepEqual(restored, exp) {
+				t.Errorf("unexpected restored keys: got %v exp %v", restored, exp)
+			}
+			for _, ns := range []string{"tasks", "templates", "versions"} {
+				if got, exp := list(to.Store(ns)), list(from.Store(ns)); !reflect.DeepEqual(got, exp) {
+					t.Errorf("unexpected keys of %s: got %v exp %v", ns, got, exp)
+				}
+			}
+			if got := list(to.Store("recordings")); len(got) != 0 {
+				t.Errorf("expected recordings to be emptied, got %v", got)
+			}
+
+			// A backup with another store version is rejected.
+			put(to.Store("versions"), "handler_specs", "2")
+			if err := storage.CheckVersions(backup, toBackend); err == nil {
+				t.Error("expected error checking versions")
+			}
+		})
+	}
+}
+
+func TestOpenBackup_Corrupt(t *testing.T) {
+	db, err := newBolt()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	dir := db.(boltDB).dir
+	if err := db.Store("tasks").Update(func(tx storage.Tx) error {
+		return tx.Put("task0", bytes.Repeat([]byte("a"), 64*1024))
+	}); err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(dir, "backup.db")
+	if err := storage.WriteBackup(storage.NewBoltBackend(db.(boltDB).db), path); err != nil {
+		t.Fatal(err)
+	}
+	backup, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	testCases := map[string][]byte{
+		"garbage":   bytes.Repeat([]byte("corrupt"), 1024),
+		"truncated": backup[:len(backup)/2],
+	}
+	for name, data := range testCases {
+		t.Run(name, func(t *testing.T) {
+			path := filepath.Join(dir, name+".db")
+			if err := ioutil.WriteFile(path, data, 0600); err != nil {
+				t.Fatal(err)
+			}
+			if b, err := storage.OpenBackup(path); err == nil {
+				b.Close()
+				t.Fatal("expected error opening corrupt backup")
+			}
+		})
+	}
+}
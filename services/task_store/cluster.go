@@ -0,0 +1,114 @@
+package task_store
+
+import (
+	"reflect"
+
+	"github.com/influxdata/kapacitor/keyvalue"
+	"github.com/influxdata/kapacitor/services/cluster"
+)
+
+// syncOwnedTasks starts the enabled tasks assigned to this member and stops all other tasks,
+// once the tasks have been changed by another member or reassigned to other members.
+func (ts *Service) syncOwnedTasks() {
+	ts.startedMu.Lock()
+	defer ts.startedMu.Unlock()
+	if ts.closed {
+		return
+	}
+
+	enabled := make(map[string]Task)
+	streams := make(map[string][]cluster.DBRP)
+	offset := 0
+	limit := 100
+	for {
+		tasks, err := ts.tasks.List("*", offset, limit)
+		if err != nil {
+			ts.diag.Error("failed to list tasks", err)
+			return
+		}
+		for _, task := range tasks {
+			if task.Status != Enabled {
+				continue
+			}
+			enabled[task.ID] = task
+			if dbrps := streamDBRPs(task); dbrps != nil {
+				streams[task.ID] = dbrps
+			}
+		}
+		if len(tasks) != limit {
+			break
+		}
+		offset += limit
+	}
+	ts.streams = streams
+	ts.setStreamTasks()
+
+	// Stop the tasks that have been deleted, disabled, changed or reassigned.
+	for id, old := range ts.started {
+		task, ok := enabled[id]
+		switch {
+		case !ok:
+			if _, err := ts.tasks.Get(id); err == ErrNoTaskExists {
+				ts.discard(id)
+			} else {
+				ts.stop(id)
+			}
+		case !ts.ClusterService.Owns(id) || !sameDefinition(old, task):
+			ts.stop(id)
+		}
+	}
+
+	// Start the enabled tasks that are assigned to this member.
+	for id, task := range enabled {
+		if _, ok := ts.started[id]; ok || !ts.ClusterService.Owns(id) {
+			continue
+		}
+		ts.diag.StartingTask(id)
+		if err := ts.start(task); err != nil {
+			ts.diag.Error("failed to start task assigned to this member", err, keyvalue.KV("task", id))
+		} else {
+			ts.diag.StartedTask(id)
+		}
+	}
+}
+
+// streamDBRPs returns the DBRPs read by a stream task, or nil if the task is not a stream task.
+func streamDBRPs(task Task) []cluster.DBRP {
+	if task.Type != StreamTask {
+		return nil
+	}
+	dbrps := make([]cluster.DBRP, len(task.DBRPs))
+	for i, dbrp := range task.DBRPs {
+		dbrps[i] = cluster.DBRP{
+			Database:        dbrp.Database,
+			RetentionPolicy: dbrp.RetentionPolicy,
+		}
+	}
+	return dbrps
+}
+
+// setStreamTask sets the DBRPs of an enabled stream task, or removes the task if dbrps is nil,
+// so that the writes are forwarded to the member owning the task.
+// Must be called with startedMu held.
+func (ts *Service) setStreamTask(id string, dbrps []cluster.DBRP) {
+	old, ok := ts.streams[id]
+	if ok == (dbrps != nil) && reflect.DeepEqual(old, dbrps) {
+		return
+	}
+	if dbrps == nil {
+		delete(ts.streams, id)
+	} else {
+		ts.streams[id] = dbrps
+	}
+	ts.setStreamTasks()
+}
+
+// setStreamTasks sets the stream tasks of the cluster.
+// Must be called with startedMu held.
+func (ts *Service) setStreamTasks() {
+	streams := make(map[string][]cluster.DBRP, len(ts.streams))
+	for id, dbrps := range ts.streams {
+		streams[id] = dbrps
+	}
+	ts.ClusterService.SetStreamTasks(streams)
+}
@@ -1,6 +1,7 @@
 package task_store
 
 import (
+	"errors"
 	"time"
 
 	"github.com/influxdata/influxdb/toml"
@@ -10,15 +11,23 @@ type Config struct {
 	// Deprecated, only needed to find old db and migrate
 	Dir              string        `toml:"dir"`
 	SnapshotInterval toml.Duration `toml:"snapshot-interval"`
+	// Number of revisions to keep for each task.
+	// Older revisions are pruned when a new revision is recorded.
+	// Zero means keep all revisions.
+	RevisionRetention int `toml:"revision-retention"`
 }
 
 func NewConfig() Config {
 	return Config{
-		Dir:              "./tasks",
-		SnapshotInterval: toml.Duration(time.Minute),
+		Dir:               "./tasks",
+		SnapshotInterval:  toml.Duration(time.Minute),
+		RevisionRetention: 10,
 	}
 }
 
 func (c Config) Validate() error {
+	if c.RevisionRetention < 0 {
+		return errors.New("revision-retention must not be negative")
+	}
 	return nil
 }
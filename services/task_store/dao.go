@@ -8,6 +8,7 @@ import (
 	"path"
 	"time"
 
+	"github.com/influxdata/kapacitor/labels"
 	"github.com/influxdata/kapacitor/services/storage"
 )
 
@@ -17,6 +18,7 @@ var (
 	ErrTemplateExists   = errors.New("template already exists")
 	ErrNoTemplateExists = errors.New("no template exists")
 	ErrNoSnapshotExists = errors.New("no snapshot exists")
+	ErrNoRevisionExists = errors.New("no task revision exists")
 )
 
 // Data access object for Task data.
@@ -42,7 +44,12 @@ type TaskDAO interface {
 	// More results may exist while the number of returned items is equal to limit.
 	List(pattern string, offset, limit int) ([]Task, error)
 
+	// List tasks matching a pattern whose labels match the selector.
+	// Offset and limit are applied after filtering by labels.
+	ListByLabels(pattern string, selector labels.Selector, offset, limit int) ([]Task, error)
+
 	Rebuild() error
+	Check() (storage.CheckResult, error)
 }
 
 // Data access object for Template data.
@@ -68,6 +75,10 @@ type TemplateDAO interface {
 	// More results may exist while the number of returned items is equal to limit.
 	List(pattern string, offset, limit int) ([]Template, error)
 
+	// List templates matching a pattern whose labels match the selector.
+	// Offset and limit are applied after filtering by labels.
+	ListByLabels(pattern string, selector labels.Selector, offset, limit int) ([]Template, error)
+
 	// Associate a task with a template
 	AssociateTask(templateId, taskId string) error
 
@@ -75,6 +86,35 @@ type TemplateDAO interface {
 	DisassociateTask(templateId, taskId string) error
 
 	ListAssociatedTasks(templateId string) ([]string, error)
+
+	Rebuild() error
+	Check() (storage.CheckResult, error)
+}
+
+// Data access object for TaskRevision data.
+type TaskRevisionDAO interface {
+	// Retrieve a single revision of a task.
+	// ErrNoRevisionExists is returned if the revision does not exist.
+	Get(taskID string, revision int) (TaskRevision, error)
+
+	// Create a revision.
+	// Revisions are immutable once created.
+	Create(r TaskRevision) error
+
+	// Delete a single revision.
+	// It is not an error to delete an non-existent revision.
+	Delete(taskID string, revision int) error
+
+	// Delete all revisions of a task.
+	DeleteAll(taskID string) error
+
+	// List revisions of a task, the most recent revision first.
+	// Offset and limit are pagination bounds. Offset is inclusive starting at index 0.
+	// If limit < 0, then no limit is enforced.
+	List(taskID string, offset, limit int) ([]TaskRevision, error)
+
+	Rebuild() error
+	Check() (storage.CheckResult, error)
 }
 
 // Data access object for Snapshot data.
@@ -106,6 +146,26 @@ const (
 	Enabled
 )
 
+type LimitPolicy int
+
+const (
+	DropPolicy LimitPolicy = iota
+	EvictPolicy
+	StopPolicy
+)
+
+// Resource limits of a task, a zero limit means the resource is not limited.
+type TaskLimits struct {
+	// Maximum number of groups per node.
+	MaxGroups int
+	// Maximum number of points buffered per window.
+	MaxWindowPoints int
+	// Maximum number of sets per join group waiting for their matches.
+	MaxJoinBuffer int
+	// What happens once a limit is reached.
+	Policy LimitPolicy
+}
+
 type TaskType int
 
 const (
@@ -137,6 +197,13 @@ type Task struct {
 	Modified time.Time
 	// The time the task was last changed to status Enabled.
 	LastEnabled time.Time
+	// The revision number of the current task definition.
+	// Zero if the task was defined before revisions were recorded.
+	Revision int
+	// Arbitrary key/value labels attached to the task.
+	Labels map[string]string
+	// Resource limits of the task.
+	Limits TaskLimits
 }
 
 type rawTask Task
@@ -157,6 +224,52 @@ func (t *Task) UnmarshalBinary(data []byte) error {
 	return dec.Decode((*rawTask)(t))
 }
 
+// TaskRevision is an immutable copy of a task definition,
+// recorded each time the definition of the task changes.
+type TaskRevision struct {
+	// ID of the task this is a revision of
+	TaskID string
+	// Revision number, starting at 1 and increasing by one for each change.
+	Revision int
+	// The task type (stream|batch).
+	Type TaskType
+	// The DBs and RPs the task is allowed to access.
+	DBRPs []DBRP
+	// The TICKscript for the task.
+	TICKscript string
+	// ID of task template
+	TemplateID string
+	// Set of vars for a templated task
+	Vars map[string]Var
+	// Name of the user that made the change, empty if authentication is disabled.
+	Author string
+	// Date the revision was recorded.
+	Created time.Time
+}
+
+type rawTaskRevision TaskRevision
+
+func revisionID(taskID string, revision int) string {
+	// Zero pad the revision so that revisions sort numerically in the ID index.
+	return path.Join(taskID, fmt.Sprintf("%010d", revision))
+}
+
+func (r TaskRevision) ObjectID() string {
+	return revisionID(r.TaskID, r.Revision)
+}
+
+func (r TaskRevision) MarshalBinary() ([]byte, error) {
+	var buf bytes.Buffer
+	enc := gob.NewEncoder(&buf)
+	err := enc.Encode(rawTaskRevision(r))
+	return buf.Bytes(), err
+}
+
+func (r *TaskRevision) UnmarshalBinary(data []byte) error {
+	dec := gob.NewDecoder(bytes.NewReader(data))
+	return dec.Decode((*rawTaskRevision)(r))
+}
+
 type Template struct {
 	// Unique identifier for the task
 	ID string
@@ -170,6 +283,26 @@ type Template struct {
 	Created time.Time
 	// The time the task was last modified
 	Modified time.Time
+	// Arbitrary key/value labels attached to the template.
+	Labels map[string]string
+}
+
+type rawTemplate Template
+
+func (t Template) ObjectID() string {
+	return t.ID
+}
+
+func (t Template) MarshalBinary() ([]byte, error) {
+	var buf bytes.Buffer
+	enc := gob.NewEncoder(&buf)
+	err := enc.Encode(rawTemplate(t))
+	return buf.Bytes(), err
+}
+
+func (t *Template) UnmarshalBinary(data []byte) error {
+	dec := gob.NewDecoder(bytes.NewReader(data))
+	return dec.Decode((*rawTemplate)(t))
 }
 
 type DBRP struct {
@@ -186,10 +319,80 @@ type taskKV struct {
 	store *storage.IndexedStore
 }
 
+const labelsIndex = "labels"
+
+// newLabelsIndex creates an index of every label of an object.
+func newLabelsIndex(labelsOf func(storage.BinaryObject) (map[string]string, error)) storage.Index {
+	return storage.Index{
+		Name: labelsIndex,
+		ValuesFunc: func(o storage.BinaryObject) ([]string, error) {
+			l, err := labelsOf(o)
+			if err != nil {
+				return nil, err
+			}
+			return labels.IndexValues(l), nil
+		},
+	}
+}
+
+// listByLabels lists the objects whose ID matches the pattern and whose labels match the selector.
+// If the selector has an equality requirement only the objects with that label are read.
+func listByLabels(
+	store *storage.IndexedStore,
+	pattern string,
+	selector labels.Selector,
+	offset, limit int,
+	labelsOf func(storage.BinaryObject) (map[string]string, error),
+) ([]storage.BinaryObject, error) {
+	var candidates []storage.BinaryObject
+	var err error
+	if k, v, ok := selector.Equality(); ok {
+		candidates, err = store.ListValue(labelsIndex, labels.IndexValue(k, v))
+	} else {
+		candidates, err = store.List(storage.DefaultIDIndex, "", 0, -1)
+	}
+	if err != nil {
+		return nil, err
+	}
+	var matches []storage.BinaryObject
+	for _, o := range candidates {
+		if pattern != "" {
+			if matched, _ := path.Match(pattern, o.ObjectID()); !matched {
+				continue
+			}
+		}
+		l, err := labelsOf(o)
+		if err != nil {
+			return nil, err
+		}
+		if !selector.Matches(l) {
+			continue
+		}
+		matches = append(matches, o)
+	}
+	if offset >= len(matches) {
+		return nil, nil
+	}
+	matches = matches[offset:]
+	if limit >= 0 && limit < len(matches) {
+		matches = matches[:limit]
+	}
+	return matches, nil
+}
+
+func taskLabels(o storage.BinaryObject) (map[string]string, error) {
+	t, ok := o.(*Task)
+	if !ok {
+		return nil, storage.ImpossibleTypeErr(t, o)
+	}
+	return t.Labels, nil
+}
+
 func newTaskKV(store storage.Interface) (*taskKV, error) {
 	c := storage.DefaultIndexedStoreConfig("tasks", func() storage.BinaryObject {
 		return new(Task)
 	})
+	c.Indexes = append(c.Indexes, newLabelsIndex(taskLabels))
 	istore, err := storage.NewIndexedStore(store, c)
 	if err != nil {
 		return nil, err
@@ -248,59 +451,154 @@ func (kv *taskKV) List(pattern string, offset, limit int) ([]Task, error) {
 	return tasks, nil
 }
 
+func (kv *taskKV) ListByLabels(pattern string, selector labels.Selector, offset, limit int) ([]Task, error) {
+	objects, err := listByLabels(kv.store, pattern, selector, offset, limit, taskLabels)
+	if err != nil {
+		return nil, err
+	}
+	tasks := make([]Task, len(objects))
+	for i, o := range objects {
+		tasks[i] = *o.(*Task)
+	}
+	return tasks, nil
+}
+
 func (kv *taskKV) Rebuild() error {
 	return kv.store.Rebuild()
 }
 
-const (
-	templateDataPrefix    = "/templates/data/"
-	templateIndexesPrefix = "/templates/indexes/"
-	// Associate tasks with a template
-	templateTaskPrefix = "/templates/tasks/"
+func (kv *taskKV) Check() (storage.CheckResult, error) {
+	return kv.store.Check()
+}
+
+// Key/Value store based implementation of the TaskRevisionDAO
+type taskRevisionKV struct {
+	raw   storage.Interface
+	store *storage.IndexedStore
+}
 
-	idIndex = "id/"
+const (
+	taskRevisionPrefix = "task_revisions"
 )
 
-// Key/Value store based implementation of the TemplateDAO
-type templateKV struct {
-	store storage.Interface
+func newTaskRevisionKV(store storage.Interface) (*taskRevisionKV, error) {
+	c := storage.DefaultIndexedStoreConfig(taskRevisionPrefix, func() storage.BinaryObject {
+		return new(TaskRevision)
+	})
+	istore, err := storage.NewIndexedStore(store, c)
+	if err != nil {
+		return nil, err
+	}
+	return &taskRevisionKV{
+		raw:   store,
+		store: istore,
+	}, nil
 }
 
-func newTemplateKV(store storage.Interface) *templateKV {
-	return &templateKV{
-		store: store,
+func (kv *taskRevisionKV) Get(taskID string, revision int) (TaskRevision, error) {
+	o, err := kv.store.Get(revisionID(taskID, revision))
+	if err != nil {
+		if err == storage.ErrNoObjectExists {
+			return TaskRevision{}, ErrNoRevisionExists
+		}
+		return TaskRevision{}, err
+	}
+	r, ok := o.(*TaskRevision)
+	if !ok {
+		return TaskRevision{}, storage.ImpossibleTypeErr(r, o)
 	}
+	return *r, nil
 }
 
-func (d *templateKV) encodeTemplate(t Template) ([]byte, error) {
-	var buf bytes.Buffer
-	enc := gob.NewEncoder(&buf)
-	err := enc.Encode(t)
-	return buf.Bytes(), err
+func (kv *taskRevisionKV) Create(r TaskRevision) error {
+	return kv.store.Create(&r)
 }
 
-func (d *templateKV) decodeTemplate(data []byte) (Template, error) {
-	var template Template
-	dec := gob.NewDecoder(bytes.NewReader(data))
-	err := dec.Decode(&template)
-	return template, err
+func (kv *taskRevisionKV) Delete(taskID string, revision int) error {
+	return kv.store.Delete(revisionID(taskID, revision))
+}
+
+func (kv *taskRevisionKV) DeleteAll(taskID string) error {
+	return kv.raw.Update(func(tx storage.Tx) error {
+		objects, err := kv.store.ListTx(tx, storage.DefaultIDIndex, path.Join(taskID, "*"), 0, -1)
+		if err != nil {
+			return err
+		}
+		for _, o := range objects {
+			if err := kv.store.DeleteTx(tx, o.ObjectID()); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
 }
 
-// Create a key for the template data
-func (d *templateKV) templateDataKey(id string) string {
-	return templateDataPrefix + id
+func (kv *taskRevisionKV) List(taskID string, offset, limit int) ([]TaskRevision, error) {
+	objects, err := kv.store.ReverseList(storage.DefaultIDIndex, path.Join(taskID, "*"), offset, limit)
+	if err != nil {
+		return nil, err
+	}
+	revisions := make([]TaskRevision, len(objects))
+	for i, o := range objects {
+		r, ok := o.(*TaskRevision)
+		if !ok {
+			return nil, storage.ImpossibleTypeErr(r, o)
+		}
+		revisions[i] = *r
+	}
+	return revisions, nil
 }
 
-// Create a key for a given index and value.
-//
-// Indexes are maintained via a 'directory' like system:
-//
-// /templates/data/ID -- contains encoded template data
-// /templates/index/id/ID -- contains the template ID
-//
-// As such to list all templates in ID sorted order use the /templates/index/id/ directory.
-func (d *templateKV) templateIndexKey(index, value string) string {
-	return templateIndexesPrefix + index + value
+func (kv *taskRevisionKV) Rebuild() error {
+	return kv.store.Rebuild()
+}
+
+func (kv *taskRevisionKV) Check() (storage.CheckResult, error) {
+	return kv.store.Check()
+}
+
+const (
+	// Associate tasks with a template
+	templateTaskPrefix = "/templates/tasks/"
+)
+
+// Key/Value store based implementation of the TemplateDAO
+type templateKV struct {
+	raw   storage.Interface
+	store *storage.IndexedStore
+}
+
+func templateLabels(o storage.BinaryObject) (map[string]string, error) {
+	t, ok := o.(*Template)
+	if !ok {
+		return nil, storage.ImpossibleTypeErr(t, o)
+	}
+	return t.Labels, nil
+}
+
+func newTemplateKV(store storage.Interface) (*templateKV, error) {
+	// Templates are stored as /templates/data/ID and indexed by ID as /templates/indexes/id/ID.
+	c := storage.DefaultIndexedStoreConfig("templates", func() storage.BinaryObject {
+		return new(Template)
+	})
+	c.Indexes = append(c.Indexes, newLabelsIndex(templateLabels))
+	istore, err := storage.NewIndexedStore(store, c)
+	if err != nil {
+		return nil, err
+	}
+	return &templateKV{
+		raw:   store,
+		store: istore,
+	}, nil
+}
+
+func (d *templateKV) error(err error) error {
+	if err == storage.ErrObjectExists {
+		return ErrTemplateExists
+	} else if err == storage.ErrNoObjectExists {
+		return ErrNoTemplateExists
+	}
+	return err
 }
 
 // Create a key for the template task association
@@ -308,85 +606,29 @@ func (d *templateKV) templateTaskAssociationKey(templateId, taskId string) strin
 	return templateTaskPrefix + templateId + "/" + taskId
 }
 
-func (d *templateKV) Get(id string) (t Template, err error) {
-	err = d.store.View(func(tx storage.ReadOnlyTx) error {
-		key := d.templateDataKey(id)
-		if exists, err := tx.Exists(key); err != nil {
-			return err
-		} else if !exists {
-			return ErrNoTemplateExists
-		}
-		kv, err := tx.Get(key)
-		if err != nil {
-			return err
-		}
-		t, err = d.decodeTemplate(kv.Value)
-		return err
-	})
-	return
+func (d *templateKV) Get(id string) (Template, error) {
+	o, err := d.store.Get(id)
+	if err != nil {
+		return Template{}, d.error(err)
+	}
+	t, ok := o.(*Template)
+	if !ok {
+		return Template{}, storage.ImpossibleTypeErr(t, o)
+	}
+	return *t, nil
 }
 
 func (d *templateKV) Create(t Template) error {
-	return d.store.Update(func(tx storage.Tx) error {
-		key := d.templateDataKey(t.ID)
-
-		exists, err := tx.Exists(key)
-		if err != nil {
-			return err
-		}
-		if exists {
-			return ErrTemplateExists
-		}
-
-		data, err := d.encodeTemplate(t)
-		if err != nil {
-			return err
-		}
-		// Put data
-		err = tx.Put(key, data)
-		if err != nil {
-			return err
-		}
-		// Put ID index
-		indexKey := d.templateIndexKey(idIndex, t.ID)
-		return tx.Put(indexKey, []byte(t.ID))
-	})
+	return d.error(d.store.Create(&t))
 }
 
 func (d *templateKV) Replace(t Template) error {
-	return d.store.Update(func(tx storage.Tx) error {
-		key := d.templateDataKey(t.ID)
-
-		exists, err := tx.Exists(key)
-		if err != nil {
-			return err
-		}
-		if !exists {
-			return ErrNoTemplateExists
-		}
-
-		data, err := d.encodeTemplate(t)
-		if err != nil {
-			return err
-		}
-		// Put data
-		err = tx.Put(key, data)
-		if err != nil {
-			return err
-		}
-		return nil
-	})
+	return d.error(d.store.Replace(&t))
 }
 
 func (d *templateKV) Delete(id string) error {
-	return d.store.Update(func(tx storage.Tx) error {
-		key := d.templateDataKey(id)
-		indexKey := d.templateIndexKey(idIndex, id)
-
-		if err := tx.Delete(key); err != nil {
-			return err
-		}
-		if err := tx.Delete(indexKey); err != nil {
+	return d.raw.Update(func(tx storage.Tx) error {
+		if err := d.store.DeleteTx(tx, id); err != nil {
 			return err
 		}
 
@@ -407,21 +649,21 @@ func (d *templateKV) Delete(id string) error {
 }
 
 func (d *templateKV) AssociateTask(templateId, taskId string) error {
-	return d.store.Update(func(tx storage.Tx) error {
+	return d.raw.Update(func(tx storage.Tx) error {
 		akey := d.templateTaskAssociationKey(templateId, taskId)
 		return tx.Put(akey, []byte(taskId))
 	})
 }
 
 func (d *templateKV) DisassociateTask(templateId, taskId string) error {
-	return d.store.Update(func(tx storage.Tx) error {
+	return d.raw.Update(func(tx storage.Tx) error {
 		akey := d.templateTaskAssociationKey(templateId, taskId)
 		return tx.Delete(akey)
 	})
 }
 
 func (d *templateKV) ListAssociatedTasks(templateId string) (taskIds []string, err error) {
-	err = d.store.View(func(tx storage.ReadOnlyTx) error {
+	err = d.raw.View(func(tx storage.ReadOnlyTx) error {
 		ids, err := tx.List(templateTaskPrefix + templateId + "/")
 		if err != nil {
 			return err
@@ -435,42 +677,40 @@ func (d *templateKV) ListAssociatedTasks(templateId string) (taskIds []string, e
 	return
 }
 
-func (d *templateKV) List(pattern string, offset, limit int) (templates []Template, err error) {
-	err = d.store.View(func(tx storage.ReadOnlyTx) error {
-		// Templates are indexed via their ID only.
-		// While templates are sorted in the data section by their ID anyway
-		// this allows us to do offset/limits and filtering without having to read in all template data.
-
-		// List all template ids sorted by ID
-		ids, err := tx.List(templateIndexesPrefix + idIndex)
-		if err != nil {
-			return err
+func (d *templateKV) convertTemplates(objects []storage.BinaryObject) ([]Template, error) {
+	templates := make([]Template, len(objects))
+	for i, o := range objects {
+		t, ok := o.(*Template)
+		if !ok {
+			return nil, storage.ImpossibleTypeErr(t, o)
 		}
+		templates[i] = *t
+	}
+	return templates, nil
+}
 
-		var match func([]byte) bool
-		if pattern != "" {
-			match = func(value []byte) bool {
-				id := string(value)
-				matched, _ := path.Match(pattern, id)
-				return matched
-			}
-		} else {
-			match = func([]byte) bool { return true }
-		}
-		matches := storage.DoListFunc(ids, match, offset, limit)
+func (d *templateKV) List(pattern string, offset, limit int) ([]Template, error) {
+	objects, err := d.store.List(storage.DefaultIDIndex, pattern, offset, limit)
+	if err != nil {
+		return nil, err
+	}
+	return d.convertTemplates(objects)
+}
 
-		templates = make([]Template, len(matches))
-		for i, id := range matches {
-			data, err := tx.Get(d.templateDataKey(string(id)))
-			if err != nil {
-				return err
-			}
-			t, err := d.decodeTemplate(data.Value)
-			templates[i] = t
-		}
-		return nil
-	})
-	return
+func (d *templateKV) ListByLabels(pattern string, selector labels.Selector, offset, limit int) ([]Template, error) {
+	objects, err := listByLabels(d.store, pattern, selector, offset, limit, templateLabels)
+	if err != nil {
+		return nil, err
+	}
+	return d.convertTemplates(objects)
+}
+
+func (d *templateKV) Rebuild() error {
+	return d.store.Rebuild()
+}
+
+func (d *templateKV) Check() (storage.CheckResult, error) {
+	return d.store.Check()
 }
 
 const (
@@ -0,0 +1,120 @@
+package task_store
+
+import (
+	"net/http"
+	"path"
+
+	"github.com/influxdata/kapacitor"
+	"github.com/influxdata/kapacitor/client/v1"
+	"github.com/influxdata/kapacitor/services/httpd"
+)
+
+const (
+	dependenciesPath = "/task-dependencies"
+	// dependentTasksHeader lists the enabled tasks fed by a deleted task.
+	dependentTasksHeader = "X-Kapacitor-Dependent-Tasks"
+)
+
+// dependencyGraph returns the dependency graph of all tasks and the set of disabled tasks.
+// Tasks that fail to compile are left out of the graph.
+func (ts *Service) dependencyGraph() (*kapacitor.DependencyGraph, map[string]bool, error) {
+	tasks, err := ts.allTasks()
+	if err != nil {
+		return nil, nil, err
+	}
+	kts := make([]*kapacitor.Task, 0, len(tasks))
+	disabled := make(map[string]bool)
+	for _, task := range tasks {
+		kt, err := ts.newKapacitorTask(task)
+		if err != nil {
+			continue
+		}
+		kts = append(kts, kt)
+		if task.Status != Enabled {
+			disabled[task.ID] = true
+		}
+	}
+	return kapacitor.NewDependencyGraph(kts), disabled, nil
+}
+
+func (ts *Service) handleTaskDependencies(w http.ResponseWriter, r *http.Request) {
+	g, disabled, err := ts.dependencyGraph()
+	if err != nil {
+		httpd.HttpError(w, err.Error(), true, http.StatusInternalServerError)
+		return
+	}
+	deps := client.TaskDependencies{
+		Link:         client.Link{Relation: client.Self, Href: path.Join(httpd.BasePath, dependenciesPath)},
+		Tasks:        g.Tasks,
+		Disabled:     make([]string, 0, len(disabled)),
+		Dependencies: make([]client.TaskDependency, len(g.Dependencies)),
+		Cycles:       g.Cycles(),
+		Dot:          string(g.Dot(disabled)),
+	}
+	for _, id := range g.Tasks {
+		if disabled[id] {
+			deps.Disabled = append(deps.Disabled, id)
+		}
+	}
+	for i, d := range g.Dependencies {
+		deps.Dependencies[i] = client.TaskDependency{
+			Upstream:        d.Upstream,
+			Downstream:      d.Downstream,
+			Database:        d.Database,
+			RetentionPolicy: d.RetentionPolicy,
+			Measurement:     d.Measurement,
+		}
+	}
+	if deps.Cycles == nil {
+		deps.Cycles = [][]string{}
+	}
+	w.Write(httpd.MarshalJSON(deps, true))
+}
+
+// dependentTasks returns the enabled tasks fed by the task,
+// since they stop receiving its points once the task is disabled or deleted.
+// Only the stream tasks reading the databases and retention policies the task writes to are compiled,
+// so that disabling or deleting every task does not compile all tasks for each of them.
+func (ts *Service) dependentTasks(action string, task Task) ([]string, error) {
+	upstream, err := ts.newKapacitorTask(task)
+	if err != nil {
+		// A task that fails to compile feeds no tasks.
+		return nil, nil
+	}
+	written := make(map[DBRP]bool)
+	for _, out := range kapacitor.LoopbackOutputs(upstream) {
+		written[DBRP{Database: out.Database, RetentionPolicy: out.RetentionPolicy}] = true
+	}
+	if len(written) == 0 {
+		return nil, nil
+	}
+	tasks, err := ts.allTasks()
+	if err != nil {
+		return nil, err
+	}
+	kts := []*kapacitor.Task{upstream}
+	for _, t := range tasks {
+		if t.ID == task.ID || t.Status != Enabled || t.Type != StreamTask {
+			continue
+		}
+		for _, dbrp := range t.DBRPs {
+			if !written[dbrp] {
+				continue
+			}
+			if kt, err := ts.newKapacitorTask(t); err == nil {
+				kts = append(kts, kt)
+			}
+			break
+		}
+	}
+	var enabled []string
+	for _, d := range kapacitor.NewDependencyGraph(kts).Downstream(task.ID) {
+		if d != task.ID {
+			enabled = append(enabled, d)
+		}
+	}
+	if len(enabled) > 0 {
+		ts.diag.DependentTasks(action, task.ID, enabled)
+	}
+	return enabled, nil
+}
@@ -0,0 +1,472 @@
+package task_store
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"path"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/influxdata/kapacitor/auth"
+	"github.com/influxdata/kapacitor/client/v1"
+	"github.com/influxdata/kapacitor/keyvalue"
+	"github.com/influxdata/kapacitor/services/httpd"
+	"github.com/influxdata/kapacitor/tick"
+	"github.com/pkg/errors"
+	"github.com/pmezard/go-difflib/difflib"
+)
+
+const (
+	revisionsPath = "revisions"
+	diffPath      = "diff"
+	rollbackPath  = "rollback"
+)
+
+// splitTaskResource splits a path of the form ID/RESOURCE into its parts.
+// Returns false if the path does not reference a sub resource of a task.
+func splitTaskResource(p string) (string, string, bool) {
+	i := strings.IndexByte(p, '/')
+	if i < 0 {
+		return p, "", false
+	}
+	return p[:i], p[i+1:], true
+}
+
+func (ts *Service) taskRevisionsLink(id string) client.Link {
+	return client.Link{Relation: client.Self, Href: path.Join(httpd.BasePath, tasksPath, id, revisionsPath)}
+}
+
+func (ts *Service) taskRevisionLink(id string, revision int) client.Link {
+	return client.Link{Relation: client.Self, Href: path.Join(httpd.BasePath, tasksPath, id, revisionsPath, strconv.Itoa(revision))}
+}
+
+// revisionAuthor returns the name to record as the author of a revision.
+// When authentication is disabled all requests are made as the admin user, which is not recorded.
+func revisionAuthor(user auth.User) string {
+	if user.Name() == auth.AdminUser.Name() {
+		return ""
+	}
+	return user.Name()
+}
+
+// sameDefinition reports whether two tasks have the same definition.
+// Only changes to the definition of a task create a new revision,
+// changes to its status or ID do not.
+func sameDefinition(a, b Task) bool {
+	return a.Type == b.Type &&
+		a.TICKscript == b.TICKscript &&
+		a.TemplateID == b.TemplateID &&
+		reflect.DeepEqual(a.DBRPs, b.DBRPs) &&
+		reflect.DeepEqual(a.Vars, b.Vars)
+}
+
+func newTaskRevision(t Task, author string, created time.Time) TaskRevision {
+	return TaskRevision{
+		TaskID:     t.ID,
+		Revision:   t.Revision,
+		Type:       t.Type,
+		DBRPs:      t.DBRPs,
+		TICKscript: t.TICKscript,
+		TemplateID: t.TemplateID,
+		Vars:       t.Vars,
+		Author:     author,
+		Created:    created,
+	}
+}
+
+// recordRevision saves the current definition of the task as a revision
+// and prunes any revisions beyond the configured retention.
+func (ts *Service) recordRevision(t Task, author string, created time.Time) error {
+	if err := ts.revisions.Create(newTaskRevision(t, author, created)); err != nil {
+		return errors.Wrapf(err, "failed to record revision %d of task %s", t.Revision, t.ID)
+	}
+	if ts.revisionRetention == 0 {
+		return nil
+	}
+	revisions, err := ts.revisions.List(t.ID, 0, -1)
+	if err != nil {
+		return errors.Wrapf(err, "failed to list revisions of task %s", t.ID)
+	}
+	if len(revisions) <= ts.revisionRetention {
+		return nil
+	}
+	for _, r := range revisions[ts.revisionRetention:] {
+		if err := ts.revisions.Delete(r.TaskID, r.Revision); err != nil {
+			return errors.Wrapf(err, "failed to prune revision %d of task %s", r.Revision, t.ID)
+		}
+	}
+	return nil
+}
+
+// moveRevisions moves the revision history of a task to a new task ID.
+func (ts *Service) moveRevisions(oldID, newID string) error {
+	revisions, err := ts.revisions.List(oldID, 0, -1)
+	if err != nil {
+		return err
+	}
+	if err := ts.revisions.DeleteAll(newID); err != nil {
+		return err
+	}
+	for _, r := range revisions {
+		r.TaskID = newID
+		if err := ts.revisions.Create(r); err != nil {
+			return err
+		}
+	}
+	return ts.revisions.DeleteAll(oldID)
+}
+
+func (ts *Service) convertTaskRevision(r TaskRevision, scriptFormat string) (client.TaskRevision, error) {
+	var typ client.TaskType
+	switch r.Type {
+	case StreamTask:
+		typ = client.StreamTask
+	case BatchTask:
+		typ = client.BatchTask
+	default:
+		return client.TaskRevision{}, fmt.Errorf("invalid task type %v", r.Type)
+	}
+
+	dbrps := make([]client.DBRP, len(r.DBRPs))
+	for i, dbrp := range r.DBRPs {
+		dbrps[i] = client.DBRP{
+			Database:        dbrp.Database,
+			RetentionPolicy: dbrp.RetentionPolicy,
+		}
+	}
+
+	vars, err := ts.convertToClientVars(r.Vars)
+	if err != nil {
+		return client.TaskRevision{}, err
+	}
+
+	script := r.TICKscript
+	if scriptFormat == "formatted" {
+		// Format TICKscript
+		formatted, err := tick.Format(script)
+		if err == nil {
+			// Only format if it succeeded.
+			// Otherwise a change in syntax may prevent revision retrieval.
+			script = formatted
+		}
+	}
+
+	return client.TaskRevision{
+		Link:       ts.taskRevisionLink(r.TaskID, r.Revision),
+		TaskID:     r.TaskID,
+		Revision:   r.Revision,
+		TemplateID: r.TemplateID,
+		Type:       typ,
+		DBRPs:      dbrps,
+		TICKscript: script,
+		Vars:       vars,
+		Author:     r.Author,
+		Created:    r.Created,
+	}, nil
+}
+
+// handleTaskRevisions serves the revisions sub resources of a task.
+// The list of revisions is at /tasks/ID/revisions, a single revision at /tasks/ID/revisions/REVISION
+// and the diff between two revisions at /tasks/ID/revisions/diff.
+func (ts *Service) handleTaskRevisions(w http.ResponseWriter, r *http.Request, id, resource string) {
+	parts := strings.Split(resource, "/")
+	if parts[0] != revisionsPath || len(parts) > 2 {
+		httpd.HttpError(w, fmt.Sprintf("unknown resource %q for task %s", resource, id), true, http.StatusNotFound)
+		return
+	}
+
+	task, err := ts.tasks.Get(id)
+	if err != nil {
+		httpd.HttpError(w, err.Error(), true, http.StatusNotFound)
+		return
+	}
+
+	scriptFormat := r.URL.Query().Get("script-format")
+	switch scriptFormat {
+	case "":
+		scriptFormat = "formatted"
+	case "formatted", "raw":
+	default:
+		httpd.HttpError(w, fmt.Sprintf("invalid script-format parameter %q", scriptFormat), true, http.StatusBadRequest)
+		return
+	}
+
+	switch {
+	case len(parts) == 1:
+		ts.handleListTaskRevisions(w, r, task.ID, scriptFormat)
+	case parts[1] == diffPath:
+		ts.handleDiffTaskRevisions(w, r, task)
+	default:
+		revision, err := strconv.Atoi(parts[1])
+		if err != nil {
+			httpd.HttpError(w, fmt.Sprintf("invalid revision %q must be an integer", parts[1]), true, http.StatusBadRequest)
+			return
+		}
+		raw, err := ts.revisions.Get(task.ID, revision)
+		if err != nil {
+			httpd.HttpError(w, err.Error(), true, http.StatusNotFound)
+			return
+		}
+		rev, err := ts.convertTaskRevision(raw, scriptFormat)
+		if err != nil {
+			httpd.HttpError(w, fmt.Sprintf("invalid revision stored in db: %s", err.Error()), true, http.StatusInternalServerError)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+		w.Write(httpd.MarshalJSON(rev, true))
+	}
+}
+
+func (ts *Service) handleListTaskRevisions(w http.ResponseWriter, r *http.Request, id, scriptFormat string) {
+	var err error
+	offset := int64(0)
+	offsetStr := r.URL.Query().Get("offset")
+	if offsetStr != "" {
+		offset, err = strconv.ParseInt(offsetStr, 10, 64)
+		if err != nil {
+			httpd.HttpError(w, fmt.Sprintf("invalid offset parameter %q must be an integer: %s", offsetStr, err), true, http.StatusBadRequest)
+			return
+		}
+	}
+
+	limit := int64(100)
+	limitStr := r.URL.Query().Get("limit")
+	if limitStr != "" {
+		limit, err = strconv.ParseInt(limitStr, 10, 64)
+		if err != nil {
+			httpd.HttpError(w, fmt.Sprintf("invalid limit parameter %q must be an integer: %s", limitStr, err), true, http.StatusBadRequest)
+			return
+		}
+	}
+
+	rawRevisions, err := ts.revisions.List(id, int(offset), int(limit))
+	if err != nil {
+		httpd.HttpError(w, fmt.Sprintf("failed to list revisions of task %s: %s", id, err), true, http.StatusInternalServerError)
+		return
+	}
+	revisions := client.TaskRevisions{
+		Link:      ts.taskRevisionsLink(id),
+		Revisions: make([]client.TaskRevision, len(rawRevisions)),
+	}
+	for i, raw := range rawRevisions {
+		revisions.Revisions[i], err = ts.convertTaskRevision(raw, scriptFormat)
+		if err != nil {
+			httpd.HttpError(w, fmt.Sprintf("invalid revision stored in db: %s", err.Error()), true, http.StatusInternalServerError)
+			return
+		}
+	}
+	w.WriteHeader(http.StatusOK)
+	w.Write(httpd.MarshalJSON(revisions, true))
+}
+
+func (ts *Service) handleDiffTaskRevisions(w http.ResponseWriter, r *http.Request, task Task) {
+	parseRevision := func(name string, def int) (int, bool) {
+		str := r.URL.Query().Get(name)
+		if str == "" {
+			return def, true
+		}
+		revision, err := strconv.Atoi(str)
+		if err != nil {
+			httpd.HttpError(w, fmt.Sprintf("invalid %s parameter %q must be an integer: %s", name, str, err), true, http.StatusBadRequest)
+			return 0, false
+		}
+		return revision, true
+	}
+	to, ok := parseRevision("to", task.Revision)
+	if !ok {
+		return
+	}
+	from, ok := parseRevision("from", to-1)
+	if !ok {
+		return
+	}
+
+	fromRev, err := ts.revisions.Get(task.ID, from)
+	if err != nil {
+		httpd.HttpError(w, fmt.Sprintf("revision %d: %s", from, err), true, http.StatusNotFound)
+		return
+	}
+	toRev, err := ts.revisions.Get(task.ID, to)
+	if err != nil {
+		httpd.HttpError(w, fmt.Sprintf("revision %d: %s", to, err), true, http.StatusNotFound)
+		return
+	}
+
+	fromText, err := ts.revisionText(fromRev)
+	if err != nil {
+		httpd.HttpError(w, err.Error(), true, http.StatusInternalServerError)
+		return
+	}
+	toText, err := ts.revisionText(toRev)
+	if err != nil {
+		httpd.HttpError(w, err.Error(), true, http.StatusInternalServerError)
+		return
+	}
+	diff, err := difflib.GetUnifiedDiffString(difflib.UnifiedDiff{
+		A:        difflib.SplitLines(fromText),
+		B:        difflib.SplitLines(toText),
+		FromFile: fmt.Sprintf("%s revision %d", task.ID, from),
+		ToFile:   fmt.Sprintf("%s revision %d", task.ID, to),
+		Context:  3,
+	})
+	if err != nil {
+		httpd.HttpError(w, fmt.Sprintf("failed to diff revisions: %s", err), true, http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	w.Write(httpd.MarshalJSON(client.TaskRevisionDiff{
+		Link: client.Link{Relation: client.Self, Href: path.Join(httpd.BasePath, tasksPath, task.ID, revisionsPath, diffPath)},
+		From: from,
+		To:   to,
+		Diff: diff,
+	}, true))
+}
+
+// revisionText renders the definition of a revision as text suitable for a line based diff.
+func (ts *Service) revisionText(r TaskRevision) (string, error) {
+	rev, err := ts.convertTaskRevision(r, "formatted")
+	if err != nil {
+		return "", err
+	}
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "type: %v\n", rev.Type)
+	fmt.Fprintf(&buf, "template-id: %s\n", rev.TemplateID)
+	fmt.Fprintf(&buf, "dbrps: %v\n", rev.DBRPs)
+	if len(rev.Vars) > 0 {
+		buf.WriteString("vars:\n")
+		names := make([]string, 0, len(rev.Vars))
+		for name := range rev.Vars {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			v := rev.Vars[name]
+			value, err := json.Marshal(v.Value)
+			if err != nil {
+				return "", errors.Wrapf(err, "invalid var %s", name)
+			}
+			fmt.Fprintf(&buf, "  %s %v = %s\n", name, v.Type, value)
+		}
+	}
+	buf.WriteString("script:\n")
+	buf.WriteString(rev.TICKscript)
+	if !strings.HasSuffix(rev.TICKscript, "\n") {
+		buf.WriteString("\n")
+	}
+	return buf.String(), nil
+}
+
+// handleTaskAction serves actions that can be taken on a task, i.e. /tasks/ID/rollback
+func (ts *Service) handleTaskAction(w http.ResponseWriter, r *http.Request, user auth.User) {
+	p, err := ts.taskIDFromPath(r.URL.Path)
+	if err != nil {
+		httpd.HttpError(w, err.Error(), true, http.StatusBadRequest)
+		return
+	}
+	id, action, _ := splitTaskResource(p)
+	switch action {
+	case rollbackPath:
+		ts.handleRollbackTask(w, r, user, id)
+	default:
+		httpd.HttpError(w, fmt.Sprintf("unknown action %q for task %s", action, id), true, http.StatusNotFound)
+	}
+}
+
+func (ts *Service) handleRollbackTask(w http.ResponseWriter, r *http.Request, user auth.User, id string) {
+	opts := client.RollbackTaskOptions{}
+	dec := json.NewDecoder(r.Body)
+	if err := dec.Decode(&opts); err != nil {
+		httpd.HttpError(w, "invalid JSON", true, http.StatusBadRequest)
+		return
+	}
+
+	original, err := ts.tasks.Get(id)
+	if err != nil {
+		httpd.HttpError(w, "task does not exist, cannot rollback", true, http.StatusNotFound)
+		return
+	}
+	rev, err := ts.revisions.Get(id, opts.Revision)
+	if err != nil {
+		httpd.HttpError(w, fmt.Sprintf("revision %d: %s", opts.Revision, err), true, http.StatusNotFound)
+		return
+	}
+
+	updated := original
+	updated.Type = rev.Type
+	updated.DBRPs = rev.DBRPs
+	updated.TICKscript = rev.TICKscript
+	updated.TemplateID = rev.TemplateID
+	updated.Vars = rev.Vars
+
+	if sameDefinition(original, updated) {
+		// Nothing to change, return the task as is.
+		t, err := ts.convertTask(original, "formatted", "attributes", ts.TaskMasterLookup.Main())
+		if err != nil {
+			httpd.HttpError(w, err.Error(), true, http.StatusInternalServerError)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+		w.Write(httpd.MarshalJSON(t, true))
+		return
+	}
+
+	// Validate task
+	if _, err := ts.newKapacitorTask(updated); err != nil {
+		httpd.HttpError(w, fmt.Sprintf("revision %d is no longer a valid task: %s", rev.Revision, err), true, http.StatusBadRequest)
+		return
+	}
+
+	if original.TemplateID != updated.TemplateID {
+		if updated.TemplateID != "" {
+			if _, err := ts.templates.Get(updated.TemplateID); err != nil {
+				httpd.HttpError(w, fmt.Sprintf("template %s of revision %d: %s", updated.TemplateID, rev.Revision, err), true, http.StatusBadRequest)
+				return
+			}
+			if err := ts.templates.AssociateTask(updated.TemplateID, updated.ID); err != nil {
+				httpd.HttpError(w, fmt.Sprintf("failed to associate task with template: %s", err), true, http.StatusInternalServerError)
+				return
+			}
+		}
+		if original.TemplateID != "" {
+			if err := ts.templates.DisassociateTask(original.TemplateID, original.ID); err != nil {
+				ts.diag.Error("failed to disassociate task from template", err,
+					keyvalue.KV("template", original.TemplateID), keyvalue.KV("task", original.ID))
+			}
+		}
+	}
+
+	now := time.Now()
+	updated.Modified = now
+	updated.Revision = original.Revision + 1
+	if err := ts.tasks.Replace(updated); err != nil {
+		httpd.HttpError(w, fmt.Sprintf("failed to replace task definition: %s", err.Error()), true, http.StatusInternalServerError)
+		return
+	}
+	if err := ts.recordRevision(updated, revisionAuthor(user), now); err != nil {
+		httpd.HttpError(w, err.Error(), true, http.StatusInternalServerError)
+		return
+	}
+
+	if updated.Status == Enabled {
+		// Restart the task with the rolled back definition
+		ts.stopTask(updated.ID)
+		if err := ts.startTask(updated); err != nil {
+			httpd.HttpError(w, err.Error(), true, http.StatusInternalServerError)
+			return
+		}
+	}
+
+	t, err := ts.convertTask(updated, "formatted", "attributes", ts.TaskMasterLookup.Main())
+	if err != nil {
+		httpd.HttpError(w, err.Error(), true, http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+	w.Write(httpd.MarshalJSON(t, true))
+}
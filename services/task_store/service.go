@@ -10,13 +10,20 @@ import (
 	"path/filepath"
 	"regexp"
 	"strconv"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/boltdb/bolt"
 	"github.com/influxdata/kapacitor"
+	"github.com/influxdata/kapacitor/auth"
 	"github.com/influxdata/kapacitor/client/v1"
+	"github.com/influxdata/kapacitor/edge"
 	"github.com/influxdata/kapacitor/keyvalue"
+	"github.com/influxdata/kapacitor/labels"
 	"github.com/influxdata/kapacitor/server/vars"
+	"github.com/influxdata/kapacitor/services/alert"
+	"github.com/influxdata/kapacitor/services/cluster"
 	"github.com/influxdata/kapacitor/services/httpd"
 	"github.com/influxdata/kapacitor/services/storage"
 	"github.com/influxdata/kapacitor/tick"
@@ -45,16 +52,30 @@ type Diagnostic interface {
 
 	AlreadyMigrated(entity, id string)
 	Migrated(entity, id string)
+
+	DependentTasks(action, taskID string, downstream []string)
 }
 
 type Service struct {
-	oldDBDir         string
-	tasks            TaskDAO
-	templates        TemplateDAO
-	snapshots        SnapshotDAO
-	routes           []httpd.Route
-	snapshotInterval time.Duration
-	StorageService   interface {
+	oldDBDir          string
+	tasks             TaskDAO
+	templates         TemplateDAO
+	snapshots         SnapshotDAO
+	revisions         TaskRevisionDAO
+	routes            []httpd.Route
+	snapshotInterval  time.Duration
+	revisionRetention int
+	// Serializes syncs.
+	syncMu sync.Mutex
+	// Serializes starting and stopping the tasks, and guards started, streams and closed.
+	startedMu sync.Mutex
+	// started are the enabled tasks this member started, as they were when started.
+	started map[string]Task
+	// streams are the DBRPs of the enabled stream tasks of all members.
+	streams map[string][]cluster.DBRP
+	closed  bool
+
+	StorageService interface {
 		Store(namespace string) storage.Interface
 		Register(name string, store storage.StoreActioner)
 	}
@@ -68,6 +89,19 @@ type Service struct {
 		Set(*kapacitor.TaskMaster)
 		Delete(*kapacitor.TaskMaster)
 	}
+	AlertService interface {
+		HandlerSpec(topic, handler string) (alert.HandlerSpec, bool, error)
+		AllHandlerSpecs() ([]alert.HandlerSpec, error)
+		ValidateHandlerSpec(spec alert.HandlerSpec) error
+		RegisterHandlerSpec(spec alert.HandlerSpec) error
+		UpdateHandlerSpec(oldSpec, newSpec alert.HandlerSpec) error
+		DeregisterHandlerSpec(topic, handler string) error
+	}
+	ClusterService interface {
+		Owns(taskID string) bool
+		Watch(namespace string, f func())
+		SetStreamTasks(streams map[string][]cluster.DBRP)
+	}
 
 	diag Diagnostic
 }
@@ -80,15 +114,22 @@ type taskStore struct {
 
 func NewService(conf Config, d Diagnostic) *Service {
 	return &Service{
-		snapshotInterval: time.Duration(conf.SnapshotInterval),
-		diag:             d,
-		oldDBDir:         conf.Dir,
+		snapshotInterval:  time.Duration(conf.SnapshotInterval),
+		revisionRetention: conf.RevisionRetention,
+		diag:              d,
+		oldDBDir:          conf.Dir,
+		started:           make(map[string]Task),
+		streams:           make(map[string][]cluster.DBRP),
 	}
 }
 
 const (
 	// Public name for the task storage layer
 	tasksAPIName = "tasks"
+	// Public name for the template storage layer
+	templatesAPIName = "templates"
+	// Public name for the task revisions storage layer
+	taskRevisionsAPIName = "task-revisions"
 	// The storage namespace for all task data.
 	taskNamespace = "task_store"
 )
@@ -102,8 +143,19 @@ func (ts *Service) Open() error {
 	}
 	ts.tasks = tasksDAO
 	ts.StorageService.Register(tasksAPIName, ts.tasks)
-	ts.templates = newTemplateKV(store)
+	templatesDAO, err := newTemplateKV(store)
+	if err != nil {
+		return err
+	}
+	ts.templates = templatesDAO
+	ts.StorageService.Register(templatesAPIName, ts.templates)
 	ts.snapshots = newSnapshotKV(store)
+	revisionsDAO, err := newTaskRevisionKV(store)
+	if err != nil {
+		return err
+	}
+	ts.revisions = revisionsDAO
+	ts.StorageService.Register(taskRevisionsAPIName, ts.revisions)
 
 	// Perform migration to new storage service.
 	if err := ts.migrate(); err != nil {
@@ -133,6 +185,11 @@ func (ts *Service) Open() error {
 			Pattern:     tasksPathAnchored,
 			HandlerFunc: ts.handleUpdateTask,
 		},
+		{
+			Method:      "POST",
+			Pattern:     tasksPathAnchored,
+			HandlerFunc: ts.handleTaskAction,
+		},
 		{
 			Method:      "GET",
 			Pattern:     tasksPath,
@@ -174,6 +231,16 @@ func (ts *Service) Open() error {
 			Pattern:     templatesPath,
 			HandlerFunc: ts.handleCreateTemplate,
 		},
+		{
+			Method:      "POST",
+			Pattern:     syncPath,
+			HandlerFunc: ts.handleSync,
+		},
+		{
+			Method:      "GET",
+			Pattern:     dependenciesPath,
+			HandlerFunc: ts.handleTaskDependencies,
+		},
 	}
 
 	err = ts.HTTPDService.AddRoutes(ts.routes)
@@ -216,6 +283,10 @@ func (ts *Service) Open() error {
 	vars.NumTasksVar.Set(numTasks)
 	vars.NumEnabledTasksVar.Set(numEnabledTasks)
 
+	// Follow the tasks changed by other members and the reassignment of the tasks.
+	ts.ClusterService.Watch(taskNamespace, ts.syncOwnedTasks)
+	ts.syncOwnedTasks()
+
 	return nil
 }
 
@@ -375,6 +446,9 @@ func (ts *Service) migrate() error {
 }
 
 func (ts *Service) Close() error {
+	ts.startedMu.Lock()
+	ts.closed = true
+	ts.startedMu.Unlock()
 	ts.HTTPDService.DelRoutes(ts.routes)
 	return nil
 }
@@ -432,6 +506,10 @@ func (ts *Service) handleTask(w http.ResponseWriter, r *http.Request) {
 		httpd.HttpError(w, err.Error(), true, http.StatusBadRequest)
 		return
 	}
+	if id, resource, ok := splitTaskResource(id); ok {
+		ts.handleTaskRevisions(w, r, id, resource)
+		return
+	}
 
 	raw, err := ts.tasks.Get(id)
 	if err != nil {
@@ -497,6 +575,9 @@ var allTaskFields = []string{
 	"modified",
 	"last-enabled",
 	"vars",
+	"revision",
+	"labels",
+	"limits",
 }
 
 const tasksBasePathAnchored = httpd.BasePath + tasksPathAnchored
@@ -567,7 +648,18 @@ func (ts *Service) handleListTasks(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
-	rawTasks, err := ts.tasks.List(pattern, int(offset), int(limit))
+	selector, err := labels.ParseSelector(r.URL.Query().Get("labels"))
+	if err != nil {
+		httpd.HttpError(w, fmt.Sprintf("invalid labels parameter: %s", err), true, http.StatusBadRequest)
+		return
+	}
+
+	var rawTasks []Task
+	if len(selector) > 0 {
+		rawTasks, err = ts.tasks.ListByLabels(pattern, selector, int(offset), int(limit))
+	} else {
+		rawTasks, err = ts.tasks.List(pattern, int(offset), int(limit))
+	}
 	if err != nil {
 		httpd.HttpError(w, fmt.Sprintf("failed to list tasks with pattern %q: %s", pattern, err), true, http.StatusBadRequest)
 		return
@@ -651,6 +743,12 @@ func (ts *Service) handleListTasks(w http.ResponseWriter, r *http.Request) {
 				value = task.Modified
 			case "last-enabled":
 				value = task.LastEnabled
+			case "revision":
+				value = task.Revision
+			case "labels":
+				value = task.Labels
+			case "limits":
+				value = convertToClientLimits(task.Limits)
 			case "vars":
 				vars, err := ts.convertToClientVars(task.Vars)
 				if err != nil {
@@ -675,7 +773,7 @@ func (ts *Service) handleListTasks(w http.ResponseWriter, r *http.Request) {
 
 var validTaskID = regexp.MustCompile(`^[-\._\p{L}0-9]+$`)
 
-func (ts *Service) handleCreateTask(w http.ResponseWriter, r *http.Request) {
+func (ts *Service) handleCreateTask(w http.ResponseWriter, r *http.Request, user auth.User) {
 	task := client.CreateTaskOptions{}
 	dec := json.NewDecoder(r.Body)
 	err := dec.Decode(&task)
@@ -773,6 +871,22 @@ func (ts *Service) handleCreateTask(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// Set labels
+	if err := labels.Validate(task.Labels); err != nil {
+		httpd.HttpError(w, err.Error(), true, http.StatusBadRequest)
+		return
+	}
+	newTask.Labels = labels.Copy(task.Labels)
+
+	// Set limits
+	if task.Limits != nil {
+		newTask.Limits, err = convertToServiceLimits(*task.Limits)
+		if err != nil {
+			httpd.HttpError(w, err.Error(), true, http.StatusBadRequest)
+			return
+		}
+	}
+
 	// Validate task
 	_, err = ts.newKapacitorTask(newTask)
 	if err != nil {
@@ -783,6 +897,7 @@ func (ts *Service) handleCreateTask(w http.ResponseWriter, r *http.Request) {
 	now := time.Now()
 	newTask.Created = now
 	newTask.Modified = now
+	newTask.Revision = 1
 	if newTask.Status == Enabled {
 		newTask.LastEnabled = now
 	}
@@ -794,6 +909,16 @@ func (ts *Service) handleCreateTask(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// Remove any revisions left over from a previous task with the same ID.
+	if err := ts.revisions.DeleteAll(newTask.ID); err != nil {
+		httpd.HttpError(w, fmt.Sprintf("failed to delete old task revisions: %s", err), true, http.StatusInternalServerError)
+		return
+	}
+	if err := ts.recordRevision(newTask, revisionAuthor(user), now); err != nil {
+		httpd.HttpError(w, err.Error(), true, http.StatusInternalServerError)
+		return
+	}
+
 	// Count new task
 	vars.NumTasksVar.Add(1)
 	if newTask.Status == Enabled {
@@ -817,7 +942,7 @@ func (ts *Service) handleCreateTask(w http.ResponseWriter, r *http.Request) {
 	w.Write(httpd.MarshalJSON(t, true))
 }
 
-func (ts *Service) handleUpdateTask(w http.ResponseWriter, r *http.Request) {
+func (ts *Service) handleUpdateTask(w http.ResponseWriter, r *http.Request, user auth.User) {
 	id, err := ts.taskIDFromPath(r.URL.Path)
 	if err != nil {
 		httpd.HttpError(w, err.Error(), true, http.StatusBadRequest)
@@ -838,6 +963,7 @@ func (ts *Service) handleUpdateTask(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	updated := original
+	var dependents []string
 
 	// Set ID if changing
 	if task.ID != "" {
@@ -915,6 +1041,25 @@ func (ts *Service) handleUpdateTask(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
+	// Set labels
+	if task.Labels != nil {
+		if err := labels.Validate(task.Labels); err != nil {
+			httpd.HttpError(w, err.Error(), true, http.StatusBadRequest)
+			return
+		}
+		updated.Labels = labels.Copy(task.Labels)
+	}
+
+	// Set limits
+	if task.Limits != nil {
+		updated.Limits, err = convertToServiceLimits(*task.Limits)
+		if err != nil {
+			httpd.HttpError(w, err.Error(), true, http.StatusBadRequest)
+			return
+		}
+	}
+	limitsChanged := updated.Limits != original.Limits
+
 	// Validate task
 	_, err = ts.newKapacitorTask(updated)
 	if err != nil {
@@ -927,6 +1072,18 @@ func (ts *Service) handleUpdateTask(w http.ResponseWriter, r *http.Request) {
 	if statusChanged && updated.Status == Enabled {
 		updated.LastEnabled = now
 	}
+	definitionChanged := !sameDefinition(original, updated)
+	if definitionChanged {
+		// Tasks defined before revisions were recorded first get their current definition as revision 1.
+		if original.Revision == 0 {
+			original.Revision = 1
+			if err := ts.recordRevision(original, "", original.Modified); err != nil {
+				httpd.HttpError(w, err.Error(), true, http.StatusInternalServerError)
+				return
+			}
+		}
+		updated.Revision = original.Revision + 1
+	}
 	if original.ID != updated.ID {
 		// Task ID changed delete and re-create.
 		if err := ts.tasks.Create(updated); err != nil {
@@ -941,6 +1098,14 @@ func (ts *Service) handleUpdateTask(w http.ResponseWriter, r *http.Request) {
 				keyvalue.KV("newID", updated.ID),
 			)
 		}
+		if err := ts.moveRevisions(original.ID, updated.ID); err != nil {
+			ts.diag.Error(
+				"failed to move task revisions during ID change",
+				err,
+				keyvalue.KV("oldID", original.ID),
+				keyvalue.KV("newID", updated.ID),
+			)
+		}
 		if original.Status == Enabled && updated.Status == Enabled {
 			// Stop task and start it under new name
 			ts.stopTask(original.ID)
@@ -956,6 +1121,13 @@ func (ts *Service) handleUpdateTask(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
+	if definitionChanged {
+		if err := ts.recordRevision(updated, revisionAuthor(user), now); err != nil {
+			httpd.HttpError(w, err.Error(), true, http.StatusInternalServerError)
+			return
+		}
+	}
+
 	if statusChanged {
 		// Enable/Disable task
 		switch updated.Status {
@@ -969,6 +1141,16 @@ func (ts *Service) handleUpdateTask(w http.ResponseWriter, r *http.Request) {
 		case Disabled:
 			vars.NumEnabledTasksVar.Add(-1)
 			ts.stopTask(original.ID)
+			if dependents, err = ts.dependentTasks("disabled", updated); err != nil {
+				ts.diag.Error("failed to find dependent tasks", err, keyvalue.KV("task", updated.ID))
+			}
+		}
+	} else if limitsChanged && updated.Status == Enabled && original.ID == updated.ID {
+		// Restart the task so that the new limits apply.
+		ts.stopTask(updated.ID)
+		if err := ts.startTask(updated); err != nil {
+			httpd.HttpError(w, err.Error(), true, http.StatusInternalServerError)
+			return
 		}
 	}
 
@@ -977,6 +1159,7 @@ func (ts *Service) handleUpdateTask(w http.ResponseWriter, r *http.Request) {
 		httpd.HttpError(w, err.Error(), true, http.StatusInternalServerError)
 		return
 	}
+	t.DependentTasks = dependents
 	w.WriteHeader(http.StatusOK)
 	w.Write(httpd.MarshalJSON(t, true))
 }
@@ -1063,6 +1246,9 @@ func (ts *Service) convertTask(t Task, scriptFormat, dotView string, tm *kapacit
 		Created:        t.Created,
 		Modified:       t.Modified,
 		LastEnabled:    t.LastEnabled,
+		Revision:       t.Revision,
+		Labels:         t.Labels,
+		Limits:         convertToClientLimits(t.Limits),
 		Error:          errMsg,
 	}, nil
 }
@@ -1323,11 +1509,20 @@ func (ts *Service) handleDeleteTask(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	var dependents []string
+	if task, err := ts.tasks.Get(id); err == nil && task.Status == Enabled {
+		if dependents, err = ts.dependentTasks("deleted", task); err != nil {
+			ts.diag.Error("failed to find dependent tasks", err, keyvalue.KV("task", id))
+		}
+	}
 	err = ts.deleteTask(id)
 	if err != nil {
 		httpd.HttpError(w, err.Error(), true, http.StatusInternalServerError)
 		return
 	}
+	if len(dependents) > 0 {
+		w.Header().Set(dependentTasksHeader, strings.Join(dependents, ","))
+	}
 	w.WriteHeader(http.StatusNoContent)
 }
 
@@ -1335,6 +1530,11 @@ func (ts *Service) deleteTask(id string) error {
 	// Delete associated snapshot
 	ts.snapshots.Delete(id)
 
+	// Delete revision history
+	if err := ts.revisions.DeleteAll(id); err != nil {
+		ts.diag.Error("failed to delete task revisions", err, keyvalue.KV("task", id))
+	}
+
 	// Delete task object
 	task, err := ts.tasks.Get(id)
 	if err != nil {
@@ -1352,7 +1552,7 @@ func (ts *Service) deleteTask(id string) error {
 	vars.NumTasksVar.Add(-1)
 	if task.Status == Enabled {
 		vars.NumEnabledTasksVar.Add(-1)
-		ts.TaskMasterLookup.Main().DeleteTask(id)
+		ts.discardTask(id)
 	}
 	return ts.tasks.Delete(id)
 }
@@ -1400,6 +1600,7 @@ func (ts *Service) convertTemplate(t Template, scriptFormat string) (client.Temp
 		Created:    t.Created,
 		Modified:   t.Modified,
 		Vars:       vars,
+		Labels:     t.Labels,
 	}, nil
 }
 
@@ -1444,6 +1645,7 @@ var allTemplateFields = []string{
 	"error",
 	"created",
 	"modified",
+	"labels",
 }
 
 const templatesBasePathAnchored = httpd.BasePath + templatesPathAnchored
@@ -1503,7 +1705,18 @@ func (ts *Service) handleListTemplates(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
-	rawTemplates, err := ts.templates.List(pattern, int(offset), int(limit))
+	selector, err := labels.ParseSelector(r.URL.Query().Get("labels"))
+	if err != nil {
+		httpd.HttpError(w, fmt.Sprintf("invalid labels parameter: %s", err), true, http.StatusBadRequest)
+		return
+	}
+
+	var rawTemplates []Template
+	if len(selector) > 0 {
+		rawTemplates, err = ts.templates.ListByLabels(pattern, selector, int(offset), int(limit))
+	} else {
+		rawTemplates, err = ts.templates.List(pattern, int(offset), int(limit))
+	}
 	if err != nil {
 		httpd.HttpError(w, fmt.Sprintf("failed to list templates with pattern %q: %s", pattern, err), true, http.StatusBadRequest)
 		return
@@ -1555,6 +1768,8 @@ func (ts *Service) handleListTemplates(w http.ResponseWriter, r *http.Request) {
 				value = template.Created
 			case "modified":
 				value = template.Modified
+			case "labels":
+				value = template.Labels
 			default:
 				httpd.HttpError(w, fmt.Sprintf("unsupported field %q", field), true, http.StatusBadRequest)
 				return
@@ -1617,6 +1832,13 @@ func (ts *Service) handleCreateTemplate(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
+	// Set labels
+	if err := labels.Validate(template.Labels); err != nil {
+		httpd.HttpError(w, err.Error(), true, http.StatusBadRequest)
+		return
+	}
+	newTemplate.Labels = labels.Copy(template.Labels)
+
 	// Validate template
 	_, err = ts.templateTask(newTemplate)
 	if err != nil {
@@ -1645,7 +1867,7 @@ func (ts *Service) handleCreateTemplate(w http.ResponseWriter, r *http.Request)
 	w.Write(httpd.MarshalJSON(t, true))
 }
 
-func (ts *Service) handleUpdateTemplate(w http.ResponseWriter, r *http.Request) {
+func (ts *Service) handleUpdateTemplate(w http.ResponseWriter, r *http.Request, user auth.User) {
 	id, err := ts.templateIDFromPath(r.URL.Path)
 	if err != nil {
 		httpd.HttpError(w, err.Error(), true, http.StatusBadRequest)
@@ -1685,6 +1907,15 @@ func (ts *Service) handleUpdateTemplate(w http.ResponseWriter, r *http.Request)
 		updated.TICKscript = template.TICKscript
 	}
 
+	// Set labels
+	if template.Labels != nil {
+		if err := labels.Validate(template.Labels); err != nil {
+			httpd.HttpError(w, err.Error(), true, http.StatusBadRequest)
+			return
+		}
+		updated.Labels = labels.Copy(template.Labels)
+	}
+
 	// Validate template
 	_, err = ts.templateTask(updated)
 	if err != nil {
@@ -1720,7 +1951,7 @@ func (ts *Service) handleUpdateTemplate(w http.ResponseWriter, r *http.Request)
 	}
 
 	// Update all associated tasks
-	err = ts.updateAllAssociatedTasks(original, updated, taskIds)
+	err = ts.updateAllAssociatedTasks(original, updated, taskIds, revisionAuthor(user))
 	if err != nil {
 		httpd.HttpError(w, err.Error(), true, http.StatusInternalServerError)
 		return
@@ -1739,7 +1970,7 @@ func (ts *Service) handleUpdateTemplate(w http.ResponseWriter, r *http.Request)
 
 // Update all associated tasks. Return the first error if any.
 // Rollsback all updated tasks if an error occurs.
-func (ts *Service) updateAllAssociatedTasks(old, new Template, taskIds []string) error {
+func (ts *Service) updateAllAssociatedTasks(old, new Template, taskIds []string, author string) error {
 	var i int
 	// Setup rollback function
 	defer func() {
@@ -1757,12 +1988,21 @@ func (ts *Service) updateAllAssociatedTasks(old, new Template, taskIds []string)
 				}
 				continue
 			}
-			task.TemplateID = old.ID
-			task.TICKscript = old.TICKscript
-			task.Type = old.Type
-			if err := ts.tasks.Replace(task); err != nil {
+			rolledBack := task
+			rolledBack.TemplateID = old.ID
+			rolledBack.TICKscript = old.TICKscript
+			rolledBack.Type = old.Type
+			if !sameDefinition(task, rolledBack) {
+				rolledBack.Revision++
+			}
+			if err := ts.tasks.Replace(rolledBack); err != nil {
 				ts.diag.Error("error rolling back associated task", err, keyvalue.KV("task", taskId))
+			} else if rolledBack.Revision != task.Revision {
+				if err := ts.recordRevision(rolledBack, author, time.Now()); err != nil {
+					ts.diag.Error("error recording revision of rolled back task", err, keyvalue.KV("task", taskId))
+				}
 			}
+			task = rolledBack
 			if task.Status == Enabled {
 				ts.stopTask(taskId)
 				err := ts.startTask(task)
@@ -1788,12 +2028,29 @@ func (ts *Service) updateAllAssociatedTasks(old, new Template, taskIds []string)
 				return fmt.Errorf("error updating task association %s: %s", taskId, err)
 			}
 		}
-		task.TemplateID = new.ID
-		task.TICKscript = new.TICKscript
-		task.Type = new.Type
+		updated := task
+		updated.TemplateID = new.ID
+		updated.TICKscript = new.TICKscript
+		updated.Type = new.Type
+		definitionChanged := !sameDefinition(task, updated)
+		if definitionChanged {
+			if task.Revision == 0 {
+				task.Revision = 1
+				if err := ts.recordRevision(task, "", task.Modified); err != nil {
+					return fmt.Errorf("error recording revision of associated task %s: %s", taskId, err)
+				}
+			}
+			updated.Revision = task.Revision + 1
+		}
+		task = updated
 		if err := ts.tasks.Replace(task); err != nil {
 			return fmt.Errorf("error updating associated task %s: %s", taskId, err)
 		}
+		if definitionChanged {
+			if err := ts.recordRevision(task, author, time.Now()); err != nil {
+				return fmt.Errorf("error recording revision of associated task %s: %s", taskId, err)
+			}
+		}
 		if task.Status == Enabled {
 			ts.stopTask(taskId)
 			err := ts.startTask(task)
@@ -1838,13 +2095,72 @@ func (ts *Service) newKapacitorTask(task Task) (*kapacitor.Task, error) {
 	if err != nil {
 		return nil, err
 	}
-	return ts.TaskMasterLookup.Main().NewTask(task.ID,
+	t, err := ts.TaskMasterLookup.Main().NewTask(task.ID,
 		task.TICKscript,
 		tt,
 		dbrps,
 		ts.snapshotInterval,
 		vars,
 	)
+	if err != nil {
+		return nil, err
+	}
+	t.Limits = kapacitor.TaskLimits{
+		MaxGroups:       task.Limits.MaxGroups,
+		MaxWindowPoints: task.Limits.MaxWindowPoints,
+		MaxJoinBuffer:   task.Limits.MaxJoinBuffer,
+	}
+	switch task.Limits.Policy {
+	case DropPolicy:
+		t.Limits.Policy = edge.DropPolicy
+	case EvictPolicy:
+		t.Limits.Policy = edge.EvictPolicy
+	case StopPolicy:
+		t.Limits.Policy = edge.StopPolicy
+	}
+	return t, nil
+}
+
+func convertToServiceLimits(l client.TaskLimits) (TaskLimits, error) {
+	if l.MaxGroups < 0 || l.MaxWindowPoints < 0 || l.MaxJoinBuffer < 0 {
+		return TaskLimits{}, errors.New("task limits must not be negative")
+	}
+	limits := TaskLimits{
+		MaxGroups:       l.MaxGroups,
+		MaxWindowPoints: l.MaxWindowPoints,
+		MaxJoinBuffer:   l.MaxJoinBuffer,
+	}
+	switch l.Policy {
+	case "", client.DropLimitPolicy:
+		limits.Policy = DropPolicy
+	case client.EvictLimitPolicy:
+		limits.Policy = EvictPolicy
+	case client.StopLimitPolicy:
+		limits.Policy = StopPolicy
+	default:
+		return TaskLimits{}, fmt.Errorf("unknown limit policy %q, must be one of %q, %q or %q", l.Policy, client.DropLimitPolicy, client.EvictLimitPolicy, client.StopLimitPolicy)
+	}
+	return limits, nil
+}
+
+func convertToClientLimits(l TaskLimits) client.TaskLimits {
+	if l == (TaskLimits{}) {
+		return client.TaskLimits{}
+	}
+	limits := client.TaskLimits{
+		MaxGroups:       l.MaxGroups,
+		MaxWindowPoints: l.MaxWindowPoints,
+		MaxJoinBuffer:   l.MaxJoinBuffer,
+	}
+	switch l.Policy {
+	case DropPolicy:
+		limits.Policy = client.DropLimitPolicy
+	case EvictPolicy:
+		limits.Policy = client.EvictLimitPolicy
+	case StopPolicy:
+		limits.Policy = client.StopLimitPolicy
+	}
+	return limits
 }
 
 func (ts *Service) templateTask(template Template) (*kapacitor.Template, error) {
@@ -1865,7 +2181,24 @@ func (ts *Service) templateTask(template Template) (*kapacitor.Template, error)
 	return t, nil
 }
 
+// startTask starts the enabled task, unless it is assigned to another member or already started.
 func (ts *Service) startTask(task Task) error {
+	ts.startedMu.Lock()
+	defer ts.startedMu.Unlock()
+	ts.setStreamTask(task.ID, streamDBRPs(task))
+	return ts.start(task)
+}
+
+// start starts the task, it must be called with startedMu held.
+func (ts *Service) start(task Task) error {
+	if !ts.ClusterService.Owns(task.ID) {
+		// The task is started by the member it is assigned to.
+		return nil
+	}
+	if _, ok := ts.started[task.ID]; ok {
+		return nil
+	}
+
 	t, err := ts.newKapacitorTask(task)
 	if err != nil {
 		return err
@@ -1890,6 +2223,7 @@ func (ts *Service) startTask(task Task) error {
 			return err
 		}
 	}
+	ts.started[task.ID] = task
 
 	go func() {
 		// Wait for task to finish
@@ -1911,10 +2245,34 @@ func (ts *Service) startTask(task Task) error {
 	return nil
 }
 
+// stopTask stops the task once it is disabled.
 func (ts *Service) stopTask(id string) {
+	ts.startedMu.Lock()
+	defer ts.startedMu.Unlock()
+	ts.setStreamTask(id, nil)
+	ts.stop(id)
+}
+
+// stop stops the task, it must be called with startedMu held.
+func (ts *Service) stop(id string) {
+	delete(ts.started, id)
 	ts.TaskMasterLookup.Main().StopTask(id)
 }
 
+// discardTask stops the task and removes it from the task master once it is deleted.
+func (ts *Service) discardTask(id string) {
+	ts.startedMu.Lock()
+	defer ts.startedMu.Unlock()
+	ts.setStreamTask(id, nil)
+	ts.discard(id)
+}
+
+// discard removes the task from the task master, it must be called with startedMu held.
+func (ts *Service) discard(id string) {
+	delete(ts.started, id)
+	ts.TaskMasterLookup.Main().DeleteTask(id)
+}
+
 // Save last error from task.
 func (ts *Service) saveLastError(id string, errStr string) error {
 	task, err := ts.tasks.Get(id)
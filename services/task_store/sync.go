@@ -0,0 +1,816 @@
+package task_store
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/influxdata/kapacitor/auth"
+	"github.com/influxdata/kapacitor/client/v1"
+	"github.com/influxdata/kapacitor/keyvalue"
+	"github.com/influxdata/kapacitor/labels"
+	"github.com/influxdata/kapacitor/server/vars"
+	"github.com/influxdata/kapacitor/services/alert"
+	"github.com/influxdata/kapacitor/services/httpd"
+	"github.com/pkg/errors"
+	"github.com/pmezard/go-difflib/difflib"
+)
+
+const (
+	syncPath = "/sync"
+
+	syncKindTemplate = "template"
+	syncKindTask     = "task"
+	syncKindHandler  = "handler"
+
+	// Page size used when reading all tasks or templates.
+	syncListLimit = 100
+)
+
+type syncTemplateChange struct {
+	action string
+	old    Template
+	new    Template
+}
+
+type syncTaskChange struct {
+	action string
+	old    Task
+	new    Task
+}
+
+type syncHandlerChange struct {
+	action string
+	old    alert.HandlerSpec
+	new    alert.HandlerSpec
+}
+
+// syncPlan is the set of changes needed to make the managed objects match a sync.
+type syncPlan struct {
+	templates []syncTemplateChange
+	tasks     []syncTaskChange
+	handlers  []syncHandlerChange
+}
+
+func (ts *Service) handleSync(w http.ResponseWriter, r *http.Request, user auth.User) {
+	opts := client.SyncOptions{}
+	if err := json.NewDecoder(r.Body).Decode(&opts); err != nil {
+		httpd.HttpError(w, "invalid JSON", true, http.StatusBadRequest)
+		return
+	}
+	if opts.Manager == "" {
+		opts.Manager = client.DefaultSyncManager
+	}
+	if err := labels.Validate(map[string]string{client.ManagedByLabel: opts.Manager}); err != nil {
+		httpd.HttpError(w, fmt.Sprintf("invalid manager: %s", err), true, http.StatusBadRequest)
+		return
+	}
+
+	// Only one sync may plan and apply at a time.
+	ts.syncMu.Lock()
+	defer ts.syncMu.Unlock()
+
+	plan, err := ts.planSync(opts)
+	if err != nil {
+		httpd.HttpError(w, err.Error(), true, http.StatusBadRequest)
+		return
+	}
+	actions, err := ts.syncActions(plan)
+	if err != nil {
+		httpd.HttpError(w, err.Error(), true, http.StatusInternalServerError)
+		return
+	}
+	if !opts.DryRun {
+		if err := ts.applySync(plan, revisionAuthor(user)); err != nil {
+			httpd.HttpError(w, fmt.Sprintf("sync failed, all changes have been rolled back: %s", err), true, http.StatusInternalServerError)
+			return
+		}
+	}
+
+	w.WriteHeader(http.StatusOK)
+	w.Write(httpd.MarshalJSON(client.SyncResult{
+		Manager: opts.Manager,
+		Applied: !opts.DryRun,
+		Actions: actions,
+	}, true))
+}
+
+// managedLabels returns the labels of a synced object including the managed by label.
+func managedLabels(l client.Labels, manager string) (map[string]string, error) {
+	if err := labels.Validate(l); err != nil {
+		return nil, err
+	}
+	m := make(map[string]string, len(l)+1)
+	for k, v := range l {
+		m[k] = v
+	}
+	m[client.ManagedByLabel] = manager
+	return m, nil
+}
+
+func isManagedBy(l map[string]string, manager string) bool {
+	return l[client.ManagedByLabel] == manager
+}
+
+// planSync validates the definitions of a sync and compares them with the current state.
+func (ts *Service) planSync(opts client.SyncOptions) (syncPlan, error) {
+	plan := syncPlan{}
+
+	// Templates
+	templates := make(map[string]Template, len(opts.Templates))
+	for _, o := range opts.Templates {
+		if !validTemplateID.MatchString(o.ID) {
+			return plan, fmt.Errorf("template ID must contain only letters, numbers, '-', '.' and '_'. %q", o.ID)
+		}
+		if _, ok := templates[o.ID]; ok {
+			return plan, fmt.Errorf("template %s is defined more than once", o.ID)
+		}
+		t := Template{
+			ID:         o.ID,
+			TICKscript: o.TICKscript,
+		}
+		switch o.Type {
+		case client.StreamTask:
+			t.Type = StreamTask
+		case client.BatchTask:
+			t.Type = BatchTask
+		default:
+			return plan, fmt.Errorf("template %s: unknown type %q", o.ID, o.Type)
+		}
+		if t.TICKscript == "" {
+			return plan, fmt.Errorf("template %s: must provide TICKscript", o.ID)
+		}
+		l, err := managedLabels(o.Labels, opts.Manager)
+		if err != nil {
+			return plan, errors.Wrapf(err, "template %s", o.ID)
+		}
+		t.Labels = l
+		if _, err := ts.templateTask(t); err != nil {
+			return plan, errors.Wrapf(err, "template %s: invalid TICKscript", o.ID)
+		}
+		templates[t.ID] = t
+
+		existing, err := ts.templates.Get(t.ID)
+		switch {
+		case err == ErrNoTemplateExists:
+			plan.templates = append(plan.templates, syncTemplateChange{action: client.SyncCreate, new: t})
+		case err != nil:
+			return plan, errors.Wrapf(err, "failed to get template %s", t.ID)
+		case existing.Type != t.Type || existing.TICKscript != t.TICKscript || !labels.Equal(existing.Labels, t.Labels):
+			updated := existing
+			updated.Type = t.Type
+			updated.TICKscript = t.TICKscript
+			updated.Labels = t.Labels
+			plan.templates = append(plan.templates, syncTemplateChange{action: client.SyncUpdate, old: existing, new: updated})
+		}
+	}
+
+	// Tasks
+	tasks := make(map[string]bool, len(opts.Tasks))
+	for _, o := range opts.Tasks {
+		if !validTaskID.MatchString(o.ID) {
+			return plan, fmt.Errorf("task ID must contain only letters, numbers, '-', '.' and '_'. %q", o.ID)
+		}
+		if tasks[o.ID] {
+			return plan, fmt.Errorf("task %s is defined more than once", o.ID)
+		}
+		tasks[o.ID] = true
+		t := Task{
+			ID:         o.ID,
+			TemplateID: o.TemplateID,
+		}
+		if o.TemplateID != "" {
+			template, ok := templates[o.TemplateID]
+			if !ok {
+				var err error
+				template, err = ts.templates.Get(o.TemplateID)
+				if err != nil {
+					return plan, fmt.Errorf("task %s: unknown template %s: err: %s", o.ID, o.TemplateID, err)
+				}
+			}
+			t.Type = template.Type
+			t.TICKscript = template.TICKscript
+		} else {
+			switch o.Type {
+			case client.StreamTask:
+				t.Type = StreamTask
+			case client.BatchTask:
+				t.Type = BatchTask
+			default:
+				return plan, fmt.Errorf("task %s: unknown type %q", o.ID, o.Type)
+			}
+			t.TICKscript = o.TICKscript
+			if t.TICKscript == "" {
+				return plan, fmt.Errorf("task %s: must provide TICKscript", o.ID)
+			}
+		}
+		t.DBRPs = make([]DBRP, len(o.DBRPs))
+		for i, dbrp := range o.DBRPs {
+			t.DBRPs[i] = DBRP{
+				Database:        dbrp.Database,
+				RetentionPolicy: dbrp.RetentionPolicy,
+			}
+		}
+		if len(t.DBRPs) == 0 {
+			return plan, fmt.Errorf("task %s: must provide at least one database and retention policy.", o.ID)
+		}
+		// Synced tasks are enabled unless stated otherwise.
+		switch o.Status {
+		case client.Disabled:
+			t.Status = Disabled
+		default:
+			t.Status = Enabled
+		}
+		var err error
+		t.Vars, err = ts.convertToServiceVars(o.Vars)
+		if err != nil {
+			return plan, errors.Wrapf(err, "task %s", o.ID)
+		}
+		t.Labels, err = managedLabels(o.Labels, opts.Manager)
+		if err != nil {
+			return plan, errors.Wrapf(err, "task %s", o.ID)
+		}
+		if o.Limits != nil {
+			t.Limits, err = convertToServiceLimits(*o.Limits)
+			if err != nil {
+				return plan, errors.Wrapf(err, "task %s", o.ID)
+			}
+		}
+		if _, err := ts.newKapacitorTask(t); err != nil {
+			return plan, errors.Wrapf(err, "task %s: invalid TICKscript", o.ID)
+		}
+
+		existing, err := ts.tasks.Get(t.ID)
+		switch {
+		case err == ErrNoTaskExists:
+			plan.tasks = append(plan.tasks, syncTaskChange{action: client.SyncCreate, new: t})
+		case err != nil:
+			return plan, errors.Wrapf(err, "failed to get task %s", t.ID)
+		case !sameDefinition(existing, t) || existing.Status != t.Status || !labels.Equal(existing.Labels, t.Labels) || existing.Limits != t.Limits:
+			updated := existing
+			updated.Type = t.Type
+			updated.DBRPs = t.DBRPs
+			updated.TICKscript = t.TICKscript
+			updated.TemplateID = t.TemplateID
+			updated.Vars = t.Vars
+			updated.Status = t.Status
+			updated.Labels = t.Labels
+			updated.Limits = t.Limits
+			plan.tasks = append(plan.tasks, syncTaskChange{action: client.SyncUpdate, old: existing, new: updated})
+		}
+	}
+
+	// Handlers
+	handlers := make(map[string]bool, len(opts.Handlers))
+	for _, o := range opts.Handlers {
+		spec := alert.HandlerSpec{
+			ID:      o.ID,
+			Topic:   o.Topic,
+			Kind:    o.Kind,
+			Options: o.Options,
+			Match:   o.Match,
+		}
+		if handlers[spec.ObjectID()] {
+			return plan, fmt.Errorf("handler %s of topic %s is defined more than once", o.ID, o.Topic)
+		}
+		handlers[spec.ObjectID()] = true
+		var err error
+		spec.Labels, err = managedLabels(o.Labels, opts.Manager)
+		if err != nil {
+			return plan, errors.Wrapf(err, "handler %s of topic %s", o.ID, o.Topic)
+		}
+		if err := ts.AlertService.ValidateHandlerSpec(spec); err != nil {
+			return plan, errors.Wrapf(err, "handler %s of topic %s", o.ID, o.Topic)
+		}
+
+		existing, ok, err := ts.AlertService.HandlerSpec(spec.Topic, spec.ID)
+		switch {
+		case err != nil:
+			return plan, errors.Wrapf(err, "failed to get handler %s of topic %s", spec.ID, spec.Topic)
+		case !ok:
+			plan.handlers = append(plan.handlers, syncHandlerChange{action: client.SyncCreate, new: spec})
+		case existing.Kind != spec.Kind || existing.Match != spec.Match || !reflect.DeepEqual(existing.Options, spec.Options) || !labels.Equal(existing.Labels, spec.Labels):
+			plan.handlers = append(plan.handlers, syncHandlerChange{action: client.SyncUpdate, old: existing, new: spec})
+		}
+	}
+
+	// Delete managed objects that are no longer defined.
+	existingTasks, err := ts.allTasks()
+	if err != nil {
+		return plan, err
+	}
+	// Tasks that use a template after the sync is applied.
+	templateUsers := make(map[string][]string)
+	for _, t := range existingTasks {
+		if !tasks[t.ID] && isManagedBy(t.Labels, opts.Manager) {
+			plan.tasks = append(plan.tasks, syncTaskChange{action: client.SyncDelete, old: t})
+			continue
+		}
+		if !tasks[t.ID] && t.TemplateID != "" {
+			templateUsers[t.TemplateID] = append(templateUsers[t.TemplateID], t.ID)
+		}
+	}
+	for _, o := range opts.Tasks {
+		if o.TemplateID != "" {
+			templateUsers[o.TemplateID] = append(templateUsers[o.TemplateID], o.ID)
+		}
+	}
+	existingTemplates, err := ts.allTemplates()
+	if err != nil {
+		return plan, err
+	}
+	for _, t := range existingTemplates {
+		if _, ok := templates[t.ID]; ok || !isManagedBy(t.Labels, opts.Manager) {
+			continue
+		}
+		if users := templateUsers[t.ID]; len(users) > 0 {
+			return plan, fmt.Errorf("cannot delete template %s, it is used by tasks %s", t.ID, strings.Join(users, ", "))
+		}
+		plan.templates = append(plan.templates, syncTemplateChange{action: client.SyncDelete, old: t})
+	}
+	existingHandlers, err := ts.AlertService.AllHandlerSpecs()
+	if err != nil {
+		return plan, errors.Wrap(err, "failed to list handlers")
+	}
+	sort.Sort(handlerSpecList(existingHandlers))
+	for _, h := range existingHandlers {
+		if !handlers[h.ObjectID()] && isManagedBy(h.Labels, opts.Manager) {
+			plan.handlers = append(plan.handlers, syncHandlerChange{action: client.SyncDelete, old: h})
+		}
+	}
+	return plan, nil
+}
+
+type handlerSpecList []alert.HandlerSpec
+
+func (l handlerSpecList) Len() int           { return len(l) }
+func (l handlerSpecList) Less(i, j int) bool { return l[i].ObjectID() < l[j].ObjectID() }
+func (l handlerSpecList) Swap(i, j int)      { l[i], l[j] = l[j], l[i] }
+
+func (ts *Service) allTasks() ([]Task, error) {
+	var all []Task
+	for offset := 0; ; offset += syncListLimit {
+		tasks, err := ts.tasks.List("*", offset, syncListLimit)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to list tasks")
+		}
+		all = append(all, tasks...)
+		if len(tasks) != syncListLimit {
+			return all, nil
+		}
+	}
+}
+
+func (ts *Service) allTemplates() ([]Template, error) {
+	var all []Template
+	for offset := 0; ; offset += syncListLimit {
+		templates, err := ts.templates.List("*", offset, syncListLimit)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to list templates")
+		}
+		all = append(all, templates...)
+		if len(templates) != syncListLimit {
+			return all, nil
+		}
+	}
+}
+
+// syncActions describes the changes of the plan grouped by kind.
+func (ts *Service) syncActions(plan syncPlan) ([]client.SyncAction, error) {
+	actions := make([]client.SyncAction, 0, len(plan.templates)+len(plan.tasks)+len(plan.handlers))
+	for _, c := range plan.templates {
+		a := client.SyncAction{Kind: syncKindTemplate, Action: c.action, ID: c.new.ID}
+		if c.action == client.SyncDelete {
+			a.ID = c.old.ID
+		}
+		if c.action == client.SyncUpdate {
+			diff, err := syncDiff(a.ID, templateText(c.old), templateText(c.new))
+			if err != nil {
+				return nil, err
+			}
+			a.Diff = diff
+		}
+		actions = append(actions, a)
+	}
+	for _, c := range plan.tasks {
+		a := client.SyncAction{Kind: syncKindTask, Action: c.action, ID: c.new.ID}
+		if c.action == client.SyncDelete {
+			a.ID = c.old.ID
+		}
+		if c.action == client.SyncUpdate {
+			oldText, err := ts.syncTaskText(c.old)
+			if err != nil {
+				return nil, err
+			}
+			newText, err := ts.syncTaskText(c.new)
+			if err != nil {
+				return nil, err
+			}
+			a.Diff, err = syncDiff(a.ID, oldText, newText)
+			if err != nil {
+				return nil, err
+			}
+		}
+		actions = append(actions, a)
+	}
+	for _, c := range plan.handlers {
+		a := client.SyncAction{Kind: syncKindHandler, Action: c.action, ID: c.new.ID, Topic: c.new.Topic}
+		if c.action == client.SyncDelete {
+			a.ID = c.old.ID
+			a.Topic = c.old.Topic
+		}
+		if c.action == client.SyncUpdate {
+			oldText, err := handlerText(c.old)
+			if err != nil {
+				return nil, err
+			}
+			newText, err := handlerText(c.new)
+			if err != nil {
+				return nil, err
+			}
+			a.Diff, err = syncDiff(a.ID, oldText, newText)
+			if err != nil {
+				return nil, err
+			}
+		}
+		actions = append(actions, a)
+	}
+	return actions, nil
+}
+
+func syncDiff(id, from, to string) (string, error) {
+	diff, err := difflib.GetUnifiedDiffString(difflib.UnifiedDiff{
+		A:        difflib.SplitLines(from),
+		B:        difflib.SplitLines(to),
+		FromFile: id + " current",
+		ToFile:   id + " desired",
+		Context:  3,
+	})
+	return diff, errors.Wrapf(err, "failed to diff %s", id)
+}
+
+func templateText(t Template) string {
+	var buf bytes.Buffer
+	typ := client.StreamTask
+	if t.Type == BatchTask {
+		typ = client.BatchTask
+	}
+	fmt.Fprintf(&buf, "type: %v\n", typ)
+	fmt.Fprintf(&buf, "labels: %v\n", client.Labels(t.Labels))
+	buf.WriteString("script:\n")
+	buf.WriteString(t.TICKscript)
+	if !strings.HasSuffix(t.TICKscript, "\n") {
+		buf.WriteString("\n")
+	}
+	return buf.String()
+}
+
+func (ts *Service) syncTaskText(t Task) (string, error) {
+	text, err := ts.revisionText(newTaskRevision(t, "", t.Modified))
+	if err != nil {
+		return "", err
+	}
+	status := client.Disabled
+	if t.Status == Enabled {
+		status = client.Enabled
+	}
+	return fmt.Sprintf("status: %v\nlabels: %v\nlimits: %v\n%s", status, client.Labels(t.Labels), convertToClientLimits(t.Limits), text), nil
+}
+
+func handlerText(h alert.HandlerSpec) (string, error) {
+	data, err := json.MarshalIndent(h, "", "  ")
+	if err != nil {
+		return "", errors.Wrapf(err, "failed to marshal handler %s", h.ID)
+	}
+	return string(data) + "\n", nil
+}
+
+// applySync applies all changes of the plan.
+// If any change fails all previously applied changes are reverted.
+func (ts *Service) applySync(plan syncPlan, author string) (err error) {
+	var undo []func() error
+	defer func() {
+		if err == nil {
+			return
+		}
+		for i := len(undo) - 1; i >= 0; i-- {
+			if err := undo[i](); err != nil {
+				ts.diag.Error("failed to roll back sync change", err)
+			}
+		}
+	}()
+
+	// Create and update templates before the tasks that use them.
+	for _, c := range plan.templates {
+		c := c
+		switch c.action {
+		case client.SyncCreate:
+			if err := ts.syncCreateTemplate(c.new); err != nil {
+				return err
+			}
+			undo = append(undo, func() error { return ts.templates.Delete(c.new.ID) })
+		case client.SyncUpdate:
+			if err := ts.syncUpdateTemplate(c.old, c.new, author); err != nil {
+				return err
+			}
+			undo = append(undo, func() error { return ts.syncUpdateTemplate(c.new, c.old, author) })
+		}
+	}
+	for _, c := range plan.tasks {
+		c := c
+		switch c.action {
+		case client.SyncCreate:
+			undoCreate, err := ts.syncCreateTask(c.new, author)
+			if undoCreate != nil {
+				undo = append(undo, undoCreate)
+			}
+			if err != nil {
+				return err
+			}
+		case client.SyncUpdate:
+			// Updated templates may already have changed the task.
+			current, err := ts.tasks.Get(c.new.ID)
+			if err != nil {
+				return errors.Wrapf(err, "failed to get task %s", c.new.ID)
+			}
+			updated := current
+			updated.Type = c.new.Type
+			updated.DBRPs = c.new.DBRPs
+			updated.TICKscript = c.new.TICKscript
+			updated.TemplateID = c.new.TemplateID
+			updated.Vars = c.new.Vars
+			updated.Status = c.new.Status
+			updated.Labels = c.new.Labels
+			updated.Limits = c.new.Limits
+			undoUpdate, err := ts.syncUpdateTask(current, updated, author)
+			if undoUpdate != nil {
+				undo = append(undo, undoUpdate)
+			}
+			if err != nil {
+				return err
+			}
+		}
+	}
+	for _, c := range plan.handlers {
+		c := c
+		switch c.action {
+		case client.SyncCreate:
+			if err := ts.AlertService.RegisterHandlerSpec(c.new); err != nil {
+				return errors.Wrapf(err, "failed to create handler %s of topic %s", c.new.ID, c.new.Topic)
+			}
+			undo = append(undo, func() error { return ts.AlertService.DeregisterHandlerSpec(c.new.Topic, c.new.ID) })
+		case client.SyncUpdate:
+			if err := ts.AlertService.UpdateHandlerSpec(c.old, c.new); err != nil {
+				return errors.Wrapf(err, "failed to update handler %s of topic %s", c.new.ID, c.new.Topic)
+			}
+			undo = append(undo, func() error { return ts.AlertService.UpdateHandlerSpec(c.new, c.old) })
+		}
+	}
+
+	// Delete tasks before the templates they use.
+	for _, c := range plan.tasks {
+		if c.action != client.SyncDelete {
+			continue
+		}
+		undoDelete, err := ts.syncDeleteTask(c.old)
+		if err != nil {
+			return err
+		}
+		undo = append(undo, undoDelete)
+	}
+	for _, c := range plan.templates {
+		c := c
+		if c.action != client.SyncDelete {
+			continue
+		}
+		if err := ts.templates.Delete(c.old.ID); err != nil {
+			return errors.Wrapf(err, "failed to delete template %s", c.old.ID)
+		}
+		undo = append(undo, func() error { return ts.templates.Create(c.old) })
+	}
+	for _, c := range plan.handlers {
+		c := c
+		if c.action != client.SyncDelete {
+			continue
+		}
+		if err := ts.AlertService.DeregisterHandlerSpec(c.old.Topic, c.old.ID); err != nil {
+			return errors.Wrapf(err, "failed to delete handler %s of topic %s", c.old.ID, c.old.Topic)
+		}
+		undo = append(undo, func() error { return ts.AlertService.RegisterHandlerSpec(c.old) })
+	}
+	return nil
+}
+
+func (ts *Service) syncCreateTemplate(t Template) error {
+	now := time.Now()
+	t.Created = now
+	t.Modified = now
+	return errors.Wrapf(ts.templates.Create(t), "failed to create template %s", t.ID)
+}
+
+func (ts *Service) syncUpdateTemplate(original, updated Template, author string) error {
+	taskIds, err := ts.templates.ListAssociatedTasks(original.ID)
+	if err != nil {
+		return errors.Wrapf(err, "error getting associated tasks for template %s", original.ID)
+	}
+	updated.Modified = time.Now()
+	if err := ts.templates.Replace(updated); err != nil {
+		return errors.Wrapf(err, "failed to replace template %s", updated.ID)
+	}
+	if err := ts.updateAllAssociatedTasks(original, updated, taskIds, author); err != nil {
+		if rerr := ts.templates.Replace(original); rerr != nil {
+			ts.diag.Error("failed to restore template", rerr, keyvalue.KV("template", original.ID))
+		}
+		return err
+	}
+	return nil
+}
+
+// syncCreateTask creates and starts the task.
+// The returned function reverts the creation, it is returned as soon as the task is stored
+// so that the task is deleted again if a later step fails.
+func (ts *Service) syncCreateTask(t Task, author string) (func() error, error) {
+	if t.TemplateID != "" {
+		if err := ts.templates.AssociateTask(t.TemplateID, t.ID); err != nil {
+			return nil, errors.Wrapf(err, "failed to associate task %s with template", t.ID)
+		}
+	}
+	now := time.Now()
+	t.Created = now
+	t.Modified = now
+	t.Revision = 1
+	if t.Status == Enabled {
+		t.LastEnabled = now
+	}
+	if err := ts.tasks.Create(t); err != nil {
+		if t.TemplateID != "" {
+			if derr := ts.templates.DisassociateTask(t.TemplateID, t.ID); derr != nil {
+				ts.diag.Error("failed to disassociate task from template", derr,
+					keyvalue.KV("template", t.TemplateID), keyvalue.KV("task", t.ID))
+			}
+		}
+		return nil, errors.Wrapf(err, "failed to create task %s", t.ID)
+	}
+	vars.NumTasksVar.Add(1)
+	if t.Status == Enabled {
+		vars.NumEnabledTasksVar.Add(1)
+	}
+	// Deleting the task also reverts the counters, the template association and the revisions.
+	undo := func() error { return ts.deleteTask(t.ID) }
+	if err := ts.revisions.DeleteAll(t.ID); err != nil {
+		return undo, errors.Wrapf(err, "failed to delete old revisions of task %s", t.ID)
+	}
+	if err := ts.recordRevision(t, author, now); err != nil {
+		return undo, err
+	}
+	if t.Status == Enabled {
+		if err := ts.startTask(t); err != nil {
+			return undo, errors.Wrapf(err, "failed to start task %s", t.ID)
+		}
+	}
+	return undo, nil
+}
+
+// syncUpdateTask replaces the task and restarts it if necessary.
+// The returned function reverts the update, it is returned as soon as the task is replaced
+// so that the original task is restored if a later step fails.
+func (ts *Service) syncUpdateTask(original, updated Task, author string) (func() error, error) {
+	now := time.Now()
+	definitionChanged := !sameDefinition(original, updated)
+	if definitionChanged {
+		if original.Revision == 0 {
+			original.Revision = 1
+			if err := ts.recordRevision(original, "", original.Modified); err != nil {
+				return nil, err
+			}
+		}
+		updated.Revision = original.Revision + 1
+	}
+	if updated.Status == Enabled && original.Status != Enabled {
+		updated.LastEnabled = now
+	}
+	updated.Modified = now
+
+	if err := ts.replaceSyncedTask(original, updated); err != nil {
+		return nil, err
+	}
+	revisionRecorded := false
+	undo := func() error {
+		if err := ts.replaceSyncedTask(updated, original); err != nil {
+			return err
+		}
+		if err := ts.restartSyncedTask(updated, original); err != nil {
+			return err
+		}
+		if revisionRecorded {
+			return ts.revisions.Delete(updated.ID, updated.Revision)
+		}
+		return nil
+	}
+	if definitionChanged {
+		if err := ts.recordRevision(updated, author, now); err != nil {
+			return undo, err
+		}
+		revisionRecorded = true
+	}
+	if err := ts.restartSyncedTask(original, updated); err != nil {
+		return undo, err
+	}
+	return undo, nil
+}
+
+// replaceSyncedTask replaces a task with a new definition of the same ID
+// and updates its template association.
+func (ts *Service) replaceSyncedTask(original, updated Task) error {
+	if original.TemplateID != updated.TemplateID {
+		if err := ts.reassociateTask(original, updated); err != nil {
+			return err
+		}
+	}
+	if err := ts.tasks.Replace(updated); err != nil {
+		if original.TemplateID != updated.TemplateID {
+			if aerr := ts.reassociateTask(updated, original); aerr != nil {
+				ts.diag.Error("failed to restore template association", aerr, keyvalue.KV("task", original.ID))
+			}
+		}
+		return errors.Wrapf(err, "failed to replace task %s", updated.ID)
+	}
+	return nil
+}
+
+// reassociateTask moves the task from the template of original to the template of updated.
+func (ts *Service) reassociateTask(original, updated Task) error {
+	if original.TemplateID != "" {
+		if err := ts.templates.DisassociateTask(original.TemplateID, original.ID); err != nil {
+			return errors.Wrapf(err, "failed to disassociate task %s with template", original.ID)
+		}
+	}
+	if updated.TemplateID != "" {
+		if err := ts.templates.AssociateTask(updated.TemplateID, updated.ID); err != nil {
+			if original.TemplateID != "" {
+				if aerr := ts.templates.AssociateTask(original.TemplateID, original.ID); aerr != nil {
+					ts.diag.Error("failed to restore template association", aerr, keyvalue.KV("task", original.ID))
+				}
+			}
+			return errors.Wrapf(err, "failed to associate task %s with template", updated.ID)
+		}
+	}
+	return nil
+}
+
+// restartSyncedTask updates the execution state of a replaced task.
+// The task is restarted only if its definition, status or limits changed.
+func (ts *Service) restartSyncedTask(original, updated Task) error {
+	if sameDefinition(original, updated) && original.Status == updated.Status && original.Limits == updated.Limits {
+		return nil
+	}
+	if original.Status == Enabled {
+		vars.NumEnabledTasksVar.Add(-1)
+		ts.stopTask(original.ID)
+	}
+	if updated.Status == Enabled {
+		vars.NumEnabledTasksVar.Add(1)
+		if err := ts.startTask(updated); err != nil {
+			return errors.Wrapf(err, "failed to start task %s", updated.ID)
+		}
+	}
+	return nil
+}
+
+// syncDeleteTask deletes the task and its revisions.
+// The returned function restores them.
+func (ts *Service) syncDeleteTask(t Task) (func() error, error) {
+	revisions, err := ts.revisions.List(t.ID, 0, -1)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to list revisions of task %s", t.ID)
+	}
+	if err := ts.deleteTask(t.ID); err != nil {
+		return nil, errors.Wrapf(err, "failed to delete task %s", t.ID)
+	}
+	return func() error {
+		if err := ts.tasks.Create(t); err != nil {
+			return err
+		}
+		for _, r := range revisions {
+			if err := ts.revisions.Create(r); err != nil {
+				return err
+			}
+		}
+		if t.TemplateID != "" {
+			if err := ts.templates.AssociateTask(t.TemplateID, t.ID); err != nil {
+				return err
+			}
+		}
+		vars.NumTasksVar.Add(1)
+		if t.Status == Enabled {
+			vars.NumEnabledTasksVar.Add(1)
+			return ts.startTask(t)
+		}
+		return nil
+	}, nil
+}
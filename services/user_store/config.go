@@ -0,0 +1,41 @@
+package user_store
+
+import (
+	"fmt"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+const (
+	DefaultBcryptCost = bcrypt.DefaultCost
+)
+
+type Config struct {
+	// Use the built-in user store instead of treating every user as an admin.
+	Enabled bool `toml:"enabled"`
+	// Cost of the bcrypt password hashes.
+	BcryptCost int `toml:"bcrypt-cost"`
+	// Admin user created when the store has no users,
+	// so that the first users can be created once authentication is enabled.
+	AdminUsername string `toml:"admin-username"`
+	AdminPassword string `toml:"admin-password"`
+}
+
+func NewConfig() Config {
+	return Config{
+		BcryptCost: DefaultBcryptCost,
+	}
+}
+
+func (c Config) Validate() error {
+	if !c.Enabled {
+		return nil
+	}
+	if c.BcryptCost < bcrypt.MinCost || c.BcryptCost > bcrypt.MaxCost {
+		return fmt.Errorf("bcrypt-cost must be between %d and %d", bcrypt.MinCost, bcrypt.MaxCost)
+	}
+	if (c.AdminUsername == "") != (c.AdminPassword == "") {
+		return fmt.Errorf("must set both admin-username and admin-password")
+	}
+	return nil
+}
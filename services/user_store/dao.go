@@ -0,0 +1,339 @@
+package user_store
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+
+	"github.com/influxdata/kapacitor/auth"
+	"github.com/influxdata/kapacitor/services/storage"
+)
+
+var (
+	ErrUserExists   = errors.New("user already exists")
+	ErrNoUserExists = errors.New("no user exists")
+
+	ErrNoSubscriptionTokenExists = errors.New("no subscription token exists")
+)
+
+// Data access object for User data.
+type UserDAO interface {
+	// Retrieve a user
+	Get(name string) (User, error)
+
+	// Create a user.
+	// ErrUserExists is returned if a user already exists with the same name.
+	Create(u User) error
+
+	// Replace an existing user.
+	// ErrNoUserExists is returned if the user does not exist.
+	Replace(u User) error
+
+	// Delete a user.
+	// It is not an error to delete an non-existent user.
+	Delete(name string) error
+
+	// List users matching a pattern.
+	// The pattern is shell/glob matching see https://golang.org/pkg/path/#Match
+	// Offset and limit are pagination bounds. Offset is inclusive starting at index 0.
+	// More results may exist while the number of returned items is equal to limit.
+	List(pattern string, offset, limit int) ([]User, error)
+
+	Rebuild() error
+	Check() (storage.CheckResult, error)
+}
+
+// Data access object for SubscriptionToken data.
+type SubscriptionTokenDAO interface {
+	// Retrieve a token
+	Get(token string) (SubscriptionToken, error)
+
+	// Put a token, replaces any existing token.
+	Put(t SubscriptionToken) error
+
+	// Delete a token.
+	// It is not an error to delete an non-existent token.
+	Delete(token string) error
+
+	// List all tokens.
+	// Offset and limit are pagination bounds. Offset is inclusive starting at index 0.
+	// More results may exist while the number of returned items is equal to limit.
+	List(offset, limit int) ([]SubscriptionToken, error)
+
+	Rebuild() error
+	Check() (storage.CheckResult, error)
+}
+
+//--------------------------------------------------------------------
+// The following structures are stored in a database via JSON encoding.
+// Changes to the structures could break existing data.
+
+const (
+	userVersion1              = 1
+	subscriptionTokenVersion1 = 1
+)
+
+// User is a user of the Kapacitor API.
+type User struct {
+	Name string `json:"name"`
+	// Bcrypt hash of the password.
+	Hash   []byte  `json:"hash"`
+	Admin  bool    `json:"admin"`
+	Grants []Grant `json:"grants,omitempty"`
+}
+
+// Grant gives a user privileges on either an API endpoint or a database.
+type Grant struct {
+	// API path relative to /kapacitor/v1, i.e. /tasks.
+	API string `json:"api,omitempty"`
+	// Database the user may write to through the write endpoints.
+	Database   string           `json:"database,omitempty"`
+	Privileges []auth.Privilege `json:"privileges"`
+}
+
+// Resource returns the auth resource of the grant.
+func (g Grant) Resource() string {
+	if g.Database != "" {
+		return auth.DatabaseResource(g.Database)
+	}
+	return auth.APIResource(g.API)
+}
+
+var validUserName = regexp.MustCompile(`^[-\._@\p{L}0-9]+$`)
+
+func (u User) Validate() error {
+	if !validUserName.MatchString(u.Name) {
+		return fmt.Errorf("user name must contain only letters, numbers, '-', '.', '_' and '@'. %q", u.Name)
+	}
+	if len(u.Hash) == 0 {
+		return errors.New("user must have a password")
+	}
+	for _, g := range u.Grants {
+		if (g.API == "") == (g.Database == "") {
+			return errors.New("grant must have exactly one of api or database")
+		}
+		if len(g.Privileges) == 0 {
+			return fmt.Errorf("grant on %q must have at least one privilege", g.Resource())
+		}
+	}
+	return nil
+}
+
+// AuthUser returns the auth.User with the privileges of all grants.
+func (u User) AuthUser() auth.User {
+	privileges := make(map[string][]auth.Privilege, len(u.Grants))
+	for _, g := range u.Grants {
+		r := g.Resource()
+		privileges[r] = append(privileges[r], g.Privileges...)
+	}
+	return auth.NewUser(u.Name, u.Hash, u.Admin, privileges)
+}
+
+func (u User) ObjectID() string {
+	return u.Name
+}
+
+func (u User) MarshalBinary() ([]byte, error) {
+	if err := u.Validate(); err != nil {
+		return nil, err
+	}
+	return storage.VersionJSONEncode(userVersion1, u)
+}
+
+func (u *User) UnmarshalBinary(data []byte) error {
+	return storage.VersionJSONDecode(data, func(version int, dec *json.Decoder) error {
+		switch version {
+		case userVersion1:
+			return dec.Decode(u)
+		default:
+			return fmt.Errorf("unknown user version %d: cannot decode", version)
+		}
+	})
+}
+
+// SubscriptionToken grants an InfluxDB subscription write access to databases.
+type SubscriptionToken struct {
+	Token string `json:"token"`
+	DBRPs []DBRP `json:"dbrps"`
+}
+
+type DBRP struct {
+	Database        string `json:"db"`
+	RetentionPolicy string `json:"rp"`
+}
+
+// AuthUser returns the auth.User used for writes made with the token.
+func (t SubscriptionToken) AuthUser(name string) auth.User {
+	privileges := map[string][]auth.Privilege{
+		auth.APIResource("/write"): {auth.WritePrivilege},
+	}
+	for _, dbrp := range t.DBRPs {
+		privileges[auth.DatabaseResource(dbrp.Database)] = []auth.Privilege{auth.WritePrivilege}
+	}
+	return auth.NewUser(name, nil, false, privileges)
+}
+
+func (t SubscriptionToken) ObjectID() string {
+	return t.Token
+}
+
+func (t SubscriptionToken) MarshalBinary() ([]byte, error) {
+	return storage.VersionJSONEncode(subscriptionTokenVersion1, t)
+}
+
+func (t *SubscriptionToken) UnmarshalBinary(data []byte) error {
+	return storage.VersionJSONDecode(data, func(version int, dec *json.Decoder) error {
+		switch version {
+		case subscriptionTokenVersion1:
+			return dec.Decode(t)
+		default:
+			return fmt.Errorf("unknown subscription token version %d: cannot decode", version)
+		}
+	})
+}
+
+// Key/Value store based implementation of the UserDAO
+type userKV struct {
+	store *storage.IndexedStore
+}
+
+const (
+	userPrefix              = "users"
+	subscriptionTokenPrefix = "subscription-tokens"
+)
+
+func newUserKV(store storage.Interface) (*userKV, error) {
+	c := storage.DefaultIndexedStoreConfig(userPrefix, func() storage.BinaryObject {
+		return new(User)
+	})
+	istore, err := storage.NewIndexedStore(store, c)
+	if err != nil {
+		return nil, err
+	}
+	return &userKV{
+		store: istore,
+	}, nil
+}
+
+func (kv *userKV) error(err error) error {
+	if err == storage.ErrObjectExists {
+		return ErrUserExists
+	} else if err == storage.ErrNoObjectExists {
+		return ErrNoUserExists
+	}
+	return err
+}
+
+func (kv *userKV) Get(name string) (User, error) {
+	o, err := kv.store.Get(name)
+	if err != nil {
+		return User{}, kv.error(err)
+	}
+	u, ok := o.(*User)
+	if !ok {
+		return User{}, storage.ImpossibleTypeErr(u, o)
+	}
+	return *u, nil
+}
+
+func (kv *userKV) Create(u User) error {
+	return kv.error(kv.store.Create(&u))
+}
+
+func (kv *userKV) Replace(u User) error {
+	return kv.error(kv.store.Replace(&u))
+}
+
+func (kv *userKV) Delete(name string) error {
+	return kv.store.Delete(name)
+}
+
+func (kv *userKV) List(pattern string, offset, limit int) ([]User, error) {
+	objects, err := kv.store.List(storage.DefaultIDIndex, pattern, offset, limit)
+	if err != nil {
+		return nil, err
+	}
+	users := make([]User, len(objects))
+	for i, o := range objects {
+		u, ok := o.(*User)
+		if !ok {
+			return nil, storage.ImpossibleTypeErr(u, o)
+		}
+		users[i] = *u
+	}
+	return users, nil
+}
+
+func (kv *userKV) Rebuild() error {
+	return kv.store.Rebuild()
+}
+
+func (kv *userKV) Check() (storage.CheckResult, error) {
+	return kv.store.Check()
+}
+
+// Key/Value store based implementation of the SubscriptionTokenDAO
+type subscriptionTokenKV struct {
+	store *storage.IndexedStore
+}
+
+func newSubscriptionTokenKV(store storage.Interface) (*subscriptionTokenKV, error) {
+	c := storage.DefaultIndexedStoreConfig(subscriptionTokenPrefix, func() storage.BinaryObject {
+		return new(SubscriptionToken)
+	})
+	istore, err := storage.NewIndexedStore(store, c)
+	if err != nil {
+		return nil, err
+	}
+	return &subscriptionTokenKV{
+		store: istore,
+	}, nil
+}
+
+func (kv *subscriptionTokenKV) Get(token string) (SubscriptionToken, error) {
+	o, err := kv.store.Get(token)
+	if err != nil {
+		if err == storage.ErrNoObjectExists {
+			return SubscriptionToken{}, ErrNoSubscriptionTokenExists
+		}
+		return SubscriptionToken{}, err
+	}
+	t, ok := o.(*SubscriptionToken)
+	if !ok {
+		return SubscriptionToken{}, storage.ImpossibleTypeErr(t, o)
+	}
+	return *t, nil
+}
+
+func (kv *subscriptionTokenKV) Put(t SubscriptionToken) error {
+	return kv.store.Put(&t)
+}
+
+func (kv *subscriptionTokenKV) Delete(token string) error {
+	return kv.store.Delete(token)
+}
+
+func (kv *subscriptionTokenKV) List(offset, limit int) ([]SubscriptionToken, error) {
+	objects, err := kv.store.List(storage.DefaultIDIndex, "", offset, limit)
+	if err != nil {
+		return nil, err
+	}
+	tokens := make([]SubscriptionToken, len(objects))
+	for i, o := range objects {
+		t, ok := o.(*SubscriptionToken)
+		if !ok {
+			return nil, storage.ImpossibleTypeErr(t, o)
+		}
+		tokens[i] = *t
+	}
+	return tokens, nil
+}
+
+func (kv *subscriptionTokenKV) Rebuild() error {
+	return kv.store.Rebuild()
+}
+
+func (kv *subscriptionTokenKV) Check() (storage.CheckResult, error) {
+	return kv.store.Check()
+}
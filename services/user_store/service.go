@@ -0,0 +1,491 @@
+// Package user_store provides an auth.Interface backed by the storage service.
+// Passwords are stored as bcrypt hashes and users are managed through the /users API endpoints.
+package user_store
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"path"
+	"strconv"
+	"sync"
+
+	"github.com/influxdata/kapacitor/auth"
+	"github.com/influxdata/kapacitor/client/v1"
+	"github.com/influxdata/kapacitor/services/httpd"
+	"github.com/influxdata/kapacitor/services/storage"
+	"github.com/pkg/errors"
+	"golang.org/x/crypto/bcrypt"
+)
+
+const (
+	usersPath         = "/users"
+	usersPathAnchored = "/users/"
+	usersBasePath     = httpd.BasePath + usersPathAnchored
+
+	// Public name for the users storage layer
+	usersAPIName = "users"
+	// Public name for the subscription tokens storage layer
+	subscriptionTokensAPIName = "subscription-tokens"
+	// The storage namespace for all user data.
+	userNamespace = "user_store"
+
+	// Page size used when reading all subscription tokens.
+	tokenListLimit = 100
+)
+
+var errAuthenticationFailed = errors.New("authentication failed")
+
+type Diagnostic interface {
+	Error(msg string, err error)
+	CreatedAdminUser(username string)
+}
+
+type Service struct {
+	bcryptCost    int
+	adminUsername string
+	adminPassword string
+
+	users  UserDAO
+	tokens SubscriptionTokenDAO
+	routes []httpd.Route
+
+	mu sync.Mutex
+	// Passwords that have already been checked against a bcrypt hash,
+	// so that each request does not pay the cost of bcrypt.
+	authCache map[string]authCacheEntry
+
+	StorageService interface {
+		Store(namespace string) storage.Interface
+		Register(name string, store storage.StoreActioner)
+	}
+	HTTPDService interface {
+		AddRoutes([]httpd.Route) error
+		DelRoutes([]httpd.Route)
+	}
+
+	diag Diagnostic
+}
+
+type authCacheEntry struct {
+	// The bcrypt hash the password was checked against.
+	hash     []byte
+	password [sha256.Size]byte
+}
+
+func NewService(c Config, d Diagnostic) *Service {
+	return &Service{
+		bcryptCost:    c.BcryptCost,
+		adminUsername: c.AdminUsername,
+		adminPassword: c.AdminPassword,
+		authCache:     make(map[string]authCacheEntry),
+		diag:          d,
+	}
+}
+
+func (s *Service) Open() error {
+	store := s.StorageService.Store(userNamespace)
+	users, err := newUserKV(store)
+	if err != nil {
+		return err
+	}
+	s.users = users
+	s.StorageService.Register(usersAPIName, s.users)
+	tokens, err := newSubscriptionTokenKV(store)
+	if err != nil {
+		return err
+	}
+	s.tokens = tokens
+	s.StorageService.Register(subscriptionTokensAPIName, s.tokens)
+
+	if err := s.createAdminUser(); err != nil {
+		return err
+	}
+
+	s.routes = []httpd.Route{
+		{
+			Method:      "GET",
+			Pattern:     usersPathAnchored,
+			HandlerFunc: s.handleUser,
+		},
+		{
+			Method:      "PATCH",
+			Pattern:     usersPathAnchored,
+			HandlerFunc: s.handleUpdateUser,
+		},
+		{
+			Method:      "DELETE",
+			Pattern:     usersPathAnchored,
+			HandlerFunc: s.handleDeleteUser,
+		},
+		{
+			// Satisfy CORS checks.
+			Method:      "OPTIONS",
+			Pattern:     usersPathAnchored,
+			HandlerFunc: httpd.ServeOptions,
+		},
+		{
+			Method:      "GET",
+			Pattern:     usersPath,
+			HandlerFunc: s.handleListUsers,
+		},
+		{
+			Method:      "POST",
+			Pattern:     usersPath,
+			HandlerFunc: s.handleCreateUser,
+		},
+	}
+	return s.HTTPDService.AddRoutes(s.routes)
+}
+
+func (s *Service) Close() error {
+	if s.HTTPDService != nil {
+		s.HTTPDService.DelRoutes(s.routes)
+	}
+	return nil
+}
+
+// createAdminUser creates the configured admin user if the store has no users.
+func (s *Service) createAdminUser() error {
+	if s.adminUsername == "" {
+		return nil
+	}
+	users, err := s.users.List("", 0, 1)
+	if err != nil {
+		return errors.Wrap(err, "failed to list users")
+	}
+	if len(users) > 0 {
+		return nil
+	}
+	hash, err := bcrypt.GenerateFromPassword([]byte(s.adminPassword), s.bcryptCost)
+	if err != nil {
+		return err
+	}
+	if err := s.users.Create(User{Name: s.adminUsername, Hash: hash, Admin: true}); err != nil {
+		return errors.Wrap(err, "failed to create admin user")
+	}
+	s.diag.CreatedAdminUser(s.adminUsername)
+	return nil
+}
+
+// Authenticate returns the user if the password matches its password hash.
+func (s *Service) Authenticate(username, password string) (auth.User, error) {
+	u, err := s.users.Get(username)
+	if err != nil {
+		if err == ErrNoUserExists {
+			return auth.User{}, errAuthenticationFailed
+		}
+		return auth.User{}, err
+	}
+	sum := sha256.Sum256([]byte(password))
+
+	s.mu.Lock()
+	cached, ok := s.authCache[username]
+	s.mu.Unlock()
+	if ok && cached.password == sum && bytes.Equal(cached.hash, u.Hash) {
+		return u.AuthUser(), nil
+	}
+
+	if err := bcrypt.CompareHashAndPassword(u.Hash, []byte(password)); err != nil {
+		return auth.User{}, errAuthenticationFailed
+	}
+	s.mu.Lock()
+	s.authCache[username] = authCacheEntry{hash: u.Hash, password: sum}
+	s.mu.Unlock()
+	return u.AuthUser(), nil
+}
+
+// User returns the user without checking its password.
+func (s *Service) User(username string) (auth.User, error) {
+	u, err := s.users.Get(username)
+	if err != nil {
+		return auth.User{}, err
+	}
+	return u.AuthUser(), nil
+}
+
+// SubscriptionUser returns a user that can write to the databases the token was granted access to.
+func (s *Service) SubscriptionUser(token string) (auth.User, error) {
+	t, err := s.tokens.Get(token)
+	if err != nil {
+		if err == ErrNoSubscriptionTokenExists {
+			return auth.User{}, errAuthenticationFailed
+		}
+		return auth.User{}, err
+	}
+	return t.AuthUser(httpd.SubscriptionUser), nil
+}
+
+func (s *Service) GrantSubscriptionAccess(token, db, rp string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	t, err := s.tokens.Get(token)
+	if err == ErrNoSubscriptionTokenExists {
+		t = SubscriptionToken{Token: token}
+	} else if err != nil {
+		return err
+	}
+	dbrp := DBRP{Database: db, RetentionPolicy: rp}
+	for _, existing := range t.DBRPs {
+		if existing == dbrp {
+			return nil
+		}
+	}
+	t.DBRPs = append(t.DBRPs, dbrp)
+	return s.tokens.Put(t)
+}
+
+func (s *Service) ListSubscriptionTokens() ([]string, error) {
+	var all []string
+	for offset := 0; ; offset += tokenListLimit {
+		tokens, err := s.tokens.List(offset, tokenListLimit)
+		if err != nil {
+			return nil, err
+		}
+		for _, t := range tokens {
+			all = append(all, t.Token)
+		}
+		if len(tokens) != tokenListLimit {
+			return all, nil
+		}
+	}
+}
+
+func (s *Service) RevokeSubscriptionAccess(token string) error {
+	return s.tokens.Delete(token)
+}
+
+func (s *Service) userLink(name string) client.Link {
+	return client.Link{Relation: client.Self, Href: path.Join(httpd.BasePath, usersPath, name)}
+}
+
+func (s *Service) userNameFromPath(p string) (string, error) {
+	if len(p) <= len(usersBasePath) {
+		return "", errors.New("must specify user name on path")
+	}
+	return p[len(usersBasePath):], nil
+}
+
+func (s *Service) convertUser(u User) client.User {
+	grants := make([]client.UserGrant, len(u.Grants))
+	for i, g := range u.Grants {
+		grants[i] = client.UserGrant{
+			API:        g.API,
+			Database:   g.Database,
+			Privileges: make([]client.Privilege, len(g.Privileges)),
+		}
+		for j, p := range g.Privileges {
+			grants[i].Privileges[j] = client.Privilege(p.String())
+		}
+	}
+	return client.User{
+		Link:   s.userLink(u.Name),
+		Name:   u.Name,
+		Admin:  u.Admin,
+		Grants: grants,
+	}
+}
+
+func convertGrants(cgrants []client.UserGrant) ([]Grant, error) {
+	grants := make([]Grant, len(cgrants))
+	for i, cg := range cgrants {
+		grants[i] = Grant{
+			API:        cg.API,
+			Database:   cg.Database,
+			Privileges: make([]auth.Privilege, len(cg.Privileges)),
+		}
+		if cg.API != "" && !path.IsAbs(cg.API) {
+			return nil, fmt.Errorf("grant api %q must be an absolute path", cg.API)
+		}
+		for j, cp := range cg.Privileges {
+			p, err := auth.ParsePrivilege(string(cp))
+			if err != nil {
+				return nil, err
+			}
+			grants[i].Privileges[j] = p
+		}
+	}
+	return grants, nil
+}
+
+func (s *Service) handleListUsers(w http.ResponseWriter, r *http.Request) {
+	pattern := r.URL.Query().Get("pattern")
+
+	var err error
+	offset := int64(0)
+	offsetStr := r.URL.Query().Get("offset")
+	if offsetStr != "" {
+		offset, err = strconv.ParseInt(offsetStr, 10, 64)
+		if err != nil {
+			httpd.HttpError(w, fmt.Sprintf("invalid offset parameter %q must be an integer: %s", offsetStr, err), true, http.StatusBadRequest)
+			return
+		}
+	}
+
+	limit := int64(100)
+	limitStr := r.URL.Query().Get("limit")
+	if limitStr != "" {
+		limit, err = strconv.ParseInt(limitStr, 10, 64)
+		if err != nil {
+			httpd.HttpError(w, fmt.Sprintf("invalid limit parameter %q must be an integer: %s", limitStr, err), true, http.StatusBadRequest)
+			return
+		}
+	}
+
+	users, err := s.users.List(pattern, int(offset), int(limit))
+	if err != nil {
+		httpd.HttpError(w, fmt.Sprintf("failed to list users with pattern %q: %s", pattern, err), true, http.StatusBadRequest)
+		return
+	}
+	response := struct {
+		Users []client.User `json:"users"`
+	}{
+		Users: make([]client.User, len(users)),
+	}
+	for i, u := range users {
+		response.Users[i] = s.convertUser(u)
+	}
+	w.Write(httpd.MarshalJSON(response, true))
+}
+
+func (s *Service) handleUser(w http.ResponseWriter, r *http.Request) {
+	name, err := s.userNameFromPath(r.URL.Path)
+	if err != nil {
+		httpd.HttpError(w, err.Error(), true, http.StatusBadRequest)
+		return
+	}
+	u, err := s.users.Get(name)
+	if err == ErrNoUserExists {
+		httpd.HttpError(w, fmt.Sprintf("user %s does not exist", name), true, http.StatusNotFound)
+		return
+	} else if err != nil {
+		httpd.HttpError(w, err.Error(), true, http.StatusInternalServerError)
+		return
+	}
+	w.Write(httpd.MarshalJSON(s.convertUser(u), true))
+}
+
+// errAdminRequired is returned when a user that is not an admin manages users.
+var errAdminRequired = errors.New("only admin users can manage users")
+
+func (s *Service) handleCreateUser(w http.ResponseWriter, r *http.Request, user auth.User) {
+	// Any privilege granted by a non admin could escalate its own privileges.
+	if !user.IsAdmin() {
+		httpd.HttpError(w, errAdminRequired.Error(), true, http.StatusForbidden)
+		return
+	}
+	opts := client.CreateUserOptions{}
+	if err := json.NewDecoder(r.Body).Decode(&opts); err != nil {
+		httpd.HttpError(w, "invalid JSON: "+err.Error(), true, http.StatusBadRequest)
+		return
+	}
+	if opts.Password == "" {
+		httpd.HttpError(w, "must provide a password", true, http.StatusBadRequest)
+		return
+	}
+	grants, err := convertGrants(opts.Grants)
+	if err != nil {
+		httpd.HttpError(w, err.Error(), true, http.StatusBadRequest)
+		return
+	}
+	hash, err := bcrypt.GenerateFromPassword([]byte(opts.Password), s.bcryptCost)
+	if err != nil {
+		httpd.HttpError(w, err.Error(), true, http.StatusInternalServerError)
+		return
+	}
+	u := User{
+		Name:   opts.Name,
+		Hash:   hash,
+		Admin:  opts.Admin,
+		Grants: grants,
+	}
+	if err := u.Validate(); err != nil {
+		httpd.HttpError(w, err.Error(), true, http.StatusBadRequest)
+		return
+	}
+	if err := s.users.Create(u); err != nil {
+		code := http.StatusInternalServerError
+		if err == ErrUserExists {
+			code = http.StatusBadRequest
+		}
+		httpd.HttpError(w, err.Error(), true, code)
+		return
+	}
+	w.Write(httpd.MarshalJSON(s.convertUser(u), true))
+}
+
+func (s *Service) handleUpdateUser(w http.ResponseWriter, r *http.Request, user auth.User) {
+	name, err := s.userNameFromPath(r.URL.Path)
+	if err != nil {
+		httpd.HttpError(w, err.Error(), true, http.StatusBadRequest)
+		return
+	}
+	opts := client.UpdateUserOptions{}
+	if err := json.NewDecoder(r.Body).Decode(&opts); err != nil {
+		httpd.HttpError(w, "invalid JSON: "+err.Error(), true, http.StatusBadRequest)
+		return
+	}
+	// Users that are not admins can only change their own password.
+	if !user.IsAdmin() && (name != user.Name() || opts.Admin != nil || opts.Grants != nil) {
+		httpd.HttpError(w, errAdminRequired.Error(), true, http.StatusForbidden)
+		return
+	}
+	u, err := s.users.Get(name)
+	if err == ErrNoUserExists {
+		httpd.HttpError(w, fmt.Sprintf("user %s does not exist", name), true, http.StatusNotFound)
+		return
+	} else if err != nil {
+		httpd.HttpError(w, err.Error(), true, http.StatusInternalServerError)
+		return
+	}
+	if opts.Password != "" {
+		hash, err := bcrypt.GenerateFromPassword([]byte(opts.Password), s.bcryptCost)
+		if err != nil {
+			httpd.HttpError(w, err.Error(), true, http.StatusInternalServerError)
+			return
+		}
+		u.Hash = hash
+	}
+	if opts.Admin != nil {
+		u.Admin = *opts.Admin
+	}
+	if opts.Grants != nil {
+		grants, err := convertGrants(opts.Grants)
+		if err != nil {
+			httpd.HttpError(w, err.Error(), true, http.StatusBadRequest)
+			return
+		}
+		u.Grants = grants
+	}
+	if err := u.Validate(); err != nil {
+		httpd.HttpError(w, err.Error(), true, http.StatusBadRequest)
+		return
+	}
+	if err := s.users.Replace(u); err != nil {
+		httpd.HttpError(w, err.Error(), true, http.StatusInternalServerError)
+		return
+	}
+	w.Write(httpd.MarshalJSON(s.convertUser(u), true))
+}
+
+func (s *Service) handleDeleteUser(w http.ResponseWriter, r *http.Request, user auth.User) {
+	if !user.IsAdmin() {
+		httpd.HttpError(w, errAdminRequired.Error(), true, http.StatusForbidden)
+		return
+	}
+	name, err := s.userNameFromPath(r.URL.Path)
+	if err != nil {
+		httpd.HttpError(w, err.Error(), true, http.StatusBadRequest)
+		return
+	}
+	if err := s.users.Delete(name); err != nil {
+		httpd.HttpError(w, err.Error(), true, http.StatusInternalServerError)
+		return
+	}
+	s.mu.Lock()
+	delete(s.authCache, name)
+	s.mu.Unlock()
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,307 @@
+// Package sketch provides a quantile sketch with bounded memory and relative accuracy.
+//
+// The sketch is a DDSketch, see https://arxiv.org/abs/1908.10693.
+// Values are counted in logarithmically sized bins, so that any quantile
+// is returned within the relative accuracy of the true value.
+// When more than the maximum number of bins are needed the lowest bins are collapsed,
+// which only affects the accuracy of the quantiles of the smallest values.
+package sketch
+
+import (
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+)
+
+const (
+	// DefaultAccuracy is the default relative accuracy of the quantiles.
+	DefaultAccuracy = 0.01
+	// DefaultMaxBins is the default maximum number of bins of each sign.
+	DefaultMaxBins = 2048
+
+	// encodingVersion is the first byte of an encoded sketch.
+	encodingVersion = 1
+)
+
+// DDSketch is a quantile sketch. The zero value is not usable, use New.
+type DDSketch struct {
+	accuracy float64
+	maxBins  int
+	gamma    float64
+	logGamma float64
+
+	positive store
+	negative store
+	zeros    uint64
+}
+
+// New returns an empty sketch with the relative accuracy and maximum number of bins.
+func New(accuracy float64, maxBins int) (*DDSketch, error) {
+	if accuracy <= 0 || accuracy >= 1 {
+		return nil, fmt.Errorf("accuracy must be > 0 and < 1, got %v", accuracy)
+	}
+	if maxBins < 1 {
+		return nil, fmt.Errorf("max bins must be >= 1, got %d", maxBins)
+	}
+	gamma := (1 + accuracy) / (1 - accuracy)
+	return &DDSketch{
+		accuracy: accuracy,
+		maxBins:  maxBins,
+		gamma:    gamma,
+		logGamma: math.Log(gamma),
+	}, nil
+}
+
+// Accuracy returns the relative accuracy of the sketch.
+func (s *DDSketch) Accuracy() float64 {
+	return s.accuracy
+}
+
+// Count returns the number of values added to the sketch.
+func (s *DDSketch) Count() uint64 {
+	return s.zeros + s.positive.count() + s.negative.count()
+}
+
+// Add adds a value to the sketch. NaN and infinite values are ignored.
+func (s *DDSketch) Add(v float64) {
+	s.AddN(v, 1)
+}
+
+// AddN adds a value n times to the sketch.
+func (s *DDSketch) AddN(v float64, n uint64) {
+	switch {
+	case n == 0 || math.IsNaN(v) || math.IsInf(v, 0):
+	case v > 0:
+		s.positive.add(s.index(v), n, s.maxBins)
+	case v < 0:
+		s.negative.add(s.index(-v), n, s.maxBins)
+	default:
+		s.zeros += n
+	}
+}
+
+// Merge adds the values of the other sketch to the sketch.
+// Both sketches must have the same accuracy.
+func (s *DDSketch) Merge(o *DDSketch) error {
+	if s.accuracy != o.accuracy {
+		return fmt.Errorf("cannot merge sketches with different accuracies, %v and %v", s.accuracy, o.accuracy)
+	}
+	s.zeros += o.zeros
+	s.positive.merge(&o.positive, s.maxBins)
+	s.negative.merge(&o.negative, s.maxBins)
+	return nil
+}
+
+// Quantile returns the value at the quantile q, between 0 and 1.
+// It returns NaN if the sketch is empty.
+func (s *DDSketch) Quantile(q float64) float64 {
+	count := s.Count()
+	if count == 0 || q < 0 || q > 1 {
+		return math.NaN()
+	}
+	rank := uint64(q * float64(count-1))
+
+	// Negative values are ordered from the largest magnitude down.
+	var seen uint64
+	for i := len(s.negative.counts) - 1; i >= 0; i-- {
+		seen += s.negative.counts[i]
+		if seen > rank {
+			return -s.value(s.negative.offset + i)
+		}
+	}
+	seen += s.zeros
+	if seen > rank {
+		return 0
+	}
+	for i, c := range s.positive.counts {
+		seen += c
+		if seen > rank {
+			return s.value(s.positive.offset + i)
+		}
+	}
+	// Unreachable since the rank is less than the count.
+	return math.NaN()
+}
+
+// index returns the index of the bin of a positive value.
+func (s *DDSketch) index(v float64) int {
+	return int(math.Ceil(math.Log(v) / s.logGamma))
+}
+
+// value returns the value that represents the bin of the index.
+func (s *DDSketch) value(index int) float64 {
+	return 2 * math.Pow(s.gamma, float64(index)) / (s.gamma + 1)
+}
+
+// Encode returns the sketch as a base64 string, that can be sent as a field of a point.
+func (s *DDSketch) Encode() string {
+	buf := make([]byte, 0, 32+binary.MaxVarintLen64*(len(s.positive.counts)+len(s.negative.counts)))
+	buf = append(buf, encodingVersion)
+	buf = appendUvarint(buf, math.Float64bits(s.accuracy))
+	buf = appendUvarint(buf, uint64(s.maxBins))
+	buf = appendUvarint(buf, s.zeros)
+	buf = s.positive.encode(buf)
+	buf = s.negative.encode(buf)
+	return base64.StdEncoding.EncodeToString(buf)
+}
+
+// Decode returns the sketch encoded by Encode.
+func Decode(data string) (*DDSketch, error) {
+	buf, err := base64.StdEncoding.DecodeString(data)
+	if err != nil {
+		return nil, fmt.Errorf("invalid sketch encoding: %v", err)
+	}
+	if len(buf) == 0 || buf[0] != encodingVersion {
+		return nil, errors.New("unsupported sketch encoding version")
+	}
+	d := decoder{buf: buf[1:]}
+	accuracy := math.Float64frombits(d.uvarint())
+	maxBins := d.uvarint()
+	zeros := d.uvarint()
+	if d.err != nil {
+		return nil, d.err
+	}
+	s, err := New(accuracy, int(maxBins))
+	if err != nil {
+		return nil, err
+	}
+	s.zeros = zeros
+	s.positive.decode(&d)
+	s.negative.decode(&d)
+	if d.err != nil {
+		return nil, d.err
+	}
+	return s, nil
+}
+
+// store is a dense range of bin counts, counts[i] is the count of the bin offset+i.
+type store struct {
+	offset int
+	counts []uint64
+}
+
+func (st *store) count() uint64 {
+	var c uint64
+	for _, n := range st.counts {
+		c += n
+	}
+	return c
+}
+
+func (st *store) add(index int, n uint64, maxBins int) {
+	if len(st.counts) == 0 {
+		st.offset = index
+		st.counts = append(st.counts, 0)
+	}
+	lo, hi := st.offset, st.offset+len(st.counts)-1
+	if index < lo {
+		lo = index
+	}
+	if index > hi {
+		hi = index
+	}
+	if hi-lo+1 > maxBins {
+		// Collapse the lowest bins.
+		lo = hi - maxBins + 1
+	}
+	if lo != st.offset || hi != st.offset+len(st.counts)-1 {
+		st.resize(lo, hi)
+	}
+	if index < lo {
+		index = lo
+	}
+	st.counts[index-st.offset] += n
+}
+
+// resize changes the range of bins to lo through hi, bins below lo are added to lo.
+func (st *store) resize(lo, hi int) {
+	counts := make([]uint64, hi-lo+1)
+	for i, c := range st.counts {
+		index := st.offset + i
+		if index < lo {
+			index = lo
+		}
+		counts[index-lo] += c
+	}
+	st.offset = lo
+	st.counts = counts
+}
+
+func (st *store) merge(o *store, maxBins int) {
+	for i, c := range o.counts {
+		if c > 0 {
+			st.add(o.offset+i, c, maxBins)
+		}
+	}
+}
+
+func (st *store) encode(buf []byte) []byte {
+	buf = appendVarint(buf, int64(st.offset))
+	buf = appendUvarint(buf, uint64(len(st.counts)))
+	for _, c := range st.counts {
+		buf = appendUvarint(buf, c)
+	}
+	return buf
+}
+
+func (st *store) decode(d *decoder) {
+	st.offset = int(d.varint())
+	n := d.uvarint()
+	if d.err != nil {
+		return
+	}
+	if n > uint64(len(d.buf)) {
+		d.err = errors.New("invalid sketch encoding: too many bins")
+		return
+	}
+	st.counts = make([]uint64, n)
+	for i := range st.counts {
+		st.counts[i] = d.uvarint()
+	}
+}
+
+func appendUvarint(buf []byte, v uint64) []byte {
+	var tmp [binary.MaxVarintLen64]byte
+	n := binary.PutUvarint(tmp[:], v)
+	return append(buf, tmp[:n]...)
+}
+
+func appendVarint(buf []byte, v int64) []byte {
+	var tmp [binary.MaxVarintLen64]byte
+	n := binary.PutVarint(tmp[:], v)
+	return append(buf, tmp[:n]...)
+}
+
+// decoder reads varints and keeps the first error.
+type decoder struct {
+	buf []byte
+	err error
+}
+
+func (d *decoder) uvarint() uint64 {
+	if d.err != nil {
+		return 0
+	}
+	v, n := binary.Uvarint(d.buf)
+	if n <= 0 {
+		d.err = errors.New("invalid sketch encoding: truncated")
+		return 0
+	}
+	d.buf = d.buf[n:]
+	return v
+}
+
+func (d *decoder) varint() int64 {
+	if d.err != nil {
+		return 0
+	}
+	v, n := binary.Varint(d.buf)
+	if n <= 0 {
+		d.err = errors.New("invalid sketch encoding: truncated")
+		return 0
+	}
+	d.buf = d.buf[n:]
+	return v
+}
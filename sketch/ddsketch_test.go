@@ -0,0 +1,85 @@
+package sketch
+
+import (
+	"math"
+	"math/rand"
+	"sort"
+	"testing"
+)
+
+func TestDDSketch_Quantile(t *testing.T) {
+	s, err := New(0.01, DefaultMaxBins)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := rand.New(rand.NewSource(42))
+	values := make([]float64, 10000)
+	for i := range values {
+		values[i] = r.ExpFloat64()*100 - 20
+		s.Add(values[i])
+	}
+	sort.Float64s(values)
+	if got, exp := s.Count(), uint64(len(values)); got != exp {
+		t.Fatalf("unexpected count, got %d exp %d", got, exp)
+	}
+	for _, q := range []float64{0, 0.1, 0.5, 0.9, 0.99, 0.999, 1} {
+		exp := values[int(q*float64(len(values)-1))]
+		got := s.Quantile(q)
+		if math.Abs(got-exp) > 0.01*math.Abs(exp)+1e-9 {
+			t.Errorf("unexpected quantile %v, got %v exp %v", q, got, exp)
+		}
+	}
+}
+
+func TestDDSketch_MaxBins(t *testing.T) {
+	s, err := New(0.01, 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for v := 1.0; v < 1e9; v *= 1.01 {
+		s.Add(v)
+	}
+	if l := len(s.positive.counts); l > 100 {
+		t.Fatalf("too many bins, got %d", l)
+	}
+	// High quantiles keep their accuracy.
+	if got := s.Quantile(1); math.Abs(got-1e9) > 0.02*1e9 {
+		t.Errorf("unexpected max, got %v", got)
+	}
+}
+
+func TestDDSketch_MergeEncode(t *testing.T) {
+	a, _ := New(0.02, DefaultMaxBins)
+	b, _ := New(0.02, DefaultMaxBins)
+	for i := 1; i <= 100; i++ {
+		a.Add(float64(i))
+		b.Add(float64(i + 100))
+	}
+	b.Add(0)
+	b.Add(-5)
+
+	decoded, err := Decode(b.Encode())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := a.Merge(decoded); err != nil {
+		t.Fatal(err)
+	}
+	if got := a.Count(); got != 202 {
+		t.Fatalf("unexpected count, got %d exp 202", got)
+	}
+	if got := a.Quantile(0); math.Abs(got+5) > 0.1 {
+		t.Errorf("unexpected min, got %v exp -5", got)
+	}
+	if got := a.Quantile(0.5); math.Abs(got-99) > 2 {
+		t.Errorf("unexpected median, got %v exp ~99", got)
+	}
+
+	c, _ := New(0.01, DefaultMaxBins)
+	if err := a.Merge(c); err == nil {
+		t.Error("expected error merging sketches with different accuracies")
+	}
+	if _, err := Decode("not a sketch"); err == nil {
+		t.Error("expected error decoding invalid sketch")
+	}
+}
@@ -32,17 +32,13 @@ type StateTrackingNode struct {
 }
 
 func (n *StateTrackingNode) runStateTracking(_ []byte) error {
-	consumer := edge.NewGroupedConsumer(
-		n.ins[0],
-		n,
-	)
-	n.statMap.Set(statCardinalityGauge, consumer.CardinalityVar())
+	consumer := n.newGroupedConsumer(n)
 	return consumer.Consume()
 }
 
 func (n *StateTrackingNode) NewGroup(group edge.GroupInfo, first edge.PointMeta) (edge.Receiver, error) {
 	return edge.NewReceiverFromForwardReceiverWithStats(
-		n.outs,
+		n.groupOuts(group),
 		edge.NewTimedForwardReceiver(n.timer, n.newGroup()),
 	), nil
 }
@@ -5,6 +5,7 @@ import (
 	"errors"
 	"fmt"
 	"math/rand"
+	"strings"
 	"sync"
 	"time"
 
@@ -78,6 +79,25 @@ type Task struct {
 	Type             TaskType
 	DBRPs            []DBRP
 	SnapshotInterval time.Duration
+	Limits           TaskLimits
+}
+
+// TaskLimits limits the resources a task may use.
+// A zero limit means the resource is not limited.
+type TaskLimits struct {
+	// MaxGroups is the maximum number of groups per node.
+	MaxGroups int
+	// MaxWindowPoints is the maximum number of points buffered per window.
+	MaxWindowPoints int
+	// MaxJoinBuffer is the maximum number of sets per join group waiting for their matches.
+	MaxJoinBuffer int
+	// Policy decides what happens once a limit is reached.
+	Policy edge.LimitPolicy
+}
+
+// IsZero reports whether no resource is limited.
+func (l TaskLimits) IsZero() bool {
+	return l.MaxGroups == 0 && l.MaxWindowPoints == 0 && l.MaxJoinBuffer == 0
 }
 
 func (t *Task) Dot() []byte {
@@ -348,6 +368,9 @@ func (et *ExecutingTask) ExecutionStats() (ExecutionStats, error) {
 
 	// Fill the task stats
 	executionStats.TaskStats["throughput"] = et.getThroughput()
+	if path := et.slowestPath(); len(path) > 0 {
+		executionStats.TaskStats["slowest_path"] = strings.Join(path, " -> ")
+	}
 
 	// Fill the nodes stats
 	err := et.walk(func(node Node) error {
@@ -401,8 +424,13 @@ func (et *ExecutingTask) EDot(labels bool) []byte {
 	}
 	buf.WriteString("];\n")
 
+	path := et.slowestPath()
+	slowest := make(map[string]string, len(path))
+	for i := 1; i < len(path); i++ {
+		slowest[path[i-1]] = path[i]
+	}
 	_ = et.walk(func(n Node) error {
-		n.edot(&buf, labels)
+		n.edot(&buf, labels, slowest)
 		return nil
 	})
 	buf.Write([]byte("}"))
@@ -410,6 +438,70 @@ func (et *ExecutingTask) EDot(labels bool) []byte {
 	return buf.Bytes()
 }
 
+// edgeOptions returns the options of the edges into the node.
+// The buffer size and overflow policy of the node override those of the task,
+// which are set on its source node.
+func (et *ExecutingTask) edgeOptions(n Node) edgeOptions {
+	opts := et.tm.defaultEdgeOptions()
+	opts.tracer = n.tracer()
+	var overflow string
+	// The source node is always the first node, et.source is not set until all nodes are linked.
+	for _, pn := range []pipeline.Node{et.nodes[0], n} {
+		size, o := pn.EdgeOptions()
+		if size > 0 {
+			opts.size = int(size)
+		}
+		if o != "" {
+			overflow = o
+		}
+	}
+	// The overflow policy has been validated with the pipeline.
+	_ = opts.policy.UnmarshalText([]byte(overflow))
+	return opts
+}
+
+// slowestPath returns the names of the nodes of the path through the task
+// with the largest sum of the mean queue wait and processing time of the traced messages.
+// It returns nil if tracing is disabled or nothing has been traced.
+func (et *ExecutingTask) slowestPath() []string {
+	type pathCost struct {
+		cost   float64
+		parent Node
+	}
+	costs := make(map[Node]pathCost, len(et.nodes))
+	var slowest Node
+	// The nodes are walked in order, so the parents of a node are walked before it.
+	_ = et.walk(func(n Node) error {
+		t := n.tracer()
+		if t == nil {
+			return nil
+		}
+		wait, processing := t.QueueWait.Snapshot(), t.Processing.Snapshot()
+		if wait.Count == 0 && processing.Count == 0 {
+			return nil
+		}
+		c := pathCost{cost: wait.Mean() + processing.Mean()}
+		var parentCost float64
+		for _, pp := range n.Parents() {
+			p := et.lookup[pp.ID()]
+			if pc, ok := costs[p]; ok && (c.parent == nil || pc.cost > parentCost) {
+				c.parent, parentCost = p, pc.cost
+			}
+		}
+		c.cost += parentCost
+		costs[n] = c
+		if slowest == nil || c.cost > costs[slowest].cost {
+			slowest = n
+		}
+		return nil
+	})
+	var path []string
+	for n := slowest; n != nil; n = costs[n].parent {
+		path = append([]string{n.Name()}, path...)
+	}
+	return path
+}
+
 // Return the current throughput value.
 func (et *ExecutingTask) getThroughput() float64 {
 	et.tmu.RLock()
@@ -504,10 +596,22 @@ func (et *ExecutingTask) createNode(p pipeline.Node, d NodeDiagnostic) (n Node,
 		n, err = newK8sAutoscaleNode(et, t, d)
 	case *pipeline.SwarmAutoscaleNode:
 		n, err = newSwarmAutoscaleNode(et, t, d)
+	case *pipeline.HTTPAutoscaleNode:
+		n, err = newHTTPAutoscaleNode(et, t, d)
 	case *pipeline.StateDurationNode:
 		n, err = newStateDurationNode(et, t, d)
 	case *pipeline.StateCountNode:
 		n, err = newStateCountNode(et, t, d)
+	case *pipeline.AnomalyNode:
+		n, err = newAnomalyNode(et, t, d)
+	case *pipeline.ForecastNode:
+		n, err = newForecastNode(et, t, d)
+	case *pipeline.QuantilesNode:
+		n, err = newQuantilesNode(et, t, d)
+	case *pipeline.CounterNode:
+		n, err = newCounterNode(et, t, d)
+	case *pipeline.TopKNode:
+		n, err = newTopKNode(et, t, d)
 	default:
 		return nil, fmt.Errorf("unknown pipeline node type %T", p)
 	}
@@ -4,6 +4,7 @@ import (
 	"errors"
 	"fmt"
 	"log"
+	"math/rand"
 	"sync"
 	"time"
 
@@ -177,6 +178,14 @@ type TaskMaster struct {
 
 	DefaultRetentionPolicy string
 
+	// EdgeTransport creates the edges between the nodes of the tasks.
+	// If nil edge.NewBufferedEdge is used.
+	EdgeTransport edge.Transport
+
+	// TraceSampleRate is the fraction of the points and batches that are traced through the nodes of the tasks.
+	// If 0 nothing is traced.
+	TraceSampleRate float64
+
 	// Incoming streams
 	writePointsIn StreamCollector
 	writesClosed  bool
@@ -240,6 +249,8 @@ func NewTaskMaster(id string, info vars.Infoer, d Diagnostic) *TaskMaster {
 func (tm *TaskMaster) New(id string) *TaskMaster {
 	n := NewTaskMaster(id, tm.ServerInfo, tm.diag)
 	n.DefaultRetentionPolicy = tm.DefaultRetentionPolicy
+	n.EdgeTransport = tm.EdgeTransport
+	n.TraceSampleRate = tm.TraceSampleRate
 	n.HTTPDService = tm.HTTPDService
 	n.TaskStore = tm.TaskStore
 	n.DeadmanService = tm.DeadmanService
@@ -459,7 +470,7 @@ func (tm *TaskMaster) StartTask(t *Task) (*ExecutingTask, error) {
 	var ins []edge.StatsEdge
 	switch et.Task.Type {
 	case StreamTask:
-		e, err := tm.newFork(et.Task.ID, et.Task.DBRPs, et.Task.Measurements())
+		e, err := tm.newFork(et.Task.ID, et.Task.DBRPs, et.Task.Measurements(), et.edgeOptions(et.source))
 		if err != nil {
 			return nil, err
 		}
@@ -470,9 +481,10 @@ func (tm *TaskMaster) StartTask(t *Task) (*ExecutingTask, error) {
 			return nil, err
 		}
 		ins = make([]edge.StatsEdge, count)
+		batcher := et.source.(*BatchNode)
 		for i := 0; i < count; i++ {
 			d := tm.diag.WithEdgeContext(t.ID, "batch", fmt.Sprintf("batch%d", i))
-			in := newEdge(t.ID, "batch", fmt.Sprintf("batch%d", i), pipeline.BatchEdge, defaultEdgeBufferSize, d)
+			in := newEdge(t.ID, "batch", fmt.Sprintf("batch%d", i), pipeline.BatchEdge, et.edgeOptions(batcher.children[i]), d)
 			ins[i] = in
 			tm.batches[t.ID] = append(tm.batches[t.ID], &batchCollector{edge: in})
 		}
@@ -596,7 +608,7 @@ func (tm *TaskMaster) stream(name string) (StreamCollector, error) {
 		return nil, ErrTaskMasterClosed
 	}
 	d := tm.diag.WithEdgeContext(fmt.Sprintf("task_master:%s", tm.id), name, "stream")
-	in := newEdge(fmt.Sprintf("task_master:%s", tm.id), name, "stream", pipeline.StreamEdge, defaultEdgeBufferSize, d)
+	in := newEdge(fmt.Sprintf("task_master:%s", tm.id), name, "stream", pipeline.StreamEdge, tm.defaultEdgeOptions(), d)
 	se := &streamEdge{edge: in}
 	tm.wg.Add(1)
 	go func() {
@@ -654,6 +666,8 @@ func (tm *TaskMaster) forkPoint(p edge.PointMessage) {
 		}
 	}()
 
+	tm.trace(p)
+
 	// Create the fork keys - which is (db, rp, measurement)
 	key := forkKey{
 		Database:        p.Database(),
@@ -707,6 +721,16 @@ func (tm *TaskMaster) forkPoint(p edge.PointMessage) {
 	c.Add(1)
 }
 
+// trace starts a trace of the message at its ingest, if it is sampled.
+func (tm *TaskMaster) trace(m edge.Message) {
+	if tm.TraceSampleRate <= 0 || rand.Float64() >= tm.TraceSampleRate {
+		return
+	}
+	if t, ok := m.(edge.Traced); ok {
+		t.SetTrace(&edge.Trace{Ingest: time.Now()})
+	}
+}
+
 func (tm *TaskMaster) WritePoints(database, retentionPolicy string, consistencyLevel imodels.ConsistencyLevel, points []imodels.Point) error {
 	tm.writesMu.RLock()
 	defer tm.writesMu.RUnlock()
@@ -748,7 +772,7 @@ func (tm *TaskMaster) WriteKapacitorPoint(p edge.PointMessage) error {
 func (tm *TaskMaster) NewFork(taskName string, dbrps []DBRP, measurements []string) (edge.StatsEdge, error) {
 	tm.mu.Lock()
 	defer tm.mu.Unlock()
-	return tm.newFork(taskName, dbrps, measurements)
+	return tm.newFork(taskName, dbrps, measurements, tm.defaultEdgeOptions())
 }
 
 func forkKeys(dbrps []DBRP, measurements []string) []forkKey {
@@ -769,14 +793,22 @@ func forkKeys(dbrps []DBRP, measurements []string) []forkKey {
 	return keys
 }
 
+// defaultEdgeOptions returns the options of the edges that are not part of a task.
+func (tm *TaskMaster) defaultEdgeOptions() edgeOptions {
+	return edgeOptions{
+		size:      defaultEdgeBufferSize,
+		transport: tm.EdgeTransport,
+	}
+}
+
 // internal newFork, must have acquired lock before calling.
-func (tm *TaskMaster) newFork(taskName string, dbrps []DBRP, measurements []string) (edge.StatsEdge, error) {
+func (tm *TaskMaster) newFork(taskName string, dbrps []DBRP, measurements []string, opts edgeOptions) (edge.StatsEdge, error) {
 	if tm.closed {
 		return nil, ErrTaskMasterClosed
 	}
 
 	d := tm.diag.WithEdgeContext(taskName, "stream", "stream0")
-	e := newEdge(taskName, "stream", "stream0", pipeline.StreamEdge, defaultEdgeBufferSize, d)
+	e := newEdge(taskName, "stream", "stream0", pipeline.StreamEdge, opts, d)
 
 	for _, key := range forkKeys(dbrps, measurements) {
 		tm.taskToForkKeys[taskName] = append(tm.taskToForkKeys[taskName], key)
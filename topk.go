@@ -0,0 +1,281 @@
+package kapacitor
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/influxdata/kapacitor/edge"
+	"github.com/influxdata/kapacitor/models"
+	"github.com/influxdata/kapacitor/pipeline"
+)
+
+type TopKNode struct {
+	node
+	t *pipeline.TopKNode
+
+	every time.Duration
+}
+
+// Create a new TopKNode which ranks the largest keys of a stream.
+func newTopKNode(et *ExecutingTask, n *pipeline.TopKNode, d NodeDiagnostic) (*TopKNode, error) {
+	tn := &TopKNode{
+		node:  node{Node: n, et: et, diag: d},
+		t:     n,
+		every: n.Every,
+	}
+	if tn.every == 0 {
+		tn.every = n.Period
+	}
+	tn.node.runF = tn.runTopK
+	return tn, nil
+}
+
+func (n *TopKNode) runTopK([]byte) error {
+	consumer := n.newGroupedConsumer(n)
+	return consumer.Consume()
+}
+
+func (n *TopKNode) NewGroup(group edge.GroupInfo, first edge.PointMeta) (edge.Receiver, error) {
+	return edge.NewReceiverFromForwardReceiverWithStats(
+		n.outs,
+		edge.NewTimedForwardReceiver(n.timer, &topKGroup{
+			n:     n,
+			name:  first.Name(),
+			group: group,
+		}),
+	), nil
+}
+
+// topKInterval holds the counters of the points within an Every long interval.
+type topKInterval struct {
+	start    time.Time
+	counters *spaceSaving
+}
+
+type topKGroup struct {
+	n     *TopKNode
+	name  string
+	group edge.GroupInfo
+
+	// The intervals within the period, oldest first.
+	intervals []topKInterval
+}
+
+func (g *topKGroup) BeginBatch(begin edge.BeginBatchMessage) (edge.Message, error) {
+	return nil, fmt.Errorf("topk node does not accept batch data")
+}
+
+func (g *topKGroup) BatchPoint(bp edge.BatchPointMessage) (edge.Message, error) {
+	return nil, fmt.Errorf("topk node does not accept batch data")
+}
+
+func (g *topKGroup) EndBatch(end edge.EndBatchMessage) (edge.Message, error) {
+	return nil, fmt.Errorf("topk node does not accept batch data")
+}
+
+func (g *topKGroup) Point(p edge.PointMessage) (edge.Message, error) {
+	start := p.Time().Truncate(g.n.every)
+
+	var msg edge.Message
+	if l := len(g.intervals); l == 0 || start.After(g.intervals[l-1].start) {
+		if l > 0 {
+			msg = g.emit(g.intervals[l-1].start.Add(g.n.every))
+		}
+		// Drop the intervals that are no longer within the period.
+		oldest := start.Add(g.n.every - g.n.t.Period)
+		i := 0
+		for i < len(g.intervals) && g.intervals[i].start.Before(oldest) {
+			i++
+		}
+		g.intervals = append(g.intervals[:0], g.intervals[i:]...)
+		g.intervals = append(g.intervals, topKInterval{
+			start:    start,
+			counters: newSpaceSaving(int(g.n.t.Capacity)),
+		})
+	}
+
+	weight, ok := numToFloat(p.Fields()[g.n.t.Field])
+	if !ok {
+		g.n.diag.Error("failed to rank point",
+			fmt.Errorf("field %q is missing or not a number, got %T", g.n.t.Field, p.Fields()[g.n.t.Field]))
+		return msg, nil
+	}
+	// Points of past intervals are added to their interval, if it is still within the period.
+	for i := len(g.intervals) - 1; i >= 0; i-- {
+		if !g.intervals[i].start.After(start) {
+			if g.intervals[i].start.Equal(start) {
+				key, tags := g.key(p.Tags())
+				g.intervals[i].counters.add(key, tags, weight)
+			}
+			break
+		}
+	}
+	return msg, nil
+}
+
+// key returns the key of the By tags and the tags of the key.
+func (g *topKGroup) key(tags models.Tags) (string, models.Tags) {
+	values := make([]string, len(g.n.t.ByTags))
+	keyTags := make(models.Tags, len(g.n.t.ByTags))
+	for i, tag := range g.n.t.ByTags {
+		values[i] = tags[tag]
+		keyTags[tag] = tags[tag]
+	}
+	return strings.Join(values, "\x00"), keyTags
+}
+
+// emit returns the ranked batch of the period that ends at end.
+func (g *topKGroup) emit(end time.Time) edge.Message {
+	start := end.Add(-g.n.t.Period)
+	merged := newSpaceSaving(int(g.n.t.Capacity))
+	for _, i := range g.intervals {
+		if !i.start.Before(start) {
+			merged.merge(i.counters)
+		}
+	}
+	top := merged.top(int(g.n.t.K))
+	points := make([]edge.BatchPointMessage, len(top))
+	for i, c := range top {
+		tags := g.group.Tags.Copy()
+		if tags == nil {
+			tags = make(models.Tags, len(c.tags))
+		}
+		for k, v := range c.tags {
+			tags[k] = v
+		}
+		points[i] = edge.NewBatchPointMessage(
+			models.Fields{
+				g.n.t.As: c.count,
+				"rank":   int64(i + 1),
+			},
+			tags,
+			end,
+		)
+	}
+	return edge.NewBufferedBatchMessage(
+		edge.NewBeginBatchMessage(
+			g.name,
+			g.group.Tags,
+			g.group.Dimensions.ByName,
+			end,
+			len(points),
+		),
+		points,
+		edge.NewEndBatchMessage(),
+	)
+}
+
+func (g *topKGroup) Barrier(b edge.BarrierMessage) (edge.Message, error) {
+	return b, nil
+}
+
+func (g *topKGroup) DeleteGroup(d edge.DeleteGroupMessage) (edge.Message, error) {
+	return d, nil
+}
+
+// spaceSaving estimates the sums of the largest keys with a fixed number of counters.
+// When a new key arrives and all counters are used, the counter with the smallest sum
+// is given to the new key, which overestimates the sum of the new key by at most that sum.
+type spaceSaving struct {
+	capacity int
+	counters map[string]*spaceSavingCounter
+}
+
+type spaceSavingCounter struct {
+	key   string
+	tags  models.Tags
+	count float64
+}
+
+func newSpaceSaving(capacity int) *spaceSaving {
+	return &spaceSaving{
+		capacity: capacity,
+		counters: make(map[string]*spaceSavingCounter, capacity),
+	}
+}
+
+// add adds the weight to the sum of the key. Weights that are not positive are ignored.
+func (s *spaceSaving) add(key string, tags models.Tags, weight float64) {
+	if weight <= 0 {
+		return
+	}
+	if c, ok := s.counters[key]; ok {
+		c.count += weight
+		return
+	}
+	if len(s.counters) < s.capacity {
+		s.counters[key] = &spaceSavingCounter{
+			key:   key,
+			tags:  tags,
+			count: weight,
+		}
+		return
+	}
+	min := s.min()
+	delete(s.counters, min.key)
+	s.counters[key] = &spaceSavingCounter{
+		key:   key,
+		tags:  tags,
+		count: min.count + weight,
+	}
+}
+
+// min returns the counter with the smallest sum.
+func (s *spaceSaving) min() *spaceSavingCounter {
+	var min *spaceSavingCounter
+	for _, c := range s.counters {
+		if min == nil || c.count < min.count || (c.count == min.count && c.key < min.key) {
+			min = c
+		}
+	}
+	return min
+}
+
+// merge adds the counters of o, keeping the counters with the largest sums.
+func (s *spaceSaving) merge(o *spaceSaving) {
+	for key, c := range o.counters {
+		if m, ok := s.counters[key]; ok {
+			m.count += c.count
+			continue
+		}
+		s.counters[key] = &spaceSavingCounter{
+			key:   key,
+			tags:  c.tags,
+			count: c.count,
+		}
+	}
+	if len(s.counters) > s.capacity {
+		top := s.top(s.capacity)
+		s.counters = make(map[string]*spaceSavingCounter, s.capacity)
+		for _, c := range top {
+			s.counters[c.key] = c
+		}
+	}
+}
+
+// top returns the k counters with the largest sums, largest first.
+func (s *spaceSaving) top(k int) []*spaceSavingCounter {
+	sorted := make([]*spaceSavingCounter, 0, len(s.counters))
+	for _, c := range s.counters {
+		sorted = append(sorted, c)
+	}
+	sort.Sort(byCount(sorted))
+	if len(sorted) > k {
+		sorted = sorted[:k]
+	}
+	return sorted
+}
+
+// byCount sorts the counters by descending count and then by key.
+type byCount []*spaceSavingCounter
+
+func (c byCount) Len() int      { return len(c) }
+func (c byCount) Swap(i, j int) { c[i], c[j] = c[j], c[i] }
+func (c byCount) Less(i, j int) bool {
+	if c[i].count != c[j].count {
+		return c[i].count > c[j].count
+	}
+	return c[i].key < c[j].key
+}
@@ -0,0 +1,52 @@
+package kapacitor
+
+import (
+	"testing"
+)
+
+func TestSpaceSaving(t *testing.T) {
+	s := newSpaceSaving(3)
+	for _, e := range []struct {
+		key    string
+		weight float64
+	}{
+		{"a", 10},
+		{"b", 5},
+		{"c", 1},
+		// Replaces the counter of c, overestimating d by its sum.
+		{"d", 2},
+		{"a", 10},
+		{"e", -1},
+	} {
+		s.add(e.key, nil, e.weight)
+	}
+	top := s.top(3)
+	exp := []struct {
+		key   string
+		count float64
+	}{
+		{"a", 20},
+		{"b", 5},
+		{"d", 3},
+	}
+	if len(top) != len(exp) {
+		t.Fatalf("unexpected number of counters, got %d exp %d", len(top), len(exp))
+	}
+	for i, c := range top {
+		if c.key != exp[i].key || c.count != exp[i].count {
+			t.Errorf("unexpected counter %d, got %s=%v exp %s=%v", i, c.key, c.count, exp[i].key, exp[i].count)
+		}
+	}
+
+	o := newSpaceSaving(3)
+	o.add("b", nil, 30)
+	o.add("f", nil, 1)
+	s.merge(o)
+	top = s.top(2)
+	if top[0].key != "b" || top[0].count != 35 || top[1].key != "a" {
+		t.Errorf("unexpected merged counters, got %s=%v %s=%v", top[0].key, top[0].count, top[1].key, top[1].count)
+	}
+	if len(s.counters) != 3 {
+		t.Errorf("expected merged counters to be limited to the capacity, got %d", len(s.counters))
+	}
+}
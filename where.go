@@ -41,18 +41,14 @@ func newWhereNode(et *ExecutingTask, n *pipeline.WhereNode, d NodeDiagnostic) (w
 }
 
 func (n *WhereNode) runWhere(snapshot []byte) error {
-	consumer := edge.NewGroupedConsumer(
-		n.ins[0],
-		n,
-	)
-	n.statMap.Set(statCardinalityGauge, consumer.CardinalityVar())
+	consumer := n.newGroupedConsumer(n)
 
 	return consumer.Consume()
 }
 
 func (n *WhereNode) NewGroup(group edge.GroupInfo, first edge.PointMeta) (edge.Receiver, error) {
 	return edge.NewReceiverFromForwardReceiverWithStats(
-		n.outs,
+		n.groupOuts(group),
 		edge.NewTimedForwardReceiver(n.timer, n.newGroup()),
 	), nil
 }
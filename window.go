@@ -6,13 +6,31 @@ import (
 	"time"
 
 	"github.com/influxdata/kapacitor/edge"
+	"github.com/influxdata/kapacitor/expvar"
 	"github.com/influxdata/kapacitor/models"
 	"github.com/influxdata/kapacitor/pipeline"
 )
 
+const (
+	statBufferedPoints = "buffered_points"
+	statPointsDropped  = "points_dropped"
+	statPointsEvicted  = "points_evicted"
+)
+
 type WindowNode struct {
 	node
 	w *pipeline.WindowNode
+
+	limits windowLimits
+}
+
+// windowLimits limits the number of points buffered by each window.
+type windowLimits struct {
+	maxPoints int
+	policy    edge.LimitPolicy
+	buffered  *expvar.Int
+	dropped   *expvar.Int
+	evicted   *expvar.Int
 }
 
 // Create a new  WindowNode, which windows data for a period of time and emits the window.
@@ -20,17 +38,32 @@ func newWindowNode(et *ExecutingTask, n *pipeline.WindowNode, d NodeDiagnostic)
 	if n.Period == 0 && n.PeriodCount == 0 {
 		return nil, errors.New("window node must have either a non zero period or non zero period count")
 	}
+	limits := et.Task.Limits
+	if limits.MaxWindowPoints > 0 && n.PeriodCount > int64(limits.MaxWindowPoints) {
+		return nil, fmt.Errorf("window period count %d exceeds the task limit of %d window points", n.PeriodCount, limits.MaxWindowPoints)
+	}
 	wn := &WindowNode{
 		w:    n,
 		node: node{Node: n, et: et, diag: d},
+		limits: windowLimits{
+			maxPoints: limits.MaxWindowPoints,
+			policy:    limits.Policy,
+			buffered:  new(expvar.Int),
+			dropped:   new(expvar.Int),
+			evicted:   new(expvar.Int),
+		},
 	}
 	wn.node.runF = wn.runWindow
 	return wn, nil
 }
 
 func (n *WindowNode) runWindow([]byte) error {
-	consumer := edge.NewGroupedConsumer(n.ins[0], n)
-	n.statMap.Set(statCardinalityGauge, consumer.CardinalityVar())
+	consumer := n.newGroupedConsumer(n)
+	if n.limits.maxPoints > 0 {
+		n.statMap.Set(statBufferedPoints, n.limits.buffered)
+		n.statMap.Set(statPointsDropped, n.limits.dropped)
+		n.statMap.Set(statPointsEvicted, n.limits.evicted)
+	}
 	return consumer.Consume()
 }
 
@@ -60,6 +93,7 @@ func (n *WindowNode) newWindow(group edge.GroupInfo, first edge.PointMeta) (edge
 			n.w.Every,
 			n.w.AlignFlag,
 			n.w.FillPeriodFlag,
+			n.limits,
 			n.diag,
 		), nil
 	case n.w.PeriodCount != 0:
@@ -90,6 +124,8 @@ type windowByTime struct {
 	period time.Duration
 	every  time.Duration
 
+	limits windowLimits
+
 	diag NodeDiagnostic
 }
 
@@ -101,6 +137,7 @@ func newWindowByTime(
 	every time.Duration,
 	align,
 	fillPeriod bool,
+	limits windowLimits,
 	d NodeDiagnostic,
 
 ) *windowByTime {
@@ -132,6 +169,7 @@ func newWindowByTime(
 		fillPeriod: fillPeriod,
 		period:     period,
 		every:      every,
+		limits:     limits,
 		diag:       d,
 	}
 }
@@ -150,18 +188,49 @@ func (w *windowByTime) Barrier(b edge.BarrierMessage) (edge.Message, error) {
 	return b, nil
 }
 func (w *windowByTime) DeleteGroup(d edge.DeleteGroupMessage) (edge.Message, error) {
+	// Release the buffered points of the group.
+	w.limits.buffered.Add(-int64(w.buf.size))
 	return d, nil
 }
 
+// insert the point into the buffer, reports false if the point was dropped because of the window point limit.
+func (w *windowByTime) insert(p edge.PointMessage) (bool, error) {
+	if w.limits.maxPoints > 0 && w.buf.size >= w.limits.maxPoints {
+		switch w.limits.policy {
+		case edge.DropPolicy:
+			w.limits.dropped.Add(1)
+			return false, nil
+		case edge.EvictPolicy:
+			w.buf.removeOldest()
+			w.limits.buffered.Add(-1)
+			w.limits.evicted.Add(1)
+		default:
+			return false, edge.LimitError{Resource: "window points", Limit: w.limits.maxPoints}
+		}
+	}
+	w.buf.insert(p)
+	w.limits.buffered.Add(1)
+	return true, nil
+}
+
+// purge old points from the buffer.
+func (w *windowByTime) purge(oldest time.Time, inclusive bool) {
+	size := w.buf.size
+	w.buf.purge(oldest, inclusive)
+	w.limits.buffered.Add(int64(w.buf.size - size))
+}
+
 func (w *windowByTime) Point(p edge.PointMessage) (msg edge.Message, err error) {
 	if w.every == 0 {
 		// Insert point before.
-		w.buf.insert(p)
+		if ok, err := w.insert(p); !ok {
+			return nil, err
+		}
 		// Since we are emitting every point we can use a right aligned window (oldest, now]
 		if !p.Time().Before(w.nextEmit) {
 			// purge old points
 			oldest := p.Time().Add(-1 * w.period)
-			w.buf.purge(oldest, false)
+			w.purge(oldest, false)
 
 			// get current batch
 			msg = w.batch(p.Time())
@@ -174,7 +243,7 @@ func (w *windowByTime) Point(p edge.PointMessage) (msg edge.Message, err error)
 		if !p.Time().Before(w.nextEmit) {
 			// purge old points
 			oldest := w.nextEmit.Add(-1 * w.period)
-			w.buf.purge(oldest, true)
+			w.purge(oldest, true)
 
 			// get current batch
 			msg = w.batch(w.nextEmit)
@@ -187,7 +256,9 @@ func (w *windowByTime) Point(p edge.PointMessage) (msg edge.Message, err error)
 			}
 		}
 		// Insert point after.
-		w.buf.insert(p)
+		if _, err := w.insert(p); err != nil {
+			return nil, err
+		}
 	}
 	return
 }
@@ -259,6 +330,18 @@ func (b *windowTimeBuffer) insert(p edge.PointMessage) {
 	b.stop++
 }
 
+// Remove the oldest point from the buffer.
+func (b *windowTimeBuffer) removeOldest() {
+	if b.size == 0 {
+		return
+	}
+	b.start++
+	if b.start == len(b.window) && b.stop < b.start {
+		b.start = 0
+	}
+	b.size--
+}
+
 // Purge expired data from the window.
 func (b *windowTimeBuffer) purge(oldest time.Time, inclusive bool) {
 	include := func(t time.Time) bool {
@@ -211,3 +211,43 @@ func TestWindowBufferByCount(t *testing.T) {
 		}
 	}
 }
+
+func TestWindowBufferByTime_RemoveOldest(t *testing.T) {
+	assert := assert.New(t)
+
+	buf := &windowTimeBuffer{}
+	insert := func(i int) {
+		buf.insert(edge.NewPointMessage(
+			"name", "db", "rp",
+			models.Dimensions{},
+			nil,
+			nil,
+			time.Unix(int64(i), 0),
+		))
+	}
+	for i := 1; i <= 4; i++ {
+		insert(i)
+	}
+	// Purge the first points so that new points wrap around
+	buf.purge(time.Unix(3, 0), true)
+	for i := 5; i <= 6; i++ {
+		insert(i)
+	}
+
+	for exp := 3; exp <= 6; exp++ {
+		points := buf.points()
+		if assert.Equal(6-exp+1, len(points)) {
+			assert.Equal(time.Unix(int64(exp), 0), points[0].Time())
+		}
+		buf.removeOldest()
+	}
+	assert.Equal(0, buf.size)
+	assert.Equal(0, len(buf.points()))
+
+	// The buffer is usable after it has been emptied
+	insert(7)
+	points := buf.points()
+	if assert.Equal(1, len(points)) {
+		assert.Equal(time.Unix(7, 0), points[0].Time())
+	}
+}